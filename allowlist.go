@@ -0,0 +1,225 @@
+package wgctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// defaultAllowlistInterval is the default value for PeerAllowlist.Interval.
+const defaultAllowlistInterval = 30 * time.Second
+
+// An AllowlistEventKind is the kind of an AllowlistEvent.
+type AllowlistEventKind int
+
+// Possible AllowlistEventKind values.
+const (
+	// AllowlistPeerDetected indicates that a peer which is not allowed was
+	// found on a device for the first time.
+	AllowlistPeerDetected AllowlistEventKind = iota
+
+	// AllowlistPeerRemoved indicates that a peer which is not allowed was
+	// removed from a device after its grace period.
+	AllowlistPeerRemoved
+)
+
+// String returns the name of k.
+func (k AllowlistEventKind) String() string {
+	switch k {
+	case AllowlistPeerDetected:
+		return "peer detected"
+	case AllowlistPeerRemoved:
+		return "peer removed"
+	default:
+		return fmt.Sprintf("AllowlistEventKind(%d)", int(k))
+	}
+}
+
+// An AllowlistEvent records an action taken by a PeerAllowlist, for auditing.
+type AllowlistEvent struct {
+	Kind   AllowlistEventKind
+	Device string
+
+	// Peer is the peer as it was configured when the event occurred.
+	Peer wgtypes.Peer
+
+	// FirstSeen is the time at which the peer was first found to be not
+	// allowed, and Time is the time of the event.
+	FirstSeen, Time time.Time
+}
+
+// String returns a human-readable description of e.
+func (e AllowlistEvent) String() string {
+	s := fmt.Sprintf("%s: device %q: peer %s", e.Kind, e.Device, e.Peer.PublicKey)
+	if e.Peer.Endpoint != nil {
+		s += fmt.Sprintf(" (endpoint %s)", e.Peer.Endpoint)
+	}
+
+	return s
+}
+
+// A PeerAllowlist removes peers which are not allowed from devices, so that
+// peers added out of band, such as by wg(8) set, do not persist unnoticed on
+// devices such as hubs.
+//
+// A peer which is not allowed is reported when it is first found, and is
+// removed once it has been configured for at least Grace, giving the source
+// of allowed peers time to catch up with peers added legitimately. A peer
+// which becomes allowed or is removed by other means during its grace period
+// is forgotten.
+//
+// The zero value is not usable; Allowed must be set. A PeerAllowlist is not
+// safe for concurrent use.
+type PeerAllowlist struct {
+	// Allowed reports whether the peer identified by key may remain
+	// configured on the device specified by name, such as by checking the
+	// desired configuration of the device.
+	Allowed func(device string, key wgtypes.Key) bool
+
+	// Grace is the minimum amount of time a peer which is not allowed
+	// remains configured before it is removed. If zero, peers are removed
+	// as soon as they are found.
+	Grace time.Duration
+
+	// Interval is the amount of time between calls to Enforce performed by
+	// Run. If zero or negative, a default of 30 seconds is used.
+	Interval time.Duration
+
+	// OnEvent, if set, is called for each peer which is detected or removed.
+	OnEvent func(e AllowlistEvent)
+
+	// OnError, if set, is called with any error returned by Enforce from
+	// Run. Errors do not stop Run.
+	OnError func(err error)
+
+	// seen holds the times at which peers which are not allowed were first
+	// found.
+	seen map[allowlistKey]time.Time
+
+	// now may be replaced in tests.
+	now func() time.Time
+}
+
+// An allowlistKey identifies a peer on a device.
+type allowlistKey struct {
+	device string
+	peer   wgtypes.Key
+}
+
+// Run calls Enforce for the devices specified by names immediately and then
+// every Interval until ctx is canceled. Run always returns a non-nil error.
+func (a *PeerAllowlist) Run(ctx context.Context, c *Client, names ...string) error {
+	if a.Allowed == nil {
+		return errors.New("wgctrl: PeerAllowlist.Allowed must be set")
+	}
+
+	interval := a.Interval
+	if interval <= 0 {
+		interval = defaultAllowlistInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := a.Enforce(c, names...); err != nil && a.OnError != nil {
+			a.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Enforce checks each device specified by names for peers which are not
+// allowed, and removes those whose grace period has elapsed. Every device is
+// checked, and an error joining the errors of each device which could not be
+// checked or whose peers could not be removed is returned.
+func (a *PeerAllowlist) Enforce(c *Client, names ...string) error {
+	if a.Allowed == nil {
+		return errors.New("wgctrl: PeerAllowlist.Allowed must be set")
+	}
+	if a.seen == nil {
+		a.seen = make(map[allowlistKey]time.Time)
+	}
+
+	now := a.timeNow()
+
+	var errs []error
+	for _, name := range names {
+		d, err := c.device(context.Background(), name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("wgctrl: device %q: %w", name, err))
+			continue
+		}
+
+		// Forget peers of this device which are now allowed or gone.
+		present := make(map[wgtypes.Key]bool, len(d.Peers))
+		for _, p := range d.Peers {
+			present[p.PublicKey] = true
+		}
+		for k := range a.seen {
+			if k.device == name && (!present[k.peer] || a.Allowed(name, k.peer)) {
+				delete(a.seen, k)
+			}
+		}
+
+		for _, p := range d.Peers {
+			if a.Allowed(name, p.PublicKey) {
+				continue
+			}
+
+			k := allowlistKey{device: name, peer: p.PublicKey}
+			first, ok := a.seen[k]
+			if !ok {
+				first = now
+				a.seen[k] = first
+				a.event(AllowlistPeerDetected, name, p, first, now)
+			}
+
+			if now.Sub(first) < a.Grace {
+				continue
+			}
+
+			if err := c.RemovePeer(name, p.PublicKey); err != nil {
+				errs = append(errs, fmt.Errorf("wgctrl: device %q: failed to remove peer %s: %w", name, p.PublicKey, err))
+				continue
+			}
+
+			delete(a.seen, k)
+			a.event(AllowlistPeerRemoved, name, p, first, now)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// event reports an AllowlistEvent to OnEvent, if set.
+func (a *PeerAllowlist) event(kind AllowlistEventKind, device string, p wgtypes.Peer, first, now time.Time) {
+	if a.OnEvent == nil {
+		return
+	}
+
+	a.OnEvent(AllowlistEvent{
+		Kind:      kind,
+		Device:    device,
+		Peer:      p,
+		FirstSeen: first,
+		Time:      now,
+	})
+}
+
+// timeNow returns the current time from a.now, or time.Now.
+func (a *PeerAllowlist) timeNow() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+
+	return time.Now()
+}
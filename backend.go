@@ -0,0 +1,84 @@
+package wgctrl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// ErrNoBackends indicates that no WireGuard implementation is available on
+// this system. Errors returned by Client.Devices can be checked for this
+// condition using errors.Is, and inspected for more detail using errors.As
+// with a *NoBackendsError.
+var ErrNoBackends = errors.New("wgctrl: no WireGuard implementation available")
+
+// A BackendError describes why a WireGuard implementation is unavailable.
+type BackendError struct {
+	// Type is the type of devices managed by the implementation.
+	Type wgtypes.DeviceType
+
+	// Err is the underlying cause. A missing kernel module or userspace
+	// socket directory can be checked using errors.Is(Err, os.ErrNotExist),
+	// and insufficient privileges using errors.Is(Err, os.ErrPermission).
+	Err error
+}
+
+// Error implements error.
+func (e BackendError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Type, e.Err)
+}
+
+// Unwrap returns the underlying cause of e.
+func (e BackendError) Unwrap() error { return e.Err }
+
+// Is reports whether target is ErrBackendUnavailable.
+func (e BackendError) Is(target error) bool { return target == ErrBackendUnavailable }
+
+// A NoBackendsError is returned by Client.Devices when no WireGuard
+// implementation is available on this system, rather than an empty list of
+// devices.
+type NoBackendsError struct {
+	// Backends describes each implementation which was considered.
+	Backends []BackendError
+}
+
+// Error implements error.
+func (e *NoBackendsError) Error() string {
+	ss := make([]string, 0, len(e.Backends))
+	for _, b := range e.Backends {
+		ss = append(ss, b.Error())
+	}
+
+	return fmt.Sprintf("%v (%s)", ErrNoBackends, strings.Join(ss, "; "))
+}
+
+// Is reports whether target is ErrNoBackends or ErrBackendUnavailable.
+func (e *NoBackendsError) Is(target error) bool {
+	return target == ErrNoBackends || target == ErrBackendUnavailable
+}
+
+// noBackends returns a *NoBackendsError if none of c's implementations are
+// available, or nil if at least one is.
+func (c *Client) noBackends() error {
+	bs := append([]BackendError(nil), c.unavailable...)
+	for _, wgc := range c.cs {
+		p, ok := wgc.(wginternal.Prober)
+		if !ok {
+			// Implementations which can't be probed were available when
+			// the Client was created.
+			return nil
+		}
+
+		err := p.Probe()
+		if err == nil {
+			return nil
+		}
+
+		bs = append(bs, BackendError{Type: p.DeviceType(), Err: err})
+	}
+
+	return &NoBackendsError{Backends: bs}
+}
@@ -0,0 +1,130 @@
+package wgctrl
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// WithDeviceCache enables a cache of devices retrieved by Client.Device and
+// Client.Devices, which serves Client.Device for up to ttl after a device was
+// last retrieved. This greatly reduces the load on the kernel or userspace
+// implementation when the same device is read many times per second, at the
+// cost of statistics such as transfer counters being up to ttl out of date.
+//
+// A device's cache entry is discarded when it is configured using the Client,
+// and when Client.Watch reports a change to the device, such as a completed
+// handshake or a roamed endpoint. It may also be discarded explicitly using
+// Client.InvalidateDevice, for example when notified of another external
+// change. A non-positive ttl disables the cache.
+func WithDeviceCache(ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+	}
+}
+
+// InvalidateDevice discards any cached state for the device specified by
+// name, so that the next call to Device retrieves it from the system. If the
+// Client was not created using WithDeviceCache, InvalidateDevice is a no-op.
+func (c *Client) InvalidateDevice(name string) {
+	if c.cache != nil {
+		c.cache.invalidate(name)
+	}
+}
+
+// A deviceCache is a cache of devices keyed by name, with a fixed TTL.
+type deviceCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// A cacheEntry is a cached device and the time it expires.
+type cacheEntry struct {
+	d       *wgtypes.Device
+	expires time.Time
+}
+
+// newDeviceCache creates a deviceCache with the specified TTL, or returns nil
+// if the TTL disables caching.
+func newDeviceCache(ttl time.Duration) *deviceCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &deviceCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// get returns a copy of the cached device for name, if one has not expired.
+func (dc *deviceCache) get(name string) (*wgtypes.Device, bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	e, ok := dc.entries[name]
+	if !ok {
+		return nil, false
+	}
+	if !dc.now().Before(e.expires) {
+		delete(dc.entries, name)
+		return nil, false
+	}
+
+	return cloneDevice(e.d), true
+}
+
+// put stores copies of ds in the cache.
+func (dc *deviceCache) put(ds ...*wgtypes.Device) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	expires := dc.now().Add(dc.ttl)
+	for _, d := range ds {
+		dc.entries[d.Name] = cacheEntry{
+			d:       cloneDevice(d),
+			expires: expires,
+		}
+	}
+}
+
+// invalidate discards the cached device for name.
+func (dc *deviceCache) invalidate(name string) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	delete(dc.entries, name)
+}
+
+// cloneDevice returns a deep copy of d, so that cached devices can't be
+// modified by callers.
+func cloneDevice(d *wgtypes.Device) *wgtypes.Device {
+	out := *d
+	out.Peers = make([]wgtypes.Peer, len(d.Peers))
+	for i, p := range d.Peers {
+		if p.Endpoint != nil {
+			ep := *p.Endpoint
+			ep.IP = append(net.IP(nil), p.Endpoint.IP...)
+			p.Endpoint = &ep
+		}
+
+		ips := make([]net.IPNet, 0, len(p.AllowedIPs))
+		for _, ip := range p.AllowedIPs {
+			ips = append(ips, net.IPNet{
+				IP:   append(net.IP(nil), ip.IP...),
+				Mask: append(net.IPMask(nil), ip.Mask...),
+			})
+		}
+		p.AllowedIPs = ips
+
+		out.Peers[i] = p
+	}
+
+	return &out
+}
@@ -1,7 +1,12 @@
 package wgctrl
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"sort"
+	"time"
 
 	"github.com/danpashin/wgctrl/internal/wginternal"
 	"github.com/danpashin/wgctrl/wgtypes"
@@ -10,12 +15,46 @@ import (
 // Expose an identical interface to the underlying packages.
 var _ wginternal.Client = &Client{}
 
+// ErrConflict is returned by ConfigureDeviceIf when a device no longer
+// satisfies the caller's precondition, indicating that another actor modified
+// the device.
+var ErrConflict = errors.New("wgctrl: device was modified concurrently")
+
 // A Client provides access to WireGuard device information.
 type Client struct {
 	// Seamlessly use different wginternal.Client implementations to provide an
 	// interface similar to wg(8).
 	cs []wginternal.Client
 
+	// unavailable describes implementations which were not found when the
+	// Client was created.
+	unavailable []BackendError
+
+	// cache is non-nil if WithDeviceCache is in use.
+	cache *deviceCache
+
+	// metrics is non-nil if WithMetrics is in use.
+	metrics *Metrics
+
+	// policy is non-nil if WithEndpointPolicy is in use.
+	policy *EndpointPolicy
+
+	// limiter is non-nil if WithRateLimit is in use.
+	limiter *rateLimiter
+
+	// history is non-nil if WithHistory is in use.
+	history *History
+
+	// revocations is non-nil if WithRevocationList is in use.
+	revocations *RevocationList
+
+	// pins is non-nil if WithEndpointPins is in use.
+	pins *EndpointPins
+
+	// seqs holds the change sequence numbers of devices tracked using
+	// Sequence and CompareAndConfigure.
+	seqs deviceSeqs
+
 	clientType wgtypes.ClientType
 }
 
@@ -23,16 +62,37 @@ func (c *Client) Type() wgtypes.ClientType {
 	return c.clientType
 }
 
-// New creates a new Client.
-func New(clientType wgtypes.ClientType) (*Client, error) {
-	cs, err := newClients(clientType)
-	if err != nil {
-		return nil, err
+// New creates a new Client, configured using opts.
+func New(clientType wgtypes.ClientType, opts ...Option) (*Client, error) {
+	o := newOptions(opts)
+
+	var (
+		cs          []wginternal.Client
+		unavailable []BackendError
+	)
+	if len(o.backends) > 0 {
+		for _, b := range o.backends {
+			cs = append(cs, b)
+		}
+	} else {
+		var err error
+		cs, unavailable, err = newClients(clientType, o)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &Client{
-		cs:         cs,
-		clientType: clientType,
+		cs:          cs,
+		unavailable: unavailable,
+		cache:       newDeviceCache(o.cacheTTL),
+		metrics:     o.metrics,
+		policy:      o.policy,
+		limiter:     newRateLimiter(o.rateInterval, o.rateBurst),
+		history:     o.history,
+		revocations: o.revoked,
+		pins:        o.pins,
+		clientType:  clientType,
 	}, nil
 }
 
@@ -48,29 +108,116 @@ func (c *Client) Close() error {
 }
 
 // Devices retrieves all WireGuard devices on this system.
+//
+// If no WireGuard implementation is available on this system, a
+// *NoBackendsError is returned which can be checked using
+// `errors.Is(err, ErrNoBackends)`.
 func (c *Client) Devices() ([]*wgtypes.Device, error) {
+	return c.DevicesContext(context.Background())
+}
+
+// DevicesContext retrieves all WireGuard devices on this system, as with
+// Devices. If ctx is canceled or its deadline is exceeded before the devices
+// are retrieved, its error is returned.
+//
+// The userspace and Linux kernel implementations stop waiting for the system
+// as soon as ctx is done. Other implementations only check ctx before each
+// operation.
+func (c *Client) DevicesContext(ctx context.Context) ([]*wgtypes.Device, error) {
 	var out []*wgtypes.Device
 	for _, wgc := range c.cs {
-		devs, _ := wgc.Devices()
+		start := time.Now()
+		devs, err := wginternal.DevicesContext(ctx, wgc)
+		c.metrics.observe("Devices", wgc, start, err)
+		if err != nil {
+			return nil, classify(err)
+		}
+
 		out = append(out, devs...)
 	}
 
+	if len(out) == 0 {
+		if err := c.noBackends(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.cache != nil {
+		c.cache.put(out...)
+	}
+	c.seqs.observe(true, out...)
+
 	return out, nil
 }
 
 // Device retrieves a WireGuard device by its interface name.
 //
 // If the device specified by name does not exist or is not a WireGuard device,
-// an error is returned which can be checked using `errors.Is(err, os.ErrNotExist)`.
+// an error is returned which can be checked using
+// `errors.Is(err, ErrDeviceNotFound)` or `errors.Is(err, os.ErrNotExist)`.
+//
+// If the Client was created using WithDeviceCache, a cached copy of the
+// device may be returned.
 func (c *Client) Device(name string) (*wgtypes.Device, error) {
+	return c.DeviceContext(context.Background(), name)
+}
+
+// DeviceContext retrieves a WireGuard device by its interface name, as with
+// Device. If ctx is canceled or its deadline is exceeded before the device is
+// retrieved, its error is returned.
+func (c *Client) DeviceContext(ctx context.Context, name string) (*wgtypes.Device, error) {
+	if c.cache == nil {
+		return c.lazyDevice(ctx, name)
+	}
+
+	if d, ok := c.cache.get(name); ok {
+		return d, nil
+	}
+
+	d, err := c.lazyDevice(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.put(d)
+	return d, nil
+}
+
+// device retrieves a WireGuard device by its interface name, bypassing the
+// device cache, and decodes any allowed IPs deferred by WithLazyAllowedIPs.
+func (c *Client) device(ctx context.Context, name string) (*wgtypes.Device, error) {
+	d, err := c.lazyDevice(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadAllowedIPs(d); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// lazyDevice retrieves a WireGuard device by its interface name, bypassing the
+// device cache.
+func (c *Client) lazyDevice(ctx context.Context, name string) (*wgtypes.Device, error) {
 	for _, wgc := range c.cs {
-		d, err := wgc.Device(name)
-		if err == nil {
+		start := time.Now()
+		d, err := wginternal.DeviceContext(ctx, wgc, name)
+		c.metrics.observe("Device", wgc, start, err)
+		switch {
+		case err == nil:
+			c.seqs.observe(false, d)
 			return d, nil
+		case errors.Is(err, os.ErrNotExist):
+			continue
+		default:
+			return nil, classify(err)
 		}
 	}
 
-	return nil, os.ErrNotExist
+	c.seqs.notFound(name)
+	return nil, ErrDeviceNotFound
 }
 
 // ConfigureDevice configures a WireGuard device by its interface name.
@@ -79,15 +226,234 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 // Config fields, only fields which are not nil will be applied when
 // configuring a device.
 //
+// cfg is checked using its Validate method before it is applied, and a
+// *wgtypes.ValidationError is returned if it contains invalid values or, if
+// the Client was created using WithEndpointPolicy, violates the policy.
+//
 // If the device specified by name does not exist or is not a WireGuard device,
-// an error is returned which can be checked using `errors.Is(err, os.ErrNotExist)`.
+// an error is returned which can be checked using
+// `errors.Is(err, ErrDeviceNotFound)` or `errors.Is(err, os.ErrNotExist)`.
 func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	return c.ConfigureDeviceContext(context.Background(), name, cfg)
+}
+
+// ConfigureDeviceContext configures a WireGuard device by its interface name,
+// as with ConfigureDevice. If ctx is canceled or its deadline is exceeded
+// before the device is configured, its error is returned, and the device may
+// have been partially configured. A call waiting for WithRateLimit stops
+// waiting when ctx is done, and its configuration is not applied.
+func (c *Client) ConfigureDeviceContext(ctx context.Context, name string, cfg wgtypes.Config) error {
+	return c.configure(ctx, name, cfg, c.history != nil)
+}
+
+// configure checks and applies cfg to the device specified by name, first
+// recording its current configuration in c.history if record is true.
+func (c *Client) configure(ctx context.Context, name string, cfg wgtypes.Config, record bool) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if c.pins != nil {
+		var err error
+		if cfg, err = c.pinEndpoints(ctx, name, cfg); err != nil {
+			return err
+		}
+	}
+	if c.revocations != nil {
+		if err := c.revocations.Check(cfg); err != nil {
+			return err
+		}
+	}
+	if err := c.checkPolicy(ctx, name, cfg); err != nil {
+		return err
+	}
+
+	if record {
+		d, err := c.device(ctx, name)
+		if err != nil {
+			return err
+		}
+		if err := c.history.record(name, d); err != nil {
+			return fmt.Errorf("wgctrl: failed to record history for device %q: %w", name, err)
+		}
+	}
+
+	cfg = primaryEndpoints(cfg)
+
+	// Any cached state is stale once a change is attempted, even if it
+	// fails part way through.
+	defer c.InvalidateDevice(name)
+	defer c.seqs.changed(name)
+
+	if c.limiter != nil {
+		return c.limiter.do(ctx, name, cfg, func(cfg wgtypes.Config) error {
+			return c.configureDevice(ctx, name, cfg)
+		})
+	}
+
+	return c.configureDevice(ctx, name, cfg)
+}
+
+// configureDevice configures a device using the first implementation which
+// knows about it.
+func (c *Client) configureDevice(ctx context.Context, name string, cfg wgtypes.Config) error {
 	for _, wgc := range c.cs {
-		err := wgc.ConfigureDevice(name, cfg)
-		if err == nil {
+		start := time.Now()
+		err := wginternal.ConfigureDeviceContext(ctx, wgc, name, cfg)
+		c.metrics.observe("ConfigureDevice", wgc, start, err)
+		switch {
+		case err == nil:
 			return nil
+		case errors.Is(err, os.ErrNotExist):
+			continue
+		default:
+			return classify(err)
 		}
 	}
 
-	return os.ErrNotExist
+	return ErrDeviceNotFound
+}
+
+// A DeviceResult is the outcome of configuring a single device using
+// ConfigureDevices.
+type DeviceResult struct {
+	// Device is the name of the device.
+	Device string
+
+	// Err is the error returned when configuring the device, or nil if it
+	// was configured successfully.
+	Err error
+}
+
+// ConfigureDevices configures multiple WireGuard devices, keyed by interface
+// name, as with ConfigureDevice. The result for each device is returned in
+// order of device name, along with an error joining the errors of each device
+// which could not be configured.
+//
+// Every configuration is checked before any device is configured, so an
+// invalid configuration for one device prevents all devices from being
+// configured. Failures when configuring one device do not prevent the
+// remaining devices from being configured.
+func (c *Client) ConfigureDevices(cfgs map[string]wgtypes.Config) ([]DeviceResult, error) {
+	names := make([]string, 0, len(cfgs))
+	for name := range cfgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := cfgs[name].Validate(); err != nil {
+			return nil, fmt.Errorf("wgctrl: device %q: %w", name, err)
+		}
+	}
+
+	var (
+		results = make([]DeviceResult, 0, len(names))
+		errs    []error
+	)
+
+	for _, name := range names {
+		err := c.ConfigureDevice(name, cfgs[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("wgctrl: device %q: %w", name, err))
+		}
+
+		results = append(results, DeviceResult{Device: name, Err: err})
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// A Precondition reports whether the current state of a device permits a
+// configuration change.
+type Precondition func(d *wgtypes.Device) bool
+
+// ExpectDevice returns a Precondition which requires the configuration of a
+// device to be identical to d, as determined by wgtypes.Diff. d is typically
+// the result of an earlier call to Client.Device.
+func ExpectDevice(d *wgtypes.Device) Precondition {
+	return func(cur *wgtypes.Device) bool {
+		return len(wgtypes.Diff(d, cur)) == 0
+	}
+}
+
+// ExpectPeers returns a Precondition which requires a device to have exactly
+// the peers identified by keys, in any order.
+func ExpectPeers(keys ...wgtypes.Key) Precondition {
+	return func(cur *wgtypes.Device) bool {
+		if len(cur.Peers) != len(keys) {
+			return false
+		}
+
+		want := make(map[wgtypes.Key]bool, len(keys))
+		for _, k := range keys {
+			want[k] = true
+		}
+
+		for _, p := range cur.Peers {
+			if !want[p.PublicKey] {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// ConfigureDeviceIf configures a WireGuard device by its interface name, as
+// with ConfigureDevice, but only if the device's current state satisfies
+// pre. If it does not, ErrConflict is returned and the device is left
+// unchanged.
+//
+// The device is re-read immediately before it is configured, which prevents
+// lost updates between cooperating agents. WireGuard itself has no notion of
+// transactions, so a change made in the short window between the read and the
+// write can't be detected.
+func (c *Client) ConfigureDeviceIf(name string, cfg wgtypes.Config, pre Precondition) error {
+	d, err := c.device(context.Background(), name)
+	if err != nil {
+		return err
+	}
+
+	if !pre(d) {
+		return ErrConflict
+	}
+
+	return c.ConfigureDevice(name, cfg)
+}
+
+// SyncDeviceConfig configures a WireGuard device by its interface name so that
+// its configuration matches cfg, with the semantics of wg syncconf: peers
+// which are not in cfg are removed, and the allowed IPs of each peer in cfg
+// are replaced by those in cfg.
+//
+// The device is read first, and only the differences determined by
+// wgtypes.Reconcile are applied, so that peers which are unchanged keep their
+// sessions. If the device already matches cfg, it is not configured at all.
+// cfg is checked using its Validate method even if no change is needed.
+func (c *Client) SyncDeviceConfig(name string, cfg wgtypes.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	d, err := c.device(context.Background(), name)
+	if err != nil {
+		return err
+	}
+
+	cfg = wgtypes.Reconcile(d, cfg)
+	if isZeroConfig(cfg) {
+		return nil
+	}
+
+	return c.ConfigureDevice(name, cfg)
+}
+
+// isZeroConfig reports whether cfg makes no changes to a device.
+func isZeroConfig(cfg wgtypes.Config) bool {
+	return cfg.PrivateKey == nil &&
+		cfg.ListenPort == nil &&
+		cfg.FirewallMark == nil &&
+		!cfg.ReplacePeers &&
+		cfg.AdvancedSecurityConfig == (wgtypes.AdvancedSecurityConfig{}) &&
+		len(cfg.Peers) == 0
 }
@@ -1,13 +1,24 @@
 package wgctrl
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgstore"
 	"github.com/danpashin/wgctrl/wgtypes"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 var (
@@ -104,7 +115,7 @@ func TestClientDevice(t *testing.T) {
 				notExist,
 				notExist,
 			},
-			err: os.ErrNotExist,
+			err: ErrDeviceNotFound,
 		},
 		{
 			name: "first not found",
@@ -187,7 +198,7 @@ func TestClientConfigureDevice(t *testing.T) {
 				notExist,
 				notExist,
 			},
-			err: os.ErrNotExist,
+			err: ErrDeviceNotFound,
 		},
 		{
 			name: "first not found",
@@ -224,6 +235,1724 @@ func TestClientConfigureDevice(t *testing.T) {
 	}
 }
 
+func TestClientConfigureDevices(t *testing.T) {
+	var configured []string
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			ConfigureDeviceFunc: func(name string, _ wgtypes.Config) error {
+				configured = append(configured, name)
+				if name == "wg1" {
+					return errFoo
+				}
+
+				return nil
+			},
+		}},
+	}
+
+	results, err := c.ConfigureDevices(map[string]wgtypes.Config{
+		"wg2": {},
+		"wg1": {},
+		"wg0": {},
+	})
+	if !errors.Is(err, errFoo) {
+		t.Fatalf("expected foo error, but got: %v", err)
+	}
+
+	want := []DeviceResult{
+		{Device: "wg0"},
+		{Device: "wg1", Err: errFoo},
+		{Device: "wg2"},
+	}
+
+	if diff := cmp.Diff(want, results, cmpopts.EquateErrors()); diff != "" {
+		t.Fatalf("unexpected results (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"wg0", "wg1", "wg2"}, configured); diff != "" {
+		t.Fatalf("unexpected configured devices (-want +got):\n%s", diff)
+	}
+
+	// An invalid configuration prevents any device from being configured.
+	configured = nil
+	d := -time.Second
+	_, err = c.ConfigureDevices(map[string]wgtypes.Config{
+		"wg0": {},
+		"wg1": {Peers: []wgtypes.PeerConfig{{PersistentKeepaliveInterval: &d}}},
+	})
+
+	var verr *wgtypes.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, but got: %v", err)
+	}
+	if len(configured) > 0 {
+		t.Fatalf("expected no devices to be configured, but got: %v", configured)
+	}
+}
+
+func TestClientConfigureDeviceInvalid(t *testing.T) {
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			ConfigureDeviceFunc: func(_ string, _ wgtypes.Config) error {
+				panic("invalid configuration; shouldn't be applied")
+			},
+		}},
+	}
+
+	keepalive := 500 * time.Millisecond
+	err := c.ConfigureDevice("wg0", wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PersistentKeepaliveInterval: &keepalive,
+		}},
+	})
+
+	var verr *wgtypes.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, but got: %v", err)
+	}
+}
+
+func TestClientConfigureDeviceIf(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+	)
+
+	cur := &wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{
+			{PublicKey: keyA},
+			{PublicKey: keyB},
+		},
+	}
+
+	modified := *cur
+	modified.ListenPort = 51821
+
+	tests := []struct {
+		name string
+		pre  Precondition
+		err  error
+	}{
+		{
+			name: "device unchanged",
+			pre:  ExpectDevice(cur),
+		},
+		{
+			name: "device changed",
+			pre:  ExpectDevice(&modified),
+			err:  ErrConflict,
+		},
+		{
+			name: "peers unchanged",
+			pre:  ExpectPeers(keyB, keyA),
+		},
+		{
+			name: "peers changed",
+			pre:  ExpectPeers(keyA),
+			err:  ErrConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var configured bool
+			c := &Client{
+				cs: []wginternal.Client{&testClient{
+					DeviceFunc: func(_ string) (*wgtypes.Device, error) {
+						return cur, nil
+					},
+					ConfigureDeviceFunc: func(_ string, _ wgtypes.Config) error {
+						configured = true
+						return nil
+					},
+				}},
+			}
+
+			err := c.ConfigureDeviceIf("wg0", wgtypes.Config{}, tt.pre)
+			if diff := cmp.Diff(tt.err, err, cmpErrors); diff != "" {
+				t.Fatalf("unexpected error (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.err == nil, configured); diff != "" {
+				t.Fatalf("unexpected configuration call (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientCompareAndConfigure(t *testing.T) {
+	var (
+		port       = 51820
+		exists     = true
+		configured int
+	)
+
+	device := func() (*wgtypes.Device, error) {
+		if !exists {
+			return nil, os.ErrNotExist
+		}
+
+		return &wgtypes.Device{Name: "wg0", ListenPort: port}, nil
+	}
+
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DevicesFunc: func() ([]*wgtypes.Device, error) {
+				if !exists {
+					return nil, nil
+				}
+
+				d, err := device()
+				return []*wgtypes.Device{d}, err
+			},
+			DeviceFunc: func(_ string) (*wgtypes.Device, error) {
+				return device()
+			},
+			ConfigureDeviceFunc: func(_ string, cfg wgtypes.Config) error {
+				configured++
+				port = *cfg.ListenPort
+				return nil
+			},
+		}},
+	}
+
+	sequence := func(want uint64) {
+		t.Helper()
+
+		got, err := c.Sequence("wg0")
+		if err != nil {
+			t.Fatalf("failed to get sequence: %v", err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected sequence (-want +got):\n%s", diff)
+		}
+	}
+
+	configure := func(seq uint64, p int, want uint64, wantErr error) {
+		t.Helper()
+
+		got, err := c.CompareAndConfigure("wg0", seq, wgtypes.Config{ListenPort: &p})
+		if diff := cmp.Diff(wantErr, err, cmpErrors); diff != "" {
+			t.Fatalf("unexpected error (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected sequence (-want +got):\n%s", diff)
+		}
+	}
+
+	sequence(1)
+	sequence(1)
+
+	// The Client's own change is not counted again when it is observed.
+	configure(1, 51821, 2, nil)
+	sequence(2)
+
+	// A change made by another program is observed by Devices.
+	port = 51822
+	if _, err := c.Devices(); err != nil {
+		t.Fatalf("failed to get devices: %v", err)
+	}
+	configure(2, 51823, 0, ErrConflict)
+	if diff := cmp.Diff(1, configured); diff != "" {
+		t.Fatalf("unexpected number of configuration calls (-want +got):\n%s", diff)
+	}
+
+	configure(3, 51823, 4, nil)
+
+	// Deleting the device is a change too.
+	exists = false
+	if _, err := c.Sequence("wg0"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected device not found, but got: %v", err)
+	}
+	exists = true
+	sequence(6)
+}
+
+func TestClientSyncDeviceConfig(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		port = 51820
+	)
+
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: port,
+		Peers:      []wgtypes.Peer{{PublicKey: keyA}, {PublicKey: keyB}},
+	}
+
+	tests := []struct {
+		name string
+		cfg  wgtypes.Config
+		want []wgtypes.Config
+	}{
+		{
+			name: "unchanged",
+			cfg: wgtypes.Config{
+				ListenPort: &port,
+				Peers:      []wgtypes.PeerConfig{{PublicKey: keyA}, {PublicKey: keyB}},
+			},
+		},
+		{
+			name: "peer removed",
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{PublicKey: keyA}},
+			},
+			want: []wgtypes.Config{{
+				Peers: []wgtypes.PeerConfig{{PublicKey: keyB, Remove: true}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []wgtypes.Config
+			c := &Client{
+				cs: []wginternal.Client{&testClient{
+					DeviceFunc: func(_ string) (*wgtypes.Device, error) {
+						return d, nil
+					},
+					ConfigureDeviceFunc: func(_ string, cfg wgtypes.Config) error {
+						got = append(got, cfg)
+						return nil
+					},
+				}},
+			}
+
+			if err := c.SyncDeviceConfig("wg0", tt.cfg); err != nil {
+				t.Fatalf("failed to sync device: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected configurations (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientUnstableDialUAPINoUserspace(t *testing.T) {
+	c := &Client{
+		cs: []wginternal.Client{&testClient{}},
+	}
+
+	if _, err := c.Unstable().DialUAPI("wg0"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
+
+func TestClientNetNSPathNotExist(t *testing.T) {
+	// Fails on Linux because the path does not exist, and elsewhere because
+	// network namespaces are not supported.
+	_, err := New(wgtypes.NativeClient, WithNetNSPath(filepath.Join(t.TempDir(), "netns")))
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestClientDevicesNoBackends(t *testing.T) {
+	none := func() ([]*wgtypes.Device, error) { return nil, nil }
+
+	tests := []struct {
+		name        string
+		cs          []wginternal.Client
+		unavailable []BackendError
+		backends    []BackendError
+	}{
+		{
+			name: "not prober",
+			cs:   []wginternal.Client{&testClient{DevicesFunc: none}},
+		},
+		{
+			name: "probe ok",
+			cs: []wginternal.Client{&testProber{
+				testClient: testClient{DevicesFunc: none},
+				ProbeFunc:  func() error { return nil },
+			}},
+		},
+		{
+			name: "none",
+			cs: []wginternal.Client{&testProber{
+				testClient: testClient{DevicesFunc: none},
+				ProbeFunc:  func() error { return os.ErrPermission },
+			}},
+			unavailable: []BackendError{{
+				Type: wgtypes.LinuxKernel,
+				Err:  os.ErrNotExist,
+			}},
+			backends: []BackendError{
+				{Type: wgtypes.LinuxKernel, Err: os.ErrNotExist},
+				{Type: wgtypes.Userspace, Err: os.ErrPermission},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				cs:          tt.cs,
+				unavailable: tt.unavailable,
+			}
+
+			devices, err := c.Devices()
+			if tt.backends == nil {
+				if err != nil {
+					t.Fatalf("failed to get devices: %v", err)
+				}
+
+				if diff := cmp.Diff(0, len(devices)); diff != "" {
+					t.Fatalf("unexpected number of devices (-want +got):\n%s", diff)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, ErrNoBackends) {
+				t.Fatalf("expected no backends, but got: %v", err)
+			}
+
+			var nerr *NoBackendsError
+			if !errors.As(err, &nerr) {
+				t.Fatalf("expected *NoBackendsError, but got: %T", err)
+			}
+
+			if diff := cmp.Diff(tt.backends, nerr.Backends, cmpErrors); diff != "" {
+				t.Fatalf("unexpected backend errors (-want +got):\n%s", diff)
+			}
+
+			if !errors.Is(nerr.Backends[1], os.ErrPermission) {
+				t.Fatalf("expected permission denied, but got: %v", nerr.Backends[1])
+			}
+		})
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		applied []wgtypes.Config
+	)
+
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			ConfigureDeviceFunc: func(_ string, cfg wgtypes.Config) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				applied = append(applied, cfg)
+				return nil
+			},
+		}},
+		limiter: newRateLimiter(time.Second, 1),
+	}
+
+	var (
+		now    = time.Unix(0, 0)
+		sleeps = make(chan time.Duration)
+		wake   = make(chan struct{})
+	)
+
+	c.limiter.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return now
+	}
+	c.limiter.sleep = func(_ context.Context, d time.Duration) {
+		sleeps <- d
+		<-wake
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		now = now.Add(d)
+	}
+
+	port := func(p int) wgtypes.Config {
+		return wgtypes.Config{ListenPort: &p}
+	}
+
+	// The first change consumes the only token immediately.
+	if err := c.ConfigureDevice("wg0", port(1)); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	// The next change must wait for a token, and the changes made while it
+	// waits are coalesced with it.
+	var wg sync.WaitGroup
+	configure := func(cfg wgtypes.Config) {
+		defer wg.Done()
+
+		if err := c.ConfigureDevice("wg0", cfg); err != nil {
+			t.Errorf("failed to configure device: %v", err)
+		}
+	}
+
+	wg.Add(1)
+	go configure(port(2))
+
+	if diff := cmp.Diff(time.Second, <-sleeps); diff != "" {
+		t.Fatalf("unexpected sleep (-want +got):\n%s", diff)
+	}
+
+	wg.Add(2)
+	go configure(wgtypes.Config{ReplacePeers: true})
+	go configure(port(3))
+
+	for queued := 0; queued < 3; time.Sleep(time.Millisecond) {
+		c.limiter.mu.Lock()
+		queued = len(c.limiter.devices["wg0"].queue)
+		c.limiter.mu.Unlock()
+	}
+
+	close(wake)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff(2, len(applied)); diff != "" {
+		t.Fatalf("unexpected number of changes (-want +got):\n%s", diff)
+	}
+
+	got := applied[1]
+	if !got.ReplacePeers {
+		t.Fatal("expected peers to be replaced by coalesced change")
+	}
+	if diff := cmp.Diff(3, *got.ListenPort); diff != "" {
+		t.Fatalf("unexpected coalesced listen port (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientRateLimitContext(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		applied []int
+	)
+
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			ConfigureDeviceFunc: func(_ string, cfg wgtypes.Config) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				applied = append(applied, *cfg.ListenPort)
+				return nil
+			},
+		}},
+		limiter: newRateLimiter(time.Second, 1),
+	}
+
+	var (
+		now    = time.Unix(0, 0)
+		sleeps = make(chan time.Duration)
+		wake   = make(chan struct{})
+	)
+
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now = now.Add(d)
+	}
+
+	c.limiter.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return now
+	}
+	c.limiter.sleep = func(ctx context.Context, d time.Duration) {
+		sleeps <- d
+
+		select {
+		case <-wake:
+			advance(d)
+		case <-ctx.Done():
+		}
+	}
+
+	queued := func() int {
+		c.limiter.mu.Lock()
+		defer c.limiter.mu.Unlock()
+
+		return len(c.limiter.devices["wg0"].queue)
+	}
+
+	configure := func(ctx context.Context, p int) <-chan error {
+		errC := make(chan error, 1)
+		go func() {
+			errC <- c.ConfigureDeviceContext(ctx, "wg0", wgtypes.Config{ListenPort: &p})
+		}()
+
+		return errC
+	}
+
+	// The first change consumes the only token, so the others must wait.
+	if err := <-configure(context.Background(), 1); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	leadCtx, leadCancel := context.WithCancel(context.Background())
+	defer leadCancel()
+	leadC := configure(leadCtx, 2)
+	<-sleeps
+
+	waitCtx, waitCancel := context.WithCancel(context.Background())
+	defer waitCancel()
+	waitC := configure(waitCtx, 3)
+	lastC := configure(context.Background(), 4)
+
+	for queued() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A queued caller gives up on its own context, leaving the others queued.
+	waitCancel()
+	if err := <-waitC; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, but got: %v", err)
+	}
+	if diff := cmp.Diff(2, queued()); diff != "" {
+		t.Fatalf("unexpected number of queued changes (-want +got):\n%s", diff)
+	}
+
+	// The waiting caller gives up, and the next caller waits in its place.
+	leadCancel()
+	if err := <-leadC; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, but got: %v", err)
+	}
+
+	<-sleeps
+	close(wake)
+	if err := <-lastC; err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	mu.Lock()
+	if diff := cmp.Diff([]int{1, 4}, applied); diff != "" {
+		t.Fatalf("unexpected applied changes (-want +got):\n%s", diff)
+	}
+	mu.Unlock()
+
+	// Once its bucket refills, the idle limiter of wg0 is removed.
+	advance(time.Second)
+	if err := c.ConfigureDevice("wg1", wgtypes.Config{ListenPort: new(int)}); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	c.limiter.mu.Lock()
+	defer c.limiter.mu.Unlock()
+
+	if _, ok := c.limiter.devices["wg0"]; ok {
+		t.Fatal("expected idle limiter for wg0 to be removed")
+	}
+}
+
+func TestClientDrainPeer(t *testing.T) {
+	prev := drainInterval
+	drainInterval = time.Millisecond
+	defer func() { drainInterval = prev }()
+
+	key := wgtest.MustPublicKey()
+
+	tests := []struct {
+		name string
+		// busy is the number of reads for which the peer's traffic grows.
+		busy    int
+		timeout time.Duration
+		err     error
+	}{
+		{
+			name:    "quiesced",
+			busy:    3,
+			timeout: time.Minute,
+		},
+		{
+			name:    "timeout",
+			busy:    1 << 30,
+			timeout: 10 * time.Millisecond,
+			err:     ErrDrainTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				reads int
+				cfgs  []wgtypes.Config
+			)
+
+			c := &Client{
+				cs: []wginternal.Client{&testClient{
+					DeviceFunc: func(name string) (*wgtypes.Device, error) {
+						if reads < tt.busy {
+							reads++
+						}
+
+						return &wgtypes.Device{
+							Name: name,
+							Peers: []wgtypes.Peer{{
+								PublicKey:    key,
+								ReceiveBytes: int64(reads),
+							}},
+						}, nil
+					},
+					ConfigureDeviceFunc: func(_ string, cfg wgtypes.Config) error {
+						cfgs = append(cfgs, cfg)
+						return nil
+					},
+				}},
+			}
+
+			err := c.DrainPeer("wg0", key, tt.timeout)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: want %v, got %v", tt.err, err)
+			}
+
+			var zero time.Duration
+			want := []wgtypes.Config{
+				{Peers: []wgtypes.PeerConfig{{
+					PublicKey:                   key,
+					UpdateOnly:                  true,
+					PersistentKeepaliveInterval: &zero,
+				}}},
+				{Peers: []wgtypes.PeerConfig{{
+					PublicKey: key,
+					Remove:    true,
+				}}},
+			}
+
+			if diff := cmp.Diff(want, cfgs); diff != "" {
+				t.Fatalf("unexpected configurations (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		c := &Client{
+			cs: []wginternal.Client{&testClient{
+				DeviceFunc: func(name string) (*wgtypes.Device, error) {
+					return &wgtypes.Device{Name: name}, nil
+				},
+			}},
+		}
+
+		if err := c.DrainPeer("wg0", key, time.Second); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected not found, but got: %v", err)
+		}
+	})
+}
+
+func TestClientPeerOperations(t *testing.T) {
+	key := wgtest.MustPublicKey()
+
+	tests := []struct {
+		name string
+		fn   func(c *Client) error
+		want wgtypes.PeerConfig
+	}{
+		{
+			name: "add",
+			fn: func(c *Client) error {
+				return c.AddPeer("wg0", wgtypes.PeerConfig{
+					PublicKey:  key,
+					Remove:     true,
+					UpdateOnly: true,
+					AllowedIPs: []net.IPNet{wgtest.MustCIDR("192.0.2.0/24")},
+				})
+			},
+			want: wgtypes.PeerConfig{
+				PublicKey:  key,
+				AllowedIPs: []net.IPNet{wgtest.MustCIDR("192.0.2.0/24")},
+			},
+		},
+		{
+			name: "add with alternates",
+			fn: func(c *Client) error {
+				return c.AddPeer("wg0", wgtypes.PeerConfig{
+					PublicKey: key,
+					AlternateEndpoints: []*net.UDPAddr{
+						wgtest.MustUDPAddr("192.0.2.1:51820"),
+						wgtest.MustUDPAddr("192.0.2.2:443"),
+					},
+				})
+			},
+			want: wgtypes.PeerConfig{
+				PublicKey: key,
+				Endpoint:  wgtest.MustUDPAddr("192.0.2.1:51820"),
+				AlternateEndpoints: []*net.UDPAddr{
+					wgtest.MustUDPAddr("192.0.2.1:51820"),
+					wgtest.MustUDPAddr("192.0.2.2:443"),
+				},
+			},
+		},
+		{
+			name: "update",
+			fn: func(c *Client) error {
+				return c.UpdatePeer("wg0", wgtypes.PeerConfig{
+					PublicKey: key,
+					Remove:    true,
+					Endpoint:  wgtest.MustUDPAddr("192.0.2.1:51820"),
+				})
+			},
+			want: wgtypes.PeerConfig{
+				PublicKey:  key,
+				UpdateOnly: true,
+				Endpoint:   wgtest.MustUDPAddr("192.0.2.1:51820"),
+			},
+		},
+		{
+			name: "remove",
+			fn: func(c *Client) error {
+				return c.RemovePeer("wg0", key)
+			},
+			want: wgtypes.PeerConfig{
+				PublicKey: key,
+				Remove:    true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []wgtypes.Config
+			c := &Client{
+				cs: []wginternal.Client{&testClient{
+					ConfigureDeviceFunc: func(name string, cfg wgtypes.Config) error {
+						if name != "wg0" {
+							t.Fatalf("unexpected device name: %q", name)
+						}
+
+						got = append(got, cfg)
+						return nil
+					},
+				}},
+			}
+
+			if err := tt.fn(c); err != nil {
+				t.Fatalf("failed to configure peer: %v", err)
+			}
+
+			want := []wgtypes.Config{{Peers: []wgtypes.PeerConfig{tt.want}}}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("unexpected configurations (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientMovePeer(t *testing.T) {
+	var (
+		key   = wgtest.MustPublicKey()
+		other = wgtest.MustPublicKey()
+		psk   = wgtest.MustPresharedKey()
+		addr  = wgtest.MustUDPAddr("192.0.2.1:51820")
+
+		keepalive = 25 * time.Second
+		remove    = wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: key, Remove: true}}}
+	)
+
+	peer := wgtypes.Peer{
+		PublicKey:                   key,
+		PresharedKey:                psk,
+		Endpoint:                    addr,
+		PersistentKeepaliveInterval: keepalive,
+		AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")},
+	}
+
+	type change struct {
+		Device string
+		Config wgtypes.Config
+	}
+
+	tests := []struct {
+		name      string
+		dst       []wgtypes.Peer
+		removeErr error
+		changes   []change
+		ok        bool
+		check     func(t *testing.T, err error)
+	}{
+		{
+			name: "ok",
+			dst: []wgtypes.Peer{{
+				PublicKey:  other,
+				AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.1.0/24")},
+			}},
+			changes: []change{
+				{Device: "wg1", Config: wgtypes.Config{Peers: []wgtypes.PeerConfig{{
+					PublicKey:                   key,
+					PresharedKey:                &psk,
+					Endpoint:                    addr,
+					PersistentKeepaliveInterval: &keepalive,
+					ReplaceAllowedIPs:           true,
+					AllowedIPs:                  peer.AllowedIPs,
+				}}}},
+				{Device: "wg0", Config: remove},
+			},
+			ok: true,
+		},
+		{
+			name: "exists",
+			dst:  []wgtypes.Peer{{PublicKey: key}},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, os.ErrExist) {
+					t.Fatalf("expected exists error, but got: %v", err)
+				}
+			},
+		},
+		{
+			name: "overlap",
+			dst: []wgtypes.Peer{{
+				PublicKey:  other,
+				AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.0/24")},
+			}},
+			check: func(t *testing.T, err error) {
+				var verr *wgtypes.ValidationError
+				if !errors.As(err, &verr) || verr.Field != "AllowedIPs" {
+					t.Fatalf("expected allowed IPs validation error, but got: %v", err)
+				}
+			},
+		},
+		{
+			name:      "rollback",
+			removeErr: errFoo,
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, errFoo) {
+					t.Fatalf("expected foo error, but got: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []change
+			c := &Client{
+				cs: []wginternal.Client{&testClient{
+					DeviceFunc: func(name string) (*wgtypes.Device, error) {
+						switch name {
+						case "wg0":
+							return &wgtypes.Device{Name: name, Peers: []wgtypes.Peer{peer}}, nil
+						case "wg1":
+							return &wgtypes.Device{Name: name, Peers: tt.dst}, nil
+						default:
+							return nil, os.ErrNotExist
+						}
+					},
+					ConfigureDeviceFunc: func(name string, cfg wgtypes.Config) error {
+						changes = append(changes, change{Device: name, Config: cfg})
+						if name == "wg0" {
+							return tt.removeErr
+						}
+
+						return nil
+					},
+				}},
+			}
+
+			err := c.MovePeer("wg0", "wg1", key)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("failed to move peer: %v", err)
+				}
+
+				if diff := cmp.Diff(tt.changes, changes); diff != "" {
+					t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+				}
+				return
+			}
+
+			tt.check(t, err)
+
+			if tt.removeErr != nil {
+				// The peer must be removed from the destination again.
+				last := changes[len(changes)-1]
+				if diff := cmp.Diff(change{Device: "wg1", Config: remove}, last); diff != "" {
+					t.Fatalf("unexpected rollback (-want +got):\n%s", diff)
+				}
+			} else if len(changes) > 0 {
+				t.Fatalf("expected no changes, but got: %v", changes)
+			}
+		})
+	}
+}
+
+func TestClientSentinelErrors(t *testing.T) {
+	key := wgtest.MustPublicKey()
+
+	tests := []struct {
+		name string
+		fn   func(c *Client) error
+		err  error
+		want []error
+	}{
+		{
+			name: "device not found",
+			fn: func(c *Client) error {
+				_, err := c.Device("wg0")
+				return err
+			},
+			err:  os.ErrNotExist,
+			want: []error{ErrDeviceNotFound, os.ErrNotExist},
+		},
+		{
+			name: "permission denied",
+			fn: func(c *Client) error {
+				_, err := c.Device("wg0")
+				return err
+			},
+			err:  fmt.Errorf("wglinux: failed to get device: %w", syscall.EPERM),
+			want: []error{ErrPermissionDenied, os.ErrPermission, syscall.EPERM},
+		},
+		{
+			name: "configure device not found",
+			fn: func(c *Client) error {
+				return c.ConfigureDevice("wg0", wgtypes.Config{})
+			},
+			err:  os.ErrNotExist,
+			want: []error{ErrDeviceNotFound, os.ErrNotExist},
+		},
+		{
+			name: "peer not found",
+			fn: func(c *Client) error {
+				return c.TriggerHandshake("wg0", key)
+			},
+			want: []error{ErrPeerNotFound, os.ErrNotExist},
+		},
+		{
+			name: "no backends",
+			fn: func(c *Client) error {
+				c.cs = nil
+				c.unavailable = []BackendError{{Type: wgtypes.LinuxKernel, Err: os.ErrNotExist}}
+				_, err := c.Devices()
+				return err
+			},
+			want: []error{ErrBackendUnavailable, ErrNoBackends},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				cs: []wginternal.Client{&testClient{
+					DeviceFunc: func(name string) (*wgtypes.Device, error) {
+						if tt.err != nil {
+							return nil, tt.err
+						}
+
+						return &wgtypes.Device{Name: name}, nil
+					},
+					ConfigureDeviceFunc: func(_ string, _ wgtypes.Config) error {
+						return tt.err
+					},
+				}},
+			}
+
+			err := tt.fn(c)
+			for _, want := range tt.want {
+				if !errors.Is(err, want) {
+					t.Fatalf("expected error matching %v, but got: %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestClientTriggerHandshake(t *testing.T) {
+	var (
+		key  = wgtest.MustPublicKey()
+		addr = wgtest.MustUDPAddr("192.0.2.1:51820")
+
+		off = time.Duration(0)
+		on  = wgtypes.DefaultPersistentKeepalive
+	)
+
+	tests := []struct {
+		name string
+		peer wgtypes.Peer
+		cfg  *wgtypes.Config
+		err  error
+	}{
+		{
+			name: "ok",
+			peer: wgtypes.Peer{PublicKey: key, Endpoint: addr},
+			cfg: &wgtypes.Config{Peers: []wgtypes.PeerConfig{
+				{PublicKey: key, UpdateOnly: true, Endpoint: addr, PersistentKeepaliveInterval: &off},
+				{PublicKey: key, UpdateOnly: true, PersistentKeepaliveInterval: &on},
+				{PublicKey: key, UpdateOnly: true, PersistentKeepaliveInterval: &off},
+			}},
+		},
+		{
+			name: "no endpoint",
+			peer: wgtypes.Peer{PublicKey: key},
+			err:  ErrNoEndpoint,
+		},
+		{
+			name: "not found",
+			err:  os.ErrNotExist,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg *wgtypes.Config
+			c := &Client{
+				cs: []wginternal.Client{&testClient{
+					DeviceFunc: func(name string) (*wgtypes.Device, error) {
+						return &wgtypes.Device{Name: name, Peers: []wgtypes.Peer{tt.peer}}, nil
+					},
+					ConfigureDeviceFunc: func(_ string, c wgtypes.Config) error {
+						cfg = &c
+						return nil
+					},
+				}},
+			}
+
+			if err := c.TriggerHandshake("wg0", key); !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: want %v, got %v", tt.err, err)
+			}
+
+			if diff := cmp.Diff(tt.cfg, cfg); diff != "" {
+				t.Fatalf("unexpected configuration (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	panicDevice := func(_ string) (*wgtypes.Device, error) {
+		panic("shouldn't be called with a canceled context")
+	}
+
+	// Implementations which don't support contexts are not called once the
+	// context is done.
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DevicesFunc: func() ([]*wgtypes.Device, error) {
+				panic("shouldn't be called with a canceled context")
+			},
+			DeviceFunc: panicDevice,
+			ConfigureDeviceFunc: func(_ string, _ wgtypes.Config) error {
+				panic("shouldn't be called with a canceled context")
+			},
+		}},
+	}
+
+	if _, err := c.DevicesContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, but got: %v", err)
+	}
+	if _, err := c.DeviceContext(ctx, "wg0"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, but got: %v", err)
+	}
+	if err := c.ConfigureDeviceContext(ctx, "wg0", wgtypes.Config{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, but got: %v", err)
+	}
+
+	// Implementations which support contexts receive the caller's context.
+	type key struct{}
+	ctx = context.WithValue(context.Background(), key{}, "foo")
+
+	c = &Client{
+		cs: []wginternal.Client{&testContextClient{
+			testClient: testClient{DeviceFunc: panicDevice},
+			DeviceContextFunc: func(ctx context.Context, name string) (*wgtypes.Device, error) {
+				if diff := cmp.Diff("foo", ctx.Value(key{})); diff != "" {
+					t.Fatalf("unexpected context value (-want +got):\n%s", diff)
+				}
+
+				return &wgtypes.Device{Name: name}, nil
+			},
+		}},
+	}
+
+	if _, err := c.DeviceContext(ctx, "wg0"); err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+}
+
+func TestClientProbe(t *testing.T) {
+	c := &Client{
+		cs: []wginternal.Client{
+			&testProber{
+				testClient: testClient{
+					DevicesFunc: func() ([]*wgtypes.Device, error) {
+						return []*wgtypes.Device{{Name: "wg0"}, {Name: "wg1"}}, nil
+					},
+				},
+				ProbeFunc: func() error { return nil },
+			},
+		},
+		unavailable: []BackendError{{
+			Type: wgtypes.LinuxKernel,
+			Err:  os.ErrNotExist,
+		}},
+		clientType: wgtypes.AmneziaClient,
+	}
+
+	r := &ProbeReport{Backends: c.probe()}
+
+	want := []BackendStatus{
+		{
+			ClientType: wgtypes.AmneziaClient,
+			Type:       wgtypes.Userspace,
+			Available:  true,
+			Devices:    []string{"wg0", "wg1"},
+		},
+		{
+			ClientType: wgtypes.AmneziaClient,
+			Type:       wgtypes.LinuxKernel,
+			Err:        os.ErrNotExist,
+		},
+	}
+
+	if diff := cmp.Diff(want, r.Backends, cmpopts.EquateErrors()); diff != "" {
+		t.Fatalf("unexpected backends (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]wgtypes.DeviceType{wgtypes.Userspace}, r.Plan(wgtypes.AmneziaClient)); diff != "" {
+		t.Fatalf("unexpected plan (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(0, len(r.Plan(wgtypes.NativeClient))); diff != "" {
+		t.Fatalf("unexpected native plan (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	prev := watchInterval
+	watchInterval = time.Millisecond
+	defer func() { watchInterval = prev }()
+
+	var (
+		key = wgtest.MustPublicKey()
+		ep1 = wgtest.MustUDPAddr("192.0.2.1:51820")
+		ep2 = wgtest.MustUDPAddr("192.0.2.2:51820")
+		hs  = time.Unix(1, 0)
+	)
+
+	// Each poll returns the next set of devices, and the final set once all
+	// have been returned.
+	polls := [][]*wgtypes.Device{
+		{{Name: "wg0", Peers: []wgtypes.Peer{{PublicKey: key, Endpoint: ep1}}}},
+		{
+			{Name: "wg0", Peers: []wgtypes.Peer{{PublicKey: key, Endpoint: ep1}}},
+			{Name: "wg1"},
+		},
+		{{Name: "wg0", Peers: []wgtypes.Peer{{PublicKey: key, Endpoint: ep2, LastHandshakeTime: hs}}}},
+	}
+
+	var (
+		mu sync.Mutex
+		n  int
+	)
+
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DevicesFunc: func() ([]*wgtypes.Device, error) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				devs := polls[n]
+				if n < len(polls)-1 {
+					n++
+				}
+
+				return devs, nil
+			},
+		}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := c.Watch(ctx)
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	want := []WatchEvent{
+		{Kind: DeviceAdded, Device: "wg1"},
+		{Kind: EndpointChanged, Device: "wg0", Peer: key, Endpoint: ep2},
+		{Kind: HandshakeCompleted, Device: "wg0", Peer: key, Endpoint: ep2, Time: hs},
+		{Kind: DeviceRemoved, Device: "wg1"},
+	}
+
+	var got []WatchEvent
+	for e := range events {
+		// Only handshakes report a deterministic time.
+		if e.Kind != HandshakeCompleted {
+			e.Time = time.Time{}
+		}
+
+		if got = append(got, e); len(got) == len(want) {
+			cancel()
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientWatchInvalidatesCache(t *testing.T) {
+	prev := watchInterval
+	watchInterval = time.Millisecond
+	defer func() { watchInterval = prev }()
+
+	var (
+		key = wgtest.MustPublicKey()
+		hs  = time.Unix(1, 0)
+
+		mu      sync.Mutex
+		n       int
+		release = make(chan struct{})
+	)
+
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DevicesFunc: func() ([]*wgtypes.Device, error) {
+				mu.Lock()
+				n++
+				i := n
+				mu.Unlock()
+
+				switch i {
+				case 1:
+					return []*wgtypes.Device{{Name: "wg0", Peers: []wgtypes.Peer{{PublicKey: key}}}}, nil
+				case 2:
+					return []*wgtypes.Device{{Name: "wg0", Peers: []wgtypes.Peer{{PublicKey: key, LastHandshakeTime: hs}}}}, nil
+				default:
+					// Don't cache any further polls.
+					<-release
+					return nil, errFoo
+				}
+			},
+		}},
+		cache: newDeviceCache(time.Hour),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := c.Watch(ctx)
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	e := <-events
+	if diff := cmp.Diff(HandshakeCompleted, e.Kind); diff != "" {
+		t.Fatalf("unexpected event (-want +got):\n%s", diff)
+	}
+
+	// The poll which found the handshake cached the device, but it must be
+	// discarded once the change is reported.
+	if _, ok := c.cache.get("wg0"); ok {
+		t.Fatal("device was cached after a change was reported")
+	}
+
+	cancel()
+	close(release)
+	for range events {
+	}
+}
+
+func TestClientWatchLinkChanges(t *testing.T) {
+	prev := watchInterval
+	watchInterval = time.Millisecond
+	defer func() { watchInterval = prev }()
+
+	polls := make(chan struct{}, 1)
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DevicesFunc: func() ([]*wgtypes.Device, error) {
+				polls <- struct{}{}
+				return []*wgtypes.Device{{Name: "wg0"}}, nil
+			},
+		}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	links := make(chan struct{})
+	events := c.watch(ctx, watchSnapshot(nil), links, watchOptions{})
+
+	// Devices are not polled while link notifications are available.
+	select {
+	case <-polls:
+		t.Fatal("devices were retrieved without a link notification")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	links <- struct{}{}
+	<-polls
+
+	e := <-events
+	if diff := cmp.Diff(WatchEvent{Kind: DeviceAdded, Device: "wg0"}, e, cmpopts.IgnoreFields(WatchEvent{}, "Time")); diff != "" {
+		t.Fatalf("unexpected event (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestClientWatchOptions(t *testing.T) {
+	key := wgtest.MustPublicKey()
+
+	// handshake returns wg0 with a peer whose last handshake was at sec, and
+	// the event which reports it.
+	handshake := func(sec int64) (*wgtypes.Device, WatchEvent) {
+		hs := time.Unix(sec, 0)
+		d := &wgtypes.Device{Name: "wg0", Peers: []wgtypes.Peer{{PublicKey: key, LastHandshakeTime: hs}}}
+		return d, WatchEvent{Kind: HandshakeCompleted, Device: "wg0", Peer: key, Time: hs}
+	}
+
+	// watch starts watching with opts, and returns a function which makes the
+	// next retrieval of the devices return devs.
+	watch := func(t *testing.T, ctx context.Context, opts ...WatchOption) (<-chan WatchEvent, func(devs ...*wgtypes.Device)) {
+		t.Helper()
+
+		polls := make(chan []*wgtypes.Device, 1)
+		c := &Client{
+			cs: []wginternal.Client{&testClient{
+				DevicesFunc: func() ([]*wgtypes.Device, error) {
+					return <-polls, nil
+				},
+			}},
+		}
+
+		var o watchOptions
+		for _, opt := range opts {
+			opt(&o)
+		}
+
+		d, _ := handshake(0)
+		links := make(chan struct{})
+		events := c.watch(ctx, watchSnapshot([]*wgtypes.Device{d}), links, o)
+
+		return events, func(devs ...*wgtypes.Device) {
+			polls <- devs
+			links <- struct{}{}
+		}
+	}
+
+	t.Run("block", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events, poll := watch(t, ctx, WatchBuffer(1))
+
+		d, want := handshake(1)
+		poll(d)
+
+		// The queue is full, so no further notifications are handled until
+		// the event is received.
+		d, _ = handshake(2)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			poll(d)
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("a change was detected while the queue was full")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		if diff := cmp.Diff(want, <-events); diff != "" {
+			t.Fatalf("unexpected event (-want +got):\n%s", diff)
+		}
+
+		<-done
+		_, want = handshake(2)
+		if diff := cmp.Diff(want, <-events); diff != "" {
+			t.Fatalf("unexpected event (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events, poll := watch(t, ctx, WatchBuffer(2), WatchDropOldest())
+		for i := int64(1); i <= 3; i++ {
+			d, _ := handshake(i)
+			poll(d)
+		}
+
+		for _, sec := range []int64{2, 3} {
+			_, want := handshake(sec)
+			if diff := cmp.Diff(want, <-events); diff != "" {
+				t.Fatalf("unexpected event (-want +got):\n%s", diff)
+			}
+		}
+	})
+
+	t.Run("coalesce", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events, poll := watch(t, ctx, WatchBuffer(10), WatchCoalesce())
+		for i := int64(1); i <= 3; i++ {
+			d, _ := handshake(i)
+			poll(d)
+		}
+
+		d, want := handshake(3)
+		if diff := cmp.Diff(want, <-events); diff != "" {
+			t.Fatalf("unexpected event (-want +got):\n%s", diff)
+		}
+
+		// The earlier handshakes were replaced rather than queued.
+		poll(d, &wgtypes.Device{Name: "wg1"})
+		if diff := cmp.Diff(DeviceAdded, (<-events).Kind); diff != "" {
+			t.Fatalf("unexpected event kind (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestJunkScheduler(t *testing.T) {
+	t.Run("bounds", func(t *testing.T) {
+		s := &JunkScheduler{MinCount: 2, MaxCount: 4, MinSize: 100, MaxSize: 102}
+		for i := 0; i < 100; i++ {
+			asc, err := s.Next()
+			if err != nil {
+				t.Fatalf("failed to generate parameters: %v", err)
+			}
+
+			jc, jmin, jmax := *asc.JunkPacketCount, *asc.JunkPacketMinSize, *asc.JunkPacketMaxSize
+			if jc < 2 || jc > 4 || jmin < 100 || jmax > 102 || jmin >= jmax {
+				t.Fatalf("parameters out of bounds: Jc %d, Jmin %d, Jmax %d", jc, jmin, jmax)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, s := range []*JunkScheduler{
+			{MinCount: 5, MaxCount: 4},
+			{MinSize: 100, MaxSize: 100},
+		} {
+			if _, err := s.Next(); err == nil {
+				t.Fatalf("expected an error for %+v, but none occurred", s)
+			}
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		var got []string
+		c := &Client{
+			cs: []wginternal.Client{&testClient{
+				DeviceFunc: func(name string) (*wgtypes.Device, error) {
+					d := &wgtypes.Device{Name: name}
+					if name == "awg0" {
+						d.AdvancedSecurity = wgtypes.AdvancedSecurity{InitPacketMagicHeader: 1}
+					}
+
+					return d, nil
+				},
+				ConfigureDeviceFunc: func(name string, cfg wgtypes.Config) error {
+					asc := cfg.AdvancedSecurityConfig
+					if asc.JunkPacketCount == nil || asc.InitPacketMagicHeader != nil || len(cfg.Peers) > 0 {
+						t.Fatalf("unexpected configuration: %+v", cfg)
+					}
+
+					got = append(got, name)
+					return nil
+				},
+			}},
+		}
+
+		if err := (&JunkScheduler{}).Apply(c, "wg0", "awg0"); err != nil {
+			t.Fatalf("failed to apply: %v", err)
+		}
+
+		if diff := cmp.Diff([]string{"awg0"}, got); diff != "" {
+			t.Fatalf("unexpected configured devices (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestClientDeviceCache(t *testing.T) {
+	var calls int
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DeviceFunc: func(name string) (*wgtypes.Device, error) {
+				calls++
+				return &wgtypes.Device{
+					Name:  name,
+					Peers: []wgtypes.Peer{{ReceiveBytes: int64(calls)}},
+				}, nil
+			},
+			ConfigureDeviceFunc: func(_ string, _ wgtypes.Config) error {
+				return nil
+			},
+		}},
+		cache: newDeviceCache(time.Second),
+	}
+
+	now := time.Unix(0, 0)
+	c.cache.now = func() time.Time { return now }
+
+	device := func(want int64) {
+		t.Helper()
+
+		d, err := c.Device("wg0")
+		if err != nil {
+			t.Fatalf("failed to get device: %v", err)
+		}
+
+		if diff := cmp.Diff(want, d.Peers[0].ReceiveBytes); diff != "" {
+			t.Fatalf("unexpected device state (-want +got):\n%s", diff)
+		}
+
+		// Modifying a returned device must not affect the cache.
+		d.Peers[0].ReceiveBytes = -1
+	}
+
+	// Populate the cache, then serve from it until the TTL expires.
+	device(1)
+	device(1)
+	now = now.Add(time.Second)
+	device(2)
+
+	// Explicit invalidation.
+	c.InvalidateDevice("wg0")
+	device(3)
+
+	// Configuring a device invalidates it.
+	if err := c.ConfigureDevice("wg0", wgtypes.Config{}); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+	device(4)
+	device(4)
+}
+
+func TestClientLazyAllowedIPs(t *testing.T) {
+	var (
+		key  = wgtest.MustPublicKey()
+		ipns = []net.IPNet{wgtest.MustCIDR("192.0.2.0/24")}
+	)
+
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DeviceFunc: func(name string) (*wgtypes.Device, error) {
+				return &wgtypes.Device{
+					Name: name,
+					Peers: []wgtypes.Peer{{
+						PublicKey: key,
+						LazyAllowedIPs: wgtypes.NewLazyAllowedIPs(func() ([]net.IPNet, error) {
+							return ipns, nil
+						}),
+					}},
+				}, nil
+			},
+			ConfigureDeviceFunc: func(_ string, cfg wgtypes.Config) error {
+				return fmt.Errorf("unexpected configuration: %+v", cfg)
+			},
+		}},
+	}
+
+	// Devices are returned with their allowed IPs deferred.
+	d, err := c.Device("wg0")
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+	if p := d.Peers[0]; len(p.AllowedIPs) > 0 || p.LazyAllowedIPs == nil {
+		t.Fatalf("expected deferred allowed IPs, but got: %v", p.AllowedIPs)
+	}
+
+	got, err := d.Peers[0].LoadAllowedIPs()
+	if err != nil {
+		t.Fatalf("failed to load allowed IPs: %v", err)
+	}
+	if diff := cmp.Diff(ipns, got); diff != "" {
+		t.Fatalf("unexpected allowed IPs (-want +got):\n%s", diff)
+	}
+
+	// Methods which compare allowed IPs decode them, so the device already
+	// matches this configuration.
+	err = c.SyncDeviceConfig("wg0", wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:  key,
+			AllowedIPs: ipns,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to sync device: %v", err)
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	m := &Metrics{}
+	c := &Client{
+		cs: []wginternal.Client{
+			&testClient{
+				DeviceFunc: func(_ string) (*wgtypes.Device, error) {
+					return nil, os.ErrNotExist
+				},
+			},
+			&testProber{testClient: testClient{
+				DeviceFunc: func(_ string) (*wgtypes.Device, error) {
+					return nil, errFoo
+				},
+			}},
+		},
+		metrics: m,
+	}
+
+	if _, err := c.Device("wg0"); !errors.Is(err, errFoo) {
+		t.Fatalf("expected foo error, but got: %v", err)
+	}
+
+	want := []OperationStats{
+		{
+			Operation: "Device",
+			Backend:   wgtypes.Unknown,
+			Calls:     1,
+		},
+		{
+			Operation: "Device",
+			Backend:   wgtypes.Userspace,
+			Calls:     1,
+			Errors:    1,
+		},
+	}
+
+	got := m.Snapshot()
+	for i := range got {
+		var n uint64
+		for _, b := range got[i].Buckets {
+			n += b
+		}
+		if diff := cmp.Diff(got[i].Calls, n); diff != "" {
+			t.Fatalf("unexpected number of bucketed calls (-want +got):\n%s", diff)
+		}
+
+		// Latencies vary, so only counts are compared.
+		got[i].Latency = 0
+		got[i].Buckets = nil
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected metrics (-want +got):\n%s", diff)
+	}
+
+	var stats []map[string]interface{}
+	if err := json.Unmarshal([]byte(m.String()), &stats); err != nil {
+		t.Fatalf("failed to unmarshal JSON: %v", err)
+	}
+
+	if diff := cmp.Diff("userspace", stats[1]["backend"]); diff != "" {
+		t.Fatalf("unexpected JSON backend (-want +got):\n%s", diff)
+	}
+}
+
 type testClient struct {
 	CloseFunc           func() error
 	DevicesFunc         func() ([]*wgtypes.Device, error)
@@ -240,3 +1969,347 @@ func (c *testClient) Device(name string) (*wgtypes.Device, error) {
 func (c *testClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
 	return c.ConfigureDeviceFunc(name, cfg)
 }
+
+type testContextClient struct {
+	testClient
+	DeviceContextFunc func(ctx context.Context, name string) (*wgtypes.Device, error)
+}
+
+func (c *testContextClient) DevicesContext(_ context.Context) ([]*wgtypes.Device, error) {
+	panic("unimplemented")
+}
+
+func (c *testContextClient) DeviceContext(ctx context.Context, name string) (*wgtypes.Device, error) {
+	return c.DeviceContextFunc(ctx, name)
+}
+
+func (c *testContextClient) ConfigureDeviceContext(_ context.Context, _ string, _ wgtypes.Config) error {
+	panic("unimplemented")
+}
+
+type testProber struct {
+	testClient
+	ProbeFunc func() error
+}
+
+func (c *testProber) DeviceType() wgtypes.DeviceType { return wgtypes.Userspace }
+func (c *testProber) Probe() error                   { return c.ProbeFunc() }
+
+type testDeviceManager struct {
+	testClient
+	Type             wgtypes.DeviceType
+	CreateDeviceFunc func(name string) error
+	DeleteDeviceFunc func(name string) error
+}
+
+func (c *testDeviceManager) DeviceType() wgtypes.DeviceType { return c.Type }
+func (c *testDeviceManager) CreateDevice(name string) error { return c.CreateDeviceFunc(name) }
+func (c *testDeviceManager) DeleteDevice(name string) error { return c.DeleteDeviceFunc(name) }
+
+func TestPeerAllowlist(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		keyC = wgtest.MustPublicKey()
+		now  = time.Unix(1000, 0)
+	)
+
+	d := &wgtypes.Device{
+		Name: "wg0",
+		Peers: []wgtypes.Peer{
+			{PublicKey: keyA},
+			{PublicKey: keyB, Endpoint: wgtest.MustUDPAddr("192.0.2.1:51820")},
+			{PublicKey: keyC},
+		},
+	}
+
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DeviceFunc: func(_ string) (*wgtypes.Device, error) {
+				return d, nil
+			},
+			ConfigureDeviceFunc: func(_ string, cfg wgtypes.Config) error {
+				d = wgtypes.Preview(d, cfg)
+				return nil
+			},
+		}},
+	}
+
+	allowed := map[wgtypes.Key]bool{keyA: true}
+
+	var events []AllowlistEvent
+	a := &PeerAllowlist{
+		Allowed: func(_ string, key wgtypes.Key) bool { return allowed[key] },
+		Grace:   time.Minute,
+		OnEvent: func(e AllowlistEvent) { events = append(events, e) },
+		now:     func() time.Time { return now },
+	}
+
+	enforce := func() {
+		t.Helper()
+		if err := a.Enforce(c, "wg0"); err != nil {
+			t.Fatalf("failed to enforce: %v", err)
+		}
+	}
+
+	// B and C are detected, but remain during their grace period.
+	enforce()
+	now = now.Add(30 * time.Second)
+	enforce()
+
+	if diff := cmp.Diff(3, len(d.Peers)); diff != "" {
+		t.Fatalf("unexpected number of peers (-want +got):\n%s", diff)
+	}
+
+	// C becomes allowed, so only B is removed once its grace period elapses.
+	allowed[keyC] = true
+	now = now.Add(30 * time.Second)
+	enforce()
+
+	keys := make([]wgtypes.Key, 0, len(d.Peers))
+	for _, p := range d.Peers {
+		keys = append(keys, p.PublicKey)
+	}
+	if diff := cmp.Diff([]wgtypes.Key{keyA, keyC}, keys); diff != "" {
+		t.Fatalf("unexpected peers (-want +got):\n%s", diff)
+	}
+
+	type event struct {
+		Kind        AllowlistEventKind
+		Peer        wgtypes.Key
+		First, Time int64
+	}
+
+	var got []event
+	for _, e := range events {
+		got = append(got, event{
+			Kind:  e.Kind,
+			Peer:  e.Peer.PublicKey,
+			First: e.FirstSeen.Unix(),
+			Time:  e.Time.Unix(),
+		})
+	}
+
+	want := []event{
+		{Kind: AllowlistPeerDetected, Peer: keyB, First: 1000, Time: 1000},
+		{Kind: AllowlistPeerDetected, Peer: keyC, First: 1000, Time: 1000},
+		{Kind: AllowlistPeerRemoved, Peer: keyB, First: 1000, Time: 1060},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+
+	// C is no longer tracked, so revoking it starts a new grace period.
+	allowed[keyC] = false
+	enforce()
+	if diff := cmp.Diff(2, len(d.Peers)); diff != "" {
+		t.Fatalf("unexpected number of peers (-want +got):\n%s", diff)
+	}
+}
+
+func TestPeerAllowlistRunNegativeInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	a := &PeerAllowlist{
+		Allowed: func(_ string, _ wgtypes.Key) bool { return true },
+		// A negative interval uses the default rather than panicking.
+		Interval: -time.Second,
+	}
+
+	if err := a.Run(ctx, &Client{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, but got: %v", err)
+	}
+}
+
+func TestClientHistoryUndo(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		psk  = wgtest.MustPresharedKey()
+		now  = time.Unix(1000, 0)
+	)
+
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{{
+			PublicKey:  keyA,
+			AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")},
+		}},
+	}
+
+	h := &History{
+		Store: &wgstore.MemoryStore{},
+		Limit: 3,
+		now:   func() time.Time { return now },
+	}
+
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DeviceFunc: func(_ string) (*wgtypes.Device, error) {
+				return d, nil
+			},
+			ConfigureDeviceFunc: func(_ string, cfg wgtypes.Config) error {
+				d = wgtypes.Preview(d, cfg)
+				return nil
+			},
+		}},
+		history: h,
+	}
+
+	if _, err := (&Client{}).Undo("wg0"); !errors.Is(err, ErrNoHistory) {
+		t.Fatalf("expected no history without WithHistory, but got: %v", err)
+	}
+
+	port := func(p int) *int { return &p }
+	configure := func(cfg wgtypes.Config) {
+		t.Helper()
+		now = now.Add(time.Minute)
+		if err := c.ConfigureDevice("wg0", cfg); err != nil {
+			t.Fatalf("failed to configure device: %v", err)
+		}
+	}
+
+	configure(wgtypes.Config{ListenPort: port(51821)})
+
+	// Configurations which leave the device unchanged are only recorded
+	// once, and invalid configurations are not recorded at all.
+	configure(wgtypes.Config{})
+	configure(wgtypes.Config{})
+	invalid := -1 * time.Second
+	if err := c.ConfigureDevice("wg0", wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{PublicKey: keyA, PersistentKeepaliveInterval: &invalid}},
+	}); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	configure(wgtypes.Config{Peers: []wgtypes.PeerConfig{
+		{PublicKey: keyA, UpdateOnly: true, PresharedKey: &psk},
+		{PublicKey: keyB, AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.3/32")}},
+	}})
+	configure(wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: keyA, Remove: true}}})
+	configure(wgtypes.Config{ListenPort: port(51822)})
+
+	es, err := h.Entries("wg0")
+	if err != nil {
+		t.Fatalf("failed to get entries: %v", err)
+	}
+
+	// The oldest entry, with port 51820, is discarded by Limit.
+	type state struct {
+		Port  int
+		Peers map[wgtypes.Key]wgtypes.Key
+	}
+
+	stateOf := func(d *wgtypes.Device) state {
+		s := state{Port: d.ListenPort, Peers: make(map[wgtypes.Key]wgtypes.Key)}
+		for _, p := range d.Peers {
+			s.Peers[p.PublicKey] = p.PresharedKey
+		}
+		return s
+	}
+
+	var (
+		afterRemove = state{Port: 51821, Peers: map[wgtypes.Key]wgtypes.Key{keyB: {}}}
+		afterAdd    = state{Port: 51821, Peers: map[wgtypes.Key]wgtypes.Key{keyA: psk, keyB: {}}}
+		afterPort   = state{Port: 51821, Peers: map[wgtypes.Key]wgtypes.Key{keyA: {}}}
+	)
+
+	var got []state
+	for _, e := range es {
+		got = append(got, stateOf(e.Device))
+	}
+	if diff := cmp.Diff([]state{afterRemove, afterAdd, afterPort}, got); diff != "" {
+		t.Fatalf("unexpected entries (-want +got):\n%s", diff)
+	}
+
+	for i, want := range []state{afterRemove, afterAdd, afterPort} {
+		e, err := c.Undo("wg0")
+		if err != nil {
+			t.Fatalf("failed to undo %d: %v", i, err)
+		}
+
+		if diff := cmp.Diff(want, stateOf(d)); diff != "" {
+			t.Fatalf("unexpected device after undo %d (-want +got):\n%s", i, diff)
+		}
+		if diff := cmp.Diff(es[i].Time, e.Time); diff != "" {
+			t.Fatalf("unexpected entry time after undo %d (-want +got):\n%s", i, diff)
+		}
+	}
+
+	if _, err := c.Undo("wg0"); !errors.Is(err, ErrNoHistory) {
+		t.Fatalf("expected no history, but got: %v", err)
+	}
+}
+
+func TestClientCreateDeleteDevice(t *testing.T) {
+	devices := map[string]bool{"wg0": true}
+
+	// A kernel implementation which can't manage devices precedes a
+	// userspace implementation which can.
+	kernel := &testClient{
+		DeviceFunc: func(name string) (*wgtypes.Device, error) {
+			if name == "wgk" {
+				return &wgtypes.Device{Name: name}, nil
+			}
+			return nil, os.ErrNotExist
+		},
+	}
+
+	user := &testDeviceManager{
+		testClient: testClient{
+			DeviceFunc: func(name string) (*wgtypes.Device, error) {
+				if !devices[name] {
+					return nil, os.ErrNotExist
+				}
+				return &wgtypes.Device{Name: name}, nil
+			},
+		},
+		Type: wgtypes.Userspace,
+		CreateDeviceFunc: func(name string) error {
+			if devices[name] {
+				return os.ErrExist
+			}
+			devices[name] = true
+			return nil
+		},
+		DeleteDeviceFunc: func(name string) error {
+			delete(devices, name)
+			return nil
+		},
+	}
+
+	c := &Client{cs: []wginternal.Client{kernel, user}}
+
+	if err := c.CreateDevice("wg1", wgtypes.LinuxKernel); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected unsupported, but got: %v", err)
+	}
+	if err := c.CreateDevice("wg0", wgtypes.Userspace); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected exists, but got: %v", err)
+	}
+	if err := c.CreateDevice("wg1", wgtypes.Userspace); err != nil {
+		t.Fatalf("failed to create device: %v", err)
+	}
+	if _, err := c.Device("wg1"); err != nil {
+		t.Fatalf("failed to get created device: %v", err)
+	}
+
+	if err := c.DeleteDevice("wgk"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected unsupported, but got: %v", err)
+	}
+	err := c.DeleteDevice("wg2")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+	if diff := cmp.Diff(`wgctrl: device "wg2": wgctrl: device not found`, err.Error()); diff != "" {
+		t.Fatalf("unexpected error message (-want +got):\n%s", diff)
+	}
+	if err := c.DeleteDevice("wg0"); err != nil {
+		t.Fatalf("failed to delete device: %v", err)
+	}
+	if _, err := c.Device("wg0"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected deleted device to not exist, but got: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// apply reads a wg(8) configuration file for each device from the *.conf
+// files in a directory, named after the device, and applies each with the
+// semantics of wg syncconf. A result is printed for every device.
+//
+// With --diff, the changes to each device are printed before they are
+// applied. With --check, nothing is applied, and the exit code indicates
+// whether any device would change.
+func apply(cs []*wgctrl.Client, args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	check := fs.Bool("check", false, "report pending changes without applying them")
+	showDiff := fs.Bool("diff", false, "print the changes to each device")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fatalf(errUsage, "usage: wgctrl apply [--check] [--diff] <directory>")
+	}
+	dir := fs.Arg(0)
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil {
+		fatalf(errUsage, "invalid configuration directory: %v", err)
+	}
+	if len(paths) == 0 {
+		fatalf(os.ErrNotExist, "no configuration files found in %q", dir)
+	}
+
+	// Parse every file before any device is modified.
+	cfgs := make(map[string]wgtypes.Config, len(paths))
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			fatalf(err, "failed to open configuration: %v", err)
+		}
+
+		cfg, err := wgtypes.ParseConfig(f)
+		_ = f.Close()
+		if err != nil {
+			fatalf(errUsage, "failed to parse %q: %v", p, err)
+		}
+
+		cfgs[strings.TrimSuffix(filepath.Base(p), ".conf")] = cfg
+	}
+
+	// Group the configurations by the client which owns each device, so that
+	// each client configures its devices in a single call.
+	var (
+		results []wgctrl.DeviceResult
+		errs    []error
+		groups  = make(map[*wgctrl.Client]map[string]wgtypes.Config)
+
+		checked []checkResult
+		pending int
+	)
+
+	names := make([]string, 0, len(cfgs))
+	for name := range cfgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cfg := cfgs[name]
+		c, d, err := findClient(cs, name)
+		if err != nil {
+			results = append(results, wgctrl.DeviceResult{Device: name, Err: err})
+			errs = append(errs, err)
+			continue
+		}
+
+		// Only apply the differences, so that unchanged peers keep their
+		// sessions.
+		cfg = wgtypes.Reconcile(d, cfg)
+		changes := wgtypes.Diff(d, wgtypes.Preview(d, cfg))
+		if *showDiff {
+			printChanges(name, changes)
+		}
+
+		if *check {
+			status := "unchanged"
+			if len(changes) > 0 {
+				status, pending = "pending", pending+1
+			}
+			checked = append(checked, checkResult{device: name, status: status, changes: len(changes)})
+			continue
+		}
+
+		if groups[c] == nil {
+			groups[c] = make(map[string]wgtypes.Config)
+		}
+		groups[c][name] = cfg
+	}
+
+	if *check {
+		printCheckResults(os.Stdout, checked, results)
+		switch {
+		case len(errs) > 0:
+			fatalf(errors.Join(errs...), "failed to check %d of %d configurations", len(errs), len(cfgs))
+		case pending > 0:
+			log.Printf("changes pending for %d of %d devices", pending, len(cfgs))
+			os.Exit(exitChangesPending)
+		}
+
+		return
+	}
+
+	for _, c := range cs {
+		if groups[c] == nil {
+			continue
+		}
+
+		rs, err := c.ConfigureDevices(groups[c])
+		if rs == nil && err != nil {
+			// No device was configured because a configuration is invalid.
+			fatalf(err, "failed to apply configurations: %v", err)
+		}
+
+		results = append(results, rs...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	printResults(os.Stdout, results)
+
+	if err := errors.Join(errs...); err != nil {
+		fatalf(err, "failed to apply %d of %d configurations", len(errs), len(cfgs))
+	}
+}
+
+// printResults prints a table of the result of configuring each device.
+func printResults(w io.Writer, results []wgctrl.DeviceResult) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Device < results[j].Device
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tSTATUS\tDETAIL")
+	for _, r := range results {
+		status, detail := "ok", "-"
+		if r.Err != nil {
+			status, detail = "failed", r.Err.Error()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Device, status, detail)
+	}
+	_ = tw.Flush()
+}
+
+// A checkResult is the outcome of checking a single device with --check.
+type checkResult struct {
+	device  string
+	status  string
+	changes int
+}
+
+// printCheckResults prints a table of the pending changes for each checked
+// device, and of each device which could not be checked.
+func printCheckResults(w io.Writer, checked []checkResult, failed []wgctrl.DeviceResult) {
+	for _, r := range failed {
+		checked = append(checked, checkResult{device: r.Device, status: "failed: " + r.Err.Error()})
+	}
+	sort.Slice(checked, func(i, j int) bool {
+		return checked[i].device < checked[j].device
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tSTATUS\tCHANGES")
+	for _, r := range checked {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", r.device, r.status, r.changes)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// A change is the staged configuration for a single device, accumulated from
+// every batch command which refers to it.
+type change struct {
+	device string
+	cfg    wgtypes.Config
+}
+
+// A staged change is a change whose device has been found, along with the
+// client which manages the device and its state before the change.
+type staged struct {
+	change
+	c *wgctrl.Client
+	d *wgtypes.Device
+}
+
+// batch reads commands from r, stages them as a single configuration change
+// per device, and applies the changes only once every command has been parsed
+// and every device has been found. If a device can't be configured, the
+// devices which were already configured are restored, so that the batch is
+// applied to every device or to none.
+func batch(cs []*wgctrl.Client, r io.Reader) {
+	changes, err := parseBatch(r)
+	if err != nil {
+		fatalf(err, "failed to parse batch: %v", err)
+	}
+
+	// Stage: resolve every device and validate its configuration before any
+	// device is modified.
+	ss := make([]staged, 0, len(changes))
+	for _, ch := range changes {
+		if err := ch.cfg.Validate(); err != nil {
+			fatalf(err, "invalid configuration for device %q: %v", ch.device, err)
+		}
+
+		c, d, err := findClient(cs, ch.device)
+		if err != nil {
+			fatalf(err, "failed to get device %q: %v", ch.device, err)
+		}
+
+		ss = append(ss, staged{change: ch, c: c, d: d})
+	}
+
+	if err := applyStaged(ss); err != nil {
+		fatalf(err, "%v", err)
+	}
+}
+
+// applyStaged configures each device of ss only if it hasn't changed since it
+// was staged. If a device can't be configured, the devices which were already
+// configured are restored, most recent first, before the error is returned.
+func applyStaged(ss []staged) error {
+	for i, s := range ss {
+		err := s.c.ConfigureDeviceIf(s.device, s.cfg, wgctrl.ExpectDevice(s.d))
+		if err == nil {
+			continue
+		}
+
+		for j := i - 1; j >= 0; j-- {
+			if rerr := restore(ss[j]); rerr != nil {
+				log.Printf("failed to restore device %q: %v", ss[j].device, rerr)
+				continue
+			}
+
+			log.Printf("restored device %q", ss[j].device)
+		}
+
+		return fmt.Errorf("failed to configure device %q: %w", s.device, err)
+	}
+
+	return nil
+}
+
+// restore reconciles the device of s back to the state in which it was
+// staged, as with rollback.
+func restore(s staged) error {
+	d, err := s.c.Device(s.device)
+	if err != nil {
+		return err
+	}
+
+	return s.c.ConfigureDevice(s.device, wgtypes.Reconcile(d, wgtypes.DeviceConfig(s.d)))
+}
+
+// findClient returns the first client which knows about the device specified
+// by name, and the device's current state.
+func findClient(cs []*wgctrl.Client, name string) (*wgctrl.Client, *wgtypes.Device, error) {
+	for _, c := range cs {
+		d, err := c.Device(name)
+		switch {
+		case err == nil:
+			return c, d, nil
+		case errors.Is(err, os.ErrNotExist):
+			continue
+		default:
+			return nil, nil, err
+		}
+	}
+
+	return nil, nil, os.ErrNotExist
+}
+
+// parseBatch parses batch commands from r, one per line, merging commands
+// for the same device in order. Blank lines and lines beginning with # are
+// ignored. The only command is set, which accepts the arguments of wg(8) set:
+//
+//	set <device> [listen-port <port>] [fwmark <mark>] [private-key <file>]
+//	    [peer <key> [remove] [preshared-key <file>] [endpoint <ip>:<port>]
+//	    [persistent-keepalive <interval>] [allowed-ips <ip>/<cidr>[,...]]]...
+func parseBatch(r io.Reader) ([]change, error) {
+	var (
+		changes []change
+		index   = make(map[string]int)
+	)
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		args := strings.Fields(s.Text())
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+			continue
+		}
+
+		if args[0] != "set" || len(args) < 2 {
+			return nil, fmt.Errorf("line %d: expected set <device> [options]: %w", n, errUsage)
+		}
+
+		device := args[1]
+		i, ok := index[device]
+		if !ok {
+			i = len(changes)
+			index[device] = i
+			changes = append(changes, change{device: device})
+		}
+
+		if err := parseSet(args[2:], &changes[i].cfg); err != nil {
+			return nil, fmt.Errorf("line %d: %v: %w", n, err, errUsage)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// parseSet parses the options of a set command into cfg.
+func parseSet(args []string, cfg *wgtypes.Config) error {
+	var peer *wgtypes.PeerConfig
+
+	next := func(i *int) (string, error) {
+		opt := args[*i]
+		*i++
+		if *i >= len(args) {
+			return "", fmt.Errorf("option %q requires a value", opt)
+		}
+
+		return args[*i], nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		opt := args[i]
+
+		// Flags without values.
+		switch {
+		case opt == "remove" && peer != nil:
+			peer.Remove = true
+			continue
+		case opt == "peer":
+			v, err := next(&i)
+			if err != nil {
+				return err
+			}
+
+			k, err := wgtypes.ParseKey(v)
+			if err != nil {
+				return fmt.Errorf("invalid peer key: %v", err)
+			}
+
+			cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{PublicKey: k})
+			peer = &cfg.Peers[len(cfg.Peers)-1]
+			continue
+		}
+
+		v, err := next(&i)
+		if err != nil {
+			return err
+		}
+
+		if peer == nil {
+			err = parseDeviceOption(opt, v, cfg)
+		} else {
+			err = parsePeerOption(opt, v, peer)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseDeviceOption parses a single device option of a set command.
+func parseDeviceOption(opt, v string, cfg *wgtypes.Config) error {
+	switch opt {
+	case "listen-port":
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid listen port: %v", err)
+		}
+
+		p := int(port)
+		cfg.ListenPort = &p
+	case "fwmark":
+		var mark uint64
+		if v != "off" {
+			var err error
+			if mark, err = strconv.ParseUint(v, 0, 32); err != nil {
+				return fmt.Errorf("invalid fwmark: %v", err)
+			}
+		}
+
+		m := int(mark)
+		cfg.FirewallMark = &m
+	case "private-key":
+		k, err := readKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid private key: %v", err)
+		}
+
+		cfg.PrivateKey = &k
+	default:
+		return fmt.Errorf("unknown device option %q", opt)
+	}
+
+	return nil
+}
+
+// parsePeerOption parses a single peer option of a set command.
+func parsePeerOption(opt, v string, p *wgtypes.PeerConfig) error {
+	switch opt {
+	case "preshared-key":
+		k, err := readKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid preshared key: %v", err)
+		}
+
+		p.PresharedKey = &k
+	case "endpoint":
+		addr, err := net.ResolveUDPAddr("udp", v)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint: %v", err)
+		}
+
+		p.Endpoint = addr
+	case "persistent-keepalive":
+		var secs uint64
+		if v != "off" {
+			var err error
+			if secs, err = strconv.ParseUint(v, 10, 16); err != nil {
+				return fmt.Errorf("invalid persistent keepalive: %v", err)
+			}
+		}
+
+		d := time.Duration(secs) * time.Second
+		p.PersistentKeepaliveInterval = &d
+	case "allowed-ips":
+		// As with wg(8), allowed IPs replace any existing ones.
+		p.ReplaceAllowedIPs = true
+		p.AllowedIPs = nil
+
+		for _, s := range strings.Split(v, ",") {
+			if s == "" {
+				continue
+			}
+
+			_, ipn, err := net.ParseCIDR(strings.TrimSpace(s))
+			if err != nil {
+				return fmt.Errorf("invalid allowed IP: %v", err)
+			}
+
+			p.AllowedIPs = append(p.AllowedIPs, *ipn)
+		}
+	default:
+		return fmt.Errorf("unknown peer option %q", opt)
+	}
+
+	return nil
+}
+
+// readKey reads a base64-encoded key from the file at path. As with wg(8), an
+// empty file such as /dev/null produces a zero key, which clears the key.
+func readKey(path string) (wgtypes.Key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return wgtypes.Key{}, nil
+	}
+
+	return wgtypes.ParseKey(s)
+}
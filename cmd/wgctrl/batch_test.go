@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgctrltest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseBatch(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+
+		port      = 51820
+		otherPort = 51821
+		mark      = 0x10
+		noMark    = 0
+		keepalive = 25 * time.Second
+		off       = time.Duration(0)
+	)
+
+	dir := t.TempDir()
+	privFile := filepath.Join(dir, "private")
+	pskFile := filepath.Join(dir, "psk")
+	emptyFile := filepath.Join(dir, "empty")
+	for file, s := range map[string]string{
+		privFile:  priv.String() + "\n",
+		pskFile:   psk.String(),
+		emptyFile: "",
+	} {
+		if err := os.WriteFile(file, []byte(s), 0o600); err != nil {
+			t.Fatalf("failed to write key: %v", err)
+		}
+	}
+
+	var zero wgtypes.Key
+
+	tests := []struct {
+		name  string
+		input string
+		want  []change
+		err   string
+	}{
+		{
+			name:  "empty",
+			input: "\n  \n# only a comment\n",
+		},
+		{
+			name:  "device options",
+			input: "set wg0 listen-port 51820 fwmark 0x10 private-key " + privFile,
+			want: []change{{
+				device: "wg0",
+				cfg: wgtypes.Config{
+					ListenPort:   &port,
+					FirewallMark: &mark,
+					PrivateKey:   &priv,
+				},
+			}},
+		},
+		{
+			name:  "fwmark off and empty key",
+			input: "set wg0 fwmark off private-key " + emptyFile,
+			want: []change{{
+				device: "wg0",
+				cfg: wgtypes.Config{
+					FirewallMark: &noMark,
+					PrivateKey:   &zero,
+				},
+			}},
+		},
+		{
+			name: "peer options",
+			input: strings.Join([]string{
+				"set wg0 peer " + keyA.String(),
+				"preshared-key " + pskFile,
+				"endpoint 192.0.2.1:51820",
+				"persistent-keepalive 25",
+				"allowed-ips 10.0.0.1/32,fd00::1/128",
+				"peer " + keyB.String() + " remove persistent-keepalive off",
+			}, " "),
+			want: []change{{
+				device: "wg0",
+				cfg: wgtypes.Config{
+					Peers: []wgtypes.PeerConfig{
+						{
+							PublicKey:                   keyA,
+							PresharedKey:                &psk,
+							Endpoint:                    wgtest.MustUDPAddr("192.0.2.1:51820"),
+							PersistentKeepaliveInterval: &keepalive,
+							ReplaceAllowedIPs:           true,
+							AllowedIPs: []net.IPNet{
+								wgtest.MustCIDR("10.0.0.1/32"),
+								wgtest.MustCIDR("fd00::1/128"),
+							},
+						},
+						{
+							PublicKey:                   keyB,
+							Remove:                      true,
+							PersistentKeepaliveInterval: &off,
+						},
+					},
+				},
+			}},
+		},
+		{
+			name:  "allowed IPs replaced and cleared",
+			input: "set wg0 peer " + keyA.String() + " allowed-ips 10.0.0.1/32 allowed-ips ,",
+			want: []change{{
+				device: "wg0",
+				cfg: wgtypes.Config{
+					Peers: []wgtypes.PeerConfig{{
+						PublicKey:         keyA,
+						ReplaceAllowedIPs: true,
+					}},
+				},
+			}},
+		},
+		{
+			name: "merged by device",
+			input: strings.Join([]string{
+				"# Commands for the same device are merged in order.",
+				"set wg0 listen-port 51820 peer " + keyA.String(),
+				"set wg1 peer " + keyB.String() + " remove",
+				"",
+				"set wg0 listen-port 51821 peer " + keyB.String(),
+			}, "\n"),
+			want: []change{
+				{
+					device: "wg0",
+					cfg: wgtypes.Config{
+						ListenPort: &otherPort,
+						Peers: []wgtypes.PeerConfig{
+							{PublicKey: keyA},
+							{PublicKey: keyB},
+						},
+					},
+				},
+				{
+					device: "wg1",
+					cfg: wgtypes.Config{
+						Peers: []wgtypes.PeerConfig{{
+							PublicKey: keyB,
+							Remove:    true,
+						}},
+					},
+				},
+			},
+		},
+		{
+			name:  "unknown command",
+			input: "\nshow wg0",
+			err:   "line 2: expected set <device> [options]",
+		},
+		{
+			name:  "no device",
+			input: "set",
+			err:   "line 1: expected set <device> [options]",
+		},
+		{
+			name:  "unknown device option",
+			input: "set wg0 mtu 1420",
+			err:   `line 1: unknown device option "mtu"`,
+		},
+		{
+			name:  "unknown peer option",
+			input: "set wg0 peer " + keyA.String() + " listen-port 1",
+			err:   `line 1: unknown peer option "listen-port"`,
+		},
+		{
+			name:  "missing value",
+			input: "set wg0 listen-port",
+			err:   `line 1: option "listen-port" requires a value`,
+		},
+		{
+			name:  "remove without peer",
+			input: "set wg0 remove",
+			err:   `line 1: option "remove" requires a value`,
+		},
+		{
+			name:  "invalid peer key",
+			input: "set wg0 peer foo",
+			err:   "line 1: invalid peer key",
+		},
+		{
+			name:  "invalid listen port",
+			input: "set wg0 listen-port 65536",
+			err:   "line 1: invalid listen port",
+		},
+		{
+			name:  "invalid keepalive",
+			input: "set wg0 peer " + keyA.String() + " persistent-keepalive 65536",
+			err:   "line 1: invalid persistent keepalive",
+		},
+		{
+			name:  "invalid allowed IP",
+			input: "set wg0 peer " + keyA.String() + " allowed-ips 10.0.0.1",
+			err:   "line 1: invalid allowed IP",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBatch(strings.NewReader(tt.input))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, but got: %v", tt.err, err)
+				}
+				if !errors.Is(err, errUsage) {
+					t.Fatalf("expected a usage error, but got: %v", err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse batch: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(change{})); diff != "" {
+				t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApplyStagedRestore(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		port = 51821
+	)
+
+	c := wgctrltest.New()
+	for _, name := range []string{"wg0", "wg1", "wg2"} {
+		c.AddDevice(&wgtypes.Device{
+			Name:       name,
+			ListenPort: 51820,
+			Peers:      []wgtypes.Peer{{PublicKey: keyA}},
+		})
+	}
+
+	cfg := wgtypes.Config{
+		ListenPort: &port,
+		Peers: []wgtypes.PeerConfig{
+			{PublicKey: keyA, Remove: true},
+			{PublicKey: keyB},
+		},
+	}
+
+	var ss []staged
+	for _, name := range []string{"wg0", "wg1", "wg2"} {
+		d, err := c.Device(name)
+		if err != nil {
+			t.Fatalf("failed to get device: %v", err)
+		}
+
+		ss = append(ss, staged{
+			change: change{device: name, cfg: cfg},
+			c:      c.Client,
+			d:      d,
+		})
+	}
+
+	// Only the first configuration of wg2 fails, so the devices before it
+	// can be restored.
+	errFail := errors.New("failed")
+	failed := false
+	c.SetError(func(op wgctrltest.Op, name string) error {
+		if op == wgctrltest.OpConfigureDevice && name == "wg2" && !failed {
+			failed = true
+			return errFail
+		}
+
+		return nil
+	})
+
+	if err := applyStaged(ss); !errors.Is(err, errFail) {
+		t.Fatalf("expected configuration error, but got: %v", err)
+	}
+
+	for _, s := range ss {
+		d, err := c.Device(s.device)
+		if err != nil {
+			t.Fatalf("failed to get device: %v", err)
+		}
+
+		if diff := wgtypes.Diff(s.d, d); len(diff) > 0 {
+			t.Fatalf("device %q was not restored: %v", s.device, diff)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// supportBundle writes a gzipped tarball for attaching to bug reports. It
+// contains a dump of every device, the result of probing for WireGuard
+// implementations, the events reported while watching devices, and a
+// description of the environment.
+//
+// Private and preshared keys are never included. Public keys and endpoint
+// addresses are replaced by a keyed hash which is unique to each bundle, so
+// that they can be correlated within a bundle but not recovered from it.
+func supportBundle(cs []*wgctrl.Client, args []string) {
+	fs := flag.NewFlagSet("support-bundle", flag.ExitOnError)
+	out := fs.String("output", "", "path of the bundle (default wgctrl-support-<time>.tar.gz)")
+	watch := fs.Duration("watch", 5*time.Second, "how long to record watcher events")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fatalf(errUsage, "usage: wgctrl support-bundle [--output file] [--watch duration]")
+	}
+
+	now := time.Now().UTC()
+	if *out == "" {
+		*out = fmt.Sprintf("wgctrl-support-%s.tar.gz", now.Format("20060102T150405Z"))
+	}
+
+	r, err := newRedactor()
+	if err != nil {
+		fatalf(err, "failed to initialize redaction: %v", err)
+	}
+
+	var files []bundleFile
+	add := func(name string, v interface{}) {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			fatalf(err, "failed to encode %s: %v", name, err)
+		}
+
+		files = append(files, bundleFile{name: name, data: append(b, '\n')})
+	}
+
+	add("environment.json", newBundleEnvironment(now))
+	add("probe.json", newBundleProbe())
+	add("devices.json", bundleDevices(cs, r))
+	add("events.json", bundleEvents(cs, r, *watch))
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fatalf(err, "failed to create bundle: %v", err)
+	}
+
+	if err := writeBundle(f, now, files); err != nil {
+		_ = f.Close()
+		fatalf(err, "failed to write bundle: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		fatalf(err, "failed to write bundle: %v", err)
+	}
+
+	fmt.Println(*out)
+}
+
+// A bundleFile is a single file in a support bundle.
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// writeBundle writes files to w as a gzipped tarball, in order.
+func writeBundle(w io.Writer, mtime time.Time, files []bundleFile) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    "wgctrl-support/" + f.name,
+			Mode:    0o644,
+			Size:    int64(len(f.data)),
+			ModTime: mtime,
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// A redactor replaces identifying values with a keyed hash.
+type redactor struct {
+	key []byte
+}
+
+// newRedactor creates a redactor with a random key, so that hashes can't be
+// correlated across bundles or reversed by enumerating addresses.
+func newRedactor() (*redactor, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &redactor{key: key}, nil
+}
+
+// hash returns a short keyed hash of b.
+func (r *redactor) hash(b []byte) string {
+	h := hmac.New(sha256.New, r.key)
+	_, _ = h.Write(b)
+	return "redacted-" + hex.EncodeToString(h.Sum(nil)[:6])
+}
+
+// Key redacts the base64-encoded key s.
+func (r *redactor) Key(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	return r.hash([]byte(s))
+}
+
+// Endpoint redacts the address of the endpoint s, keeping its port and
+// address family.
+func (r *redactor) Endpoint(s string) string {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return r.hash([]byte(s))
+	}
+
+	redacted := r.hash([]byte(host))
+	if strings.Contains(host, ":") {
+		redacted = "[" + redacted + "]"
+	}
+
+	return redacted + ":" + port
+}
+
+// Device redacts the keys and endpoints of d.
+func (r *redactor) Device(d *jsonDevice) {
+	d.PublicKey = r.Key(d.PublicKey)
+	for i := range d.Peers {
+		p := &d.Peers[i]
+		p.PublicKey = r.Key(p.PublicKey)
+		if p.Endpoint != "" {
+			p.Endpoint = r.Endpoint(p.Endpoint)
+		}
+	}
+}
+
+// bundleEnvironment describes the system which produced a support bundle.
+type bundleEnvironment struct {
+	Time      string `json:"time"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Kernel    string `json:"kernel,omitempty"`
+	Module    string `json:"module,omitempty"`
+	Version   string `json:"version,omitempty"`
+}
+
+// newBundleEnvironment describes the current environment at now.
+func newBundleEnvironment(now time.Time) bundleEnvironment {
+	env := bundleEnvironment{
+		Time:      now.Format(time.RFC3339),
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+
+	// The kernel version is only readily available on Linux.
+	if b, err := os.ReadFile("/proc/version"); err == nil {
+		env.Kernel = strings.TrimSpace(string(b))
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, m := range bi.Deps {
+			if m.Path == "github.com/danpashin/wgctrl" {
+				env.Module, env.Version = m.Path, m.Version
+			}
+		}
+		if env.Module == "" {
+			env.Module, env.Version = bi.Main.Path, bi.Main.Version
+		}
+	}
+
+	return env
+}
+
+// bundleBackend is the JSON representation of a wgctrl.BackendStatus.
+type bundleBackend struct {
+	ClientType string   `json:"client_type"`
+	Type       string   `json:"type"`
+	Available  bool     `json:"available"`
+	Version    string   `json:"version,omitempty"`
+	Devices    []string `json:"devices,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// bundleProbe is the result of probing for WireGuard implementations.
+type bundleProbe struct {
+	Backends []bundleBackend `json:"backends"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// newBundleProbe probes for WireGuard implementations. A failure is recorded
+// in the result rather than preventing the bundle from being written.
+func newBundleProbe() bundleProbe {
+	var out bundleProbe
+
+	r, err := wgctrl.Probe()
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+
+	for _, b := range r.Backends {
+		bb := bundleBackend{
+			ClientType: b.ClientType.String(),
+			Type:       b.Type.String(),
+			Available:  b.Available,
+			Version:    b.Version,
+			Devices:    b.Devices,
+		}
+		if b.Err != nil {
+			bb.Error = b.Err.Error()
+		}
+
+		out.Backends = append(out.Backends, bb)
+	}
+
+	return out
+}
+
+// bundleDeviceDump is the redacted --json document of every device, along
+// with any errors retrieving them.
+type bundleDeviceDump struct {
+	jsonOutput
+	Errors []string `json:"errors,omitempty"`
+}
+
+// bundleDevices retrieves and redacts every device known to cs.
+func bundleDevices(cs []*wgctrl.Client, r *redactor) bundleDeviceDump {
+	out := bundleDeviceDump{jsonOutput: jsonOutput{
+		Version: jsonVersion,
+		Devices: []jsonDevice{},
+	}}
+
+	for _, c := range cs {
+		devices, err := c.Devices()
+		if err != nil {
+			out.Errors = append(out.Errors, fmt.Sprintf("%s: %v", c.Type(), err))
+			continue
+		}
+
+		for _, d := range devices {
+			jd := newJSONDevice(d)
+			r.Device(&jd)
+			out.Devices = append(out.Devices, jd)
+		}
+	}
+
+	return out
+}
+
+// bundleEvent is the JSON representation of a wgctrl.WatchEvent.
+type bundleEvent struct {
+	Time     string `json:"time"`
+	Kind     string `json:"kind"`
+	Device   string `json:"device"`
+	Peer     string `json:"peer,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// bundleWatch is the record of watching devices for a period of time.
+type bundleWatch struct {
+	Seconds float64       `json:"seconds"`
+	Events  []bundleEvent `json:"events"`
+	Errors  []string      `json:"errors,omitempty"`
+}
+
+// bundleEvents watches the devices known to cs for d and returns the redacted
+// events which were reported.
+func bundleEvents(cs []*wgctrl.Client, r *redactor, d time.Duration) bundleWatch {
+	out := bundleWatch{
+		Seconds: d.Seconds(),
+		Events:  []bundleEvent{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for _, c := range cs {
+		events, err := c.Watch(ctx)
+		if err != nil {
+			out.Errors = append(out.Errors, fmt.Sprintf("%s: %v", c.Type(), err))
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for e := range events {
+				be := bundleEvent{
+					Time:   e.Time.UTC().Format(time.RFC3339Nano),
+					Kind:   e.Kind.String(),
+					Device: e.Device,
+				}
+				if e.Peer != (wgtypes.Key{}) {
+					be.Peer = r.Key(e.Peer.String())
+				}
+				if e.Endpoint != nil {
+					be.Endpoint = r.Endpoint(e.Endpoint.String())
+				}
+
+				mu.Lock()
+				out.Events = append(out.Events, be)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return out
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// ANSI escape sequences used to colorize diff output.
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+// diff prints the configuration differences between a and b, each of which
+// is a wg(8) configuration file if such a file exists, or otherwise a device.
+// A file is compared as it would be applied to the other device, replacing its
+// peers, or as applied to an unconfigured device if both are files.
+func diff(cs []*wgctrl.Client, a, b string) {
+	ca, aok := loadConfig(a)
+	cb, bok := loadConfig(b)
+
+	da, db := &wgtypes.Device{}, &wgtypes.Device{}
+	if !aok {
+		da = findDevice(cs, a)
+	}
+	if !bok {
+		db = findDevice(cs, b)
+	}
+
+	switch {
+	case aok && bok:
+		da, db = wgtypes.Preview(da, ca), wgtypes.Preview(db, cb)
+	case aok:
+		da = wgtypes.Preview(db, wgtypes.Reconcile(db, ca))
+	case bok:
+		db = wgtypes.Preview(da, wgtypes.Reconcile(da, cb))
+	}
+
+	fmt.Printf("--- %s\n+++ %s\n", a, b)
+	printChangeLines(wgtypes.Diff(da, db))
+}
+
+// loadConfig parses the wg(8) configuration file at path, reporting whether
+// such a file exists.
+func loadConfig(path string) (wgtypes.Config, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return wgtypes.Config{}, false
+		}
+
+		fatalf(err, "failed to open configuration: %v", err)
+	}
+	defer f.Close()
+
+	cfg, err := wgtypes.ParseConfig(f)
+	if err != nil {
+		fatalf(errUsage, "failed to parse %q: %v", path, err)
+	}
+
+	return cfg, true
+}
+
+// printChanges prints the pending changes to the device specified by name.
+func printChanges(name string, changes []wgtypes.Change) {
+	fmt.Printf("--- %s\n+++ %s (pending)\n", name, name)
+	printChangeLines(changes)
+}
+
+// printChangeLines prints each change as a pair of removed and added lines.
+func printChangeLines(changes []wgtypes.Change) {
+	color := useColor()
+	line := func(prefix, c, field, value string, secret bool) {
+		if value == "" {
+			return
+		}
+		if secret {
+			value = "(hidden)"
+		}
+
+		if color {
+			fmt.Printf("%s%s %s: %s%s\n", c, prefix, field, value, colorReset)
+			return
+		}
+
+		fmt.Printf("%s %s: %s\n", prefix, field, value)
+	}
+
+	for _, c := range changes {
+		field := c.Field
+		if c.Peer != nil && c.Field != "Peer" {
+			field = fmt.Sprintf("Peer %s %s", c.Peer.String(), c.Field)
+		}
+
+		line("-", colorRed, field, c.Old, c.Secret)
+		line("+", colorGreen, field, c.New, c.Secret)
+	}
+}
+
+// useColor determines if output should be colorized, which is the case when
+// writing to a terminal and NO_COLOR is unset.
+func useColor() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
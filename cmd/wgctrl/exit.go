@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// Exit codes used by wgctrl, so that scripts can branch on the cause of a
+// failure rather than parsing error messages.
+const (
+	exitFailure            = 1
+	exitUsage              = 2
+	exitNotFound           = 3
+	exitPermissionDenied   = 4
+	exitBackendUnavailable = 5
+	exitValidationFailed   = 6
+	exitChangesPending     = 7
+)
+
+// errUsage indicates that wgctrl was invoked incorrectly.
+var errUsage = errors.New("invalid usage")
+
+// A backendError indicates that a device implementation could not be used.
+type backendError struct {
+	err error
+}
+
+func (e *backendError) Error() string { return e.err.Error() }
+func (e *backendError) Unwrap() error { return e.err }
+
+// exitCode determines the exit code for err.
+func exitCode(err error) int {
+	var verr *wgtypes.ValidationError
+	var berr *backendError
+
+	// Usage errors and a system with no device implementations are matched
+	// first. Permission errors are matched before the remaining causes, as
+	// they may also prevent the use of a device implementation.
+	switch {
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, wgctrl.ErrNoBackends):
+		return exitBackendUnavailable
+	case errors.Is(err, os.ErrPermission):
+		return exitPermissionDenied
+	case errors.Is(err, os.ErrNotExist):
+		return exitNotFound
+	case errors.As(err, &berr):
+		return exitBackendUnavailable
+	case errors.As(err, &verr):
+		return exitValidationFailed
+	default:
+		return exitFailure
+	}
+}
+
+// fatalf logs a formatted message and exits with the exit code for err.
+func fatalf(err error, format string, v ...interface{}) {
+	log.Printf(format, v...)
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// formatFuncs are the functions available to --format templates, in addition
+// to the text/template builtins.
+var formatFuncs = template.FuncMap{
+	// ips formats allowed IPs as a comma-separated list.
+	"ips": func(ipns []net.IPNet) string {
+		ss := make([]string, 0, len(ipns))
+		for _, ipn := range ipns {
+			ss = append(ss, ipn.String())
+		}
+
+		return strings.Join(ss, ",")
+	},
+	"join": strings.Join,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// templatePrinter returns a function which prints each device using the Go
+// template text, such as '{{.Name}} {{len .Peers}}'. As with docker and
+// kubectl, a newline is printed after each device.
+func templatePrinter(text string) (func(d *wgtypes.Device), error) {
+	t, err := template.New("format").Funcs(formatFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(d *wgtypes.Device) {
+		if err := t.Execute(os.Stdout, d); err != nil {
+			fatalf(err, "failed to execute format template: %v", err)
+		}
+
+		fmt.Println()
+	}, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// jsonVersion is the version of the --json output format. Changes to the
+// format are additive only: fields may be added, but are never removed,
+// renamed, or given a different type. jsonVersion is incremented if a
+// breaking change is ever unavoidable.
+const jsonVersion = 1
+
+// jsonOutput is the document printed by --json. The field tags are the
+// source of the schema printed by the schema command, so each field must have
+// a doc tag.
+type jsonOutput struct {
+	Version int          `json:"version" doc:"Version of the output format, incremented only for breaking changes."`
+	Devices []jsonDevice `json:"devices" doc:"WireGuard devices, in the order reported by the system."`
+}
+
+type jsonDevice struct {
+	Name             string                `json:"name" doc:"Interface name."`
+	Index            int                   `json:"index" doc:"Network interface index, or 0 if unknown."`
+	Type             string                `json:"type" doc:"Implementation of the device, such as linux kernel or userspace."`
+	PublicKey        string                `json:"public_key" doc:"Base64-encoded public key. The private key is never printed."`
+	ListenPort       int                   `json:"listen_port" doc:"UDP port the device listens on."`
+	FirewallMark     int                   `json:"firewall_mark" doc:"Firewall mark applied to outgoing packets, or 0 if unset."`
+	AdvancedSecurity *jsonAdvancedSecurity `json:"advanced_security,omitempty" doc:"AmneziaWG obfuscation parameters, if enabled."`
+	Peers            []jsonPeer            `json:"peers" doc:"Peers of the device."`
+}
+
+type jsonAdvancedSecurity struct {
+	Jc    uint16 `json:"jc" doc:"Number of junk packets sent before a handshake."`
+	Jmin  uint16 `json:"jmin" doc:"Minimum size of junk packets."`
+	Jmax  uint16 `json:"jmax" doc:"Maximum size of junk packets."`
+	S1    uint16 `json:"s1" doc:"Junk bytes prepended to handshake initiations."`
+	S2    uint16 `json:"s2" doc:"Junk bytes prepended to handshake responses."`
+	S3    uint16 `json:"s3,omitempty" doc:"Junk bytes prepended to cookie replies (AmneziaWG 1.5)."`
+	S4    uint16 `json:"s4,omitempty" doc:"Junk bytes prepended to transport data (AmneziaWG 1.5)."`
+	H1    uint32 `json:"h1" doc:"Magic header of handshake initiations."`
+	H2    uint32 `json:"h2" doc:"Magic header of handshake responses."`
+	H3    uint32 `json:"h3" doc:"Magic header of cookie replies."`
+	H4    uint32 `json:"h4" doc:"Magic header of transport data."`
+	I1    string `json:"i1,omitempty" doc:"First special junk packet sent before a handshake (AmneziaWG 1.5)."`
+	I2    string `json:"i2,omitempty" doc:"Second special junk packet (AmneziaWG 1.5)."`
+	I3    string `json:"i3,omitempty" doc:"Third special junk packet (AmneziaWG 1.5)."`
+	I4    string `json:"i4,omitempty" doc:"Fourth special junk packet (AmneziaWG 1.5)."`
+	I5    string `json:"i5,omitempty" doc:"Fifth special junk packet (AmneziaWG 1.5)."`
+	Itime uint32 `json:"itime,omitempty" doc:"Seconds between resending special junk packets (AmneziaWG 1.5)."`
+}
+
+type jsonPeer struct {
+	PublicKey           string   `json:"public_key" doc:"Base64-encoded public key."`
+	HasPresharedKey     bool     `json:"has_preshared_key" doc:"Whether a preshared key is set. The key itself is never printed."`
+	Endpoint            string   `json:"endpoint,omitempty" doc:"Most recent endpoint address and port, if known."`
+	PersistentKeepalive int      `json:"persistent_keepalive" doc:"Persistent keepalive interval in seconds, or 0 if disabled."`
+	LatestHandshake     string   `json:"latest_handshake,omitempty" doc:"Time of the most recent handshake in RFC 3339 format, if any."`
+	ReceiveBytes        int64    `json:"receive_bytes" doc:"Bytes received from the peer."`
+	TransmitBytes       int64    `json:"transmit_bytes" doc:"Bytes transmitted to the peer."`
+	AllowedIPs          []string `json:"allowed_ips" doc:"Allowed IP networks in CIDR notation."`
+	ProtocolVersion     int      `json:"protocol_version" doc:"WireGuard protocol version in use."`
+}
+
+// newJSONDevice converts d to its --json representation.
+func newJSONDevice(d *wgtypes.Device) jsonDevice {
+	jd := jsonDevice{
+		Name:         d.Name,
+		Index:        d.Index,
+		Type:         d.Type.String(),
+		PublicKey:    d.PublicKey.String(),
+		ListenPort:   d.ListenPort,
+		FirewallMark: d.FirewallMark,
+		Peers:        make([]jsonPeer, 0, len(d.Peers)),
+	}
+
+	if as := d.AdvancedSecurity; as.IsEnabled() {
+		jd.AdvancedSecurity = &jsonAdvancedSecurity{
+			Jc:    as.JunkPacketCount,
+			Jmin:  as.JunkPacketMinSize,
+			Jmax:  as.JunkPacketMaxSize,
+			S1:    as.InitPacketJunkSize,
+			S2:    as.ResponsePacketJunkSize,
+			S3:    as.UnderloadPacketJunkSize,
+			S4:    as.TransportPacketJunkSize,
+			H1:    as.InitPacketMagicHeader,
+			H2:    as.ResponsePacketMagicHeader,
+			H3:    as.UnderloadPacketMagicHeader,
+			H4:    as.TransportPacketMagicHeader,
+			I1:    as.SpecialJunkPacket1,
+			I2:    as.SpecialJunkPacket2,
+			I3:    as.SpecialJunkPacket3,
+			I4:    as.SpecialJunkPacket4,
+			I5:    as.SpecialJunkPacket5,
+			Itime: as.SpecialJunkInterval,
+		}
+	}
+
+	for _, p := range d.Peers {
+		jp := jsonPeer{
+			PublicKey:           p.PublicKey.String(),
+			HasPresharedKey:     p.PresharedKey != (wgtypes.Key{}),
+			PersistentKeepalive: int(p.PersistentKeepaliveInterval / time.Second),
+			ReceiveBytes:        p.ReceiveBytes,
+			TransmitBytes:       p.TransmitBytes,
+			AllowedIPs:          make([]string, 0, len(p.AllowedIPs)),
+			ProtocolVersion:     p.ProtocolVersion,
+		}
+
+		if p.Endpoint != nil {
+			jp.Endpoint = p.Endpoint.String()
+		}
+		if !p.LastHandshakeTime.IsZero() {
+			jp.LatestHandshake = p.LastHandshakeTime.UTC().Format(time.RFC3339Nano)
+		}
+		for _, ipn := range p.AllowedIPs {
+			jp.AllowedIPs = append(jp.AllowedIPs, ipn.String())
+		}
+
+		jd.Peers = append(jd.Peers, jp)
+	}
+
+	return jd
+}
+
+// printJSON prints devices to w as a versioned --json document.
+func printJSON(w io.Writer, devices []*wgtypes.Device) error {
+	out := jsonOutput{
+		Version: jsonVersion,
+		Devices: make([]jsonDevice, 0, len(devices)),
+	}
+	for _, d := range devices {
+		out.Devices = append(out.Devices, newJSONDevice(d))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// printSchema prints the JSON Schema of the --json output to w.
+func printSchema(w io.Writer) error {
+	s := schemaOf(reflect.TypeOf(jsonOutput{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = fmt.Sprintf("https://github.com/danpashin/wgctrl/cmd/wgctrl/v%d", jsonVersion)
+	s["title"] = "wgctrl --json output"
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// schemaOf returns the JSON Schema of values of type t, as encoded by
+// encoding/json.
+func schemaOf(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Struct:
+		var (
+			props    = make(map[string]interface{})
+			required []string
+		)
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+
+			p := schemaOf(f.Type)
+			p["description"] = f.Tag.Get("doc")
+			props[name] = p
+
+			if opts != "omitempty" {
+				required = append(required, name)
+			}
+		}
+
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": props,
+			"required":   required,
+		}
+	default:
+		panic(fmt.Sprintf("wgctrl: no JSON schema for type %s", t))
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgdiag"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// jsonLintOutput is the document printed by lint --json. It is versioned
+// along with the --json output format.
+type jsonLintOutput struct {
+	Version  int           `json:"version" doc:"Version of the output format, incremented only for breaking changes."`
+	Findings []jsonFinding `json:"findings" doc:"Problems found, errors first."`
+}
+
+type jsonFinding struct {
+	Source   string `json:"source" doc:"Configuration file or device name which was checked."`
+	Severity string `json:"severity" doc:"Either error or warning."`
+	Code     string `json:"code" doc:"Short, stable identifier for the problem."`
+	Peer     string `json:"peer,omitempty" doc:"Base64-encoded public key of the peer concerned, if any."`
+	Detail   string `json:"detail" doc:"Human-readable explanation of the problem."`
+}
+
+// lint checks wg(8) configuration files and devices for mistakes using
+// wgdiag.LintConfig and wgdiag.Lint, and prints each problem found. An
+// argument is treated as a file if one exists at that path, and otherwise as
+// a device name. Clients are only opened if a device is checked, so that
+// files can be checked on systems without WireGuard, such as in CI.
+//
+// wgctrl exits with exitValidationFailed if any errors are found, or if any
+// warnings are found with --strict.
+func lint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "print problems as a JSON document")
+	strict := fs.Bool("strict", false, "fail on warnings as well as errors")
+	mtu := fs.Int("mtu", 0, "path MTU used to check AmneziaWG packet sizes (default 1500)")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fatalf(errUsage, "usage: wgctrl lint [--json] [--strict] [--mtu mtu] <file|device>...")
+	}
+
+	var (
+		cs        []*wgctrl.Client
+		findings  []jsonFinding
+		nerrors   int
+		nwarnings int
+	)
+	defer func() {
+		for _, c := range cs {
+			c.Close()
+		}
+	}()
+
+	for _, arg := range fs.Args() {
+		var found []wgdiag.Finding
+		if _, err := os.Stat(arg); err == nil {
+			found = lintFile(arg, *mtu)
+		} else {
+			if cs == nil {
+				cs = openClients("")
+			}
+
+			found = wgdiag.Lint(findDevice(cs, arg), *mtu)
+		}
+
+		for _, f := range found {
+			if f.Severity == wgdiag.SeverityError {
+				nerrors++
+			} else {
+				nwarnings++
+			}
+
+			jf := jsonFinding{
+				Source:   arg,
+				Severity: f.Severity.String(),
+				Code:     f.Code,
+				Detail:   f.Detail,
+			}
+			if f.Peer != nil {
+				jf.Peer = f.Peer.String()
+			}
+
+			findings = append(findings, jf)
+		}
+	}
+
+	if *jsonOut {
+		if err := printLintJSON(os.Stdout, findings); err != nil {
+			fatalf(err, "failed to print problems: %v", err)
+		}
+	} else {
+		printFindings(os.Stdout, findings)
+	}
+
+	if nerrors > 0 || (*strict && nwarnings > 0) {
+		log.Printf("found %d errors and %d warnings", nerrors, nwarnings)
+		os.Exit(exitValidationFailed)
+	}
+}
+
+// lintFile parses and checks the wg(8) configuration file at path, as it
+// would be applied to a device named after the file.
+func lintFile(path string, mtu int) []wgdiag.Finding {
+	f, err := os.Open(path)
+	if err != nil {
+		fatalf(err, "failed to open configuration: %v", err)
+	}
+	defer f.Close()
+
+	cfg, err := wgtypes.ParseConfig(f)
+	if err != nil {
+		return []wgdiag.Finding{{
+			Severity: wgdiag.SeverityError,
+			Code:     wgdiag.FindingInvalidConfig,
+			Detail:   err.Error(),
+		}}
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), ".conf")
+	return wgdiag.LintConfig(name, cfg, mtu)
+}
+
+// printFindings prints each finding on a line, prefixed by its source.
+func printFindings(w io.Writer, findings []jsonFinding) {
+	for _, f := range findings {
+		peer := ""
+		if f.Peer != "" {
+			peer = fmt.Sprintf(" (peer %s)", f.Peer)
+		}
+
+		fmt.Fprintf(w, "%s: %s: %s: %s%s\n", f.Source, f.Severity, f.Code, f.Detail, peer)
+	}
+}
+
+// printLintJSON prints findings as a jsonLintOutput document.
+func printLintJSON(w io.Writer, findings []jsonFinding) error {
+	if findings == nil {
+		findings = []jsonFinding{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonLintOutput{
+		Version:  jsonVersion,
+		Findings: findings,
+	})
+}
@@ -3,52 +3,249 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"net"
+	"os"
 	"strings"
 
 	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgstore"
 	"github.com/danpashin/wgctrl/wgtypes"
 )
 
+const usage = `usage: wgctrl [--history file] [--format template | --json] [device]
+       wgctrl set <device> [options]
+       wgctrl diff <file|device> <file|device>
+       wgctrl batch < commands
+       wgctrl apply [--check] [--diff] <directory>
+       wgctrl lint [--json] [--strict] [--mtu mtu] <file|device>...
+       wgctrl --history file rollback <device>
+       wgctrl support-bundle [--output file] [--watch duration]
+       wgctrl selftest [--amnezia] [--timeout duration]
+       wgctrl schema
+
+--format executes a Go template for each device, such as:
+  wgctrl --format '{{.Name}}{{range .Peers}} {{.PublicKey}}{{end}}'
+The functions ips, join, and json are available to templates.
+
+--json prints a versioned JSON document, whose JSON Schema is printed by
+schema. Changes to the document are additive only, so parsers should ignore
+unknown fields; the version is only incremented for breaking changes.
+
+set configures a device with the options of wg(8) set:
+  private-key <file>, listen-port <port>, fwmark <mark>, and
+  peer <key> [remove] [preshared-key <file>] [endpoint <ip>:<port>]
+  [persistent-keepalive <interval>] [allowed-ips <ip>/<cidr>[,...]]
+
+diff prints the differences between two devices or wg(8) configuration files.
+A file is compared as it would be applied to the other device by apply.
+
+batch reads wg(8)-style "set <device> ..." commands from stdin, one per line,
+and applies them as a single change per device. Nothing is applied unless
+every command parses and every device exists.
+
+apply configures each device from the wg(8) configuration file <device>.conf
+in directory, replacing its peers as with "wg syncconf", and prints a result
+for each device. --diff prints the changes to each device, and --check only
+reports them, exiting with code 7 if any device would change.
+
+lint checks wg(8) configuration files, or devices if no such file exists, for
+mistakes: invalid or duplicate keys, allowed IPs assigned to several peers,
+endpoints routed through the tunnel, and AmneziaWG parameters which prevent
+handshakes or exceed the path MTU (--mtu, 1500 by default). Each problem is
+printed as an error or a warning, or as a JSON document with --json. lint exits
+with code 6 if any errors are found, or any warnings with --strict.
+
+--history records the configuration of each device changed by set, batch, or
+apply in file, keeping the last 10 configurations of each device. rollback
+reverts the most recent recorded change to device, and may be repeated to
+revert earlier changes. The file contains private keys.
+
+support-bundle writes a tarball for attaching to bug reports, containing every
+device, the WireGuard implementations found, the device changes seen while
+watching for --watch (5s by default), and details of the system. Private and
+preshared keys are omitted, and public keys and endpoint addresses are
+replaced by hashes which are unique to the bundle.
+
+selftest checks that WireGuard works on this system. It creates a pair of
+devices in temporary network namespaces, configures them as peers of each
+other, checks that they complete a handshake and carry data within --timeout
+(10s by default), and deletes them. --amnezia tests AmneziaWG devices with
+obfuscation parameters instead. selftest is only available on Linux, and
+typically requires root.
+
+exit codes:
+  1  unspecified failure
+  2  invalid usage
+  3  device not found
+  4  permission denied
+  5  no WireGuard implementation available
+  6  invalid configuration (or lint found problems)
+  7  changes pending (apply --check)`
+
 func main() {
+	format := flag.String("format", "", "print each device using a Go template")
+	jsonOut := flag.Bool("json", false, "print devices as a versioned JSON document")
+	history := flag.String("history", "", "record device changes in file for rollback")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	if *format != "" && *jsonOut {
+		fatalf(errUsage, "--format and --json are mutually exclusive")
+	}
+
+	switch flag.Arg(0) {
+	case "schema":
+		if err := printSchema(os.Stdout); err != nil {
+			fatalf(err, "failed to print schema: %v", err)
+		}
+		return
+	case "lint":
+		// Files can be checked without any WireGuard implementation.
+		lint(flag.Args()[1:])
+		return
+	case "selftest":
+		// The self-test uses clients of its own in temporary namespaces.
+		selftest(flag.Args()[1:])
+		return
+	}
+
+	var devices []*wgtypes.Device
+	printer := printDevicePeers
+	switch {
+	case *format != "":
+		p, err := templatePrinter(*format)
+		if err != nil {
+			fatalf(errUsage, "invalid format template: %v", err)
+		}
+
+		printer = p
+	case *jsonOut:
+		// Collect the devices to print them as a single document.
+		printer = func(d *wgtypes.Device) {
+			devices = append(devices, d)
+		}
+	}
+
+	cs := openClients(*history)
+	defer func() {
+		for _, c := range cs {
+			c.Close()
+		}
+	}()
+
+	switch flag.Arg(0) {
+	case "set":
+		set(cs, flag.Args()[1:])
+	case "diff":
+		if flag.NArg() != 3 {
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+
+		diff(cs, flag.Arg(1), flag.Arg(2))
+	case "batch":
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+
+		batch(cs, os.Stdin)
+	case "apply":
+		apply(cs, flag.Args()[1:])
+	case "rollback":
+		rollback(cs, *history, flag.Args()[1:])
+	case "support-bundle":
+		supportBundle(cs, flag.Args()[1:])
+	default:
+		show(cs, flag.Arg(0), printer)
+
+		if *jsonOut {
+			if err := printJSON(os.Stdout, devices); err != nil {
+				fatalf(err, "failed to print devices: %v", err)
+			}
+		}
+	}
+}
+
+// openClients opens a wgctrl.Client for each supported client type. If
+// history is not empty, changes are recorded in the file it names.
+func openClients(history string) []*wgctrl.Client {
 	clientTypes := [](wgtypes.ClientType){
 		wgtypes.NativeClient, wgtypes.AmneziaClient,
 	}
 
+	var opts []wgctrl.Option
+	if history != "" {
+		opts = append(opts, wgctrl.WithHistory(&wgctrl.History{
+			Store: &wgstore.FileStore{Path: history},
+		}))
+	}
+
+	cs := make([]*wgctrl.Client, 0, len(clientTypes))
 	for _, clientType := range clientTypes {
-		c, err := wgctrl.New(clientType)
+		c, err := wgctrl.New(clientType, opts...)
 		if err != nil {
-			log.Fatalf("failed to open wgctrl: %v", err)
+			fatalf(&backendError{err: err}, "failed to open wgctrl: %v", err)
 		}
-		defer c.Close()
 
-		var devices []*wgtypes.Device
-		if device := flag.Arg(0); device != "" {
-			d, err := c.Device(device)
-			if err != nil {
-				log.Fatalf("failed to get device %q: %v", device, err)
-			}
+		cs = append(cs, c)
+	}
 
-			devices = append(devices, d)
-		} else {
-			devices, err = c.Devices()
-			if err != nil {
-				log.Fatalf("failed to get devices: %v", err)
-			}
+	return cs
+}
+
+// findDevice retrieves the device specified by name from the first client
+// which knows about it. If no client does, the last error other than
+// os.ErrNotExist is reported, such as a permission error.
+func findDevice(cs []*wgctrl.Client, name string) *wgtypes.Device {
+	err := os.ErrNotExist
+	for _, c := range cs {
+		d, derr := c.Device(name)
+		switch {
+		case derr == nil:
+			return d
+		case !errors.Is(derr, os.ErrNotExist):
+			err = derr
 		}
+	}
 
-		for _, d := range devices {
-			printDevice(d)
+	fatalf(err, "failed to get device %q: %v", name, err)
+	return nil
+}
 
-			for _, p := range d.Peers {
-				printPeer(p)
-			}
+// show prints the device specified by name, or all devices if name is empty,
+// using printer.
+func show(cs []*wgctrl.Client, name string, printer func(d *wgtypes.Device)) {
+	if name != "" {
+		printer(findDevice(cs, name))
+		return
+	}
+
+	for _, c := range cs {
+		devices, err := c.Devices()
+		if err != nil {
+			fatalf(err, "failed to get devices: %v", err)
 		}
+
+		for _, d := range devices {
+			printer(d)
+		}
+	}
+}
+
+// printDevicePeers prints d and each of its peers in a human-readable format.
+func printDevicePeers(d *wgtypes.Device) {
+	printDevice(d)
+
+	for _, p := range d.Peers {
+		printPeer(p)
 	}
 }
 
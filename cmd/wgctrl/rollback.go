@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/danpashin/wgctrl"
+)
+
+// rollback reverts the most recent change to a device recorded in the
+// --history file by a previous set, batch, or apply.
+func rollback(cs []*wgctrl.Client, history string, args []string) {
+	if len(args) != 1 {
+		fatalf(errUsage, "usage: wgctrl --history <file> rollback <device>")
+	}
+	if history == "" {
+		fatalf(errUsage, "rollback requires --history")
+	}
+
+	device := args[0]
+
+	c, _, err := findClient(cs, device)
+	if err != nil {
+		fatalf(err, "failed to get device %q: %v", device, err)
+	}
+
+	e, err := c.Undo(device)
+	if err != nil {
+		fatalf(err, "failed to roll back device %q: %v", device, err)
+	}
+
+	fmt.Printf("%s: restored configuration from %s\n", device, e.Time.Format(time.RFC3339))
+}
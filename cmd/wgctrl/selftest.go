@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// Names and tunnel addresses of the pair of devices created by selftest.
+var (
+	selftestNames = [2]string{"wgtest0", "wgtest1"}
+	selftestAddrs = [2]net.IP{
+		net.IPv4(192, 168, 241, 1),
+		net.IPv4(192, 168, 241, 2),
+	}
+)
+
+// selftestPorts are the listen ports of the devices created by selftest. The
+// devices listen in a network namespace of their own, so these can't
+// conflict with ports in use on the system.
+var selftestPorts = [2]int{51820, 51821}
+
+// selftest creates a temporary pair of WireGuard devices configured as peers
+// of each other, checks that they complete a handshake and carry data, and
+// removes them again, printing each step as it succeeds. It is a health check
+// of the whole stack on a new host.
+func selftest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	amnezia := fs.Bool("amnezia", false, "test AmneziaWG devices with obfuscation parameters")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for data to be carried")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fatalf(errUsage, "usage: wgctrl selftest [--amnezia] [--timeout duration]")
+	}
+
+	clientType := wgtypes.NativeClient
+	if *amnezia {
+		clientType = wgtypes.AmneziaClient
+	}
+
+	cfgs, err := selftestConfigs(clientType)
+	if err != nil {
+		fatalf(err, "selftest failed: %v", err)
+	}
+
+	report := func(step string) {
+		fmt.Printf("ok  %s\n", step)
+	}
+
+	if err := runSelftest(clientType, cfgs, *timeout, report); err != nil {
+		fatalf(err, "selftest failed: %v", err)
+	}
+
+	fmt.Println("selftest passed")
+}
+
+// selftestConfigs returns the configurations of the pair of devices created
+// by selftest, which are peers of each other over the loopback interface. For
+// an AmneziaClient, both use the same obfuscation parameters.
+func selftestConfigs(clientType wgtypes.ClientType) ([2]wgtypes.Config, error) {
+	var keys [2]wgtypes.Key
+	for i := range keys {
+		k, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			return [2]wgtypes.Config{}, fmt.Errorf("failed to generate private key: %v", err)
+		}
+
+		keys[i] = k
+	}
+
+	var (
+		cfgs      [2]wgtypes.Config
+		keepalive = time.Second
+	)
+	for i := range cfgs {
+		// Each device is the peer of the other.
+		j := 1 - i
+		port := selftestPorts[i]
+
+		cfgs[i] = wgtypes.Config{
+			PrivateKey:   &keys[i],
+			ListenPort:   &port,
+			ReplacePeers: true,
+			Peers: []wgtypes.PeerConfig{{
+				PublicKey: keys[j].PublicKey(),
+				Endpoint: &net.UDPAddr{
+					IP:   net.IPv4(127, 0, 0, 1),
+					Port: selftestPorts[j],
+				},
+				PersistentKeepaliveInterval: &keepalive,
+				ReplaceAllowedIPs:           true,
+				AllowedIPs: []net.IPNet{{
+					IP:   selftestAddrs[j],
+					Mask: net.CIDRMask(32, 32),
+				}},
+			}},
+		}
+
+		if clientType == wgtypes.AmneziaClient {
+			cfgs[i].AdvancedSecurityConfig = selftestAmnezia()
+		}
+	}
+
+	return cfgs, nil
+}
+
+// selftestAmnezia returns the AmneziaWG obfuscation parameters used by
+// selftest, which are valid but differ from the defaults in every field.
+func selftestAmnezia() wgtypes.AdvancedSecurityConfig {
+	u16 := func(v uint16) *uint16 { return &v }
+	u32 := func(v uint32) *uint32 { return &v }
+
+	return wgtypes.AdvancedSecurityConfig{
+		JunkPacketCount:            u16(4),
+		JunkPacketMinSize:          u16(40),
+		JunkPacketMaxSize:          u16(70),
+		InitPacketJunkSize:         u16(15),
+		ResponsePacketJunkSize:     u16(18),
+		InitPacketMagicHeader:      u32(1293748561),
+		ResponsePacketMagicHeader:  u32(1634287351),
+		UnderloadPacketMagicHeader: u32(1869437283),
+		TransportPacketMagicHeader: u32(1970436724),
+	}
+}
+
+// checkSelftestPeer checks that the only peer of d has completed a handshake
+// and both sent and received data.
+func checkSelftestPeer(d *wgtypes.Device) error {
+	if len(d.Peers) != 1 {
+		return fmt.Errorf("device %q has %d peers, expected 1", d.Name, len(d.Peers))
+	}
+
+	p := d.Peers[0]
+	switch {
+	case p.LastHandshakeTime.IsZero():
+		return fmt.Errorf("device %q has not completed a handshake", d.Name)
+	case p.ReceiveBytes == 0 || p.TransmitBytes == 0:
+		return fmt.Errorf("device %q has received %d bytes and sent %d bytes, expected both to be non-zero",
+			d.Name, p.ReceiveBytes, p.TransmitBytes)
+	}
+
+	return nil
+}
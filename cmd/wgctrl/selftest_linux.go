@@ -0,0 +1,316 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+// runSelftest implements selftest using Linux kernel devices in temporary
+// network namespaces, which are destroyed along with anything left in them
+// when runSelftest returns.
+//
+// Both devices are created in an underlay namespace, where they keep the UDP
+// sockets which carry their traffic over its loopback interface, and are then
+// moved to a namespace each. Otherwise, traffic between their tunnel
+// addresses would be delivered locally rather than through WireGuard.
+func runSelftest(clientType wgtypes.ClientType, cfgs [2]wgtypes.Config, timeout time.Duration, report func(step string)) error {
+	errc := make(chan error, 1)
+	go func() {
+		// Namespaces are entered by the calling thread. It is never unlocked,
+		// so the runtime discards it when the goroutine exits.
+		runtime.LockOSThread()
+		errc <- selftestNetNS(clientType, cfgs, timeout, report)
+	}()
+
+	return <-errc
+}
+
+// selftestNetNS implements runSelftest on a locked thread.
+func selftestNetNS(clientType wgtypes.ClientType, cfgs [2]wgtypes.Config, timeout time.Duration, report func(step string)) error {
+	var underlay int
+	var ns [2]int
+	for _, fd := range []*int{&underlay, &ns[0], &ns[1]} {
+		var err error
+		if *fd, err = newNetNS(); err != nil {
+			return fmt.Errorf("failed to create network namespace: %w", err)
+		}
+		defer unix.Close(*fd)
+	}
+	if err := setLinkUp(underlay, "lo"); err != nil {
+		return fmt.Errorf("failed to set loopback interface up: %w", err)
+	}
+	report("create network namespaces")
+
+	c, err := wgctrl.New(clientType, wgctrl.WithNetNS(underlay))
+	if err != nil {
+		return &backendError{err: err}
+	}
+	defer c.Close()
+
+	for i, name := range selftestNames {
+		err := c.CreateDevice(name, wgtypes.LinuxKernel)
+		switch {
+		case errors.Is(err, wgctrl.ErrUnsupported):
+			// The kernel module is not loaded.
+			return &backendError{err: fmt.Errorf("failed to create device %q: %w", name, err)}
+		case err != nil:
+			return fmt.Errorf("failed to create device %q: %w", name, err)
+		}
+		if err := c.ConfigureDevice(name, cfgs[i]); err != nil {
+			return fmt.Errorf("failed to configure device %q: %w", name, err)
+		}
+	}
+	report("create and configure devices")
+
+	var cs [2]*wgctrl.Client
+	for i, name := range selftestNames {
+		if err := moveLink(underlay, name, ns[i]); err != nil {
+			return fmt.Errorf("failed to move device %q: %w", name, err)
+		}
+
+		addr := net.IPNet{IP: selftestAddrs[i], Mask: net.CIDRMask(24, 32)}
+		if err := addAddress(ns[i], name, addr); err != nil {
+			return fmt.Errorf("failed to add address to device %q: %w", name, err)
+		}
+		if err := setLinkUp(ns[i], name); err != nil {
+			return fmt.Errorf("failed to set device %q up: %w", name, err)
+		}
+
+		nc, err := wgctrl.New(clientType, wgctrl.WithNetNS(ns[i]))
+		if err != nil {
+			return &backendError{err: err}
+		}
+		defer nc.Close()
+
+		cs[i] = nc
+	}
+	report("move devices to namespaces")
+
+	if err := selftestTransfer(ns, timeout); err != nil {
+		return err
+	}
+	report("transfer data")
+
+	for i, name := range selftestNames {
+		d, err := cs[i].Device(name)
+		if err != nil {
+			return fmt.Errorf("failed to get device %q: %w", name, err)
+		}
+		if err := checkSelftestPeer(d); err != nil {
+			return err
+		}
+	}
+	report("check handshakes and counters")
+
+	for i, name := range selftestNames {
+		if err := cs[i].DeleteDevice(name); err != nil {
+			return fmt.Errorf("failed to delete device %q: %w", name, err)
+		}
+	}
+	report("delete devices")
+
+	return nil
+}
+
+// selftestTransfer sends a datagram from the first device's namespace in
+// ns to the tunnel address of the second device, and waits up to timeout for
+// it to arrive. It must be called on a locked thread, whose network
+// namespace it changes.
+func selftestTransfer(ns [2]int, timeout time.Duration) error {
+	if err := unix.Setns(ns[1], unix.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("failed to enter network namespace: %w", err)
+	}
+
+	// A socket stays in the namespace in which it is created.
+	rc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: selftestAddrs[1]})
+	if err != nil {
+		return fmt.Errorf("failed to listen on tunnel address: %w", err)
+	}
+	defer rc.Close()
+
+	if err := unix.Setns(ns[0], unix.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("failed to enter network namespace: %w", err)
+	}
+
+	sc, err := net.DialUDP("udp4", nil, rc.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		return fmt.Errorf("failed to dial tunnel address: %w", err)
+	}
+	defer sc.Close()
+
+	payload := []byte("wgctrl selftest")
+
+	errc := make(chan error, 1)
+	go func() {
+		_ = rc.SetReadDeadline(time.Now().Add(timeout))
+
+		b := make([]byte, 64)
+		n, _, err := rc.ReadFromUDP(b)
+		switch {
+		case err != nil:
+			errc <- err
+		case string(b[:n]) != string(payload):
+			errc <- fmt.Errorf("received unexpected data %q", b[:n])
+		default:
+			errc <- nil
+		}
+	}()
+
+	// Datagrams sent before the handshake completes may be dropped, so
+	// keep sending until one arrives.
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		if _, err := sc.Write(payload); err != nil {
+			return fmt.Errorf("failed to send data: %w", err)
+		}
+
+		select {
+		case err := <-errc:
+			if err != nil {
+				return fmt.Errorf("failed to receive data through the tunnel: %w", err)
+			}
+
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+// newNetNS moves the calling thread to a new network namespace, and returns a
+// file descriptor referring to it.
+func newNetNS() (int, error) {
+	if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+		return 0, os.NewSyscallError("unshare", err)
+	}
+
+	fd, err := unix.Open("/proc/thread-self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return 0, &os.PathError{Op: "open", Path: "/proc/thread-self/ns/net", Err: err}
+	}
+
+	return fd, nil
+}
+
+// setLinkUp sets the network interface specified by name in the network
+// namespace netns up, as with "ip link set name up".
+func setLinkUp(netns int, name string) error {
+	// struct ifinfomsg: family and padding, type, index, flags, and change.
+	ifi := make([]byte, unix.SizeofIfInfomsg)
+	nlenc.PutUint32(ifi[8:12], unix.IFF_UP)
+	nlenc.PutUint32(ifi[12:16], unix.IFF_UP)
+
+	return executeSelftestRTNL(netns, unix.RTM_NEWLINK, 0, ifi, []netlink.Attribute{{
+		Type: unix.IFLA_IFNAME,
+		Data: nlenc.Bytes(name),
+	}})
+}
+
+// moveLink moves the network interface specified by name from the network
+// namespace netns to the network namespace to, as with
+// "ip link set name netns to".
+func moveLink(netns int, name string, to int) error {
+	return executeSelftestRTNL(netns, unix.RTM_NEWLINK, 0, make([]byte, unix.SizeofIfInfomsg), []netlink.Attribute{
+		{Type: unix.IFLA_IFNAME, Data: nlenc.Bytes(name)},
+		{Type: unix.IFLA_NET_NS_FD, Data: nlenc.Uint32Bytes(uint32(to))},
+	})
+}
+
+// addAddress adds the IPv4 address addr to the network interface specified by
+// name in the network namespace netns, as with "ip addr add addr dev name".
+func addAddress(netns int, name string, addr net.IPNet) error {
+	index, err := linkIndex(netns, name)
+	if err != nil {
+		return err
+	}
+
+	ip := addr.IP.To4()
+	if ip == nil {
+		return errors.New("only IPv4 addresses are supported")
+	}
+	ones, _ := addr.Mask.Size()
+
+	// struct ifaddrmsg: family, prefix length, flags, scope, and index.
+	ifa := make([]byte, unix.SizeofIfAddrmsg)
+	ifa[0] = unix.AF_INET
+	ifa[1] = uint8(ones)
+	nlenc.PutUint32(ifa[4:8], index)
+
+	return executeSelftestRTNL(netns, unix.RTM_NEWADDR, netlink.Create|netlink.Excl, ifa, []netlink.Attribute{
+		{Type: unix.IFA_LOCAL, Data: ip},
+		{Type: unix.IFA_ADDRESS, Data: ip},
+	})
+}
+
+// linkIndex returns the index of the network interface specified by name in
+// the network namespace netns.
+func linkIndex(netns int, name string) (uint32, error) {
+	conn, err := netlink.Dial(unix.NETLINK_ROUTE, &netlink.Config{NetNS: netns})
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	attrs, err := netlink.MarshalAttributes([]netlink.Attribute{{
+		Type: unix.IFLA_IFNAME,
+		Data: nlenc.Bytes(name),
+	}})
+	if err != nil {
+		return 0, err
+	}
+
+	msgs, err := conn.Execute(netlink.Message{
+		Header: netlink.Header{
+			Type:  unix.RTM_GETLINK,
+			Flags: netlink.Request,
+		},
+		Data: append(make([]byte, unix.SizeofIfInfomsg), attrs...),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(msgs) != 1 || len(msgs[0].Data) < unix.SizeofIfInfomsg {
+		return 0, errors.New("unexpected rtnetlink reply")
+	}
+
+	return nlenc.Uint32(msgs[0].Data[4:8]), nil
+}
+
+// executeSelftestRTNL executes a single rtnetlink request with the specified
+// message type, additional header flags, fixed header, and attributes in the
+// network namespace netns.
+func executeSelftestRTNL(netns int, typ netlink.HeaderType, flags netlink.HeaderFlags, hdr []byte, attrs []netlink.Attribute) error {
+	conn, err := netlink.Dial(unix.NETLINK_ROUTE, &netlink.Config{NetNS: netns})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	b, err := netlink.MarshalAttributes(attrs)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Execute(netlink.Message{
+		Header: netlink.Header{
+			Type:  typ,
+			Flags: netlink.Request | netlink.Acknowledge | flags,
+		},
+		Data: append(hdr, b...),
+	})
+
+	return err
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// runSelftest implements selftest. The devices must be isolated from each
+// other so that traffic between their tunnel addresses is not delivered
+// locally, which is only implemented using Linux network namespaces.
+func runSelftest(_ wgtypes.ClientType, _ [2]wgtypes.Config, _ time.Duration, _ func(step string)) error {
+	return fmt.Errorf("selftest needs Linux network namespaces, not available on %s: %w", runtime.GOOS, wgctrl.ErrUnsupported)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+func TestSelftestConfigs(t *testing.T) {
+	for _, ct := range []wgtypes.ClientType{wgtypes.NativeClient, wgtypes.AmneziaClient} {
+		t.Run(ct.String(), func(t *testing.T) {
+			cfgs, err := selftestConfigs(ct)
+			if err != nil {
+				t.Fatalf("failed to create configurations: %v", err)
+			}
+
+			for i, cfg := range cfgs {
+				if err := cfg.Validate(); err != nil {
+					t.Fatalf("configuration %d is invalid: %v", i, err)
+				}
+
+				// Each device must be the only peer of the other.
+				other := cfgs[1-i]
+				if len(cfg.Peers) != 1 || cfg.Peers[0].PublicKey != other.PrivateKey.PublicKey() {
+					t.Fatalf("configuration %d does not have the other device as its peer", i)
+				}
+				if got := cfg.Peers[0].Endpoint.Port; got != *other.ListenPort {
+					t.Fatalf("configuration %d has endpoint port %d, expected %d", i, got, *other.ListenPort)
+				}
+
+				asc := cfg.AdvancedSecurityConfig
+				if want := ct == wgtypes.AmneziaClient; (asc.JunkPacketCount != nil) != want {
+					t.Fatalf("configuration %d has AmneziaWG parameters: %v, expected %v", i, !want, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSelftestPeer(t *testing.T) {
+	tests := []struct {
+		name string
+		p    wgtypes.Peer
+		ok   bool
+	}{
+		{
+			name: "no handshake",
+		},
+		{
+			name: "no data received",
+			p:    wgtypes.Peer{LastHandshakeTime: time.Unix(1, 0), TransmitBytes: 92},
+		},
+		{
+			name: "ok",
+			p: wgtypes.Peer{
+				LastHandshakeTime: time.Unix(1, 0),
+				ReceiveBytes:      92,
+				TransmitBytes:     92,
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSelftestPeer(&wgtypes.Device{Name: "wgtest0", Peers: []wgtypes.Peer{tt.p}})
+			if ok := err == nil; ok != tt.ok {
+				t.Fatalf("unexpected result: %v", err)
+			}
+		})
+	}
+}
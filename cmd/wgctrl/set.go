@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// set configures a single device from the arguments of wg(8) set, such as
+// "wg0 listen-port 51820 peer <key> allowed-ips 10.0.0.2/32", exercising
+// Client.ConfigureDevice directly.
+func set(cs []*wgctrl.Client, args []string) {
+	if len(args) < 1 {
+		fatalf(errUsage, "usage: wgctrl set <device> [options]")
+	}
+
+	device := args[0]
+
+	var cfg wgtypes.Config
+	if err := parseSet(args[1:], &cfg); err != nil {
+		fatalf(errUsage, "invalid set options: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		fatalf(err, "invalid configuration for device %q: %v", device, err)
+	}
+
+	c, _, err := findClient(cs, device)
+	if err != nil {
+		fatalf(err, "failed to get device %q: %v", device, err)
+	}
+
+	if err := c.ConfigureDevice(device, cfg); err != nil {
+		fatalf(err, "failed to configure device %q: %v", device, err)
+	}
+}
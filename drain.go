@@ -0,0 +1,103 @@
+package wgctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// ErrDrainTimeout is returned by DrainPeer when a peer's traffic did not
+// quiesce before the timeout, and the peer was removed while still active.
+var ErrDrainTimeout = errors.New("wgctrl: peer traffic did not quiesce before timeout")
+
+// drainInterval is how often DrainPeer checks the traffic counters of a peer.
+// A peer is quiescent once its counters are unchanged over one interval.
+var drainInterval = 2 * time.Second
+
+// DrainPeer gracefully removes the peer with public key from the device
+// specified by name, for example when decommissioning a relay node.
+//
+// The peer is first switched to a drain configuration: its persistent
+// keepalive is disabled so that only real traffic moves its counters, while
+// its allowed IPs are kept so that established flows continue. Once the
+// peer's transfer counters stop changing, or timeout elapses, the peer is
+// removed. If the peer was removed because of the timeout, ErrDrainTimeout is
+// returned. Routes which direct new traffic to the peer should be withdrawn
+// before it is drained.
+//
+// If the device or peer does not exist, an error which matches
+// ErrDeviceNotFound or ErrPeerNotFound, and os.ErrNotExist, is returned.
+func (c *Client) DrainPeer(name string, key wgtypes.Key, timeout time.Duration) error {
+	counters := func() (wgtypes.Peer, error) {
+		d, err := c.device(context.Background(), name)
+		if err != nil {
+			return wgtypes.Peer{}, err
+		}
+
+		for _, p := range d.Peers {
+			if p.PublicKey == key {
+				return p, nil
+			}
+		}
+
+		return wgtypes.Peer{}, fmt.Errorf("wgctrl: peer %s on device %q: %w", key, name, ErrPeerNotFound)
+	}
+
+	prev, err := counters()
+	if err != nil {
+		return err
+	}
+
+	var keepalive time.Duration
+	err = c.ConfigureDevice(name, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:                   key,
+			UpdateOnly:                  true,
+			PersistentKeepaliveInterval: &keepalive,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		deadline = time.Now().Add(timeout)
+		quiet    bool
+	)
+
+	for !quiet && time.Now().Before(deadline) {
+		wait := drainInterval
+		if left := time.Until(deadline); left < wait {
+			wait = left
+		}
+		time.Sleep(wait)
+
+		cur, err := counters()
+		if err != nil {
+			return err
+		}
+
+		quiet = cur.ReceiveBytes == prev.ReceiveBytes &&
+			cur.TransmitBytes == prev.TransmitBytes
+		prev = cur
+	}
+
+	err = c.ConfigureDevice(name, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey: key,
+			Remove:    true,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if !quiet {
+		return ErrDrainTimeout
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package wgctrl
+
+import (
+	"errors"
+	"os"
+)
+
+// Sentinel errors returned by Client methods, which can be checked using
+// errors.Is regardless of the WireGuard implementation in use. Each also
+// matches the corresponding os error, such as os.ErrNotExist for
+// ErrDeviceNotFound, so that existing checks continue to work.
+var (
+	// ErrDeviceNotFound indicates that a device does not exist or is not a
+	// WireGuard device.
+	ErrDeviceNotFound error = &sentinelError{msg: "wgctrl: device not found", os: os.ErrNotExist}
+
+	// ErrDeviceExists indicates that a device or network interface already
+	// exists.
+	ErrDeviceExists error = &sentinelError{msg: "wgctrl: device already exists", os: os.ErrExist}
+
+	// ErrPeerNotFound indicates that a peer is not configured on a device.
+	ErrPeerNotFound error = &sentinelError{msg: "wgctrl: peer not found", os: os.ErrNotExist}
+
+	// ErrPeerExists indicates that a peer is already configured on a device.
+	ErrPeerExists error = &sentinelError{msg: "wgctrl: peer already exists", os: os.ErrExist}
+
+	// ErrPermissionDenied indicates that the caller lacks the privileges
+	// required by a WireGuard implementation, such as CAP_NET_ADMIN on Linux.
+	ErrPermissionDenied error = &sentinelError{msg: "wgctrl: permission denied", os: os.ErrPermission}
+)
+
+// ErrBackendUnavailable indicates that a WireGuard implementation is not
+// available. It is matched by every BackendError and NoBackendsError.
+var ErrBackendUnavailable = errors.New("wgctrl: WireGuard implementation unavailable")
+
+// A sentinelError is a sentinel error which also matches an os error.
+type sentinelError struct {
+	msg string
+	os  error
+}
+
+func (e *sentinelError) Error() string        { return e.msg }
+func (e *sentinelError) Is(target error) bool { return target == e.os }
+
+// A classifiedError is an error from a WireGuard implementation which also
+// matches a sentinel error. Its message is that of the underlying error.
+type classifiedError struct {
+	sentinel error
+	err      error
+}
+
+func (e *classifiedError) Error() string        { return e.err.Error() }
+func (e *classifiedError) Unwrap() error        { return e.err }
+func (e *classifiedError) Is(target error) bool { return target == e.sentinel }
+
+// classify wraps an error concerning a device returned by a WireGuard
+// implementation so that it matches the sentinel error for its cause. Errors
+// which already match a sentinel error, or have no corresponding sentinel
+// error, are returned unchanged.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	for _, s := range []error{ErrDeviceNotFound, ErrDeviceExists, ErrPeerNotFound, ErrPeerExists, ErrPermissionDenied} {
+		if errors.Is(err, s) {
+			return err
+		}
+	}
+
+	var sentinel error
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		sentinel = ErrDeviceNotFound
+	case errors.Is(err, os.ErrExist):
+		sentinel = ErrDeviceExists
+	case errors.Is(err, os.ErrPermission):
+		sentinel = ErrPermissionDenied
+	default:
+		return err
+	}
+
+	return &classifiedError{sentinel: sentinel, err: err}
+}
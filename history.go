@@ -0,0 +1,251 @@
+package wgctrl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgstore"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// DefaultHistoryNamespace is the wgstore namespace used by a History with no
+// Namespace set.
+const DefaultHistoryNamespace = "wgctrl.history"
+
+// defaultHistoryLimit is the default value for History.Limit.
+const defaultHistoryLimit = 10
+
+// ErrNoHistory is returned by Client.Undo when no previous configuration of a
+// device has been recorded, or when WithHistory is not in use.
+var ErrNoHistory = errors.New("wgctrl: no configuration history")
+
+// A HistoryEntry is a configuration of a device recorded by a History before
+// the device was changed.
+type HistoryEntry struct {
+	// Time is the time at which the configuration was recorded.
+	Time time.Time
+
+	// Device is the device as it was configured. Statistics such as
+	// transfer counters and handshake times are not recorded.
+	Device *wgtypes.Device
+}
+
+// A History records the configuration of each device before it is changed
+// by a Client, so that changes can be reverted using Client.Undo. Use
+// WithHistory to record changes made by a Client.
+//
+// Entries are kept in a wgstore.Store so that they can survive restarts, and
+// include each device's private key, so the Store should be protected
+// accordingly. Consecutive changes which leave a device's configuration as
+// it was are recorded once.
+//
+// A History is safe for concurrent use, but a Store should not be shared by
+// multiple Histories using the same Namespace.
+type History struct {
+	// Store is the underlying key/value store.
+	Store wgstore.Store
+
+	// Namespace is the namespace of the stored entries. If empty,
+	// DefaultHistoryNamespace is used.
+	Namespace string
+
+	// Limit is the maximum number of entries kept for each device. If zero,
+	// a default of 10 is used.
+	Limit int
+
+	mu sync.Mutex
+
+	// now may be replaced in tests.
+	now func() time.Time
+}
+
+// WithHistory records the configuration of each device in h before it is
+// changed by ConfigureDevice or any method which calls it, so that the change
+// can be reverted using Undo. Changes which are rejected before they are
+// applied are not recorded. If the configuration can't be recorded, the
+// change is not applied.
+func WithHistory(h *History) Option {
+	return func(o *options) {
+		o.history = h
+	}
+}
+
+// A historyEntry is the stored form of a HistoryEntry.
+type historyEntry struct {
+	Time   time.Time       `json:"time"`
+	Device *wgtypes.Device `json:"device"`
+}
+
+// Entries returns the recorded configurations of the device specified by
+// name, most recent first.
+func (h *History) Entries(name string) ([]HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	es, err := h.load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]HistoryEntry, 0, len(es))
+	for _, e := range es {
+		out = append(out, HistoryEntry(e))
+	}
+
+	return out, nil
+}
+
+// record adds the configuration of d to the history of the device specified
+// by name, unless it matches the most recent entry.
+func (h *History) record(name string, d *wgtypes.Device) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	es, err := h.load(name)
+	if err != nil {
+		return err
+	}
+
+	if len(es) > 0 && isZeroConfig(wgtypes.Reconcile(es[0].Device, wgtypes.DeviceConfig(d))) {
+		return nil
+	}
+
+	es = append([]historyEntry{{Time: h.timeNow(), Device: historyDevice(d)}}, es...)
+	if limit := h.limit(); len(es) > limit {
+		es = es[:limit]
+	}
+
+	return h.save(name, es)
+}
+
+// undo calls fn with the most recent entry for the device specified by name,
+// and removes the entry if fn succeeds.
+func (h *History) undo(name string, fn func(e HistoryEntry) error) (HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	es, err := h.load(name)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	if len(es) == 0 {
+		return HistoryEntry{}, ErrNoHistory
+	}
+
+	e := HistoryEntry(es[0])
+	if err := fn(e); err != nil {
+		return HistoryEntry{}, err
+	}
+
+	return e, h.save(name, es[1:])
+}
+
+// load returns the stored entries for the device specified by name.
+func (h *History) load(name string) ([]historyEntry, error) {
+	b, err := h.Store.Get(h.namespace(), name)
+	switch {
+	case errors.Is(err, wgstore.ErrNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var es []historyEntry
+	if err := json.Unmarshal(b, &es); err != nil {
+		return nil, fmt.Errorf("wgctrl: invalid history for device %q: %w", name, err)
+	}
+
+	return es, nil
+}
+
+// save replaces the stored entries for the device specified by name.
+func (h *History) save(name string, es []historyEntry) error {
+	if len(es) == 0 {
+		return h.Store.Delete(h.namespace(), name)
+	}
+
+	b, err := json.Marshal(es)
+	if err != nil {
+		return err
+	}
+
+	return h.Store.Put(h.namespace(), name, b)
+}
+
+func (h *History) namespace() string {
+	if h.Namespace != "" {
+		return h.Namespace
+	}
+
+	return DefaultHistoryNamespace
+}
+
+func (h *History) limit() int {
+	if h.Limit > 0 {
+		return h.Limit
+	}
+
+	return defaultHistoryLimit
+}
+
+// timeNow returns the current time from h.now, or time.Now.
+func (h *History) timeNow() time.Time {
+	if h.now != nil {
+		return h.now()
+	}
+
+	return time.Now()
+}
+
+// Undo reverts the most recent change to the device specified by name which
+// was recorded by the History set using WithHistory, and returns the entry
+// which was restored. Peers added since the entry was recorded are removed,
+// and the device's other settings and peers are restored as with
+// SyncDeviceConfig. The entry is removed from the History, so that calling
+// Undo again reverts the change before it.
+//
+// If no change has been recorded, or WithHistory is not in use, Undo returns
+// ErrNoHistory. Undo is not itself recorded.
+func (c *Client) Undo(name string) (HistoryEntry, error) {
+	if c.history == nil {
+		return HistoryEntry{}, ErrNoHistory
+	}
+
+	return c.history.undo(name, func(e HistoryEntry) error {
+		ctx := context.Background()
+
+		d, err := c.device(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		cfg := wgtypes.Reconcile(d, wgtypes.DeviceConfig(e.Device))
+		if isZeroConfig(cfg) {
+			return nil
+		}
+
+		return c.configure(ctx, name, cfg, false)
+	})
+}
+
+// historyDevice returns a copy of d without its statistics.
+func historyDevice(d *wgtypes.Device) *wgtypes.Device {
+	out := *d
+	out.Peers = make([]wgtypes.Peer, 0, len(d.Peers))
+	for _, p := range d.Peers {
+		out.Peers = append(out.Peers, wgtypes.Peer{
+			PublicKey:                   p.PublicKey,
+			PresharedKey:                p.PresharedKey,
+			Endpoint:                    p.Endpoint,
+			PersistentKeepaliveInterval: p.PersistentKeepaliveInterval,
+			AllowedIPs:                  p.AllowedIPs,
+			ProtocolVersion:             p.ProtocolVersion,
+		})
+	}
+
+	return &out
+}
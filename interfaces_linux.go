@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package wgctrl
+
+import "github.com/danpashin/wgctrl/internal/wglinux"
+
+// LinkKindInterfaces returns a function for use with WithInterfaces which
+// uses rtnetlink to list the interfaces whose link kind is one of kinds, such
+// as "wireguard" or "amneziawg".
+//
+// On platforms other than Linux, the returned function always returns an
+// error.
+func LinkKindInterfaces(kinds ...string) func() ([]string, error) {
+	return func() ([]string, error) {
+		return wglinux.KindInterfaces(kinds...)
+	}
+}
@@ -27,7 +27,10 @@ import (
 // ifGroupWG is the WireGuard interface group name passed to the kernel.
 var ifGroupWG = [16]byte{0: 'w', 1: 'g'}
 
-var _ wginternal.Client = &Client{}
+var (
+	_ wginternal.Client = &Client{}
+	_ wginternal.Typer  = &Client{}
+)
 
 // A Client provides access to FreeBSD WireGuard ioctl information.
 type Client struct {
@@ -60,6 +63,9 @@ func New() (*Client, bool, error) {
 	}, true, nil
 }
 
+// DeviceType implements wginternal.Typer.
+func (c *Client) DeviceType() wgtypes.DeviceType { return wgtypes.FreeBSDKernel }
+
 // Close implements wginternal.Client.
 func (c *Client) Close() error {
 	return c.close()
@@ -160,6 +166,7 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 	}
 
 	dev.Name = name
+	dev.Index = wginternal.InterfaceIndex(name)
 
 	return dev, nil
 }
@@ -469,7 +476,7 @@ func unparsePeerConfig(cfg wgtypes.PeerConfig) nv.List {
 	}
 
 	if v := cfg.PersistentKeepaliveInterval; v != nil {
-		m["persistent-keepalive-interval"] = uint64(v.Seconds())
+		m["persistent-keepalive-interval"] = uint64(*v / time.Second)
 	}
 
 	if v := cfg.Endpoint; v != nil {
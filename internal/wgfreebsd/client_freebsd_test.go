@@ -0,0 +1,69 @@
+//go:build freebsd
+// +build freebsd
+
+package wgfreebsd
+
+import (
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/danpashin/wgctrl/internal/wgfreebsd/internal/nv"
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKeepaliveRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		keepalive *time.Duration
+		want      time.Duration
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:      "disabled",
+			keepalive: durPtr(0),
+		},
+		{
+			name:      "seconds",
+			keepalive: durPtr(25 * time.Second),
+			want:      25 * time.Second,
+		},
+		{
+			name:      "maximum",
+			keepalive: durPtr(65535 * time.Second),
+			want:      65535 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, sz, err := nv.Marshal(unparseConfig(wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:                   wgtest.MustPublicKey(),
+					PersistentKeepaliveInterval: tt.keepalive,
+				}},
+			}))
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			d, err := parseDevice(unsafe.Slice(buf, sz))
+			if err != nil {
+				t.Fatalf("failed to parse device: %v", err)
+			}
+			if len(d.Peers) != 1 {
+				t.Fatalf("expected 1 peer, but got %d", len(d.Peers))
+			}
+
+			if diff := cmp.Diff(tt.want, d.Peers[0].PersistentKeepaliveInterval); diff != "" {
+				t.Fatalf("unexpected keepalive interval (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func durPtr(d time.Duration) *time.Duration { return &d }
@@ -1,8 +1,10 @@
 package wginternal
 
 import (
+	"context"
 	"errors"
 	"io"
+	"net"
 
 	"github.com/danpashin/wgctrl/wgtypes"
 )
@@ -31,3 +33,96 @@ type Client interface {
 	Device(name string) (*wgtypes.Device, error)
 	ConfigureDevice(name string, cfg wgtypes.Config) error
 }
+
+// A ContextClient is a Client whose operations can be canceled or time out
+// using a context.Context.
+type ContextClient interface {
+	Client
+	DevicesContext(ctx context.Context) ([]*wgtypes.Device, error)
+	DeviceContext(ctx context.Context, name string) (*wgtypes.Device, error)
+	ConfigureDeviceContext(ctx context.Context, name string, cfg wgtypes.Config) error
+}
+
+// DevicesContext calls c.DevicesContext if c is a ContextClient. Otherwise,
+// it checks ctx and calls c.Devices, which can't be interrupted.
+func DevicesContext(ctx context.Context, c Client) ([]*wgtypes.Device, error) {
+	if cc, ok := c.(ContextClient); ok {
+		return cc.DevicesContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.Devices()
+}
+
+// DeviceContext calls c.DeviceContext if c is a ContextClient. Otherwise, it
+// checks ctx and calls c.Device, which can't be interrupted.
+func DeviceContext(ctx context.Context, c Client, name string) (*wgtypes.Device, error) {
+	if cc, ok := c.(ContextClient); ok {
+		return cc.DeviceContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.Device(name)
+}
+
+// ConfigureDeviceContext calls c.ConfigureDeviceContext if c is a
+// ContextClient. Otherwise, it checks ctx and calls c.ConfigureDevice, which
+// can't be interrupted.
+func ConfigureDeviceContext(ctx context.Context, c Client, name string, cfg wgtypes.Config) error {
+	if cc, ok := c.(ContextClient); ok {
+		return cc.ConfigureDeviceContext(ctx, name, cfg)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return c.ConfigureDevice(name, cfg)
+}
+
+// A Typer is a Client which reports the type of devices it manages.
+type Typer interface {
+	// DeviceType returns the type of devices managed by the Client.
+	DeviceType() wgtypes.DeviceType
+}
+
+// A Prober is a Client which can report whether its WireGuard implementation
+// is available on this system, for implementations whose availability may
+// change after the Client is created.
+type Prober interface {
+	Typer
+
+	// Probe returns an error describing why the implementation is
+	// unavailable, or nil if it is available.
+	Probe() error
+}
+
+// A DeviceManager is a Client which can create and delete devices of the
+// type it manages.
+type DeviceManager interface {
+	Typer
+
+	// CreateDevice creates a device named name. If a device or network
+	// interface with that name already exists, an error which matches
+	// os.ErrExist is returned.
+	CreateDevice(name string) error
+
+	// DeleteDevice deletes the device specified by name. If no such device
+	// exists, an error which matches os.ErrNotExist is returned.
+	DeleteDevice(name string) error
+}
+
+// InterfaceIndex returns the index of the network interface specified by name,
+// or 0 if it cannot be determined, for implementations which do not report an
+// index themselves.
+func InterfaceIndex(name string) int {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return 0
+	}
+
+	return ifi.Index
+}
@@ -0,0 +1,140 @@
+//go:build linux
+// +build linux
+
+package wglinux
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+)
+
+func BenchmarkLinuxParseDevice(b *testing.B) {
+	for _, n := range wgtest.BenchPeers {
+		for _, lazy := range []bool{false, true} {
+			lazy := lazy
+			b.Run(fmt.Sprintf("peers-%d/lazy-%t", n, lazy), func(b *testing.B) {
+				msgs := benchDeviceMessages(b, n)
+
+				// Sanity check the fixture before timing.
+				d, err := parseDevice(msgs, lazy)
+				if err != nil {
+					b.Fatalf("failed to parse device: %v", err)
+				}
+				if len(d.Peers) != n {
+					b.Fatalf("expected %d peers, but got %d", n, len(d.Peers))
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					if _, err := parseDevice(msgs, lazy); err != nil {
+						b.Fatalf("failed to parse device: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkLinuxConfigAttrs(b *testing.B) {
+	// A single message can only hold a limited number of peers, so larger
+	// configurations are covered by BenchmarkLinuxClientConfigureDevice.
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("peers-%d", n), func(b *testing.B) {
+			cfg := wgtest.BenchConfig(n)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				ae := newAttrEncoder()
+				if _, err := configAttrs(ae, okName, cfg); err != nil {
+					b.Fatalf("failed to encode config: %v", err)
+				}
+				ae.release()
+			}
+		})
+	}
+}
+
+func BenchmarkLinuxClientDevice(b *testing.B) {
+	for _, n := range wgtest.BenchPeers {
+		b.Run(fmt.Sprintf("peers-%d", n), func(b *testing.B) {
+			res := benchDeviceMessages(b, n)
+			c := testClient(b, func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+				return res, nil
+			})
+			defer c.Close()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Device(okName); err != nil {
+					b.Fatalf("failed to get device: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLinuxClientConfigureDevice(b *testing.B) {
+	for _, n := range wgtest.BenchPeers {
+		b.Run(fmt.Sprintf("peers-%d", n), func(b *testing.B) {
+			c := testClient(b, func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+				return nil, nil
+			})
+			defer c.Close()
+
+			cfg := wgtest.BenchConfig(n)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := c.ConfigureDevice(okName, cfg); err != nil {
+					b.Fatalf("failed to configure device: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// benchDevicePeersPerMessage is the number of peers placed in each message
+// by benchDeviceMessages, as the kernel splits large devices across several
+// messages.
+const benchDevicePeersPerMessage = 100
+
+// benchDeviceMessages returns the messages the kernel would send for a device
+// with n peers. The configuration attribute format is a subset of the device
+// attribute format, so it is reused here.
+func benchDeviceMessages(tb testing.TB, n int) []genetlink.Message {
+	cfg := wgtest.BenchConfig(n)
+	peers := cfg.Peers
+
+	var msgs []genetlink.Message
+	for len(msgs) == 0 || len(peers) > 0 {
+		chunk := peers
+		if len(chunk) > benchDevicePeersPerMessage {
+			chunk = chunk[:benchDevicePeersPerMessage]
+		}
+		peers = peers[len(chunk):]
+
+		cfg.Peers = chunk
+		ae := newAttrEncoder()
+		b, err := configAttrs(ae, okName, cfg)
+		if err != nil {
+			tb.Fatalf("failed to encode device: %v", err)
+		}
+
+		msgs = append(msgs, genetlink.Message{Data: append([]byte(nil), b...)})
+		ae.release()
+	}
+
+	return msgs
+}
@@ -4,10 +4,13 @@
 package wglinux
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/danpashin/wgctrl/internal/wginternal"
 	"github.com/danpashin/wgctrl/wgtypes"
@@ -21,7 +24,10 @@ const (
 	AnmeziaWgGenlName = "amneziawg"
 )
 
-var _ wginternal.Client = &Client{}
+var (
+	_ wginternal.ContextClient = &Client{}
+	_ wginternal.Typer         = &Client{}
+)
 
 // A Client provides access to Linux WireGuard netlink information.
 type Client struct {
@@ -29,14 +35,49 @@ type Client struct {
 	family     genetlink.Family
 	clientType wgtypes.ClientType
 
+	// mu serializes requests, as the deadlines used to interrupt them apply
+	// to the whole connection. It also guards pending, the number of
+	// interrupted requests whose replies have yet to be read.
+	mu      sync.Mutex
+	pending int
+
 	interfaces func(clientType wgtypes.ClientType) ([]string, error)
+	rtnl       func() (*netlink.Conn, error)
+
+	// netns is the file descriptor of the network namespace used by
+	// NewNetNS, or 0 for the current network namespace.
+	netns int
+
+	// lazyAllowedIPs defers decoding the allowed IPs of peers; see
+	// SetLazyAllowedIPs.
+	lazyAllowedIPs bool
 }
 
 // New creates a new Client and returns whether or not the generic netlink
-// interface is available.
-func New(clientType wgtypes.ClientType) (*Client, bool, error) {
-	c, err := genetlink.Dial(nil)
+// interface is available. The generic netlink families are tried in order,
+// and the first which is registered is used. If no families are specified,
+// the default family for clientType is used.
+func New(clientType wgtypes.ClientType, families ...string) (*Client, bool, error) {
+	return NewNetNS(clientType, 0, families...)
+}
+
+// NewNetNS is like New, but the Client operates in the network namespace
+// referred to by the file descriptor netns, such as an open handle of
+// /proc/<pid>/ns/net, rather than in that of the calling thread. If netns is
+// 0, the current network namespace is used. netns is duplicated, so that the
+// caller may close it once NewNetNS returns.
+func NewNetNS(clientType wgtypes.ClientType, netns int, families ...string) (*Client, bool, error) {
+	if netns != 0 {
+		fd, err := unix.FcntlInt(uintptr(netns), unix.F_DUPFD_CLOEXEC, 0)
+		if err != nil {
+			return nil, false, fmt.Errorf("wglinux: failed to duplicate network namespace file descriptor: %w", err)
+		}
+		netns = fd
+	}
+
+	c, err := genetlink.Dial(&netlink.Config{NetNS: netns})
 	if err != nil {
+		closeNetNS(netns)
 		return nil, false, err
 	}
 
@@ -48,54 +89,99 @@ func New(clientType wgtypes.ClientType) (*Client, bool, error) {
 		_ = c.SetOption(o, true)
 	}
 
-	return initClient(c, clientType)
-}
+	wc, ok, err := initClient(c, clientType, families)
+	if err != nil || !ok {
+		closeNetNS(netns)
+		return nil, ok, err
+	}
 
-// initClient is the internal Client constructor used in some tests.
-func initClient(c *genetlink.Conn, clientType wgtypes.ClientType) (*Client, bool, error) {
+	if netns != 0 {
+		// rtnetlink connections must be opened in the same namespace.
+		wc.netns = netns
+		wc.rtnl = func() (*netlink.Conn, error) {
+			return netlink.Dial(unix.NETLINK_ROUTE, &netlink.Config{NetNS: netns})
+		}
+	}
 
-	var netlinkFamily string
-	switch clientType {
-	case wgtypes.AmneziaClient:
-		netlinkFamily = AnmeziaWgGenlName
-	default:
-		netlinkFamily = unix.WG_GENL_NAME
+	return wc, true, nil
+}
+
+// closeNetNS closes a network namespace file descriptor duplicated by
+// NewNetNS, if any.
+func closeNetNS(netns int) {
+	if netns != 0 {
+		_ = unix.Close(netns)
 	}
+}
 
-	f, err := c.GetFamily(netlinkFamily)
-	if err != nil {
-		_ = c.Close()
+// initClient is the internal Client constructor used in some tests.
+func initClient(c *genetlink.Conn, clientType wgtypes.ClientType, families []string) (*Client, bool, error) {
+	if len(families) == 0 {
+		families = familiesFor(clientType)
+	}
 
-		if errors.Is(err, os.ErrNotExist) {
-			// The generic netlink interface is not available.
-			return nil, false, nil
+	var (
+		f     genetlink.Family
+		found bool
+	)
+
+	for _, name := range families {
+		var err error
+		f, err = c.GetFamily(name)
+		if err == nil {
+			found = true
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			_ = c.Close()
+			return nil, false, err
 		}
+	}
 
-		return nil, false, err
+	if !found {
+		// The generic netlink interface is not available.
+		_ = c.Close()
+		return nil, false, nil
 	}
 
-	return &Client{
+	wc := &Client{
 		c:          c,
 		family:     f,
 		clientType: clientType,
+		rtnl:       dialRTNL,
+	}
 
-		// By default, gather only WireGuard interfaces using rtnetlink.
-		interfaces: rtnlInterfaces,
-	}, true, nil
+	// By default, gather only WireGuard interfaces using rtnetlink.
+	wc.interfaces = wc.rtnlInterfaces
+
+	return wc, true, nil
 }
 
+// DeviceType implements wginternal.Typer.
+func (c *Client) DeviceType() wgtypes.DeviceType { return wgtypes.LinuxKernel }
+
 // Close implements wginternal.Client.
 func (c *Client) Close() error {
-	return c.c.Close()
+	err := c.c.Close()
+	closeNetNS(c.netns)
+	return err
+}
+
+// Conn returns the generic netlink connection and WireGuard family used by
+// c. The connection is shared with c and must not be closed by the caller.
+func (c *Client) Conn() (*genetlink.Conn, genetlink.Family) {
+	return c.c, c.family
 }
 
 // Devices implements wginternal.Client.
 func (c *Client) Devices() ([]*wgtypes.Device, error) {
+	return c.DevicesContext(context.Background())
+}
+
+// DevicesContext implements wginternal.ContextClient.
+func (c *Client) DevicesContext(ctx context.Context) ([]*wgtypes.Device, error) {
 	// By default, rtnetlink is used to fetch a list of all interfaces and then
 	// filter that list to only find WireGuard interfaces.
-	//
-	// The remainder of this function assumes that any returned device from this
-	// function is a valid WireGuard device.
 	ifis, err := c.interfaces(c.clientType)
 	if err != nil {
 		return nil, err
@@ -103,8 +189,14 @@ func (c *Client) Devices() ([]*wgtypes.Device, error) {
 
 	ds := make([]*wgtypes.Device, 0, len(ifis))
 	for _, ifi := range ifis {
-		d, err := c.Device(ifi)
+		d, err := c.DeviceContext(ctx, ifi)
 		if err != nil {
+			// The interface was removed after it was listed, or the list was
+			// supplied by the caller and contains other interfaces.
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
 			return nil, err
 		}
 
@@ -116,6 +208,11 @@ func (c *Client) Devices() ([]*wgtypes.Device, error) {
 
 // Device implements wginternal.Client.
 func (c *Client) Device(name string) (*wgtypes.Device, error) {
+	return c.DeviceContext(context.Background(), name)
+}
+
+// DeviceContext implements wginternal.ContextClient.
+func (c *Client) DeviceContext(ctx context.Context, name string) (*wgtypes.Device, error) {
 	// Don't bother querying netlink with empty input.
 	if name == "" {
 		return nil, os.ErrNotExist
@@ -131,27 +228,30 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 		return nil, err
 	}
 
-	msgs, err := c.execute(unix.WG_CMD_GET_DEVICE, netlink.Request|netlink.Dump, b)
+	msgs, err := c.execute(ctx, unix.WG_CMD_GET_DEVICE, netlink.Request|netlink.Dump, b)
 	if err != nil {
 		return nil, err
 	}
 
-	return parseDevice(msgs)
+	return parseDevice(msgs, c.lazyAllowedIPs)
 }
 
 // ConfigureDevice implements wginternal.Client.
 func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
-	// Large configurations are split into batches for use with netlink.
-	for _, b := range buildBatches(cfg) {
-		attrs, err := configAttrs(name, b)
-		if err != nil {
-			return err
-		}
+	return c.ConfigureDeviceContext(context.Background(), name, cfg)
+}
+
+// ConfigureDeviceContext implements wginternal.ContextClient.
+func (c *Client) ConfigureDeviceContext(ctx context.Context, name string, cfg wgtypes.Config) error {
+	// Large configurations are split into batches which each fit in a
+	// single netlink message.
+	batches, err := buildBatches(name, cfg)
+	if err != nil {
+		return err
+	}
 
-		// Request acknowledgement of our request from netlink, even though the
-		// output messages are unused.  The netlink package checks and trims the
-		// status code value.
-		if _, err := c.execute(unix.WG_CMD_SET_DEVICE, netlink.Request|netlink.Acknowledge, attrs); err != nil {
+	for _, b := range batches {
+		if err := c.configureBatch(ctx, name, b); err != nil {
 			return err
 		}
 	}
@@ -159,9 +259,37 @@ func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
 	return nil
 }
 
+// configureBatch applies a single batch of a configuration to the device
+// specified by name.
+func (c *Client) configureBatch(ctx context.Context, name string, cfg wgtypes.Config) error {
+	ae := newAttrEncoder()
+
+	attrs, err := configAttrs(ae, name, cfg)
+	if err != nil {
+		ae.release()
+		return err
+	}
+
+	// Request acknowledgement of our request from netlink, even though the
+	// output messages are unused.  The netlink package checks and trims the
+	// status code value.
+	_, err = c.execute(ctx, unix.WG_CMD_SET_DEVICE, netlink.Request|netlink.Acknowledge, attrs)
+	ae.release()
+
+	return err
+}
+
 // execute executes a single WireGuard netlink request with the specified command,
 // header flags, and attribute arguments.
-func (c *Client) execute(command uint8, flags netlink.HeaderFlags, attrb []byte) ([]genetlink.Message, error) {
+//
+// The request is bounded by the deadline of ctx, and is interrupted if ctx is
+// done before it completes. Deadlines apply to the whole netlink connection, so
+// requests are executed one at a time.
+func (c *Client) execute(ctx context.Context, command uint8, flags netlink.HeaderFlags, attrb []byte) ([]genetlink.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	msg := genetlink.Message{
 		Header: genetlink.Header{
 			Command: command,
@@ -170,7 +298,25 @@ func (c *Client) execute(command uint8, flags netlink.HeaderFlags, attrb []byte)
 		Data: attrb,
 	}
 
-	msgs, err := c.c.Execute(msg, c.family.ID, flags)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ctx.Done() != nil {
+		stop, err := c.interruptOnDone(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer stop()
+	}
+
+	msgs, err := c.roundTrip(msg, flags)
+	if ctx.Done() != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		// The request was interrupted because ctx is done, or is about to be
+		// done as its deadline has passed.
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
 	if err == nil {
 		return msgs, nil
 	}
@@ -194,26 +340,165 @@ func (c *Client) execute(command uint8, flags netlink.HeaderFlags, attrb []byte)
 	}
 }
 
-// rtnlInterfaces uses rtnetlink to fetch a list of WireGuard interfaces.
-func rtnlInterfaces(clientType wgtypes.ClientType) ([]string, error) {
-	// Use the stdlib's rtnetlink helpers to get ahold of a table of all
-	// interfaces, so we can begin filtering it down to just WireGuard devices.
-	tab, err := syscall.NetlinkRIB(unix.RTM_GETLINK, unix.AF_UNSPEC)
+// roundTrip sends a request and receives its reply, as genetlink.Conn.Execute
+// does. The kernel replies to a request even if it was interrupted, so the
+// replies to earlier interrupted requests are read and discarded first, lest
+// they be mistaken for the reply to this one. c.mu must be held.
+func (c *Client) roundTrip(msg genetlink.Message, flags netlink.HeaderFlags) ([]genetlink.Message, error) {
+	for c.pending > 0 {
+		// The kernel replies to requests in order, and each reply is either
+		// received in full or reported as a single error.
+		if _, _, err := c.c.Receive(); errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, err
+		}
+		c.pending--
+	}
+
+	req, err := c.c.Send(msg, c.family.ID, flags)
 	if err != nil {
-		return nil, fmt.Errorf("wglinux: failed to get list of interfaces from rtnetlink: %v", err)
+		return nil, err
+	}
+
+	msgs, nmsgs, err := c.c.Receive()
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// The reply, or what remains of it, is still to come.
+			c.pending++
+		}
+
+		return nil, err
 	}
 
-	msgs, err := syscall.ParseNetlinkMessage(tab)
+	if err := netlink.Validate(req, nmsgs); err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
+// interruptOnDone sets the deadline of the netlink connection to that of ctx,
+// and moves it into the past when ctx is done, interrupting the request in
+// progress. The returned function stops watching ctx and clears the deadline,
+// and must be called once the request completes.
+func (c *Client) interruptOnDone(ctx context.Context) (func(), error) {
+	deadline, _ := ctx.Deadline()
+	if err := c.c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	stopC, doneC := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(doneC)
+
+		select {
+		case <-ctx.Done():
+			// Any time in the past interrupts the request immediately.
+			_ = c.c.SetDeadline(time.Unix(1, 0))
+		case <-stopC:
+		}
+	}()
+
+	return func() {
+		// Wait for the watcher to exit, so that it can't interrupt a later
+		// request, before clearing the deadline.
+		close(stopC)
+		<-doneC
+		_ = c.c.SetDeadline(time.Time{})
+	}, nil
+}
+
+// SetInterfaces replaces the function used by Devices to list candidate
+// WireGuard interfaces. Interfaces which are not WireGuard devices are
+// skipped.
+func (c *Client) SetInterfaces(fn func() ([]string, error)) {
+	c.interfaces = func(_ wgtypes.ClientType) ([]string, error) {
+		return fn()
+	}
+}
+
+// SetLazyAllowedIPs sets whether the allowed IPs of the peers of devices are
+// kept undecoded in their LazyAllowedIPs field, and only decoded when needed.
+func (c *Client) SetLazyAllowedIPs(lazy bool) {
+	c.lazyAllowedIPs = lazy
+}
+
+// rtnlInterfaces uses rtnetlink to fetch a list of WireGuard interfaces.
+func (c *Client) rtnlInterfaces(clientType wgtypes.ClientType) ([]string, error) {
+	return kindInterfaces(c.rtnl, kindsFor(clientType))
+}
+
+// KindInterfaces uses rtnetlink to fetch a list of interfaces whose link kind
+// (IFLA_INFO_KIND) is one of kinds.
+func KindInterfaces(kinds ...string) ([]string, error) {
+	return kindInterfaces(dialRTNL, kinds)
+}
+
+// kindInterfaces dumps the links of each of kinds using an rtnetlink
+// connection from dial.
+//
+// The kernel filters each dump by link kind, so that systems with many
+// interfaces don't return every link. Kernels which don't support filtering
+// return every link, so the links are filtered again here.
+func kindInterfaces(dial func() (*netlink.Conn, error), kinds []string) ([]string, error) {
+	conn, err := dial()
 	if err != nil {
-		return nil, fmt.Errorf("wglinux: failed to parse rtnetlink messages: %v", err)
+		return nil, fmt.Errorf("wglinux: failed to dial rtnetlink: %v", err)
 	}
+	defer conn.Close()
+
+	var ifis []string
+	for _, kind := range kinds {
+		ae := netlink.NewAttributeEncoder()
+		ae.Nested(unix.IFLA_LINKINFO, func(nae *netlink.AttributeEncoder) error {
+			nae.String(unix.IFLA_INFO_KIND, kind)
+			return nil
+		})
+
+		attrs, err := ae.Encode()
+		if err != nil {
+			return nil, err
+		}
+
+		msgs, err := conn.Execute(netlink.Message{
+			Header: netlink.Header{
+				Type:  unix.RTM_GETLINK,
+				Flags: netlink.Request | netlink.Dump,
+			},
+			Data: append(make([]byte, unix.SizeofIfInfomsg), attrs...),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("wglinux: failed to get list of interfaces from rtnetlink: %v", err)
+		}
+
+		// Reuse the parser for messages from the stdlib's rtnetlink helpers.
+		smsgs := make([]syscall.NetlinkMessage, 0, len(msgs))
+		for _, m := range msgs {
+			smsgs = append(smsgs, syscall.NetlinkMessage{
+				Header: syscall.NlMsghdr{
+					Len:   m.Header.Length,
+					Type:  uint16(m.Header.Type),
+					Flags: uint16(m.Header.Flags),
+					Seq:   m.Header.Sequence,
+					Pid:   m.Header.PID,
+				},
+				Data: m.Data,
+			})
+		}
 
-	return parseRTNLInterfaces(msgs, clientType)
+		names, err := parseRTNLInterfaces(smsgs, []string{kind})
+		if err != nil {
+			return nil, err
+		}
+
+		ifis = append(ifis, names...)
+	}
+
+	return ifis, nil
 }
 
-// parseRTNLInterfaces unpacks rtnetlink messages and returns WireGuard
-// interface names.
-func parseRTNLInterfaces(msgs []syscall.NetlinkMessage, clientType wgtypes.ClientType) ([]string, error) {
+// parseRTNLInterfaces unpacks rtnetlink messages and returns the names of
+// interfaces with one of the specified link kinds.
+func parseRTNLInterfaces(msgs []syscall.NetlinkMessage, kinds []string) ([]string, error) {
 	var ifis []string
 	for _, m := range msgs {
 		// Only deal with link messages, and they must have an ifinfomsg
@@ -242,7 +527,7 @@ func parseRTNLInterfaces(msgs []syscall.NetlinkMessage, clientType wgtypes.Clien
 			case unix.IFLA_IFNAME:
 				ifi = ad.String()
 			case unix.IFLA_LINKINFO:
-				ad.Do(isWGKind(&isWG, clientType))
+				ad.Do(isWGKind(&isWG, kinds))
 			}
 		}
 
@@ -259,22 +544,34 @@ func parseRTNLInterfaces(msgs []syscall.NetlinkMessage, clientType wgtypes.Clien
 	return ifis, nil
 }
 
+// familiesFor returns the default generic netlink family names for
+// clientType.
+func familiesFor(clientType wgtypes.ClientType) []string {
+	switch clientType {
+	case wgtypes.AmneziaClient:
+		return []string{AnmeziaWgGenlName}
+	default:
+		return []string{unix.WG_GENL_NAME}
+	}
+}
+
 // wgKind is the IFLA_INFO_KIND value for WireGuard devices.
 const wgKind = "wireguard"
 const amneziaWgKind = "amneziawg"
 
-// isWGKind parses netlink attributes to determine if a link is a WireGuard
-// device, then populates ok with the result.
-func isWGKind(ok *bool, clientType wgtypes.ClientType) func(b []byte) error {
-
-	var kind string
+// kindsFor returns the IFLA_INFO_KIND values of devices for clientType.
+func kindsFor(clientType wgtypes.ClientType) []string {
 	switch clientType {
 	case wgtypes.AmneziaClient:
-		kind = amneziaWgKind
+		return []string{amneziaWgKind}
 	default:
-		kind = wgKind
+		return []string{wgKind}
 	}
+}
 
+// isWGKind parses netlink attributes to determine if a link is one of the
+// specified kinds, then populates ok with the result.
+func isWGKind(ok *bool, kinds []string) func(b []byte) error {
 	return func(b []byte) error {
 		ad, err := netlink.NewAttributeDecoder(b)
 		if err != nil {
@@ -286,10 +583,12 @@ func isWGKind(ok *bool, clientType wgtypes.ClientType) func(b []byte) error {
 				continue
 			}
 
-			adStr := ad.String()
-			if adStr == kind {
-				*ok = true
-				return nil
+			kind := ad.String()
+			for _, k := range kinds {
+				if kind == k {
+					*ok = true
+					return nil
+				}
 			}
 		}
 
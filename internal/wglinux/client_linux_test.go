@@ -4,11 +4,13 @@
 package wglinux
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/user"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
@@ -62,6 +64,79 @@ func TestLinuxClientDevicesEmpty(t *testing.T) {
 	}
 }
 
+func TestLinuxClientContext(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		err  error
+	}{
+		{
+			name: "deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			err: context.DeadlineExceeded,
+		},
+		{
+			name: "canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			err: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sock := newHangSocket()
+			c := &Client{
+				c: genetlink.NewConn(netlink.NewConn(sock, nltest.PID)),
+				family: genetlink.Family{
+					ID:      familyID,
+					Version: unix.WG_GENL_VERSION,
+					Name:    unix.WG_GENL_NAME,
+				},
+			}
+			defer c.Close()
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			if _, err := c.DeviceContext(ctx, okName); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, but got: %v", tt.err, err)
+			}
+
+			// The request must have been interrupted rather than left in
+			// progress, and must not affect later requests.
+			if n := sock.receiving(); n != 0 {
+				t.Fatalf("expected no requests in progress, but got %d", n)
+			}
+			if d := sock.getDeadline(); !d.IsZero() {
+				t.Fatalf("expected the deadline to be cleared, but got %v", d)
+			}
+
+			// A done context prevents any further requests.
+			if err := c.ConfigureDeviceContext(ctx, okName, wgtypes.Config{}); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, but got: %v", tt.err, err)
+			}
+
+			// The kernel replies to the interrupted request late, and that
+			// reply must not be mistaken for the reply to the next one.
+			sock.release()
+
+			d, err := c.DeviceContext(context.Background(), okName)
+			if err != nil {
+				t.Fatalf("failed to get device after interrupted request: %v", err)
+			}
+			if d.Name != okName {
+				t.Fatalf("expected device %q, but got %q", okName, d.Name)
+			}
+		})
+	}
+}
+
 func TestLinuxClientIsNotExist(t *testing.T) {
 	// TODO(mdlayher): not ideal but this test is not particularly load-bearing
 	// and the entire *nltest ecosystem needs to be reworked.
@@ -158,7 +233,7 @@ func Test_initClientNotExist(t *testing.T) {
 		return nil, genltest.Error(int(unix.ENOENT))
 	})
 
-	_, ok, err := initClient(conn, wgtypes.NativeClient)
+	_, ok, err := initClient(conn, wgtypes.NativeClient, nil)
 	if err != nil {
 		t.Fatalf("failed to open Client: %v", err)
 	}
@@ -167,6 +242,84 @@ func Test_initClientNotExist(t *testing.T) {
 	}
 }
 
+func TestNewNetNSBadFD(t *testing.T) {
+	if _, _, err := NewNetNS(wgtypes.NativeClient, -1); !errors.Is(err, unix.EBADF) {
+		t.Fatalf("expected bad file descriptor, but got: %v", err)
+	}
+}
+
+func Test_initClientFamilies(t *testing.T) {
+	const custom = "amneziawg-test"
+
+	tests := []struct {
+		name     string
+		families []string
+		ok       bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:     "custom",
+			families: []string{custom},
+			ok:       true,
+		},
+		{
+			name:     "fallback",
+			families: []string{AnmeziaWgGenlName, custom},
+			ok:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			family := genetlink.Family{
+				ID:      familyID,
+				Version: unix.WG_GENL_VERSION,
+				Name:    custom,
+			}
+
+			serve := genltest.ServeFamily(family, func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+				return nil, nil
+			})
+
+			conn := genltest.Dial(func(greq genetlink.Message, nreq netlink.Message) ([]genetlink.Message, error) {
+				// Families other than the custom one are not registered.
+				if nreq.Header.Type == unix.GENL_ID_CTRL {
+					attrs, err := netlink.UnmarshalAttributes(greq.Data)
+					if err != nil {
+						return nil, err
+					}
+
+					for _, a := range attrs {
+						if a.Type == unix.CTRL_ATTR_FAMILY_NAME && nlenc.String(a.Data) != custom {
+							return nil, genltest.Error(int(unix.ENOENT))
+						}
+					}
+				}
+
+				return serve(greq, nreq)
+			})
+
+			c, ok, err := initClient(conn, wgtypes.AmneziaClient, tt.families)
+			if err != nil {
+				t.Fatalf("failed to open Client: %v", err)
+			}
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected availability (-want +got):\n%s", diff)
+			}
+			if !ok {
+				return
+			}
+			defer c.Close()
+
+			if diff := cmp.Diff(custom, c.family.Name); diff != "" {
+				t.Fatalf("unexpected family (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func Test_parseRTNLInterfaces(t *testing.T) {
 	// marshalAttrs creates packed netlink attributes with a prepended ifinfomsg
 	// structure, as returned by rtnetlink.
@@ -177,10 +330,11 @@ func Test_parseRTNLInterfaces(t *testing.T) {
 	}
 
 	tests := []struct {
-		name string
-		msgs []syscall.NetlinkMessage
-		ifis []string
-		ok   bool
+		name  string
+		kinds []string
+		msgs  []syscall.NetlinkMessage
+		ifis  []string
+		ok    bool
 	}{
 		{
 			name: "short ifinfomsg",
@@ -256,11 +410,60 @@ func Test_parseRTNLInterfaces(t *testing.T) {
 			ifis: []string{okName},
 			ok:   true,
 		},
+		{
+			name:  "ok, multiple kinds",
+			kinds: []string{wgKind, amneziaWgKind},
+			msgs: []syscall.NetlinkMessage{
+				{
+					Header: syscall.NlMsghdr{
+						Type: unix.RTM_NEWLINK,
+					},
+					Data: marshalAttrs([]netlink.Attribute{
+						{
+							Type: unix.IFLA_IFNAME,
+							Data: nlenc.Bytes(okName),
+						},
+						{
+							Type: unix.IFLA_LINKINFO,
+							Data: m(netlink.Attribute{
+								Type: unix.IFLA_INFO_KIND,
+								Data: nlenc.Bytes(wgKind),
+							}),
+						},
+					}),
+				},
+				{
+					Header: syscall.NlMsghdr{
+						Type: unix.RTM_NEWLINK,
+					},
+					Data: marshalAttrs([]netlink.Attribute{
+						{
+							Type: unix.IFLA_IFNAME,
+							Data: nlenc.Bytes("awg0"),
+						},
+						{
+							Type: unix.IFLA_LINKINFO,
+							Data: m(netlink.Attribute{
+								Type: unix.IFLA_INFO_KIND,
+								Data: nlenc.Bytes(amneziaWgKind),
+							}),
+						},
+					}),
+				},
+			},
+			ifis: []string{okName, "awg0"},
+			ok:   true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ifis, err := parseRTNLInterfaces(tt.msgs, wgtypes.NativeClient)
+			kinds := tt.kinds
+			if kinds == nil {
+				kinds = kindsFor(wgtypes.NativeClient)
+			}
+
+			ifis, err := parseRTNLInterfaces(tt.msgs, kinds)
 
 			if tt.ok && err != nil {
 				t.Fatalf("failed to parse interfaces: %v", err)
@@ -281,7 +484,222 @@ func Test_parseRTNLInterfaces(t *testing.T) {
 
 const familyID = 20
 
-func testClient(t *testing.T, fn genltest.Func) *Client {
+func Test_kindInterfaces(t *testing.T) {
+	// link creates an RTM_NEWLINK message for an interface with a link kind.
+	link := func(req netlink.Message, name, kind string) netlink.Message {
+		return netlink.Message{
+			Header: netlink.Header{
+				Type:     unix.RTM_NEWLINK,
+				Sequence: req.Header.Sequence,
+				PID:      req.Header.PID,
+			},
+			Data: append(make([]byte, unix.SizeofIfInfomsg), nltest.MustMarshalAttributes([]netlink.Attribute{
+				{Type: unix.IFLA_IFNAME, Data: nlenc.Bytes(name)},
+				{
+					Type: unix.IFLA_LINKINFO,
+					Data: m(netlink.Attribute{
+						Type: unix.IFLA_INFO_KIND,
+						Data: nlenc.Bytes(kind),
+					}),
+				},
+			})...),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter bool
+	}{
+		{
+			name:   "filtered by kernel",
+			filter: true,
+		},
+		{
+			name: "unfiltered",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var kinds []string
+			fn := func(reqs []netlink.Message) ([]netlink.Message, error) {
+				req := reqs[0]
+				if diff := cmp.Diff(netlink.Request|netlink.Dump, req.Header.Flags); diff != "" {
+					t.Fatalf("unexpected flags (-want +got):\n%s", diff)
+				}
+
+				_, kind := parseLinkRequest(t, req)
+				kinds = append(kinds, kind)
+
+				links := []netlink.Message{
+					link(req, "br0", "bridge"),
+					link(req, okName, wgKind),
+					link(req, "awg0", amneziaWgKind),
+				}
+
+				var msgs []netlink.Message
+				for _, l := range links {
+					_, k := parseLinkRequest(t, l)
+					if !tt.filter || k == kind {
+						msgs = append(msgs, l)
+					}
+				}
+
+				return nltest.Multipart(append(msgs, netlink.Message{
+					Header: netlink.Header{
+						Type:     netlink.Done,
+						Sequence: req.Header.Sequence,
+						PID:      req.Header.PID,
+					},
+				}))
+			}
+
+			dial := func() (*netlink.Conn, error) { return nltest.Dial(fn), nil }
+
+			ifis, err := kindInterfaces(dial, []string{wgKind, amneziaWgKind})
+			if err != nil {
+				t.Fatalf("failed to get interfaces: %v", err)
+			}
+
+			if diff := cmp.Diff([]string{okName, "awg0"}, ifis); diff != "" {
+				t.Fatalf("unexpected interfaces (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]string{wgKind, amneziaWgKind}, kinds); diff != "" {
+				t.Fatalf("unexpected requested kinds (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// A hangSocket is a netlink.Socket which holds the replies to requests until
+// released, but which stops waiting for one when its deadline passes, as with
+// a real netlink socket. Each request is answered with device okName.
+type hangSocket struct {
+	mu       sync.Mutex
+	deadline time.Time
+	changed  chan struct{}
+	n        int
+	held     bool
+	replies  []netlink.Message
+}
+
+func newHangSocket() *hangSocket {
+	return &hangSocket{changed: make(chan struct{}), held: true}
+}
+
+func (s *hangSocket) Close() error                           { return nil }
+func (s *hangSocket) SendMessages(_ []netlink.Message) error { return nil }
+
+func (s *hangSocket) Send(m netlink.Message) error {
+	attrs, err := netlink.MarshalAttributes([]netlink.Attribute{{
+		Type: unix.WGDEVICE_A_IFNAME,
+		Data: nlenc.Bytes(okName),
+	}})
+	if err != nil {
+		return err
+	}
+
+	b, err := (&genetlink.Message{Data: attrs}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.replies = append(s.replies, netlink.Message{
+		Header: netlink.Header{
+			Type:     m.Header.Type,
+			Sequence: m.Header.Sequence,
+			PID:      m.Header.PID,
+		},
+		Data: b,
+	})
+	s.notify()
+	return nil
+}
+
+func (s *hangSocket) Receive() ([]netlink.Message, error) {
+	s.mu.Lock()
+	s.n++
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.n--
+		s.mu.Unlock()
+	}()
+
+	for {
+		s.mu.Lock()
+		if !s.held && len(s.replies) > 0 {
+			m := s.replies[0]
+			s.replies = s.replies[1:]
+			s.mu.Unlock()
+			return []netlink.Message{m}, nil
+		}
+		deadline, changed := s.deadline, s.changed
+		s.mu.Unlock()
+
+		if deadline.IsZero() {
+			<-changed
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-timer.C:
+			return nil, os.ErrDeadlineExceeded
+		case <-changed:
+			timer.Stop()
+		}
+	}
+}
+
+func (s *hangSocket) SetDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deadline = t
+	s.notify()
+	return nil
+}
+
+func (s *hangSocket) SetReadDeadline(t time.Time) error  { return s.SetDeadline(t) }
+func (s *hangSocket) SetWriteDeadline(_ time.Time) error { return nil }
+
+// release delivers the replies held so far, and any later ones immediately.
+func (s *hangSocket) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.held = false
+	s.notify()
+}
+
+// notify wakes calls to Receive in progress. s.mu must be held.
+func (s *hangSocket) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// receiving returns the number of calls to Receive in progress.
+func (s *hangSocket) receiving() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.n
+}
+
+// getDeadline returns the current deadline of the socket.
+func (s *hangSocket) getDeadline() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deadline
+}
+
+func testClient(t testing.TB, fn genltest.Func) *Client {
 	family := genetlink.Family{
 		ID:      familyID,
 		Version: unix.WG_GENL_VERSION,
@@ -290,7 +708,7 @@ func testClient(t *testing.T, fn genltest.Func) *Client {
 
 	conn := genltest.Dial(genltest.ServeFamily(family, fn))
 
-	c, ok, err := initClient(conn, wgtypes.NativeClient)
+	c, ok, err := initClient(conn, wgtypes.NativeClient, nil)
 	if err != nil {
 		t.Fatalf("failed to open Client: %v", err)
 	}
@@ -326,8 +744,10 @@ func diffAttrs(x, y []netlink.Attribute) string {
 }
 
 func mustAllowedIPs(ipns []net.IPNet) []byte {
-	ae := netlink.NewAttributeEncoder()
-	if err := encodeAllowedIPs(ipns)(ae); err != nil {
+	ae := newAttrEncoder()
+	defer ae.release()
+
+	if err := encodeAllowedIPs(ae, ipns); err != nil {
 		panicf("failed to create allowed IP attributes: %v", err)
 	}
 
@@ -336,7 +756,7 @@ func mustAllowedIPs(ipns []net.IPNet) []byte {
 		panicf("failed to encode allowed IP attributes: %v", err)
 	}
 
-	return b
+	return append([]byte(nil), b...)
 }
 
 func m(attrs ...netlink.Attribute) []byte { return nltest.MustMarshalAttributes(attrs) }
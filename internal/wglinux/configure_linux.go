@@ -7,19 +7,19 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"time"
 	"unsafe"
 
 	"github.com/danpashin/wgctrl/internal/wginternal"
 	"github.com/danpashin/wgctrl/wgtypes"
-	"github.com/mdlayher/netlink"
 	"github.com/mdlayher/netlink/nlenc"
 	"golang.org/x/sys/unix"
 )
 
-// configAttrs creates the required encoded netlink attributes to configure
-// the device specified by name using the non-nil fields in cfg.
-func configAttrs(name string, cfg wgtypes.Config) ([]byte, error) {
-	ae := netlink.NewAttributeEncoder()
+// configAttrs uses ae to create the required encoded netlink attributes to
+// configure the device specified by name using the non-nil fields in cfg. The
+// returned bytes are only valid until ae is released.
+func configAttrs(ae *attrEncoder, name string, cfg wgtypes.Config) ([]byte, error) {
 	ae.String(unix.WGDEVICE_A_IFNAME, name)
 
 	if cfg.PrivateKey != nil {
@@ -40,10 +40,12 @@ func configAttrs(name string, cfg wgtypes.Config) ([]byte, error) {
 
 	// Only apply peer attributes if necessary.
 	if len(cfg.Peers) > 0 {
-		ae.Nested(unix.WGDEVICE_A_PEERS, func(nae *netlink.AttributeEncoder) error {
+		ae.Nested(unix.WGDEVICE_A_PEERS, func(nae *attrEncoder) error {
 			// Netlink arrays use type as an array index.
-			for i, p := range cfg.Peers {
-				nae.Nested(uint16(i), encodePeer(p))
+			for i := range cfg.Peers {
+				nae.Nested(uint16(i), func(nae *attrEncoder) error {
+					return encodePeer(nae, cfg.Peers[i])
+				})
 			}
 
 			return nil
@@ -51,6 +53,12 @@ func configAttrs(name string, cfg wgtypes.Config) ([]byte, error) {
 	}
 
 	advancedSecCfg := cfg.AdvancedSecurityConfig
+	if hasAmneziaV15(advancedSecCfg) {
+		// The kernel module has no attributes for these parameters, so
+		// refuse them rather than silently leaving them unset.
+		return nil, wgtypes.ErrAdvancedSecurityNotSupported
+	}
+
 	if advancedSecCfg.JunkPacketCount != nil {
 		ae.Uint16(wginternal.WGDEVICE_A_JC, *advancedSecCfg.JunkPacketCount)
 	}
@@ -90,228 +98,315 @@ func configAttrs(name string, cfg wgtypes.Config) ([]byte, error) {
 	return ae.Encode()
 }
 
-// ipBatchChunk is a tunable allowed IP batch limit per peer.
+// hasAmneziaV15 reports whether cfg sets any of the parameters added in
+// AmneziaWG 1.5.
+func hasAmneziaV15(cfg wgtypes.AdvancedSecurityConfig) bool {
+	return cfg.UnderloadPacketJunkSize != nil ||
+		cfg.TransportPacketJunkSize != nil ||
+		cfg.SpecialJunkPacket1 != nil ||
+		cfg.SpecialJunkPacket2 != nil ||
+		cfg.SpecialJunkPacket3 != nil ||
+		cfg.SpecialJunkPacket4 != nil ||
+		cfg.SpecialJunkPacket5 != nil ||
+		cfg.SpecialJunkInterval != nil
+}
+
+// maxBatchSize is the maximum size of the attributes of a single
+// WG_CMD_SET_DEVICE request. Like wg(8), configurations are split into
+// messages of at most 8 KiB, which the kernel always accepts, rather than
+// risking EMSGSIZE for large configurations.
+const maxBatchSize = 8192 - unix.NLMSG_HDRLEN - unix.GENL_HDRLEN
+
+// buildBatches splits cfg into configurations which each fit in a single
+// request to configure the device specified by name, if needed.
 //
-// Because we don't necessarily know how much space a given peer will occupy,
-// we play it safe and use a reasonably small value.  Note that this constant
-// is used both in this package and tests, so be aware when making changes.
-const ipBatchChunk = 256
+// As with wg(8), each batch holds as many peers and allowed IPs as fit. The
+// first batch holds the device-level fields of cfg, and later batches only
+// add peers and allowed IPs. A peer whose allowed IPs do not fit in one batch
+// is continued in the next with only its public key and flags, so that the
+// allowed IPs are appended to those added by the previous batch.
+func buildBatches(name string, cfg wgtypes.Config) ([]wgtypes.Config, error) {
+	// Use the device-level fields of cfg for the first batch only, so that
+	// later batches don't replace the peers added by earlier ones.
+	base := cfg
+	base.Peers = nil
 
-// peerBatchChunk specifies the number of peers that can appear in a
-// configuration before we start splitting it into chunks.
-const peerBatchChunk = 32
+	size, err := configSize(name, base)
+	if err != nil {
+		return nil, err
+	}
 
-// shouldBatch determines if a configuration is sufficiently complex that it
-// should be split into batches.
-func shouldBatch(cfg wgtypes.Config) bool {
-	if len(cfg.Peers) > peerBatchChunk {
-		return true
+	// Is this a small configuration; no need to batch?
+	total := size
+	if len(cfg.Peers) > 0 {
+		total += nlaHeaderLen
+		for _, p := range cfg.Peers {
+			total += peerSize(p)
+		}
+	}
+	if total <= maxBatchSize {
+		return []wgtypes.Config{cfg}, nil
 	}
 
-	var ips int
-	for _, p := range cfg.Peers {
-		ips += len(p.AllowedIPs)
+	next, err := configSize(name, wgtypes.Config{})
+	if err != nil {
+		return nil, err
 	}
 
-	return ips > ipBatchChunk
-}
+	var (
+		batches = []wgtypes.Config{base}
 
-// buildBatches produces a batch of configs from a single config, if needed.
-func buildBatches(cfg wgtypes.Config) []wgtypes.Config {
-	// Is this a small configuration; no need to batch?
-	if !shouldBatch(cfg) {
-		return []wgtypes.Config{cfg}
+		// free is the space left in the last batch for peers.
+		free = maxBatchSize - size - nlaHeaderLen
+	)
+
+	newBatch := func() {
+		batches = append(batches, wgtypes.Config{})
+		free = maxBatchSize - next - nlaHeaderLen
 	}
 
-	// Use most fields of cfg for our "base" configuration, and only differ
-	// peers in each batch.
-	base := cfg
-	base.Peers = nil
+	for _, p := range cfg.Peers {
+		pcfg := p
+		ips := p.AllowedIPs
+
+		for {
+			pcfg.AllowedIPs = nil
+			n := peerSize(pcfg)
+			if len(ips) > 0 {
+				n += nlaHeaderLen
+			}
 
-	// Track the known peers so that peer IPs are not replaced if a single
-	// peer has its allowed IPs split into multiple batches.
-	knownPeers := make(map[wgtypes.Key]struct{})
+			// Add as many of the remaining allowed IPs as fit.
+			var fit int
+			for fit < len(ips) && n+allowedIPSize(ips[fit]) <= free {
+				n += allowedIPSize(ips[fit])
+				fit++
+			}
 
-	batches := make([]wgtypes.Config, 0)
-	for _, p := range cfg.Peers {
-		batch := base
-
-		// Iterate until no more allowed IPs.
-		var done bool
-		for !done {
-			var tmp []net.IPNet
-			if len(p.AllowedIPs) < ipBatchChunk {
-				// IPs all fit within a batch; we are done.
-				tmp = make([]net.IPNet, len(p.AllowedIPs))
-				copy(tmp, p.AllowedIPs)
-				done = true
-			} else {
-				// IPs are larger than a single batch, copy a batch out and
-				// advance the cursor.
-				tmp = make([]net.IPNet, ipBatchChunk)
-				copy(tmp, p.AllowedIPs[:ipBatchChunk])
-
-				p.AllowedIPs = p.AllowedIPs[ipBatchChunk:]
-
-				if len(p.AllowedIPs) == 0 {
-					// IPs ended on a batch boundary; no more IPs left so end
-					// iteration after this loop.
-					done = true
-				}
+			b := &batches[len(batches)-1]
+			if (n > free || fit == 0 && len(ips) > 0) && len(b.Peers) > 0 {
+				// None of the peer fits; try again with an empty batch.
+				newBatch()
+				continue
+			}
+
+			if fit == 0 && len(ips) > 0 {
+				// Always make progress, though an empty batch has room for
+				// far more than one allowed IP.
+				n += allowedIPSize(ips[0])
+				fit = 1
+			}
+
+			pcfg.AllowedIPs = ips[:fit:fit]
+			b.Peers = append(b.Peers, pcfg)
+			free -= n
+
+			ips = ips[fit:]
+			if len(ips) == 0 {
+				break
 			}
 
-			pcfg := wgtypes.PeerConfig{
-				// PublicKey denotes the peer and must be present.
+			// Continue the peer in the next batch, only passing the flags
+			// which must apply to every batch. In particular, the other
+			// fields must not be passed again or the allowed IPs added by
+			// this batch would be replaced.
+			pcfg = wgtypes.PeerConfig{
 				PublicKey: p.PublicKey,
 
-				// Apply the update only flag to every chunk to ensure
-				// consistency between batches when the kernel module processes
-				// them.
+				// Skip every batch if the peer does not exist, rather than
+				// creating it with only some of its allowed IPs.
 				UpdateOnly: p.UpdateOnly,
 
 				// It'd be a bit weird to have a remove peer message with many
 				// IPs, but just in case, add this to every peer's message.
 				Remove: p.Remove,
-
-				// The IPs for this chunk.
-				AllowedIPs: tmp,
 			}
 
-			// Only pass certain fields on the first occurrence of a peer, so
-			// that subsequent IPs won't be wiped out and space isn't wasted.
-			if _, ok := knownPeers[p.PublicKey]; !ok {
-				knownPeers[p.PublicKey] = struct{}{}
+			newBatch()
+		}
+	}
 
-				pcfg.PresharedKey = p.PresharedKey
-				pcfg.Endpoint = p.Endpoint
-				pcfg.PersistentKeepaliveInterval = p.PersistentKeepaliveInterval
+	return batches, nil
+}
 
-				// Important: do not move or appending peers won't work.
-				pcfg.ReplaceAllowedIPs = p.ReplaceAllowedIPs
-			}
+// configSize returns the size of the attributes which configure the device
+// specified by name using the device-level fields of cfg.
+func configSize(name string, cfg wgtypes.Config) (int, error) {
+	cfg.Peers = nil
 
-			// Add a peer configuration to this batch and keep going.
-			batch.Peers = []wgtypes.PeerConfig{pcfg}
-			batches = append(batches, batch)
-		}
-	}
+	ae := newAttrEncoder()
+	defer ae.release()
 
-	// Do not allow peer replacement beyond the first message in a batch,
-	// so we don't overwrite our previous batch work.
-	for i := range batches {
-		if i > 0 {
-			batches[i].ReplacePeers = false
-		}
+	b, err := configAttrs(ae, name, cfg)
+	if err != nil {
+		return 0, err
 	}
 
-	return batches
+	return len(b), nil
 }
 
-// encodePeer returns a function to encode PeerConfig nested attributes.
-func encodePeer(p wgtypes.PeerConfig) func(ae *netlink.AttributeEncoder) error {
-	return func(ae *netlink.AttributeEncoder) error {
-		ae.Bytes(unix.WGPEER_A_PUBLIC_KEY, p.PublicKey[:])
+// peerSize returns the size of the nested attribute which encodePeer produces
+// for p.
+func peerSize(p wgtypes.PeerConfig) int {
+	n := nlaHeaderLen + attrSize(wgtypes.KeyLen)
 
-		// Flags are stored in a single attribute.
-		var flags uint32
-		if p.Remove {
-			flags |= unix.WGPEER_F_REMOVE_ME
-		}
-		if p.ReplaceAllowedIPs {
-			flags |= unix.WGPEER_F_REPLACE_ALLOWEDIPS
-		}
-		if p.UpdateOnly {
-			flags |= unix.WGPEER_F_UPDATE_ONLY
-		}
-		if flags != 0 {
-			ae.Uint32(unix.WGPEER_A_FLAGS, flags)
-		}
+	if p.Remove || p.ReplaceAllowedIPs || p.UpdateOnly {
+		n += attrSize(4)
+	}
 
-		if p.PresharedKey != nil {
-			ae.Bytes(unix.WGPEER_A_PRESHARED_KEY, (*p.PresharedKey)[:])
-		}
+	if p.PresharedKey != nil {
+		n += attrSize(wgtypes.KeyLen)
+	}
 
-		if p.Endpoint != nil {
-			ae.Do(unix.WGPEER_A_ENDPOINT, encodeSockaddr(*p.Endpoint))
+	if p.Endpoint != nil {
+		if isIPv6(p.Endpoint.IP) {
+			n += attrSize(unix.SizeofSockaddrInet6)
+		} else {
+			n += attrSize(unix.SizeofSockaddrInet4)
 		}
+	}
 
-		if p.PersistentKeepaliveInterval != nil {
-			ae.Uint16(unix.WGPEER_A_PERSISTENT_KEEPALIVE_INTERVAL, uint16(p.PersistentKeepaliveInterval.Seconds()))
-		}
+	if p.PersistentKeepaliveInterval != nil {
+		n += attrSize(2)
+	}
 
-		// Only apply allowed IPs if necessary.
-		if len(p.AllowedIPs) > 0 {
-			ae.Nested(unix.WGPEER_A_ALLOWEDIPS, encodeAllowedIPs(p.AllowedIPs))
+	if len(p.AllowedIPs) > 0 {
+		n += nlaHeaderLen
+		for _, ipn := range p.AllowedIPs {
+			n += allowedIPSize(ipn)
 		}
+	}
 
-		return nil
+	return n
+}
+
+// allowedIPSize returns the size of the nested attribute which
+// encodeAllowedIPs produces for ipn.
+func allowedIPSize(ipn net.IPNet) int {
+	// Invalid allowed IPs are reported by encodeAllowedIPs.
+	addr := net.IPv6len
+	if pfx, err := wgtypes.AllowedIPPrefix(ipn); err == nil && pfx.Addr().Is4() {
+		addr = net.IPv4len
 	}
+
+	return nlaHeaderLen + attrSize(2) + attrSize(addr) + attrSize(1)
 }
 
-// encodeSockaddr returns a function which encodes a net.UDPAddr as raw
-// sockaddr_in or sockaddr_in6 bytes.
-func encodeSockaddr(endpoint net.UDPAddr) func() ([]byte, error) {
-	return func() ([]byte, error) {
-		if !isValidIP(endpoint.IP) {
-			return nil, fmt.Errorf("wglinux: invalid endpoint IP: %s", endpoint.IP.String())
-		}
+// attrSize returns the size of an attribute with n bytes of data, including
+// its header and padding.
+func attrSize(n int) int {
+	return nlaAlign(nlaHeaderLen + n)
+}
 
-		// Is this an IPv6 address?
-		if isIPv6(endpoint.IP) {
-			var addr [16]byte
-			copy(addr[:], endpoint.IP.To16())
+// encodePeer encodes the nested attributes of PeerConfig p.
+func encodePeer(ae *attrEncoder, p wgtypes.PeerConfig) error {
+	ae.Bytes(unix.WGPEER_A_PUBLIC_KEY, p.PublicKey[:])
 
-			sa := unix.RawSockaddrInet6{
-				Family: unix.AF_INET6,
-				Port:   sockaddrPort(endpoint.Port),
-				Addr:   addr,
-			}
+	// Flags are stored in a single attribute.
+	var flags uint32
+	if p.Remove {
+		flags |= unix.WGPEER_F_REMOVE_ME
+	}
+	if p.ReplaceAllowedIPs {
+		flags |= unix.WGPEER_F_REPLACE_ALLOWEDIPS
+	}
+	if p.UpdateOnly {
+		flags |= unix.WGPEER_F_UPDATE_ONLY
+	}
+	if flags != 0 {
+		ae.Uint32(unix.WGPEER_A_FLAGS, flags)
+	}
+
+	if p.PresharedKey != nil {
+		ae.Bytes(unix.WGPEER_A_PRESHARED_KEY, (*p.PresharedKey)[:])
+	}
 
-			return (*(*[unix.SizeofSockaddrInet6]byte)(unsafe.Pointer(&sa)))[:], nil
+	if p.Endpoint != nil {
+		if err := encodeSockaddr(ae, unix.WGPEER_A_ENDPOINT, *p.Endpoint); err != nil {
+			return err
 		}
+	}
+
+	if p.PersistentKeepaliveInterval != nil {
+		// The interval is specified in seconds; see
+		// wgtypes.PeerConfig.Validate.
+		ae.Uint16(unix.WGPEER_A_PERSISTENT_KEEPALIVE_INTERVAL, uint16(*p.PersistentKeepaliveInterval/time.Second))
+	}
+
+	// Only apply allowed IPs if necessary.
+	if len(p.AllowedIPs) > 0 {
+		ae.Nested(unix.WGPEER_A_ALLOWEDIPS, func(nae *attrEncoder) error {
+			return encodeAllowedIPs(nae, p.AllowedIPs)
+		})
+	}
+
+	return nil
+}
+
+// encodeSockaddr encodes a net.UDPAddr as a raw sockaddr_in or sockaddr_in6
+// attribute of type typ.
+func encodeSockaddr(ae *attrEncoder, typ uint16, endpoint net.UDPAddr) error {
+	if !isValidIP(endpoint.IP) {
+		return fmt.Errorf("wglinux: invalid endpoint IP: %s", endpoint.IP.String())
+	}
 
-		// IPv4 address handling.
-		var addr [4]byte
-		copy(addr[:], endpoint.IP.To4())
+	// Is this an IPv6 address?
+	if isIPv6(endpoint.IP) {
+		var addr [16]byte
+		copy(addr[:], endpoint.IP.To16())
 
-		sa := unix.RawSockaddrInet4{
-			Family: unix.AF_INET,
+		sa := unix.RawSockaddrInet6{
+			Family: unix.AF_INET6,
 			Port:   sockaddrPort(endpoint.Port),
 			Addr:   addr,
 		}
 
-		return (*(*[unix.SizeofSockaddrInet4]byte)(unsafe.Pointer(&sa)))[:], nil
+		ae.Bytes(typ, (*(*[unix.SizeofSockaddrInet6]byte)(unsafe.Pointer(&sa)))[:])
+		return nil
 	}
-}
 
-// encodeAllowedIPs returns a function to encode allowed IP nested attributes.
-func encodeAllowedIPs(ipns []net.IPNet) func(ae *netlink.AttributeEncoder) error {
-	return func(ae *netlink.AttributeEncoder) error {
-		for i, ipn := range ipns {
-			if !isValidIP(ipn.IP) {
-				return fmt.Errorf("wglinux: invalid allowed IP: %s", ipn.IP.String())
-			}
+	// IPv4 address handling.
+	var addr [4]byte
+	copy(addr[:], endpoint.IP.To4())
 
-			family := uint16(unix.AF_INET6)
-			if !isIPv6(ipn.IP) {
-				// Make sure address is 4 bytes if IPv4.
-				family = unix.AF_INET
-				ipn.IP = ipn.IP.To4()
-			}
+	sa := unix.RawSockaddrInet4{
+		Family: unix.AF_INET,
+		Port:   sockaddrPort(endpoint.Port),
+		Addr:   addr,
+	}
 
-			// Netlink arrays use type as an array index.
-			ae.Nested(uint16(i), func(nae *netlink.AttributeEncoder) error {
-				nae.Uint16(unix.WGALLOWEDIP_A_FAMILY, family)
-				nae.Bytes(unix.WGALLOWEDIP_A_IPADDR, ipn.IP)
-
-				ones, _ := ipn.Mask.Size()
-				nae.Uint8(unix.WGALLOWEDIP_A_CIDR_MASK, uint8(ones))
-				return nil
-			})
+	ae.Bytes(typ, (*(*[unix.SizeofSockaddrInet4]byte)(unsafe.Pointer(&sa)))[:])
+	return nil
+}
+
+// encodeAllowedIPs encodes ipns as allowed IP nested attributes.
+func encodeAllowedIPs(ae *attrEncoder, ipns []net.IPNet) error {
+	for i, ipn := range ipns {
+		// Infer the address family and prefix length from the IP and mask so
+		// that mismatches are reported here rather than as EINVAL.
+		pfx, err := wgtypes.AllowedIPPrefix(ipn)
+		if err != nil {
+			return err
 		}
 
-		return nil
+		// Netlink arrays use type as an array index.
+		ae.Nested(uint16(i), func(nae *attrEncoder) error {
+			if addr := pfx.Addr(); addr.Is4() {
+				ip := addr.As4()
+				nae.Uint16(unix.WGALLOWEDIP_A_FAMILY, unix.AF_INET)
+				nae.Bytes(unix.WGALLOWEDIP_A_IPADDR, ip[:])
+			} else {
+				ip := addr.As16()
+				nae.Uint16(unix.WGALLOWEDIP_A_FAMILY, unix.AF_INET6)
+				nae.Bytes(unix.WGALLOWEDIP_A_IPADDR, ip[:])
+			}
+
+			nae.Uint8(unix.WGALLOWEDIP_A_CIDR_MASK, uint8(pfx.Bits()))
+			return nil
+		})
 	}
+
+	return nil
 }
 
 // isValidIP determines if IP is a valid IPv4 or IPv6 address.
@@ -4,6 +4,7 @@
 package wglinux
 
 import (
+	"errors"
 	"net"
 	"testing"
 	"time"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/danpashin/wgctrl/internal/wgtest"
 	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
 	"github.com/mdlayher/genetlink"
 	"github.com/mdlayher/genetlink/genltest"
 	"github.com/mdlayher/netlink"
@@ -278,15 +280,17 @@ func TestLinuxClientConfigureDeviceLargePeerIPChunks(t *testing.T) {
 		Data: nlenc.Bytes(okName),
 	}
 
+	// Each message holds up to 202 IPv6 allowed IPs of a single peer, after
+	// the device name and peer attributes.
 	var (
 		peerA    = wgtest.MustPublicKey()
-		peerAIPs = generateIPs(ipBatchChunk + 1)
+		peerAIPs = generateIPs(257)
 
 		peerB    = wgtest.MustPublicKey()
-		peerBIPs = generateIPs(ipBatchChunk / 2)
+		peerBIPs = generateIPs(128)
 
 		peerC    = wgtest.MustPublicKey()
-		peerCIPs = generateIPs(ipBatchChunk * 3)
+		peerCIPs = generateIPs(768)
 
 		peerD = wgtest.MustPublicKey()
 	)
@@ -322,6 +326,10 @@ func TestLinuxClientConfigureDeviceLargePeerIPChunks(t *testing.T) {
 
 	var allAttrs []netlink.Attribute
 	fn := func(greq genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+		if l := len(greq.Data); l > maxBatchSize {
+			t.Fatalf("message attributes of %d bytes exceed maximum of %d bytes", l, maxBatchSize)
+		}
+
 		attrs, err := netlink.UnmarshalAttributes(greq.Data)
 		if err != nil {
 			return nil, err
@@ -340,167 +348,84 @@ func TestLinuxClientConfigureDeviceLargePeerIPChunks(t *testing.T) {
 		t.Fatalf("failed to configure: %v", err)
 	}
 
+	// peer returns the attributes of a peer with the specified flags and
+	// allowed IPs.
+	peer := func(key wgtypes.Key, flags uint32, ips []net.IPNet) []netlink.Attribute {
+		attrs := []netlink.Attribute{
+			{
+				Type: unix.WGPEER_A_PUBLIC_KEY,
+				Data: key[:],
+			},
+			{
+				Type: unix.WGPEER_A_FLAGS,
+				Data: nlenc.Uint32Bytes(flags),
+			},
+		}
+
+		if len(ips) > 0 {
+			attrs = append(attrs, netlink.Attribute{
+				Type: netlink.Nested | unix.WGPEER_A_ALLOWEDIPS,
+				Data: mustAllowedIPs(ips),
+			})
+		}
+
+		return attrs
+	}
+
+	// peers returns the attribute holding the nested peers ps.
+	peers := func(ps ...[]netlink.Attribute) netlink.Attribute {
+		attrs := make([]netlink.Attribute, 0, len(ps))
+		for i, p := range ps {
+			attrs = append(attrs, netlink.Attribute{
+				Type: netlink.Nested | uint16(i),
+				Data: m(p...),
+			})
+		}
+
+		return netlink.Attribute{
+			Type: netlink.Nested | unix.WGDEVICE_A_PEERS,
+			Data: m(attrs...),
+		}
+	}
+
+	const (
+		replace = unix.WGPEER_F_REPLACE_ALLOWEDIPS | unix.WGPEER_F_UPDATE_ONLY
+		update  = unix.WGPEER_F_UPDATE_ONLY
+	)
+
 	want := []netlink.Attribute{
-		// First peer, first chunk.
+		// First message: device attributes and the first chunk of the first
+		// peer.
 		nameAttr,
 		{
 			Type: unix.WGDEVICE_A_FLAGS,
 			Data: nlenc.Uint32Bytes(unix.WGDEVICE_F_REPLACE_PEERS),
 		},
-		{
-			Type: netlink.Nested | unix.WGDEVICE_A_PEERS,
-			Data: m(netlink.Attribute{
-				Type: netlink.Nested,
-				Data: m([]netlink.Attribute{
-					{
-						Type: unix.WGPEER_A_PUBLIC_KEY,
-						Data: peerA[:],
-					},
-					{
-						Type: unix.WGPEER_A_FLAGS,
-						Data: nlenc.Uint32Bytes(unix.WGPEER_F_REPLACE_ALLOWEDIPS | unix.WGPEER_F_UPDATE_ONLY),
-					},
-					{
-						Type: netlink.Nested | unix.WGPEER_A_ALLOWEDIPS,
-						Data: mustAllowedIPs(peerAIPs[:ipBatchChunk]),
-					},
-				}...),
-			}),
-		},
-		// First peer, final chunk.
-		nameAttr,
-		{
-			Type: netlink.Nested | unix.WGDEVICE_A_PEERS,
-			Data: m(netlink.Attribute{
-				Type: netlink.Nested,
-				Data: m([]netlink.Attribute{
-					{
-						Type: unix.WGPEER_A_PUBLIC_KEY,
-						Data: peerA[:],
-					},
-					{
-						Type: unix.WGPEER_A_FLAGS,
-						Data: nlenc.Uint32Bytes(unix.WGPEER_F_UPDATE_ONLY),
-					},
-					// Not first chunk; don't replace IPs.
-					{
-						Type: netlink.Nested | unix.WGPEER_A_ALLOWEDIPS,
-						Data: mustAllowedIPs(peerAIPs[ipBatchChunk:]),
-					},
-				}...),
-			}),
-		},
-		// Second peer, only chunk.
+		peers(peer(peerA, replace, peerAIPs[:202])),
+		// Second message: the final chunk of the first peer, which must not
+		// replace IPs, the only chunk of the second peer, and the first
+		// chunk of the third peer. This is not the first message; don't
+		// replace existing peers.
 		nameAttr,
-		// This is not the first peer; don't replace existing peers.
-		{
-			Type: netlink.Nested | unix.WGDEVICE_A_PEERS,
-			Data: m(netlink.Attribute{
-				Type: netlink.Nested,
-				Data: m([]netlink.Attribute{
-					{
-						Type: unix.WGPEER_A_PUBLIC_KEY,
-						Data: peerB[:],
-					},
-					{
-						Type: unix.WGPEER_A_FLAGS,
-						Data: nlenc.Uint32Bytes(unix.WGPEER_F_REPLACE_ALLOWEDIPS | unix.WGPEER_F_UPDATE_ONLY),
-					},
-					{
-						Type: netlink.Nested | unix.WGPEER_A_ALLOWEDIPS,
-						Data: mustAllowedIPs(peerBIPs),
-					},
-				}...),
-			}),
-		},
-		// Third peer, first chunk.
+		peers(
+			peer(peerA, update, peerAIPs[202:]),
+			peer(peerB, replace, peerBIPs),
+			peer(peerC, replace, peerCIPs[:17]),
+		),
+		// Following messages: further chunks of the third peer.
 		nameAttr,
-		// This is not the first peer; don't replace existing peers.
-		{
-			Type: netlink.Nested | unix.WGDEVICE_A_PEERS,
-			Data: m(netlink.Attribute{
-				Type: netlink.Nested,
-				Data: m([]netlink.Attribute{
-					{
-						Type: unix.WGPEER_A_PUBLIC_KEY,
-						Data: peerC[:],
-					},
-					{
-						Type: unix.WGPEER_A_FLAGS,
-						Data: nlenc.Uint32Bytes(unix.WGPEER_F_REPLACE_ALLOWEDIPS | unix.WGPEER_F_UPDATE_ONLY),
-					},
-					{
-						Type: netlink.Nested | unix.WGPEER_A_ALLOWEDIPS,
-						Data: mustAllowedIPs(peerCIPs[:ipBatchChunk]),
-					},
-				}...),
-			}),
-		},
-		// Third peer, second chunk.
+		peers(peer(peerC, update, peerCIPs[17:219])),
 		nameAttr,
-		{
-			Type: netlink.Nested | unix.WGDEVICE_A_PEERS,
-			Data: m(netlink.Attribute{
-				Type: netlink.Nested,
-				Data: m([]netlink.Attribute{
-					{
-						Type: unix.WGPEER_A_PUBLIC_KEY,
-						Data: peerC[:],
-					},
-					{
-						Type: unix.WGPEER_A_FLAGS,
-						Data: nlenc.Uint32Bytes(unix.WGPEER_F_UPDATE_ONLY),
-					},
-					// Not first chunk; don't replace IPs.
-					{
-						Type: netlink.Nested | unix.WGPEER_A_ALLOWEDIPS,
-						Data: mustAllowedIPs(peerCIPs[ipBatchChunk : ipBatchChunk*2]),
-					},
-				}...),
-			}),
-		},
-		// Third peer, final chunk.
+		peers(peer(peerC, update, peerCIPs[219:421])),
 		nameAttr,
-		{
-			Type: netlink.Nested | unix.WGDEVICE_A_PEERS,
-			Data: m(netlink.Attribute{
-				Type: netlink.Nested,
-				Data: m([]netlink.Attribute{
-					{
-						Type: unix.WGPEER_A_PUBLIC_KEY,
-						Data: peerC[:],
-					},
-					{
-						Type: unix.WGPEER_A_FLAGS,
-						Data: nlenc.Uint32Bytes(unix.WGPEER_F_UPDATE_ONLY),
-					},
-					// Not first chunk; don't replace IPs.
-					{
-						Type: netlink.Nested | unix.WGPEER_A_ALLOWEDIPS,
-						Data: mustAllowedIPs(peerCIPs[ipBatchChunk*2:]),
-					},
-				}...),
-			}),
-		},
-		// Fourth peer, only chunk.
+		peers(peer(peerC, update, peerCIPs[421:623])),
+		// Final message: the final chunk of the third peer, and the fourth
+		// peer.
 		nameAttr,
-		{
-			Type: netlink.Nested | unix.WGDEVICE_A_PEERS,
-			Data: m(netlink.Attribute{
-				Type: netlink.Nested,
-				Data: m([]netlink.Attribute{
-					{
-						Type: unix.WGPEER_A_PUBLIC_KEY,
-						Data: peerD[:],
-					},
-					// Not first chunk; don't replace IPs.
-					{
-						Type: unix.WGPEER_A_FLAGS,
-						Data: nlenc.Uint32Bytes(unix.WGPEER_F_REMOVE_ME),
-					},
-				}...),
-			}),
-		},
+		peers(
+			peer(peerC, update, peerCIPs[623:]),
+			peer(peerD, unix.WGPEER_F_REMOVE_ME, nil),
+		),
 	}
 
 	if diff := diffAttrs(want, allAttrs); diff != "" {
@@ -508,6 +433,93 @@ func TestLinuxClientConfigureDeviceLargePeerIPChunks(t *testing.T) {
 	}
 }
 
+func TestLinuxBuildBatchesSize(t *testing.T) {
+	var (
+		psk = wgtest.MustPresharedKey()
+		ka  = 25 * time.Second
+	)
+
+	cfg := wgtest.BenchConfig(1000)
+	cfg.Peers = append(cfg.Peers,
+		wgtypes.PeerConfig{
+			PublicKey:    wgtest.MustPublicKey(),
+			PresharedKey: &psk,
+			Endpoint:     wgtest.MustUDPAddr("[2001:db8::1]:51820"),
+			AllowedIPs:   generateIPs(1000),
+		},
+		wgtypes.PeerConfig{
+			PublicKey:                   wgtest.MustPublicKey(),
+			UpdateOnly:                  true,
+			PersistentKeepaliveInterval: &ka,
+			AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("192.0.2.0/24")},
+		},
+	)
+
+	batches, err := buildBatches(okName, cfg)
+	if err != nil {
+		t.Fatalf("failed to build batches: %v", err)
+	}
+	if len(batches) < 2 {
+		t.Fatalf("expected configuration to be split, but got %d batch(es)", len(batches))
+	}
+
+	var peers, ips int
+	for i, b := range batches {
+		if i > 0 && (b.PrivateKey != nil || b.ListenPort != nil || b.ReplacePeers) {
+			t.Fatalf("batch %d: unexpected device attributes", i)
+		}
+
+		for _, p := range b.Peers {
+			if diff := cmp.Diff(encodedPeerSize(t, p), peerSize(p)); diff != "" {
+				t.Fatalf("batch %d: unexpected peer size (-want +got):\n%s", i, diff)
+			}
+
+			ips += len(p.AllowedIPs)
+		}
+		peers += len(b.Peers)
+
+		ae := newAttrEncoder()
+		attrs, err := configAttrs(ae, okName, b)
+		if err != nil {
+			t.Fatalf("batch %d: failed to encode: %v", i, err)
+		}
+		if l := len(attrs); l > maxBatchSize {
+			t.Fatalf("batch %d: attributes of %d bytes exceed maximum of %d bytes", i, l, maxBatchSize)
+		}
+		ae.release()
+	}
+
+	var wantIPs int
+	for _, p := range cfg.Peers {
+		wantIPs += len(p.AllowedIPs)
+	}
+	if diff := cmp.Diff(wantIPs, ips); diff != "" {
+		t.Fatalf("unexpected number of allowed IPs (-want +got):\n%s", diff)
+	}
+	if peers < len(cfg.Peers) {
+		t.Fatalf("expected at least %d peers, but got %d", len(cfg.Peers), peers)
+	}
+}
+
+// encodedPeerSize returns the size of the nested attribute encoding p.
+func encodedPeerSize(t *testing.T, p wgtypes.PeerConfig) int {
+	t.Helper()
+
+	ae := newAttrEncoder()
+	defer ae.release()
+
+	ae.Nested(0, func(nae *attrEncoder) error {
+		return encodePeer(nae, p)
+	})
+
+	b, err := ae.Encode()
+	if err != nil {
+		t.Fatalf("failed to encode peer: %v", err)
+	}
+
+	return len(b)
+}
+
 func keyBytes(s string) []byte {
 	k := wgtest.MustHexKey(s)
 	return k[:]
@@ -534,3 +546,104 @@ func generateIPs(n int) []net.IPNet {
 
 	return ips
 }
+
+func TestLinuxPersistentKeepaliveRoundTrip(t *testing.T) {
+	for _, d := range []time.Duration{0, time.Second, 25 * time.Second, wgtypes.MaxPersistentKeepaliveInterval} {
+		t.Run(d.String(), func(t *testing.T) {
+			ae := newAttrEncoder()
+			defer ae.release()
+
+			ae.Nested(0, func(nae *attrEncoder) error {
+				return encodePeer(nae, wgtypes.PeerConfig{
+					PublicKey:                   wgtest.MustPublicKey(),
+					PersistentKeepaliveInterval: &d,
+				})
+			})
+
+			b, err := ae.Encode()
+			if err != nil {
+				t.Fatalf("failed to encode peer: %v", err)
+			}
+
+			ad, err := netlink.NewAttributeDecoder(b)
+			if err != nil {
+				t.Fatalf("failed to create decoder: %v", err)
+			}
+
+			var p wgtypes.Peer
+			for ad.Next() {
+				ad.Nested(func(nad *netlink.AttributeDecoder) error {
+					p = parsePeer(nad, false)
+					return nil
+				})
+			}
+			if err := ad.Err(); err != nil {
+				t.Fatalf("failed to decode peer: %v", err)
+			}
+
+			if diff := cmp.Diff(d, p.PersistentKeepaliveInterval); diff != "" {
+				t.Fatalf("unexpected keepalive interval (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLinuxEncodeAllowedIPsFamily(t *testing.T) {
+	// An IPv4 address with an IPv4-mapped IPv6 mask is sent as IPv4.
+	want := mustAllowedIPs([]net.IPNet{wgtest.MustCIDR("10.0.0.0/8")})
+	got := mustAllowedIPs([]net.IPNet{wgtest.MustCIDR("::ffff:10.0.0.0/104")})
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected allowed IP attributes (-want +got):\n%s", diff)
+	}
+
+	ae := newAttrEncoder()
+	defer ae.release()
+
+	err := encodeAllowedIPs(ae, []net.IPNet{{
+		IP:   net.IPv4(10, 0, 0, 0),
+		Mask: net.CIDRMask(33, 128),
+	}})
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestLinuxClientConfigureDeviceAmneziaV15(t *testing.T) {
+	var (
+		size     uint16 = 64
+		packet          = "<b 0xf6ab3267fa><r 16>"
+		interval uint32 = 120
+	)
+
+	tests := []struct {
+		name string
+		cfg  wgtypes.AdvancedSecurityConfig
+	}{
+		{name: "S3", cfg: wgtypes.AdvancedSecurityConfig{UnderloadPacketJunkSize: &size}},
+		{name: "S4", cfg: wgtypes.AdvancedSecurityConfig{TransportPacketJunkSize: &size}},
+		{name: "I1", cfg: wgtypes.AdvancedSecurityConfig{SpecialJunkPacket1: &packet}},
+		{name: "I2", cfg: wgtypes.AdvancedSecurityConfig{SpecialJunkPacket2: &packet}},
+		{name: "I3", cfg: wgtypes.AdvancedSecurityConfig{SpecialJunkPacket3: &packet}},
+		{name: "I4", cfg: wgtypes.AdvancedSecurityConfig{SpecialJunkPacket4: &packet}},
+		{name: "I5", cfg: wgtypes.AdvancedSecurityConfig{SpecialJunkPacket5: &packet}},
+		{name: "Itime", cfg: wgtypes.AdvancedSecurityConfig{SpecialJunkInterval: &interval}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+				t.Fatal("the device must not be configured")
+				return nil, nil
+			}
+
+			c := testClient(t, genltest.CheckRequest(familyID, unix.WG_CMD_SET_DEVICE, netlink.Request|netlink.Acknowledge, fn))
+			defer c.Close()
+
+			err := c.ConfigureDevice(okName, wgtypes.Config{AdvancedSecurityConfig: tt.cfg})
+			if !errors.Is(err, wgtypes.ErrAdvancedSecurityNotSupported) {
+				t.Fatalf("expected ErrAdvancedSecurityNotSupported, but got: %v", err)
+			}
+		})
+	}
+}
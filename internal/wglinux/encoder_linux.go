@@ -0,0 +1,171 @@
+//go:build linux
+// +build linux
+
+package wglinux
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+// nlaHeaderLen is the length of a netlink attribute header.
+const nlaHeaderLen = 4
+
+// maxPooledEncoder is the largest buffer capacity an attrEncoder may retain
+// when it is returned to the pool. Batched configurations never approach it.
+const maxPooledEncoder = 1 << 20
+
+var errAttributeTooLarge = errors.New("wglinux: attribute is too large to fit in a netlink attribute")
+
+// encoderPool holds attrEncoders for reuse by configAttrs callers.
+var encoderPool = sync.Pool{
+	New: func() any { return new(attrEncoder) },
+}
+
+// An attrEncoder encodes netlink attributes directly into a single buffer.
+//
+// Unlike netlink.AttributeEncoder, which marshals each nested attribute into
+// its own byte slice before copying it into its parent, an attrEncoder writes
+// nested attributes in place and patches their lengths afterwards, so
+// encoding a large set of peers does not allocate per peer. attrEncoders are
+// pooled: use newAttrEncoder and release.
+type attrEncoder struct {
+	b   []byte
+	err error
+}
+
+// newAttrEncoder returns an empty attrEncoder from the pool.
+func newAttrEncoder() *attrEncoder {
+	ae := encoderPool.Get().(*attrEncoder)
+	ae.b = ae.b[:0]
+	ae.err = nil
+	return ae
+}
+
+// release returns ae to the pool. The bytes returned by Encode must not be
+// used after release is called.
+func (ae *attrEncoder) release() {
+	if cap(ae.b) > maxPooledEncoder {
+		return
+	}
+
+	encoderPool.Put(ae)
+}
+
+// Bytes encodes b as an attribute of type typ.
+func (ae *attrEncoder) Bytes(typ uint16, b []byte) {
+	copy(ae.attr(typ, len(b)), b)
+}
+
+// String encodes s as a NULL-terminated string attribute of type typ.
+func (ae *attrEncoder) String(typ uint16, s string) {
+	b := ae.attr(typ, len(s)+1)
+	if b == nil {
+		return
+	}
+
+	copy(b, s)
+	b[len(s)] = 0
+}
+
+// Uint8 encodes v as an attribute of type typ.
+func (ae *attrEncoder) Uint8(typ uint16, v uint8) {
+	if b := ae.attr(typ, 1); b != nil {
+		b[0] = v
+	}
+}
+
+// Uint16 encodes v as a native endian attribute of type typ.
+func (ae *attrEncoder) Uint16(typ uint16, v uint16) {
+	if b := ae.attr(typ, 2); b != nil {
+		nlenc.PutUint16(b, v)
+	}
+}
+
+// Uint32 encodes v as a native endian attribute of type typ.
+func (ae *attrEncoder) Uint32(typ uint16, v uint32) {
+	if b := ae.attr(typ, 4); b != nil {
+		nlenc.PutUint32(b, v)
+	}
+}
+
+// Nested encodes the attributes produced by fn as an attribute of type typ,
+// flagged with netlink.Nested.
+func (ae *attrEncoder) Nested(typ uint16, fn func(ae *attrEncoder) error) {
+	if ae.err != nil {
+		return
+	}
+
+	off := len(ae.b)
+	ae.b = append(ae.b, make([]byte, nlaHeaderLen)...)
+
+	if err := fn(ae); err != nil {
+		ae.fail(err)
+		return
+	}
+
+	// fn may have failed by way of another method.
+	if ae.err != nil {
+		return
+	}
+
+	n := len(ae.b) - off
+	if n > math.MaxUint16 {
+		ae.fail(errAttributeTooLarge)
+		return
+	}
+
+	// Nested attributes are always padded, so no further padding is needed.
+	nlenc.PutUint16(ae.b[off:off+2], uint16(n))
+	nlenc.PutUint16(ae.b[off+2:off+4], netlink.Nested|typ)
+}
+
+// Encode returns the encoded attributes, or the first error encountered while
+// encoding them. The returned bytes are only valid until ae is released.
+func (ae *attrEncoder) Encode() ([]byte, error) {
+	if ae.err != nil {
+		return nil, ae.err
+	}
+
+	return ae.b, nil
+}
+
+// attr appends the header of an attribute of type typ with n bytes of data
+// and its padding, and returns the slice which must hold the data. attr
+// returns nil if an error has occurred.
+func (ae *attrEncoder) attr(typ uint16, n int) []byte {
+	if ae.err != nil {
+		return nil
+	}
+
+	l := nlaHeaderLen + n
+	if l > math.MaxUint16 {
+		ae.fail(errAttributeTooLarge)
+		return nil
+	}
+
+	off := len(ae.b)
+	ae.b = append(ae.b, make([]byte, nlaAlign(l))...)
+
+	nlenc.PutUint16(ae.b[off:off+2], uint16(l))
+	nlenc.PutUint16(ae.b[off+2:off+4], typ)
+
+	return ae.b[off+nlaHeaderLen : off+l]
+}
+
+// fail records err if no other error has occurred.
+func (ae *attrEncoder) fail(err error) {
+	if ae.err == nil {
+		ae.err = err
+	}
+}
+
+// nlaAlign returns the netlink attribute length n rounded up to a 4 byte
+// boundary.
+func nlaAlign(n int) int {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,119 @@
+//go:build linux
+// +build linux
+
+package wglinux
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netlink"
+)
+
+func TestLinuxAttrEncoder(t *testing.T) {
+	// The output must match netlink.AttributeEncoder byte for byte, including
+	// the lengths and padding of odd-sized and nested attributes.
+	want := netlink.NewAttributeEncoder()
+	want.String(1, "wg0")
+	want.Uint8(2, 0xff)
+	want.Uint16(3, 0x1234)
+	want.Uint32(4, 0xdeadbeef)
+	want.Bytes(5, []byte{1, 2, 3, 4, 5})
+	want.Nested(6, func(nae *netlink.AttributeEncoder) error {
+		nae.Nested(0, func(nae *netlink.AttributeEncoder) error {
+			nae.Bytes(1, []byte{1, 2, 3})
+			nae.Uint8(2, 1)
+			return nil
+		})
+		nae.Nested(1, func(nae *netlink.AttributeEncoder) error { return nil })
+		return nil
+	})
+
+	wb, err := want.Encode()
+	if err != nil {
+		t.Fatalf("failed to encode with netlink: %v", err)
+	}
+
+	got := newAttrEncoder()
+	defer got.release()
+
+	got.String(1, "wg0")
+	got.Uint8(2, 0xff)
+	got.Uint16(3, 0x1234)
+	got.Uint32(4, 0xdeadbeef)
+	got.Bytes(5, []byte{1, 2, 3, 4, 5})
+	got.Nested(6, func(nae *attrEncoder) error {
+		nae.Nested(0, func(nae *attrEncoder) error {
+			nae.Bytes(1, []byte{1, 2, 3})
+			nae.Uint8(2, 1)
+			return nil
+		})
+		nae.Nested(1, func(nae *attrEncoder) error { return nil })
+		return nil
+	})
+
+	gb, err := got.Encode()
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+
+	if diff := cmp.Diff(wb, gb); diff != "" {
+		t.Fatalf("unexpected attributes (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinuxAttrEncoderErrors(t *testing.T) {
+	errFoo := errors.New("foo")
+
+	tests := []struct {
+		name string
+		fn   func(ae *attrEncoder)
+		err  error
+	}{
+		{
+			name: "string too large",
+			fn: func(ae *attrEncoder) {
+				ae.String(1, strings.Repeat("a", 1<<16))
+			},
+			err: errAttributeTooLarge,
+		},
+		{
+			name: "nested too large",
+			fn: func(ae *attrEncoder) {
+				ae.Nested(1, func(nae *attrEncoder) error {
+					for i := 0; i < 2; i++ {
+						nae.Bytes(uint16(i), make([]byte, 1<<15))
+					}
+					return nil
+				})
+			},
+			err: errAttributeTooLarge,
+		},
+		{
+			name: "nested error",
+			fn: func(ae *attrEncoder) {
+				ae.Nested(1, func(nae *attrEncoder) error {
+					nae.Nested(2, func(_ *attrEncoder) error { return errFoo })
+					return nil
+				})
+				ae.Uint8(3, 1)
+			},
+			err: errFoo,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ae := newAttrEncoder()
+			defer ae.release()
+
+			tt.fn(ae)
+
+			if _, err := ae.Encode(); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, but got: %v", tt.err, err)
+			}
+		})
+	}
+}
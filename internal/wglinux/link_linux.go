@@ -0,0 +1,195 @@
+//go:build linux
+// +build linux
+
+package wglinux
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+var _ wginternal.DeviceManager = &Client{}
+
+// dialRTNL is the default implementation of Client.rtnl.
+func dialRTNL() (*netlink.Conn, error) {
+	return netlink.Dial(unix.NETLINK_ROUTE, nil)
+}
+
+// DialLinkNotifications dials an rtnetlink connection which receives a
+// notification whenever a link is added, removed, or changed in the network
+// namespace of the Client.
+func (c *Client) DialLinkNotifications() (*netlink.Conn, error) {
+	return netlink.Dial(unix.NETLINK_ROUTE, &netlink.Config{
+		Groups: unix.RTMGRP_LINK,
+		NetNS:  c.netns,
+	})
+}
+
+// CreateDevice implements wginternal.DeviceManager, adding a link of the
+// WireGuard kind for the Client's type using rtnetlink, as with
+// "ip link add name type wireguard".
+func (c *Client) CreateDevice(name string) error {
+	if name == "" {
+		return errors.New("wglinux: device name must not be empty")
+	}
+
+	kind := kindsFor(c.clientType)[0]
+
+	ae := netlink.NewAttributeEncoder()
+	ae.String(unix.IFLA_IFNAME, name)
+	ae.Nested(unix.IFLA_LINKINFO, func(nae *netlink.AttributeEncoder) error {
+		nae.String(unix.IFLA_INFO_KIND, kind)
+		return nil
+	})
+
+	attrs, err := ae.Encode()
+	if err != nil {
+		return err
+	}
+
+	_, err = executeRTNL(c.rtnl, unix.RTM_NEWLINK, netlink.Request|netlink.Acknowledge|netlink.Create|netlink.Excl, 0, attrs)
+	switch {
+	case errors.Is(err, unix.EOPNOTSUPP):
+		// The kernel has no link type for kind, and could not load a module
+		// which provides it.
+		return fmt.Errorf("wglinux: failed to create device %q: link kind %q is not supported by the kernel: %w", name, kind, err)
+	case err != nil:
+		return fmt.Errorf("wglinux: failed to create device %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// DeleteDevice implements wginternal.DeviceManager, deleting the link of the
+// device specified by name using rtnetlink, as with "ip link del name". Links
+// which are not of a WireGuard kind for the Client's type are never deleted,
+// and are reported as not existing.
+func (c *Client) DeleteDevice(name string) error {
+	if name == "" {
+		return os.ErrNotExist
+	}
+
+	l, err := getLink(c.rtnl, name)
+	if err != nil {
+		return fmt.Errorf("wglinux: failed to get link of device %q: %w", name, err)
+	}
+
+	var isWG bool
+	for _, k := range kindsFor(c.clientType) {
+		isWG = isWG || l.kind == k
+	}
+	if !isWG {
+		return fmt.Errorf("wglinux: device %q is not a WireGuard device: %w", name, os.ErrNotExist)
+	}
+
+	// Delete the link by index, so that another link which has taken its name
+	// since it was checked is never deleted.
+	if _, err := executeRTNL(c.rtnl, unix.RTM_DELLINK, netlink.Request|netlink.Acknowledge, l.index, nil); err != nil {
+		return fmt.Errorf("wglinux: failed to delete device %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// An rtnlLink is the subset of the attributes of an rtnetlink link used by
+// this package.
+type rtnlLink struct {
+	index  int32
+	kind   string
+	qdisc  string
+	txqlen uint32
+}
+
+// getLink fetches the link of the network interface specified by name using
+// an rtnetlink connection from dial.
+func getLink(dial func() (*netlink.Conn, error), name string) (*rtnlLink, error) {
+	if name == "" {
+		return nil, os.ErrNotExist
+	}
+
+	attrs, err := netlink.MarshalAttributes([]netlink.Attribute{{
+		Type: unix.IFLA_IFNAME,
+		Data: nlenc.Bytes(name),
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := executeRTNL(dial, unix.RTM_GETLINK, netlink.Request, 0, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) != 1 || len(msgs[0].Data) < unix.SizeofIfInfomsg {
+		return nil, errors.New("unexpected rtnetlink reply")
+	}
+
+	l := &rtnlLink{index: nlenc.Int32(msgs[0].Data[4:8])}
+
+	ad, err := netlink.NewAttributeDecoder(msgs[0].Data[unix.SizeofIfInfomsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	for ad.Next() {
+		switch ad.Type() {
+		case unix.IFLA_QDISC:
+			l.qdisc = ad.String()
+		case unix.IFLA_TXQLEN:
+			l.txqlen = ad.Uint32()
+		case unix.IFLA_LINKINFO:
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				for nad.Next() {
+					if nad.Type() == unix.IFLA_INFO_KIND {
+						l.kind = nad.String()
+					}
+				}
+				return nil
+			})
+		}
+	}
+	if err := ad.Err(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// executeRTNL executes a single rtnetlink link request with the specified
+// message type, header flags, interface index, and attributes, using a
+// connection from dial. Errors indicating that no such link exists are
+// converted to os.ErrNotExist.
+func executeRTNL(dial func() (*netlink.Conn, error), typ netlink.HeaderType, flags netlink.HeaderFlags, index int32, attrb []byte) ([]netlink.Message, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ifi := make([]byte, unix.SizeofIfInfomsg)
+	ifi[0] = unix.AF_UNSPEC
+	nlenc.PutInt32(ifi[4:8], index)
+
+	msgs, err := conn.Execute(netlink.Message{
+		Header: netlink.Header{
+			Type:  typ,
+			Flags: flags,
+		},
+		Data: append(ifi, attrb...),
+	})
+	if err == nil {
+		return msgs, nil
+	}
+
+	var oerr *netlink.OpError
+	if errors.As(err, &oerr) && oerr.Err == unix.ENODEV {
+		return nil, os.ErrNotExist
+	}
+
+	return nil, err
+}
@@ -0,0 +1,214 @@
+//go:build linux
+// +build linux
+
+package wglinux
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/mdlayher/netlink/nltest"
+	"golang.org/x/sys/unix"
+)
+
+func TestLinuxClientCreateDevice(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientType wgtypes.ClientType
+		errno      unix.Errno
+		kind       string
+		exist      bool
+	}{
+		{
+			name:       "wireguard",
+			clientType: wgtypes.NativeClient,
+			kind:       wgKind,
+		},
+		{
+			name:       "amneziawg",
+			clientType: wgtypes.AmneziaClient,
+			kind:       amneziaWgKind,
+		},
+		{
+			name:       "exists",
+			clientType: wgtypes.NativeClient,
+			errno:      unix.EEXIST,
+			kind:       wgKind,
+			exist:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var kind string
+			c := testLinkClient(tt.clientType, func(reqs []netlink.Message) ([]netlink.Message, error) {
+				req := reqs[0]
+				if diff := cmp.Diff(netlink.HeaderType(unix.RTM_NEWLINK), req.Header.Type); diff != "" {
+					t.Fatalf("unexpected message type (-want +got):\n%s", diff)
+				}
+
+				want := netlink.Request | netlink.Acknowledge | netlink.Create | netlink.Excl
+				if diff := cmp.Diff(want, req.Header.Flags); diff != "" {
+					t.Fatalf("unexpected flags (-want +got):\n%s", diff)
+				}
+
+				name, k := parseLinkRequest(t, req)
+				if diff := cmp.Diff("wg0", name); diff != "" {
+					t.Fatalf("unexpected name (-want +got):\n%s", diff)
+				}
+				kind = k
+
+				return nltest.Error(int(tt.errno), reqs)
+			})
+
+			err := c.CreateDevice("wg0")
+			if tt.exist {
+				if !errors.Is(err, os.ErrExist) {
+					t.Fatalf("expected exists, but got: %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("failed to create device: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.kind, kind); diff != "" {
+				t.Fatalf("unexpected link kind (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLinuxClientDeleteDevice(t *testing.T) {
+	const index = 7
+
+	tests := []struct {
+		name    string
+		kind    string
+		errno   unix.Errno
+		deleted bool
+	}{
+		{
+			name:    "wireguard",
+			kind:    wgKind,
+			deleted: true,
+		},
+		{
+			name: "not wireguard",
+			kind: "bridge",
+		},
+		{
+			name:  "not found",
+			errno: unix.ENODEV,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted bool
+			c := testLinkClient(wgtypes.NativeClient, func(reqs []netlink.Message) ([]netlink.Message, error) {
+				req := reqs[0]
+				switch req.Header.Type {
+				case unix.RTM_GETLINK:
+					if tt.errno != 0 {
+						return nltest.Error(int(tt.errno), reqs)
+					}
+
+					name, _ := parseLinkRequest(t, req)
+					if diff := cmp.Diff("wg0", name); diff != "" {
+						t.Fatalf("unexpected name (-want +got):\n%s", diff)
+					}
+
+					ifi := make([]byte, unix.SizeofIfInfomsg)
+					nlenc.PutInt32(ifi[4:8], index)
+
+					return []netlink.Message{{
+						Header: netlink.Header{
+							Type:     unix.RTM_NEWLINK,
+							Sequence: req.Header.Sequence,
+							PID:      req.Header.PID,
+						},
+						Data: append(ifi, nltest.MustMarshalAttributes([]netlink.Attribute{
+							{Type: unix.IFLA_IFNAME, Data: nlenc.Bytes("wg0")},
+							{
+								Type: unix.IFLA_LINKINFO,
+								Data: nltest.MustMarshalAttributes([]netlink.Attribute{{
+									Type: unix.IFLA_INFO_KIND,
+									Data: nlenc.Bytes(tt.kind),
+								}}),
+							},
+						})...),
+					}}, nil
+				case unix.RTM_DELLINK:
+					if diff := cmp.Diff(int32(index), nlenc.Int32(req.Data[4:8])); diff != "" {
+						t.Fatalf("unexpected interface index (-want +got):\n%s", diff)
+					}
+
+					deleted = true
+					return nltest.Error(0, reqs)
+				default:
+					t.Fatalf("unexpected message type: %d", req.Header.Type)
+					return nil, nil
+				}
+			})
+
+			err := c.DeleteDevice("wg0")
+			if tt.deleted {
+				if err != nil {
+					t.Fatalf("failed to delete device: %v", err)
+				}
+			} else if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected is not exist, but got: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.deleted, deleted); diff != "" {
+				t.Fatalf("unexpected deletion (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// testLinkClient returns a Client whose rtnetlink requests are handled by fn.
+func testLinkClient(clientType wgtypes.ClientType, fn nltest.Func) *Client {
+	return &Client{
+		clientType: clientType,
+		rtnl: func() (*netlink.Conn, error) {
+			return nltest.Dial(fn), nil
+		},
+	}
+}
+
+// parseLinkRequest returns the interface name and link kind of an rtnetlink
+// link request.
+func parseLinkRequest(t *testing.T, req netlink.Message) (name, kind string) {
+	t.Helper()
+
+	ad, err := netlink.NewAttributeDecoder(req.Data[unix.SizeofIfInfomsg:])
+	if err != nil {
+		t.Fatalf("failed to create attribute decoder: %v", err)
+	}
+
+	for ad.Next() {
+		switch ad.Type() {
+		case unix.IFLA_IFNAME:
+			name = ad.String()
+		case unix.IFLA_LINKINFO:
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				for nad.Next() {
+					if nad.Type() == unix.IFLA_INFO_KIND {
+						kind = nad.String()
+					}
+				}
+				return nil
+			})
+		}
+	}
+	if err := ad.Err(); err != nil {
+		t.Fatalf("failed to decode attributes: %v", err)
+	}
+
+	return name, kind
+}
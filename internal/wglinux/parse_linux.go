@@ -18,13 +18,14 @@ import (
 
 // parseDevice parses a Device from a slice of generic netlink messages,
 // automatically merging peer lists from subsequent messages into the Device
-// from the first message.
-func parseDevice(msgs []genetlink.Message) (*wgtypes.Device, error) {
+// from the first message. If lazy is true, the allowed IPs of peers are kept
+// undecoded in their LazyAllowedIPs field.
+func parseDevice(msgs []genetlink.Message, lazy bool) (*wgtypes.Device, error) {
 	var first wgtypes.Device
 	knownPeers := make(map[wgtypes.Key]int)
 
 	for i, m := range msgs {
-		d, err := parseDeviceLoop(m)
+		d, err := parseDeviceLoop(m, lazy)
 		if err != nil {
 			return nil, err
 		}
@@ -51,7 +52,7 @@ func parseDevice(msgs []genetlink.Message) (*wgtypes.Device, error) {
 }
 
 // parseDeviceLoop parses a Device from a single generic netlink message.
-func parseDeviceLoop(m genetlink.Message) (*wgtypes.Device, error) {
+func parseDeviceLoop(m genetlink.Message, lazy bool) (*wgtypes.Device, error) {
 	ad, err := netlink.NewAttributeDecoder(m.Data)
 	if err != nil {
 		return nil, err
@@ -61,8 +62,7 @@ func parseDeviceLoop(m genetlink.Message) (*wgtypes.Device, error) {
 	for ad.Next() {
 		switch ad.Type() {
 		case unix.WGDEVICE_A_IFINDEX:
-			// Ignored; interface index isn't exposed at all in the userspace
-			// configuration protocol, and name is more friendly anyway.
+			d.Index = int(ad.Uint32())
 		case unix.WGDEVICE_A_IFNAME:
 			d.Name = ad.String()
 		case unix.WGDEVICE_A_PRIVATE_KEY:
@@ -83,7 +83,7 @@ func parseDeviceLoop(m genetlink.Message) (*wgtypes.Device, error) {
 				d.Peers = make([]wgtypes.Peer, 0, nad.Len())
 				for nad.Next() {
 					nad.Nested(func(nnad *netlink.AttributeDecoder) error {
-						d.Peers = append(d.Peers, parsePeer(nnad))
+						d.Peers = append(d.Peers, parsePeer(nnad, lazy))
 						return nil
 					})
 				}
@@ -118,8 +118,9 @@ func parseDeviceLoop(m genetlink.Message) (*wgtypes.Device, error) {
 	return &d, nil
 }
 
-// parseAllowedIPs parses a wgtypes.Peer from a netlink attribute payload.
-func parsePeer(ad *netlink.AttributeDecoder) wgtypes.Peer {
+// parsePeer parses a wgtypes.Peer from a netlink attribute payload. If lazy is
+// true, its allowed IPs are kept undecoded in its LazyAllowedIPs field.
+func parsePeer(ad *netlink.AttributeDecoder, lazy bool) wgtypes.Peer {
 	var p wgtypes.Peer
 	for ad.Next() {
 		switch ad.Type() {
@@ -139,7 +140,12 @@ func parsePeer(ad *netlink.AttributeDecoder) wgtypes.Peer {
 		case unix.WGPEER_A_TX_BYTES:
 			p.TransmitBytes = int64(ad.Uint64())
 		case unix.WGPEER_A_ALLOWEDIPS:
-			ad.Nested(parseAllowedIPs(&p.AllowedIPs))
+			if lazy {
+				// Bytes returns a copy, so the message may be discarded.
+				p.LazyAllowedIPs = lazyAllowedIPs(ad.Bytes())
+			} else {
+				ad.Nested(parseAllowedIPs(&p.AllowedIPs))
+			}
 		case unix.WGPEER_A_PROTOCOL_VERSION:
 			p.ProtocolVersion = int(ad.Uint32())
 		}
@@ -196,6 +202,49 @@ func parseAllowedIPs(ipns *[]net.IPNet) func(ad *netlink.AttributeDecoder) error
 	}
 }
 
+// lazyAllowedIPs returns a wgtypes.LazyAllowedIPs which decodes the allowed IP
+// attributes in b using parseAllowedIPs.
+func lazyAllowedIPs(b []byte) *wgtypes.LazyAllowedIPs {
+	return wgtypes.NewLazyAllowedIPs(func() ([]net.IPNet, error) {
+		ad, err := netlink.NewAttributeDecoder(b)
+		if err != nil {
+			return nil, err
+		}
+
+		var ipns []net.IPNet
+		if err := parseAllowedIPs(&ipns)(ad); err != nil {
+			return nil, err
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+
+		return ipns, nil
+	})
+}
+
+// joinLazyAllowedIPs returns a wgtypes.LazyAllowedIPs which decodes the allowed
+// IPs of a, if any, followed by those of b.
+func joinLazyAllowedIPs(a, b *wgtypes.LazyAllowedIPs) *wgtypes.LazyAllowedIPs {
+	if a == nil {
+		return b
+	}
+
+	return wgtypes.NewLazyAllowedIPs(func() ([]net.IPNet, error) {
+		x, err := a.Decode()
+		if err != nil {
+			return nil, err
+		}
+		y, err := b.Decode()
+		if err != nil {
+			return nil, err
+		}
+
+		ipns := make([]net.IPNet, 0, len(x)+len(y))
+		return append(append(ipns, x...), y...), nil
+	})
+}
+
 // parseKey parses a wgtypes.Key from a byte slice.
 func parseKey(key *wgtypes.Key) func(b []byte) error {
 	return func(b []byte) error {
@@ -314,6 +363,9 @@ func mergeDevices(target, d *wgtypes.Device, knownPeers map[wgtypes.Key]int) {
 		// Peer is already known, append to it's allowed IP networks
 		if peerIndex, ok := knownPeers[d.Peers[i].PublicKey]; ok {
 			target.Peers[peerIndex].AllowedIPs = append(target.Peers[peerIndex].AllowedIPs, d.Peers[i].AllowedIPs...)
+			if l := d.Peers[i].LazyAllowedIPs; l != nil {
+				target.Peers[peerIndex].LazyAllowedIPs = joinLazyAllowedIPs(target.Peers[peerIndex].LazyAllowedIPs, l)
+			}
 		} else { // New peer, add it to the target peers.
 			target.Peers = append(target.Peers, d.Peers[i])
 			knownPeers[d.Peers[i].PublicKey] = len(target.Peers) - 1
@@ -4,6 +4,7 @@
 package wglinux
 
 import (
+	"encoding/binary"
 	"net"
 	"runtime"
 	"testing"
@@ -85,7 +86,7 @@ func TestLinuxClientDevicesError(t *testing.T) {
 			})
 			defer c.Close()
 
-			c.interfaces = func() ([]string, error) {
+			c.interfaces = func(_ wgtypes.ClientType) ([]string, error) {
 				return []string{okName}, nil
 			}
 
@@ -113,13 +114,13 @@ func TestLinuxClientDevicesOK(t *testing.T) {
 
 	tests := []struct {
 		name       string
-		interfaces func() ([]string, error)
+		interfaces func(clientType wgtypes.ClientType) ([]string, error)
 		msgs       [][]genetlink.Message
 		devices    []*wgtypes.Device
 	}{
 		{
 			name: "basic",
-			interfaces: func() ([]string, error) {
+			interfaces: func(_ wgtypes.ClientType) ([]string, error) {
 				return []string{okName, "wg1"}, nil
 			},
 			msgs: [][]genetlink.Message{
@@ -150,12 +151,14 @@ func TestLinuxClientDevicesOK(t *testing.T) {
 			},
 			devices: []*wgtypes.Device{
 				{
-					Name: okName,
-					Type: wgtypes.LinuxKernel,
+					Name:  okName,
+					Index: okIndex,
+					Type:  wgtypes.LinuxKernel,
 				},
 				{
-					Name: "wg1",
-					Type: wgtypes.LinuxKernel,
+					Name:  "wg1",
+					Index: testIndex,
+					Type:  wgtypes.LinuxKernel,
 				},
 			},
 		},
@@ -269,6 +272,7 @@ func TestLinuxClientDevicesOK(t *testing.T) {
 			devices: []*wgtypes.Device{
 				{
 					Name:         okName,
+					Index:        okIndex,
 					Type:         wgtypes.LinuxKernel,
 					PrivateKey:   testKey,
 					PublicKey:    testKey,
@@ -491,6 +495,71 @@ func TestLinuxClientDevicesOK(t *testing.T) {
 	}
 }
 
+func TestLinuxClientDeviceCaptures(t *testing.T) {
+	if nlenc.NativeEndian() != binary.LittleEndian {
+		t.Skip("skipping, captures were taken on little-endian hosts")
+	}
+
+	for _, src := range []wgtest.Source{wgtest.SourceLinux, wgtest.SourceAmneziaLinux} {
+		for _, cc := range wgtest.CapturesFrom(src) {
+			cc := cc
+			t.Run(cc.Name, func(t *testing.T) {
+				c := testClient(t, func(greq genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+					msgs := make([]genetlink.Message, 0, len(cc.Messages))
+					for _, b := range cc.Messages {
+						msgs = append(msgs, genetlink.Message{
+							Header: genetlink.Header{
+								Command: greq.Header.Command,
+								Version: greq.Header.Version,
+							},
+							Data: b,
+						})
+					}
+
+					return msgs, nil
+				})
+				defer c.Close()
+
+				d, err := c.Device(cc.Device.Name)
+				if err != nil {
+					t.Fatalf("failed to get device: %v", err)
+				}
+
+				if diff := cmp.Diff(cc.Device, d); diff != "" {
+					t.Fatalf("unexpected device (-want +got):\n%s", diff)
+				}
+
+				// Deferring allowed IPs must produce the same peers once
+				// they are decoded.
+				c.SetLazyAllowedIPs(true)
+
+				d, err = c.Device(cc.Device.Name)
+				if err != nil {
+					t.Fatalf("failed to get lazy device: %v", err)
+				}
+
+				for i := range d.Peers {
+					p := &d.Peers[i]
+					if len(p.AllowedIPs) > 0 {
+						t.Fatalf("peer %d: allowed IPs were decoded eagerly", i)
+					}
+
+					ipns, err := p.LoadAllowedIPs()
+					if err != nil {
+						t.Fatalf("peer %d: failed to decode allowed IPs: %v", i, err)
+					}
+
+					p.AllowedIPs, p.LazyAllowedIPs = ipns, nil
+				}
+
+				if diff := cmp.Diff(cc.Device, d); diff != "" {
+					t.Fatalf("unexpected lazy device (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
 func Test_parseTimespec(t *testing.T) {
 	var zero [sizeofTimespec64]byte
 
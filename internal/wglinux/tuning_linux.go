@@ -0,0 +1,367 @@
+//go:build linux
+// +build linux
+
+package wglinux
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+// Traffic control constants which are not provided by package unix.
+const (
+	sizeofTcMsg = 20
+	tcaKind     = 1
+	tcHRoot     = 0xffffffff
+)
+
+// LinkQueue returns the kind of the root queueing discipline and the length
+// of the transmit queue of the network interface specified by name.
+func LinkQueue(name string) (qdisc string, txqlen int, err error) {
+	l, err := getLink(dialRTNL, name)
+	if err != nil {
+		return "", 0, fmt.Errorf("wglinux: failed to get link %q: %w", name, err)
+	}
+
+	return l.qdisc, int(l.txqlen), nil
+}
+
+// SetLinkTxQueueLen sets the length of the transmit queue of the network
+// interface specified by name, as with "ip link set name txqueuelen n".
+func SetLinkTxQueueLen(name string, n int) error {
+	return setLinkTxQueueLen(dialRTNL, name, n)
+}
+
+// setLinkTxQueueLen implements SetLinkTxQueueLen using an rtnetlink
+// connection from dial.
+func setLinkTxQueueLen(dial func() (*netlink.Conn, error), name string, n int) error {
+	if n < 0 || n > math.MaxUint32 {
+		return fmt.Errorf("wglinux: invalid transmit queue length %d", n)
+	}
+
+	l, err := getLink(dial, name)
+	if err != nil {
+		return fmt.Errorf("wglinux: failed to get link %q: %w", name, err)
+	}
+
+	attrs, err := netlink.MarshalAttributes([]netlink.Attribute{{
+		Type: unix.IFLA_TXQLEN,
+		Data: nlenc.Uint32Bytes(uint32(n)),
+	}})
+	if err != nil {
+		return err
+	}
+
+	if _, err := executeRTNL(dial, unix.RTM_NEWLINK, netlink.Request|netlink.Acknowledge, l.index, attrs); err != nil {
+		return fmt.Errorf("wglinux: failed to set transmit queue length of %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// SetLinkQdisc replaces the root queueing discipline of the network interface
+// specified by name with one of the specified kind and its default
+// parameters, as with "tc qdisc replace dev name root kind".
+func SetLinkQdisc(name, kind string) error {
+	return setLinkQdisc(dialRTNL, name, kind)
+}
+
+// setLinkQdisc implements SetLinkQdisc using an rtnetlink connection from
+// dial.
+func setLinkQdisc(dial func() (*netlink.Conn, error), name, kind string) error {
+	if kind == "" {
+		return errors.New("wglinux: queueing discipline kind must not be empty")
+	}
+
+	l, err := getLink(dial, name)
+	if err != nil {
+		return fmt.Errorf("wglinux: failed to get link %q: %w", name, err)
+	}
+
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// struct tcmsg: family and padding, ifindex, handle, parent, and info.
+	tcm := make([]byte, sizeofTcMsg)
+	nlenc.PutInt32(tcm[4:8], l.index)
+	nlenc.PutUint32(tcm[12:16], tcHRoot)
+
+	attrs, err := netlink.MarshalAttributes([]netlink.Attribute{{
+		Type: tcaKind,
+		Data: nlenc.Bytes(kind),
+	}})
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Execute(netlink.Message{
+		Header: netlink.Header{
+			Type:  unix.RTM_NEWQDISC,
+			Flags: netlink.Request | netlink.Acknowledge | netlink.Create | netlink.Replace,
+		},
+		Data: append(tcm, attrs...),
+	})
+	if err != nil {
+		return fmt.Errorf("wglinux: failed to set queueing discipline of %q to %q: %w", name, kind, err)
+	}
+
+	return nil
+}
+
+// LinkFeatures returns the state of each offload feature of the network
+// interface specified by name which is enabled or can be changed, keyed by
+// its ethtool(8) name such as "rx-udp-gro-forwarding". The ethtool netlink
+// interface of Linux 5.6 or later is required.
+func LinkFeatures(name string) (map[string]bool, error) {
+	c, f, err := dialEthtool()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	return linkFeatures(c, f, name)
+}
+
+// SetLinkFeatures enables or disables each of the named offload features of
+// the network interface specified by name, as with "ethtool -K". An error is
+// returned if any feature could not be changed as requested.
+func SetLinkFeatures(name string, features map[string]bool) error {
+	c, f, err := dialEthtool()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return setLinkFeatures(c, f, name, features)
+}
+
+// dialEthtool opens a generic netlink connection to the ethtool family.
+func dialEthtool() (*genetlink.Conn, genetlink.Family, error) {
+	c, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, genetlink.Family{}, err
+	}
+
+	f, err := c.GetFamily(unix.ETHTOOL_GENL_NAME)
+	if err != nil {
+		_ = c.Close()
+		return nil, genetlink.Family{}, fmt.Errorf("wglinux: ethtool netlink interface is not available: %w", err)
+	}
+
+	return c, f, nil
+}
+
+// linkFeatures implements LinkFeatures using the ethtool family f.
+func linkFeatures(c *genetlink.Conn, f genetlink.Family, name string) (map[string]bool, error) {
+	ae := netlink.NewAttributeEncoder()
+	encodeEthtoolHeader(ae, name, 0)
+
+	msgs, err := executeEthtool(c, f, unix.ETHTOOL_MSG_FEATURES_GET, netlink.Request, ae)
+	if err != nil {
+		return nil, fmt.Errorf("wglinux: failed to get features of %q: %w", name, err)
+	}
+	if len(msgs) != 1 {
+		return nil, fmt.Errorf("wglinux: unexpected ethtool reply for %q", name)
+	}
+
+	ad, err := netlink.NewAttributeDecoder(msgs[0].Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var hw, active map[string]bool
+	for ad.Next() {
+		switch ad.Type() {
+		case unix.ETHTOOL_A_FEATURES_HW:
+			hw, err = parseBitset(ad.Bytes())
+		case unix.ETHTOOL_A_FEATURES_ACTIVE:
+			active, err = parseBitset(ad.Bytes())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := ad.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]bool, len(hw)+len(active))
+	for name := range hw {
+		out[name] = active[name]
+	}
+	for name := range active {
+		out[name] = true
+	}
+
+	return out, nil
+}
+
+// setLinkFeatures implements SetLinkFeatures using the ethtool family f.
+func setLinkFeatures(c *genetlink.Conn, f genetlink.Family, name string, features map[string]bool) error {
+	if len(features) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(features))
+	for n := range features {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	ae := netlink.NewAttributeEncoder()
+	encodeEthtoolHeader(ae, name, unix.ETHTOOL_FLAG_OMIT_REPLY)
+	ae.Nested(unix.ETHTOOL_A_FEATURES_WANTED, func(nae *netlink.AttributeEncoder) error {
+		// Without ETHTOOL_A_BITSET_NOMASK, only the listed bits are changed.
+		nae.Nested(unix.ETHTOOL_A_BITSET_BITS, func(nae *netlink.AttributeEncoder) error {
+			for _, n := range names {
+				n := n
+				nae.Nested(unix.ETHTOOL_A_BITSET_BITS_BIT, func(nae *netlink.AttributeEncoder) error {
+					nae.String(unix.ETHTOOL_A_BITSET_BIT_NAME, n)
+					nae.Flag(unix.ETHTOOL_A_BITSET_BIT_VALUE, features[n])
+					return nil
+				})
+			}
+			return nil
+		})
+		return nil
+	})
+
+	if _, err := executeEthtool(c, f, unix.ETHTOOL_MSG_FEATURES_SET, netlink.Request|netlink.Acknowledge, ae); err != nil {
+		return fmt.Errorf("wglinux: failed to set features of %q: %w", name, err)
+	}
+
+	// The kernel accepts requests for features which are fixed or depend on
+	// others, so check which took effect.
+	got, err := linkFeatures(c, f, name)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, n := range names {
+		if got[n] != features[n] {
+			failed = append(failed, n)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("wglinux: features of %q could not be changed: %s", name, strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// encodeEthtoolHeader encodes the ethtool request header for the network
+// interface specified by name, with the specified ETHTOOL_FLAG_* flags.
+func encodeEthtoolHeader(ae *netlink.AttributeEncoder, name string, flags uint32) {
+	ae.Nested(unix.ETHTOOL_A_FEATURES_HEADER, func(nae *netlink.AttributeEncoder) error {
+		nae.String(unix.ETHTOOL_A_HEADER_DEV_NAME, name)
+		if flags != 0 {
+			nae.Uint32(unix.ETHTOOL_A_HEADER_FLAGS, flags)
+		}
+		return nil
+	})
+}
+
+// executeEthtool executes a single ethtool request with the specified command,
+// header flags, and attributes. Errors indicating that no such network
+// interface exists are converted to os.ErrNotExist.
+func executeEthtool(c *genetlink.Conn, f genetlink.Family, command uint8, flags netlink.HeaderFlags, ae *netlink.AttributeEncoder) ([]genetlink.Message, error) {
+	b, err := ae.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := c.Execute(genetlink.Message{
+		Header: genetlink.Header{
+			Command: command,
+			Version: f.Version,
+		},
+		Data: b,
+	}, f.ID, flags)
+	if err == nil {
+		return msgs, nil
+	}
+
+	var oerr *netlink.OpError
+	if errors.As(err, &oerr) && oerr.Err == unix.ENODEV {
+		return nil, os.ErrNotExist
+	}
+
+	return nil, err
+}
+
+// parseBitset returns the names of the bits which are set in an ethtool
+// bitset in its verbose form.
+func parseBitset(b []byte) (map[string]bool, error) {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return nil, err
+	}
+
+	type bit struct {
+		name  string
+		value bool
+	}
+
+	var (
+		nomask bool
+		bits   []bit
+	)
+
+	for ad.Next() {
+		switch ad.Type() {
+		case unix.ETHTOOL_A_BITSET_NOMASK:
+			nomask = true
+		case unix.ETHTOOL_A_BITSET_BITS:
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				for nad.Next() {
+					if nad.Type() != unix.ETHTOOL_A_BITSET_BITS_BIT {
+						continue
+					}
+
+					nad.Nested(func(bad *netlink.AttributeDecoder) error {
+						var b bit
+						for bad.Next() {
+							switch bad.Type() {
+							case unix.ETHTOOL_A_BITSET_BIT_NAME:
+								b.name = bad.String()
+							case unix.ETHTOOL_A_BITSET_BIT_VALUE:
+								b.value = true
+							}
+						}
+
+						bits = append(bits, b)
+						return nil
+					})
+				}
+
+				return nil
+			})
+		}
+	}
+	if err := ad.Err(); err != nil {
+		return nil, err
+	}
+
+	// Without a mask, only the bits which are set are listed.
+	out := make(map[string]bool, len(bits))
+	for _, b := range bits {
+		if nomask || b.value {
+			out[b.name] = true
+		}
+	}
+
+	return out, nil
+}
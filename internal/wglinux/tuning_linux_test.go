@@ -0,0 +1,332 @@
+//go:build linux
+// +build linux
+
+package wglinux
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/genetlink/genltest"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/mdlayher/netlink/nltest"
+	"golang.org/x/sys/unix"
+)
+
+func Test_setLinkTxQueueLen(t *testing.T) {
+	const index = 7
+
+	var txqlen uint32
+	dial := func() (*netlink.Conn, error) {
+		return nltest.Dial(func(reqs []netlink.Message) ([]netlink.Message, error) {
+			req := reqs[0]
+			switch req.Header.Type {
+			case unix.RTM_GETLINK:
+				return testLinkReply(req, index), nil
+			case unix.RTM_NEWLINK:
+				if diff := cmp.Diff(int32(index), nlenc.Int32(req.Data[4:8])); diff != "" {
+					t.Fatalf("unexpected interface index (-want +got):\n%s", diff)
+				}
+
+				attrs, err := netlink.UnmarshalAttributes(req.Data[unix.SizeofIfInfomsg:])
+				if err != nil {
+					t.Fatalf("failed to unmarshal attributes: %v", err)
+				}
+				if len(attrs) != 1 || attrs[0].Type != unix.IFLA_TXQLEN {
+					t.Fatalf("unexpected attributes: %+v", attrs)
+				}
+
+				txqlen = nlenc.Uint32(attrs[0].Data)
+				return nltest.Error(0, reqs)
+			default:
+				t.Fatalf("unexpected message type: %d", req.Header.Type)
+				return nil, nil
+			}
+		}), nil
+	}
+
+	if err := setLinkTxQueueLen(dial, "wg0", 500); err != nil {
+		t.Fatalf("failed to set transmit queue length: %v", err)
+	}
+	if diff := cmp.Diff(uint32(500), txqlen); diff != "" {
+		t.Fatalf("unexpected transmit queue length (-want +got):\n%s", diff)
+	}
+
+	if err := setLinkTxQueueLen(dial, "wg0", -1); err == nil {
+		t.Fatal("expected an error for a negative transmit queue length")
+	}
+}
+
+func Test_setLinkQdisc(t *testing.T) {
+	const index = 7
+
+	var (
+		tcm  []byte
+		kind string
+	)
+
+	dial := func() (*netlink.Conn, error) {
+		return nltest.Dial(func(reqs []netlink.Message) ([]netlink.Message, error) {
+			req := reqs[0]
+			switch req.Header.Type {
+			case unix.RTM_GETLINK:
+				return testLinkReply(req, index), nil
+			case unix.RTM_NEWQDISC:
+				want := netlink.Request | netlink.Acknowledge | netlink.Create | netlink.Replace
+				if diff := cmp.Diff(want, req.Header.Flags); diff != "" {
+					t.Fatalf("unexpected flags (-want +got):\n%s", diff)
+				}
+
+				attrs, err := netlink.UnmarshalAttributes(req.Data[sizeofTcMsg:])
+				if err != nil {
+					t.Fatalf("failed to unmarshal attributes: %v", err)
+				}
+				if len(attrs) != 1 || attrs[0].Type != tcaKind {
+					t.Fatalf("unexpected attributes: %+v", attrs)
+				}
+
+				tcm = req.Data[:sizeofTcMsg]
+				kind = nlenc.String(attrs[0].Data)
+				return nltest.Error(0, reqs)
+			default:
+				t.Fatalf("unexpected message type: %d", req.Header.Type)
+				return nil, nil
+			}
+		}), nil
+	}
+
+	if err := setLinkQdisc(dial, "wg0", "fq_codel"); err != nil {
+		t.Fatalf("failed to set queueing discipline: %v", err)
+	}
+
+	if diff := cmp.Diff("fq_codel", kind); diff != "" {
+		t.Fatalf("unexpected kind (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(int32(index), nlenc.Int32(tcm[4:8])); diff != "" {
+		t.Fatalf("unexpected interface index (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(uint32(tcHRoot), nlenc.Uint32(tcm[12:16])); diff != "" {
+		t.Fatalf("unexpected parent (-want +got):\n%s", diff)
+	}
+}
+
+func Test_linkFeatures(t *testing.T) {
+	c := testEthtoolConn(t, func(_ map[string]bool) {
+		t.Fatal("unexpected set request")
+	})
+
+	got, err := linkFeatures(c, testEthtoolFamily, "eth0")
+	if err != nil {
+		t.Fatalf("failed to get features: %v", err)
+	}
+
+	want := map[string]bool{
+		"rx-gro":                 true,
+		"rx-udp-gro-forwarding":  false,
+		"tx-checksum-ip-generic": true,
+		"highdma":                true,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected features (-want +got):\n%s", diff)
+	}
+
+	if _, err := linkFeatures(c, testEthtoolFamily, "nope0"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
+
+func Test_setLinkFeatures(t *testing.T) {
+	var wanted map[string]bool
+	c := testEthtoolConn(t, func(w map[string]bool) {
+		wanted = w
+	})
+
+	features := map[string]bool{
+		"rx-gro":                false,
+		"rx-udp-gro-forwarding": true,
+	}
+
+	// The test kernel never changes any features, so both are reported as
+	// failed.
+	err := setLinkFeatures(c, testEthtoolFamily, "eth0", features)
+	if err == nil {
+		t.Fatal("expected an error for features which were not changed")
+	}
+	if diff := cmp.Diff(`wglinux: features of "eth0" could not be changed: rx-gro, rx-udp-gro-forwarding`, err.Error()); diff != "" {
+		t.Fatalf("unexpected error (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(features, wanted); diff != "" {
+		t.Fatalf("unexpected wanted features (-want +got):\n%s", diff)
+	}
+
+	if err := setLinkFeatures(c, testEthtoolFamily, "eth0", map[string]bool{"highdma": true}); err != nil {
+		t.Fatalf("failed to set features: %v", err)
+	}
+}
+
+var testEthtoolFamily = genetlink.Family{ID: 20, Name: unix.ETHTOOL_GENL_NAME, Version: unix.ETHTOOL_GENL_VERSION}
+
+// testEthtoolConn returns a connection to a test ethtool family which serves
+// a fixed set of features for eth0, and passes the features of each set
+// request to set.
+func testEthtoolConn(t *testing.T, set func(map[string]bool)) *genetlink.Conn {
+	t.Helper()
+
+	return genltest.Dial(func(greq genetlink.Message, nreq netlink.Message) ([]genetlink.Message, error) {
+		var (
+			name   string
+			wanted map[string]bool
+		)
+
+		ad, err := netlink.NewAttributeDecoder(greq.Data)
+		if err != nil {
+			t.Fatalf("failed to create attribute decoder: %v", err)
+		}
+		for ad.Next() {
+			switch ad.Type() {
+			case unix.ETHTOOL_A_FEATURES_HEADER:
+				ad.Nested(func(nad *netlink.AttributeDecoder) error {
+					for nad.Next() {
+						if nad.Type() == unix.ETHTOOL_A_HEADER_DEV_NAME {
+							name = nad.String()
+						}
+					}
+					return nil
+				})
+			case unix.ETHTOOL_A_FEATURES_WANTED:
+				wanted = testParseWanted(t, ad.Bytes())
+			}
+		}
+		if err := ad.Err(); err != nil {
+			t.Fatalf("failed to decode attributes: %v", err)
+		}
+
+		if name != "eth0" {
+			return nil, genltest.Error(int(unix.ENODEV))
+		}
+
+		switch greq.Header.Command {
+		case unix.ETHTOOL_MSG_FEATURES_GET:
+			ae := netlink.NewAttributeEncoder()
+			ae.Nested(unix.ETHTOOL_A_FEATURES_HW, func(nae *netlink.AttributeEncoder) error {
+				testEncodeBitset(nae, true, map[string]bool{
+					"rx-gro":                true,
+					"rx-udp-gro-forwarding": true,
+				})
+				return nil
+			})
+			ae.Nested(unix.ETHTOOL_A_FEATURES_ACTIVE, func(nae *netlink.AttributeEncoder) error {
+				testEncodeBitset(nae, false, map[string]bool{
+					"rx-gro":                 true,
+					"rx-udp-gro-forwarding":  false,
+					"tx-checksum-ip-generic": true,
+					"highdma":                true,
+				})
+				return nil
+			})
+
+			b, err := ae.Encode()
+			if err != nil {
+				t.Fatalf("failed to encode attributes: %v", err)
+			}
+
+			return []genetlink.Message{{Data: b}}, nil
+		case unix.ETHTOOL_MSG_FEATURES_SET:
+			set(wanted)
+			return nil, genltest.Error(0)
+		default:
+			t.Fatalf("unexpected command: %d", greq.Header.Command)
+			return nil, nil
+		}
+	})
+}
+
+// testEncodeBitset encodes bits as an ethtool bitset in its verbose form,
+// listing only the bits which are set if nomask is true.
+func testEncodeBitset(ae *netlink.AttributeEncoder, nomask bool, bits map[string]bool) {
+	if nomask {
+		ae.Flag(unix.ETHTOOL_A_BITSET_NOMASK, true)
+	}
+
+	ae.Nested(unix.ETHTOOL_A_BITSET_BITS, func(nae *netlink.AttributeEncoder) error {
+		for name, value := range bits {
+			if nomask && !value {
+				continue
+			}
+
+			name, value := name, value
+			nae.Nested(unix.ETHTOOL_A_BITSET_BITS_BIT, func(nae *netlink.AttributeEncoder) error {
+				nae.String(unix.ETHTOOL_A_BITSET_BIT_NAME, name)
+				nae.Flag(unix.ETHTOOL_A_BITSET_BIT_VALUE, value)
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// testParseWanted returns the bits of an ethtool bitset in its verbose form
+// with a mask, and whether each is set.
+func testParseWanted(t *testing.T, b []byte) map[string]bool {
+	t.Helper()
+
+	bits := make(map[string]bool)
+
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		t.Fatalf("failed to create attribute decoder: %v", err)
+	}
+	for ad.Next() {
+		if ad.Type() != unix.ETHTOOL_A_BITSET_BITS {
+			t.Fatalf("unexpected bitset attribute: %d", ad.Type())
+		}
+
+		ad.Nested(func(nad *netlink.AttributeDecoder) error {
+			for nad.Next() {
+				nad.Nested(func(bad *netlink.AttributeDecoder) error {
+					var (
+						name  string
+						value bool
+					)
+					for bad.Next() {
+						switch bad.Type() {
+						case unix.ETHTOOL_A_BITSET_BIT_NAME:
+							name = bad.String()
+						case unix.ETHTOOL_A_BITSET_BIT_VALUE:
+							value = true
+						}
+					}
+
+					bits[name] = value
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+	if err := ad.Err(); err != nil {
+		t.Fatalf("failed to decode attributes: %v", err)
+	}
+
+	return bits
+}
+
+// testLinkReply returns the reply to an RTM_GETLINK request for a link with
+// the specified index.
+func testLinkReply(req netlink.Message, index int32) []netlink.Message {
+	ifi := make([]byte, unix.SizeofIfInfomsg)
+	nlenc.PutInt32(ifi[4:8], index)
+
+	return []netlink.Message{{
+		Header: netlink.Header{
+			Type:     unix.RTM_NEWLINK,
+			Sequence: req.Header.Sequence,
+			PID:      req.Header.PID,
+		},
+		Data: ifi,
+	}}
+}
@@ -10,6 +10,7 @@ import (
 	"net"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -22,7 +23,10 @@ import (
 // ifGroupWG is the WireGuard interface group name passed to the kernel.
 var ifGroupWG = [16]byte{0: 'w', 1: 'g'}
 
-var _ wginternal.Client = &Client{}
+var (
+	_ wginternal.Client = &Client{}
+	_ wginternal.Typer  = &Client{}
+)
 
 // A Client provides access to OpenBSD WireGuard ioctl information.
 type Client struct {
@@ -31,6 +35,11 @@ type Client struct {
 	close           func() error
 	ioctlIfgroupreq func(ifg *wgh.Ifgroupreq) error
 	ioctlWGDataIO   func(data *wgh.WGDataIO) error
+
+	// mu guards buf, which is reused across calls to Device to avoid both
+	// allocations and a second system call to size the buffer.
+	mu  sync.Mutex
+	buf []byte
 }
 
 // New creates a new Client and returns whether or not the ioctl interface
@@ -55,6 +64,9 @@ func New() (*Client, bool, error) {
 	}, true, nil
 }
 
+// DeviceType implements wginternal.Typer.
+func (c *Client) DeviceType() wgtypes.DeviceType { return wgtypes.OpenBSDKernel }
+
 // Close implements wginternal.Client.
 func (c *Client) Close() error {
 	return c.close()
@@ -113,15 +125,21 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 		return nil, err
 	}
 
-	// First, specify the name of the device and determine how much memory
-	// must be allocated in order to store the WGInterfaceIO structure and
-	// any trailing WGPeerIO/WGAIPIOs.
-	data := wgh.WGDataIO{Name: dname}
+	// Specify the name of the device and lend the kernel our buffer, which
+	// is typically large enough from a previous call, so most lookups only
+	// need a single system call. The kernel always reports the number of
+	// bytes required to store the WGInterfaceIO structure and any trailing
+	// WGPeerIO/WGAIPIOs in data.Size.
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	// TODO: consider preallocating some memory to avoid a second system call
-	// if it proves to be a concern.
-	var mem []byte
+	data := wgh.WGDataIO{Name: dname}
 	for {
+		if len(c.buf) > 0 {
+			data.Size = uint64(len(c.buf))
+			data.Interface = (*wgh.WGInterfaceIO)(unsafe.Pointer(&c.buf[0]))
+		}
+
 		if err := c.ioctlWGDataIO(&data); err != nil {
 			// ioctl functions always return a wrapped unix.Errno value.
 			// Conform to the wgctrl contract by unwrapping some values:
@@ -136,33 +154,33 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 			}
 		}
 
-		if len(mem) >= int(data.Size) {
-			// Allocated enough memory!
-			break
-		}
-
 		// Ensure we don't unsafe cast into uninitialized memory. We need at very
 		// least a single WGInterfaceIO with no peers.
 		if data.Size < wgh.SizeofWGInterfaceIO {
 			return nil, fmt.Errorf("wgopenbsd: kernel returned unexpected number of bytes for WGInterfaceIO: %d", data.Size)
 		}
 
-		// Allocate the appropriate amount of memory and point the kernel at
-		// the first byte of our slice's backing array. When the loop continues,
-		// we will check if we've allocated enough memory.
-		mem = make([]byte, data.Size)
-		data.Interface = (*wgh.WGInterfaceIO)(unsafe.Pointer(&mem[0]))
+		if len(c.buf) > 0 && uint64(len(c.buf)) >= data.Size {
+			// The kernel populated our buffer.
+			break
+		}
+
+		// Grow the buffer with some headroom so that peers added before the
+		// next call don't immediately require another round trip.
+		c.buf = make([]byte, data.Size+data.Size/8)
 	}
 
 	return parseDevice(name, data.Interface)
 }
 
 // parseDevice unpacks a Device from ifio, along with its associated peers
-// and their allowed IPs.
+// and their allowed IPs. The returned Device does not reference the memory
+// of ifio, so the memory may be reused afterwards.
 func parseDevice(name string, ifio *wgh.WGInterfaceIO) (*wgtypes.Device, error) {
 	d := &wgtypes.Device{
-		Name: name,
-		Type: wgtypes.OpenBSDKernel,
+		Name:  name,
+		Index: wginternal.InterfaceIndex(name),
+		Type:  wgtypes.OpenBSDKernel,
 	}
 
 	// The kernel populates ifio.Flags to indicate which fields are present.
@@ -284,15 +302,22 @@ func parsePeer(pio *wgh.WGPeerIO) wgtypes.Peer {
 
 // parseAllowedIP unpacks a net.IPNet from a WGAIP structure.
 func parseAllowedIP(aip *wgh.WGAIPIO) net.IPNet {
+	// Copy the addresses out of the kernel buffer, which is reused.
 	switch aip.Af {
 	case unix.AF_INET:
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, aip.Addr[:net.IPv4len])
+
 		return net.IPNet{
-			IP:   net.IP(aip.Addr[:net.IPv4len]),
+			IP:   ip,
 			Mask: net.CIDRMask(int(aip.Cidr), 32),
 		}
 	case unix.AF_INET6:
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, aip.Addr[:])
+
 		return net.IPNet{
-			IP:   net.IP(aip.Addr[:]),
+			IP:   ip,
 			Mask: net.CIDRMask(int(aip.Cidr), 128),
 		}
 	default:
@@ -53,19 +53,16 @@ func TestClientDevices(t *testing.T) {
 		return nil
 	}
 
-	// TODO(mdlayher): add a test case where the data.Size field changes between
-	// call 1 and 2, so the caller must loop again to determine how much memory
-	// to allocate for the memory slice.
-
 	var wgIOCalls int
 	wgDataIOFunc := func(data *wgh.WGDataIO) error {
-		// Expect two calls per device, where the first call indicates the
-		// number of bytes to populate, and the second would normally populate
-		// the caller's memory.
+		// Expect two calls for the first device, where the first call
+		// indicates the number of bytes to populate, and the second would
+		// normally populate the caller's memory. The second device reuses the
+		// caller's memory, which is already large enough.
 		switch wgIOCalls {
 		case 0, 2:
 			data.Size = wgh.SizeofWGInterfaceIO
-		case 1, 3:
+		case 1:
 			// No-op, nothing to fill out.
 		default:
 			t.Fatal("too many calls to ioctlWGDataIO")
@@ -262,6 +259,91 @@ func TestClientDeviceBasic(t *testing.T) {
 	}
 }
 
+func TestClientDeviceCaptures(t *testing.T) {
+	if wgh.SizeofWGInterfaceIO != 0x50 || wgh.SizeofWGPeerIO != 0x90 || wgh.SizeofWGAIPIO != 0x18 {
+		t.Skip("skipping, captures use the structure layout of 64-bit platforms")
+	}
+
+	const device = "testwg0"
+
+	for _, cc := range wgtest.CapturesFrom(wgtest.SourceOpenBSD) {
+		cc := cc
+		t.Run(cc.Name, func(t *testing.T) {
+			c := &Client{
+				ioctlIfgroupreq: func(_ *wgh.Ifgroupreq) error {
+					panic("no calls to Client.Devices, should not be called")
+				},
+				ioctlWGDataIO: func(data *wgh.WGDataIO) error {
+					// Copy the capture into the caller's buffer once it is
+					// large enough, as the kernel would.
+					if data.Size >= uint64(len(cc.IOCtl)) {
+						b := unsafe.Slice((*byte)(unsafe.Pointer(data.Interface)), data.Size)
+						copy(b, cc.IOCtl)
+					}
+
+					data.Size = uint64(len(cc.IOCtl))
+					return nil
+				},
+			}
+
+			d, err := c.Device(device)
+			if err != nil {
+				t.Fatalf("failed to get device: %v", err)
+			}
+
+			// The ioctl does not report the device name, so the capture's
+			// device is requested as device.
+			want := cc.Device
+			want.Name = device
+
+			if diff := cmp.Diff(want, d); diff != "" {
+				t.Fatalf("unexpected device (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientDeviceGrowsBuffer(t *testing.T) {
+	// The size reported by the kernel for each call, which grows after the
+	// third call as if peers were added to the device.
+	sizes := []uint64{
+		wgh.SizeofWGInterfaceIO,
+		wgh.SizeofWGInterfaceIO,
+		wgh.SizeofWGInterfaceIO,
+		wgh.SizeofWGInterfaceIO + 2*wgh.SizeofWGPeerIO,
+		wgh.SizeofWGInterfaceIO + 2*wgh.SizeofWGPeerIO,
+	}
+
+	var calls int
+	c := &Client{
+		ioctlWGDataIO: func(data *wgh.WGDataIO) error {
+			if calls >= len(sizes) {
+				t.Fatal("too many calls to ioctlWGDataIO")
+			}
+
+			if calls > 0 && data.Interface == nil {
+				t.Fatal("caller did not reuse its buffer")
+			}
+
+			data.Size = sizes[calls]
+			calls++
+			return nil
+		},
+	}
+
+	// The first lookup sizes the buffer, the second reuses it, and the third
+	// grows it because the kernel requires more memory.
+	for i, want := range []int{2, 3, 5} {
+		if _, err := c.Device("wg0"); err != nil {
+			t.Fatalf("failed to get device %d: %v", i, err)
+		}
+
+		if diff := cmp.Diff(want, calls); diff != "" {
+			t.Fatalf("unexpected number of calls after device %d (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
 func TestClientDeviceNotExist(t *testing.T) {
 	tests := []struct {
 		name string
@@ -309,6 +391,51 @@ func TestClientDeviceWrongMemorySize(t *testing.T) {
 	t.Logf("err: %v", err)
 }
 
+func TestParsePeerKeepalive(t *testing.T) {
+	// The driver is read-only, so only the decoding of keepalive intervals
+	// reported by the kernel can be checked.
+	tests := []struct {
+		name  string
+		flags int32
+		pka   uint16
+		want  time.Duration
+	}{
+		{
+			name: "unset",
+			pka:  25,
+		},
+		{
+			name:  "disabled",
+			flags: wgh.WG_PEER_HAS_PKA,
+		},
+		{
+			name:  "seconds",
+			flags: wgh.WG_PEER_HAS_PKA,
+			pka:   25,
+			want:  25 * time.Second,
+		},
+		{
+			name:  "maximum",
+			flags: wgh.WG_PEER_HAS_PKA,
+			pka:   65535,
+			want:  65535 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parsePeer(&wgh.WGPeerIO{
+				Flags: tt.flags,
+				Pka:   tt.pka,
+			})
+
+			if diff := cmp.Diff(tt.want, p.PersistentKeepaliveInterval); diff != "" {
+				t.Fatalf("unexpected keepalive interval (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 // pack packs a WGInterfaceIO and trailing WGPeerIO/WGAIPIO values in a
 // contiguous byte slice to emulate the kernel module output.
 func pack(ifio *wgh.WGInterfaceIO, values ...interface{}) []byte {
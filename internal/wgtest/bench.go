@@ -0,0 +1,46 @@
+package wgtest
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// BenchPeers are the peer counts used by benchmarks, so that results can be
+// compared across WireGuard implementations.
+var BenchPeers = []int{1, 100, 1000}
+
+// BenchConfig returns a configuration with n peers, each with an endpoint,
+// a persistent keepalive interval, and an IPv4 and IPv6 allowed IP. It
+// replaces all peers, so applying it repeatedly keeps a device the same size.
+func BenchConfig(n int) wgtypes.Config {
+	var (
+		priv      = MustPrivateKey()
+		port      = 51820
+		keepalive = 25 * time.Second
+	)
+
+	cfg := wgtypes.Config{
+		PrivateKey:   &priv,
+		ListenPort:   &port,
+		ReplacePeers: true,
+		Peers:        make([]wgtypes.PeerConfig, 0, n),
+	}
+
+	for i := 0; i < n; i++ {
+		cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{
+			PublicKey:                   MustPublicKey(),
+			Endpoint:                    &net.UDPAddr{IP: net.IPv4(192, 0, 2, byte(i)), Port: 51820},
+			PersistentKeepaliveInterval: &keepalive,
+			ReplaceAllowedIPs:           true,
+			AllowedIPs: []net.IPNet{
+				MustCIDR(fmt.Sprintf("10.%d.%d.%d/32", byte(i>>16), byte(i>>8), byte(i))),
+				MustCIDR(fmt.Sprintf("fd00::%x/128", i)),
+			},
+		})
+	}
+
+	return cfg
+}
@@ -0,0 +1,385 @@
+package wgtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// captureFS holds the capture corpus. Each capture is stored in a file named
+// for its Source, as captures/<source>/<name>.hex for netlink and ioctl
+// captures, or captures/<source>/<name>.uapi for UAPI transcripts.
+//
+// A .hex file holds hexadecimal bytes, in which whitespace and comments
+// beginning with '#' are ignored. In netlink captures, each message is
+// separated from the next by a line containing "---".
+//
+//go:embed captures
+var captureFS embed.FS
+
+// A Source is a WireGuard implementation from which a Capture was taken.
+type Source string
+
+// Possible Source values.
+const (
+	// SourceLinux is the Linux kernel's WireGuard implementation, which is
+	// configured using generic netlink.
+	SourceLinux Source = "linux"
+
+	// SourceAmneziaLinux is the AmneziaWG Linux kernel module, which is
+	// configured using generic netlink.
+	SourceAmneziaLinux Source = "amneziawg-linux"
+
+	// SourceWireGuardGo is wireguard-go, which is configured using the
+	// userspace configuration protocol (UAPI).
+	SourceWireGuardGo Source = "wireguard-go"
+
+	// SourceAmneziaGo is amneziawg-go, which is configured using the
+	// userspace configuration protocol (UAPI).
+	SourceAmneziaGo Source = "amneziawg-go"
+
+	// SourceOpenBSD is OpenBSD's WireGuard implementation, which is
+	// configured using ioctls.
+	SourceOpenBSD Source = "openbsd"
+)
+
+// A Capture is the data returned by a WireGuard implementation when it is
+// asked for a device, and the device which should be parsed from it. Exactly
+// one of Messages, UAPI, and IOCtl is set, depending on the Source.
+//
+// Keys, addresses, and counters in captures are anonymized: keys are derived
+// from fixed labels, and addresses are from the ranges reserved for
+// documentation and private use.
+type Capture struct {
+	// Name identifies the capture, such as "linux/peers".
+	Name string
+
+	// Source is the implementation from which the capture was taken.
+	Source Source
+
+	// Messages holds the payload of each generic netlink message, following
+	// the generic netlink header, in the reply to a WG_CMD_GET_DEVICE dump
+	// request. Set for SourceLinux and SourceAmneziaLinux.
+	Messages [][]byte
+
+	// UAPI holds the reply to a "get=1" operation, up to and including the
+	// blank line which ends it. Set for SourceWireGuardGo and
+	// SourceAmneziaGo.
+	UAPI []byte
+
+	// IOCtl holds the buffer filled by the SIOCGWG ioctl, in the layout used
+	// on 64-bit platforms. Set for SourceOpenBSD.
+	IOCtl []byte
+
+	// Device is the device described by the capture. Name and Type are set
+	// as a wgctrl.Client would set them. Index is only set if the capture
+	// includes it.
+	Device *wgtypes.Device
+}
+
+// Captures returns the capture corpus, ordered by name. Each call returns new
+// copies of the captures, which the caller may modify.
+func Captures() []Capture {
+	devices := captureDevices()
+
+	var cs []Capture
+	err := fs.WalkDir(captureFS, "captures", func(p string, de fs.DirEntry, err error) error {
+		if err != nil || de.IsDir() {
+			return err
+		}
+
+		b, err := captureFS.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		ext := path.Ext(p)
+		name := strings.TrimSuffix(strings.TrimPrefix(p, "captures/"), ext)
+
+		d, ok := devices[name]
+		if !ok {
+			panicf("wgtest: no device for capture %q", name)
+		}
+
+		c := Capture{
+			Name:   name,
+			Source: Source(path.Dir(name)),
+			Device: d,
+		}
+
+		switch {
+		case ext == ".uapi":
+			c.UAPI = b
+		case c.Source == SourceOpenBSD:
+			c.IOCtl = parseHex(name, b)[0]
+		default:
+			c.Messages = parseHex(name, b)
+		}
+
+		cs = append(cs, c)
+		return nil
+	})
+	if err != nil {
+		panicf("wgtest: failed to read captures: %v", err)
+	}
+
+	return cs
+}
+
+// CapturesFrom returns the captures taken from src, ordered by name.
+func CapturesFrom(src Source) []Capture {
+	var cs []Capture
+	for _, c := range Captures() {
+		if c.Source == src {
+			cs = append(cs, c)
+		}
+	}
+
+	return cs
+}
+
+// parseHex parses the messages of the .hex capture file b.
+func parseHex(name string, b []byte) [][]byte {
+	var (
+		msgs [][]byte
+		buf  strings.Builder
+	)
+
+	flush := func() {
+		m, err := hex.DecodeString(buf.String())
+		if err != nil {
+			panicf("wgtest: invalid hex in capture %q: %v", name, err)
+		}
+
+		msgs = append(msgs, m)
+		buf.Reset()
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "---" {
+			flush()
+			continue
+		}
+
+		buf.WriteString(strings.Join(strings.Fields(line), ""))
+	}
+	flush()
+
+	return msgs
+}
+
+// captureKey returns the key which replaces a key in the captures, derived
+// from label so that the captures are reproducible. The key is clamped so
+// that it may be used as a private key.
+func captureKey(label string) wgtypes.Key {
+	k := wgtypes.Key(sha256.Sum256([]byte("wgtest capture " + label)))
+	k[0] &= 248
+	k[31] = (k[31] & 127) | 64
+
+	return k
+}
+
+// captureDevices returns the device described by each capture, keyed by
+// capture name.
+func captureDevices() map[string]*wgtypes.Device {
+	var (
+		peerA = captureKey("peer a").PublicKey()
+		peerB = captureKey("peer b").PublicKey()
+		peerC = captureKey("peer c").PublicKey()
+		pskA  = captureKey("psk a")
+
+		endpointA = &net.UDPAddr{IP: net.IPv4(198, 51, 100, 7), Port: 51820}
+		endpointB = &net.UDPAddr{IP: net.ParseIP("2001:db8::17"), Port: 41414}
+
+		handshakeA = time.Unix(1700000000, 250000000)
+
+		amnezia = wgtypes.AdvancedSecurity{
+			JunkPacketCount:            4,
+			JunkPacketMinSize:          40,
+			JunkPacketMaxSize:          70,
+			InitPacketJunkSize:         15,
+			ResponsePacketJunkSize:     68,
+			InitPacketMagicHeader:      1106457265,
+			ResponsePacketMagicHeader:  249455488,
+			UnderloadPacketMagicHeader: 1209847463,
+			TransportPacketMagicHeader: 1646644382,
+		}
+	)
+
+	// device returns a device with the private key derived from label.
+	device := func(label string, d wgtypes.Device) *wgtypes.Device {
+		d.PrivateKey = captureKey(label)
+		d.PublicKey = d.PrivateKey.PublicKey()
+		return &d
+	}
+
+	return map[string]*wgtypes.Device{
+		"linux/empty": {
+			Name:  "wg0",
+			Index: 4,
+			Type:  wgtypes.LinuxKernel,
+		},
+		"linux/peers": device("linux peers", wgtypes.Device{
+			Name:         "wg0",
+			Index:        5,
+			Type:         wgtypes.LinuxKernel,
+			ListenPort:   51820,
+			FirewallMark: 0xca6c,
+			Peers: []wgtypes.Peer{
+				{
+					PublicKey:                   peerA,
+					PresharedKey:                pskA,
+					Endpoint:                    endpointA,
+					PersistentKeepaliveInterval: 25 * time.Second,
+					LastHandshakeTime:           handshakeA,
+					ReceiveBytes:                2259384,
+					TransmitBytes:               148920,
+					AllowedIPs:                  []net.IPNet{MustCIDR("10.8.0.2/32"), MustCIDR("fd00:8::2/128")},
+					ProtocolVersion:             1,
+				},
+				{
+					PublicKey:       peerB,
+					Endpoint:        endpointB,
+					AllowedIPs:      []net.IPNet{MustCIDR("10.8.1.0/24")},
+					ProtocolVersion: 1,
+				},
+				{
+					PublicKey:       peerC,
+					AllowedIPs:      []net.IPNet{},
+					ProtocolVersion: 1,
+				},
+			},
+		}),
+		"linux/split": device("linux split", wgtypes.Device{
+			Name:       "wg1",
+			Index:      6,
+			Type:       wgtypes.LinuxKernel,
+			ListenPort: 51821,
+			Peers: []wgtypes.Peer{
+				{
+					PublicKey:         peerA,
+					PresharedKey:      pskA,
+					Endpoint:          &net.UDPAddr{IP: net.IPv4(203, 0, 113, 5), Port: 51820},
+					LastHandshakeTime: time.Unix(1700000123, 500000000),
+					ReceiveBytes:      148,
+					TransmitBytes:     92,
+					AllowedIPs: []net.IPNet{
+						MustCIDR("10.9.0.0/24"),
+						MustCIDR("10.9.1.0/24"),
+						MustCIDR("10.9.2.0/24"),
+						MustCIDR("10.9.3.0/24"),
+					},
+					ProtocolVersion: 1,
+				},
+				{
+					PublicKey:       peerB,
+					AllowedIPs:      []net.IPNet{MustCIDR("10.9.4.0/24"), MustCIDR("fd00:9::/64")},
+					ProtocolVersion: 1,
+				},
+			},
+		}),
+		"amneziawg-linux/basic": device("amneziawg-linux basic", wgtypes.Device{
+			Name:             "awg0",
+			Index:            7,
+			Type:             wgtypes.LinuxKernel,
+			ListenPort:       51820,
+			AdvancedSecurity: amnezia,
+			Peers: []wgtypes.Peer{{
+				PublicKey:                   peerA,
+				PresharedKey:                pskA,
+				Endpoint:                    endpointA,
+				PersistentKeepaliveInterval: 25 * time.Second,
+				LastHandshakeTime:           handshakeA,
+				ReceiveBytes:                2259384,
+				TransmitBytes:               148920,
+				AllowedIPs:                  []net.IPNet{MustCIDR("0.0.0.0/0"), MustCIDR("::/0")},
+				ProtocolVersion:             1,
+			}},
+		}),
+		"wireguard-go/peers": device("wireguard-go peers", wgtypes.Device{
+			Name:       "wg0",
+			Type:       wgtypes.Userspace,
+			ListenPort: 51820,
+			Peers: []wgtypes.Peer{
+				{
+					PublicKey:                   peerA,
+					PresharedKey:                pskA,
+					Endpoint:                    endpointA,
+					PersistentKeepaliveInterval: 25 * time.Second,
+					LastHandshakeTime:           handshakeA,
+					ReceiveBytes:                2259384,
+					TransmitBytes:               148920,
+					AllowedIPs:                  []net.IPNet{MustCIDR("10.8.0.2/32"), MustCIDR("fd00:8::2/128")},
+					ProtocolVersion:             1,
+				},
+				{
+					PublicKey:       peerB,
+					Endpoint:        endpointB,
+					AllowedIPs:      []net.IPNet{MustCIDR("10.8.1.0/24")},
+					ProtocolVersion: 1,
+				},
+				{
+					PublicKey:       peerC,
+					ProtocolVersion: 1,
+				},
+			},
+		}),
+		"amneziawg-go/basic": device("amneziawg-go basic", wgtypes.Device{
+			Name:             "awg0",
+			Type:             wgtypes.Userspace,
+			ListenPort:       51820,
+			AdvancedSecurity: amnezia,
+			Peers: []wgtypes.Peer{{
+				PublicKey:                   peerA,
+				PresharedKey:                pskA,
+				Endpoint:                    endpointA,
+				PersistentKeepaliveInterval: 25 * time.Second,
+				LastHandshakeTime:           handshakeA,
+				ReceiveBytes:                2259384,
+				TransmitBytes:               148920,
+				AllowedIPs:                  []net.IPNet{MustCIDR("0.0.0.0/0"), MustCIDR("::/0")},
+				ProtocolVersion:             1,
+			}},
+		}),
+		"openbsd/basic": device("openbsd basic", wgtypes.Device{
+			Name:       "wg0",
+			Type:       wgtypes.OpenBSDKernel,
+			ListenPort: 51820,
+			Peers: []wgtypes.Peer{
+				{
+					PublicKey:                   peerA,
+					PresharedKey:                pskA,
+					Endpoint:                    endpointA,
+					PersistentKeepaliveInterval: 25 * time.Second,
+					LastHandshakeTime:           handshakeA,
+					ReceiveBytes:                2259384,
+					TransmitBytes:               148920,
+					AllowedIPs:                  []net.IPNet{MustCIDR("10.8.0.2/32"), MustCIDR("fd00:8::2/128")},
+					ProtocolVersion:             1,
+				},
+				{
+					PublicKey:       peerB,
+					Endpoint:        endpointB,
+					AllowedIPs:      []net.IPNet{MustCIDR("10.8.1.0/24")},
+					ProtocolVersion: 1,
+				},
+			},
+		}),
+	}
+}
@@ -0,0 +1,74 @@
+package wguser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+)
+
+func BenchmarkUserspaceParseDevice(b *testing.B) {
+	for _, n := range wgtest.BenchPeers {
+		b.Run(fmt.Sprintf("peers-%d", n), func(b *testing.B) {
+			res := benchGet(n)
+
+			// Sanity check the fixture before timing.
+			d, err := parseDevice(bytes.NewReader(res))
+			if err != nil {
+				b.Fatalf("failed to parse device: %v", err)
+			}
+			if len(d.Peers) != n {
+				b.Fatalf("expected %d peers, but got %d", n, len(d.Peers))
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(res)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := parseDevice(bytes.NewReader(res)); err != nil {
+					b.Fatalf("failed to parse device: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUserspaceWriteConfig(b *testing.B) {
+	for _, n := range wgtest.BenchPeers {
+		b.Run(fmt.Sprintf("peers-%d", n), func(b *testing.B) {
+			cfg := wgtest.BenchConfig(n)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				writeConfig(io.Discard, cfg)
+			}
+		})
+	}
+}
+
+// benchGet returns a get=1 response for a device with n peers.
+func benchGet(n int) []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "private_key=%s\nlisten_port=51820\nfwmark=1\n", hexKey(wgtest.MustPrivateKey()))
+
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "public_key=%s\n", hexKey(wgtest.MustPublicKey()))
+		fmt.Fprintf(&sb, "preshared_key=%s\n", hexKey(wgtest.MustPresharedKey()))
+		fmt.Fprintf(&sb, "endpoint=192.0.2.%d:51820\n", byte(i))
+		fmt.Fprintf(&sb, "last_handshake_time_sec=%d\nlast_handshake_time_nsec=0\n", 1600000000+i)
+		fmt.Fprintf(&sb, "tx_bytes=%d\nrx_bytes=%d\n", i*1024, i*2048)
+		sb.WriteString("persistent_keepalive_interval=25\n")
+		fmt.Fprintf(&sb, "allowed_ip=10.%d.%d.%d/32\n", byte(i>>16), byte(i>>8), byte(i))
+		fmt.Fprintf(&sb, "allowed_ip=fd00::%x/128\n", i)
+		sb.WriteString("protocol_version=1\n")
+	}
+
+	sb.WriteString("errno=0\n\n")
+	return []byte(sb.String())
+}
@@ -1,22 +1,31 @@
 package wguser
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/danpashin/wgctrl/internal/wginternal"
 	"github.com/danpashin/wgctrl/wgtypes"
 )
 
-var _ wginternal.Client = &Client{}
+var (
+	_ wginternal.ContextClient = &Client{}
+	_ wginternal.Prober        = &Client{}
+	_ wginternal.DeviceManager = &Client{}
+)
 
 // A Client provides access to userspace WireGuard device information.
 type Client struct {
 	dial       func(device string) (net.Conn, error)
 	find       func(clientType wgtypes.ClientType) ([]string, error)
+	probe      func(clientType wgtypes.ClientType) error
+	spawn      func(clientType wgtypes.ClientType, name string) error
+	terminate  func(device string) error
 	clientType wgtypes.ClientType
 }
 
@@ -28,6 +37,9 @@ func New(clientType wgtypes.ClientType) (*Client, error) {
 		// overridden for tests.
 		dial:       dial,
 		find:       find,
+		probe:      probe,
+		spawn:      spawn,
+		terminate:  terminate,
 		clientType: clientType,
 	}, nil
 }
@@ -35,8 +47,25 @@ func New(clientType wgtypes.ClientType) (*Client, error) {
 // Close implements wginternal.Client.
 func (c *Client) Close() error { return nil }
 
+// DeviceType implements wginternal.Typer.
+func (c *Client) DeviceType() wgtypes.DeviceType { return wgtypes.Userspace }
+
+// Probe implements wginternal.Prober.
+func (c *Client) Probe() error {
+	if c.probe == nil {
+		return nil
+	}
+
+	return c.probe(c.clientType)
+}
+
 // Devices implements wginternal.Client.
 func (c *Client) Devices() ([]*wgtypes.Device, error) {
+	return c.DevicesContext(context.Background())
+}
+
+// DevicesContext implements wginternal.ContextClient.
+func (c *Client) DevicesContext(ctx context.Context) ([]*wgtypes.Device, error) {
 	devices, err := c.find(c.clientType)
 	if err != nil {
 		return nil, err
@@ -44,7 +73,7 @@ func (c *Client) Devices() ([]*wgtypes.Device, error) {
 
 	wgds := make([]*wgtypes.Device, 0, len(devices))
 	for _, d := range devices {
-		wgd, err := c.getDevice(d)
+		wgd, err := c.getDevice(ctx, d)
 		if err != nil {
 			return nil, err
 		}
@@ -57,38 +86,81 @@ func (c *Client) Devices() ([]*wgtypes.Device, error) {
 
 // Device implements wginternal.Client.
 func (c *Client) Device(name string) (*wgtypes.Device, error) {
-	devices, err := c.find(c.clientType)
+	return c.DeviceContext(context.Background(), name)
+}
+
+// DeviceContext implements wginternal.ContextClient.
+func (c *Client) DeviceContext(ctx context.Context, name string) (*wgtypes.Device, error) {
+	d, err := c.lookup(name)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, d := range devices {
-		if name != deviceName(d) {
-			continue
-		}
+	return c.getDevice(ctx, d)
+}
 
-		return c.getDevice(d)
+// ConfigureDevice implements wginternal.Client.
+func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	return c.ConfigureDeviceContext(context.Background(), name, cfg)
+}
+
+// ConfigureDeviceContext implements wginternal.ContextClient.
+func (c *Client) ConfigureDeviceContext(ctx context.Context, name string, cfg wgtypes.Config) error {
+	d, err := c.lookup(name)
+	if err != nil {
+		return err
 	}
 
-	return nil, os.ErrNotExist
+	return c.configureDevice(ctx, d, cfg)
 }
 
-// ConfigureDevice implements wginternal.Client.
-func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
-	devices, err := c.find(c.clientType)
+// CreateDevice implements wginternal.DeviceManager by starting a userspace
+// implementation process for the device, such as wireguard-go.
+func (c *Client) CreateDevice(name string) error {
+	if _, err := c.lookup(name); err == nil {
+		return fmt.Errorf("wguser: device %q: %w", name, os.ErrExist)
+	}
+
+	return c.spawn(c.clientType, name)
+}
+
+// DeleteDevice implements wginternal.DeviceManager by removing the device's
+// socket, which causes its userspace implementation process to exit.
+func (c *Client) DeleteDevice(name string) error {
+	d, err := c.lookup(name)
 	if err != nil {
 		return err
 	}
 
+	return c.terminate(d)
+}
+
+// Dial opens a connection to the userspace configuration protocol socket of
+// the device specified by name. The caller is responsible for closing the
+// connection.
+func (c *Client) Dial(name string) (net.Conn, error) {
+	d, err := c.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.dial(d)
+}
+
+// lookup returns the path of the device specified by name.
+func (c *Client) lookup(name string) (string, error) {
+	devices, err := c.find(c.clientType)
+	if err != nil {
+		return "", err
+	}
+
 	for _, d := range devices {
-		if name != deviceName(d) {
-			continue
+		if name == deviceName(d) {
+			return d, nil
 		}
-
-		return c.configureDevice(d, cfg)
 	}
 
-	return os.ErrNotExist
+	return "", os.ErrNotExist
 }
 
 // deviceName infers a device name from an absolute file path with extension.
@@ -96,6 +168,57 @@ func deviceName(sock string) string {
 	return strings.TrimSuffix(filepath.Base(sock), filepath.Ext(sock))
 }
 
+// dialContext opens a connection to the device specified by its path, and
+// arranges for I/O on the connection to fail once ctx is done. The returned
+// function must be called once I/O is complete, before closing the
+// connection.
+func (c *Client) dialContext(ctx context.Context, device string) (net.Conn, func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := c.dial(device)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ctx.Done() == nil {
+		// ctx can never be canceled.
+		return conn, func() {}, nil
+	}
+
+	var (
+		stop = make(chan struct{})
+		done = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+
+		select {
+		case <-ctx.Done():
+			// Unblock any pending reads and writes.
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	return conn, func() {
+		close(stop)
+		<-done
+	}, nil
+}
+
+// contextError returns the error of ctx if it is done, which is the reason
+// for err, or err otherwise.
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
 func panicf(format string, a ...interface{}) {
 	panic(fmt.Sprintf(format, a...))
 }
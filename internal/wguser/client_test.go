@@ -1,7 +1,10 @@
 package wguser
 
 import (
+	"context"
 	"errors"
+	"io"
+	"net"
 	"os"
 	"strings"
 	"sync"
@@ -59,6 +62,42 @@ func TestClientDevice(t *testing.T) {
 	}
 }
 
+func TestClientContext(t *testing.T) {
+	// A device which accepts requests but never responds.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	c := &Client{
+		dial: func(_ string) (net.Conn, error) {
+			client, server := net.Pipe()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer server.Close()
+
+				_, _ = io.Copy(io.Discard, server)
+			}()
+
+			return client, nil
+		},
+		find: func(_ wgtypes.ClientType) ([]string, error) {
+			return []string{testDevice + ".sock"}, nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.DeviceContext(ctx, testDevice); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	if err := c.ConfigureDeviceContext(ctx, testDevice, wgtypes.Config{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+}
+
 func testClient(t *testing.T, res []byte) (*Client, func() []byte) {
 	t.Helper()
 
@@ -128,3 +167,69 @@ func testClient(t *testing.T, res []byte) (*Client, func() []byte) {
 func durPtr(d time.Duration) *time.Duration { return &d }
 func keyPtr(k wgtypes.Key) *wgtypes.Key     { return &k }
 func intPtr(v int) *int                     { return &v }
+func u16Ptr(v uint16) *uint16               { return &v }
+func u32Ptr(v uint32) *uint32               { return &v }
+
+func TestClientDial(t *testing.T) {
+	c, done := testClient(t, nil)
+	defer done()
+
+	if _, err := c.Dial("wg1"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+
+	conn, err := c.Dial(testDevice)
+	if err != nil {
+		t.Fatalf("failed to dial device: %v", err)
+	}
+	defer conn.Close()
+
+	// The listener replies to the first request with "OK".
+	if _, err := io.WriteString(conn, "get=1\n\n"); err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+
+	if _, err := parseDevice(conn); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+}
+
+func TestClientCreateDeleteDevice(t *testing.T) {
+	const sock = "/var/run/wireguard/wg0.sock"
+
+	var spawned, terminated []string
+	c := &Client{
+		find: func(_ wgtypes.ClientType) ([]string, error) {
+			return []string{sock}, nil
+		},
+		spawn: func(_ wgtypes.ClientType, name string) error {
+			spawned = append(spawned, name)
+			return nil
+		},
+		terminate: func(device string) error {
+			terminated = append(terminated, device)
+			return nil
+		},
+	}
+
+	if err := c.CreateDevice("wg0"); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected exists, but got: %v", err)
+	}
+	if err := c.CreateDevice("wg1"); err != nil {
+		t.Fatalf("failed to create device: %v", err)
+	}
+
+	if err := c.DeleteDevice("wg1"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+	if err := c.DeleteDevice("wg0"); err != nil {
+		t.Fatalf("failed to delete device: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"wg1"}, spawned); diff != "" {
+		t.Fatalf("unexpected spawned devices (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{sock}, terminated); diff != "" {
+		t.Fatalf("unexpected terminated devices (-want +got):\n%s", diff)
+	}
+}
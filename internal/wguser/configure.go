@@ -2,22 +2,25 @@ package wguser
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/danpashin/wgctrl/wgtypes"
 )
 
 // configureDevice configures a device specified by its path.
-func (c *Client) configureDevice(device string, cfg wgtypes.Config) error {
-	conn, err := c.dial(device)
+func (c *Client) configureDevice(ctx context.Context, device string, cfg wgtypes.Config) error {
+	conn, stop, err := c.dialContext(ctx, device)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
+	defer stop()
 
 	// Start with set command.
 	var buf bytes.Buffer
@@ -29,13 +32,13 @@ func (c *Client) configureDevice(device string, cfg wgtypes.Config) error {
 
 	// Apply configuration for the device and then check the error number.
 	if _, err := io.Copy(conn, &buf); err != nil {
-		return err
+		return contextError(ctx, err)
 	}
 
 	res := make([]byte, 32)
 	n, err := conn.Read(res)
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
 
 	// errno=0 indicates success, anything else returns an error number that
@@ -63,6 +66,10 @@ func writeConfig(w io.Writer, cfg wgtypes.Config) {
 		fmt.Fprintf(w, "fwmark=%d\n", *cfg.FirewallMark)
 	}
 
+	// AmneziaWG parameters are device keys, so they must be written before
+	// the first public_key starts the peer section.
+	_ = cfg.AdvancedSecurityConfig.WriteUAPI(w)
+
 	if cfg.ReplacePeers {
 		fmt.Fprintln(w, "replace_peers=true")
 	}
@@ -87,7 +94,7 @@ func writeConfig(w io.Writer, cfg wgtypes.Config) {
 		}
 
 		if p.PersistentKeepaliveInterval != nil {
-			fmt.Fprintf(w, "persistent_keepalive_interval=%d\n", int(p.PersistentKeepaliveInterval.Seconds()))
+			fmt.Fprintf(w, "persistent_keepalive_interval=%d\n", *p.PersistentKeepaliveInterval/time.Second)
 		}
 
 		if p.ReplaceAllowedIPs {
@@ -98,43 +105,6 @@ func writeConfig(w io.Writer, cfg wgtypes.Config) {
 			fmt.Fprintf(w, "allowed_ip=%s\n", ip.String())
 		}
 	}
-
-	advancedSecCfg := cfg.AdvancedSecurityConfig
-	if advancedSecCfg.JunkPacketCount != nil {
-		fmt.Fprintf(w, "jc=%d\n", *advancedSecCfg.JunkPacketCount)
-	}
-
-	if advancedSecCfg.JunkPacketMinSize != nil {
-		fmt.Fprintf(w, "jmin=%d\n", *advancedSecCfg.JunkPacketMinSize)
-	}
-
-	if advancedSecCfg.JunkPacketMaxSize != nil {
-		fmt.Fprintf(w, "jmax=%d\n", *advancedSecCfg.JunkPacketMaxSize)
-	}
-
-	if advancedSecCfg.InitPacketJunkSize != nil {
-		fmt.Fprintf(w, "s1=%d\n", *advancedSecCfg.InitPacketJunkSize)
-	}
-
-	if advancedSecCfg.ResponsePacketJunkSize != nil {
-		fmt.Fprintf(w, "s2=%d\n", *advancedSecCfg.ResponsePacketJunkSize)
-	}
-
-	if advancedSecCfg.InitPacketMagicHeader != nil {
-		fmt.Fprintf(w, "h1=%d\n", *advancedSecCfg.InitPacketMagicHeader)
-	}
-
-	if advancedSecCfg.ResponsePacketMagicHeader != nil {
-		fmt.Fprintf(w, "h2=%d\n", *advancedSecCfg.ResponsePacketMagicHeader)
-	}
-
-	if advancedSecCfg.UnderloadPacketMagicHeader != nil {
-		fmt.Fprintf(w, "h3=%d\n", *advancedSecCfg.UnderloadPacketMagicHeader)
-	}
-
-	if advancedSecCfg.TransportPacketMagicHeader != nil {
-		fmt.Fprintf(w, "h4=%d\n", *advancedSecCfg.TransportPacketMagicHeader)
-	}
 }
 
 // hexKey encodes a wgtypes.Key into a hexadecimal string.
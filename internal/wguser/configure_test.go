@@ -1,6 +1,7 @@
 package wguser
 
 import (
+	"bytes"
 	"errors"
 	"net"
 	"os"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/danpashin/wgctrl/internal/wgtest"
 	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
 )
 
 // Example string source (with some slight modifications to use all fields):
@@ -140,6 +142,19 @@ func TestClientConfigureDeviceOK(t *testing.T) {
 			},
 			req: okSet,
 		},
+		{
+			name: "ok, amnezia before peers",
+			cfg: wgtypes.Config{
+				AdvancedSecurityConfig: wgtypes.AdvancedSecurityConfig{
+					JunkPacketCount:       u16Ptr(4),
+					InitPacketMagicHeader: u32Ptr(1234567),
+				},
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey: wgtest.MustHexKey("b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33"),
+				}},
+			},
+			req: "set=1\njc=4\nh1=1234567\npublic_key=b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33\n\n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -158,3 +173,26 @@ func TestClientConfigureDeviceOK(t *testing.T) {
 		})
 	}
 }
+
+func TestPersistentKeepaliveRoundTrip(t *testing.T) {
+	for _, d := range []time.Duration{0, time.Second, 25 * time.Second, wgtypes.MaxPersistentKeepaliveInterval} {
+		t.Run(d.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			writeConfig(&buf, wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:                   wgtest.MustPublicKey(),
+					PersistentKeepaliveInterval: &d,
+				}},
+			})
+
+			dev, err := parseDevice(&buf)
+			if err != nil {
+				t.Fatalf("failed to parse device: %v", err)
+			}
+
+			if diff := cmp.Diff(d, dev.Peers[0].PersistentKeepaliveInterval); diff != "" {
+				t.Fatalf("unexpected keepalive interval (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -5,11 +5,13 @@ package wguser
 
 import (
 	"errors"
-	"github.com/danpashin/wgctrl/wgtypes"
+	"fmt"
 	"io/fs"
 	"net"
 	"os"
 	"path/filepath"
+
+	"github.com/danpashin/wgctrl/wgtypes"
 )
 
 // dial is the default implementation of Client.dial.
@@ -17,22 +19,36 @@ func dial(device string) (net.Conn, error) {
 	return net.Dial("unix", device)
 }
 
-// find is the default implementation of Client.find.
-func find(clientType wgtypes.ClientType) ([]string, error) {
-	socketsPaths := []string{
+// socketDirs returns the directories which contain the UNIX sockets of
+// userspace devices for clientType.
+func socketDirs(clientType wgtypes.ClientType) []string {
+	switch clientType {
+	case wgtypes.AmneziaClient:
+		return []string{"/var/run/amneziawg"}
+	default:
 		// It seems that /var/run is a common location between Linux and the
 		// BSDs, even though it's a symlink on Linux.
-		"/var/run/wireguard",
+		return []string{"/var/run/wireguard"}
 	}
+}
 
-	switch clientType {
-	case wgtypes.AmneziaClient:
-		socketsPaths = []string{"/var/run/amneziawg"}
-	default:
-		break
+// find is the default implementation of Client.find.
+func find(clientType wgtypes.ClientType) ([]string, error) {
+	return findUNIXSockets(socketDirs(clientType))
+}
+
+// probe is the default implementation of Client.probe. Userspace
+// implementations create their socket directory on startup, so its absence
+// means that none have ever run.
+func probe(clientType wgtypes.ClientType) error {
+	var err error
+	for _, d := range socketDirs(clientType) {
+		if _, err = os.Stat(d); err == nil {
+			return nil
+		}
 	}
 
-	return findUNIXSockets(socketsPaths)
+	return fmt.Errorf("wguser: socket directory not found: %w", err)
 }
 
 // findUNIXSockets looks for UNIX socket files in the specified directories.
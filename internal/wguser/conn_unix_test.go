@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/danpashin/wgctrl/wgtypes"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -51,8 +52,8 @@ func TestUNIX_findUNIXSockets(t *testing.T) {
 }
 
 // testFind produces a Client.find function for integration tests.
-func testFind(dir string) func() ([]string, error) {
-	return func() ([]string, error) {
+func testFind(dir string) func(clientType wgtypes.ClientType) ([]string, error) {
+	return func(_ wgtypes.ClientType) ([]string, error) {
 		return findUNIXSockets([]string{dir})
 	}
 }
@@ -8,14 +8,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/danpashin/wgctrl/wgtypes"
 	"golang.org/x/sys/windows"
 	"golang.zx2c4.com/wireguard/ipc/namedpipe"
 )
 
 // Expected prefixes when dealing with named pipes.
 const (
-	pipePrefix = `\\.\pipe\`
-	wgPrefix   = `ProtectedPrefix\Administrators\WireGuard\`
+	pipePrefix      = `\\.\pipe\`
+	wgPrefix        = `ProtectedPrefix\Administrators\WireGuard\`
+	amneziaWgPrefix = `ProtectedPrefix\Administrators\AmneziaWG\`
 )
 
 // dial is the default implementation of Client.dial.
@@ -31,10 +33,20 @@ func dial(device string) (net.Conn, error) {
 }
 
 // find is the default implementation of Client.find.
-func find() ([]string, error) {
-	return findNamedPipes(wgPrefix)
+func find(clientType wgtypes.ClientType) ([]string, error) {
+	switch clientType {
+	case wgtypes.AmneziaClient:
+		return findNamedPipes(amneziaWgPrefix)
+	default:
+		return findNamedPipes(wgPrefix)
+	}
 }
 
+// probe is the default implementation of Client.probe. Named pipes have no
+// parent directory whose presence indicates that a userspace implementation
+// has run, so the implementation is always considered available.
+func probe(_ wgtypes.ClientType) error { return nil }
+
 // findNamedPipes looks for Windows named pipes that match the specified
 // search string prefix.
 func findNamedPipes(search string) ([]string, error) {
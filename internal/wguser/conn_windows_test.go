@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/danpashin/wgctrl/wgtypes"
 	"golang.org/x/sys/windows/registry"
 	"golang.zx2c4.com/wireguard/ipc/namedpipe"
 )
@@ -33,8 +34,8 @@ var isWINE = func() bool {
 }()
 
 // testFind produces a Client.find function for integration tests.
-func testFind(dir string) func() ([]string, error) {
-	return func() ([]string, error) {
+func testFind(dir string) func(clientType wgtypes.ClientType) ([]string, error) {
+	return func(_ wgtypes.ClientType) ([]string, error) {
 		return findNamedPipes(dir)
 	}
 }
@@ -3,6 +3,7 @@ package wguser
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/danpashin/wgctrl/internal/wginternal"
 	"github.com/danpashin/wgctrl/wgtypes"
 )
 
@@ -19,26 +21,29 @@ import (
 
 // getDevice gathers device information from a device specified by its path
 // and returns a Device.
-func (c *Client) getDevice(device string) (*wgtypes.Device, error) {
-	conn, err := c.dial(device)
+func (c *Client) getDevice(ctx context.Context, device string) (*wgtypes.Device, error) {
+	conn, stop, err := c.dialContext(ctx, device)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
+	defer stop()
 
 	// Get information about this device.
 	if _, err := io.WriteString(conn, "get=1\n\n"); err != nil {
-		return nil, err
+		return nil, contextError(ctx, err)
 	}
 
 	// Parse the device from the incoming data stream.
 	d, err := parseDevice(conn)
 	if err != nil {
-		return nil, err
+		return nil, contextError(ctx, err)
 	}
 
-	// TODO(mdlayher): populate interface index too?
+	// The userspace configuration protocol has no interface index, so look
+	// it up from the network interface of the same name, if any.
 	d.Name = deviceName(device)
+	d.Index = wginternal.InterfaceIndex(d.Name)
 	d.Type = wgtypes.Userspace
 
 	return d, nil
@@ -132,24 +137,8 @@ func (dp *deviceParser) Parse(key, value string) {
 		dp.d.ListenPort = dp.parseInt(value)
 	case "fwmark":
 		dp.d.FirewallMark = dp.parseInt(value)
-	case "jc":
-		dp.d.AdvancedSecurity.JunkPacketCount = uint16(dp.parseInt(value))
-	case "jmin":
-		dp.d.AdvancedSecurity.JunkPacketMinSize = uint16(dp.parseInt(value))
-	case "jmax":
-		dp.d.AdvancedSecurity.JunkPacketMaxSize = uint16(dp.parseInt(value))
-	case "s1":
-		dp.d.AdvancedSecurity.InitPacketJunkSize = uint16(dp.parseInt(value))
-	case "s2":
-		dp.d.AdvancedSecurity.ResponsePacketJunkSize = uint16(dp.parseInt(value))
-	case "h1":
-		dp.d.AdvancedSecurity.InitPacketMagicHeader = uint32(dp.parseInt(value))
-	case "h2":
-		dp.d.AdvancedSecurity.ResponsePacketMagicHeader = uint32(dp.parseInt(value))
-	case "h3":
-		dp.d.AdvancedSecurity.UnderloadPacketMagicHeader = uint32(dp.parseInt(value))
-	case "h4":
-		dp.d.AdvancedSecurity.TransportPacketMagicHeader = uint32(dp.parseInt(value))
+	default:
+		dp.parseAdvancedSecurity(key, value)
 	}
 }
 
@@ -194,6 +183,17 @@ func (dp *deviceParser) peerParse(key, value string) {
 	}
 }
 
+// parseAdvancedSecurity parses an AmneziaWG key/value field into the Device.
+func (dp *deviceParser) parseAdvancedSecurity(key, value string) {
+	if dp.err != nil {
+		return
+	}
+
+	if _, err := dp.d.AdvancedSecurity.ParseUAPI(key, value); err != nil {
+		dp.err = err
+	}
+}
+
 // parseKey parses a Key from a hex string.
 func (dp *deviceParser) parseKey(s string) wgtypes.Key {
 	if dp.err != nil {
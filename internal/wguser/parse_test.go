@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/danpashin/wgctrl/internal/wgtest"
 	"github.com/danpashin/wgctrl/wgtypes"
 	"github.com/google/go-cmp/cmp"
 )
@@ -174,3 +175,29 @@ func TestClientDevices(t *testing.T) {
 		})
 	}
 }
+
+func TestClientDeviceCaptures(t *testing.T) {
+	for _, src := range []wgtest.Source{wgtest.SourceWireGuardGo, wgtest.SourceAmneziaGo} {
+		for _, cc := range wgtest.CapturesFrom(src) {
+			cc := cc
+			t.Run(cc.Name, func(t *testing.T) {
+				c, done := testClient(t, cc.UAPI)
+				defer done()
+
+				d, err := c.Device(testDevice)
+				if err != nil {
+					t.Fatalf("failed to get device: %v", err)
+				}
+
+				// The UAPI does not report the device name, so the capture's
+				// device is served as testDevice.
+				want := cc.Device
+				want.Name = testDevice
+
+				if diff := cmp.Diff(want, d); diff != "" {
+					t.Fatalf("unexpected Device (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package wguser
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// implementation returns the userspace implementation executable started by
+// spawn for clientType. As with wg-quick(8), it may be overridden using the
+// WG_QUICK_USERSPACE_IMPLEMENTATION environment variable.
+func implementation(clientType wgtypes.ClientType) string {
+	if bin := os.Getenv("WG_QUICK_USERSPACE_IMPLEMENTATION"); bin != "" {
+		return bin
+	}
+
+	switch clientType {
+	case wgtypes.AmneziaClient:
+		return "amneziawg-go"
+	default:
+		return "wireguard-go"
+	}
+}
+
+// spawn is the default implementation of Client.spawn. The implementation
+// daemonizes itself once the device and its socket are ready, so spawn waits
+// only for the initial process to exit.
+func spawn(clientType wgtypes.ClientType, name string) error {
+	bin := implementation(clientType)
+
+	// Output is discarded rather than captured: the daemon may inherit the
+	// initial process's output and keep it open indefinitely.
+	if err := exec.Command(bin, name).Run(); err != nil {
+		return fmt.Errorf("wguser: failed to start %s for device %q: %w", bin, name, err)
+	}
+
+	return nil
+}
+
+// terminate is the default implementation of Client.terminate. Userspace
+// implementations watch their socket and shut down the device once it is
+// removed.
+func terminate(device string) error {
+	return os.Remove(device)
+}
@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package wguser
+
+import (
+	"errors"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// errSpawnUnsupported is returned when creating or deleting devices, which
+// is performed by the WireGuard service rather than a standalone process on
+// Windows.
+var errSpawnUnsupported = errors.New("wguser: creating and deleting userspace devices is not supported on windows")
+
+// spawn is the default implementation of Client.spawn.
+func spawn(_ wgtypes.ClientType, _ string) error { return errSpawnUnsupported }
+
+// terminate is the default implementation of Client.terminate.
+func terminate(_ string) error { return errSpawnUnsupported }
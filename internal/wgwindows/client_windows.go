@@ -13,7 +13,10 @@ import (
 	"github.com/danpashin/wgctrl/wgtypes"
 )
 
-var _ wginternal.Client = &Client{}
+var (
+	_ wginternal.Client = &Client{}
+	_ wginternal.Typer  = &Client{}
+)
 
 // A Client provides access to WireGuardNT ioctl information.
 type Client struct {
@@ -110,6 +113,12 @@ func (c *Client) interfaceHandle(name string) (handle windows.Handle, err error)
 	return
 }
 
+// Handle opens a handle to the WireGuardNT adapter specified by name. The
+// caller is responsible for closing the handle.
+func (c *Client) Handle(name string) (windows.Handle, error) {
+	return c.interfaceHandle(name)
+}
+
 // Devices implements wginternal.Client.
 func (c *Client) Devices() ([]*wgtypes.Device, error) {
 	err := c.refreshInterfaceCache()
@@ -132,6 +141,9 @@ func New() *Client {
 	return &Client{}
 }
 
+// DeviceType implements wginternal.Typer.
+func (c *Client) DeviceType() wgtypes.DeviceType { return wgtypes.WindowsKernel }
+
 // Close implements wginternal.Client.
 func (c *Client) Close() error {
 	return nil
@@ -162,9 +174,16 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 		break
 	}
 	c.lastLenGuess = size
-	interfaze := (*ioctl.Interface)(unsafe.Pointer(&buf[0]))
+	device := parseDevice((*ioctl.Interface)(unsafe.Pointer(&buf[0])))
+	device.Name = name
+	device.Index = wginternal.InterfaceIndex(name)
+	return device, nil
+}
 
-	device := wgtypes.Device{Type: wgtypes.WindowsKernel, Name: name}
+// parseDevice unpacks a wgtypes.Device from the configuration returned by
+// the driver.
+func parseDevice(interfaze *ioctl.Interface) *wgtypes.Device {
+	device := wgtypes.Device{Type: wgtypes.WindowsKernel}
 	if interfaze.Flags&ioctl.InterfaceHasPrivateKey != 0 {
 		device.PrivateKey = interfaze.PrivateKey
 	}
@@ -225,7 +244,7 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 		}
 		device.Peers = append(device.Peers, peer)
 	}
-	return &device, nil
+	return &device
 }
 
 // ConfigureDevice implements wginternal.Client.
@@ -236,6 +255,13 @@ func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
 	}
 	defer windows.CloseHandle(handle)
 
+	interfaze, size := unparseConfig(cfg)
+	return windows.DeviceIoControl(handle, ioctl.IoctlSet, nil, 0, (*byte)(unsafe.Pointer(interfaze)), size, &size, nil)
+}
+
+// unparseConfig encodes cfg in the configuration format accepted by the
+// driver, returning the configuration and its size.
+func unparseConfig(cfg wgtypes.Config) (*ioctl.Interface, uint32) {
 	preallocation := unsafe.Sizeof(ioctl.Interface{}) + uintptr(len(cfg.Peers))*unsafe.Sizeof(ioctl.Peer{})
 	for i := range cfg.Peers {
 		preallocation += uintptr(len(cfg.Peers[i].AllowedIPs)) * unsafe.Sizeof(ioctl.AllowedIP{})
@@ -302,6 +328,5 @@ func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
 			b.AppendAllowedIP(a)
 		}
 	}
-	interfaze, size := b.Interface()
-	return windows.DeviceIoControl(handle, ioctl.IoctlSet, nil, 0, (*byte)(unsafe.Pointer(interfaze)), size, &size, nil)
+	return b.Interface()
 }
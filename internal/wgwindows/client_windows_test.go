@@ -0,0 +1,61 @@
+//go:build windows
+// +build windows
+
+package wgwindows
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKeepaliveRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		keepalive *time.Duration
+		want      time.Duration
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:      "disabled",
+			keepalive: durPtr(0),
+		},
+		{
+			name:      "seconds",
+			keepalive: durPtr(25 * time.Second),
+			want:      25 * time.Second,
+		},
+		{
+			name:      "maximum",
+			keepalive: durPtr(65535 * time.Second),
+			want:      65535 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interfaze, _ := unparseConfig(wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:                   wgtest.MustPublicKey(),
+					PersistentKeepaliveInterval: tt.keepalive,
+				}},
+			})
+
+			d := parseDevice(interfaze)
+			if len(d.Peers) != 1 {
+				t.Fatalf("expected 1 peer, but got %d", len(d.Peers))
+			}
+
+			if diff := cmp.Diff(tt.want, d.Peers[0].PersistentKeepaliveInterval); diff != "" {
+				t.Fatalf("unexpected keepalive interval (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func durPtr(d time.Duration) *time.Duration { return &d }
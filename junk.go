@@ -0,0 +1,159 @@
+package wgctrl
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// Default values for JunkScheduler fields. The size bounds keep junk packets
+// within the IPv6 minimum MTU of 1280 bytes, including IPv6 and UDP headers.
+const (
+	defaultJunkInterval = time.Hour
+	defaultJunkMinCount = 3
+	defaultJunkMaxCount = 10
+	defaultJunkMinSize  = 50
+	defaultJunkMaxSize  = 1000
+)
+
+// A JunkScheduler periodically regenerates the junk packet parameters of
+// AmneziaWG devices, so that the number and sizes of the packets sent before
+// each handshake vary over time and are harder to fingerprint.
+//
+// Only the junk packet count and size range (Jc, Jmin, and Jmax) are changed.
+// They only affect the packets a device sends, so each device is given its own
+// random values and peers need not be reconfigured. The parameters which must
+// match between peers, S1, S2, and H1 to H4, are never changed. Devices which
+// don't use AmneziaWG obfuscation are left unchanged.
+type JunkScheduler struct {
+	// Interval is the amount of time between regenerations performed by Run.
+	// If zero, a default of one hour is used.
+	Interval time.Duration
+
+	// MinCount and MaxCount bound the number of junk packets, Jc. If both are
+	// zero, defaults of 3 and 10 are used.
+	MinCount, MaxCount uint16
+
+	// MinSize and MaxSize bound the sizes of junk packets, Jmin and Jmax. If
+	// both are zero, defaults of 50 and 1000 bytes are used. MaxSize should
+	// leave room for IP and UDP headers within the path MTU of each device.
+	MinSize, MaxSize uint16
+
+	// OnError, if set, is called with any error returned by Apply from Run.
+	// Errors do not stop Run.
+	OnError func(err error)
+}
+
+// Run calls Apply for the devices specified by names every Interval until ctx
+// is canceled. Run always returns a non-nil error.
+func (s *JunkScheduler) Run(ctx context.Context, c *Client, names ...string) error {
+	if _, err := s.Next(); err != nil {
+		return err
+	}
+
+	interval := s.Interval
+	if interval == 0 {
+		interval = defaultJunkInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			if err := s.Apply(c, names...); err != nil && s.OnError != nil {
+				s.OnError(err)
+			}
+		}
+	}
+}
+
+// Apply configures each AmneziaWG device specified by names with new junk
+// packet parameters generated by Next. Every device is attempted, and an
+// error joining the errors of each device which could not be configured is
+// returned.
+func (s *JunkScheduler) Apply(c *Client, names ...string) error {
+	var errs []error
+	for _, name := range names {
+		d, err := c.device(context.Background(), name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("wgctrl: device %q: %w", name, err))
+			continue
+		}
+		if !d.AdvancedSecurity.IsEnabled() {
+			continue
+		}
+
+		asc, err := s.Next()
+		if err != nil {
+			return err
+		}
+
+		if err := c.ConfigureDevice(name, wgtypes.Config{AdvancedSecurityConfig: asc}); err != nil {
+			errs = append(errs, fmt.Errorf("wgctrl: device %q: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Next generates random junk packet parameters within the bounds of s. Only
+// the JunkPacketCount, JunkPacketMinSize, and JunkPacketMaxSize fields of the
+// result are set, and the minimum size is always less than the maximum size.
+func (s *JunkScheduler) Next() (wgtypes.AdvancedSecurityConfig, error) {
+	minCount, maxCount := s.MinCount, s.MaxCount
+	if minCount == 0 && maxCount == 0 {
+		minCount, maxCount = defaultJunkMinCount, defaultJunkMaxCount
+	}
+	minSize, maxSize := s.MinSize, s.MaxSize
+	if minSize == 0 && maxSize == 0 {
+		minSize, maxSize = defaultJunkMinSize, defaultJunkMaxSize
+	}
+
+	switch {
+	case minCount > maxCount:
+		return wgtypes.AdvancedSecurityConfig{}, fmt.Errorf("wgctrl: junk packet count range %d-%d is invalid", minCount, maxCount)
+	case minSize >= maxSize:
+		return wgtypes.AdvancedSecurityConfig{}, fmt.Errorf("wgctrl: junk packet size range %d-%d is invalid", minSize, maxSize)
+	}
+
+	jc, err := randUint16(minCount, maxCount)
+	if err != nil {
+		return wgtypes.AdvancedSecurityConfig{}, err
+	}
+
+	// Choose two distinct sizes, so that Jmin is always less than Jmax.
+	jmin, err := randUint16(minSize, maxSize-1)
+	if err != nil {
+		return wgtypes.AdvancedSecurityConfig{}, err
+	}
+	jmax, err := randUint16(jmin+1, maxSize)
+	if err != nil {
+		return wgtypes.AdvancedSecurityConfig{}, err
+	}
+
+	return wgtypes.AdvancedSecurityConfig{
+		JunkPacketCount:   &jc,
+		JunkPacketMinSize: &jmin,
+		JunkPacketMaxSize: &jmax,
+	}, nil
+}
+
+// randUint16 returns a uniformly random value in the range [lo, hi], using a
+// cryptographically secure source so that the values can't be predicted.
+func randUint16(lo, hi uint16) (uint16, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(hi-lo)+1))
+	if err != nil {
+		return 0, fmt.Errorf("wgctrl: failed to read random bytes: %v", err)
+	}
+
+	return lo + uint16(n.Int64()), nil
+}
@@ -0,0 +1,46 @@
+package wgctrl
+
+import (
+	"net"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// WithLazyAllowedIPs defers decoding the allowed IPs of the peers of devices
+// retrieved by Client.Device and Client.Devices until they are needed. Such
+// peers have an empty AllowedIPs field, and their allowed IPs are decoded by
+// the first call to their LoadAllowedIPs method. This greatly reduces the CPU
+// time spent by callers which frequently retrieve devices with peers which
+// have many allowed IPs, but only read statistics such as transfer counters
+// and handshake times.
+//
+// Only the Linux kernel implementation defers decoding; other implementations
+// always decode allowed IPs. Methods of Client which use allowed IPs, such as
+// MovePeer and SyncDeviceConfig, decode them as needed.
+func WithLazyAllowedIPs() Option {
+	return func(o *options) {
+		o.lazyAllowedIPs = true
+	}
+}
+
+// loadAllowedIPs decodes the deferred allowed IPs of each peer of d, if any,
+// into its AllowedIPs field.
+func loadAllowedIPs(d *wgtypes.Device) error {
+	for i := range d.Peers {
+		p := &d.Peers[i]
+		if p.LazyAllowedIPs == nil {
+			continue
+		}
+
+		ipns, err := p.LoadAllowedIPs()
+		if err != nil {
+			return err
+		}
+
+		// The decoded allowed IPs are shared; give the peer its own copy.
+		p.AllowedIPs = append([]net.IPNet(nil), ipns...)
+		p.LazyAllowedIPs = nil
+	}
+
+	return nil
+}
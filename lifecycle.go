@@ -0,0 +1,93 @@
+package wgctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// ErrUnsupported is returned by CreateDevice and DeleteDevice when no
+// WireGuard implementation in use can create or delete the device.
+var ErrUnsupported = errors.New("wgctrl: operation not supported")
+
+// CreateDevice creates a WireGuard device named name, using the
+// implementation of the specified type. The device has no configuration and
+// its network interface is down; use ConfigureDevice to configure it.
+//
+// On Linux, wgtypes.LinuxKernel devices are created using rtnetlink, as with
+// "ip link add name type wireguard", or type amneziawg for an AmneziaClient.
+// On UNIX-like systems, wgtypes.Userspace devices are created by starting
+// wireguard-go, or amneziawg-go for an AmneziaClient, which must be found in
+// PATH. As with wg-quick(8), the WG_QUICK_USERSPACE_IMPLEMENTATION
+// environment variable may name another implementation.
+//
+// If a device or network interface named name already exists, an error is
+// returned which can be checked using `errors.Is(err, ErrDeviceExists)` or
+// `errors.Is(err, os.ErrExist)`. If no implementation can create devices of
+// type typ, an error is returned which can be checked using
+// `errors.Is(err, ErrUnsupported)`.
+func (c *Client) CreateDevice(name string, typ wgtypes.DeviceType) error {
+	for _, wgc := range c.cs {
+		dm, ok := wgc.(wginternal.DeviceManager)
+		if !ok || dm.DeviceType() != typ {
+			continue
+		}
+
+		start := time.Now()
+		err := dm.CreateDevice(name)
+		c.metrics.observe("CreateDevice", wgc, start, err)
+		c.InvalidateDevice(name)
+		c.seqs.changed(name)
+
+		return classify(err)
+	}
+
+	return fmt.Errorf("wgctrl: creating %s devices: %w", typ, ErrUnsupported)
+}
+
+// DeleteDevice deletes the WireGuard device specified by name, which was
+// created by CreateDevice or by other means. Linux kernel devices are deleted
+// using rtnetlink, and userspace devices by removing their configuration
+// socket, which causes the implementation process to exit. Network
+// interfaces which are not WireGuard devices are never deleted.
+//
+// If the device specified by name does not exist or is not a WireGuard
+// device, an error is returned which can be checked using
+// `errors.Is(err, ErrDeviceNotFound)` or `errors.Is(err, os.ErrNotExist)`. If
+// the implementation of the device can't delete devices, an error is returned
+// which can be checked using `errors.Is(err, ErrUnsupported)`.
+func (c *Client) DeleteDevice(name string) error {
+	ctx := context.Background()
+
+	for _, wgc := range c.cs {
+		start := time.Now()
+		_, err := wginternal.DeviceContext(ctx, wgc, name)
+		c.metrics.observe("Device", wgc, start, err)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			continue
+		case err != nil:
+			return classify(err)
+		}
+
+		dm, ok := wgc.(wginternal.DeviceManager)
+		if !ok {
+			return fmt.Errorf("wgctrl: deleting device %q: %w", name, ErrUnsupported)
+		}
+
+		start = time.Now()
+		err = dm.DeleteDevice(name)
+		c.metrics.observe("DeleteDevice", wgc, start, err)
+		c.InvalidateDevice(name)
+		c.seqs.changed(name)
+
+		return classify(err)
+	}
+
+	return fmt.Errorf("wgctrl: device %q: %w", name, ErrDeviceNotFound)
+}
@@ -0,0 +1,164 @@
+package wgctrl
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// LatencyBuckets are the upper bounds of the latency histogram buckets
+// recorded by Metrics. A final bucket counts calls slower than the last bound.
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// Metrics collects call counts and latencies for each operation performed by
+// a Client against each of its WireGuard implementations. A Metrics is
+// attached to a Client using WithMetrics, and may be shared by several
+// Clients. Its methods are safe for concurrent use.
+//
+// Metrics implements expvar.Var, so it can be published directly using
+// expvar.Publish.
+type Metrics struct {
+	mu  sync.Mutex
+	ops map[opKey]*OperationStats
+}
+
+// WithMetrics records statistics for each call made by the Client in m.
+func WithMetrics(m *Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// OperationStats are the statistics for a single operation and
+// implementation.
+type OperationStats struct {
+	// Operation is the name of the Client method, such as "Device".
+	Operation string `json:"operation"`
+
+	// Backend is the type of the implementation which performed the call, or
+	// Unknown if the implementation does not report its type.
+	Backend wgtypes.DeviceType `json:"-"`
+
+	// Calls is the total number of calls made.
+	Calls uint64 `json:"calls"`
+
+	// Errors is the number of calls which returned an error. Device not found
+	// errors are not counted, as each implementation is asked for a device in
+	// turn until one has it.
+	Errors uint64 `json:"errors"`
+
+	// Latency is the total time spent in all calls.
+	Latency time.Duration `json:"latency_ns"`
+
+	// Buckets counts calls by latency, using the bounds in LatencyBuckets.
+	// It has one more element than LatencyBuckets.
+	Buckets []uint64 `json:"buckets"`
+}
+
+// An opKey identifies an operation performed by an implementation.
+type opKey struct {
+	op  string
+	typ wgtypes.DeviceType
+}
+
+// Snapshot returns a copy of the current statistics, sorted by backend and
+// then operation.
+func (m *Metrics) Snapshot() []OperationStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]OperationStats, 0, len(m.ops))
+	for _, s := range m.ops {
+		c := *s
+		c.Buckets = append([]uint64(nil), s.Buckets...)
+		out = append(out, c)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Backend != out[j].Backend {
+			return out[i].Backend < out[j].Backend
+		}
+
+		return out[i].Operation < out[j].Operation
+	})
+
+	return out
+}
+
+// String returns a JSON representation of the current statistics, and
+// implements expvar.Var.
+func (m *Metrics) String() string {
+	type stats struct {
+		OperationStats
+		Backend string `json:"backend"`
+	}
+
+	snap := m.Snapshot()
+	ss := make([]stats, 0, len(snap))
+	for _, s := range snap {
+		ss = append(ss, stats{OperationStats: s, Backend: s.Backend.String()})
+	}
+
+	b, err := json.Marshal(ss)
+	if err != nil {
+		// Can't happen with the types used above.
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// observe records the outcome of a call to op by wgc which began at start.
+func (m *Metrics) observe(op string, wgc wginternal.Client, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	d := time.Since(start)
+
+	typ := wgtypes.Unknown
+	if t, ok := wgc.(wginternal.Typer); ok {
+		typ = t.DeviceType()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ops == nil {
+		m.ops = make(map[opKey]*OperationStats)
+	}
+
+	k := opKey{op: op, typ: typ}
+	s, ok := m.ops[k]
+	if !ok {
+		s = &OperationStats{
+			Operation: op,
+			Backend:   typ,
+			Buckets:   make([]uint64, len(LatencyBuckets)+1),
+		}
+		m.ops[k] = s
+	}
+
+	s.Calls++
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.Errors++
+	}
+	s.Latency += d
+
+	i := sort.Search(len(LatencyBuckets), func(i int) bool {
+		return d <= LatencyBuckets[i]
+	})
+	s.Buckets[i]++
+}
@@ -0,0 +1,109 @@
+package wgctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// MovePeer moves the peer with public key from the device specified by from
+// to the device specified by to, with an identical configuration, for example
+// to rebalance peers across devices listening on different ports.
+//
+// The peer is added to the destination device before it is removed from the
+// source device, and is removed from the destination device again if it can't
+// be removed from the source, so the peer is never absent from both devices.
+// Because WireGuard moves an allowed IP between peers of the same device when
+// it is reassigned, the move is refused with a *wgtypes.ValidationError if any
+// of the peer's allowed IPs overlap those of another peer on the destination
+// device. Routes for the peer's allowed IPs are not managed by WireGuard, and
+// must be moved to the destination interface by the caller.
+//
+// If either device does not exist, an error which matches ErrDeviceNotFound
+// is returned, and if the peer does not exist, one which matches
+// ErrPeerNotFound. Both also match os.ErrNotExist. If the peer already exists
+// on the destination device, an error which matches ErrPeerExists and
+// os.ErrExist is returned.
+func (c *Client) MovePeer(from, to string, key wgtypes.Key) error {
+	src, err := c.device(context.Background(), from)
+	if err != nil {
+		return err
+	}
+	dst, err := c.device(context.Background(), to)
+	if err != nil {
+		return err
+	}
+
+	var peer *wgtypes.Peer
+	for i := range src.Peers {
+		if src.Peers[i].PublicKey == key {
+			peer = &src.Peers[i]
+			break
+		}
+	}
+	if peer == nil {
+		return fmt.Errorf("wgctrl: peer %s on device %q: %w", key, from, ErrPeerNotFound)
+	}
+
+	for _, p := range dst.Peers {
+		if p.PublicKey == key {
+			return fmt.Errorf("wgctrl: peer %s on device %q: %w", key, to, ErrPeerExists)
+		}
+
+		for _, a := range peer.AllowedIPs {
+			for _, b := range p.AllowedIPs {
+				if overlaps(a, b) {
+					return &wgtypes.ValidationError{
+						Peer:   &peer.PublicKey,
+						Field:  "AllowedIPs",
+						Reason: fmt.Sprintf("%s overlaps %s of peer %s on device %q", a.String(), b.String(), p.PublicKey, to),
+					}
+				}
+			}
+		}
+	}
+
+	add := peerConfig(*peer)
+	if err := c.AddPeer(to, add); err != nil {
+		return err
+	}
+
+	err = c.RemovePeer(from, key)
+	if err == nil {
+		return nil
+	}
+
+	// Roll back the addition so the peer remains only on its original device.
+	rerr := c.RemovePeer(to, key)
+
+	return errors.Join(err, rerr)
+}
+
+// peerConfig returns a PeerConfig which configures a new peer identically to
+// p.
+func peerConfig(p wgtypes.Peer) wgtypes.PeerConfig {
+	var psk *wgtypes.Key
+	if p.PresharedKey != (wgtypes.Key{}) {
+		k := p.PresharedKey
+		psk = &k
+	}
+
+	keepalive := p.PersistentKeepaliveInterval
+
+	return wgtypes.PeerConfig{
+		PublicKey:                   p.PublicKey,
+		PresharedKey:                psk,
+		Endpoint:                    p.Endpoint,
+		PersistentKeepaliveInterval: &keepalive,
+		ReplaceAllowedIPs:           true,
+		AllowedIPs:                  append([]net.IPNet(nil), p.AllowedIPs...),
+	}
+}
+
+// overlaps reports whether a and b have any addresses in common.
+func overlaps(a, b net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
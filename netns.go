@@ -0,0 +1,33 @@
+package wgctrl
+
+// WithNetNS makes the Client manage the WireGuard devices in the network
+// namespace referred to by the file descriptor fd, such as an open handle of
+// /proc/<pid>/ns/net, rather than those in the network namespace of the
+// calling process. fd is only used by New, and may be closed once New
+// returns. Creating a Client in another network namespace typically requires
+// the CAP_SYS_ADMIN capability.
+//
+// Only the Linux kernel implementation is used with WithNetNS, since the
+// devices of userspace implementations are found using the file system
+// rather than a network namespace. On platforms other than Linux, New returns
+// an error if WithNetNS is used.
+func WithNetNS(fd int) Option {
+	return func(o *options) {
+		o.netns = fd
+		o.netnsPath = ""
+	}
+}
+
+// WithNetNSPath is like WithNetNS, but uses the network namespace file at
+// path, such as /var/run/netns/name as created by "ip netns add name".
+func WithNetNSPath(path string) Option {
+	return func(o *options) {
+		o.netns = 0
+		o.netnsPath = path
+	}
+}
+
+// useNetNS reports whether WithNetNS or WithNetNSPath is in use.
+func (o options) useNetNS() bool {
+	return o.netns != 0 || o.netnsPath != ""
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package wgctrl
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// checkNetNS returns an error if WithNetNS or WithNetNSPath is in use, since
+// network namespaces are only supported on Linux.
+func checkNetNS(o options) error {
+	if !o.useNetNS() {
+		return nil
+	}
+
+	return fmt.Errorf("wgctrl: network namespaces not implemented on %s/%s",
+		runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,88 @@
+package wgctrl
+
+import (
+	"io"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// An Option configures a Client created by New.
+type Option func(o *options)
+
+// options holds the settings applied by Options.
+type options struct {
+	backends   []Backend
+	interfaces func() ([]string, error)
+	families   []string
+	cacheTTL   time.Duration
+	metrics    *Metrics
+	policy     *EndpointPolicy
+	history    *History
+	revoked    *RevocationList
+	pins       *EndpointPins
+	netns      int
+	netnsPath  string
+
+	lazyAllowedIPs bool
+
+	rateInterval time.Duration
+	rateBurst    int
+}
+
+// WithInterfaces replaces the function used to list network interfaces when
+// an implementation enumerates them to find WireGuard devices. This is only
+// used by the Linux kernel implementation, which otherwise uses rtnetlink.
+//
+// Any interfaces returned by fn which are not WireGuard devices are skipped,
+// so fn may return all of the system's interfaces. It is useful in
+// environments where the default enumeration is unavailable, such as minimal
+// containers, and may be used with LinkKindInterfaces to match additional
+// link kinds.
+func WithInterfaces(fn func() ([]string, error)) Option {
+	return func(o *options) {
+		o.interfaces = fn
+	}
+}
+
+// WithGenlFamilies sets the generic netlink family names used to find the
+// Linux kernel implementation, which are tried in order. By default, the
+// family for the Client's type is used: "wireguard" for wgtypes.NativeClient
+// and "amneziawg" for wgtypes.AmneziaClient. This is useful for kernel
+// modules which register a different family name, such as builds of
+// AmneziaWG which coexist with WireGuard. It is ignored on other platforms.
+func WithGenlFamilies(names ...string) Option {
+	return func(o *options) {
+		o.families = names
+	}
+}
+
+// A Backend is a WireGuard implementation which a Client can use in place of
+// those found on the system.
+type Backend interface {
+	io.Closer
+	Devices() ([]*wgtypes.Device, error)
+	Device(name string) (*wgtypes.Device, error)
+	ConfigureDevice(name string, cfg wgtypes.Config) error
+}
+
+// WithBackends replaces the WireGuard implementations found on the system
+// with bs, which are used in order as with the system's implementations. It
+// is intended for tests, such as with the in-memory implementation provided
+// by package wgctrltest, and for implementations this package does not
+// support.
+func WithBackends(bs ...Backend) Option {
+	return func(o *options) {
+		o.backends = bs
+	}
+}
+
+// newOptions applies opts to a default set of options.
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
@@ -4,6 +4,10 @@
 package wgctrl
 
 import (
+	"errors"
+	"fmt"
+	"os"
+
 	"github.com/danpashin/wgctrl/internal/wginternal"
 	"github.com/danpashin/wgctrl/internal/wglinux"
 	"github.com/danpashin/wgctrl/internal/wguser"
@@ -11,27 +15,74 @@ import (
 )
 
 // newClients configures wginternal.Clients for Linux systems.
-func newClients(clientType wgtypes.ClientType) ([]wginternal.Client, error) {
-	var clients []wginternal.Client
+func newClients(clientType wgtypes.ClientType, o options) ([]wginternal.Client, []BackendError, error) {
+	var (
+		clients     []wginternal.Client
+		unavailable []BackendError
+	)
 
 	// Linux has an in-kernel WireGuard implementation. Determine if it is
 	// available and make use of it if so.
-	kc, ok, err := wglinux.New(clientType)
+	netns, closeNetNS, err := openNetNS(o)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeNetNS()
+
+	kc, ok, err := wglinux.NewNetNS(clientType, netns, o.families...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if ok {
+		if o.interfaces != nil {
+			kc.SetInterfaces(o.interfaces)
+		}
+		kc.SetLazyAllowedIPs(o.lazyAllowedIPs)
+
 		clients = append(clients, kc)
+	} else {
+		unavailable = append(unavailable, BackendError{
+			Type: wgtypes.LinuxKernel,
+			Err:  fmt.Errorf("generic netlink family not found, the kernel module may not be loaded: %w", os.ErrNotExist),
+		})
+	}
+
+	// Userspace devices are found using the file system, not the network
+	// namespace, so only the kernel implementation can be used in another
+	// namespace.
+	if o.useNetNS() {
+		unavailable = append(unavailable, BackendError{
+			Type: wgtypes.Userspace,
+			Err:  errors.New("userspace implementations are not used in another network namespace"),
+		})
+
+		return clients, unavailable, nil
 	}
 
 	// Although it isn't recommended to use userspace implementations on Linux,
 	// it can be used. We make use of it in integration tests as well.
 	uc, err := wguser.New(clientType)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Kernel devices seem to appear first in wg(8).
 	clients = append(clients, uc)
-	return clients, nil
+	return clients, unavailable, nil
+}
+
+// openNetNS returns the network namespace file descriptor set by WithNetNS or
+// WithNetNSPath, or 0 for the current network namespace, and a function which
+// releases it once the Client has been created.
+func openNetNS(o options) (int, func(), error) {
+	if o.netnsPath == "" {
+		return o.netns, func() {}, nil
+	}
+
+	f, err := os.Open(o.netnsPath)
+	if err != nil {
+		return 0, nil, fmt.Errorf("wgctrl: failed to open network namespace: %w", err)
+	}
+
+	return int(f.Fd()), func() { _ = f.Close() }, nil
 }
@@ -4,6 +4,9 @@
 package wgctrl
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/danpashin/wgctrl/internal/wginternal"
 	"github.com/danpashin/wgctrl/internal/wgopenbsd"
 	"github.com/danpashin/wgctrl/internal/wguser"
@@ -11,24 +14,36 @@ import (
 )
 
 // newClients configures wginternal.Clients for OpenBSD systems.
-func newClients(clientType wgtypes.ClientType) ([]wginternal.Client, error) {
-	var clients []wginternal.Client
+func newClients(clientType wgtypes.ClientType, o options) ([]wginternal.Client, []BackendError, error) {
+	if err := checkNetNS(o); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		clients     []wginternal.Client
+		unavailable []BackendError
+	)
 
 	// OpenBSD has an in-kernel WireGuard implementation. Determine if it is
 	// available and make use of it if so.
 	kc, ok, err := wgopenbsd.New()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if ok {
 		clients = append(clients, kc)
+	} else {
+		unavailable = append(unavailable, BackendError{
+			Type: wgtypes.OpenBSDKernel,
+			Err:  fmt.Errorf("WireGuard interface group not found, the kernel may lack WireGuard support: %w", os.ErrNotExist),
+		})
 	}
 
 	uc, err := wguser.New(clientType)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	clients = append(clients, uc)
-	return clients, nil
+	return clients, unavailable, nil
 }
@@ -11,11 +11,15 @@ import (
 
 // newClients configures wginternal.Clients for systems which only support
 // userspace WireGuard implementations.
-func newClients(clientType wgtypes.ClientType) ([]wginternal.Client, error) {
+func newClients(clientType wgtypes.ClientType, o options) ([]wginternal.Client, []BackendError, error) {
+	if err := checkNetNS(o); err != nil {
+		return nil, nil, err
+	}
+
 	c, err := wguser.New(clientType)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return []wginternal.Client{c}, nil
+	return []wginternal.Client{c}, nil, nil
 }
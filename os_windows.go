@@ -11,7 +11,11 @@ import (
 )
 
 // newClients configures wginternal.Clients for Windows systems.
-func newClients(clientType wgtypes.ClientType) ([]wginternal.Client, error) {
+func newClients(clientType wgtypes.ClientType, o options) ([]wginternal.Client, []BackendError, error) {
+	if err := checkNetNS(o); err != nil {
+		return nil, nil, err
+	}
+
 	var clients []wginternal.Client
 
 	// Windows has an in-kernel WireGuard implementation.
@@ -20,9 +24,9 @@ func newClients(clientType wgtypes.ClientType) ([]wginternal.Client, error) {
 
 	uc, err := wguser.New(clientType)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	clients = append(clients, uc)
-	return clients, nil
+	return clients, nil, nil
 }
@@ -0,0 +1,66 @@
+package wgctrl
+
+import "github.com/danpashin/wgctrl/wgtypes"
+
+// AddPeer adds the peer described by cfg to the device specified by name, as
+// with ConfigureDevice using a Config containing only cfg. If the peer
+// already exists, it is updated with cfg instead.
+//
+// The Remove and UpdateOnly fields of cfg are ignored.
+func (c *Client) AddPeer(name string, cfg wgtypes.PeerConfig) error {
+	cfg.Remove = false
+	cfg.UpdateOnly = false
+
+	return c.configurePeer(name, cfg)
+}
+
+// UpdatePeer updates the existing peer described by cfg on the device
+// specified by name, as with ConfigureDevice using a Config containing only
+// cfg. If the peer does not exist, the device is left unchanged and no error
+// is returned.
+//
+// The Remove field of cfg is ignored, and its UpdateOnly field is always set.
+func (c *Client) UpdatePeer(name string, cfg wgtypes.PeerConfig) error {
+	cfg.Remove = false
+	cfg.UpdateOnly = true
+
+	return c.configurePeer(name, cfg)
+}
+
+// RemovePeer removes the peer with public key from the device specified by
+// name. If the peer does not exist, the device is left unchanged and no error
+// is returned.
+func (c *Client) RemovePeer(name string, key wgtypes.Key) error {
+	return c.configurePeer(name, wgtypes.PeerConfig{
+		PublicKey: key,
+		Remove:    true,
+	})
+}
+
+// configurePeer applies a Config which only contains cfg to the device
+// specified by name.
+func (c *Client) configurePeer(name string, cfg wgtypes.PeerConfig) error {
+	return c.ConfigureDevice(name, wgtypes.Config{Peers: []wgtypes.PeerConfig{cfg}})
+}
+
+// primaryEndpoints returns cfg with the endpoint of each peer which has none
+// set to the first of its AlternateEndpoints. cfg is not modified.
+func primaryEndpoints(cfg wgtypes.Config) wgtypes.Config {
+	var peers []wgtypes.PeerConfig
+	for i, p := range cfg.Peers {
+		if p.Endpoint != nil || len(p.AlternateEndpoints) == 0 {
+			continue
+		}
+
+		if peers == nil {
+			peers = append([]wgtypes.PeerConfig(nil), cfg.Peers...)
+		}
+		peers[i].Endpoint = p.AlternateEndpoints[0]
+	}
+
+	if peers != nil {
+		cfg.Peers = peers
+	}
+
+	return cfg
+}
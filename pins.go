@@ -0,0 +1,396 @@
+package wgctrl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgstore"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// DefaultEndpointPinsNamespace is the wgstore namespace used by EndpointPins
+// with no Namespace set.
+const DefaultEndpointPinsNamespace = "wgctrl.endpoints"
+
+const (
+	// defaultPinMaxAge is the default value for EndpointPins.MaxAge, after
+	// which WireGuard no longer uses a session (Reject-After-Time).
+	defaultPinMaxAge = 3 * time.Minute
+
+	// defaultPinInterval is the default value for EndpointPins.Interval.
+	defaultPinInterval = time.Minute
+)
+
+// EndpointPins records the last known good endpoint of each peer, from which
+// it most recently completed a handshake, so that the endpoint can be applied
+// again once its device is restarted. A hub can then reach peers behind
+// stable NATs, which have roamed from their configured endpoint or have none,
+// without waiting for them to initiate a handshake.
+//
+// Record stores the endpoints of peers, and Restore applies them to peers
+// which have not completed a handshake since they were configured. Run does
+// both periodically. With WithEndpointPins, ConfigureDevice also applies the
+// stored endpoint of each peer which would otherwise have none.
+//
+// Endpoints are kept in a wgstore.Store so that they survive restarts. Those
+// of peers which are removed from a device are kept, so that they are
+// available if the peer is added again. EndpointPins is safe for concurrent
+// use, but a Store should not be shared by multiple EndpointPins using the
+// same Namespace.
+type EndpointPins struct {
+	// Store is the underlying key/value store.
+	Store wgstore.Store
+
+	// Namespace is the namespace of the stored endpoints. If empty,
+	// DefaultEndpointPinsNamespace is used.
+	Namespace string
+
+	// MaxAge is the maximum age of the most recent handshake of a peer for
+	// its endpoint to be recorded. If zero, a default of 3 minutes is used.
+	MaxAge time.Duration
+
+	// Interval is the amount of time between calls to Restore and Record
+	// performed by Run. If zero or negative, a default of 1 minute is used.
+	Interval time.Duration
+
+	// OnError, if set, is called with any error returned by Restore or
+	// Record from Run. Errors do not stop Run.
+	OnError func(err error)
+
+	mu sync.Mutex
+
+	// now may be replaced in tests.
+	now func() time.Time
+}
+
+// WithEndpointPins applies the endpoint recorded by p to each peer passed to
+// ConfigureDevice which would otherwise have no endpoint once the
+// configuration is applied: a peer which is added or replaced, or which has
+// no endpoint on the device, and whose configuration does not set one.
+// Endpoints which are applied are checked by WithEndpointPolicy.
+func WithEndpointPins(p *EndpointPins) Option {
+	return func(o *options) {
+		o.pins = p
+	}
+}
+
+// A pinnedEndpoint is the stored form of a recorded endpoint.
+type pinnedEndpoint struct {
+	Endpoint string    `json:"endpoint"`
+	Time     time.Time `json:"time"`
+}
+
+// Endpoint returns the endpoint recorded for the peer identified by key on the
+// device specified by name, or nil if no endpoint has been recorded.
+func (p *EndpointPins) Endpoint(name string, key wgtypes.Key) (*net.UDPAddr, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pins, err := p.load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pin, ok := pins[key.String()]
+	if !ok {
+		return nil, nil
+	}
+
+	return pin.addr(name)
+}
+
+// Record records the endpoint of each peer which completed a handshake within
+// MaxAge on the devices specified by names, or on every device if names is
+// empty. Every device is checked, and an error joining the errors of each
+// device which could not be checked or recorded is returned.
+func (p *EndpointPins) Record(c *Client, names ...string) error {
+	devices, errs, err := c.namedDevices(names)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		if err := p.record(d); err != nil {
+			errs = append(errs, fmt.Errorf("wgctrl: device %q: failed to record endpoints: %w", d.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// record records the endpoints of the peers of d, saving them only if they
+// have changed.
+func (p *EndpointPins) record(d *wgtypes.Device) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pins, err := p.load(d.Name)
+	if err != nil {
+		return err
+	}
+
+	var (
+		now     = p.timeNow()
+		maxAge  = p.maxAge()
+		changed bool
+	)
+
+	for _, peer := range d.Peers {
+		if peer.Endpoint == nil || peer.LastHandshakeTime.IsZero() || now.Sub(peer.LastHandshakeTime) > maxAge {
+			continue
+		}
+
+		key := peer.PublicKey.String()
+		if pins[key].Endpoint == peer.Endpoint.String() {
+			continue
+		}
+
+		if pins == nil {
+			pins = make(map[string]pinnedEndpoint)
+		}
+		pins[key] = pinnedEndpoint{
+			Endpoint: peer.Endpoint.String(),
+			Time:     peer.LastHandshakeTime,
+		}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return p.save(d.Name, pins)
+}
+
+// Restore applies the recorded endpoint of each peer on the devices specified
+// by names, or on every device if names is empty, which has not completed a
+// handshake since it was configured and whose endpoint differs from the one
+// recorded. Every device is checked, and an error joining the errors of each
+// device which could not be checked or configured is returned.
+func (p *EndpointPins) Restore(c *Client, names ...string) error {
+	devices, errs, err := c.namedDevices(names)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		cfg, err := p.restoreConfig(d)
+		if err == nil && len(cfg.Peers) > 0 {
+			err = c.ConfigureDevice(d.Name, cfg)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("wgctrl: device %q: failed to restore endpoints: %w", d.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// restoreConfig returns the configuration which applies the recorded
+// endpoints of the peers of d for Restore.
+func (p *EndpointPins) restoreConfig(d *wgtypes.Device) (wgtypes.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pins, err := p.load(d.Name)
+	if err != nil || len(pins) == 0 {
+		return wgtypes.Config{}, err
+	}
+
+	var cfg wgtypes.Config
+	for _, peer := range d.Peers {
+		pin, ok := pins[peer.PublicKey.String()]
+		if !ok || !peer.LastHandshakeTime.IsZero() {
+			continue
+		}
+		if peer.Endpoint != nil && peer.Endpoint.String() == pin.Endpoint {
+			continue
+		}
+
+		addr, err := pin.addr(d.Name)
+		if err != nil {
+			return wgtypes.Config{}, err
+		}
+
+		cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{
+			PublicKey:  peer.PublicKey,
+			UpdateOnly: true,
+			Endpoint:   addr,
+		})
+	}
+
+	return cfg, nil
+}
+
+// Run calls Restore and Record for the devices specified by names immediately
+// and then every Interval until ctx is canceled. Run always returns a non-nil
+// error.
+func (p *EndpointPins) Run(ctx context.Context, c *Client, names ...string) error {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = defaultPinInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		p.report(p.Restore(c, names...))
+		p.report(p.Record(c, names...))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// report passes a non-nil err to OnError, if set.
+func (p *EndpointPins) report(err error) {
+	if err != nil && p.OnError != nil {
+		p.OnError(err)
+	}
+}
+
+// pinEndpoints applies the endpoints recorded by c.pins to cfg, fetching the
+// current state of the device specified by name only if it is needed.
+func (c *Client) pinEndpoints(ctx context.Context, name string, cfg wgtypes.Config) (wgtypes.Config, error) {
+	var cur *wgtypes.Device
+	if !cfg.ReplacePeers && len(cfg.Peers) > 0 {
+		d, err := c.device(ctx, name)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// Let the implementation report the missing device.
+		case err != nil:
+			return wgtypes.Config{}, err
+		default:
+			cur = d
+		}
+	}
+
+	return c.pins.apply(name, cfg, cur)
+}
+
+// apply returns cfg with the recorded endpoints set for each peer which would
+// otherwise have no endpoint once cfg is applied to cur, which may be nil for
+// a device which has no existing peers.
+func (p *EndpointPins) apply(name string, cfg wgtypes.Config, cur *wgtypes.Device) (wgtypes.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pins, err := p.load(name)
+	if err != nil || len(pins) == 0 {
+		return cfg, err
+	}
+
+	existing := make(map[wgtypes.Key]wgtypes.Peer)
+	if cur != nil && !cfg.ReplacePeers {
+		for _, peer := range cur.Peers {
+			existing[peer.PublicKey] = peer
+		}
+	}
+
+	var peers []wgtypes.PeerConfig
+	for i, pc := range cfg.Peers {
+		if pc.Remove || pc.Endpoint != nil {
+			continue
+		}
+		if peer, ok := existing[pc.PublicKey]; ok && peer.Endpoint != nil {
+			continue
+		}
+
+		pin, ok := pins[pc.PublicKey.String()]
+		if !ok {
+			continue
+		}
+
+		addr, err := pin.addr(name)
+		if err != nil {
+			return wgtypes.Config{}, err
+		}
+
+		// Copy the peers so that the caller's configuration is unchanged.
+		if peers == nil {
+			peers = append([]wgtypes.PeerConfig(nil), cfg.Peers...)
+		}
+		peers[i].Endpoint = addr
+	}
+
+	if peers != nil {
+		cfg.Peers = peers
+	}
+
+	return cfg, nil
+}
+
+// load returns the stored endpoints for the device specified by name, keyed by
+// peer public key.
+func (p *EndpointPins) load(name string) (map[string]pinnedEndpoint, error) {
+	b, err := p.Store.Get(p.namespace(), name)
+	switch {
+	case errors.Is(err, wgstore.ErrNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var pins map[string]pinnedEndpoint
+	if err := json.Unmarshal(b, &pins); err != nil {
+		return nil, fmt.Errorf("wgctrl: invalid endpoints for device %q: %w", name, err)
+	}
+
+	return pins, nil
+}
+
+// save replaces the stored endpoints for the device specified by name.
+func (p *EndpointPins) save(name string, pins map[string]pinnedEndpoint) error {
+	b, err := json.Marshal(pins)
+	if err != nil {
+		return err
+	}
+
+	return p.Store.Put(p.namespace(), name, b)
+}
+
+func (p *EndpointPins) namespace() string {
+	if p.Namespace != "" {
+		return p.Namespace
+	}
+
+	return DefaultEndpointPinsNamespace
+}
+
+func (p *EndpointPins) maxAge() time.Duration {
+	if p.MaxAge > 0 {
+		return p.MaxAge
+	}
+
+	return defaultPinMaxAge
+}
+
+// timeNow returns the current time from p.now, or time.Now.
+func (p *EndpointPins) timeNow() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+
+	return time.Now()
+}
+
+// addr parses the stored endpoint of a peer on the device specified by name.
+func (pe pinnedEndpoint) addr(name string) (*net.UDPAddr, error) {
+	ap, err := netip.ParseAddrPort(pe.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("wgctrl: invalid endpoint for device %q: %w", name, err)
+	}
+
+	return net.UDPAddrFromAddrPort(ap), nil
+}
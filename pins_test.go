@@ -0,0 +1,142 @@
+package wgctrl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgstore"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEndpointPins(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		keyC = wgtest.MustPublicKey()
+
+		now = time.Unix(1700000000, 0)
+
+		roamed  = &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 41000}
+		stale   = &net.UDPAddr{IP: net.IPv4(198, 51, 100, 2), Port: 41000}
+		static  = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51820}
+		roamed6 = &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 41000}
+	)
+
+	devices := map[string]*wgtypes.Device{
+		"wg0": {Name: "wg0", Peers: []wgtypes.Peer{
+			// Recent handshake from a roamed endpoint.
+			{PublicKey: keyA, Endpoint: roamed, LastHandshakeTime: now.Add(-time.Minute)},
+			// Handshake too long ago.
+			{PublicKey: keyB, Endpoint: stale, LastHandshakeTime: now.Add(-time.Hour)},
+			// Recent handshake over IPv6.
+			{PublicKey: keyC, Endpoint: roamed6, LastHandshakeTime: now.Add(-time.Second)},
+		}},
+	}
+
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DevicesFunc: func() ([]*wgtypes.Device, error) {
+				return []*wgtypes.Device{devices["wg0"]}, nil
+			},
+			DeviceFunc: func(name string) (*wgtypes.Device, error) {
+				d, ok := devices[name]
+				if !ok {
+					return nil, os.ErrNotExist
+				}
+
+				return d, nil
+			},
+			ConfigureDeviceFunc: func(name string, cfg wgtypes.Config) error {
+				devices[name] = wgtypes.Preview(devices[name], cfg)
+				return nil
+			},
+		}},
+	}
+
+	p := &EndpointPins{
+		Store: &wgstore.MemoryStore{},
+		now:   func() time.Time { return now },
+	}
+	c.pins = p
+
+	if err := p.Record(c); err != nil {
+		t.Fatalf("failed to record endpoints: %v", err)
+	}
+
+	for _, tt := range []struct {
+		key  wgtypes.Key
+		want *net.UDPAddr
+	}{
+		{key: keyA, want: roamed},
+		{key: keyB},
+		{key: keyC, want: roamed6},
+	} {
+		got, err := p.Endpoint("wg0", tt.key)
+		if err != nil {
+			t.Fatalf("failed to get endpoint: %v", err)
+		}
+		if diff := cmp.Diff(tt.want.String(), got.String()); diff != "" {
+			t.Fatalf("unexpected endpoint for %s (-want +got):\n%s", tt.key, diff)
+		}
+	}
+
+	// Simulate a restart of the device from its static configuration, in
+	// which peer A has its original endpoint and peer C has none.
+	devices["wg0"] = &wgtypes.Device{Name: "wg0", Peers: []wgtypes.Peer{
+		{PublicKey: keyA, Endpoint: static},
+		{PublicKey: keyB, Endpoint: static, LastHandshakeTime: now},
+	}}
+
+	// Adding peer C applies its recorded endpoint, and leaves the caller's
+	// configuration unchanged.
+	cfg := wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: keyC}}}
+	if err := c.ConfigureDevice("wg0", cfg); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+	if cfg.Peers[0].Endpoint != nil {
+		t.Fatal("caller's configuration was modified")
+	}
+
+	// Restoring applies the recorded endpoint of peer A, which has not yet
+	// completed a handshake. Peer B has, so its endpoint is kept.
+	if err := p.Restore(c, "wg0"); err != nil {
+		t.Fatalf("failed to restore endpoints: %v", err)
+	}
+
+	got := make(map[wgtypes.Key]string)
+	for _, peer := range devices["wg0"].Peers {
+		got[peer.PublicKey] = peer.Endpoint.String()
+	}
+
+	want := map[wgtypes.Key]string{
+		keyA: roamed.String(),
+		keyB: static.String(),
+		keyC: roamed6.String(),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected endpoints (-want +got):\n%s", diff)
+	}
+
+	if err := p.Restore(c, "wg1"); err == nil {
+		t.Fatal("expected an error for a missing device, but none occurred")
+	}
+}
+
+func TestEndpointPinsRunNegativeInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A negative interval uses the default rather than panicking.
+	p := &EndpointPins{Interval: -time.Second}
+
+	if err := p.Run(ctx, &Client{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, but got: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package wgctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// PrivateNetworks are the IPv4 private address ranges of RFC 1918 and the
+// IPv6 unique local address range of RFC 4193, for use with EndpointPolicy.
+var PrivateNetworks = []net.IPNet{
+	mustCIDR("10.0.0.0/8"),
+	mustCIDR("172.16.0.0/12"),
+	mustCIDR("192.168.0.0/16"),
+	mustCIDR("fc00::/7"),
+}
+
+// An EndpointPolicy restricts the peer endpoints which may be applied by
+// ConfigureDevice. It is enabled using WithEndpointPolicy.
+type EndpointPolicy struct {
+	// Allow, if not empty, requires every endpoint to fall within one of
+	// the networks.
+	Allow []net.IPNet
+
+	// Deny rejects endpoints which fall within any of the networks, such as
+	// PrivateNetworks on a node which must only reach peers over the
+	// internet. Deny takes precedence over Allow.
+	Deny []net.IPNet
+
+	// DenyAllowedIPs rejects endpoints which fall within the allowed IPs of
+	// any peer on the device once the configuration is applied. Traffic to
+	// such an endpoint would be routed through the tunnel itself, a routing
+	// loop which takes the tunnel and often the node offline.
+	DenyAllowedIPs bool
+}
+
+// WithEndpointPolicy checks each configuration passed to ConfigureDevice
+// against p. A configuration which violates p is rejected with a
+// *wgtypes.ValidationError, and is not applied.
+func WithEndpointPolicy(p EndpointPolicy) Option {
+	return func(o *options) {
+		o.policy = &p
+	}
+}
+
+// Check checks the peer endpoints in cfg against p, and returns a
+// *wgtypes.ValidationError describing the first violation it finds. cur is the
+// current state of the device cfg will be applied to, and is used to determine
+// its allowed IPs when DenyAllowedIPs is set. cur may be nil for a device
+// which has no existing peers.
+func (p EndpointPolicy) Check(cfg wgtypes.Config, cur *wgtypes.Device) error {
+	var allowed []net.IPNet
+	if p.DenyAllowedIPs {
+		allowed = effectiveAllowedIPs(cfg, cur)
+	}
+
+	for _, pc := range cfg.Peers {
+		if pc.Remove {
+			continue
+		}
+
+		// Alternate endpoints are checked up front, because they may be
+		// configured later by a failover controller.
+		if err := p.check(pc, "Endpoint", pc.Endpoint, allowed); err != nil {
+			return err
+		}
+		for _, ep := range pc.AlternateEndpoints {
+			if err := p.check(pc, "AlternateEndpoints", ep, allowed); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// check checks a single endpoint of pc, reported as field, against p.
+func (p EndpointPolicy) check(pc wgtypes.PeerConfig, field string, ep *net.UDPAddr, allowed []net.IPNet) error {
+	if ep == nil {
+		return nil
+	}
+
+	ip := ep.IP
+	invalid := func(format string, v ...interface{}) error {
+		key := pc.PublicKey
+		return &wgtypes.ValidationError{
+			Peer:   &key,
+			Field:  field,
+			Reason: fmt.Sprintf(format, v...),
+		}
+	}
+
+	if n, ok := containedBy(ip, p.Deny); ok {
+		return invalid("%s is in denied network %s", ip, n.String())
+	}
+	if len(p.Allow) > 0 {
+		if _, ok := containedBy(ip, p.Allow); !ok {
+			return invalid("%s is not in an allowed network", ip)
+		}
+	}
+	if n, ok := containedBy(ip, allowed); ok {
+		return invalid("%s is routed through the tunnel by allowed IP %s", ip, n.String())
+	}
+
+	return nil
+}
+
+// checkPolicy checks cfg against c's endpoint policy, if any.
+func (c *Client) checkPolicy(ctx context.Context, name string, cfg wgtypes.Config) error {
+	if c.policy == nil {
+		return nil
+	}
+
+	var cur *wgtypes.Device
+	if c.policy.DenyAllowedIPs && !cfg.ReplacePeers {
+		d, err := c.device(ctx, name)
+		switch {
+		case err == nil:
+			cur = d
+		case errors.Is(err, os.ErrNotExist):
+			// ConfigureDevice reports the missing device.
+		default:
+			return err
+		}
+	}
+
+	return c.policy.Check(cfg, cur)
+}
+
+// effectiveAllowedIPs returns the allowed IPs of all peers on cur once cfg is
+// applied.
+func effectiveAllowedIPs(cfg wgtypes.Config, cur *wgtypes.Device) []net.IPNet {
+	peers := make(map[wgtypes.Key][]net.IPNet)
+	if cur != nil && !cfg.ReplacePeers {
+		for _, p := range cur.Peers {
+			peers[p.PublicKey] = p.AllowedIPs
+		}
+	}
+
+	for _, pc := range cfg.Peers {
+		ips, ok := peers[pc.PublicKey]
+		switch {
+		case pc.Remove:
+			delete(peers, pc.PublicKey)
+			continue
+		case pc.UpdateOnly && !ok:
+			continue
+		case pc.ReplaceAllowedIPs:
+			ips = nil
+		}
+
+		peers[pc.PublicKey] = append(append([]net.IPNet(nil), ips...), pc.AllowedIPs...)
+	}
+
+	var out []net.IPNet
+	for _, ips := range peers {
+		out = append(out, ips...)
+	}
+
+	return out
+}
+
+// containedBy returns the first network in ns which contains ip.
+func containedBy(ip net.IP, ns []net.IPNet) (net.IPNet, bool) {
+	for _, n := range ns {
+		if n.Contains(ip) {
+			return n, true
+		}
+	}
+
+	return net.IPNet{}, false
+}
+
+// mustCIDR parses a CIDR string or panics.
+func mustCIDR(s string) net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(fmt.Sprintf("wgctrl: failed to parse CIDR: %v", err))
+	}
+
+	return *n
+}
@@ -0,0 +1,164 @@
+package wgctrl
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+func TestEndpointPolicyCheck(t *testing.T) {
+	var (
+		peerA = wgtest.MustPublicKey()
+		peerB = wgtest.MustPublicKey()
+
+		cur = &wgtypes.Device{
+			Peers: []wgtypes.Peer{{
+				PublicKey:  peerB,
+				AllowedIPs: []net.IPNet{wgtest.MustCIDR("198.51.100.0/24")},
+			}},
+		}
+	)
+
+	peer := func(endpoint string, allowed ...string) wgtypes.PeerConfig {
+		pc := wgtypes.PeerConfig{
+			PublicKey: peerA,
+			Endpoint:  wgtest.MustUDPAddr(endpoint),
+		}
+		for _, a := range allowed {
+			pc.AllowedIPs = append(pc.AllowedIPs, wgtest.MustCIDR(a))
+		}
+
+		return pc
+	}
+
+	tests := []struct {
+		name string
+		p    EndpointPolicy
+		cfg  wgtypes.Config
+		cur  *wgtypes.Device
+		ok   bool
+	}{
+		{
+			name: "OK empty policy",
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{peer("10.0.0.1:51820")}},
+			ok:   true,
+		},
+		{
+			name: "denied private",
+			p:    EndpointPolicy{Deny: PrivateNetworks},
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{peer("192.168.1.1:51820")}},
+		},
+		{
+			name: "denied private IPv6",
+			p:    EndpointPolicy{Deny: PrivateNetworks},
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{peer("[fd00::1]:51820")}},
+		},
+		{
+			name: "not allowed",
+			p:    EndpointPolicy{Allow: []net.IPNet{wgtest.MustCIDR("192.0.2.0/24")}},
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{peer("203.0.113.1:51820")}},
+		},
+		{
+			name: "denied alternate",
+			p:    EndpointPolicy{Deny: PrivateNetworks},
+			cfg: wgtypes.Config{Peers: []wgtypes.PeerConfig{{
+				PublicKey:          peerA,
+				Endpoint:           wgtest.MustUDPAddr("192.0.2.1:51820"),
+				AlternateEndpoints: []*net.UDPAddr{wgtest.MustUDPAddr("10.0.0.1:51820")},
+			}}},
+		},
+		{
+			name: "OK allowed",
+			p:    EndpointPolicy{Allow: []net.IPNet{wgtest.MustCIDR("192.0.2.0/24")}},
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{peer("192.0.2.1:51820")}},
+			ok:   true,
+		},
+		{
+			name: "loop in own allowed IPs",
+			p:    EndpointPolicy{DenyAllowedIPs: true},
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{peer("192.0.2.1:51820", "0.0.0.0/0")}},
+		},
+		{
+			name: "loop in existing peer",
+			p:    EndpointPolicy{DenyAllowedIPs: true},
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{peer("198.51.100.1:51820")}},
+			cur:  cur,
+		},
+		{
+			name: "OK existing peer replaced",
+			p:    EndpointPolicy{DenyAllowedIPs: true},
+			cfg: wgtypes.Config{
+				ReplacePeers: true,
+				Peers:        []wgtypes.PeerConfig{peer("198.51.100.1:51820")},
+			},
+			cur: cur,
+			ok:  true,
+		},
+		{
+			name: "OK existing peer removed",
+			p:    EndpointPolicy{DenyAllowedIPs: true},
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					peer("198.51.100.1:51820"),
+					{PublicKey: peerB, Remove: true},
+				},
+			},
+			cur: cur,
+			ok:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Check(tt.cfg, tt.cur)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to check policy: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if err == nil {
+				return
+			}
+
+			var verr *wgtypes.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected *wgtypes.ValidationError, but got: %T", err)
+			}
+		})
+	}
+}
+
+func TestClientConfigureDeviceEndpointPolicy(t *testing.T) {
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DeviceFunc: func(_ string) (*wgtypes.Device, error) {
+				return &wgtypes.Device{
+					Peers: []wgtypes.Peer{{
+						AllowedIPs: []net.IPNet{wgtest.MustCIDR("0.0.0.0/0")},
+					}},
+				}, nil
+			},
+			ConfigureDeviceFunc: func(_ string, _ wgtypes.Config) error {
+				panic("policy violation should not be applied")
+			},
+		}},
+		policy: &EndpointPolicy{DenyAllowedIPs: true},
+	}
+
+	err := c.ConfigureDevice("wg0", wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey: wgtest.MustPublicKey(),
+			Endpoint:  wgtest.MustUDPAddr("192.0.2.1:51820"),
+		}},
+	})
+
+	var verr *wgtypes.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *wgtypes.ValidationError, but got: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package wgctrl
+
+import (
+	"runtime"
+
+	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// A ProbeReport describes the WireGuard implementations found on this system
+// by Probe.
+type ProbeReport struct {
+	// OS is the operating system, as reported by runtime.GOOS.
+	OS string
+
+	// Backends describes each implementation considered for each client
+	// type. Available implementations are listed in the order a Client of
+	// that type uses them.
+	Backends []BackendStatus
+}
+
+// A BackendStatus describes a single WireGuard implementation.
+type BackendStatus struct {
+	// ClientType is the type of Client which uses the implementation.
+	ClientType wgtypes.ClientType
+
+	// Type is the type of devices managed by the implementation.
+	Type wgtypes.DeviceType
+
+	// Available reports whether the implementation can be used.
+	Available bool
+
+	// Version describes the version of the implementation, such as the
+	// kernel module and generic netlink family versions on Linux, or is
+	// empty if it can't be determined.
+	Version string
+
+	// Devices lists the names of the devices managed by the implementation.
+	// For userspace implementations, each device is served by a running
+	// daemon.
+	Devices []string
+
+	// Err describes why the implementation is unavailable, or why its
+	// devices could not be listed.
+	Err error
+}
+
+// Plan returns the types of devices a Client of clientType would use, in
+// order, leaving out implementations which are unavailable.
+func (r *ProbeReport) Plan(clientType wgtypes.ClientType) []wgtypes.DeviceType {
+	var dts []wgtypes.DeviceType
+	for _, b := range r.Backends {
+		if b.ClientType == clientType && b.Available {
+			dts = append(dts, b.Type)
+		}
+	}
+
+	return dts
+}
+
+// Probe reports which WireGuard and AmneziaWG implementations are available on
+// this system, their versions where known, and the devices each of them
+// manages, for use by installers and in bug reports.
+func Probe() (*ProbeReport, error) {
+	r := &ProbeReport{OS: runtime.GOOS}
+	for _, clientType := range []wgtypes.ClientType{wgtypes.NativeClient, wgtypes.AmneziaClient} {
+		c, err := New(clientType)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Backends = append(r.Backends, c.probe()...)
+		_ = c.Close()
+	}
+
+	return r, nil
+}
+
+// probe returns the status of each of c's implementations.
+func (c *Client) probe() []BackendStatus {
+	var bs []BackendStatus
+	for _, wgc := range c.cs {
+		b := BackendStatus{
+			ClientType: c.clientType,
+			Available:  true,
+			Version:    backendVersion(wgc, c.clientType),
+		}
+
+		if t, ok := wgc.(wginternal.Typer); ok {
+			b.Type = t.DeviceType()
+		}
+		if p, ok := wgc.(wginternal.Prober); ok {
+			if err := p.Probe(); err != nil {
+				b.Available, b.Err = false, err
+				bs = append(bs, b)
+				continue
+			}
+		}
+
+		devices, err := wgc.Devices()
+		if err != nil {
+			b.Err = err
+		}
+		for _, d := range devices {
+			b.Devices = append(b.Devices, d.Name)
+		}
+
+		bs = append(bs, b)
+	}
+
+	for _, u := range c.unavailable {
+		bs = append(bs, BackendStatus{
+			ClientType: c.clientType,
+			Type:       u.Type,
+			Err:        u.Err,
+		})
+	}
+
+	return bs
+}
@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package wgctrl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/danpashin/wgctrl/internal/wglinux"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// backendVersion returns the versions of the kernel module and generic
+// netlink family used by the Linux kernel implementation.
+func backendVersion(wgc wginternal.Client, clientType wgtypes.ClientType) string {
+	kc, ok := wgc.(*wglinux.Client)
+	if !ok {
+		return ""
+	}
+
+	module := "wireguard"
+	if clientType == wgtypes.AmneziaClient {
+		module = "amneziawg"
+	}
+
+	_, f := kc.Conn()
+	genl := fmt.Sprintf("genl %s v%d", f.Name, f.Version)
+
+	// Modules which are built into the kernel may not report a version.
+	b, err := os.ReadFile("/sys/module/" + module + "/version")
+	if err != nil {
+		return genl
+	}
+
+	return fmt.Sprintf("%s %s, %s", module, strings.TrimSpace(string(b)), genl)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package wgctrl
+
+import (
+	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// backendVersion returns an empty string, as implementation versions can
+// only be determined on Linux.
+func backendVersion(_ wginternal.Client, _ wgtypes.ClientType) string {
+	return ""
+}
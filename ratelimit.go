@@ -0,0 +1,303 @@
+package wgctrl
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// WithRateLimit limits the rate at which Client.ConfigureDevice configures
+// each device, using a token bucket which holds up to burst tokens and gains
+// one token every interval. This protects the kernel or userspace
+// implementation from controllers which reconfigure devices in a tight loop.
+//
+// A call which exceeds the limit blocks until the device may be configured
+// again, or until its context is done, in which case its configuration is not
+// applied. Calls for the same device which are waiting together are coalesced
+// into a single configuration, applied in the order the calls were made, and
+// each call returns the result of that configuration. A non-positive interval
+// or burst disables rate limiting.
+func WithRateLimit(interval time.Duration, burst int) Option {
+	return func(o *options) {
+		o.rateInterval = interval
+		o.rateBurst = burst
+	}
+}
+
+// A rateLimiter limits the rate of configuration changes for each device.
+type rateLimiter struct {
+	interval time.Duration
+	burst    int
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration)
+
+	mu      sync.Mutex
+	devices map[string]*deviceLimiter
+
+	// pruned is the last time idle limiters were removed from devices.
+	pruned time.Time
+}
+
+// A deviceLimiter is the token bucket and queue of pending changes for a
+// single device.
+type deviceLimiter struct {
+	tokens float64
+	last   time.Time
+
+	// busy is set while a caller is waiting for a token or applying changes;
+	// other callers queue behind it.
+	busy  bool
+	queue []*pendingChange
+}
+
+// A pendingChange is a configuration waiting for its device's rate limit.
+type pendingChange struct {
+	cfg wgtypes.Config
+
+	// done is closed once err is set, or once lead is set if this change's
+	// caller must apply the queue.
+	done chan struct{}
+	err  error
+	lead bool
+}
+
+// newRateLimiter creates a rateLimiter, or returns nil if the arguments
+// disable rate limiting.
+func newRateLimiter(interval time.Duration, burst int) *rateLimiter {
+	if interval <= 0 || burst <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		interval: interval,
+		burst:    burst,
+		now:      time.Now,
+		sleep:    sleep,
+		devices:  make(map[string]*deviceLimiter),
+	}
+}
+
+// do applies cfg to the device specified by name using apply once the
+// device's rate limit permits, coalescing it with any other queued changes.
+// If ctx is done before cfg is applied, do returns the error of ctx.
+func (l *rateLimiter) do(ctx context.Context, name string, cfg wgtypes.Config, apply func(cfg wgtypes.Config) error) error {
+	p := &pendingChange{cfg: cfg, done: make(chan struct{})}
+
+	l.mu.Lock()
+	now := l.now()
+	l.prune(now)
+
+	dl, ok := l.devices[name]
+	if !ok {
+		dl = &deviceLimiter{tokens: float64(l.burst), last: now}
+		l.devices[name] = dl
+	}
+	dl.queue = append(dl.queue, p)
+
+	if dl.busy {
+		// Another caller will apply this change, or hand the queue over to
+		// this caller once it is done.
+		l.mu.Unlock()
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+		}
+
+		l.mu.Lock()
+		if !p.lead {
+			if dl.remove(p) {
+				// ctx is done while the change is still queued.
+				l.mu.Unlock()
+				return ctx.Err()
+			}
+			l.mu.Unlock()
+
+			// Another caller is applying the change.
+			<-p.done
+			return p.err
+		}
+	}
+	dl.busy = true
+
+	for {
+		if err := ctx.Err(); err != nil {
+			// Leave the remaining changes to the next caller.
+			dl.remove(p)
+			dl.handOver()
+			l.mu.Unlock()
+			return err
+		}
+
+		wait := dl.reserve(l.now(), l.interval, l.burst)
+		if wait <= 0 {
+			break
+		}
+
+		l.mu.Unlock()
+		l.sleep(ctx, wait)
+		l.mu.Lock()
+	}
+
+	batch := dl.queue
+	dl.queue = nil
+	l.mu.Unlock()
+
+	err := apply(coalesce(batch))
+
+	// Changes which arrived while applying this batch now wait for the next
+	// token.
+	l.mu.Lock()
+	dl.handOver()
+	l.mu.Unlock()
+
+	for _, b := range batch {
+		if b != p {
+			b.err = err
+			close(b.done)
+		}
+	}
+
+	return err
+}
+
+// prune removes the limiters of idle devices whose buckets have refilled, as
+// they are equivalent to new limiters. It scans devices at most once for each
+// interval, so that its cost is spread across calls.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < l.interval {
+		return
+	}
+	l.pruned = now
+
+	for name, dl := range l.devices {
+		refill := time.Duration((float64(l.burst) - dl.tokens) * float64(l.interval))
+		if !dl.busy && now.Sub(dl.last) >= refill {
+			delete(l.devices, name)
+		}
+	}
+}
+
+// handOver makes the caller of the first queued change apply the queue, or
+// marks dl idle if no changes are queued. The rateLimiter's mu must be held.
+func (dl *deviceLimiter) handOver() {
+	if len(dl.queue) == 0 {
+		dl.busy = false
+		return
+	}
+
+	next := dl.queue[0]
+	next.lead = true
+	close(next.done)
+}
+
+// remove removes p from the queue, reporting whether it was queued.
+func (dl *deviceLimiter) remove(p *pendingChange) bool {
+	for i, q := range dl.queue {
+		if q == p {
+			dl.queue = append(dl.queue[:i], dl.queue[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// reserve takes a token from the bucket at time now, or returns how long to
+// wait until a token is available.
+func (dl *deviceLimiter) reserve(now time.Time, interval time.Duration, burst int) time.Duration {
+	dl.tokens += float64(now.Sub(dl.last)) / float64(interval)
+	if dl.tokens > float64(burst) {
+		dl.tokens = float64(burst)
+	}
+	dl.last = now
+
+	if dl.tokens >= 1 {
+		dl.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - dl.tokens) * float64(interval))
+}
+
+// sleep waits for d to elapse, or for ctx to be done.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// coalesce combines the configurations of changes into one which has the same
+// effect as applying each configuration in order.
+func coalesce(changes []*pendingChange) wgtypes.Config {
+	var out wgtypes.Config
+	for _, ch := range changes {
+		cfg := ch.cfg
+
+		if cfg.PrivateKey != nil {
+			out.PrivateKey = cfg.PrivateKey
+		}
+		if cfg.ListenPort != nil {
+			out.ListenPort = cfg.ListenPort
+		}
+		if cfg.FirewallMark != nil {
+			out.FirewallMark = cfg.FirewallMark
+		}
+		out.AdvancedSecurityConfig = coalesceAdvancedSecurity(out.AdvancedSecurityConfig, cfg.AdvancedSecurityConfig)
+
+		// Replacing peers discards the peer changes of every earlier
+		// configuration. Otherwise, changes to the same peer are applied in
+		// order by the implementation.
+		if cfg.ReplacePeers {
+			out.ReplacePeers = true
+			out.Peers = nil
+		}
+		out.Peers = append(out.Peers, cfg.Peers...)
+	}
+
+	return out
+}
+
+// coalesceAdvancedSecurity returns a with each field set in b replaced.
+func coalesceAdvancedSecurity(a, b wgtypes.AdvancedSecurityConfig) wgtypes.AdvancedSecurityConfig {
+	set16 := func(dst **uint16, src *uint16) {
+		if src != nil {
+			*dst = src
+		}
+	}
+	set32 := func(dst **uint32, src *uint32) {
+		if src != nil {
+			*dst = src
+		}
+	}
+	setString := func(dst **string, src *string) {
+		if src != nil {
+			*dst = src
+		}
+	}
+
+	set16(&a.JunkPacketCount, b.JunkPacketCount)
+	set16(&a.JunkPacketMinSize, b.JunkPacketMinSize)
+	set16(&a.JunkPacketMaxSize, b.JunkPacketMaxSize)
+	set16(&a.InitPacketJunkSize, b.InitPacketJunkSize)
+	set16(&a.ResponsePacketJunkSize, b.ResponsePacketJunkSize)
+	set16(&a.UnderloadPacketJunkSize, b.UnderloadPacketJunkSize)
+	set16(&a.TransportPacketJunkSize, b.TransportPacketJunkSize)
+	set32(&a.InitPacketMagicHeader, b.InitPacketMagicHeader)
+	set32(&a.ResponsePacketMagicHeader, b.ResponsePacketMagicHeader)
+	set32(&a.UnderloadPacketMagicHeader, b.UnderloadPacketMagicHeader)
+	set32(&a.TransportPacketMagicHeader, b.TransportPacketMagicHeader)
+	setString(&a.SpecialJunkPacket1, b.SpecialJunkPacket1)
+	setString(&a.SpecialJunkPacket2, b.SpecialJunkPacket2)
+	setString(&a.SpecialJunkPacket3, b.SpecialJunkPacket3)
+	setString(&a.SpecialJunkPacket4, b.SpecialJunkPacket4)
+	setString(&a.SpecialJunkPacket5, b.SpecialJunkPacket5)
+	set32(&a.SpecialJunkInterval, b.SpecialJunkInterval)
+
+	return a
+}
@@ -0,0 +1,277 @@
+package wgctrl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// defaultRevocationInterval is the default value for RevocationList.Interval.
+const defaultRevocationInterval = time.Minute
+
+// A RevocationList holds the public keys of peers which must never be
+// configured, such as keys known to be compromised.
+//
+// With WithRevocationList, ConfigureDevice rejects configurations which add or
+// update a revoked peer. Enforce and Run remove revoked peers which are
+// already configured on devices.
+//
+// The list is read from Source by Load, and may also be set directly using
+// Set. The zero value is an empty list which is ready to use. A
+// RevocationList is safe for concurrent use, but its exported fields must not
+// be modified once it is in use.
+type RevocationList struct {
+	// Source is the path of a file or an http or https URL from which Load
+	// reads the list. The list contains one base64-encoded public key per
+	// line. Blank lines and text following a # are ignored.
+	Source string
+
+	// HTTPClient is used to fetch Source if it is a URL. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Interval is the amount of time between calls to Load and Enforce
+	// performed by Run. If zero or negative, a default of 1 minute is used.
+	Interval time.Duration
+
+	// OnRemove, if set, is called for each revoked peer removed from a
+	// device by Enforce.
+	OnRemove func(device string, p wgtypes.Peer)
+
+	// OnError, if set, is called with any error returned by Load or
+	// Enforce from Run. Errors do not stop Run.
+	OnError func(err error)
+
+	mu   sync.RWMutex
+	keys map[wgtypes.Key]struct{}
+}
+
+// WithRevocationList rejects each configuration passed to ConfigureDevice
+// which adds or updates a peer revoked by rl with a *wgtypes.ValidationError,
+// so that the configuration is not applied. Removing a revoked peer is always
+// permitted.
+func WithRevocationList(rl *RevocationList) Option {
+	return func(o *options) {
+		o.revoked = rl
+	}
+}
+
+// ParseRevocationList parses a list of revoked public keys from r, in the
+// format described by RevocationList.Source.
+func ParseRevocationList(r io.Reader) ([]wgtypes.Key, error) {
+	var (
+		keys []wgtypes.Key
+		line int
+	)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line++
+
+		text, _, _ := strings.Cut(s.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		k, err := wgtypes.ParseKey(text)
+		if err != nil {
+			return nil, fmt.Errorf("wgctrl: invalid revocation list line %d: %w", line, err)
+		}
+
+		keys = append(keys, k)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Load reads the list from Source, replacing the current list. If Source
+// can't be read or parsed, the current list is kept.
+func (rl *RevocationList) Load(ctx context.Context) error {
+	if rl.Source == "" {
+		return errors.New("wgctrl: RevocationList.Source must be set")
+	}
+
+	rc, err := rl.open(ctx)
+	if err != nil {
+		return fmt.Errorf("wgctrl: failed to read revocation list: %w", err)
+	}
+	defer rc.Close()
+
+	keys, err := ParseRevocationList(rc)
+	if err != nil {
+		return err
+	}
+
+	rl.Set(keys...)
+	return nil
+}
+
+// open opens Source as a URL or a file.
+func (rl *RevocationList) open(ctx context.Context) (io.ReadCloser, error) {
+	if !strings.HasPrefix(rl.Source, "http://") && !strings.HasPrefix(rl.Source, "https://") {
+		return os.Open(rl.Source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rl.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	hc := rl.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("unexpected HTTP status: %s", res.Status)
+	}
+
+	return res.Body, nil
+}
+
+// Set replaces the list with keys.
+func (rl *RevocationList) Set(keys ...wgtypes.Key) {
+	m := make(map[wgtypes.Key]struct{}, len(keys))
+	for _, k := range keys {
+		m[k] = struct{}{}
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.keys = m
+}
+
+// Revoked reports whether key is revoked.
+func (rl *RevocationList) Revoked(key wgtypes.Key) bool {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	_, ok := rl.keys[key]
+	return ok
+}
+
+// Check returns a *wgtypes.ValidationError if cfg adds or updates a revoked
+// peer.
+func (rl *RevocationList) Check(cfg wgtypes.Config) error {
+	for _, pc := range cfg.Peers {
+		if pc.Remove || !rl.Revoked(pc.PublicKey) {
+			continue
+		}
+
+		key := pc.PublicKey
+		return &wgtypes.ValidationError{
+			Peer:   &key,
+			Field:  "PublicKey",
+			Reason: "public key is revoked",
+		}
+	}
+
+	return nil
+}
+
+// Run calls Load, if Source is set, and Enforce for the devices specified by
+// names immediately and then every Interval until ctx is canceled. Run always
+// returns a non-nil error.
+func (rl *RevocationList) Run(ctx context.Context, c *Client, names ...string) error {
+	interval := rl.Interval
+	if interval <= 0 {
+		interval = defaultRevocationInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if rl.Source != "" {
+			rl.report(rl.Load(ctx))
+		}
+		rl.report(rl.Enforce(c, names...))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// report passes a non-nil err to OnError, if set.
+func (rl *RevocationList) report(err error) {
+	if err != nil && rl.OnError != nil {
+		rl.OnError(err)
+	}
+}
+
+// Enforce removes revoked peers from the devices specified by names, or from
+// every device if names is empty. Every device is checked, and an error
+// joining the errors of each device which could not be checked or whose peers
+// could not be removed is returned.
+func (rl *RevocationList) Enforce(c *Client, names ...string) error {
+	devices, errs, err := c.namedDevices(names)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		for _, p := range d.Peers {
+			if !rl.Revoked(p.PublicKey) {
+				continue
+			}
+
+			if err := c.RemovePeer(d.Name, p.PublicKey); err != nil {
+				errs = append(errs, fmt.Errorf("wgctrl: device %q: failed to remove revoked peer %s: %w", d.Name, p.PublicKey, err))
+				continue
+			}
+
+			if rl.OnRemove != nil {
+				rl.OnRemove(d.Name, p)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// namedDevices returns the devices specified by names, or every device if
+// names is empty. An error is returned for each named device which could not
+// be retrieved, or a single error if every device could not be listed.
+func (c *Client) namedDevices(names []string) ([]*wgtypes.Device, []error, error) {
+	if len(names) == 0 {
+		ds, err := c.Devices()
+		return ds, nil, err
+	}
+
+	var (
+		devices []*wgtypes.Device
+		errs    []error
+	)
+
+	for _, name := range names {
+		d, err := c.device(context.Background(), name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("wgctrl: device %q: %w", name, err))
+			continue
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, errs, nil
+}
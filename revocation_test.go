@@ -0,0 +1,238 @@
+package wgctrl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wginternal"
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRevocationList(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+	)
+
+	tests := []struct {
+		name string
+		s    string
+		keys []wgtypes.Key
+		ok   bool
+	}{
+		{
+			name: "empty",
+			ok:   true,
+		},
+		{
+			name: "OK",
+			s: "# Compromised keys.\n\n" +
+				keyA.String() + "\n" +
+				"  " + keyB.String() + "  # laptop\n",
+			keys: []wgtypes.Key{keyA, keyB},
+			ok:   true,
+		},
+		{
+			name: "bad key",
+			s:    keyA.String() + "\nfoo\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseRevocationList(strings.NewReader(tt.s))
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+
+				return
+			}
+
+			if diff := cmp.Diff(tt.keys, keys); diff != "" {
+				t.Fatalf("unexpected keys (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRevocationListLoad(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+	)
+
+	file := filepath.Join(t.TempDir(), "revoked")
+	if err := os.WriteFile(file, []byte(keyA.String()+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write list: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/revoked" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte(keyB.String() + "\n"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		source string
+		keys   []wgtypes.Key
+	}{
+		{
+			name:   "file",
+			source: file,
+			keys:   []wgtypes.Key{keyA},
+		},
+		{
+			name:   "URL",
+			source: srv.URL + "/revoked",
+			keys:   []wgtypes.Key{keyB},
+		},
+		{
+			name:   "missing file",
+			source: filepath.Join(t.TempDir(), "missing"),
+		},
+		{
+			name:   "missing URL",
+			source: srv.URL + "/missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A list which fails to load is left unchanged.
+			var prev wgtypes.Key
+			rl := &RevocationList{Source: tt.source}
+			rl.Set(prev)
+
+			err := rl.Load(context.Background())
+			if len(tt.keys) == 0 {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				if !rl.Revoked(prev) {
+					t.Fatal("previous list was discarded")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to load: %v", err)
+			}
+
+			for _, k := range tt.keys {
+				if !rl.Revoked(k) {
+					t.Fatalf("key %s is not revoked", k)
+				}
+			}
+			if rl.Revoked(prev) {
+				t.Fatal("previous list was kept")
+			}
+		})
+	}
+}
+
+func TestClientRevocationList(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		keyC = wgtest.MustPublicKey()
+	)
+
+	devices := map[string]*wgtypes.Device{
+		"wg0": {Name: "wg0", Peers: []wgtypes.Peer{{PublicKey: keyA}, {PublicKey: keyB}}},
+		"wg1": {Name: "wg1", Peers: []wgtypes.Peer{{PublicKey: keyB}, {PublicKey: keyC}}},
+	}
+
+	rl := &RevocationList{}
+	rl.Set(keyB)
+
+	var removed []string
+	rl.OnRemove = func(device string, p wgtypes.Peer) {
+		removed = append(removed, device+" "+p.PublicKey.String())
+	}
+
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			DevicesFunc: func() ([]*wgtypes.Device, error) {
+				return []*wgtypes.Device{devices["wg0"], devices["wg1"]}, nil
+			},
+			DeviceFunc: func(name string) (*wgtypes.Device, error) {
+				d, ok := devices[name]
+				if !ok {
+					return nil, os.ErrNotExist
+				}
+
+				return d, nil
+			},
+			ConfigureDeviceFunc: func(name string, cfg wgtypes.Config) error {
+				devices[name] = wgtypes.Preview(devices[name], cfg)
+				return nil
+			},
+		}},
+		revocations: rl,
+	}
+
+	// Revoked peers can't be added or updated.
+	err := c.ConfigureDevice("wg0", wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{PublicKey: keyC}, {PublicKey: keyB, UpdateOnly: true}},
+	})
+
+	var verr *wgtypes.ValidationError
+	if !errors.As(err, &verr) || *verr.Peer != keyB {
+		t.Fatalf("expected validation error for revoked peer, but got: %v", err)
+	}
+	if diff := cmp.Diff(2, len(devices["wg0"].Peers)); diff != "" {
+		t.Fatalf("unexpected number of peers (-want +got):\n%s", diff)
+	}
+
+	// Revoked peers are removed from every device.
+	if err := rl.Enforce(c); err != nil {
+		t.Fatalf("failed to enforce: %v", err)
+	}
+
+	want := []string{"wg0 " + keyB.String(), "wg1 " + keyB.String()}
+	if diff := cmp.Diff(want, removed); diff != "" {
+		t.Fatalf("unexpected removed peers (-want +got):\n%s", diff)
+	}
+
+	for name, d := range devices {
+		for _, p := range d.Peers {
+			if p.PublicKey == keyB {
+				t.Fatalf("revoked peer remains on device %q", name)
+			}
+		}
+	}
+
+	if err := rl.Enforce(c, "wg0", "wg2"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist for missing device, but got: %v", err)
+	}
+}
+
+func TestRevocationListRunNegativeInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A negative interval uses the default rather than panicking.
+	rl := &RevocationList{Interval: -time.Second}
+
+	if err := rl.Run(ctx, &Client{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, but got: %v", err)
+	}
+}
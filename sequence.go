@@ -0,0 +1,184 @@
+package wgctrl
+
+import (
+	"context"
+	"sync"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// Sequence returns the change sequence number of the WireGuard device
+// specified by name, a counter which increases whenever the Client observes a
+// change to the device. It is intended for optimistic concurrency control
+// using CompareAndConfigure.
+//
+// A Client begins tracking a device on the first call to Sequence or
+// CompareAndConfigure for it. From then on, the sequence number increases
+// when the Client configures, creates or deletes the device, and when a
+// retrieval of the device, including those made by Watch, finds that its
+// configuration differs from the previous retrieval, as determined by
+// wgtypes.Diff. Changes made by other programs are therefore only detected
+// when the device is next retrieved; Sequence itself always retrieves it.
+//
+// Sequence numbers are only meaningful to the Client which returned them.
+func (c *Client) Sequence(name string) (uint64, error) {
+	c.seqs.track(name)
+
+	if _, err := c.device(context.Background(), name); err != nil {
+		return 0, err
+	}
+
+	return c.seqs.get(name), nil
+}
+
+// CompareAndConfigure configures a WireGuard device by its interface name, as
+// with ConfigureDevice, but only if its change sequence number is still seq,
+// as returned by an earlier call to Sequence or CompareAndConfigure. If it is
+// not, ErrConflict is returned and the device is left unchanged. Otherwise,
+// the sequence number which reflects the new configuration is returned.
+//
+// As with ConfigureDeviceIf, the device is re-read immediately before it is
+// configured, and calls to CompareAndConfigure on the same Client are
+// serialized. WireGuard itself has no notion of transactions, so a change
+// made by another program in the short window between the read and the write
+// can't be detected.
+func (c *Client) CompareAndConfigure(name string, seq uint64, cfg wgtypes.Config) (uint64, error) {
+	c.seqs.cas.Lock()
+	defer c.seqs.cas.Unlock()
+
+	c.seqs.track(name)
+
+	err := c.ConfigureDeviceIf(name, cfg, func(_ *wgtypes.Device) bool {
+		// Retrieving the device updated its sequence number.
+		return c.seqs.get(name) == seq
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return c.seqs.get(name), nil
+}
+
+// deviceSeqs holds the change sequence numbers of the devices tracked by a
+// Client. The zero value is ready to use.
+type deviceSeqs struct {
+	// cas serializes calls to CompareAndConfigure.
+	cas sync.Mutex
+
+	mu      sync.Mutex
+	devices map[string]*seqState
+}
+
+// A seqState is the change sequence number of a device and the last
+// configuration observed for it.
+type seqState struct {
+	seq uint64
+
+	// known reports whether last is the current configuration of the
+	// device, or nil if the device does not exist. It is false once the
+	// Client changes the device, until the device is next retrieved.
+	known bool
+	last  *wgtypes.Device
+}
+
+// track begins tracking the device specified by name, if it is not tracked
+// already.
+func (s *deviceSeqs) track(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.devices == nil {
+		s.devices = make(map[string]*seqState)
+	}
+	if s.devices[name] == nil {
+		s.devices[name] = &seqState{seq: 1}
+	}
+}
+
+// get returns the sequence number of the device specified by name, or 0 if
+// it is not tracked.
+func (s *deviceSeqs) get(name string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st := s.devices[name]; st != nil {
+		return st.seq
+	}
+
+	return 0
+}
+
+// changed records that the Client changed the device specified by name.
+func (s *deviceSeqs) changed(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st := s.devices[name]; st != nil {
+		st.seq++
+		st.known, st.last = false, nil
+	}
+}
+
+// observe records the retrieved devices devs. If all is true, devs are all of
+// the devices on the system, so tracked devices which are not among them no
+// longer exist.
+func (s *deviceSeqs) observe(all bool, devs ...*wgtypes.Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.devices) == 0 {
+		return
+	}
+
+	seen := make(map[string]bool, len(devs))
+	for _, d := range devs {
+		seen[d.Name] = true
+
+		st := s.devices[d.Name]
+		if st == nil {
+			continue
+		}
+
+		// Lazily decoded allowed IPs must be compared too.
+		last := cloneDevice(d)
+		if err := loadAllowedIPs(last); err != nil {
+			st.known, st.last = false, nil
+			continue
+		}
+
+		if st.known && (st.last == nil || len(wgtypes.Diff(st.last, last)) > 0) {
+			st.seq++
+		}
+		st.known, st.last = true, last
+	}
+
+	if !all {
+		return
+	}
+
+	for name := range s.devices {
+		if !seen[name] {
+			s.gone(name)
+		}
+	}
+}
+
+// gone records that the device specified by name does not exist. s.mu must
+// be held.
+func (s *deviceSeqs) gone(name string) {
+	st := s.devices[name]
+	if st == nil || (st.known && st.last == nil) {
+		return
+	}
+
+	st.seq++
+	st.known, st.last = true, nil
+}
+
+// notFound records that the device specified by name does not exist.
+func (s *deviceSeqs) notFound(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gone(name)
+}
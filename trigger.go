@@ -0,0 +1,82 @@
+package wgctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// ErrNoEndpoint is returned by TriggerHandshake when a peer has no endpoint,
+// so a handshake can't be initiated with it.
+var ErrNoEndpoint = errors.New("wgctrl: peer has no endpoint")
+
+// TriggerHandshake prompts the device specified by name to initiate a
+// handshake with the peer with public key, for example to implement a
+// "reconnect now" action, using whichever implementation serves the device.
+//
+// WireGuard has no operation which initiates a handshake directly. Instead,
+// the peer's endpoint is set to its current value, which also discards any
+// cached source address, and its persistent keepalive is briefly enabled.
+// Every implementation sends a keepalive immediately when persistent
+// keepalive is enabled, which requires a handshake if the peer has no
+// current session. The peer's persistent keepalive interval is then
+// restored, so the peer's configuration is left unchanged.
+//
+// If the device or peer does not exist, an error which matches
+// ErrDeviceNotFound or ErrPeerNotFound respectively, and os.ErrNotExist, is
+// returned. If the peer has no endpoint, ErrNoEndpoint is returned.
+func (c *Client) TriggerHandshake(name string, key wgtypes.Key) error {
+	d, err := c.device(context.Background(), name)
+	if err != nil {
+		return err
+	}
+
+	var peer *wgtypes.Peer
+	for i := range d.Peers {
+		if d.Peers[i].PublicKey == key {
+			peer = &d.Peers[i]
+			break
+		}
+	}
+	if peer == nil {
+		return fmt.Errorf("wgctrl: peer %s on device %q: %w", key, name, ErrPeerNotFound)
+	}
+	if peer.Endpoint == nil {
+		return ErrNoEndpoint
+	}
+
+	// The peer configurations are applied in order: disable keepalive, then
+	// enable it to send a keepalive, then restore the original interval.
+	var (
+		off      time.Duration
+		on       = wgtypes.DefaultPersistentKeepalive
+		original = peer.PersistentKeepaliveInterval
+	)
+	if original > 0 {
+		on = original
+	}
+
+	return c.ConfigureDevice(name, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:                   key,
+				UpdateOnly:                  true,
+				Endpoint:                    peer.Endpoint,
+				PersistentKeepaliveInterval: &off,
+			},
+			{
+				PublicKey:                   key,
+				UpdateOnly:                  true,
+				PersistentKeepaliveInterval: &on,
+			},
+			{
+				PublicKey:                   key,
+				UpdateOnly:                  true,
+				PersistentKeepaliveInterval: &original,
+			},
+		},
+	})
+}
@@ -0,0 +1,11 @@
+package wgctrl
+
+// A LinkQueue describes the transmit queueing of a network interface.
+type LinkQueue struct {
+	// Qdisc is the kind of the interface's root queueing discipline, such as
+	// "noqueue" or "fq_codel".
+	Qdisc string
+
+	// TxQueueLen is the length of the interface's transmit queue, in packets.
+	TxQueueLen int
+}
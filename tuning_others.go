@@ -0,0 +1,66 @@
+//go:build !linux
+// +build !linux
+
+package wgctrl
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// GetLinkQueue returns the root queueing discipline and the transmit queue
+// length of the network interface specified by name, which may be a WireGuard
+// device or the underlay interface carrying its traffic. If the interface
+// does not exist, an error is returned which can be checked using
+// `errors.Is(err, os.ErrNotExist)`.
+//
+// On platforms other than Linux, GetLinkQueue always returns an error.
+func GetLinkQueue(name string) (LinkQueue, error) {
+	return LinkQueue{}, errTuningNotImplemented()
+}
+
+// SetLinkTxQueueLen sets the transmit queue length of the network interface
+// specified by name, as with "ip link set dev name txqueuelen n".
+//
+// On platforms other than Linux, SetLinkTxQueueLen always returns an error.
+func SetLinkTxQueueLen(name string, n int) error {
+	return errTuningNotImplemented()
+}
+
+// SetLinkQdisc replaces the root queueing discipline of the network interface
+// specified by name with one of the specified kind using its default
+// parameters, as with "tc qdisc replace dev name root kind".
+//
+// On platforms other than Linux, SetLinkQdisc always returns an error.
+func SetLinkQdisc(name, kind string) error {
+	return errTuningNotImplemented()
+}
+
+// GetLinkFeatures returns the offload features of the network interface
+// specified by name which are enabled or can be changed, keyed by their
+// ethtool(8) names such as "rx-udp-gro-forwarding", and whether each is
+// enabled. These are typically of interest on the underlay interface of a
+// WireGuard device. The ethtool netlink interface of Linux 5.6 or later is
+// required.
+//
+// On platforms other than Linux, GetLinkFeatures always returns an error.
+func GetLinkFeatures(name string) (map[string]bool, error) {
+	return nil, errTuningNotImplemented()
+}
+
+// SetLinkFeatures enables or disables each of the offload features of the
+// network interface specified by name in features, keyed by their ethtool(8)
+// names, as with "ethtool -K". Features not in features are left unchanged.
+// If any feature could not be changed as requested, an error is returned.
+//
+// On platforms other than Linux, SetLinkFeatures always returns an error.
+func SetLinkFeatures(name string, features map[string]bool) error {
+	return errTuningNotImplemented()
+}
+
+// errTuningNotImplemented returns the error of the link tuning functions on
+// platforms other than Linux.
+func errTuningNotImplemented() error {
+	return fmt.Errorf("wgctrl: link tuning not implemented on %s/%s",
+		runtime.GOOS, runtime.GOARCH)
+}
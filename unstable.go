@@ -0,0 +1,44 @@
+package wgctrl
+
+import (
+	"net"
+
+	"github.com/danpashin/wgctrl/internal/wguser"
+)
+
+// Unstable provides access to the handles used internally by a Client's
+// device implementations, so that advanced users can perform operations which
+// this package does not wrap yet.
+//
+// Unstable is not covered by any compatibility guarantees: its methods may
+// change or be removed at any time. Operations performed through these
+// handles bypass the Client entirely, and may leave devices in states the
+// Client does not expect.
+type Unstable struct {
+	c *Client
+}
+
+// Unstable returns the unstable API of c.
+func (c *Client) Unstable() Unstable {
+	return Unstable{c: c}
+}
+
+// DialUAPI opens a connection to the userspace configuration protocol socket
+// of the userspace device specified by name. The caller is responsible for
+// closing the connection.
+//
+// If no userspace device exists with the specified name, an error is returned
+// which can be checked using `errors.Is(err, os.ErrNotExist)`.
+func (u Unstable) DialUAPI(name string) (net.Conn, error) {
+	for _, wgc := range u.c.cs {
+		uc, ok := wgc.(*wguser.Client)
+		if !ok {
+			continue
+		}
+
+		conn, err := uc.Dial(name)
+		return conn, classify(err)
+	}
+
+	return nil, ErrDeviceNotFound
+}
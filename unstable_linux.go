@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+package wgctrl
+
+import (
+	"github.com/danpashin/wgctrl/internal/wglinux"
+	"github.com/mdlayher/genetlink"
+)
+
+// Genetlink returns the generic netlink connection and WireGuard family used
+// by the Linux kernel device implementation, and whether that implementation
+// is in use. The connection is shared with the Client and must not be closed
+// by the caller.
+func (u Unstable) Genetlink() (*genetlink.Conn, genetlink.Family, bool) {
+	for _, wgc := range u.c.cs {
+		if kc, ok := wgc.(*wglinux.Client); ok {
+			c, f := kc.Conn()
+			return c, f, true
+		}
+	}
+
+	return nil, genetlink.Family{}, false
+}
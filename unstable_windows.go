@@ -0,0 +1,27 @@
+//go:build windows
+// +build windows
+
+package wgctrl
+
+import (
+	"os"
+
+	"github.com/danpashin/wgctrl/internal/wgwindows"
+	"golang.org/x/sys/windows"
+)
+
+// AdapterHandle opens a handle to the WireGuardNT adapter specified by name,
+// which can be used with the driver's ioctl interface. The caller is
+// responsible for closing the handle.
+//
+// If no adapter exists with the specified name, an error is returned which
+// can be checked using `errors.Is(err, os.ErrNotExist)`.
+func (u Unstable) AdapterHandle(name string) (windows.Handle, error) {
+	for _, wgc := range u.c.cs {
+		if kc, ok := wgc.(*wgwindows.Client); ok {
+			return kc.Handle(name)
+		}
+	}
+
+	return 0, os.ErrNotExist
+}
@@ -0,0 +1,323 @@
+package wgctrl
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// A WatchEventKind is the kind of change described by a WatchEvent.
+type WatchEventKind int
+
+// Possible WatchEventKind values.
+const (
+	// DeviceAdded indicates that a WireGuard device was created.
+	DeviceAdded WatchEventKind = iota
+
+	// DeviceRemoved indicates that a WireGuard device was deleted.
+	DeviceRemoved
+
+	// EndpointChanged indicates that the endpoint of a peer changed, such as
+	// when the peer roams to a new address.
+	EndpointChanged
+
+	// HandshakeCompleted indicates that a handshake with a peer completed.
+	HandshakeCompleted
+)
+
+// String returns the string representation of a WatchEventKind.
+func (k WatchEventKind) String() string {
+	switch k {
+	case DeviceAdded:
+		return "device added"
+	case DeviceRemoved:
+		return "device removed"
+	case EndpointChanged:
+		return "endpoint changed"
+	case HandshakeCompleted:
+		return "handshake completed"
+	default:
+		return "unknown"
+	}
+}
+
+// A WatchEvent is a change to a WireGuard device reported by Watch.
+type WatchEvent struct {
+	// Kind is the kind of change.
+	Kind WatchEventKind
+
+	// Device is the name of the device.
+	Device string
+
+	// Peer is the public key of the peer, for EndpointChanged and
+	// HandshakeCompleted events.
+	Peer wgtypes.Key
+
+	// Endpoint is the new endpoint of the peer for EndpointChanged events,
+	// and the peer's endpoint for HandshakeCompleted events.
+	Endpoint *net.UDPAddr
+
+	// Time is when the change was observed, or for HandshakeCompleted
+	// events, when the handshake completed.
+	Time time.Time
+}
+
+// watchInterval is how often Watch retrieves devices to detect changes when
+// network interface changes are not reported.
+var watchInterval = time.Second
+
+// A WatchOption configures how Watch delivers events to a consumer which
+// does not receive them promptly.
+type WatchOption func(o *watchOptions)
+
+// watchOptions holds the settings applied by WatchOptions.
+type watchOptions struct {
+	buffer     int
+	dropOldest bool
+	coalesce   bool
+}
+
+// WatchBuffer lets up to n events wait to be received before the detection of
+// changes pauses. By default, detection pauses as soon as any event is
+// waiting, so only the events found by a single retrieval of the devices are
+// held.
+func WatchBuffer(n int) WatchOption {
+	return func(o *watchOptions) {
+		o.buffer = n
+	}
+}
+
+// WatchDropOldest makes Watch discard the oldest queued event when an event
+// is found and the queue set by WatchBuffer is full, rather than pausing the
+// detection of changes until the consumer catches up. At least one event is
+// always queued.
+func WatchDropOldest() WatchOption {
+	return func(o *watchOptions) {
+		o.dropOldest = true
+	}
+}
+
+// WatchCoalesce makes Watch replace a queued event with a later event of the
+// same kind for the same device and peer, such as the handshakes of a peer
+// which rekeys, or the endpoints of a peer which roams, so that a slow
+// consumer only receives the latest. The replacement keeps the position of
+// the event it replaces.
+func WatchCoalesce() WatchOption {
+	return func(o *watchOptions) {
+		o.coalesce = true
+	}
+}
+
+// Watch reports changes to the WireGuard devices on this system over the
+// returned channel, until ctx is canceled, at which point the channel is
+// closed. The devices are retrieved once before Watch returns, and any error
+// doing so is returned.
+//
+// WireGuard implementations do not announce changes, so changes are detected
+// by retrieving the devices again and comparing them to those retrieved
+// before. On Linux, when the kernel implementation is in use, devices are
+// retrieved only when rtnetlink reports that a network interface in its
+// network namespace was added, removed, or changed, so devices are not
+// polled; peer changes are therefore only reported once such a notification
+// is received. Elsewhere, or if rtnetlink is unavailable, devices are
+// retrieved at regular intervals instead. Errors retrieving devices after
+// Watch returns are ignored, and the devices are retrieved again on the next
+// notification or interval.
+//
+// By default, events must be received promptly: no further changes are
+// detected while an event is waiting to be received. WatchBuffer,
+// WatchDropOldest and WatchCoalesce allow slower consumers. If the Client was
+// created using WithDeviceCache, the cached state of a device is discarded
+// when an event for it is found.
+func (c *Client) Watch(ctx context.Context, opts ...WatchOption) (<-chan WatchEvent, error) {
+	var o watchOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	devs, err := c.DevicesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.watch(ctx, watchSnapshot(devs), c.linkChanges(ctx), o), nil
+}
+
+// watch reports the changes from the devices in prev over the returned
+// channel, retrieving devices whenever links receives a value, or at regular
+// intervals if links is nil.
+func (c *Client) watch(ctx context.Context, prev map[string]*wgtypes.Device, links <-chan struct{}, o watchOptions) <-chan WatchEvent {
+	events := make(chan WatchEvent)
+
+	go func() {
+		defer close(events)
+
+		var tick <-chan time.Time
+		if links == nil {
+			// Without notifications, changes can only be found by polling.
+			t := time.NewTicker(watchInterval)
+			defer t.Stop()
+			tick = t.C
+		}
+
+		// queue holds the events which were found but not yet received.
+		var queue []WatchEvent
+
+		for {
+			var (
+				out  chan<- WatchEvent
+				next WatchEvent
+			)
+			if len(queue) > 0 {
+				out, next = events, queue[0]
+			}
+
+			// Pause detection while the queue is full, unless the oldest
+			// events are discarded to make room instead.
+			ttick, tlinks := tick, links
+			if len(queue) > 0 && len(queue) >= o.buffer && !o.dropOldest {
+				ttick, tlinks = nil, nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- next:
+				queue = queue[1:]
+				continue
+			case <-ttick:
+			case <-tlinks:
+			}
+
+			devs, err := c.DevicesContext(ctx)
+			if err != nil {
+				continue
+			}
+
+			cur := watchSnapshot(devs)
+			for _, e := range watchEvents(prev, cur, time.Now()) {
+				// Discard the cached device before reporting the change, so
+				// that a receiver retrieves the device from the system.
+				if c.cache != nil {
+					c.cache.invalidate(e.Device)
+				}
+
+				queue = o.enqueue(queue, e)
+			}
+
+			prev = cur
+		}
+	}()
+
+	return events
+}
+
+// enqueue adds e to queue according to o, and returns the updated queue.
+func (o watchOptions) enqueue(queue []WatchEvent, e WatchEvent) []WatchEvent {
+	if o.coalesce {
+		for i, q := range queue {
+			if q.Kind == e.Kind && q.Device == e.Device && q.Peer == e.Peer {
+				queue[i] = e
+				return queue
+			}
+		}
+	}
+
+	queue = append(queue, e)
+
+	if n := o.buffer; o.dropOldest {
+		if n < 1 {
+			n = 1
+		}
+		if len(queue) > n {
+			queue = queue[len(queue)-n:]
+		}
+	}
+
+	return queue
+}
+
+// watchSnapshot indexes devs by name.
+func watchSnapshot(devs []*wgtypes.Device) map[string]*wgtypes.Device {
+	m := make(map[string]*wgtypes.Device, len(devs))
+	for _, d := range devs {
+		m[d.Name] = d
+	}
+
+	return m
+}
+
+// watchEvents returns the events which describe the changes from prev to
+// cur, in order of device name. now is the time the changes were observed.
+func watchEvents(prev, cur map[string]*wgtypes.Device, now time.Time) []WatchEvent {
+	names := make([]string, 0, len(prev)+len(cur))
+	for name := range prev {
+		names = append(names, name)
+	}
+	for name := range cur {
+		if prev[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var events []WatchEvent
+	for _, name := range names {
+		pd, cd := prev[name], cur[name]
+		switch {
+		case cd == nil:
+			events = append(events, WatchEvent{Kind: DeviceRemoved, Device: name, Time: now})
+			continue
+		case pd == nil:
+			events = append(events, WatchEvent{Kind: DeviceAdded, Device: name, Time: now})
+			continue
+		}
+
+		peers := make(map[wgtypes.Key]wgtypes.Peer, len(pd.Peers))
+		for _, p := range pd.Peers {
+			peers[p.PublicKey] = p
+		}
+
+		for _, p := range cd.Peers {
+			// A peer which was just added has no previous state, so any
+			// handshake it has is new, but its endpoint was configured
+			// rather than roamed.
+			pp, ok := peers[p.PublicKey]
+
+			if ok && p.Endpoint != nil && endpointString(pp.Endpoint) != p.Endpoint.String() {
+				events = append(events, WatchEvent{
+					Kind:     EndpointChanged,
+					Device:   name,
+					Peer:     p.PublicKey,
+					Endpoint: p.Endpoint,
+					Time:     now,
+				})
+			}
+
+			if p.LastHandshakeTime.After(pp.LastHandshakeTime) {
+				events = append(events, WatchEvent{
+					Kind:     HandshakeCompleted,
+					Device:   name,
+					Peer:     p.PublicKey,
+					Endpoint: p.Endpoint,
+					Time:     p.LastHandshakeTime,
+				})
+			}
+		}
+	}
+
+	return events
+}
+
+// endpointString returns the string representation of addr, or the empty
+// string if addr is nil.
+func endpointString(addr *net.UDPAddr) string {
+	if addr == nil {
+		return ""
+	}
+
+	return addr.String()
+}
@@ -0,0 +1,76 @@
+//go:build linux
+// +build linux
+
+package wgctrl
+
+import (
+	"context"
+
+	"github.com/danpashin/wgctrl/internal/wglinux"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// linkChanges returns a channel which receives a value whenever rtnetlink
+// reports that a network interface was added, removed, or changed in the
+// network namespace of the Linux kernel implementation used by c, until ctx
+// is canceled. If that implementation is not in use or rtnetlink is
+// unavailable, a nil channel is returned.
+func (c *Client) linkChanges(ctx context.Context) <-chan struct{} {
+	var kc *wglinux.Client
+	for _, wgc := range c.cs {
+		if k, ok := wgc.(*wglinux.Client); ok {
+			kc = k
+			break
+		}
+	}
+	if kc == nil {
+		return nil
+	}
+
+	conn, err := kc.DialLinkNotifications()
+	if err != nil {
+		return nil
+	}
+
+	// Close unblocks Receive once ctx is canceled.
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	// Changes which occur while a previous change is pending are coalesced,
+	// because the watcher retrieves all devices in response to either.
+	changes := make(chan struct{}, 1)
+	go func() {
+		for {
+			msgs, err := conn.Receive()
+			if err != nil {
+				return
+			}
+
+			if !linkChanged(msgs) {
+				continue
+			}
+
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changes
+}
+
+// linkChanged reports whether msgs contain any link notifications.
+func linkChanged(msgs []netlink.Message) bool {
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case unix.RTM_NEWLINK, unix.RTM_DELLINK:
+			return true
+		}
+	}
+
+	return false
+}
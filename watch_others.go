@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package wgctrl
+
+import "context"
+
+// linkChanges returns a nil channel, because network interface changes are
+// only reported on Linux.
+func (c *Client) linkChanges(_ context.Context) <-chan struct{} { return nil }
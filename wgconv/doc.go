@@ -0,0 +1,10 @@
+// Package wgconv converts WireGuard configurations between package wgtypes and
+// the formats used by other WireGuard management systems, such as appliance
+// firewalls and the exports of the WireGuard mobile apps.
+//
+// Conversions never perform DNS lookups. Endpoints given as host names are
+// preserved in Interface.Endpoints rather than resolved.
+//
+// Devices have no notion of peer names, so a PeerNameStore can be used to keep
+// the names in Interface.PeerNames between exports and imports.
+package wgconv
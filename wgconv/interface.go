@@ -0,0 +1,243 @@
+package wgconv
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// An Interface is a WireGuard interface and the settings which surround it
+// on other systems, but which are not part of a wgtypes.Config.
+type Interface struct {
+	// Name is the name of the network interface, such as "wg0".
+	Name string
+
+	// Description is an optional human-readable description.
+	Description string
+
+	// Addresses are the tunnel addresses assigned to the interface.
+	Addresses []net.IPNet
+
+	// Config is the WireGuard configuration of the interface. Config always
+	// sets ReplacePeers so that applying it reproduces the source.
+	Config wgtypes.Config
+
+	// Endpoints holds the "host:port" endpoints of peers whose endpoint is a
+	// host name rather than an IP address, which must be resolved before
+	// the peer can be configured. When converting to another format, an
+	// entry in Endpoints takes precedence over the peer's Endpoint.
+	Endpoints map[wgtypes.Key]string
+
+	// PeerNames holds optional human-readable names for peers.
+	PeerNames map[wgtypes.Key]string
+}
+
+// peerEndpoint returns the "host:port" endpoint of p, or empty if none.
+func (ifi *Interface) peerEndpoint(p wgtypes.PeerConfig) (host string, port int) {
+	if hp, ok := ifi.Endpoints[p.PublicKey]; ok {
+		h, ps, err := net.SplitHostPort(hp)
+		if err == nil {
+			port, _ = strconv.Atoi(ps)
+			return h, port
+		}
+	}
+
+	if p.Endpoint == nil {
+		return "", 0
+	}
+
+	return p.Endpoint.IP.String(), p.Endpoint.Port
+}
+
+// setPeerEndpoint sets the endpoint of the peer at index i from host and
+// port, recording host names in ifi.Endpoints.
+func (ifi *Interface) setPeerEndpoint(i int, host, port string) error {
+	if host == "" {
+		return nil
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q: %v", port, err)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		ifi.Config.Peers[i].Endpoint = &net.UDPAddr{IP: ip, Port: int(p)}
+		return nil
+	}
+
+	if ifi.Endpoints == nil {
+		ifi.Endpoints = make(map[wgtypes.Key]string)
+	}
+	ifi.Endpoints[ifi.Config.Peers[i].PublicKey] = net.JoinHostPort(host, port)
+	return nil
+}
+
+// setPeerName records name for the peer at index i, if non-empty.
+func (ifi *Interface) setPeerName(i int, name string) {
+	if name == "" {
+		return
+	}
+
+	if ifi.PeerNames == nil {
+		ifi.PeerNames = make(map[wgtypes.Key]string)
+	}
+	ifi.PeerNames[ifi.Config.Peers[i].PublicKey] = name
+}
+
+// parseKey parses an optional base64 key. It returns nil if s is empty.
+func parseKey(s string) (*wgtypes.Key, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	k, err := wgtypes.ParseKey(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &k, nil
+}
+
+// parseCIDR parses an IP address with an optional prefix length. Addresses
+// without a prefix length are host routes.
+func parseCIDR(s string) (net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return net.IPNet{}, fmt.Errorf("invalid IP address %q", s)
+		}
+
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+
+		return net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	ip, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		return net.IPNet{}, err
+	}
+
+	// Keep the host bits of interface addresses such as 10.0.0.1/24.
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	cidr.IP = ip
+	return *cidr, nil
+}
+
+// parseCIDRs parses a comma-separated list of addresses using parseCIDR.
+func parseCIDRs(s string) ([]net.IPNet, error) {
+	var out []net.IPNet
+	for _, f := range strings.Split(s, ",") {
+		if strings.TrimSpace(f) == "" {
+			continue
+		}
+
+		cidr, err := parseCIDR(f)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, cidr)
+	}
+
+	return out, nil
+}
+
+// stableUUID derives a deterministic RFC 4122 UUID from s, so that repeated
+// exports of the same configuration produce identical output.
+func stableUUID(s string) string {
+	b := sha256.Sum256([]byte(s))
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// joinCIDRs formats ips as a comma-separated list.
+func joinCIDRs(ips []net.IPNet) string {
+	ss := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		ss = append(ss, ip.String())
+	}
+
+	return strings.Join(ss, ",")
+}
+
+// FromDevice creates an Interface from the current configuration of d, such
+// as one returned by wgctrl.Client.Device. Runtime statistics are discarded.
+func FromDevice(d *wgtypes.Device) Interface {
+	ifi := Interface{
+		Name: d.Name,
+		Config: wgtypes.Config{
+			ReplacePeers: true,
+			Peers:        make([]wgtypes.PeerConfig, 0, len(d.Peers)),
+		},
+	}
+
+	if d.PrivateKey != (wgtypes.Key{}) {
+		priv := d.PrivateKey
+		ifi.Config.PrivateKey = &priv
+	}
+	if d.ListenPort != 0 {
+		port := d.ListenPort
+		ifi.Config.ListenPort = &port
+	}
+	if d.FirewallMark != 0 {
+		mark := d.FirewallMark
+		ifi.Config.FirewallMark = &mark
+	}
+	if as := d.AdvancedSecurity; as.IsEnabled() {
+		ifi.Config.AdvancedSecurityConfig = wgtypes.AdvancedSecurityConfig{
+			JunkPacketCount:            &as.JunkPacketCount,
+			JunkPacketMinSize:          &as.JunkPacketMinSize,
+			JunkPacketMaxSize:          &as.JunkPacketMaxSize,
+			InitPacketJunkSize:         &as.InitPacketJunkSize,
+			ResponsePacketJunkSize:     &as.ResponsePacketJunkSize,
+			UnderloadPacketJunkSize:    &as.UnderloadPacketJunkSize,
+			TransportPacketJunkSize:    &as.TransportPacketJunkSize,
+			InitPacketMagicHeader:      &as.InitPacketMagicHeader,
+			ResponsePacketMagicHeader:  &as.ResponsePacketMagicHeader,
+			UnderloadPacketMagicHeader: &as.UnderloadPacketMagicHeader,
+			TransportPacketMagicHeader: &as.TransportPacketMagicHeader,
+			SpecialJunkPacket1:         &as.SpecialJunkPacket1,
+			SpecialJunkPacket2:         &as.SpecialJunkPacket2,
+			SpecialJunkPacket3:         &as.SpecialJunkPacket3,
+			SpecialJunkPacket4:         &as.SpecialJunkPacket4,
+			SpecialJunkPacket5:         &as.SpecialJunkPacket5,
+			SpecialJunkInterval:        &as.SpecialJunkInterval,
+		}
+	}
+
+	for _, p := range d.Peers {
+		pc := wgtypes.PeerConfig{
+			PublicKey:         p.PublicKey,
+			Endpoint:          p.Endpoint,
+			ReplaceAllowedIPs: true,
+			AllowedIPs:        p.AllowedIPs,
+		}
+
+		if p.PresharedKey != (wgtypes.Key{}) {
+			psk := p.PresharedKey
+			pc.PresharedKey = &psk
+		}
+		if p.PersistentKeepaliveInterval != 0 {
+			ka := p.PersistentKeepaliveInterval
+			pc.PersistentKeepaliveInterval = &ka
+		}
+
+		ifi.Config.Peers = append(ifi.Config.Peers, pc)
+	}
+
+	return ifi
+}
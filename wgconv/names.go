@@ -0,0 +1,70 @@
+package wgconv
+
+import "github.com/danpashin/wgctrl/wgstore"
+
+// DefaultPeerNamesNamespace is the wgstore namespace used by a PeerNameStore
+// with no Namespace set.
+const DefaultPeerNamesNamespace = "wgconv.peer-names"
+
+// A PeerNameStore keeps the human-readable names of peers in a wgstore.Store,
+// keyed by public key, so that names survive a round trip through a device,
+// which has no notion of names.
+//
+// Names are embedded in an export by calling Load before writing an
+// Interface, and names edited in an exported file are re-ingested by calling
+// Save after reading it.
+type PeerNameStore struct {
+	// Store is the underlying key/value store.
+	Store wgstore.Store
+
+	// Namespace is the namespace of the stored names. If empty,
+	// DefaultPeerNamesNamespace is used.
+	Namespace string
+}
+
+// Load sets the name of each peer of ifi which has a name in the store. Names
+// already present in ifi.PeerNames take precedence over stored names.
+func (s *PeerNameStore) Load(ifi *Interface) error {
+	names, err := s.Store.List(s.namespace())
+	if err != nil {
+		return err
+	}
+
+	for i, p := range ifi.Config.Peers {
+		if ifi.PeerNames[p.PublicKey] != "" {
+			continue
+		}
+
+		ifi.setPeerName(i, string(names[p.PublicKey.String()]))
+	}
+
+	return nil
+}
+
+// Save stores the name of each peer of ifi which has one. The stored names of
+// peers without a name in ifi are left unchanged, so that reading a format
+// which can't hold names does not discard them.
+func (s *PeerNameStore) Save(ifi Interface) error {
+	ns := s.namespace()
+	for _, p := range ifi.Config.Peers {
+		name := ifi.PeerNames[p.PublicKey]
+		if name == "" {
+			continue
+		}
+
+		if err := s.Store.Put(ns, p.PublicKey.String(), []byte(name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// namespace returns the namespace of the stored names.
+func (s *PeerNameStore) namespace() string {
+	if s.Namespace == "" {
+		return DefaultPeerNamesNamespace
+	}
+
+	return s.Namespace
+}
@@ -0,0 +1,59 @@
+package wgconv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/danpashin/wgctrl/wgstore"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPeerNameStoreRoundTrip(t *testing.T) {
+	s := &PeerNameStore{Store: &wgstore.MemoryStore{}}
+
+	// A device has no names, so they are only known from the store.
+	ifi := testInterface("wg0")
+	ifi.PeerNames = nil
+	if err := s.Save(ifi); err != nil {
+		t.Fatalf("failed to save empty names: %v", err)
+	}
+
+	if err := s.Store.Put(DefaultPeerNamesNamespace, testPeerA.String(), []byte("laptop")); err != nil {
+		t.Fatalf("failed to seed store: %v", err)
+	}
+	if err := s.Load(&ifi); err != nil {
+		t.Fatalf("failed to load names: %v", err)
+	}
+
+	if diff := cmp.Diff(map[wgtypes.Key]string{testPeerA: "laptop"}, ifi.PeerNames); diff != "" {
+		t.Fatalf("unexpected loaded names (-want +got):\n%s", diff)
+	}
+
+	// Export the names, edit them by hand, and re-ingest the result.
+	var buf bytes.Buffer
+	if err := WriteOPNsense(&buf, []Interface{ifi}); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	edited := strings.Replace(buf.String(), "<name>laptop</name>", "<name>desktop</name>", 1)
+	ifis, err := ReadOPNsense(strings.NewReader(edited))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if err := s.Save(ifis[0]); err != nil {
+		t.Fatalf("failed to save names: %v", err)
+	}
+
+	got, err := s.Store.List(DefaultPeerNamesNamespace)
+	if err != nil {
+		t.Fatalf("failed to list names: %v", err)
+	}
+
+	want := map[string][]byte{testPeerA.String(): []byte("desktop")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected stored names (-want +got):\n%s", diff)
+	}
+}
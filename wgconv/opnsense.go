@@ -0,0 +1,267 @@
+package wgconv
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// opnsenseConfig is the subset of an OPNsense config.xml document which holds
+// the WireGuard plugin configuration.
+type opnsenseConfig struct {
+	XMLName   xml.Name          `xml:"opnsense"`
+	WireGuard opnsenseWireGuard `xml:"OPNsense>wireguard"`
+}
+
+type opnsenseWireGuard struct {
+	Enabled string           `xml:"general>enabled"`
+	Servers []opnsenseServer `xml:"server>servers>server"`
+	Clients []opnsenseClient `xml:"client>clients>client"`
+}
+
+type opnsenseServer struct {
+	UUID          string `xml:"uuid,attr"`
+	Enabled       string `xml:"enabled"`
+	Name          string `xml:"name"`
+	Instance      string `xml:"instance"`
+	PublicKey     string `xml:"pubkey"`
+	PrivateKey    string `xml:"privkey"`
+	Port          string `xml:"port"`
+	TunnelAddress string `xml:"tunneladdress"`
+	Peers         string `xml:"peers"`
+}
+
+type opnsenseClient struct {
+	UUID          string `xml:"uuid,attr"`
+	Enabled       string `xml:"enabled"`
+	Name          string `xml:"name"`
+	PublicKey     string `xml:"pubkey"`
+	PresharedKey  string `xml:"psk"`
+	TunnelAddress string `xml:"tunneladdress"`
+	ServerAddress string `xml:"serveraddress"`
+	ServerPort    string `xml:"serverport"`
+	Keepalive     string `xml:"keepalive"`
+}
+
+// ReadOPNsense reads the WireGuard instances ("servers") and their peers
+// ("clients") from an OPNsense config.xml document. Disabled instances and
+// peers are skipped. Each instance is named after its WireGuard device, such
+// as "wg0", and the instance name is used as its Description.
+func ReadOPNsense(r io.Reader) ([]Interface, error) {
+	var cfg opnsenseConfig
+	if err := xml.NewDecoder(r).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("wgconv: failed to decode OPNsense configuration: %v", err)
+	}
+
+	clients := make(map[string]opnsenseClient, len(cfg.WireGuard.Clients))
+	for _, c := range cfg.WireGuard.Clients {
+		clients[c.UUID] = c
+	}
+
+	var ifis []Interface
+	for _, s := range cfg.WireGuard.Servers {
+		if s.Enabled != "1" {
+			continue
+		}
+
+		ifi, err := s.toInterface(clients)
+		if err != nil {
+			return nil, fmt.Errorf("wgconv: invalid OPNsense instance %q: %v", s.Name, err)
+		}
+
+		ifis = append(ifis, *ifi)
+	}
+
+	return ifis, nil
+}
+
+func (s opnsenseServer) toInterface(clients map[string]opnsenseClient) (*Interface, error) {
+	priv, err := parseKey(s.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := parseCIDRs(s.TunnelAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	ifi := &Interface{
+		Name:        "wg" + s.Instance,
+		Description: s.Name,
+		Addresses:   addrs,
+		Config: wgtypes.Config{
+			PrivateKey:   priv,
+			ReplacePeers: true,
+			Peers:        []wgtypes.PeerConfig{},
+		},
+	}
+
+	if s.Port != "" {
+		port, err := strconv.ParseUint(s.Port, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %v", s.Port, err)
+		}
+
+		p := int(port)
+		ifi.Config.ListenPort = &p
+	}
+
+	for _, id := range strings.Split(s.Peers, ",") {
+		c, ok := clients[strings.TrimSpace(id)]
+		if !ok || c.Enabled != "1" {
+			continue
+		}
+
+		if err := c.appendTo(ifi); err != nil {
+			return nil, fmt.Errorf("invalid peer %q: %v", c.Name, err)
+		}
+	}
+
+	return ifi, nil
+}
+
+func (c opnsenseClient) appendTo(ifi *Interface) error {
+	pub, err := parseKey(c.PublicKey)
+	if err != nil {
+		return err
+	}
+	if pub == nil {
+		return fmt.Errorf("missing public key")
+	}
+
+	psk, err := parseKey(c.PresharedKey)
+	if err != nil {
+		return err
+	}
+
+	ips, err := parseCIDRs(c.TunnelAddress)
+	if err != nil {
+		return err
+	}
+
+	pc := wgtypes.PeerConfig{
+		PublicKey:         *pub,
+		PresharedKey:      psk,
+		ReplaceAllowedIPs: true,
+		AllowedIPs:        ips,
+	}
+
+	if c.Keepalive != "" {
+		secs, err := strconv.ParseUint(c.Keepalive, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid keepalive %q: %v", c.Keepalive, err)
+		}
+
+		d := time.Duration(secs) * time.Second
+		pc.PersistentKeepaliveInterval = &d
+	}
+
+	ifi.Config.Peers = append(ifi.Config.Peers, pc)
+	i := len(ifi.Config.Peers) - 1
+
+	// OPNsense requires a name, so unnamed peers are written with a
+	// placeholder which is not a name of its own.
+	if c.Name != opnsensePlaceholderName(*pub) {
+		ifi.setPeerName(i, c.Name)
+	}
+	return ifi.setPeerEndpoint(i, c.ServerAddress, c.ServerPort)
+}
+
+// WriteOPNsense writes ifis as an OPNsense config.xml document containing only
+// the WireGuard plugin configuration, suitable for restoring the WireGuard
+// area of an appliance's configuration. Interface names must be of the form
+// "wg<instance>".
+func WriteOPNsense(w io.Writer, ifis []Interface) error {
+	var cfg opnsenseConfig
+	cfg.WireGuard.Enabled = "1"
+
+	for _, ifi := range ifis {
+		instance := strings.TrimPrefix(ifi.Name, "wg")
+		if _, err := strconv.Atoi(instance); err != nil || instance == ifi.Name {
+			return fmt.Errorf("wgconv: OPNsense interface name %q must be of the form wg<instance>", ifi.Name)
+		}
+
+		s := opnsenseServer{
+			UUID:          stableUUID("server:" + ifi.Name),
+			Enabled:       "1",
+			Name:          ifi.Description,
+			Instance:      instance,
+			TunnelAddress: joinCIDRs(ifi.Addresses),
+		}
+		if s.Name == "" {
+			s.Name = ifi.Name
+		}
+
+		if ifi.Config.PrivateKey != nil {
+			s.PrivateKey = ifi.Config.PrivateKey.String()
+			s.PublicKey = ifi.Config.PrivateKey.PublicKey().String()
+		}
+		if ifi.Config.ListenPort != nil {
+			s.Port = strconv.Itoa(*ifi.Config.ListenPort)
+		}
+
+		var ids []string
+		for _, p := range ifi.Config.Peers {
+			if p.Remove {
+				continue
+			}
+
+			c := opnsenseClient{
+				UUID:          stableUUID("client:" + ifi.Name + ":" + p.PublicKey.String()),
+				Enabled:       "1",
+				Name:          ifi.PeerNames[p.PublicKey],
+				PublicKey:     p.PublicKey.String(),
+				TunnelAddress: joinCIDRs(p.AllowedIPs),
+			}
+			if c.Name == "" {
+				c.Name = opnsensePlaceholderName(p.PublicKey)
+			}
+			if p.PresharedKey != nil {
+				c.PresharedKey = p.PresharedKey.String()
+			}
+			if p.PersistentKeepaliveInterval != nil && *p.PersistentKeepaliveInterval > 0 {
+				c.Keepalive = strconv.Itoa(int(*p.PersistentKeepaliveInterval / time.Second))
+			}
+			if host, port := ifi.peerEndpoint(p); host != "" {
+				c.ServerAddress = host
+				c.ServerPort = strconv.Itoa(port)
+			}
+
+			ids = append(ids, c.UUID)
+			cfg.WireGuard.Clients = append(cfg.WireGuard.Clients, c)
+		}
+
+		s.Peers = strings.Join(ids, ",")
+		cfg.WireGuard.Servers = append(cfg.WireGuard.Servers, s)
+	}
+
+	return writeXML(w, cfg)
+}
+
+// writeXML writes v as an indented XML document.
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("wgconv: failed to encode XML: %v", err)
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// opnsensePlaceholderName returns the name written for a peer with public key
+// pub which has no name.
+func opnsensePlaceholderName(pub wgtypes.Key) string {
+	return pub.String()[:8]
+}
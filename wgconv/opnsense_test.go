@@ -0,0 +1,197 @@
+package wgconv
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	testPrivate = wgtest.MustHexKey("e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a")
+	testPeerA   = wgtest.MustHexKey("b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33")
+	testPeerB   = wgtest.MustHexKey("58402e695ba1772b1cc9309755f043251ea77fdcf10fbe63989ceb7e19321376")
+	testPSK     = wgtest.MustHexKey("188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52")
+)
+
+// testInterface returns the Interface described by the sample documents.
+func testInterface(name string) Interface {
+	port := 51820
+	keepalive := 25 * time.Second
+
+	return Interface{
+		Name:        name,
+		Description: "office",
+		Addresses:   []net.IPNet{mustAddr("10.0.0.1/24"), mustAddr("fd00::1/64")},
+		Config: wgtypes.Config{
+			PrivateKey:   &testPrivate,
+			ListenPort:   &port,
+			ReplacePeers: true,
+			Peers: []wgtypes.PeerConfig{
+				{
+					PublicKey:                   testPeerA,
+					PresharedKey:                &testPSK,
+					Endpoint:                    wgtest.MustUDPAddr("192.0.2.1:51821"),
+					PersistentKeepaliveInterval: &keepalive,
+					ReplaceAllowedIPs:           true,
+					AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")},
+				},
+				{
+					PublicKey:         testPeerB,
+					ReplaceAllowedIPs: true,
+					AllowedIPs: []net.IPNet{
+						wgtest.MustCIDR("10.0.1.0/24"),
+						wgtest.MustCIDR("fd00:1::/64"),
+					},
+				},
+			},
+		},
+		Endpoints: map[wgtypes.Key]string{testPeerB: "vpn.example.com:51820"},
+		PeerNames: map[wgtypes.Key]string{testPeerA: "laptop", testPeerB: "branch"},
+	}
+}
+
+const opnsenseSample = `<?xml version="1.0"?>
+<opnsense>
+  <system><hostname>fw</hostname></system>
+  <OPNsense>
+    <wireguard>
+      <general><enabled>1</enabled></general>
+      <server>
+        <servers>
+          <server uuid="s1">
+            <enabled>1</enabled>
+            <name>office</name>
+            <instance>0</instance>
+            <pubkey>ignored</pubkey>
+            <privkey>{{priv}}</privkey>
+            <port>51820</port>
+            <mtu/>
+            <tunneladdress>10.0.0.1/24,fd00::1/64</tunneladdress>
+            <peers>c1,c2,c3</peers>
+          </server>
+          <server uuid="s2">
+            <enabled>0</enabled>
+            <name>disabled</name>
+            <instance>1</instance>
+          </server>
+        </servers>
+      </server>
+      <client>
+        <clients>
+          <client uuid="c1">
+            <enabled>1</enabled>
+            <name>laptop</name>
+            <pubkey>{{peerA}}</pubkey>
+            <psk>{{psk}}</psk>
+            <tunneladdress>10.0.0.2/32</tunneladdress>
+            <serveraddress>192.0.2.1</serveraddress>
+            <serverport>51821</serverport>
+            <keepalive>25</keepalive>
+          </client>
+          <client uuid="c2">
+            <enabled>1</enabled>
+            <name>branch</name>
+            <pubkey>{{peerB}}</pubkey>
+            <psk/>
+            <tunneladdress>10.0.1.0/24,fd00:1::/64</tunneladdress>
+            <serveraddress>vpn.example.com</serveraddress>
+            <serverport>51820</serverport>
+            <keepalive/>
+          </client>
+          <client uuid="c3">
+            <enabled>0</enabled>
+            <name>disabled</name>
+          </client>
+        </clients>
+      </client>
+    </wireguard>
+  </OPNsense>
+</opnsense>
+`
+
+func TestReadOPNsense(t *testing.T) {
+	ifis, err := ReadOPNsense(strings.NewReader(fillKeys(opnsenseSample)))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff([]Interface{testInterface("wg0")}, ifis); diff != "" {
+		t.Fatalf("unexpected interfaces (-want +got):\n%s", diff)
+	}
+}
+
+func TestOPNsenseRoundTrip(t *testing.T) {
+	want := []Interface{testInterface("wg0")}
+
+	var buf bytes.Buffer
+	if err := WriteOPNsense(&buf, want); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	got, err := ReadOPNsense(&buf)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected interfaces (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteOPNsenseBadName(t *testing.T) {
+	for _, name := range []string{"wg", "tun_wg0", "wgx"} {
+		if err := WriteOPNsense(&bytes.Buffer{}, []Interface{{Name: name}}); err == nil {
+			t.Fatalf("expected an error for %q, but none occurred", name)
+		}
+	}
+}
+
+func TestReadOPNsenseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{name: "not XML", doc: "wireguard"},
+		{name: "wrong root", doc: "<pfsense/>"},
+		{
+			name: "bad key",
+			doc: `<opnsense><OPNsense><wireguard><server><servers>
+<server><enabled>1</enabled><instance>0</instance><privkey>AAAA</privkey></server>
+</servers></server></wireguard></OPNsense></opnsense>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadOPNsense(strings.NewReader(tt.doc)); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// fillKeys replaces key placeholders in a sample document.
+func fillKeys(s string) string {
+	return strings.NewReplacer(
+		"{{priv}}", testPrivate.String(),
+		"{{peerA}}", testPeerA.String(),
+		"{{peerB}}", testPeerB.String(),
+		"{{psk}}", testPSK.String(),
+	).Replace(s)
+}
+
+func mustAddr(s string) net.IPNet {
+	cidr, err := parseCIDR(s)
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse address: %v", err))
+	}
+
+	return cidr
+}
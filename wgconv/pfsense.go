@@ -0,0 +1,260 @@
+package wgconv
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// pfsenseConfig is the subset of a pfSense config.xml document which holds
+// the WireGuard package configuration.
+type pfsenseConfig struct {
+	XMLName   xml.Name         `xml:"pfsense"`
+	WireGuard pfsenseWireGuard `xml:"installedpackages>wireguard"`
+}
+
+type pfsenseWireGuard struct {
+	Tunnels []pfsenseTunnel `xml:"tunnels>item"`
+	Peers   []pfsensePeer   `xml:"peers>item"`
+}
+
+type pfsenseTunnel struct {
+	Name       string           `xml:"name"`
+	Enabled    string           `xml:"enabled"`
+	Descr      string           `xml:"descr"`
+	ListenPort string           `xml:"listenport"`
+	PrivateKey string           `xml:"privatekey"`
+	PublicKey  string           `xml:"publickey"`
+	Addresses  []pfsenseAddress `xml:"addresses>row"`
+}
+
+type pfsensePeer struct {
+	Enabled             string           `xml:"enabled"`
+	Tunnel              string           `xml:"tun"`
+	Descr               string           `xml:"descr"`
+	Endpoint            string           `xml:"endpoint"`
+	Port                string           `xml:"port"`
+	PersistentKeepalive string           `xml:"persistentkeepalive"`
+	PublicKey           string           `xml:"publickey"`
+	PresharedKey        string           `xml:"presharedkey"`
+	AllowedIPs          []pfsenseAddress `xml:"allowedips>row"`
+}
+
+type pfsenseAddress struct {
+	Address string `xml:"address"`
+	Mask    string `xml:"mask"`
+	Descr   string `xml:"descr"`
+}
+
+// ReadPfSense reads the WireGuard tunnels and their peers from a pfSense
+// config.xml document. Disabled tunnels and peers are skipped. Each tunnel is
+// named after its network interface, such as "tun_wg0".
+func ReadPfSense(r io.Reader) ([]Interface, error) {
+	var cfg pfsenseConfig
+	if err := xml.NewDecoder(r).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("wgconv: failed to decode pfSense configuration: %v", err)
+	}
+
+	var ifis []Interface
+	for _, t := range cfg.WireGuard.Tunnels {
+		if t.Enabled != "yes" {
+			continue
+		}
+
+		ifi, err := t.toInterface(cfg.WireGuard.Peers)
+		if err != nil {
+			return nil, fmt.Errorf("wgconv: invalid pfSense tunnel %q: %v", t.Name, err)
+		}
+
+		ifis = append(ifis, *ifi)
+	}
+
+	return ifis, nil
+}
+
+func (t pfsenseTunnel) toInterface(peers []pfsensePeer) (*Interface, error) {
+	priv, err := parseKey(t.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := parsePfSenseAddresses(t.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	ifi := &Interface{
+		Name:        t.Name,
+		Description: t.Descr,
+		Addresses:   addrs,
+		Config: wgtypes.Config{
+			PrivateKey:   priv,
+			ReplacePeers: true,
+			Peers:        []wgtypes.PeerConfig{},
+		},
+	}
+
+	if t.ListenPort != "" {
+		port, err := strconv.ParseUint(t.ListenPort, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen port %q: %v", t.ListenPort, err)
+		}
+
+		p := int(port)
+		ifi.Config.ListenPort = &p
+	}
+
+	for _, p := range peers {
+		if p.Tunnel != t.Name || p.Enabled != "yes" {
+			continue
+		}
+
+		if err := p.appendTo(ifi); err != nil {
+			return nil, fmt.Errorf("invalid peer %q: %v", p.Descr, err)
+		}
+	}
+
+	return ifi, nil
+}
+
+func (p pfsensePeer) appendTo(ifi *Interface) error {
+	pub, err := parseKey(p.PublicKey)
+	if err != nil {
+		return err
+	}
+	if pub == nil {
+		return fmt.Errorf("missing public key")
+	}
+
+	psk, err := parseKey(p.PresharedKey)
+	if err != nil {
+		return err
+	}
+
+	ips, err := parsePfSenseAddresses(p.AllowedIPs)
+	if err != nil {
+		return err
+	}
+
+	pc := wgtypes.PeerConfig{
+		PublicKey:         *pub,
+		PresharedKey:      psk,
+		ReplaceAllowedIPs: true,
+		AllowedIPs:        ips,
+	}
+
+	if p.PersistentKeepalive != "" {
+		secs, err := strconv.ParseUint(p.PersistentKeepalive, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid keepalive %q: %v", p.PersistentKeepalive, err)
+		}
+
+		d := time.Duration(secs) * time.Second
+		pc.PersistentKeepaliveInterval = &d
+	}
+
+	ifi.Config.Peers = append(ifi.Config.Peers, pc)
+	i := len(ifi.Config.Peers) - 1
+
+	ifi.setPeerName(i, p.Descr)
+
+	// pfSense uses the default WireGuard port when none is specified.
+	port := p.Port
+	if port == "" {
+		port = "51820"
+	}
+
+	return ifi.setPeerEndpoint(i, p.Endpoint, port)
+}
+
+// parsePfSenseAddresses parses address and prefix length rows.
+func parsePfSenseAddresses(rows []pfsenseAddress) ([]net.IPNet, error) {
+	var out []net.IPNet
+	for _, r := range rows {
+		s := r.Address
+		if r.Mask != "" {
+			s += "/" + r.Mask
+		}
+
+		cidr, err := parseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, cidr)
+	}
+
+	return out, nil
+}
+
+// WritePfSense writes ifis as a pfSense config.xml document containing only
+// the WireGuard package configuration.
+func WritePfSense(w io.Writer, ifis []Interface) error {
+	var cfg pfsenseConfig
+
+	for _, ifi := range ifis {
+		t := pfsenseTunnel{
+			Name:      ifi.Name,
+			Enabled:   "yes",
+			Descr:     ifi.Description,
+			Addresses: pfSenseAddresses(ifi.Addresses),
+		}
+
+		if ifi.Config.PrivateKey != nil {
+			t.PrivateKey = ifi.Config.PrivateKey.String()
+			t.PublicKey = ifi.Config.PrivateKey.PublicKey().String()
+		}
+		if ifi.Config.ListenPort != nil {
+			t.ListenPort = strconv.Itoa(*ifi.Config.ListenPort)
+		}
+
+		for _, p := range ifi.Config.Peers {
+			if p.Remove {
+				continue
+			}
+
+			pp := pfsensePeer{
+				Enabled:    "yes",
+				Tunnel:     ifi.Name,
+				Descr:      ifi.PeerNames[p.PublicKey],
+				PublicKey:  p.PublicKey.String(),
+				AllowedIPs: pfSenseAddresses(p.AllowedIPs),
+			}
+			if p.PresharedKey != nil {
+				pp.PresharedKey = p.PresharedKey.String()
+			}
+			if p.PersistentKeepaliveInterval != nil && *p.PersistentKeepaliveInterval > 0 {
+				pp.PersistentKeepalive = strconv.Itoa(int(*p.PersistentKeepaliveInterval / time.Second))
+			}
+			if host, port := ifi.peerEndpoint(p); host != "" {
+				pp.Endpoint = host
+				pp.Port = strconv.Itoa(port)
+			}
+
+			cfg.WireGuard.Peers = append(cfg.WireGuard.Peers, pp)
+		}
+
+		cfg.WireGuard.Tunnels = append(cfg.WireGuard.Tunnels, t)
+	}
+
+	return writeXML(w, cfg)
+}
+
+// pfSenseAddresses converts ips to address and prefix length rows.
+func pfSenseAddresses(ips []net.IPNet) []pfsenseAddress {
+	rows := make([]pfsenseAddress, 0, len(ips))
+	for _, ip := range ips {
+		ones, _ := ip.Mask.Size()
+		rows = append(rows, pfsenseAddress{
+			Address: ip.IP.String(),
+			Mask:    strconv.Itoa(ones),
+		})
+	}
+
+	return rows
+}
@@ -0,0 +1,105 @@
+package wgconv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const pfsenseSample = `<?xml version="1.0"?>
+<pfsense>
+  <installedpackages>
+    <wireguard>
+      <tunnels>
+        <item>
+          <name>tun_wg0</name>
+          <enabled>yes</enabled>
+          <descr>office</descr>
+          <listenport>51820</listenport>
+          <privatekey>{{priv}}</privatekey>
+          <publickey>ignored</publickey>
+          <mtu>1420</mtu>
+          <addresses>
+            <row><address>10.0.0.1</address><mask>24</mask><descr/></row>
+            <row><address>fd00::1</address><mask>64</mask><descr/></row>
+          </addresses>
+        </item>
+        <item>
+          <name>tun_wg1</name>
+          <enabled>no</enabled>
+        </item>
+      </tunnels>
+      <peers>
+        <item>
+          <enabled>yes</enabled>
+          <tun>tun_wg0</tun>
+          <descr>laptop</descr>
+          <endpoint>192.0.2.1</endpoint>
+          <port>51821</port>
+          <persistentkeepalive>25</persistentkeepalive>
+          <publickey>{{peerA}}</publickey>
+          <presharedkey>{{psk}}</presharedkey>
+          <allowedips>
+            <row><address>10.0.0.2</address><mask>32</mask><descr/></row>
+          </allowedips>
+        </item>
+        <item>
+          <enabled>yes</enabled>
+          <tun>tun_wg0</tun>
+          <descr>branch</descr>
+          <endpoint>vpn.example.com</endpoint>
+          <port/>
+          <persistentkeepalive/>
+          <publickey>{{peerB}}</publickey>
+          <presharedkey/>
+          <allowedips>
+            <row><address>10.0.1.0</address><mask>24</mask><descr/></row>
+            <row><address>fd00:1::</address><mask>64</mask><descr/></row>
+          </allowedips>
+        </item>
+        <item>
+          <enabled>no</enabled>
+          <tun>tun_wg0</tun>
+          <publickey>{{peerA}}</publickey>
+        </item>
+        <item>
+          <enabled>yes</enabled>
+          <tun>tun_wg1</tun>
+          <publickey>{{peerA}}</publickey>
+        </item>
+      </peers>
+    </wireguard>
+  </installedpackages>
+</pfsense>
+`
+
+func TestReadPfSense(t *testing.T) {
+	ifis, err := ReadPfSense(strings.NewReader(fillKeys(pfsenseSample)))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff([]Interface{testInterface("tun_wg0")}, ifis); diff != "" {
+		t.Fatalf("unexpected interfaces (-want +got):\n%s", diff)
+	}
+}
+
+func TestPfSenseRoundTrip(t *testing.T) {
+	want := []Interface{testInterface("tun_wg0")}
+
+	var buf bytes.Buffer
+	if err := WritePfSense(&buf, want); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	got, err := ReadPfSense(&buf)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected interfaces (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,133 @@
+package wgconv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// WriteRouterOS writes a MikroTik RouterOS v7 script to w which creates the
+// WireGuard interface ifi, its peers, and its addresses.
+//
+// RouterOS has no equivalent to the device firewall mark, so it is ignored.
+// An error is returned if ifi uses AmneziaWG parameters, which RouterOS does
+// not support.
+func WriteRouterOS(w io.Writer, ifi Interface) error {
+	if ifi.Config.AdvancedSecurityConfig != (wgtypes.AdvancedSecurityConfig{}) {
+		return errors.New("wgconv: RouterOS does not support AmneziaWG parameters")
+	}
+	if ifi.Name == "" {
+		return errors.New("wgconv: RouterOS interface must have a name")
+	}
+
+	bw := bufio.NewWriter(w)
+	name := rosQuote(ifi.Name)
+
+	fmt.Fprintln(bw, "/interface/wireguard")
+	args := []string{"name=" + name}
+	if ifi.Config.ListenPort != nil {
+		args = append(args, "listen-port="+strconv.Itoa(*ifi.Config.ListenPort))
+	}
+	if ifi.Config.PrivateKey != nil {
+		args = append(args, "private-key="+rosQuote(ifi.Config.PrivateKey.String()))
+	}
+	if ifi.Description != "" {
+		args = append(args, "comment="+rosQuote(ifi.Description))
+	}
+	fmt.Fprintf(bw, "add %s\n", strings.Join(args, " "))
+
+	if len(ifi.Config.Peers) > 0 || ifi.Config.ReplacePeers {
+		fmt.Fprintln(bw, "/interface/wireguard/peers")
+	}
+	if ifi.Config.ReplacePeers {
+		fmt.Fprintf(bw, "remove [find interface=%s]\n", name)
+	}
+
+	for _, p := range ifi.Config.Peers {
+		if p.Remove {
+			fmt.Fprintf(bw, "remove [find interface=%s public-key=%s]\n", name, rosQuote(p.PublicKey.String()))
+			continue
+		}
+
+		args := []string{
+			"interface=" + name,
+			"public-key=" + rosQuote(p.PublicKey.String()),
+		}
+		if p.PresharedKey != nil {
+			args = append(args, "preshared-key="+rosQuote(p.PresharedKey.String()))
+		}
+		if host, port := ifi.peerEndpoint(p); host != "" {
+			args = append(args,
+				"endpoint-address="+rosQuote(host),
+				"endpoint-port="+strconv.Itoa(port),
+			)
+		}
+		if len(p.AllowedIPs) > 0 {
+			args = append(args, "allowed-address="+joinCIDRs(p.AllowedIPs))
+		}
+		if p.PersistentKeepaliveInterval != nil && *p.PersistentKeepaliveInterval > 0 {
+			args = append(args, fmt.Sprintf("persistent-keepalive=%ds", *p.PersistentKeepaliveInterval/time.Second))
+		}
+		if c := ifi.PeerNames[p.PublicKey]; c != "" {
+			args = append(args, "comment="+rosQuote(c))
+		}
+
+		fmt.Fprintf(bw, "add %s\n", strings.Join(args, " "))
+	}
+
+	var v4, v6 []string
+	for _, a := range ifi.Addresses {
+		if a.IP.To4() != nil {
+			v4 = append(v4, a.String())
+		} else {
+			v6 = append(v6, a.String())
+		}
+	}
+
+	if len(v4) > 0 {
+		fmt.Fprintln(bw, "/ip/address")
+		for _, a := range v4 {
+			fmt.Fprintf(bw, "add address=%s interface=%s\n", a, name)
+		}
+	}
+	if len(v6) > 0 {
+		fmt.Fprintln(bw, "/ipv6/address")
+		for _, a := range v6 {
+			// Router advertisements are meaningless on a point-to-point
+			// tunnel.
+			fmt.Fprintf(bw, "add address=%s interface=%s advertise=no\n", a, name)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// rosQuote quotes s as a RouterOS string literal.
+func rosQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\', '$', '?':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
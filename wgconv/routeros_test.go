@@ -0,0 +1,125 @@
+package wgconv
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteRouterOS(t *testing.T) {
+	ifi := testInterface("wg0")
+	ifi.Description = `HQ "main"`
+
+	var buf bytes.Buffer
+	if err := WriteRouterOS(&buf, ifi); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	want := `/interface/wireguard
+add name="wg0" listen-port=51820 private-key="6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA/rpSAno=" comment="HQ \"main\""
+/interface/wireguard/peers
+remove [find interface="wg0"]
+add interface="wg0" public-key="uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM=" preshared-key="GIUVCT6VL18i6GXO8wEucvi18LWYrAMJ1drM47cPz1I=" endpoint-address="192.0.2.1" endpoint-port=51821 allowed-address=10.0.0.2/32 persistent-keepalive=25s comment="laptop"
+add interface="wg0" public-key="WEAuaVuhdyscyTCXVfBDJR6nf9zxD75jmJzrfhkyE3Y=" endpoint-address="vpn.example.com" endpoint-port=51820 allowed-address=10.0.1.0/24,fd00:1::/64 comment="branch"
+/ip/address
+add address=10.0.0.1/24 interface="wg0"
+/ipv6/address
+add address=fd00::1/64 interface="wg0" advertise=no
+`
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("unexpected script (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteRouterOSErrors(t *testing.T) {
+	jc := uint16(4)
+
+	tests := []struct {
+		name string
+		ifi  Interface
+	}{
+		{
+			name: "no name",
+		},
+		{
+			name: "amnezia",
+			ifi: Interface{
+				Name: "wg0",
+				Config: wgtypes.Config{
+					AdvancedSecurityConfig: wgtypes.AdvancedSecurityConfig{JunkPacketCount: &jc},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := WriteRouterOS(&bytes.Buffer{}, tt.ifi); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestFromDevice(t *testing.T) {
+	var (
+		port      = 51820
+		keepalive = 25 * time.Second
+	)
+
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		Type:       wgtypes.LinuxKernel,
+		PrivateKey: testPrivate,
+		PublicKey:  testPrivate.PublicKey(),
+		ListenPort: port,
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:                   testPeerA,
+				PresharedKey:                testPSK,
+				Endpoint:                    wgtest.MustUDPAddr("192.0.2.1:51821"),
+				PersistentKeepaliveInterval: keepalive,
+				LastHandshakeTime:           time.Unix(1, 0),
+				ReceiveBytes:                1,
+				TransmitBytes:               2,
+				AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")},
+			},
+			{
+				PublicKey: testPeerB,
+			},
+		},
+	}
+
+	want := Interface{
+		Name: "wg0",
+		Config: wgtypes.Config{
+			PrivateKey:   &testPrivate,
+			ListenPort:   &port,
+			ReplacePeers: true,
+			Peers: []wgtypes.PeerConfig{
+				{
+					PublicKey:                   testPeerA,
+					PresharedKey:                &testPSK,
+					Endpoint:                    wgtest.MustUDPAddr("192.0.2.1:51821"),
+					PersistentKeepaliveInterval: &keepalive,
+					ReplaceAllowedIPs:           true,
+					AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")},
+				},
+				{
+					PublicKey:         testPeerB,
+					ReplaceAllowedIPs: true,
+				},
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, FromDevice(d)); diff != "" {
+		t.Fatalf("unexpected Interface (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,269 @@
+package wgconv
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// maxWGQuickSize is the largest wg-quick configuration file read from an
+// archive, which guards against archives that expand to huge files.
+const maxWGQuickSize = 1 << 20
+
+// ReadWGQuick reads a wg-quick(8) configuration file, such as one written by
+// the WireGuard apps, into an Interface named name. Address is read into
+// Interface.Addresses, and the AmneziaWG keys of awg-quick into the
+// AdvancedSecurityConfig. Other keys which are only meaningful to wg-quick,
+// such as DNS, MTU, and the hook scripts, are ignored.
+func ReadWGQuick(name string, r io.Reader) (Interface, error) {
+	ifi, err := parseWGQuick(name, r)
+	if err != nil {
+		return Interface{}, fmt.Errorf("wgconv: invalid wg-quick configuration: %v", err)
+	}
+
+	return ifi, nil
+}
+
+// parseWGQuick implements ReadWGQuick.
+func parseWGQuick(name string, r io.Reader) (Interface, error) {
+	ifi := Interface{
+		Name: name,
+		Config: wgtypes.Config{
+			ReplacePeers: true,
+			Peers:        []wgtypes.PeerConfig{},
+		},
+	}
+
+	var (
+		section string
+
+		// endpoints holds the endpoint of each peer, which is only set once
+		// the whole file is read, because it is keyed by the peer's public
+		// key.
+		endpoints []string
+	)
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(line[1 : len(line)-1])
+			switch section {
+			case "interface":
+			case "peer":
+				ifi.Config.Peers = append(ifi.Config.Peers, wgtypes.PeerConfig{ReplaceAllowedIPs: true})
+				endpoints = append(endpoints, "")
+			default:
+				return Interface{}, fmt.Errorf("line %d: unknown section %q", n, line)
+			}
+
+			continue
+		}
+
+		key, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return Interface{}, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, v = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(v)
+
+		var err error
+		switch section {
+		case "interface":
+			err = ifi.parseWGQuickInterface(key, v)
+		case "peer":
+			i := len(ifi.Config.Peers) - 1
+			if key == "endpoint" {
+				endpoints[i] = v
+				break
+			}
+
+			err = parseWGQuickPeer(key, v, &ifi.Config.Peers[i])
+		default:
+			err = fmt.Errorf("key %q outside of a section", key)
+		}
+		if err != nil {
+			return Interface{}, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return Interface{}, err
+	}
+
+	for i, p := range ifi.Config.Peers {
+		if p.PublicKey == (wgtypes.Key{}) {
+			return Interface{}, fmt.Errorf("peer %d has no public key", i)
+		}
+
+		if endpoints[i] == "" {
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(endpoints[i])
+		if err != nil {
+			return Interface{}, fmt.Errorf("peer %d: invalid endpoint %q: %v", i, endpoints[i], err)
+		}
+		if err := ifi.setPeerEndpoint(i, host, port); err != nil {
+			return Interface{}, fmt.Errorf("peer %d: %v", i, err)
+		}
+	}
+
+	return ifi, nil
+}
+
+// parseWGQuickInterface parses a single key of an [Interface] section into
+// ifi.
+func (ifi *Interface) parseWGQuickInterface(key, v string) error {
+	switch key {
+	case "privatekey":
+		k, err := parseKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid private key: %v", err)
+		}
+
+		ifi.Config.PrivateKey = k
+	case "listenport":
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid listen port: %v", err)
+		}
+
+		p := int(port)
+		ifi.Config.ListenPort = &p
+	case "fwmark":
+		var mark uint64
+		if v != "off" {
+			var err error
+			if mark, err = strconv.ParseUint(v, 0, 32); err != nil {
+				return fmt.Errorf("invalid fwmark: %v", err)
+			}
+		}
+
+		m := int(mark)
+		ifi.Config.FirewallMark = &m
+	case "address":
+		addrs, err := parseCIDRs(v)
+		if err != nil {
+			return fmt.Errorf("invalid address: %v", err)
+		}
+
+		ifi.Addresses = append(ifi.Addresses, addrs...)
+	case "dns", "mtu", "table", "preup", "postup", "predown", "postdown", "saveconfig",
+		"includedapplications", "excludedapplications":
+		// wg-quick(8) and the Android app only.
+	default:
+		ok, err := ifi.Config.AdvancedSecurityConfig.ParseUAPI(key, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("unknown interface key %q", key)
+		}
+	}
+
+	return nil
+}
+
+// parseWGQuickPeer parses a single key of a [Peer] section, other than
+// Endpoint, into p.
+func parseWGQuickPeer(key, v string, p *wgtypes.PeerConfig) error {
+	switch key {
+	case "publickey":
+		k, err := wgtypes.ParseKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid public key: %v", err)
+		}
+
+		p.PublicKey = k
+	case "presharedkey":
+		k, err := parseKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid preshared key: %v", err)
+		}
+
+		p.PresharedKey = k
+	case "persistentkeepalive":
+		var secs uint64
+		if v != "off" {
+			var err error
+			if secs, err = strconv.ParseUint(v, 10, 16); err != nil {
+				return fmt.Errorf("invalid persistent keepalive: %v", err)
+			}
+		}
+
+		d := time.Duration(secs) * time.Second
+		p.PersistentKeepaliveInterval = &d
+	case "allowedips":
+		// Allowed IPs accumulate across lines.
+		ips, err := parseCIDRs(v)
+		if err != nil {
+			return fmt.Errorf("invalid allowed IP: %v", err)
+		}
+
+		p.AllowedIPs = append(p.AllowedIPs, ips...)
+	default:
+		return fmt.Errorf("unknown peer key %q", key)
+	}
+
+	return nil
+}
+
+// ReadMobileExport reads the zip archive exported by the WireGuard apps for
+// Android and iOS, which holds a wg-quick configuration file for each tunnel.
+// Each file is read using ReadWGQuick into an Interface named after the file,
+// without its ".conf" extension, in the order of the archive. Other files,
+// and files in directories, are skipped.
+func ReadMobileExport(r io.ReaderAt, size int64) ([]Interface, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("wgconv: failed to read archive: %v", err)
+	}
+
+	var ifis []Interface
+	for _, f := range zr.File {
+		name := strings.TrimSuffix(f.Name, ".conf")
+		if name == f.Name || name == "" || path.Dir(f.Name) != "." {
+			continue
+		}
+
+		ifi, err := readZipWGQuick(f, name)
+		if err != nil {
+			return nil, fmt.Errorf("wgconv: invalid tunnel %q: %v", name, err)
+		}
+
+		ifis = append(ifis, ifi)
+	}
+
+	return ifis, nil
+}
+
+// readZipWGQuick reads the wg-quick configuration file f of an archive.
+func readZipWGQuick(f *zip.File, name string) (Interface, error) {
+	if f.UncompressedSize64 > maxWGQuickSize {
+		return Interface{}, fmt.Errorf("file is larger than %d bytes", maxWGQuickSize)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return Interface{}, err
+	}
+	defer rc.Close()
+
+	// The size in the archive header is not trusted.
+	return parseWGQuick(name, io.LimitReader(rc, maxWGQuickSize))
+}
@@ -0,0 +1,168 @@
+package wgconv
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+const wgquickSample = `[Interface]
+PrivateKey = {{priv}}
+ListenPort = 51820
+Address = 10.0.0.1/24, fd00::1/64
+DNS = 192.0.2.53
+ExcludedApplications = com.example.app
+
+# laptop
+[Peer]
+PublicKey = {{peerA}}
+PresharedKey = {{psk}}
+Endpoint = 192.0.2.1:51821
+PersistentKeepalive = 25
+AllowedIPs = 10.0.0.2/32
+
+[Peer]
+Endpoint = vpn.example.com:51820
+PublicKey = {{peerB}}
+AllowedIPs = 10.0.1.0/24
+AllowedIPs = fd00:1::/64
+`
+
+// wgquickInterface returns the Interface described by wgquickSample, which
+// has no description or peer names.
+func wgquickInterface(name string) Interface {
+	ifi := testInterface(name)
+	ifi.Description = ""
+	ifi.PeerNames = nil
+
+	return ifi
+}
+
+func TestReadWGQuick(t *testing.T) {
+	ifi, err := ReadWGQuick("wg0", strings.NewReader(fillKeys(wgquickSample)))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff(wgquickInterface("wg0"), ifi); diff != "" {
+		t.Fatalf("unexpected interface (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadWGQuickAmneziaWG(t *testing.T) {
+	const conf = `[Interface]
+Jc = 4
+H1 = 1234
+I1 = <b 0xf6ab3267fa><r 16>
+`
+
+	ifi, err := ReadWGQuick("awg0", strings.NewReader(conf))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	var (
+		jc uint16 = 4
+		h1 uint32 = 1234
+		i1        = "<b 0xf6ab3267fa><r 16>"
+	)
+
+	want := wgtypes.AdvancedSecurityConfig{
+		JunkPacketCount:       &jc,
+		InitPacketMagicHeader: &h1,
+		SpecialJunkPacket1:    &i1,
+	}
+
+	if diff := cmp.Diff(want, ifi.Config.AdvancedSecurityConfig); diff != "" {
+		t.Fatalf("unexpected AmneziaWG parameters (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadWGQuickErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+	}{
+		{name: "unknown section", conf: "[Tunnel]\n"},
+		{name: "no value", conf: "[Interface]\nPrivateKey\n"},
+		{name: "unknown key", conf: "[Interface]\nFoo = bar\n"},
+		{name: "no public key", conf: "[Peer]\nAllowedIPs = 10.0.0.0/8\n"},
+		{name: "bad endpoint", conf: "[Peer]\nPublicKey = {{peerA}}\nEndpoint = 192.0.2.1\n"},
+		{name: "bad address", conf: "[Interface]\nAddress = 10.0.0.300/24\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadWGQuick("wg0", strings.NewReader(fillKeys(tt.conf))); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestReadMobileExport(t *testing.T) {
+	b := mustZip(t, []zipFile{
+		{name: "home.conf", body: fillKeys(wgquickSample)},
+		{name: "README.txt", body: "not a tunnel"},
+		{name: "__MACOSX/._home.conf", body: "\x00\x05\x16\x07"},
+		{name: "office.conf", body: fillKeys(wgquickSample)},
+	})
+
+	ifis, err := ReadMobileExport(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	want := []Interface{wgquickInterface("home"), wgquickInterface("office")}
+	if diff := cmp.Diff(want, ifis); diff != "" {
+		t.Fatalf("unexpected interfaces (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadMobileExportErrors(t *testing.T) {
+	t.Run("not a zip archive", func(t *testing.T) {
+		b := []byte(fillKeys(wgquickSample))
+		if _, err := ReadMobileExport(bytes.NewReader(b), int64(len(b))); err == nil {
+			t.Fatal("expected an error, but none occurred")
+		}
+	})
+
+	t.Run("invalid tunnel", func(t *testing.T) {
+		b := mustZip(t, []zipFile{{name: "bad.conf", body: "[Tunnel]\n"}})
+
+		_, err := ReadMobileExport(bytes.NewReader(b), int64(len(b)))
+		if err == nil || !strings.Contains(err.Error(), `"bad"`) {
+			t.Fatalf("expected an error naming the tunnel, but got: %v", err)
+		}
+	})
+}
+
+type zipFile struct {
+	name, body string
+}
+
+// mustZip creates a zip archive holding files.
+func mustZip(t *testing.T, files []zipFile) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatalf("failed to create %q: %v", f.name, err)
+		}
+		if _, err := w.Write([]byte(f.body)); err != nil {
+			t.Fatalf("failed to write %q: %v", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,97 @@
+package wgctrltest_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+func BenchmarkClientDevice(b *testing.B) {
+	for _, n := range wgtest.BenchPeers {
+		b.Run(fmt.Sprintf("peers-%d", n), func(b *testing.B) {
+			c := newBenchClient(b, n)
+			defer c.Close()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				d, err := c.Device("wg0")
+				if err != nil {
+					b.Fatalf("failed to get device: %v", err)
+				}
+				if len(d.Peers) != n {
+					b.Fatalf("expected %d peers, but got %d", n, len(d.Peers))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkClientConfigureDevice(b *testing.B) {
+	for _, n := range wgtest.BenchPeers {
+		b.Run(fmt.Sprintf("peers-%d", n), func(b *testing.B) {
+			c := newBenchClient(b, 0)
+			defer c.Close()
+
+			cfg := wgtest.BenchConfig(n)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := c.ConfigureDevice("wg0", cfg); err != nil {
+					b.Fatalf("failed to configure device: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// newBenchClient creates a wgctrl.Client whose only backend is a benchBackend
+// with a device wg0 that has n peers.
+func newBenchClient(b *testing.B, n int) *wgctrl.Client {
+	b.Helper()
+
+	d := wgtypes.Preview(&wgtypes.Device{Name: "wg0", Type: wgtypes.Userspace}, wgtest.BenchConfig(n))
+
+	c, err := wgctrl.New(wgtypes.NativeClient, wgctrl.WithBackends(&benchBackend{d: d}))
+	if err != nil {
+		b.Fatalf("failed to create client: %v", err)
+	}
+
+	return c
+}
+
+// A benchBackend is a wgctrl.Backend with a single device, which it returns
+// without copying and never modifies, so that benchmarks measure the
+// wgctrl.Client rather than the in-memory implementation of this package.
+type benchBackend struct {
+	d *wgtypes.Device
+}
+
+func (b *benchBackend) Close() error { return nil }
+
+func (b *benchBackend) Devices() ([]*wgtypes.Device, error) {
+	return []*wgtypes.Device{b.d}, nil
+}
+
+func (b *benchBackend) Device(name string) (*wgtypes.Device, error) {
+	if name != b.d.Name {
+		return nil, os.ErrNotExist
+	}
+
+	return b.d, nil
+}
+
+func (b *benchBackend) ConfigureDevice(name string, _ wgtypes.Config) error {
+	if name != b.d.Name {
+		return os.ErrNotExist
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package wgctrltest
+
+import "github.com/danpashin/wgctrl/internal/wgtest"
+
+// A Capture is the data returned by a WireGuard implementation when it is
+// asked for a device, and the device which package wgctrl parses from it.
+// Captures may be used to test other parsers of the WireGuard netlink,
+// userspace configuration protocol (UAPI), and OpenBSD ioctl interfaces.
+//
+// Exactly one of the Messages, UAPI, and IOCtl fields is set, depending on
+// the Source of the capture:
+//   - Messages holds the payload of each generic netlink message, following
+//     the generic netlink header, in the reply to a WG_CMD_GET_DEVICE dump
+//     request, in the byte order of little-endian hosts.
+//   - UAPI holds the reply to a "get=1" operation, up to and including the
+//     blank line which ends it.
+//   - IOCtl holds the buffer filled by the SIOCGWG ioctl, in the layout used
+//     on 64-bit little-endian platforms.
+//
+// Keys, addresses, and counters in captures are anonymized.
+type Capture = wgtest.Capture
+
+// A CaptureSource is a WireGuard implementation from which a Capture was
+// taken.
+type CaptureSource = wgtest.Source
+
+// Possible CaptureSource values.
+const (
+	SourceLinux        CaptureSource = wgtest.SourceLinux
+	SourceAmneziaLinux CaptureSource = wgtest.SourceAmneziaLinux
+	SourceWireGuardGo  CaptureSource = wgtest.SourceWireGuardGo
+	SourceAmneziaGo    CaptureSource = wgtest.SourceAmneziaGo
+	SourceOpenBSD      CaptureSource = wgtest.SourceOpenBSD
+)
+
+// Captures returns the captures used to test the parsers of package wgctrl,
+// ordered by name. Each call returns new copies of the captures, which the
+// caller may modify.
+func Captures() []Capture { return wgtest.Captures() }
+
+// CapturesFrom returns the captures taken from src, ordered by name.
+func CapturesFrom(src CaptureSource) []Capture { return wgtest.CapturesFrom(src) }
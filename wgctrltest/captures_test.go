@@ -0,0 +1,54 @@
+package wgctrltest_test
+
+import (
+	"testing"
+
+	"github.com/danpashin/wgctrl/wgctrltest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCaptures(t *testing.T) {
+	sources := []wgctrltest.CaptureSource{
+		wgctrltest.SourceLinux,
+		wgctrltest.SourceAmneziaLinux,
+		wgctrltest.SourceWireGuardGo,
+		wgctrltest.SourceAmneziaGo,
+		wgctrltest.SourceOpenBSD,
+	}
+
+	var n int
+	for _, src := range sources {
+		cs := wgctrltest.CapturesFrom(src)
+		if len(cs) == 0 {
+			t.Fatalf("no captures from %q", src)
+		}
+		n += len(cs)
+
+		for _, c := range cs {
+			var set int
+			for _, ok := range []bool{len(c.Messages) > 0, len(c.UAPI) > 0, len(c.IOCtl) > 0} {
+				if ok {
+					set++
+				}
+			}
+			if set != 1 {
+				t.Fatalf("capture %q: expected exactly one payload, but got %d", c.Name, set)
+			}
+
+			if c.Device == nil || c.Device.Name == "" {
+				t.Fatalf("capture %q: no device", c.Name)
+			}
+		}
+	}
+
+	all := wgctrltest.Captures()
+	if diff := cmp.Diff(n, len(all)); diff != "" {
+		t.Fatalf("unexpected number of captures (-want +got):\n%s", diff)
+	}
+
+	// Modifying a capture must not affect later calls.
+	all[0].Device.Name = "modified"
+	if got := wgctrltest.Captures()[0].Device.Name; got == "modified" {
+		t.Fatal("modifying a capture affected a later call to Captures")
+	}
+}
@@ -0,0 +1,254 @@
+// Package wgctrltest provides an in-memory WireGuard implementation for
+// testing code which uses package wgctrl, without root privileges or real
+// devices.
+package wgctrltest
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/danpashin/wgctrl"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// An Op is an operation performed by the in-memory implementation of a
+// Client, which may be failed using SetError.
+type Op string
+
+// Possible Op values.
+const (
+	OpDevices         Op = "Devices"
+	OpDevice          Op = "Device"
+	OpConfigureDevice Op = "ConfigureDevice"
+)
+
+// A Client is a *wgctrl.Client whose only WireGuard implementation keeps its
+// devices in memory. Every method of wgctrl.Client is available, and devices
+// are configured as a WireGuard implementation would configure them.
+//
+// Devices only exist once added using AddDevice. The methods of Client which
+// simulate the system are safe for concurrent use.
+type Client struct {
+	*wgctrl.Client
+	b *backend
+}
+
+// New creates a Client with no devices, configured using opts. Any
+// wgctrl.WithBackends option is ignored.
+func New(opts ...wgctrl.Option) *Client {
+	b := &backend{}
+
+	c, err := wgctrl.New(wgtypes.NativeClient, append(opts, wgctrl.WithBackends(b))...)
+	if err != nil {
+		// New does not look for the system's implementations when backends
+		// are specified, so it can't fail.
+		panic(fmt.Sprintf("wgctrltest: failed to create client: %v", err))
+	}
+
+	return &Client{Client: c, b: b}
+}
+
+// AddDevice adds a copy of d, replacing any device with the same name. If d
+// has a private key but no public key, the public key is derived from it.
+func (c *Client) AddDevice(d *wgtypes.Device) {
+	d = cloneDevice(d)
+	if d.PublicKey == (wgtypes.Key{}) && d.PrivateKey != (wgtypes.Key{}) {
+		d.PublicKey = d.PrivateKey.PublicKey()
+	}
+
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+
+	for i, dd := range c.b.devices {
+		if dd.Name == d.Name {
+			c.b.devices[i] = d
+			return
+		}
+	}
+
+	c.b.devices = append(c.b.devices, d)
+}
+
+// RemoveDevice removes the device specified by name, if it exists.
+func (c *Client) RemoveDevice(name string) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+
+	for i, d := range c.b.devices {
+		if d.Name == name {
+			c.b.devices = append(c.b.devices[:i], c.b.devices[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetError sets a function which is called before each operation of the
+// in-memory implementation, with the name of the device, or an empty name for
+// OpDevices. If fn returns an error, the operation fails with that error and
+// no device is modified. A nil fn clears any previous function. fn must not
+// call the methods of c.
+func (c *Client) SetError(fn func(op Op, name string) error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+
+	c.b.errFn = fn
+}
+
+// SetHandshake sets the last handshake time of the peer identified by key on
+// the device specified by name, simulating a completed handshake.
+//
+// If the device or peer does not exist, an error is returned which can be
+// checked using `errors.Is(err, os.ErrNotExist)`.
+func (c *Client) SetHandshake(name string, key wgtypes.Key, t time.Time) error {
+	return c.b.updatePeer(name, key, func(p *wgtypes.Peer) {
+		p.LastHandshakeTime = t
+	})
+}
+
+// AddTraffic adds rx bytes received from and tx bytes transmitted to the peer
+// identified by key on the device specified by name, simulating traffic.
+//
+// If the device or peer does not exist, an error is returned which can be
+// checked using `errors.Is(err, os.ErrNotExist)`.
+func (c *Client) AddTraffic(name string, key wgtypes.Key, rx, tx int64) error {
+	return c.b.updatePeer(name, key, func(p *wgtypes.Peer) {
+		p.ReceiveBytes += rx
+		p.TransmitBytes += tx
+	})
+}
+
+var _ wgctrl.Backend = &backend{}
+
+// A backend is an in-memory wgctrl.Backend.
+type backend struct {
+	mu      sync.Mutex
+	devices []*wgtypes.Device
+	errFn   func(op Op, name string) error
+}
+
+// Close implements wgctrl.Backend.
+func (b *backend) Close() error { return nil }
+
+// Devices implements wgctrl.Backend.
+func (b *backend) Devices() ([]*wgtypes.Device, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.err(OpDevices, ""); err != nil {
+		return nil, err
+	}
+
+	ds := make([]*wgtypes.Device, 0, len(b.devices))
+	for _, d := range b.devices {
+		ds = append(ds, cloneDevice(d))
+	}
+
+	return ds, nil
+}
+
+// Device implements wgctrl.Backend.
+func (b *backend) Device(name string) (*wgtypes.Device, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.err(OpDevice, name); err != nil {
+		return nil, err
+	}
+
+	i, ok := b.find(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return cloneDevice(b.devices[i]), nil
+}
+
+// ConfigureDevice implements wgctrl.Backend.
+func (b *backend) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.err(OpConfigureDevice, name); err != nil {
+		return err
+	}
+
+	i, ok := b.find(name)
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	b.devices[i] = cloneDevice(wgtypes.Preview(b.devices[i], cfg))
+	return nil
+}
+
+// updatePeer calls fn with the peer identified by key on the device specified
+// by name.
+func (b *backend) updatePeer(name string, key wgtypes.Key, fn func(p *wgtypes.Peer)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i, ok := b.find(name)
+	if !ok {
+		return fmt.Errorf("wgctrltest: device %q: %w", name, os.ErrNotExist)
+	}
+
+	d := b.devices[i]
+	for j := range d.Peers {
+		if d.Peers[j].PublicKey == key {
+			fn(&d.Peers[j])
+			return nil
+		}
+	}
+
+	return fmt.Errorf("wgctrltest: peer %s on device %q: %w", key, name, os.ErrNotExist)
+}
+
+// find returns the index of the device specified by name. b.mu must be held.
+func (b *backend) find(name string) (int, bool) {
+	for i, d := range b.devices {
+		if d.Name == name {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// err calls the error function for op, if any. b.mu must be held.
+func (b *backend) err(op Op, name string) error {
+	if b.errFn == nil {
+		return nil
+	}
+
+	return b.errFn(op, name)
+}
+
+// cloneDevice returns a deep copy of d, so that stored devices can't be
+// modified by callers.
+func cloneDevice(d *wgtypes.Device) *wgtypes.Device {
+	out := *d
+	out.Peers = make([]wgtypes.Peer, len(d.Peers))
+	for i, p := range d.Peers {
+		if p.Endpoint != nil {
+			ep := *p.Endpoint
+			ep.IP = append(net.IP(nil), p.Endpoint.IP...)
+			p.Endpoint = &ep
+		}
+
+		ips := make([]net.IPNet, 0, len(p.AllowedIPs))
+		for _, ip := range p.AllowedIPs {
+			ips = append(ips, net.IPNet{
+				IP:   append(net.IP(nil), ip.IP...),
+				Mask: append(net.IPMask(nil), ip.Mask...),
+			})
+		}
+		p.AllowedIPs = ips
+
+		out.Peers[i] = p
+	}
+
+	return &out
+}
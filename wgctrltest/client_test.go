@@ -0,0 +1,142 @@
+package wgctrltest_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgctrltest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClient(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		pub  = wgtest.MustPublicKey()
+		ip   = wgtest.MustCIDR("10.0.0.2/32")
+		now  = time.Unix(1000, 0)
+	)
+
+	c := wgctrltest.New()
+	defer c.Close()
+
+	devices, err := c.Devices()
+	if err != nil {
+		t.Fatalf("failed to get devices: %v", err)
+	}
+	if len(devices) != 0 {
+		t.Fatalf("expected no devices, but got: %v", devices)
+	}
+
+	if _, err := c.Device("wg0"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist, but got: %v", err)
+	}
+
+	c.AddDevice(&wgtypes.Device{
+		Name:       "wg0",
+		Type:       wgtypes.Userspace,
+		PrivateKey: priv,
+	})
+
+	if err := c.AddPeer("wg0", wgtypes.PeerConfig{
+		PublicKey:  pub,
+		AllowedIPs: []net.IPNet{ip},
+	}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+
+	if err := c.SetHandshake("wg0", pub, now); err != nil {
+		t.Fatalf("failed to set handshake: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.AddTraffic("wg0", pub, 100, 200); err != nil {
+			t.Fatalf("failed to add traffic: %v", err)
+		}
+	}
+
+	want := &wgtypes.Device{
+		Name:       "wg0",
+		Type:       wgtypes.Userspace,
+		PrivateKey: priv,
+		PublicKey:  priv.PublicKey(),
+		Peers: []wgtypes.Peer{{
+			PublicKey:         pub,
+			LastHandshakeTime: now,
+			ReceiveBytes:      200,
+			TransmitBytes:     400,
+			AllowedIPs:        []net.IPNet{ip},
+		}},
+	}
+
+	d, err := c.Device("wg0")
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+
+	if diff := cmp.Diff(want, d); diff != "" {
+		t.Fatalf("unexpected device (-want +got):\n%s", diff)
+	}
+
+	// Modifying the returned device must not modify the stored device.
+	d.Peers[0].AllowedIPs[0].IP[0] = 192
+	if d, _ := c.Device("wg0"); !d.Peers[0].AllowedIPs[0].IP.Equal(ip.IP) {
+		t.Fatal("modifying a returned device modified the stored device")
+	}
+
+	if err := c.RemovePeer("wg0", pub); err != nil {
+		t.Fatalf("failed to remove peer: %v", err)
+	}
+	if d, _ := c.Device("wg0"); len(d.Peers) != 0 {
+		t.Fatalf("expected no peers, but got: %v", d.Peers)
+	}
+
+	if err := c.AddTraffic("wg0", pub, 1, 1); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist for a removed peer, but got: %v", err)
+	}
+
+	c.RemoveDevice("wg0")
+	if _, err := c.Device("wg0"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist for a removed device, but got: %v", err)
+	}
+}
+
+func TestClientSetError(t *testing.T) {
+	errFoo := errors.New("some error")
+
+	c := wgctrltest.New()
+	defer c.Close()
+
+	c.AddDevice(&wgtypes.Device{Name: "wg0"})
+	c.AddDevice(&wgtypes.Device{Name: "wg1"})
+
+	c.SetError(func(op wgctrltest.Op, name string) error {
+		if op == wgctrltest.OpConfigureDevice && name == "wg1" {
+			return errFoo
+		}
+
+		return nil
+	})
+
+	port := 51820
+	cfg := wgtypes.Config{ListenPort: &port}
+
+	if err := c.ConfigureDevice("wg0", cfg); err != nil {
+		t.Fatalf("failed to configure wg0: %v", err)
+	}
+	if err := c.ConfigureDevice("wg1", cfg); !errors.Is(err, errFoo) {
+		t.Fatalf("expected error for wg1, but got: %v", err)
+	}
+
+	if d, _ := c.Device("wg1"); d.ListenPort != 0 {
+		t.Fatalf("failed operation modified device: %v", d)
+	}
+
+	c.SetError(nil)
+	if err := c.ConfigureDevice("wg1", cfg); err != nil {
+		t.Fatalf("failed to configure wg1 after clearing error: %v", err)
+	}
+}
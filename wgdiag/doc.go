@@ -0,0 +1,5 @@
+// Package wgdiag provides diagnostics for WireGuard devices and peers.
+//
+// The checks in this package operate on the wgtypes values returned by package
+// wgctrl, and only consult the operating system where noted.
+package wgdiag
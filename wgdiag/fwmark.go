@@ -0,0 +1,65 @@
+package wgdiag
+
+import (
+	"fmt"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// CauseFirewallMarkIgnored is returned by CheckFirewallMark when a device's
+// sockets do not carry its configured firewall mark.
+const CauseFirewallMarkIgnored = "firewall-mark-ignored"
+
+// A socketMark is the firewall mark of a UDP socket bound to a device's
+// listening port.
+type socketMark struct {
+	IPv6 bool
+	Mark uint32
+}
+
+// CheckFirewallMark verifies that the UDP sockets bound to the listening port
+// of userspace device d carry the device's configured FirewallMark, and
+// returns a Cause for each socket which does not. A userspace implementation
+// which ignores the firewall mark can cause its encrypted packets to be
+// routed back into the tunnel.
+//
+// Kernel implementations apply the firewall mark to each packet rather than
+// to their sockets, so no checks are performed for devices other than
+// wgtypes.Userspace. CheckFirewallMark is only supported on Linux, and
+// requires CAP_NET_ADMIN to read socket marks.
+func CheckFirewallMark(d *wgtypes.Device) ([]Cause, error) {
+	if d.Type != wgtypes.Userspace || d.ListenPort == 0 {
+		return nil, nil
+	}
+
+	marks, err := udpSocketMarks(d.ListenPort)
+	if err != nil {
+		return nil, fmt.Errorf("wgdiag: failed to read socket marks: %w", err)
+	}
+
+	return firewallMarkCauses(d, marks), nil
+}
+
+// firewallMarkCauses compares marks against the firewall mark of d.
+func firewallMarkCauses(d *wgtypes.Device, marks []socketMark) []Cause {
+	var cs []Cause
+	for _, m := range marks {
+		if m.Mark == uint32(d.FirewallMark) {
+			continue
+		}
+
+		family := "IPv4"
+		if m.IPv6 {
+			family = "IPv6"
+		}
+
+		cs = append(cs, Cause{
+			Code:  CauseFirewallMarkIgnored,
+			Score: 85,
+			Detail: fmt.Sprintf("%s socket on UDP port %d of device %q has firewall mark %#x, but %#x is configured",
+				family, d.ListenPort, d.Name, m.Mark, d.FirewallMark),
+		})
+	}
+
+	return cs
+}
@@ -0,0 +1,118 @@
+//go:build linux
+// +build linux
+
+package wgdiag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+// sock_diag constants which are not exposed by package unix.
+const (
+	sockDiagByFamily = 20
+	inetDiagSKV6Only = 11
+	inetDiagMark     = 15
+
+	// Sizes of struct inet_diag_req_v2 and struct inet_diag_msg.
+	sizeofInetDiagReqV2 = 56
+	sizeofInetDiagMsg   = 72
+)
+
+// udpSocketMarks uses sock_diag to retrieve the firewall marks of all UDP
+// sockets bound to port.
+func udpSocketMarks(port int) ([]socketMark, error) {
+	msgs, err := dumpUDPSockets()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSocketMarks(msgs, port)
+}
+
+// dumpUDPSockets uses sock_diag to retrieve an inet_diag_msg for every IPv4
+// and IPv6 UDP socket.
+func dumpUDPSockets() ([]netlink.Message, error) {
+	c, err := netlink.Dial(unix.NETLINK_SOCK_DIAG, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var out []netlink.Message
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		req := make([]byte, sizeofInetDiagReqV2)
+		req[0] = family
+		req[1] = unix.IPPROTO_UDP
+		// Match sockets in any state.
+		nlenc.PutUint32(req[4:8], ^uint32(0))
+
+		msgs, err := c.Execute(netlink.Message{
+			Header: netlink.Header{
+				Type:  sockDiagByFamily,
+				Flags: netlink.Request | netlink.Dump,
+			},
+			Data: req,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, msgs...)
+	}
+
+	return out, nil
+}
+
+// parseSocketMarks parses the marks of sockets bound to port from sock_diag
+// inet_diag_msg responses.
+func parseSocketMarks(msgs []netlink.Message, port int) ([]socketMark, error) {
+	var marks []socketMark
+	for _, m := range msgs {
+		if len(m.Data) < sizeofInetDiagMsg {
+			return nil, fmt.Errorf("short inet_diag_msg: %d bytes", len(m.Data))
+		}
+
+		// The source port in struct inet_diag_sockid is big endian.
+		if int(binary.BigEndian.Uint16(m.Data[4:6])) != port {
+			continue
+		}
+
+		ad, err := netlink.NewAttributeDecoder(m.Data[sizeofInetDiagMsg:])
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			mark  uint32
+			found bool
+		)
+		for ad.Next() {
+			if ad.Type() == inetDiagMark {
+				mark = ad.Uint32()
+				found = true
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+
+		// The kernel only reports socket marks to callers with
+		// CAP_NET_ADMIN.
+		if !found {
+			return nil, os.ErrPermission
+		}
+
+		marks = append(marks, socketMark{
+			IPv6: m.Data[0] == unix.AF_INET6,
+			Mark: mark,
+		})
+	}
+
+	return marks, nil
+}
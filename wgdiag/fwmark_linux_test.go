@@ -0,0 +1,88 @@
+//go:build linux
+// +build linux
+
+package wgdiag
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestLinuxParseSocketMarks(t *testing.T) {
+	tests := []struct {
+		name  string
+		msgs  []netlink.Message
+		marks []socketMark
+		err   error
+	}{
+		{
+			name: "OK",
+			msgs: []netlink.Message{
+				diagMessage(unix.AF_INET, 51820, true, 1),
+				diagMessage(unix.AF_INET6, 51820, true, 2),
+				diagMessage(unix.AF_INET, 53, true, 3),
+			},
+			marks: []socketMark{
+				{Mark: 1},
+				{IPv6: true, Mark: 2},
+			},
+		},
+		{
+			name: "no mark",
+			msgs: []netlink.Message{diagMessage(unix.AF_INET, 51820, false, 0)},
+			err:  os.ErrPermission,
+		},
+		{
+			name: "short",
+			msgs: []netlink.Message{{Data: make([]byte, 4)}},
+			err:  errors.New("short"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marks, err := parseSocketMarks(tt.msgs, 51820)
+			if tt.err != nil {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				if errors.Is(tt.err, os.ErrPermission) && !errors.Is(err, os.ErrPermission) {
+					t.Fatalf("expected permission denied, but got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.marks, marks); diff != "" {
+				t.Fatalf("unexpected marks (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// diagMessage builds a sock_diag inet_diag_msg for a socket bound to port.
+func diagMessage(family uint8, port uint16, hasMark bool, mark uint32) netlink.Message {
+	b := make([]byte, sizeofInetDiagMsg)
+	b[0] = family
+	binary.BigEndian.PutUint16(b[4:6], port)
+
+	if hasMark {
+		ae := netlink.NewAttributeEncoder()
+		ae.Uint32(inetDiagMark, mark)
+		attrs, err := ae.Encode()
+		if err != nil {
+			panic(err)
+		}
+		b = append(b, attrs...)
+	}
+
+	return netlink.Message{Data: b}
+}
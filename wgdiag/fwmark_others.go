@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package wgdiag
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// udpSocketMarks reports that socket marks cannot be read.
+func udpSocketMarks(_ int) ([]socketMark, error) {
+	return nil, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,66 @@
+package wgdiag
+
+import (
+	"testing"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckFirewallMarkKernel(t *testing.T) {
+	// Kernel devices are never checked, so this must not touch the system.
+	cs, err := CheckFirewallMark(&wgtypes.Device{
+		Type:         wgtypes.LinuxKernel,
+		ListenPort:   51820,
+		FirewallMark: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to check firewall mark: %v", err)
+	}
+	if len(cs) > 0 {
+		t.Fatalf("expected no causes, but got: %v", cs)
+	}
+}
+
+func TestFirewallMarkCauses(t *testing.T) {
+	d := &wgtypes.Device{
+		Name:         "wg0",
+		Type:         wgtypes.Userspace,
+		ListenPort:   51820,
+		FirewallMark: 0xca6c,
+	}
+
+	tests := []struct {
+		name  string
+		marks []socketMark
+		want  []Cause
+	}{
+		{
+			name: "OK",
+			marks: []socketMark{
+				{Mark: 0xca6c},
+				{IPv6: true, Mark: 0xca6c},
+			},
+		},
+		{
+			name: "ignored",
+			marks: []socketMark{
+				{Mark: 0xca6c},
+				{IPv6: true},
+			},
+			want: []Cause{{
+				Code:   CauseFirewallMarkIgnored,
+				Score:  85,
+				Detail: `IPv6 socket on UDP port 51820 of device "wg0" has firewall mark 0x0, but 0xca6c is configured`,
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, firewallMarkCauses(d, tt.marks)); diff != "" {
+				t.Fatalf("unexpected causes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package wgdiag
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// rejectAfterTime is the WireGuard protocol constant after which a session
+// is no longer usable and a new handshake is required.
+const rejectAfterTime = 180 * time.Second
+
+// Sizes of the WireGuard handshake messages, which AmneziaWG pads with S1, S2,
+// and S3 bytes respectively.
+const (
+	initiationSize  = 148
+	responseSize    = 92
+	cookieReplySize = 64
+)
+
+// Possible Cause codes.
+const (
+	CauseNoPrivateKey        = "no-private-key"
+	CauseNoListenPort        = "no-listen-port"
+	CauseListenPortClosed    = "listen-port-closed"
+	CausePeerNotFound        = "peer-not-found"
+	CauseNoEndpoint          = "no-endpoint"
+	CauseInvalidEndpoint     = "invalid-endpoint"
+	CauseNoAllowedIPs        = "no-allowed-ips"
+	CauseNoResponse          = "no-response"
+	CauseNeverHandshaked     = "never-handshaked"
+	CauseStaleHandshake      = "stale-handshake"
+	CauseNoKeepalive         = "no-keepalive"
+	CauseAmneziaJunkSize     = "amnezia-junk-size"
+	CauseAmneziaPaddingClash = "amnezia-padding-clash"
+	CauseAmneziaHeaders      = "amnezia-headers"
+	CauseAmneziaMismatch     = "amnezia-mismatch"
+	CauseRoutingLoop         = "routing-loop"
+)
+
+// A Cause is a likely reason why a peer is failing to complete handshakes.
+type Cause struct {
+	// Code is a short, stable identifier for this Cause.
+	Code string
+
+	// Score ranks the likelihood of this Cause from 0 to 100, where higher
+	// values are more likely to be responsible for the failure.
+	Score int
+
+	// Detail is a human-readable explanation of the evidence gathered.
+	Detail string
+}
+
+// String returns a human-readable representation of a Cause.
+func (c Cause) String() string {
+	return fmt.Sprintf("%s (%d): %s", c.Code, c.Score, c.Detail)
+}
+
+// Diagnose gathers evidence about the handshake state of the peer identified
+// by peer on device d, and returns a list of likely causes of handshake
+// failures ordered from most to least likely.
+//
+// Diagnose probes the local system to determine if the device's listening
+// port is open. An empty list indicates that no problems were detected.
+func Diagnose(d *wgtypes.Device, peer wgtypes.Key) []Cause {
+	return diagnose(d, peer, systemEnv)
+}
+
+// An env contains the hooks used by diagnose to interact with the system,
+// which can be swapped out during tests.
+type env struct {
+	now            func() time.Time
+	listenPortOpen func(port int) bool
+}
+
+// systemEnv is the env used outside of tests.
+var systemEnv = env{
+	now:            time.Now,
+	listenPortOpen: listenPortOpen,
+}
+
+// diagnose implements Diagnose using the hooks in e.
+func diagnose(d *wgtypes.Device, peer wgtypes.Key, e env) []Cause {
+	var cs []Cause
+	add := func(code string, score int, format string, v ...interface{}) {
+		cs = append(cs, Cause{
+			Code:   code,
+			Score:  score,
+			Detail: fmt.Sprintf(format, v...),
+		})
+	}
+
+	if d.PrivateKey == (wgtypes.Key{}) {
+		add(CauseNoPrivateKey, 100, "device %q has no private key configured", d.Name)
+	}
+
+	switch {
+	case d.ListenPort == 0:
+		add(CauseNoListenPort, 90, "device %q is not listening on any port", d.Name)
+	case !e.listenPortOpen(d.ListenPort):
+		add(CauseListenPortClosed, 90, "no socket is bound to UDP port %d of device %q", d.ListenPort, d.Name)
+	}
+
+	amneziaCauses(d.AdvancedSecurity, add)
+
+	p, ok := findPeer(d, peer)
+	if !ok {
+		add(CausePeerNotFound, 100, "peer %s is not configured on device %q", peer, d.Name)
+		return sortCauses(cs)
+	}
+
+	switch {
+	case p.Endpoint == nil:
+		add(CauseNoEndpoint, 60, "peer has no endpoint, so only the peer can initiate a handshake")
+	case p.Endpoint.IP.IsUnspecified() || p.Endpoint.Port == 0:
+		add(CauseInvalidEndpoint, 95, "peer endpoint %s is not a usable address", p.Endpoint)
+	default:
+		if via, n, ok := routingLoop(d, p); ok {
+			cs = append(cs, loopCause(d, p, via, n))
+		}
+	}
+
+	if len(p.AllowedIPs) == 0 {
+		add(CauseNoAllowedIPs, 70, "peer has no allowed IPs, so no traffic will trigger a handshake")
+	}
+
+	if p.LastHandshakeTime.IsZero() {
+		add(CauseNeverHandshaked, 50, "no handshake has ever completed with this peer")
+	} else if age := e.now().Sub(p.LastHandshakeTime); age > rejectAfterTime {
+		add(CauseStaleHandshake, 40, "last handshake completed %s ago", age.Round(time.Second))
+	} else {
+		// A recent handshake means the remaining heuristics don't apply.
+		return sortCauses(cs)
+	}
+
+	if p.TransmitBytes > 0 && p.ReceiveBytes == 0 {
+		add(CauseNoResponse, 80, "%d bytes were sent to the peer but none were received", p.TransmitBytes)
+
+		if d.AdvancedSecurity.IsEnabled() {
+			add(CauseAmneziaMismatch, 75, "AmneziaWG obfuscation is enabled; S1, S2, and H1-H4 must match on both peers")
+		}
+	}
+
+	if p.PersistentKeepaliveInterval == 0 && p.Endpoint != nil {
+		add(CauseNoKeepalive, 20, "persistent keepalive is disabled, so NAT mappings may expire")
+	}
+
+	return sortCauses(cs)
+}
+
+// amneziaCauses checks AmneziaWG parameters for values which prevent
+// handshakes from completing, and reports them using add.
+func amneziaCauses(as wgtypes.AdvancedSecurity, add func(code string, score int, format string, v ...interface{})) {
+	if !as.IsEnabled() {
+		return
+	}
+
+	if as.JunkPacketMinSize > as.JunkPacketMaxSize {
+		add(CauseAmneziaJunkSize, 60, "Jmin (%d) is larger than Jmax (%d)", as.JunkPacketMinSize, as.JunkPacketMaxSize)
+	}
+
+	if int(as.InitPacketJunkSize)+initiationSize == int(as.ResponsePacketJunkSize)+responseSize {
+		add(CauseAmneziaPaddingClash, 85, "S1 (%d) and S2 (%d) make handshake initiations and responses the same size",
+			as.InitPacketJunkSize, as.ResponsePacketJunkSize)
+	}
+
+	hs := []uint32{
+		as.InitPacketMagicHeader,
+		as.ResponsePacketMagicHeader,
+		as.UnderloadPacketMagicHeader,
+		as.TransportPacketMagicHeader,
+	}
+
+	seen := make(map[uint32]bool, len(hs))
+	for _, h := range hs {
+		if seen[h] {
+			add(CauseAmneziaHeaders, 85, "magic headers H1-H4 are not unique: %v", hs)
+			break
+		}
+
+		seen[h] = true
+	}
+}
+
+// findPeer returns the peer identified by key on device d.
+func findPeer(d *wgtypes.Device, key wgtypes.Key) (wgtypes.Peer, bool) {
+	for _, p := range d.Peers {
+		if p.PublicKey == key {
+			return p, true
+		}
+	}
+
+	return wgtypes.Peer{}, false
+}
+
+// sortCauses orders cs from most to least likely.
+func sortCauses(cs []Cause) []Cause {
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].Score > cs[j].Score
+	})
+
+	return cs
+}
+
+// listenPortOpen reports whether a UDP socket is bound to port by attempting
+// to bind it. If the result cannot be determined, the port is assumed open.
+func listenPortOpen(port int) bool {
+	c, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err == nil {
+		// We could bind the port, so nothing else is bound to it.
+		_ = c.Close()
+		return false
+	}
+
+	// Most likely "address in use", but errors such as permission denied say
+	// nothing about the device, so give it the benefit of the doubt.
+	return true
+}
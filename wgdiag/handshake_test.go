@@ -0,0 +1,151 @@
+package wgdiag
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestDiagnose(t *testing.T) {
+	var (
+		now  = time.Unix(1000000, 0)
+		priv = wgtest.MustPrivateKey()
+		peer = wgtest.MustPublicKey()
+	)
+
+	okPeer := func() wgtypes.Peer {
+		return wgtypes.Peer{
+			PublicKey:                   peer,
+			Endpoint:                    wgtest.MustUDPAddr("192.0.2.1:51820"),
+			PersistentKeepaliveInterval: 25 * time.Second,
+			LastHandshakeTime:           now.Add(-time.Minute),
+			ReceiveBytes:                1,
+			TransmitBytes:               1,
+			AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		d      func(d *wgtypes.Device)
+		closed bool
+		codes  []string
+	}{
+		{
+			name: "OK",
+		},
+		{
+			name: "no peer",
+			d: func(d *wgtypes.Device) {
+				d.Peers = nil
+			},
+			codes: []string{CausePeerNotFound},
+		},
+		{
+			name:   "listen port closed",
+			closed: true,
+			codes:  []string{CauseListenPortClosed},
+		},
+		{
+			name: "no private key",
+			d: func(d *wgtypes.Device) {
+				d.PrivateKey = wgtypes.Key{}
+				d.ListenPort = 0
+			},
+			codes: []string{CauseNoPrivateKey, CauseNoListenPort},
+		},
+		{
+			name: "routing loop",
+			d: func(d *wgtypes.Device) {
+				d.Peers[0].AllowedIPs = []net.IPNet{wgtest.MustCIDR("0.0.0.0/0")}
+			},
+			codes: []string{CauseRoutingLoop},
+		},
+		{
+			name: "never handshaked without response",
+			d: func(d *wgtypes.Device) {
+				d.Peers[0].LastHandshakeTime = time.Time{}
+				d.Peers[0].ReceiveBytes = 0
+				d.Peers[0].PersistentKeepaliveInterval = 0
+				d.Peers[0].AllowedIPs = nil
+			},
+			codes: []string{
+				CauseNoResponse,
+				CauseNoAllowedIPs,
+				CauseNeverHandshaked,
+				CauseNoKeepalive,
+			},
+		},
+		{
+			name: "stale handshake without endpoint",
+			d: func(d *wgtypes.Device) {
+				d.Peers[0].LastHandshakeTime = now.Add(-time.Hour)
+				d.Peers[0].Endpoint = nil
+			},
+			codes: []string{CauseNoEndpoint, CauseStaleHandshake},
+		},
+		{
+			name: "invalid endpoint",
+			d: func(d *wgtypes.Device) {
+				d.Peers[0].Endpoint = wgtest.MustUDPAddr("0.0.0.0:51820")
+			},
+			codes: []string{CauseInvalidEndpoint},
+		},
+		{
+			name: "amnezia",
+			d: func(d *wgtypes.Device) {
+				d.AdvancedSecurity = wgtypes.AdvancedSecurity{
+					JunkPacketMinSize:      100,
+					JunkPacketMaxSize:      50,
+					InitPacketJunkSize:     0,
+					ResponsePacketJunkSize: 56,
+					InitPacketMagicHeader:  1,
+				}
+
+				d.Peers[0].LastHandshakeTime = time.Time{}
+				d.Peers[0].ReceiveBytes = 0
+			},
+			codes: []string{
+				CauseAmneziaPaddingClash,
+				CauseAmneziaHeaders,
+				CauseNoResponse,
+				CauseAmneziaMismatch,
+				CauseAmneziaJunkSize,
+				CauseNeverHandshaked,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &wgtypes.Device{
+				Name:       "wg0",
+				PrivateKey: priv,
+				ListenPort: 51820,
+				Peers:      []wgtypes.Peer{okPeer()},
+			}
+			if tt.d != nil {
+				tt.d(d)
+			}
+
+			cs := diagnose(d, peer, env{
+				now:            func() time.Time { return now },
+				listenPortOpen: func(_ int) bool { return !tt.closed },
+			})
+
+			codes := make([]string, 0, len(cs))
+			for _, c := range cs {
+				codes = append(codes, c.Code)
+			}
+
+			if diff := cmp.Diff(tt.codes, codes, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatalf("unexpected causes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
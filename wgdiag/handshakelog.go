@@ -0,0 +1,296 @@
+package wgdiag
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// Possible Cause codes reported by AuditHandshakes.
+const (
+	CauseInitiationsIgnored = "initiations-ignored"
+	CauseInvalidHandshakes  = "invalid-handshakes"
+	CauseHandshakeGaveUp    = "handshake-gave-up"
+)
+
+// A HandshakeEventKind is the kind of a HandshakeEvent.
+type HandshakeEventKind int
+
+// Possible HandshakeEventKind values.
+const (
+	_ HandshakeEventKind = iota
+	InitiationSent
+	InitiationReceived
+	ResponseSent
+	ResponseReceived
+	InvalidInitiation
+	InvalidResponse
+	HandshakeRetried
+	HandshakeGaveUp
+)
+
+// String returns the string representation of a HandshakeEventKind.
+func (k HandshakeEventKind) String() string {
+	switch k {
+	case InitiationSent:
+		return "initiation sent"
+	case InitiationReceived:
+		return "initiation received"
+	case ResponseSent:
+		return "response sent"
+	case ResponseReceived:
+		return "response received"
+	case InvalidInitiation:
+		return "invalid initiation"
+	case InvalidResponse:
+		return "invalid response"
+	case HandshakeRetried:
+		return "handshake retried"
+	case HandshakeGaveUp:
+		return "handshake gave up"
+	default:
+		return "unknown"
+	}
+}
+
+// A HandshakeEvent is a handshake message logged by a WireGuard
+// implementation.
+type HandshakeEvent struct {
+	Kind HandshakeEventKind
+
+	// Device is the name of the device which logged the event, or empty if
+	// the log does not include it.
+	Device string
+
+	// PeerID is the Linux kernel's internal identifier for the peer, or 0 if
+	// the log does not include it.
+	PeerID int
+
+	// Endpoint is the peer's address, if the log includes it. Invalid
+	// handshake messages can only be attributed to a peer by address.
+	Endpoint string
+
+	// KeyPrefix and KeySuffix are the leading and trailing characters of the
+	// peer's base64-encoded public key, as logged by wireguard-go.
+	KeyPrefix, KeySuffix string
+}
+
+// Patterns for Linux kernel messages, which are only logged when dynamic
+// debugging is enabled for the wireguard module.
+var (
+	kernelLine = regexp.MustCompile(`wireguard: (\S+): (.+)$`)
+
+	kernelEvents = []struct {
+		kind HandshakeEventKind
+		re   *regexp.Regexp
+	}{
+		{InitiationSent, regexp.MustCompile(`^Sending handshake initiation to peer (\d+) \((.+)\)$`)},
+		{InitiationReceived, regexp.MustCompile(`^Receiving handshake initiation from peer (\d+) \((.+)\)$`)},
+		{ResponseSent, regexp.MustCompile(`^Sending handshake response to peer (\d+) \((.+)\)$`)},
+		{ResponseReceived, regexp.MustCompile(`^Receiving handshake response from peer (\d+) \((.+)\)$`)},
+		{InvalidInitiation, regexp.MustCompile(`^()Invalid handshake initiation from (.+)$`)},
+		{InvalidResponse, regexp.MustCompile(`^()Invalid handshake response from (.+)$`)},
+		{HandshakeRetried, regexp.MustCompile(`^Handshake for peer (\d+) \((.+)\) did not complete after \d+ seconds, retrying`)},
+		{HandshakeGaveUp, regexp.MustCompile(`^Handshake for peer (\d+) \((.+)\) did not complete after \d+ attempts, giving up$`)},
+	}
+)
+
+// Patterns for wireguard-go messages, logged at its verbose log level.
+var (
+	userspaceLine = regexp.MustCompile(`peer\(([^…)]*)…([^…)]*)\) - (.+)$`)
+
+	userspaceEvents = map[string]HandshakeEventKind{
+		"Sending handshake initiation":  InitiationSent,
+		"Received handshake initiation": InitiationReceived,
+		"Sending handshake response":    ResponseSent,
+		"Received handshake response":   ResponseReceived,
+	}
+)
+
+// ParseHandshakeLog parses handshake events from the lines of a log read from
+// r, ignoring any other lines. Both Linux kernel messages, as printed by
+// dmesg or journalctl -k with dynamic debugging enabled for the wireguard
+// module, and wireguard-go verbose log messages are recognized.
+func ParseHandshakeLog(r io.Reader) ([]HandshakeEvent, error) {
+	var events []HandshakeEvent
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if e, ok := parseHandshakeLine(s.Text()); ok {
+			events = append(events, e)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("wgdiag: failed to read log: %w", err)
+	}
+
+	return events, nil
+}
+
+// parseHandshakeLine parses a single log line.
+func parseHandshakeLine(line string) (HandshakeEvent, bool) {
+	if m := kernelLine.FindStringSubmatch(line); m != nil {
+		for _, ke := range kernelEvents {
+			em := ke.re.FindStringSubmatch(m[2])
+			if em == nil {
+				continue
+			}
+
+			// Invalid messages have no peer ID.
+			id, _ := strconv.Atoi(em[1])
+			return HandshakeEvent{
+				Kind:     ke.kind,
+				Device:   m[1],
+				PeerID:   id,
+				Endpoint: em[2],
+			}, true
+		}
+
+		return HandshakeEvent{}, false
+	}
+
+	if m := userspaceLine.FindStringSubmatch(line); m != nil {
+		msg := m[3]
+		kind, ok := userspaceEvents[msg]
+		switch {
+		case ok:
+		case strings.HasPrefix(msg, "Handshake did not complete after"):
+			kind = HandshakeRetried
+		default:
+			return HandshakeEvent{}, false
+		}
+
+		return HandshakeEvent{
+			Kind:      kind,
+			KeyPrefix: m[1],
+			KeySuffix: m[2],
+		}, true
+	}
+
+	return HandshakeEvent{}, false
+}
+
+// A HandshakeAudit summarizes the logged handshake events of a peer.
+type HandshakeAudit struct {
+	PublicKey wgtypes.Key
+
+	// Counts holds the number of events of each kind attributed to the peer.
+	Counts map[HandshakeEventKind]int
+
+	// Causes are likely reasons for handshake failures with the peer,
+	// ordered from most to least likely.
+	Causes []Cause
+}
+
+// AuditHandshakes attributes events to the peers of device d and summarizes
+// them, returning an audit for each peer with at least one event in the
+// order of d.Peers. Events are matched to peers by public key where logged,
+// by endpoint, and by the kernel's peer identifiers once an identifier has
+// been seen alongside a matching endpoint. Events which can't be attributed
+// are ignored.
+func AuditHandshakes(d *wgtypes.Device, events []HandshakeEvent) []HandshakeAudit {
+	var (
+		ids    = make(map[int]int)
+		counts = make(map[int]map[HandshakeEventKind]int)
+	)
+
+	for _, e := range events {
+		if e.Device != "" && e.Device != d.Name {
+			continue
+		}
+
+		i, ok := matchPeer(d, e, ids)
+		if !ok {
+			continue
+		}
+
+		if e.PeerID != 0 {
+			ids[e.PeerID] = i
+		}
+		if counts[i] == nil {
+			counts[i] = make(map[HandshakeEventKind]int)
+		}
+		counts[i][e.Kind]++
+	}
+
+	var audits []HandshakeAudit
+	for i, p := range d.Peers {
+		c, ok := counts[i]
+		if !ok {
+			continue
+		}
+
+		audits = append(audits, HandshakeAudit{
+			PublicKey: p.PublicKey,
+			Counts:    c,
+			Causes:    auditCauses(c),
+		})
+	}
+
+	return audits
+}
+
+// matchPeer returns the index of the peer of d which logged e.
+func matchPeer(d *wgtypes.Device, e HandshakeEvent, ids map[int]int) (int, bool) {
+	if e.KeyPrefix != "" || e.KeySuffix != "" {
+		for i, p := range d.Peers {
+			// wireguard-go omits the trailing padding of the key.
+			k := strings.TrimRight(p.PublicKey.String(), "=")
+			if strings.HasPrefix(k, e.KeyPrefix) && strings.HasSuffix(k, e.KeySuffix) {
+				return i, true
+			}
+		}
+
+		return 0, false
+	}
+
+	if e.Endpoint != "" {
+		if addr, err := net.ResolveUDPAddr("udp", e.Endpoint); err == nil {
+			for i, p := range d.Peers {
+				if p.Endpoint != nil && p.Endpoint.IP.Equal(addr.IP) && p.Endpoint.Port == addr.Port {
+					return i, true
+				}
+			}
+		}
+	}
+
+	if e.PeerID != 0 {
+		i, ok := ids[e.PeerID]
+		return i, ok
+	}
+
+	return 0, false
+}
+
+// auditCauses derives Causes from the event counts of a peer.
+func auditCauses(c map[HandshakeEventKind]int) []Cause {
+	var cs []Cause
+	add := func(code string, score int, format string, v ...interface{}) {
+		cs = append(cs, Cause{
+			Code:   code,
+			Score:  score,
+			Detail: fmt.Sprintf(format, v...),
+		})
+	}
+
+	if n := c[InitiationReceived]; n > 0 && c[ResponseSent] == 0 {
+		add(CauseInitiationsIgnored, 90, "%d handshake initiations were received from the peer but no response was sent", n)
+	}
+	if n := c[InvalidInitiation] + c[InvalidResponse]; n > 0 {
+		add(CauseInvalidHandshakes, 85, "%d invalid handshake messages were received from the peer's endpoint; keys or AmneziaWG parameters may not match", n)
+	}
+	if n := c[HandshakeGaveUp]; n > 0 {
+		add(CauseHandshakeGaveUp, 70, "gave up initiating a handshake with the peer %d times", n)
+	}
+	if c[InitiationSent] > 0 && c[ResponseReceived] == 0 {
+		add(CauseNoResponse, 80, "%d handshake initiations were sent to the peer but no response was received", c[InitiationSent])
+	}
+
+	return sortCauses(cs)
+}
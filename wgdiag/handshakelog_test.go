@@ -0,0 +1,113 @@
+package wgdiag
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseHandshakeLog(t *testing.T) {
+	const log = `[ 1234.5678] wireguard: wg0: Sending handshake initiation to peer 3 (192.0.2.1:51820)
+[ 1234.5679] wireguard: wg0: Receiving handshake initiation from peer 4 ([2001:db8::1]:51820)
+[ 1234.5680] wireguard: wg0: Invalid handshake initiation from 198.51.100.1:1234
+[ 1234.5681] wireguard: wg0: Handshake for peer 3 (192.0.2.1:51820) did not complete after 5 seconds, retrying (try 2)
+[ 1234.5682] wireguard: wg0: Handshake for peer 3 (192.0.2.1:51820) did not complete after 20 attempts, giving up
+[ 1234.5683] wireguard: wg0: Receiving keepalive packet from peer 3 (192.0.2.1:51820)
+[ 1234.5684] eth0: link up
+DEBUG: (wg1) 2024/01/01 00:00:00 peer(AbCd…WxYz) - Received handshake initiation
+DEBUG: (wg1) 2024/01/01 00:00:00 peer(AbCd…WxYz) - Handshake did not complete after 5 seconds, retrying (try 2)
+DEBUG: (wg1) 2024/01/01 00:00:00 peer(AbCd…WxYz) - Sending keepalive packet
+`
+
+	events, err := ParseHandshakeLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("failed to parse log: %v", err)
+	}
+
+	want := []HandshakeEvent{
+		{Kind: InitiationSent, Device: "wg0", PeerID: 3, Endpoint: "192.0.2.1:51820"},
+		{Kind: InitiationReceived, Device: "wg0", PeerID: 4, Endpoint: "[2001:db8::1]:51820"},
+		{Kind: InvalidInitiation, Device: "wg0", Endpoint: "198.51.100.1:1234"},
+		{Kind: HandshakeRetried, Device: "wg0", PeerID: 3, Endpoint: "192.0.2.1:51820"},
+		{Kind: HandshakeGaveUp, Device: "wg0", PeerID: 3, Endpoint: "192.0.2.1:51820"},
+		{Kind: InitiationReceived, KeyPrefix: "AbCd", KeySuffix: "WxYz"},
+		{Kind: HandshakeRetried, KeyPrefix: "AbCd", KeySuffix: "WxYz"},
+	}
+
+	if diff := cmp.Diff(want, events); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+}
+
+func TestAuditHandshakes(t *testing.T) {
+	var (
+		ignoring = wgtest.MustPublicKey()
+		invalid  = wgtest.MustPublicKey()
+		quiet    = wgtest.MustPublicKey()
+		roaming  = wgtest.MustPublicKey()
+	)
+
+	d := &wgtypes.Device{
+		Name: "wg0",
+		Peers: []wgtypes.Peer{
+			{PublicKey: ignoring, Endpoint: wgtest.MustUDPAddr("192.0.2.1:51820")},
+			{PublicKey: invalid, Endpoint: wgtest.MustUDPAddr("[2001:db8::1]:51820")},
+			{PublicKey: quiet},
+			{PublicKey: roaming, Endpoint: wgtest.MustUDPAddr("192.0.2.3:51820")},
+		},
+	}
+
+	key := roaming.String()
+	events := []HandshakeEvent{
+		// Another device is ignored.
+		{Kind: ResponseSent, Device: "wg1", PeerID: 1, Endpoint: "192.0.2.1:51820"},
+		{Kind: InitiationReceived, Device: "wg0", PeerID: 1, Endpoint: "192.0.2.1:51820"},
+		// The endpoint has since changed, so match by peer ID.
+		{Kind: InitiationReceived, Device: "wg0", PeerID: 1, Endpoint: "203.0.113.1:51820"},
+		{Kind: InvalidInitiation, Device: "wg0", Endpoint: "[2001:db8::1]:51820"},
+		// Unattributable.
+		{Kind: InvalidInitiation, Device: "wg0", Endpoint: "198.51.100.1:1234"},
+		{Kind: InitiationSent, KeyPrefix: key[:4], KeySuffix: key[39:43]},
+		{Kind: ResponseReceived, KeyPrefix: key[:4], KeySuffix: key[39:43]},
+	}
+
+	type result struct {
+		PublicKey wgtypes.Key
+		Counts    map[HandshakeEventKind]int
+		Codes     []string
+	}
+
+	var got []result
+	for _, a := range AuditHandshakes(d, events) {
+		r := result{PublicKey: a.PublicKey, Counts: a.Counts}
+		for _, c := range a.Causes {
+			r.Codes = append(r.Codes, c.Code)
+		}
+
+		got = append(got, r)
+	}
+
+	want := []result{
+		{
+			PublicKey: ignoring,
+			Counts:    map[HandshakeEventKind]int{InitiationReceived: 2},
+			Codes:     []string{CauseInitiationsIgnored},
+		},
+		{
+			PublicKey: invalid,
+			Counts:    map[HandshakeEventKind]int{InvalidInitiation: 1},
+			Codes:     []string{CauseInvalidHandshakes},
+		},
+		{
+			PublicKey: roaming,
+			Counts:    map[HandshakeEventKind]int{InitiationSent: 1, ResponseReceived: 1},
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected audits (-want +got):\n%s", diff)
+	}
+}
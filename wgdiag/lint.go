@@ -0,0 +1,298 @@
+package wgdiag
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// defaultPathMTU is the path MTU assumed by Lint when none is specified.
+const defaultPathMTU = 1500
+
+// Possible Finding codes, in addition to the Cause codes CauseNoPrivateKey,
+// CauseInvalidEndpoint, CauseNoAllowedIPs, CauseRoutingLoop,
+// CauseJunkExceedsMTU, and the AmneziaWG Cause codes, which Lint also reports.
+const (
+	FindingInvalidConfig     = "invalid-config"
+	FindingDuplicatePeer     = "duplicate-peer"
+	FindingInvalidPublicKey  = "invalid-public-key"
+	FindingSelfPeer          = "self-peer"
+	FindingAllowedIPConflict = "allowed-ip-conflict"
+	FindingAllowedIPOverlap  = "allowed-ip-overlap"
+)
+
+// A Severity indicates whether a Finding must be fixed.
+type Severity int
+
+// Possible Severity values.
+const (
+	// SeverityWarning indicates a configuration which works, but is likely
+	// to be a mistake.
+	SeverityWarning Severity = iota
+
+	// SeverityError indicates a configuration which can't work as intended.
+	SeverityError
+)
+
+// String returns the name of a Severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// A Finding is a problem found in the configuration of a device by Lint.
+type Finding struct {
+	// Severity indicates whether the problem must be fixed.
+	Severity Severity
+
+	// Code is a short, stable identifier for the problem.
+	Code string
+
+	// Peer is the public key of the peer which has the problem, or nil if it
+	// concerns the device as a whole.
+	Peer *wgtypes.Key
+
+	// Detail is a human-readable explanation of the problem.
+	Detail string
+}
+
+// String returns a human-readable representation of a Finding.
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Code, f.Detail)
+}
+
+// Lint checks the configuration of device d for mistakes, and returns a
+// Finding for each, errors first. An empty list indicates that no problems
+// were found.
+//
+// Unlike Diagnose, Lint ignores runtime state such as handshakes and does not
+// consult the operating system, so it may be used on configurations which are
+// not applied, such as in CI. pathMTU is the MTU of the path to the device's
+// peers, used to check the size of AmneziaWG packets. If zero, 1500 is
+// assumed.
+func Lint(d *wgtypes.Device, pathMTU int) []Finding {
+	if pathMTU == 0 {
+		pathMTU = defaultPathMTU
+	}
+
+	var fs []Finding
+	add := func(sev Severity, code string, peer *wgtypes.Key, format string, v ...interface{}) {
+		fs = append(fs, Finding{
+			Severity: sev,
+			Code:     code,
+			Peer:     peer,
+			Detail:   fmt.Sprintf(format, v...),
+		})
+	}
+
+	if d.PrivateKey == (wgtypes.Key{}) {
+		add(SeverityError, CauseNoPrivateKey, nil, "device %q has no private key configured", d.Name)
+	}
+
+	amneziaCauses(d.AdvancedSecurity, func(code string, _ int, format string, v ...interface{}) {
+		add(SeverityError, code, nil, format, v...)
+	})
+	for _, c := range CheckJunkMTU(d, pathMTU) {
+		add(SeverityWarning, c.Code, nil, "%s", c.Detail)
+	}
+
+	for _, p := range d.Peers {
+		key := p.PublicKey
+
+		switch {
+		case key == (wgtypes.Key{}):
+			add(SeverityError, FindingInvalidPublicKey, &key, "peer has an all-zero public key")
+		case key == d.PublicKey:
+			add(SeverityError, FindingSelfPeer, &key, "peer has the public key of device %q itself", d.Name)
+		}
+
+		switch {
+		case p.Endpoint == nil:
+		case len(p.Endpoint.IP) == 0 || p.Endpoint.IP.IsUnspecified() || p.Endpoint.Port == 0:
+			add(SeverityError, CauseInvalidEndpoint, &key, "peer endpoint %s is not a usable address", p.Endpoint)
+		default:
+			if via, n, ok := routingLoop(d, p); ok {
+				c := loopCause(d, p, via, n)
+				add(SeverityError, c.Code, &key, "%s", c.Detail)
+			}
+		}
+
+		if len(p.AllowedIPs) == 0 {
+			add(SeverityWarning, CauseNoAllowedIPs, &key, "peer has no allowed IPs, so no traffic is routed to it")
+		}
+	}
+
+	fs = append(fs, lintAllowedIPs(d)...)
+
+	sort.SliceStable(fs, func(i, j int) bool {
+		return fs[i].Severity > fs[j].Severity
+	})
+
+	return fs
+}
+
+// LintConfig checks cfg, as it would be applied to a new device named name,
+// for mistakes as with Lint. It also checks for mistakes which applying cfg
+// would hide, such as peers which are listed more than once and allowed IPs
+// assigned to more than one peer, and for values rejected by cfg.Validate.
+func LintConfig(name string, cfg wgtypes.Config, pathMTU int) []Finding {
+	var fs []Finding
+
+	if err := cfg.Validate(); err != nil {
+		f := Finding{
+			Severity: SeverityError,
+			Code:     FindingInvalidConfig,
+			Detail:   err.Error(),
+		}
+
+		var verr *wgtypes.ValidationError
+		if errors.As(err, &verr) {
+			f.Peer = verr.Peer
+		}
+
+		fs = append(fs, f)
+	}
+
+	// Build the device without merging peers or allowed IPs, as
+	// wgtypes.Preview would, so that duplicates are reported.
+	d := wgtypes.Preview(&wgtypes.Device{Name: name}, wgtypes.Config{
+		PrivateKey:             cfg.PrivateKey,
+		ListenPort:             cfg.ListenPort,
+		FirewallMark:           cfg.FirewallMark,
+		AdvancedSecurityConfig: cfg.AdvancedSecurityConfig,
+	})
+
+	seen := make(map[wgtypes.Key]bool, len(cfg.Peers))
+	for _, pc := range cfg.Peers {
+		if pc.Remove {
+			continue
+		}
+
+		key := pc.PublicKey
+		if seen[key] {
+			fs = append(fs, Finding{
+				Severity: SeverityError,
+				Code:     FindingDuplicatePeer,
+				Peer:     &key,
+				Detail:   "peer is listed more than once, so only its last configuration takes effect",
+			})
+			continue
+		}
+		seen[key] = true
+
+		p := wgtypes.Peer{
+			PublicKey:  key,
+			Endpoint:   pc.Endpoint,
+			AllowedIPs: pc.AllowedIPs,
+		}
+		if pc.PresharedKey != nil {
+			p.PresharedKey = *pc.PresharedKey
+		}
+		if pc.PersistentKeepaliveInterval != nil {
+			p.PersistentKeepaliveInterval = *pc.PersistentKeepaliveInterval
+		}
+
+		d.Peers = append(d.Peers, p)
+	}
+
+	fs = append(fs, Lint(d, pathMTU)...)
+
+	sort.SliceStable(fs, func(i, j int) bool {
+		return fs[i].Severity > fs[j].Severity
+	})
+
+	return fs
+}
+
+// An allowedIP is an allowed IP of a peer, for lintAllowedIPs.
+type allowedIP struct {
+	prefix netip.Prefix
+	peer   wgtypes.Key
+}
+
+// lintAllowedIPs reports allowed IPs of d which are assigned to more than one
+// peer, of which WireGuard keeps only the last, and allowed IPs which contain
+// those of another peer, which routes part of their traffic to that peer.
+func lintAllowedIPs(d *wgtypes.Device) []Finding {
+	var ips []allowedIP
+	for _, p := range d.Peers {
+		for _, n := range p.AllowedIPs {
+			// Invalid allowed IPs are reported by wgtypes.Config.Validate.
+			pfx, err := wgtypes.AllowedIPPrefix(n)
+			if err != nil {
+				continue
+			}
+
+			ips = append(ips, allowedIP{prefix: pfx.Masked(), peer: p.PublicKey})
+		}
+	}
+
+	// Order prefixes so that each follows every prefix which contains it.
+	sort.SliceStable(ips, func(i, j int) bool {
+		a, b := ips[i].prefix, ips[j].prefix
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+
+		return a.Bits() < b.Bits()
+	})
+
+	var (
+		fs []Finding
+
+		// stack holds the prefixes which contain the current prefix, from
+		// outermost to innermost.
+		stack []allowedIP
+	)
+
+	for _, ip := range ips {
+		for len(stack) > 0 && !stack[len(stack)-1].prefix.Overlaps(ip.prefix) {
+			stack = stack[:len(stack)-1]
+		}
+
+		// Report the innermost containing prefix of another peer.
+		for i := len(stack) - 1; i >= 0; i-- {
+			outer := stack[i]
+			if outer.peer == ip.peer {
+				continue
+			}
+
+			key := ip.peer
+			if outer.prefix == ip.prefix {
+				fs = append(fs, Finding{
+					Severity: SeverityError,
+					Code:     FindingAllowedIPConflict,
+					Peer:     &key,
+					Detail:   fmt.Sprintf("allowed IP %s is also assigned to peer %s, and is only kept by the last", ip.prefix, outer.peer),
+				})
+			} else {
+				fs = append(fs, Finding{
+					Severity: SeverityWarning,
+					Code:     FindingAllowedIPOverlap,
+					Peer:     &key,
+					Detail:   fmt.Sprintf("allowed IP %s is within allowed IP %s of peer %s, so its traffic is routed to this peer instead", ip.prefix, outer.prefix, outer.peer),
+				})
+			}
+
+			break
+		}
+
+		stack = append(stack, ip)
+	}
+
+	return fs
+}
@@ -0,0 +1,160 @@
+package wgdiag
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		a    = wgtest.MustPublicKey()
+		b    = wgtest.MustPublicKey()
+	)
+
+	tests := []struct {
+		name  string
+		d     *wgtypes.Device
+		codes []string
+	}{
+		{
+			name: "OK",
+			d: &wgtypes.Device{
+				PrivateKey: priv,
+				PublicKey:  priv.PublicKey(),
+				Peers: []wgtypes.Peer{
+					{
+						PublicKey:  a,
+						Endpoint:   wgtest.MustUDPAddr("192.0.2.1:51820"),
+						AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.0/24")},
+					},
+					{
+						PublicKey:  b,
+						AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.1.0/24"), wgtest.MustCIDR("fd00::/64")},
+					},
+				},
+			},
+		},
+		{
+			name: "keys",
+			d: &wgtypes.Device{
+				PublicKey: priv.PublicKey(),
+				Peers: []wgtypes.Peer{
+					{PublicKey: priv.PublicKey(), AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.1/32")}},
+					{AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")}},
+				},
+			},
+			codes: []string{CauseNoPrivateKey, FindingSelfPeer, FindingInvalidPublicKey},
+		},
+		{
+			name: "endpoints",
+			d: &wgtypes.Device{
+				PrivateKey: priv,
+				Peers: []wgtypes.Peer{
+					{PublicKey: a, Endpoint: wgtest.MustUDPAddr("0.0.0.0:51820")},
+					{
+						PublicKey:  b,
+						Endpoint:   wgtest.MustUDPAddr("10.0.0.1:51820"),
+						AllowedIPs: []net.IPNet{wgtest.MustCIDR("0.0.0.0/0")},
+					},
+				},
+			},
+			codes: []string{CauseInvalidEndpoint, CauseRoutingLoop, CauseNoAllowedIPs},
+		},
+		{
+			name: "allowed IPs",
+			d: &wgtypes.Device{
+				PrivateKey: priv,
+				Peers: []wgtypes.Peer{
+					{
+						PublicKey: a,
+						AllowedIPs: []net.IPNet{
+							wgtest.MustCIDR("0.0.0.0/0"),
+							wgtest.MustCIDR("fd00::/64"),
+						},
+					},
+					{
+						PublicKey: b,
+						AllowedIPs: []net.IPNet{
+							wgtest.MustCIDR("10.0.0.0/8"),
+							wgtest.MustCIDR("fd00::/64"),
+						},
+					},
+				},
+			},
+			codes: []string{FindingAllowedIPConflict, FindingAllowedIPOverlap},
+		},
+		{
+			name: "AmneziaWG",
+			d: &wgtypes.Device{
+				PrivateKey: priv,
+				AdvancedSecurity: wgtypes.AdvancedSecurity{
+					JunkPacketMinSize:          100,
+					JunkPacketMaxSize:          50,
+					InitPacketJunkSize:         1400,
+					InitPacketMagicHeader:      1,
+					ResponsePacketMagicHeader:  2,
+					UnderloadPacketMagicHeader: 3,
+					TransportPacketMagicHeader: 4,
+				},
+			},
+			codes: []string{CauseAmneziaJunkSize, CauseJunkExceedsMTU},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var codes []string
+			for _, f := range Lint(tt.d, 0) {
+				codes = append(codes, f.Code)
+			}
+
+			if diff := cmp.Diff(tt.codes, codes); diff != "" {
+				t.Fatalf("unexpected findings (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		a    = wgtest.MustPublicKey()
+		b    = wgtest.MustPublicKey()
+
+		keepalive = 1500 * time.Millisecond
+	)
+
+	cfg := wgtypes.Config{
+		PrivateKey: &priv,
+		Peers: []wgtypes.PeerConfig{
+			{PublicKey: a, AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.1/32")}},
+			{
+				PublicKey:                   b,
+				PersistentKeepaliveInterval: &keepalive,
+				AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("10.0.0.1/32")},
+			},
+			{PublicKey: a, AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")}},
+		},
+	}
+
+	var got []Finding
+	for _, f := range LintConfig("wg0", cfg, 0) {
+		f.Detail = ""
+		got = append(got, f)
+	}
+
+	want := []Finding{
+		{Severity: SeverityError, Code: FindingInvalidConfig, Peer: &b},
+		{Severity: SeverityError, Code: FindingDuplicatePeer, Peer: &a},
+		{Severity: SeverityError, Code: FindingAllowedIPConflict, Peer: &b},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected findings (-want +got):\n%s", diff)
+	}
+}
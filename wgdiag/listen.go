@@ -0,0 +1,151 @@
+package wgdiag
+
+import (
+	"fmt"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// CauseListenFamilyMissing is returned by CheckListenFamilies when a device
+// has peers with endpoints in an address family on which it does not listen.
+const CauseListenFamilyMissing = "listen-family-missing"
+
+// A listenSocket is a UDP socket bound to a device's listening port.
+type listenSocket struct {
+	IPv6 bool
+
+	// V6Only reports whether an IPv6 socket has IPV6_V6ONLY set, and so
+	// does not also accept IPv4 packets as IPv4-mapped IPv6 addresses.
+	V6Only bool
+}
+
+// ListenFamilies reports the address families on which a device accepts
+// packets on its listening port.
+//
+// Implementations bind their sockets differently: the Linux kernel module and
+// wireguard-go open separate IPv4 and IPv6 sockets, while other
+// implementations may open a single dual-stack IPv6 socket, or only one
+// family if the other is unavailable when the device is brought up. Peers
+// whose endpoints are in a family the device does not listen on can't
+// complete handshakes, although peers in the other family are unaffected.
+type ListenFamilies struct {
+	// IPv4 and IPv6 report whether the device accepts IPv4 and IPv6 packets.
+	IPv4, IPv6 bool
+
+	// DualStack reports whether IPv4 packets are only accepted by an IPv6
+	// socket without IPV6_V6ONLY, as IPv4-mapped IPv6 addresses.
+	DualStack bool
+}
+
+// String returns "IPv4", "IPv6", "IPv4 and IPv6", or "none".
+func (lf ListenFamilies) String() string {
+	switch {
+	case lf.IPv4 && lf.IPv6:
+		return "IPv4 and IPv6"
+	case lf.IPv4:
+		return "IPv4"
+	case lf.IPv6:
+		return "IPv6"
+	default:
+		return "none"
+	}
+}
+
+// Listening reports the address families on which the UDP sockets bound to
+// the listening port of device d accept packets. Listening is only supported
+// on Linux.
+func Listening(d *wgtypes.Device) (ListenFamilies, error) {
+	if d.ListenPort == 0 {
+		return ListenFamilies{}, nil
+	}
+
+	socks, err := udpListenSockets(d.ListenPort)
+	if err != nil {
+		return ListenFamilies{}, fmt.Errorf("wgdiag: failed to read sockets: %w", err)
+	}
+
+	return listenFamilies(socks), nil
+}
+
+// listenFamilies determines the address families accepted by socks.
+func listenFamilies(socks []listenSocket) ListenFamilies {
+	var (
+		lf     ListenFamilies
+		mapped bool
+	)
+
+	for _, s := range socks {
+		switch {
+		case !s.IPv6:
+			lf.IPv4 = true
+		case s.V6Only:
+			lf.IPv6 = true
+		default:
+			lf.IPv6 = true
+			mapped = true
+		}
+	}
+
+	if mapped && !lf.IPv4 {
+		lf.IPv4 = true
+		lf.DualStack = true
+	}
+
+	return lf
+}
+
+// CheckListenFamilies verifies that device d listens on the address family
+// of each of its peers' endpoints, and returns a Cause for each family which
+// is missing. Devices which are not listening at all are left to Diagnose.
+// CheckListenFamilies is only supported on Linux.
+func CheckListenFamilies(d *wgtypes.Device) ([]Cause, error) {
+	if d.ListenPort == 0 {
+		return nil, nil
+	}
+
+	lf, err := Listening(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return listenFamilyCauses(d, lf), nil
+}
+
+// listenFamilyCauses compares the endpoints of d's peers against lf.
+func listenFamilyCauses(d *wgtypes.Device, lf ListenFamilies) []Cause {
+	if !lf.IPv4 && !lf.IPv6 {
+		return nil
+	}
+
+	var n4, n6 int
+	for _, p := range d.Peers {
+		if p.Endpoint == nil {
+			continue
+		}
+
+		if p.Endpoint.IP.To4() != nil {
+			n4++
+		} else {
+			n6++
+		}
+	}
+
+	var cs []Cause
+	add := func(family string, n int) {
+		cs = append(cs, Cause{
+			Code:  CauseListenFamilyMissing,
+			Score: 85,
+			Detail: fmt.Sprintf("device %q only listens on %s on UDP port %d, but %d peers have %s endpoints",
+				d.Name, lf, d.ListenPort, n, family),
+		})
+	}
+
+	if !lf.IPv4 && n4 > 0 {
+		add("IPv4", n4)
+	}
+	if !lf.IPv6 && n6 > 0 {
+		add("IPv6", n6)
+	}
+
+	return cs
+}
@@ -0,0 +1,59 @@
+//go:build linux
+// +build linux
+
+package wgdiag
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// udpListenSockets uses sock_diag to retrieve all UDP sockets bound to port.
+func udpListenSockets(port int) ([]listenSocket, error) {
+	msgs, err := dumpUDPSockets()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseListenSockets(msgs, port)
+}
+
+// parseListenSockets parses the sockets bound to port from sock_diag
+// inet_diag_msg responses.
+func parseListenSockets(msgs []netlink.Message, port int) ([]listenSocket, error) {
+	var socks []listenSocket
+	for _, m := range msgs {
+		if len(m.Data) < sizeofInetDiagMsg {
+			return nil, fmt.Errorf("short inet_diag_msg: %d bytes", len(m.Data))
+		}
+
+		// The source port in struct inet_diag_sockid is big endian.
+		if int(binary.BigEndian.Uint16(m.Data[4:6])) != port {
+			continue
+		}
+
+		s := listenSocket{IPv6: m.Data[0] == unix.AF_INET6}
+		if s.IPv6 {
+			ad, err := netlink.NewAttributeDecoder(m.Data[sizeofInetDiagMsg:])
+			if err != nil {
+				return nil, err
+			}
+
+			for ad.Next() {
+				if ad.Type() == inetDiagSKV6Only {
+					s.V6Only = ad.Uint8() != 0
+				}
+			}
+			if err := ad.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		socks = append(socks, s)
+	}
+
+	return socks, nil
+}
@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+package wgdiag
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestLinuxParseListenSockets(t *testing.T) {
+	msgs := []netlink.Message{
+		diagMessage(unix.AF_INET, 51820, false, 0),
+		v6DiagMessage(51820, true),
+		v6DiagMessage(51820, false),
+		v6DiagMessage(53, true),
+	}
+
+	want := []listenSocket{
+		{},
+		{IPv6: true, V6Only: true},
+		{IPv6: true},
+	}
+
+	socks, err := parseListenSockets(msgs, 51820)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if diff := cmp.Diff(want, socks); diff != "" {
+		t.Fatalf("unexpected sockets (-want +got):\n%s", diff)
+	}
+
+	if _, err := parseListenSockets([]netlink.Message{{Data: make([]byte, 4)}}, 51820); err == nil {
+		t.Fatal("expected an error for a short message, but none occurred")
+	}
+}
+
+// v6DiagMessage builds a sock_diag inet_diag_msg for an IPv6 socket bound to
+// port.
+func v6DiagMessage(port uint16, v6Only bool) netlink.Message {
+	b := make([]byte, sizeofInetDiagMsg)
+	b[0] = unix.AF_INET6
+	binary.BigEndian.PutUint16(b[4:6], port)
+
+	var v uint8
+	if v6Only {
+		v = 1
+	}
+
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint8(inetDiagSKV6Only, v)
+	attrs, err := ae.Encode()
+	if err != nil {
+		panic(err)
+	}
+
+	return netlink.Message{Data: append(b, attrs...)}
+}
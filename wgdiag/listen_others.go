@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package wgdiag
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// udpListenSockets reports that sockets cannot be read.
+func udpListenSockets(_ int) ([]listenSocket, error) {
+	return nil, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
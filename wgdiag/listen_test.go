@@ -0,0 +1,102 @@
+package wgdiag
+
+import (
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListenFamilies(t *testing.T) {
+	tests := []struct {
+		name  string
+		socks []listenSocket
+		want  ListenFamilies
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:  "IPv4",
+			socks: []listenSocket{{}},
+			want:  ListenFamilies{IPv4: true},
+		},
+		{
+			name:  "IPv6 only",
+			socks: []listenSocket{{IPv6: true, V6Only: true}},
+			want:  ListenFamilies{IPv6: true},
+		},
+		{
+			name:  "separate sockets",
+			socks: []listenSocket{{}, {IPv6: true, V6Only: true}},
+			want:  ListenFamilies{IPv4: true, IPv6: true},
+		},
+		{
+			name:  "dual-stack",
+			socks: []listenSocket{{IPv6: true}},
+			want:  ListenFamilies{IPv4: true, IPv6: true, DualStack: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, listenFamilies(tt.socks)); diff != "" {
+				t.Fatalf("unexpected families (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListenFamilyCauses(t *testing.T) {
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{
+			{Endpoint: wgtest.MustUDPAddr("192.0.2.1:51820")},
+			{Endpoint: wgtest.MustUDPAddr("[2001:db8::1]:51820")},
+			{Endpoint: wgtest.MustUDPAddr("[2001:db8::2]:51820")},
+			{},
+		},
+	}
+
+	tests := []struct {
+		name string
+		lf   ListenFamilies
+		want []Cause
+	}{
+		{
+			name: "both",
+			lf:   ListenFamilies{IPv4: true, IPv6: true},
+		},
+		{
+			name: "not listening",
+		},
+		{
+			name: "IPv4 only",
+			lf:   ListenFamilies{IPv4: true},
+			want: []Cause{{
+				Code:   CauseListenFamilyMissing,
+				Score:  85,
+				Detail: `device "wg0" only listens on IPv4 on UDP port 51820, but 2 peers have IPv6 endpoints`,
+			}},
+		},
+		{
+			name: "IPv6 only",
+			lf:   ListenFamilies{IPv6: true},
+			want: []Cause{{
+				Code:   CauseListenFamilyMissing,
+				Score:  85,
+				Detail: `device "wg0" only listens on IPv6 on UDP port 51820, but 1 peers have IPv4 endpoints`,
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, listenFamilyCauses(d, tt.lf)); diff != "" {
+				t.Fatalf("unexpected causes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
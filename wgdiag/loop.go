@@ -0,0 +1,67 @@
+package wgdiag
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// CheckRoutingLoops returns a Cause for each peer of d whose endpoint falls
+// within the allowed IPs of a peer on d, including its own. Encrypted packets
+// to such an endpoint are routed back into the tunnel, so the peer can never
+// complete a handshake and, with a default route, the node loses
+// connectivity.
+//
+// wg-quick and similar tools avoid the loop with policy routing keyed on the
+// device's firewall mark, so no checks are performed for devices with a
+// non-zero FirewallMark.
+func CheckRoutingLoops(d *wgtypes.Device) []Cause {
+	var cs []Cause
+	for _, p := range d.Peers {
+		via, n, ok := routingLoop(d, p)
+		if !ok {
+			continue
+		}
+
+		cs = append(cs, loopCause(d, p, via, n))
+	}
+
+	return cs
+}
+
+// routingLoop reports whether the endpoint of p on d is routed through the
+// tunnel, and if so, the peer and allowed IP responsible.
+func routingLoop(d *wgtypes.Device, p wgtypes.Peer) (wgtypes.Peer, net.IPNet, bool) {
+	if d.FirewallMark != 0 || p.Endpoint == nil {
+		return wgtypes.Peer{}, net.IPNet{}, false
+	}
+
+	for _, via := range d.Peers {
+		for _, n := range via.AllowedIPs {
+			if n.Contains(p.Endpoint.IP) {
+				return via, n, true
+			}
+		}
+	}
+
+	return wgtypes.Peer{}, net.IPNet{}, false
+}
+
+// loopCause returns a Cause describing the routing loop of p through via.
+func loopCause(d *wgtypes.Device, p, via wgtypes.Peer, n net.IPNet) Cause {
+	c := Cause{
+		Code:  CauseRoutingLoop,
+		Score: 95,
+	}
+
+	if via.PublicKey == p.PublicKey {
+		c.Detail = fmt.Sprintf("endpoint %s of peer %s on device %q is within its own allowed IP %s and no firewall mark is set",
+			p.Endpoint, p.PublicKey, d.Name, n.String())
+	} else {
+		c.Detail = fmt.Sprintf("endpoint %s of peer %s on device %q is within allowed IP %s of peer %s and no firewall mark is set",
+			p.Endpoint, p.PublicKey, d.Name, n.String(), via.PublicKey)
+	}
+
+	return c
+}
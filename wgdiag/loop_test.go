@@ -0,0 +1,80 @@
+package wgdiag
+
+import (
+	"net"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckRoutingLoops(t *testing.T) {
+	var (
+		exit = wgtest.MustPublicKey()
+		site = wgtest.MustPublicKey()
+	)
+
+	peers := func(exitEndpoint, siteEndpoint string) []wgtypes.Peer {
+		return []wgtypes.Peer{
+			{
+				PublicKey:  exit,
+				Endpoint:   wgtest.MustUDPAddr(exitEndpoint),
+				AllowedIPs: []net.IPNet{wgtest.MustCIDR("0.0.0.0/0")},
+			},
+			{
+				PublicKey:  site,
+				Endpoint:   wgtest.MustUDPAddr(siteEndpoint),
+				AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.0/8")},
+			},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		d     *wgtypes.Device
+		codes []string
+	}{
+		{
+			name: "no endpoints",
+			d: &wgtypes.Device{
+				Peers: []wgtypes.Peer{{
+					AllowedIPs: []net.IPNet{wgtest.MustCIDR("0.0.0.0/0")},
+				}},
+			},
+		},
+		{
+			name: "firewall mark",
+			d: &wgtypes.Device{
+				FirewallMark: 51820,
+				Peers:        peers("192.0.2.1:51820", "198.51.100.1:51820"),
+			},
+		},
+		{
+			name: "loops",
+			d: &wgtypes.Device{
+				Peers: peers("192.0.2.1:51820", "10.1.1.1:51820"),
+			},
+			codes: []string{CauseRoutingLoop, CauseRoutingLoop},
+		},
+		{
+			name: "IPv6 endpoint outside IPv4 default route",
+			d: &wgtypes.Device{
+				Peers: peers("[2001:db8::1]:51820", "[2001:db8::2]:51820"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var codes []string
+			for _, c := range CheckRoutingLoops(tt.d) {
+				codes = append(codes, c.Code)
+			}
+
+			if diff := cmp.Diff(tt.codes, codes); diff != "" {
+				t.Fatalf("unexpected causes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
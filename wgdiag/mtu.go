@@ -0,0 +1,276 @@
+package wgdiag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// Sizes used to compute the overhead of WireGuard encapsulation.
+const (
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+	udpHeaderSize  = 8
+
+	// A transport data message has a 16 byte header (type, receiver index,
+	// and counter) and a 16 byte Poly1305 authentication tag.
+	transportOverhead = 32
+)
+
+// Default values for MTUProber fields.
+const (
+	defaultMinMTU   = 1280
+	defaultMaxMTU   = 1500
+	defaultTimeout  = time.Second
+	defaultAttempts = 3
+)
+
+// TunnelOverhead returns the number of bytes WireGuard adds to each packet it
+// carries when the peer's endpoint is an IPv4 or IPv6 address. AmneziaWG 1.5
+// S4 padding, which RecommendMTU accounts for, is not included.
+func TunnelOverhead(ipv6 bool) int {
+	ip := ipv4HeaderSize
+	if ipv6 {
+		ip = ipv6HeaderSize
+	}
+
+	return ip + udpHeaderSize + transportOverhead
+}
+
+// RecommendMTU returns the interface MTU for a device whose peer is reached
+// over a path with the specified MTU, such as one found by adding
+// TunnelOverhead to the result of an MTUProber.
+//
+// Transport packets padded by the S4 parameter of as leave correspondingly
+// less space for tunneled packets. An error is returned if handshake or junk
+// packets padded according to as would not fit in the path without
+// fragmentation, which often prevents AmneziaWG handshakes from completing at
+// all.
+func RecommendMTU(pathMTU int, ipv6 bool, as wgtypes.AdvancedSecurity) (int, error) {
+	overhead := TunnelOverhead(ipv6) + int(as.TransportPacketJunkSize)
+	mtu := pathMTU - overhead
+	if mtu < defaultMinMTU && ipv6 {
+		return 0, fmt.Errorf("wgdiag: path MTU %d is too small to carry IPv6 traffic", pathMTU)
+	}
+	if mtu <= 0 {
+		return 0, fmt.Errorf("wgdiag: path MTU %d is too small", pathMTU)
+	}
+
+	for _, p := range udpPackets(ipv6, as) {
+		if p.size > pathMTU {
+			return 0, fmt.Errorf("wgdiag: %s packets of %d bytes exceed path MTU %d", p.name, p.size, pathMTU)
+		}
+	}
+
+	return mtu, nil
+}
+
+// CauseJunkExceedsMTU is returned by CheckJunkMTU when AmneziaWG padding makes
+// handshake or junk packets larger than the path MTU.
+const CauseJunkExceedsMTU = "amnezia-junk-mtu"
+
+// CheckJunkMTU verifies that the handshake and junk packets of device d, as
+// padded by its AmneziaWG parameters, fit within pathMTU for the address
+// family of each peer endpoint, and returns a Cause for each kind of packet
+// which does not. Oversized packets are fragmented, which makes them easy to
+// detect by DPI and causes them to be dropped by many networks, so handshakes
+// fail while plain WireGuard peers on the same path work.
+//
+// If no peer has an endpoint, IPv4 is assumed.
+func CheckJunkMTU(d *wgtypes.Device, pathMTU int) []Cause {
+	var v4, v6 bool
+	for _, p := range d.Peers {
+		if p.Endpoint == nil {
+			continue
+		}
+
+		if p.Endpoint.IP.To4() != nil {
+			v4 = true
+		} else {
+			v6 = true
+		}
+	}
+	if !v4 && !v6 {
+		v4 = true
+	}
+
+	var cs []Cause
+	for _, ipv6 := range []bool{false, true} {
+		if (ipv6 && !v6) || (!ipv6 && !v4) {
+			continue
+		}
+
+		family := "IPv4"
+		if ipv6 {
+			family = "IPv6"
+		}
+
+		for _, p := range udpPackets(ipv6, d.AdvancedSecurity) {
+			if p.size <= pathMTU {
+				continue
+			}
+
+			cs = append(cs, Cause{
+				Code:  CauseJunkExceedsMTU,
+				Score: 80,
+				Detail: fmt.Sprintf("%s packets of device %q are %d bytes over %s (%s), exceeding path MTU %d by %d bytes",
+					p.name, d.Name, p.size, family, p.detail, pathMTU, p.size-pathMTU),
+			})
+		}
+	}
+
+	return cs
+}
+
+// A udpPacket is a kind of packet which is carried directly in UDP, rather
+// than as transport data, and its size including IP and UDP headers.
+type udpPacket struct {
+	name   string
+	size   int
+	detail string
+}
+
+// udpPackets returns the largest handshake and junk packets sent by a device
+// with AmneziaWG parameters as, when its peer's endpoint is an IPv4 or IPv6
+// address.
+func udpPackets(ipv6 bool, as wgtypes.AdvancedSecurity) []udpPacket {
+	headers := TunnelOverhead(ipv6) - transportOverhead
+
+	return []udpPacket{
+		{
+			name:   "handshake initiation",
+			size:   headers + initiationSize + int(as.InitPacketJunkSize),
+			detail: fmt.Sprintf("%d byte message, S1 %d, %d bytes of headers", initiationSize, as.InitPacketJunkSize, headers),
+		},
+		{
+			name:   "handshake response",
+			size:   headers + responseSize + int(as.ResponsePacketJunkSize),
+			detail: fmt.Sprintf("%d byte message, S2 %d, %d bytes of headers", responseSize, as.ResponsePacketJunkSize, headers),
+		},
+		{
+			name:   "cookie reply",
+			size:   headers + cookieReplySize + int(as.UnderloadPacketJunkSize),
+			detail: fmt.Sprintf("%d byte message, S3 %d, %d bytes of headers", cookieReplySize, as.UnderloadPacketJunkSize, headers),
+		},
+		{
+			name:   "junk",
+			size:   headers + int(as.JunkPacketMaxSize),
+			detail: fmt.Sprintf("Jmax %d, %d bytes of headers", as.JunkPacketMaxSize, headers),
+		},
+	}
+}
+
+// An MTUProber finds the largest packet which can be sent through a tunnel,
+// by sending ICMP echo requests with the don't fragment bit set to a peer's
+// tunnel address and searching for the largest which is answered. Probing
+// requires permission to open ICMP sockets and is only supported on Linux.
+type MTUProber struct {
+	// Target is the peer's address within the tunnel.
+	Target net.IP
+
+	// Min and Max bound the MTU search. If zero, defaults of 1280 and 1500
+	// are used. Min is assumed to work if no larger probe succeeds.
+	Min, Max int
+
+	// Timeout is the time to wait for each reply. If zero, a default of one
+	// second is used.
+	Timeout time.Duration
+
+	// Attempts is the number of probes of each size sent before the size is
+	// considered too large. If zero, a default of 3 is used.
+	Attempts int
+
+	// probe may be replaced in tests.
+	probe func(ctx context.Context, size int) (bool, error)
+}
+
+// errTooBig indicates that a probe was too large to send.
+var errTooBig = errors.New("packet too big")
+
+// Run searches for the largest working packet size, including IP headers,
+// and returns it. That size is the largest usable MTU of the tunnel
+// interface.
+func (p *MTUProber) Run(ctx context.Context) (int, error) {
+	lo, hi := p.Min, p.Max
+	if lo == 0 {
+		lo = defaultMinMTU
+	}
+	if hi == 0 {
+		hi = defaultMaxMTU
+	}
+	if lo > hi {
+		return 0, fmt.Errorf("wgdiag: minimum MTU %d exceeds maximum %d", lo, hi)
+	}
+
+	probe := p.probe
+	if probe == nil {
+		pc, err := listenICMP(p.Target)
+		if err != nil {
+			return 0, fmt.Errorf("wgdiag: failed to open ICMP socket: %w", err)
+		}
+		defer pc.Close()
+
+		probe = func(ctx context.Context, size int) (bool, error) {
+			return pc.echo(ctx, p.Target, size, p.timeout())
+		}
+	}
+
+	// Binary search for the largest size which is answered, with lo always
+	// assumed to work.
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+
+		ok, err := p.try(ctx, probe, mid)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return lo, nil
+}
+
+// try sends up to Attempts probes of size and reports whether any was
+// answered.
+func (p *MTUProber) try(ctx context.Context, probe func(ctx context.Context, size int) (bool, error), size int) (bool, error) {
+	attempts := p.Attempts
+	if attempts == 0 {
+		attempts = defaultAttempts
+	}
+
+	for i := 0; i < attempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		ok, err := probe(ctx, size)
+		switch {
+		case errors.Is(err, errTooBig):
+			// Retrying can't help.
+			return false, nil
+		case err != nil:
+			return false, fmt.Errorf("wgdiag: failed to probe MTU %d: %w", size, err)
+		case ok:
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (p *MTUProber) timeout() time.Duration {
+	if p.Timeout != 0 {
+		return p.Timeout
+	}
+
+	return defaultTimeout
+}
@@ -0,0 +1,136 @@
+//go:build linux
+// +build linux
+
+package wgdiag
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+// An icmpConn is an unprivileged ICMP datagram socket which always sets the
+// don't fragment bit.
+type icmpConn struct {
+	c    net.PacketConn
+	ipv6 bool
+	seq  int
+}
+
+// listenICMP opens an ICMP socket for probing target. Unprivileged ICMP
+// sockets must be permitted by the net.ipv4.ping_group_range sysctl.
+func listenICMP(target net.IP) (*icmpConn, error) {
+	var (
+		ip6             = target.To4() == nil
+		family, proto   = unix.AF_INET, unix.IPPROTO_ICMP
+		level, opt, val = unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_PROBE
+	)
+	if ip6 {
+		family, proto = unix.AF_INET6, unix.IPPROTO_ICMPV6
+		level, opt, val = unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_PROBE
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+
+	// Set the don't fragment bit, ignoring any cached path MTU so that the
+	// probes themselves determine the result.
+	if err := unix.SetsockoptInt(fd, level, opt, val); err != nil {
+		_ = unix.Close(fd)
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+
+	c, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &icmpConn{c: c, ipv6: ip6}, nil
+}
+
+// Close closes the socket.
+func (c *icmpConn) Close() error { return c.c.Close() }
+
+// echo sends an echo request of size bytes, including IP headers, to target
+// and reports whether a reply was received within timeout.
+func (c *icmpConn) echo(ctx context.Context, target net.IP, size int, timeout time.Duration) (bool, error) {
+	var (
+		typ, reply icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+		header               = ipv4HeaderSize
+		proto                = 1
+	)
+	if c.ipv6 {
+		typ, reply = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		header, proto = ipv6HeaderSize, 58
+	}
+
+	// An ICMP echo header is 8 bytes.
+	data := size - header - 8
+	if data < 0 {
+		data = 0
+	}
+
+	c.seq++
+	b, err := (&icmp.Message{
+		Type: typ,
+		Body: &icmp.Echo{
+			// The kernel replaces the ID of unprivileged echo requests.
+			Seq:  c.seq & 0xffff,
+			Data: make([]byte, data),
+		},
+	}).Marshal(nil)
+	if err != nil {
+		return false, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.c.SetDeadline(deadline); err != nil {
+		return false, err
+	}
+
+	if _, err := c.c.WriteTo(b, &net.UDPAddr{IP: target}); err != nil {
+		if errors.Is(err, unix.EMSGSIZE) {
+			return false, errTooBig
+		}
+
+		return false, err
+	}
+
+	buf := make([]byte, size+header)
+	for {
+		n, _, err := c.c.ReadFrom(buf)
+		if err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+
+		// Ignore stale replies to earlier probes.
+		if e, ok := m.Body.(*icmp.Echo); ok && m.Type == reply && e.Seq == c.seq&0xffff {
+			return true, nil
+		}
+	}
+}
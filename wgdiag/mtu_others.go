@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package wgdiag
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+)
+
+// An icmpConn is unused on this platform.
+type icmpConn struct{}
+
+// listenICMP reports that MTU probing is not supported.
+func listenICMP(_ net.IP) (*icmpConn, error) {
+	return nil, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
+
+func (*icmpConn) Close() error { return nil }
+
+func (*icmpConn) echo(_ context.Context, _ net.IP, _ int, _ time.Duration) (bool, error) {
+	return false, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
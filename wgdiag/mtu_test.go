@@ -0,0 +1,244 @@
+package wgdiag
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMTUProberRun(t *testing.T) {
+	errProbe := errors.New("probe failed")
+
+	tests := []struct {
+		name  string
+		p     MTUProber
+		probe func(size int, attempt int) (bool, error)
+		mtu   int
+		ok    bool
+	}{
+		{
+			name: "bad range",
+			p:    MTUProber{Min: 1500, Max: 1280},
+		},
+		{
+			name: "probe error",
+			probe: func(_, _ int) (bool, error) {
+				return false, errProbe
+			},
+		},
+		{
+			name: "path limit",
+			probe: func(size, _ int) (bool, error) {
+				return size <= 1412, nil
+			},
+			mtu: 1412,
+			ok:  true,
+		},
+		{
+			name: "too big locally",
+			probe: func(size, _ int) (bool, error) {
+				if size > 1420 {
+					return false, errTooBig
+				}
+				return true, nil
+			},
+			mtu: 1420,
+			ok:  true,
+		},
+		{
+			name: "lossy",
+			probe: func(size, attempt int) (bool, error) {
+				// Only the final attempt of each size is answered.
+				return size <= 1400 && attempt == defaultAttempts-1, nil
+			},
+			mtu: 1400,
+			ok:  true,
+		},
+		{
+			name: "nothing answered",
+			probe: func(_, _ int) (bool, error) {
+				return false, nil
+			},
+			mtu: defaultMinMTU,
+			ok:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := make(map[int]int)
+			tt.p.probe = func(_ context.Context, size int) (bool, error) {
+				defer func() { attempts[size]++ }()
+				return tt.probe(size, attempts[size])
+			}
+
+			mtu, err := tt.p.Run(context.Background())
+			if tt.ok && err != nil {
+				t.Fatalf("failed to probe MTU: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tt.mtu, mtu); diff != "" {
+				t.Fatalf("unexpected MTU (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRecommendMTU(t *testing.T) {
+	tests := []struct {
+		name    string
+		pathMTU int
+		ipv6    bool
+		as      wgtypes.AdvancedSecurity
+		mtu     int
+		ok      bool
+	}{
+		{
+			name:    "IPv4",
+			pathMTU: 1500,
+			mtu:     1440,
+			ok:      true,
+		},
+		{
+			name:    "IPv6",
+			pathMTU: 1500,
+			ipv6:    true,
+			mtu:     1420,
+			ok:      true,
+		},
+		{
+			name:    "IPv6 too small",
+			pathMTU: 1340,
+			ipv6:    true,
+		},
+		{
+			name:    "amnezia",
+			pathMTU: 1500,
+			as: wgtypes.AdvancedSecurity{
+				JunkPacketMaxSize:      1000,
+				InitPacketJunkSize:     100,
+				ResponsePacketJunkSize: 100,
+			},
+			mtu: 1440,
+			ok:  true,
+		},
+		{
+			name:    "amnezia transport padding",
+			pathMTU: 1500,
+			as:      wgtypes.AdvancedSecurity{TransportPacketJunkSize: 40},
+			mtu:     1400,
+			ok:      true,
+		},
+		{
+			name:    "amnezia cookie reply too large",
+			pathMTU: 1500,
+			as:      wgtypes.AdvancedSecurity{UnderloadPacketJunkSize: 1420},
+		},
+		{
+			name:    "amnezia junk too large",
+			pathMTU: 1500,
+			as:      wgtypes.AdvancedSecurity{JunkPacketMaxSize: 1480},
+		},
+		{
+			name:    "amnezia initiation too large",
+			pathMTU: 1280,
+			as:      wgtypes.AdvancedSecurity{InitPacketJunkSize: 1200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mtu, err := RecommendMTU(tt.pathMTU, tt.ipv6, tt.as)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to recommend MTU: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tt.mtu, mtu); diff != "" {
+				t.Fatalf("unexpected MTU (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckJunkMTU(t *testing.T) {
+	var (
+		v4 = wgtest.MustUDPAddr("192.0.2.1:51820")
+		v6 = wgtest.MustUDPAddr("[2001:db8::1]:51820")
+	)
+
+	tests := []struct {
+		name      string
+		endpoints []*net.UDPAddr
+		as        wgtypes.AdvancedSecurity
+		codes     []string
+		details   []string
+	}{
+		{
+			name: "plain",
+		},
+		{
+			name:      "fits",
+			endpoints: []*net.UDPAddr{v4, v6},
+			as: wgtypes.AdvancedSecurity{
+				JunkPacketMaxSize:  1000,
+				InitPacketJunkSize: 100,
+			},
+		},
+		{
+			name:  "initiation IPv4",
+			as:    wgtypes.AdvancedSecurity{InitPacketJunkSize: 1400},
+			codes: []string{CauseJunkExceedsMTU},
+			details: []string{
+				`handshake initiation packets of device "wg0" are 1576 bytes over IPv4 (148 byte message, S1 1400, 28 bytes of headers), exceeding path MTU 1500 by 76 bytes`,
+			},
+		},
+		{
+			name:      "junk IPv6 only",
+			endpoints: []*net.UDPAddr{v4, v6},
+			as:        wgtypes.AdvancedSecurity{JunkPacketMaxSize: 1460},
+			codes:     []string{CauseJunkExceedsMTU},
+			details: []string{
+				`junk packets of device "wg0" are 1508 bytes over IPv6 (Jmax 1460, 48 bytes of headers), exceeding path MTU 1500 by 8 bytes`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &wgtypes.Device{Name: "wg0", AdvancedSecurity: tt.as}
+			for _, ep := range tt.endpoints {
+				d.Peers = append(d.Peers, wgtypes.Peer{Endpoint: ep})
+			}
+
+			var codes, details []string
+			for _, c := range CheckJunkMTU(d, 1500) {
+				codes = append(codes, c.Code)
+				details = append(details, c.Detail)
+			}
+
+			if diff := cmp.Diff(tt.codes, codes); diff != "" {
+				t.Fatalf("unexpected cause codes (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.details, details); diff != "" {
+				t.Fatalf("unexpected cause details (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+// Package wgendpoint keeps WireGuard peer endpoints reachable as the network
+// environment of the host changes.
+//
+// WireGuard itself only learns a new endpoint for a peer when it receives an
+// authenticated packet from that peer, and the kernel implementations cache
+// the source address used to reach each endpoint. When a roaming client
+// switches between networks, such as from Wi-Fi to LTE, the tunnel may stall
+// until the next handshake times out. The types in this package detect such
+// changes and reconfigure the affected peers through package wgctrl.
+package wgendpoint
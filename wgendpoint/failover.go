@@ -0,0 +1,174 @@
+package wgendpoint
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// defaultFailoverTimeout is the default value for Failover.Timeout. It is the
+// WireGuard protocol's reject-after-time, after which a peer which is sent
+// traffic must have completed a new handshake.
+const defaultFailoverTimeout = 180 * time.Second
+
+// A Failover switches a peer's endpoint between IPv4 and IPv6 addresses when
+// the active address family becomes unreachable. WireGuard itself never
+// retries an endpoint using the other address family.
+//
+// A peer is considered unreachable when traffic has been sent to it since its
+// most recent handshake, and no handshake has completed within Timeout. After
+// switching, the new endpoint is given a full Timeout to complete a
+// handshake before switching back, so that a peer which is unreachable over
+// both families does not flap between them.
+type Failover struct {
+	// Peer is the public key of the peer to manage.
+	Peer wgtypes.Key
+
+	// IPv4 and IPv6 are the candidate endpoints for Peer. If either is
+	// nil, no failover occurs away from the other.
+	IPv4, IPv6 *net.UDPAddr
+
+	// Timeout is the amount of time after which a peer that has been sent
+	// traffic without completing a handshake is considered unreachable. If
+	// zero, a default of 180 seconds is used.
+	Timeout time.Duration
+
+	// handshake and tx are the most recent handshake time and the number of
+	// bytes transmitted when it was observed. switched is the time of the
+	// most recent failover.
+	handshake, switched time.Time
+	tx                  int64
+	started             bool
+
+	// now may be replaced in tests.
+	now func() time.Time
+}
+
+// LookupFailover creates a Failover for peer using the IPv4 and IPv6
+// addresses of the "host:port" endpoint hostport, resolved using r. If r is
+// nil, net.DefaultResolver is used.
+func LookupFailover(ctx context.Context, r Resolver, peer wgtypes.Key, hostport string) (*Failover, error) {
+	f := &Failover{Peer: peer}
+
+	var err error
+	for _, network := range []string{"ip4", "ip6"} {
+		addr, rerr := ResolveUDPAddr(ctx, r, network, hostport)
+		if rerr != nil {
+			// A host needn't have addresses of both families.
+			err = rerr
+			continue
+		}
+
+		if network == "ip4" {
+			f.IPv4 = addr
+		} else {
+			f.IPv6 = addr
+		}
+	}
+
+	if f.IPv4 == nil && f.IPv6 == nil {
+		return nil, fmt.Errorf("wgendpoint: failed to resolve %q: %w", hostport, err)
+	}
+
+	return f, nil
+}
+
+// Check inspects the peer on the device specified by name, and if the active
+// endpoint is unreachable, configures the endpoint of the other address
+// family. Check returns the newly configured endpoint, or nil if no change
+// was made. Check should be called periodically, such as every few seconds.
+func (f *Failover) Check(c Client, name string) (*net.UDPAddr, error) {
+	d, err := c.Device(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var p *wgtypes.Peer
+	for i := range d.Peers {
+		if d.Peers[i].PublicKey == f.Peer {
+			p = &d.Peers[i]
+			break
+		}
+	}
+	if p == nil {
+		return nil, fmt.Errorf("wgendpoint: peer %s not found on device %q: %w", f.Peer, name, os.ErrNotExist)
+	}
+
+	now := f.timeNow()
+	if !f.started || !p.LastHandshakeTime.Equal(f.handshake) {
+		// First observation or a new handshake: the active endpoint is
+		// reachable, so measure traffic from this point on.
+		f.started = true
+		f.handshake = p.LastHandshakeTime
+		f.tx = p.TransmitBytes
+		return nil, nil
+	}
+
+	last := f.handshake
+	if f.switched.After(last) {
+		last = f.switched
+	}
+
+	if p.TransmitBytes == f.tx || now.Sub(last) < f.timeout() {
+		return nil, nil
+	}
+
+	next := f.alternate(p.Endpoint)
+	if next == nil {
+		return nil, nil
+	}
+
+	err = c.ConfigureDevice(name, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:  f.Peer,
+			UpdateOnly: true,
+			Endpoint:   next,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f.switched = now
+	f.tx = p.TransmitBytes
+	return next, nil
+}
+
+// alternate returns the candidate endpoint of the address family which is not
+// used by active, or nil if there is none.
+func (f *Failover) alternate(active *net.UDPAddr) *net.UDPAddr {
+	if active == nil {
+		// Prefer IPv4 when no endpoint is known, since it is more likely
+		// to be routable.
+		if f.IPv4 != nil {
+			return f.IPv4
+		}
+		return f.IPv6
+	}
+
+	if active.IP.To4() != nil {
+		return f.IPv6
+	}
+
+	return f.IPv4
+}
+
+func (f *Failover) timeout() time.Duration {
+	if f.Timeout == 0 {
+		return defaultFailoverTimeout
+	}
+
+	return f.Timeout
+}
+
+func (f *Failover) timeNow() time.Time {
+	if f.now == nil {
+		return time.Now()
+	}
+
+	return f.now()
+}
@@ -0,0 +1,132 @@
+package wgendpoint
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFailoverCheck(t *testing.T) {
+	var (
+		peer = wgtest.MustPublicKey()
+		v4   = wgtest.MustUDPAddr("192.0.2.1:51820")
+		v6   = wgtest.MustUDPAddr("[2001:db8::1]:51820")
+
+		start = time.Unix(1000, 0)
+		now   = start
+	)
+
+	p := &wgtypes.Peer{
+		PublicKey:         peer,
+		Endpoint:          v4,
+		LastHandshakeTime: start,
+	}
+
+	c := &testClient{}
+	f := &Failover{
+		Peer:    peer,
+		IPv4:    v4,
+		IPv6:    v6,
+		Timeout: time.Minute,
+		now:     func() time.Time { return now },
+	}
+
+	check := func(want *net.UDPAddr) {
+		t.Helper()
+
+		c.d = &wgtypes.Device{Peers: []wgtypes.Peer{*p}}
+		got, err := f.Check(c, "wg0")
+		if err != nil {
+			t.Fatalf("failed to check: %v", err)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected endpoint (-want +got):\n%s", diff)
+		}
+
+		if got != nil {
+			p.Endpoint = got
+		}
+	}
+
+	// Establish the baseline.
+	check(nil)
+
+	// An idle peer is not unreachable, regardless of handshake age.
+	now = start.Add(10 * time.Minute)
+	check(nil)
+
+	// Traffic was sent and the timeout has elapsed since the most
+	// recent handshake, so fail over to IPv6.
+	p.TransmitBytes = 148
+	check(v6)
+
+	// The new endpoint is given a full timeout, even though traffic is sent.
+	p.TransmitBytes = 296
+	now = now.Add(30 * time.Second)
+	check(nil)
+
+	// A handshake completes over IPv6, so the peer is reachable.
+	p.LastHandshakeTime = now
+	check(nil)
+
+	// Traffic is sent and IPv6 stops working, so fail back to IPv4.
+	p.TransmitBytes = 444
+	now = now.Add(time.Minute)
+	check(v4)
+
+	want := []wgtypes.Config{
+		{Peers: []wgtypes.PeerConfig{{PublicKey: peer, UpdateOnly: true, Endpoint: v6}}},
+		{Peers: []wgtypes.PeerConfig{{PublicKey: peer, UpdateOnly: true, Endpoint: v4}}},
+	}
+
+	if diff := cmp.Diff(want, c.cfgs); diff != "" {
+		t.Fatalf("unexpected configuration (-want +got):\n%s", diff)
+	}
+}
+
+func TestFailoverCheckNoAlternate(t *testing.T) {
+	peer := wgtest.MustPublicKey()
+
+	c := &testClient{d: &wgtypes.Device{Peers: []wgtypes.Peer{{
+		PublicKey: peer,
+		Endpoint:  wgtest.MustUDPAddr("192.0.2.1:51820"),
+	}}}}
+
+	now := time.Unix(1000, 0)
+	f := &Failover{
+		Peer: peer,
+		IPv4: wgtest.MustUDPAddr("192.0.2.1:51820"),
+		now:  func() time.Time { return now },
+	}
+
+	if _, err := f.Check(c, "wg0"); err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	c.d.Peers[0].TransmitBytes = 148
+
+	addr, err := f.Check(c, "wg0")
+	if err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	if addr != nil || len(c.cfgs) > 0 {
+		t.Fatalf("expected no failover, but got: %v", addr)
+	}
+}
+
+func TestFailoverCheckPeerNotFound(t *testing.T) {
+	c := &testClient{d: &wgtypes.Device{}}
+	f := &Failover{Peer: wgtest.MustPublicKey()}
+
+	if _, err := f.Check(c, "wg0"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package wgendpoint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// defaultSettle is the default value for RouteMonitor.Settle.
+const defaultSettle = 1 * time.Second
+
+// A Client is a type which can retrieve and configure WireGuard devices, such
+// as *wgctrl.Client.
+type Client interface {
+	Device(name string) (*wgtypes.Device, error)
+	ConfigureDevice(name string, cfg wgtypes.Config) error
+}
+
+// A RouteEventKind indicates the type of a RouteEvent.
+type RouteEventKind int
+
+// Possible RouteEventKind values.
+const (
+	// DefaultRouteChanged indicates that a default route was added, removed,
+	// or replaced.
+	DefaultRouteChanged RouteEventKind = iota
+
+	// AddressChanged indicates that an address which may be used as the
+	// source of outgoing packets was added to or removed from an interface.
+	AddressChanged
+)
+
+// String returns the string representation of a RouteEventKind.
+func (k RouteEventKind) String() string {
+	switch k {
+	case DefaultRouteChanged:
+		return "default route changed"
+	case AddressChanged:
+		return "address changed"
+	default:
+		return "unknown"
+	}
+}
+
+// A RouteEvent is a change to the routing state of the host which may affect
+// the reachability of peer endpoints.
+type RouteEvent struct {
+	// Kind specifies the type of change.
+	Kind RouteEventKind
+
+	// IPv6 reports whether the change affects IPv6 rather than IPv4.
+	IPv6 bool
+
+	// Index is the index of the network interface affected by the change,
+	// or 0 if unknown.
+	Index int
+}
+
+// An Action is invoked by a RouteMonitor once a burst of routing changes has
+// settled. events contains every change observed since the previous
+// invocation.
+type Action func(ctx context.Context, events []RouteEvent) error
+
+// A RouteMonitor watches the routing state of the host and invokes Actions
+// when a default route or source address changes.
+type RouteMonitor struct {
+	// Actions are invoked in order after each burst of routing changes.
+	Actions []Action
+
+	// Settle is the amount of time to wait after the most recent routing
+	// change before invoking Actions, because a single network transition
+	// typically produces many changes. If zero, a default of 1 second is
+	// used.
+	Settle time.Duration
+
+	// OnError, if set, is called with any error returned by an Action.
+	// Errors from Actions do not stop the RouteMonitor.
+	OnError func(err error)
+
+	// open opens the source of routing changes, and may be replaced in tests.
+	open func() (routeSource, error)
+}
+
+// A routeSource is an operating system specific source of RouteEvents.
+type routeSource interface {
+	// Receive blocks until one or more RouteEvents are available. It may
+	// return no events for changes which are not of interest.
+	Receive() ([]RouteEvent, error)
+
+	// Close unblocks any pending calls to Receive and releases resources.
+	Close() error
+}
+
+// Run watches for routing changes until ctx is canceled or an error occurs.
+// Run always returns a non-nil error.
+func (m *RouteMonitor) Run(ctx context.Context) error {
+	open := m.open
+	if open == nil {
+		open = newRouteSource
+	}
+
+	src, err := open()
+	if err != nil {
+		return fmt.Errorf("wgendpoint: failed to monitor routes: %w", err)
+	}
+
+	var (
+		eventC = make(chan []RouteEvent)
+		errC   = make(chan error, 1)
+		done   = make(chan struct{})
+	)
+
+	defer func() {
+		close(done)
+		_ = src.Close()
+	}()
+
+	go func() {
+		for {
+			events, err := src.Receive()
+			if err != nil {
+				errC <- err
+				return
+			}
+			if len(events) == 0 {
+				continue
+			}
+
+			select {
+			case eventC <- events:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	settle := m.Settle
+	if settle == 0 {
+		settle = defaultSettle
+	}
+
+	var (
+		pending []RouteEvent
+		timer   *time.Timer
+		fire    <-chan time.Time
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return ctx.Err()
+		case err := <-errC:
+			return fmt.Errorf("wgendpoint: failed to receive route changes: %w", err)
+		case events := <-eventC:
+			pending = append(pending, events...)
+
+			// Restart the settle period on every change.
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(settle)
+			fire = timer.C
+		case <-fire:
+			m.act(ctx, pending)
+			pending, timer, fire = nil, nil, nil
+		}
+	}
+}
+
+// act invokes each Action with events.
+func (m *RouteMonitor) act(ctx context.Context, events []RouteEvent) {
+	for _, a := range m.Actions {
+		if err := a(ctx, events); err != nil && m.OnError != nil {
+			m.OnError(err)
+		}
+	}
+}
+
+// ReapplyEndpoints returns an Action which sets the endpoint of every peer on
+// the device specified by name to its current value. This discards the source
+// address cached for each peer by the kernel, so that the next packet to the
+// peer is routed according to the new routing table.
+func ReapplyEndpoints(c Client, name string) Action {
+	return func(_ context.Context, _ []RouteEvent) error {
+		d, err := c.Device(name)
+		if err != nil {
+			return err
+		}
+
+		var peers []wgtypes.PeerConfig
+		for _, p := range d.Peers {
+			if p.Endpoint == nil {
+				continue
+			}
+
+			peers = append(peers, wgtypes.PeerConfig{
+				PublicKey:  p.PublicKey,
+				UpdateOnly: true,
+				Endpoint:   p.Endpoint,
+			})
+		}
+
+		if len(peers) == 0 {
+			return nil
+		}
+
+		return c.ConfigureDevice(name, wgtypes.Config{Peers: peers})
+	}
+}
+
+// ResolveEndpoints returns an Action which resolves the "host:port" endpoint
+// configured for each peer in endpoints using r and applies the result to the
+// device specified by name. This allows a peer whose DNS name resolves
+// differently on the new network to be reached at its new address. If r is
+// nil, net.DefaultResolver is used.
+//
+// If any endpoint fails to resolve, no changes are applied.
+func ResolveEndpoints(c Client, name string, r Resolver, endpoints map[wgtypes.Key]string) Action {
+	return func(ctx context.Context, _ []RouteEvent) error {
+		peers := make([]wgtypes.PeerConfig, 0, len(endpoints))
+		for k, hostport := range endpoints {
+			addr, err := ResolveUDPAddr(ctx, r, "ip", hostport)
+			if err != nil {
+				return fmt.Errorf("wgendpoint: failed to resolve endpoint for peer %s: %w", k, err)
+			}
+
+			peers = append(peers, wgtypes.PeerConfig{
+				PublicKey:  k,
+				UpdateOnly: true,
+				Endpoint:   addr,
+			})
+		}
+
+		if len(peers) == 0 {
+			return nil
+		}
+
+		return c.ConfigureDevice(name, wgtypes.Config{Peers: peers})
+	}
+}
@@ -0,0 +1,118 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package wgendpoint
+
+import (
+	"os"
+
+	"golang.org/x/net/route"
+	"golang.org/x/sys/unix"
+)
+
+// A routingSocketSource is a routeSource backed by a BSD routing socket.
+type routingSocketSource struct {
+	f   *os.File
+	buf []byte
+}
+
+// newRouteSource opens a routing socket which receives all route and address
+// changes.
+func newRouteSource() (routeSource, error) {
+	fd, err := unix.Socket(unix.AF_ROUTE, unix.SOCK_RAW, unix.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+
+	// A non-blocking descriptor is registered with the runtime network
+	// poller, which allows Close to interrupt a pending Read.
+	if err := unix.SetNonblock(fd, true); err != nil {
+		_ = unix.Close(fd)
+		return nil, os.NewSyscallError("setnonblock", err)
+	}
+
+	return &routingSocketSource{
+		f:   os.NewFile(uintptr(fd), "route"),
+		buf: make([]byte, os.Getpagesize()),
+	}, nil
+}
+
+// Receive implements routeSource.
+func (s *routingSocketSource) Receive() ([]RouteEvent, error) {
+	n, err := s.f.Read(s.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := route.ParseRIB(route.RIBTypeRoute, s.buf[:n])
+	if err != nil {
+		// Messages of types unknown to package route cannot be parsed, but
+		// are not a reason to stop monitoring.
+		return nil, nil
+	}
+
+	return parseRouteEvents(msgs), nil
+}
+
+// Close implements routeSource.
+func (s *routingSocketSource) Close() error { return s.f.Close() }
+
+// parseRouteEvents extracts RouteEvents from routing socket messages, ignoring
+// any messages which do not affect default routes or addresses.
+func parseRouteEvents(msgs []route.Message) []RouteEvent {
+	var events []RouteEvent
+	for _, m := range msgs {
+		switch m := m.(type) {
+		case *route.RouteMessage:
+			switch m.Type {
+			case unix.RTM_ADD, unix.RTM_DELETE, unix.RTM_CHANGE:
+			default:
+				continue
+			}
+
+			if len(m.Addrs) <= unix.RTAX_DST {
+				continue
+			}
+
+			var ipv6 bool
+			switch a := m.Addrs[unix.RTAX_DST].(type) {
+			case *route.Inet4Addr:
+				if a.IP != [4]byte{} {
+					continue
+				}
+			case *route.Inet6Addr:
+				if a.IP != [16]byte{} {
+					continue
+				}
+				ipv6 = true
+			default:
+				continue
+			}
+
+			events = append(events, RouteEvent{
+				Kind:  DefaultRouteChanged,
+				IPv6:  ipv6,
+				Index: m.Index,
+			})
+		case *route.InterfaceAddrMessage:
+			switch m.Type {
+			case unix.RTM_NEWADDR, unix.RTM_DELADDR:
+			default:
+				continue
+			}
+
+			var ipv6 bool
+			if len(m.Addrs) > unix.RTAX_IFA {
+				_, ipv6 = m.Addrs[unix.RTAX_IFA].(*route.Inet6Addr)
+			}
+
+			events = append(events, RouteEvent{
+				Kind:  AddressChanged,
+				IPv6:  ipv6,
+				Index: m.Index,
+			})
+		}
+	}
+
+	return events
+}
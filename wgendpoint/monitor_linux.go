@@ -0,0 +1,109 @@
+//go:build linux
+// +build linux
+
+package wgendpoint
+
+import (
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+// A netlinkSource is a routeSource backed by rtnetlink multicast groups.
+type netlinkSource struct {
+	c *netlink.Conn
+}
+
+// newRouteSource opens an rtnetlink socket subscribed to route and address
+// changes for both IPv4 and IPv6.
+func newRouteSource() (routeSource, error) {
+	c, err := netlink.Dial(unix.NETLINK_ROUTE, &netlink.Config{
+		Groups: unix.RTMGRP_IPV4_ROUTE | unix.RTMGRP_IPV6_ROUTE |
+			unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &netlinkSource{c: c}, nil
+}
+
+// Receive implements routeSource.
+func (s *netlinkSource) Receive() ([]RouteEvent, error) {
+	msgs, err := s.c.Receive()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRouteEvents(msgs), nil
+}
+
+// Close implements routeSource.
+func (s *netlinkSource) Close() error { return s.c.Close() }
+
+// parseRouteEvents extracts RouteEvents from rtnetlink notifications, ignoring
+// any messages which do not affect default routes or addresses.
+func parseRouteEvents(msgs []netlink.Message) []RouteEvent {
+	var events []RouteEvent
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case unix.RTM_NEWROUTE, unix.RTM_DELROUTE:
+			if len(m.Data) < unix.SizeofRtMsg {
+				continue
+			}
+
+			var (
+				family = m.Data[0]
+				dstLen = m.Data[1]
+				typ    = m.Data[7]
+			)
+
+			// Only unicast routes to the default destination can change the
+			// path to a peer's endpoint; ignore local, broadcast, and cached
+			// routes which the kernel reports frequently.
+			if dstLen != 0 || typ != unix.RTN_UNICAST {
+				continue
+			}
+
+			events = append(events, RouteEvent{
+				Kind:  DefaultRouteChanged,
+				IPv6:  family == unix.AF_INET6,
+				Index: routeIndex(m.Data[unix.SizeofRtMsg:]),
+			})
+		case unix.RTM_NEWADDR, unix.RTM_DELADDR:
+			if len(m.Data) < unix.SizeofIfAddrmsg {
+				continue
+			}
+
+			events = append(events, RouteEvent{
+				Kind:  AddressChanged,
+				IPv6:  m.Data[0] == unix.AF_INET6,
+				Index: int(nlenc.Uint32(m.Data[4:8])),
+			})
+		}
+	}
+
+	return events
+}
+
+// routeIndex returns the output interface index from route attributes, or 0
+// if none is present.
+func routeIndex(b []byte) int {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return 0
+	}
+
+	var index int
+	for ad.Next() {
+		if ad.Type() == unix.RTA_OIF {
+			index = int(ad.Uint32())
+		}
+	}
+
+	if ad.Err() != nil {
+		return 0
+	}
+
+	return index
+}
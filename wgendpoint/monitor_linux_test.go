@@ -0,0 +1,78 @@
+//go:build linux
+// +build linux
+
+package wgendpoint
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+func TestLinuxParseRouteEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		msgs []netlink.Message
+		want []RouteEvent
+	}{
+		{
+			name: "default route",
+			msgs: []netlink.Message{
+				routeMessage(unix.RTM_NEWROUTE, unix.AF_INET, 0, unix.RTN_UNICAST, 2),
+				routeMessage(unix.RTM_DELROUTE, unix.AF_INET6, 0, unix.RTN_UNICAST, 3),
+			},
+			want: []RouteEvent{
+				{Kind: DefaultRouteChanged, Index: 2},
+				{Kind: DefaultRouteChanged, IPv6: true, Index: 3},
+			},
+		},
+		{
+			name: "ignored routes",
+			msgs: []netlink.Message{
+				routeMessage(unix.RTM_NEWROUTE, unix.AF_INET, 24, unix.RTN_UNICAST, 2),
+				routeMessage(unix.RTM_NEWROUTE, unix.AF_INET, 0, unix.RTN_LOCAL, 2),
+				{Header: netlink.Header{Type: unix.RTM_NEWROUTE}},
+				{Header: netlink.Header{Type: unix.RTM_NEWLINK}},
+			},
+		},
+		{
+			name: "address",
+			msgs: []netlink.Message{{
+				Header: netlink.Header{Type: unix.RTM_NEWADDR},
+				Data:   append([]byte{unix.AF_INET6, 64, 0, 0}, nlenc.Uint32Bytes(4)...),
+			}},
+			want: []RouteEvent{{Kind: AddressChanged, IPv6: true, Index: 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, parseRouteEvents(tt.msgs)); diff != "" {
+				t.Fatalf("unexpected events (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// routeMessage builds an rtnetlink route message with an output interface.
+func routeMessage(typ netlink.HeaderType, family, dstLen, rtype uint8, index uint32) netlink.Message {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(unix.RTA_OIF, index)
+	attrs, err := ae.Encode()
+	if err != nil {
+		panicf("failed to encode attributes: %v", err)
+	}
+
+	rtm := make([]byte, unix.SizeofRtMsg)
+	rtm[0] = family
+	rtm[1] = dstLen
+	rtm[7] = rtype
+
+	return netlink.Message{
+		Header: netlink.Header{Type: typ},
+		Data:   append(rtm, attrs...),
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package wgendpoint
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newRouteSource reports that route monitoring is not supported.
+func newRouteSource() (routeSource, error) {
+	return nil, fmt.Errorf("route monitoring is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,216 @@
+package wgendpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRouteMonitorRun(t *testing.T) {
+	src := &testSource{c: make(chan []RouteEvent)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	actC := make(chan []RouteEvent)
+	m := &RouteMonitor{
+		Settle: 50 * time.Millisecond,
+		Actions: []Action{func(_ context.Context, events []RouteEvent) error {
+			actC <- events
+			return errors.New("test error")
+		}},
+		OnError: func(err error) {
+			if err.Error() != "test error" {
+				panicf("unexpected error: %v", err)
+			}
+		},
+		open: func() (routeSource, error) { return src, nil },
+	}
+
+	errC := make(chan error, 1)
+	go func() { errC <- m.Run(ctx) }()
+
+	// A burst of changes must be coalesced into a single invocation.
+	want := []RouteEvent{
+		{Kind: AddressChanged, Index: 2},
+		{Kind: DefaultRouteChanged, Index: 2},
+		{Kind: DefaultRouteChanged, IPv6: true, Index: 3},
+	}
+	src.c <- want[:1]
+	src.c <- want[1:]
+
+	if diff := cmp.Diff(want, <-actC); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+
+	// The next burst is delivered independently of the first.
+	src.c <- want[:1]
+	if diff := cmp.Diff(want[:1], <-actC); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	if err := <-errC; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+	if !src.closed {
+		t.Fatal("route source was not closed")
+	}
+}
+
+func TestRouteMonitorRunReceiveError(t *testing.T) {
+	errTest := errors.New("test error")
+	m := &RouteMonitor{
+		open: func() (routeSource, error) {
+			return &testSource{err: errTest}, nil
+		},
+	}
+
+	if err := m.Run(context.Background()); !errors.Is(err, errTest) {
+		t.Fatalf("expected test error, but got: %v", err)
+	}
+}
+
+func TestReapplyEndpoints(t *testing.T) {
+	var (
+		peerA = wgtest.MustPublicKey()
+		peerB = wgtest.MustPublicKey()
+		addr  = wgtest.MustUDPAddr("192.0.2.1:51820")
+	)
+
+	c := &testClient{
+		d: &wgtypes.Device{
+			Name: "wg0",
+			Peers: []wgtypes.Peer{
+				{PublicKey: peerA, Endpoint: addr},
+				{PublicKey: peerB},
+			},
+		},
+	}
+
+	if err := ReapplyEndpoints(c, "wg0")(context.Background(), nil); err != nil {
+		t.Fatalf("failed to reapply endpoints: %v", err)
+	}
+
+	want := []wgtypes.Config{{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:  peerA,
+			UpdateOnly: true,
+			Endpoint:   addr,
+		}},
+	}}
+
+	if diff := cmp.Diff(want, c.cfgs); diff != "" {
+		t.Fatalf("unexpected configuration (-want +got):\n%s", diff)
+	}
+}
+
+func TestResolveEndpoints(t *testing.T) {
+	peer := wgtest.MustPublicKey()
+
+	tests := []struct {
+		name      string
+		endpoints map[wgtypes.Key]string
+		cfgs      []wgtypes.Config
+		ok        bool
+	}{
+		{
+			name: "none",
+			ok:   true,
+		},
+		{
+			name:      "bad endpoint",
+			endpoints: map[wgtypes.Key]string{peer: "192.0.2.1"},
+		},
+		{
+			name:      "OK",
+			endpoints: map[wgtypes.Key]string{peer: "[2001:db8::1]:51820"},
+			cfgs: []wgtypes.Config{{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:  peer,
+					UpdateOnly: true,
+					Endpoint:   wgtest.MustUDPAddr("[2001:db8::1]:51820"),
+				}},
+			}},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &testClient{}
+
+			err := ResolveEndpoints(c, "wg0", nil, tt.endpoints)(context.Background(), nil)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to resolve endpoints: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.cfgs, c.cfgs, cmp.Comparer(udpAddrEqual)); diff != "" {
+				t.Fatalf("unexpected configuration (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+var _ routeSource = &testSource{}
+
+// A testSource is a routeSource which returns events sent on c, or err.
+type testSource struct {
+	c      chan []RouteEvent
+	err    error
+	closed bool
+}
+
+func (s *testSource) Receive() ([]RouteEvent, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	events, ok := <-s.c
+	if !ok {
+		return nil, net.ErrClosed
+	}
+
+	return events, nil
+}
+
+func (s *testSource) Close() error {
+	s.closed = true
+	if s.c != nil {
+		close(s.c)
+	}
+	return nil
+}
+
+var _ Client = &testClient{}
+
+// A testClient is a Client which returns d and records configurations.
+type testClient struct {
+	d    *wgtypes.Device
+	cfgs []wgtypes.Config
+}
+
+func (c *testClient) Device(_ string) (*wgtypes.Device, error) { return c.d, nil }
+
+func (c *testClient) ConfigureDevice(_ string, cfg wgtypes.Config) error {
+	c.cfgs = append(c.cfgs, cfg)
+	return nil
+}
+
+func udpAddrEqual(x, y *net.UDPAddr) bool {
+	return x.String() == y.String()
+}
+
+func panicf(format string, a ...interface{}) {
+	panic(fmt.Sprintf(format, a...))
+}
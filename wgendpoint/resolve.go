@@ -0,0 +1,68 @@
+package wgendpoint
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// A Resolver resolves host names to IP addresses. *net.Resolver implements
+// Resolver, and callers may supply their own to use DNS over HTTPS or TLS, a
+// split-horizon resolver, or a static table where system DNS is unreliable
+// or monitored.
+type Resolver interface {
+	// LookupIP looks up host and returns its IP addresses. network is one
+	// of "ip", "ip4", or "ip6".
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+var _ Resolver = net.DefaultResolver
+
+// ResolveUDPAddr resolves the "host:port" endpoint hostport to a UDP address
+// using r, choosing the first address of the given network, which is one of
+// "ip", "ip4", or "ip6". If r is nil, net.DefaultResolver is used. IP
+// literals are never passed to r.
+func ResolveUDPAddr(ctx context.Context, r Resolver, network, hostport string) (*net.UDPAddr, error) {
+	host, service, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := lookupPort(service)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if (network == "ip4" && ip.To4() == nil) || (network == "ip6" && ip.To4() != nil) {
+			return nil, fmt.Errorf("address %s is not of network %s", host, network)
+		}
+
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	ips, err := r.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no %s addresses found for %q", network, host)
+	}
+
+	return &net.UDPAddr{IP: ips[0], Port: port}, nil
+}
+
+// lookupPort parses a numeric port, or looks up a named UDP service using the
+// local services database, which never consults DNS.
+func lookupPort(service string) (int, error) {
+	if port, err := strconv.ParseUint(service, 10, 16); err == nil {
+		return int(port), nil
+	}
+
+	return net.LookupPort("udp", service)
+}
@@ -0,0 +1,139 @@
+package wgendpoint
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolveUDPAddr(t *testing.T) {
+	r := testResolver{
+		"vpn.example.com": {
+			net.ParseIP("192.0.2.1"),
+			net.ParseIP("2001:db8::1"),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		network  string
+		hostport string
+		want     *net.UDPAddr
+	}{
+		{
+			name:     "IPv4 literal",
+			network:  "ip",
+			hostport: "192.0.2.2:51820",
+			want:     wgtest.MustUDPAddr("192.0.2.2:51820"),
+		},
+		{
+			name:     "IPv6 literal wrong network",
+			network:  "ip4",
+			hostport: "[2001:db8::2]:51820",
+		},
+		{
+			name:     "host IPv4",
+			network:  "ip4",
+			hostport: "vpn.example.com:51820",
+			want:     wgtest.MustUDPAddr("192.0.2.1:51820"),
+		},
+		{
+			name:     "host IPv6",
+			network:  "ip6",
+			hostport: "vpn.example.com:443",
+			want:     wgtest.MustUDPAddr("[2001:db8::1]:443"),
+		},
+		{
+			name:     "host not found",
+			network:  "ip",
+			hostport: "unknown.example.com:51820",
+		},
+		{
+			name:     "no port",
+			network:  "ip",
+			hostport: "vpn.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := ResolveUDPAddr(context.Background(), r, tt.network, tt.hostport)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("expected an error, but got: %v", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to resolve: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, addr, cmp.Comparer(udpAddrEqual)); diff != "" {
+				t.Fatalf("unexpected address (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLookupFailover(t *testing.T) {
+	peer := wgtest.MustPublicKey()
+	r := testResolver{
+		"dual.example.com": {net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+		"v6.example.com":   {net.ParseIP("2001:db8::2")},
+	}
+
+	f, err := LookupFailover(context.Background(), r, peer, "dual.example.com:51820")
+	if err != nil {
+		t.Fatalf("failed to look up failover: %v", err)
+	}
+
+	want := &Failover{
+		Peer: peer,
+		IPv4: wgtest.MustUDPAddr("192.0.2.1:51820"),
+		IPv6: wgtest.MustUDPAddr("[2001:db8::1]:51820"),
+	}
+
+	opts := []cmp.Option{cmp.Comparer(udpAddrEqual), cmp.AllowUnexported(Failover{})}
+	if diff := cmp.Diff(want, f, opts...); diff != "" {
+		t.Fatalf("unexpected Failover (-want +got):\n%s", diff)
+	}
+
+	f, err = LookupFailover(context.Background(), r, peer, "v6.example.com:51820")
+	if err != nil {
+		t.Fatalf("failed to look up failover: %v", err)
+	}
+	if f.IPv4 != nil || f.IPv6 == nil {
+		t.Fatalf("expected only an IPv6 address, but got: %v, %v", f.IPv4, f.IPv6)
+	}
+
+	if _, err := LookupFailover(context.Background(), r, peer, "unknown.example.com:51820"); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+var _ Resolver = testResolver{}
+
+// A testResolver is a Resolver backed by a static table of hosts.
+type testResolver map[string][]net.IP
+
+func (r testResolver) LookupIP(_ context.Context, network, host string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, ip := range r[host] {
+		switch {
+		case network == "ip4" && ip.To4() == nil:
+		case network == "ip6" && ip.To4() != nil:
+		default:
+			ips = append(ips, ip)
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, errors.New("no such host")
+	}
+
+	return ips, nil
+}
@@ -0,0 +1,211 @@
+package wgendpoint
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// Default values for Watchdog fields.
+const (
+	defaultWatchdogThreshold = 180 * time.Second
+	defaultWatchdogInterval  = 5 * time.Second
+)
+
+// A Watchdog reconfigures peers which have not completed a handshake within a
+// threshold, which is a common workaround for connection tracking or deep
+// packet inspection middleboxes that stop forwarding a peer's traffic.
+//
+// For each stuck peer, a Watchdog cycles through the peer's Alternates, or if
+// none are configured, re-applies the peer's current endpoint, which forces
+// a new handshake initiation from a fresh source address. Cycling starts
+// with the alternate after the peer's current endpoint, if it is one of the
+// alternates.
+//
+// Only peers with a persistent keepalive interval or Alternates are watched,
+// since other peers do not handshake while idle.
+type Watchdog struct {
+	// Threshold is the amount of time since a peer's most recent handshake
+	// after which the peer is reconfigured. A peer is reconfigured at most
+	// once per Threshold. If zero, a default of 180 seconds is used.
+	Threshold time.Duration
+
+	// Interval is the amount of time between checks performed by Run. If
+	// zero, a default of 5 seconds is used.
+	Interval time.Duration
+
+	// Alternates specifies endpoints to cycle through for each peer, such as
+	// the failover order returned by the Alternates function.
+	Alternates map[wgtypes.Key][]*net.UDPAddr
+
+	// OnError, if set, is called with any error returned by Check from Run.
+	// Errors do not stop Run.
+	OnError func(err error)
+
+	// acted is the time each peer was first seen or last reconfigured, and
+	// next is the index of the next alternate to use for each peer.
+	acted map[wgtypes.Key]time.Time
+	next  map[wgtypes.Key]int
+
+	// now may be replaced in tests.
+	now func() time.Time
+}
+
+// Run calls Check for the device specified by name every Interval until ctx is
+// canceled. Run always returns a non-nil error.
+func (w *Watchdog) Run(ctx context.Context, c Client, name string) error {
+	interval := w.Interval
+	if interval == 0 {
+		interval = defaultWatchdogInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			if _, err := w.Check(c, name); err != nil && w.OnError != nil {
+				w.OnError(err)
+			}
+		}
+	}
+}
+
+// Check reconfigures any stuck peers on the device specified by name, and
+// returns the configuration applied to each of them.
+func (w *Watchdog) Check(c Client, name string) ([]wgtypes.PeerConfig, error) {
+	d, err := c.Device(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.acted == nil {
+		w.acted = make(map[wgtypes.Key]time.Time)
+		w.next = make(map[wgtypes.Key]int)
+	}
+
+	var (
+		now       = w.timeNow()
+		threshold = w.threshold()
+		peers     []wgtypes.PeerConfig
+	)
+
+	for _, p := range d.Peers {
+		alts := w.Alternates[p.PublicKey]
+		if p.PersistentKeepaliveInterval == 0 && len(alts) == 0 {
+			continue
+		}
+
+		acted, ok := w.acted[p.PublicKey]
+		if !ok {
+			// Give peers which have never handshaked a full threshold from
+			// the time they are first seen.
+			w.acted[p.PublicKey] = now
+			acted = now
+		}
+
+		last := p.LastHandshakeTime
+		if acted.After(last) {
+			last = acted
+		}
+
+		if now.Sub(last) < threshold {
+			continue
+		}
+
+		endpoint := p.Endpoint
+		if len(alts) > 0 {
+			i, ok := w.next[p.PublicKey]
+			if !ok {
+				i = after(alts, p.Endpoint)
+			}
+
+			i %= len(alts)
+			endpoint = alts[i]
+			w.next[p.PublicKey] = i + 1
+		}
+		if endpoint == nil {
+			continue
+		}
+
+		w.acted[p.PublicKey] = now
+		peers = append(peers, wgtypes.PeerConfig{
+			PublicKey:  p.PublicKey,
+			UpdateOnly: true,
+			Endpoint:   endpoint,
+		})
+	}
+
+	if len(peers) == 0 {
+		return nil, nil
+	}
+
+	if err := c.ConfigureDevice(name, wgtypes.Config{Peers: peers}); err != nil {
+		return nil, err
+	}
+
+	return peers, nil
+}
+
+// Alternates returns the failover order of each peer in cfg which has
+// AlternateEndpoints, for use as Watchdog.Alternates: the peer's Endpoint, if
+// set, followed by its AlternateEndpoints.
+func Alternates(cfg wgtypes.Config) map[wgtypes.Key][]*net.UDPAddr {
+	alts := make(map[wgtypes.Key][]*net.UDPAddr)
+	for _, p := range cfg.Peers {
+		if p.Remove || len(p.AlternateEndpoints) == 0 {
+			continue
+		}
+
+		var eps []*net.UDPAddr
+		if p.Endpoint != nil {
+			eps = append(eps, p.Endpoint)
+		}
+		for _, ep := range p.AlternateEndpoints {
+			// Skip duplicates, such as an alternate equal to Endpoint.
+			if after(eps, ep) == 0 {
+				eps = append(eps, ep)
+			}
+		}
+
+		alts[p.PublicKey] = eps
+	}
+
+	return alts
+}
+
+// after returns the index following ep in eps, or 0 if ep is not in eps.
+func after(eps []*net.UDPAddr, ep *net.UDPAddr) int {
+	if ep == nil {
+		return 0
+	}
+
+	for i, e := range eps {
+		if e.IP.Equal(ep.IP) && e.Port == ep.Port {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+func (w *Watchdog) threshold() time.Duration {
+	if w.Threshold == 0 {
+		return defaultWatchdogThreshold
+	}
+
+	return w.Threshold
+}
+
+func (w *Watchdog) timeNow() time.Time {
+	if w.now == nil {
+		return time.Now()
+	}
+
+	return w.now()
+}
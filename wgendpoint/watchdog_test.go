@@ -0,0 +1,181 @@
+package wgendpoint
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWatchdogCheck(t *testing.T) {
+	var (
+		peerA = wgtest.MustPublicKey()
+		peerB = wgtest.MustPublicKey()
+		peerC = wgtest.MustPublicKey()
+
+		addrA  = wgtest.MustUDPAddr("192.0.2.1:51820")
+		altB1  = wgtest.MustUDPAddr("192.0.2.2:51820")
+		altB2  = wgtest.MustUDPAddr("192.0.2.2:443")
+		start  = time.Unix(1000, 0)
+		now    = start
+		minute = time.Minute
+	)
+
+	c := &testClient{d: &wgtypes.Device{
+		Peers: []wgtypes.Peer{
+			// Reapplies its endpoint.
+			{
+				PublicKey:                   peerA,
+				Endpoint:                    addrA,
+				PersistentKeepaliveInterval: 25 * time.Second,
+			},
+			// Cycles through alternates.
+			{
+				PublicKey: peerB,
+			},
+			// Not watched.
+			{
+				PublicKey: peerC,
+				Endpoint:  addrA,
+			},
+		},
+	}}
+
+	w := &Watchdog{
+		Threshold:  minute,
+		Alternates: map[wgtypes.Key][]*net.UDPAddr{peerB: {altB1, altB2}},
+		now:        func() time.Time { return now },
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		peers   []wgtypes.PeerConfig
+	}{
+		{
+			name: "first seen",
+		},
+		{
+			name:    "within threshold",
+			advance: 30 * time.Second,
+		},
+		{
+			name:    "stuck",
+			advance: 30 * time.Second,
+			peers: []wgtypes.PeerConfig{
+				{PublicKey: peerA, UpdateOnly: true, Endpoint: addrA},
+				{PublicKey: peerB, UpdateOnly: true, Endpoint: altB1},
+			},
+		},
+		{
+			name:    "rate limited",
+			advance: 30 * time.Second,
+		},
+		{
+			name:    "still stuck",
+			advance: 30 * time.Second,
+			peers: []wgtypes.PeerConfig{
+				{PublicKey: peerA, UpdateOnly: true, Endpoint: addrA},
+				{PublicKey: peerB, UpdateOnly: true, Endpoint: altB2},
+			},
+		},
+		{
+			name:    "wraps",
+			advance: minute,
+			peers: []wgtypes.PeerConfig{
+				{PublicKey: peerA, UpdateOnly: true, Endpoint: addrA},
+				{PublicKey: peerB, UpdateOnly: true, Endpoint: altB1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+
+		peers, err := w.Check(c, "wg0")
+		if err != nil {
+			t.Fatalf("%s: failed to check: %v", tt.name, err)
+		}
+
+		if diff := cmp.Diff(tt.peers, peers); diff != "" {
+			t.Fatalf("%s: unexpected peers (-want +got):\n%s", tt.name, diff)
+		}
+	}
+
+	// A recent handshake means the peer is no longer stuck.
+	now = now.Add(minute)
+	c.d.Peers[0].LastHandshakeTime = now
+	c.d.Peers[1].LastHandshakeTime = now
+
+	peers, err := w.Check(c, "wg0")
+	if err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	if len(peers) > 0 {
+		t.Fatalf("expected no peers reconfigured, but got: %v", peers)
+	}
+}
+
+func TestWatchdogAlternates(t *testing.T) {
+	var (
+		peerA = wgtest.MustPublicKey()
+		peerB = wgtest.MustPublicKey()
+
+		primary = wgtest.MustUDPAddr("192.0.2.1:51820")
+		alt1    = wgtest.MustUDPAddr("198.51.100.1:443")
+		alt2    = wgtest.MustUDPAddr("[2001:db8::1]:51820")
+		now     = time.Unix(1000, 0)
+	)
+
+	alts := Alternates(wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:          peerA,
+				Endpoint:           primary,
+				AlternateEndpoints: []*net.UDPAddr{primary, alt1, alt2},
+			},
+			// No alternates.
+			{
+				PublicKey: peerB,
+				Endpoint:  primary,
+			},
+		},
+	})
+
+	want := map[wgtypes.Key][]*net.UDPAddr{peerA: {primary, alt1, alt2}}
+	if diff := cmp.Diff(want, alts, cmp.Comparer(udpAddrEqual)); diff != "" {
+		t.Fatalf("unexpected alternates (-want +got):\n%s", diff)
+	}
+
+	c := &testClient{d: &wgtypes.Device{
+		Peers: []wgtypes.Peer{{PublicKey: peerA, Endpoint: primary}},
+	}}
+
+	w := &Watchdog{
+		Threshold:  time.Minute,
+		Alternates: alts,
+		now:        func() time.Time { return now },
+	}
+
+	// The current endpoint is first in the failover order, so the first
+	// failover moves on to the next endpoint rather than re-applying it.
+	var got []*net.UDPAddr
+	for i := 0; i < 4; i++ {
+		peers, err := w.Check(c, "wg0")
+		if err != nil {
+			t.Fatalf("failed to check: %v", err)
+		}
+		for _, p := range peers {
+			got = append(got, p.Endpoint)
+		}
+
+		now = now.Add(time.Minute)
+	}
+
+	if diff := cmp.Diff([]*net.UDPAddr{alt1, alt2, primary}, got, cmp.Comparer(udpAddrEqual)); diff != "" {
+		t.Fatalf("unexpected endpoints (-want +got):\n%s", diff)
+	}
+}
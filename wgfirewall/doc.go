@@ -0,0 +1,16 @@
+// Package wgfirewall generates the Linux firewall rules commonly paired with
+// WireGuard devices, as nftables scripts or iptables commands.
+//
+// The rules for full-tunnel devices match those created by wg-quick(8), which
+// prevent packets addressed to the tunnel from being accepted on other
+// interfaces and carry the device's firewall mark across connection tracking
+// so that replies bypass the tunnel. Rules to accept incoming handshakes and
+// to masquerade tunnel traffic for gateways may also be generated.
+//
+// MultiHop generates the device configurations, routes, and routing rules for
+// a chain of tunnels each carried inside the previous one, separating each
+// hop's firewall mark and stacking their MTUs so that traffic is not routed
+// back into its own tunnel.
+//
+// This package only generates rules; applying them is left to the caller.
+package wgfirewall
@@ -0,0 +1,297 @@
+package wgfirewall
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/danpashin/wgctrl/wgdiag"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// Default values for MultiHop fields.
+const (
+	defaultMultiHopKind     = "wireguard"
+	defaultMultiHopPathMTU  = 1500
+	defaultMultiHopPriority = 10000
+
+	// minMultiHopMTU is the minimum IPv6 link MTU, below which a nested
+	// device can't carry IPv6 traffic.
+	minMultiHopMTU = 1280
+)
+
+// A Hop is a single tunnel of a MultiHop chain.
+type Hop struct {
+	// Device is the name of the hop's WireGuard network interface.
+	Device string
+
+	// PrivateKey is the private key of the hop's device.
+	PrivateKey wgtypes.Key
+
+	// Peer is the server reached by this hop, which must have an Endpoint.
+	// Its AllowedIPs are replaced by those needed to route the chain.
+	Peer wgtypes.PeerConfig
+}
+
+// A MultiHop describes a chain of WireGuard tunnels, each carried inside the
+// previous one, such as for routing traffic through several servers so that
+// no single server sees both its source and its destination.
+//
+// Multi-hop setups are easy to get wrong: each hop must send its encrypted
+// packets through the previous hop rather than back into itself, and each
+// hop's MTU must leave room for the overhead of every tunnel beneath it.
+// MultiHop generates the device configurations and Linux ip(8) commands which
+// do both:
+//
+//   - Each hop's device is given its own firewall mark, and a routing rule
+//     sends packets carrying that mark through the previous hop, or through
+//     the main routing table for the first hop.
+//   - All other traffic is routed through the last hop, as with a wg-quick(8)
+//     full tunnel, while routes more specific than a default route in the
+//     main table still take precedence.
+//   - Each hop's MTU is the path MTU less the overhead of its own tunnel and
+//     all of the tunnels beneath it.
+type MultiHop struct {
+	// Hops are the tunnels of the chain, outermost first: the first hop's
+	// peer is reached directly, and each following hop's peer is reached
+	// through the previous hop.
+	Hops []Hop
+
+	// Kind is the ip(8) link type used to create each device. If empty,
+	// "wireguard" is used; AmneziaWG devices use "amneziawg".
+	Kind string
+
+	// PathMTU is the MTU of the path to the first hop's peer. If zero, a
+	// default of 1500 is used.
+	PathMTU int
+
+	// FirewallMark is the firewall mark of the first hop. Each following
+	// hop uses the next mark. If zero, DefaultFirewallMark is used.
+	FirewallMark int
+
+	// Table is the routing table through which all other traffic is routed
+	// to the last hop. Each hop other than the first uses the next table to
+	// reach its peer. If zero, the first hop's firewall mark is used, as
+	// with wg-quick(8).
+	Table int
+
+	// Priority is the priority of the first routing rule. The rules use
+	// consecutive priorities. If zero, a default of 10000 is used.
+	Priority int
+}
+
+// A hopPlan is a Hop with the parameters computed for it.
+type hopPlan struct {
+	Hop
+	mark, table, mtu int
+}
+
+// plan validates m and computes the parameters of each hop.
+func (m MultiHop) plan() ([]hopPlan, error) {
+	if len(m.Hops) == 0 {
+		return nil, errors.New("wgfirewall: multi-hop chain has no hops")
+	}
+
+	mtu := m.PathMTU
+	if mtu == 0 {
+		mtu = defaultMultiHopPathMTU
+	}
+	mark := m.FirewallMark
+	if mark == 0 {
+		mark = DefaultFirewallMark
+	}
+
+	ps := make([]hopPlan, 0, len(m.Hops))
+	seen := make(map[string]bool, len(m.Hops))
+	for i, h := range m.Hops {
+		switch {
+		case h.Device == "":
+			return nil, fmt.Errorf("wgfirewall: hop %d has no device name", i)
+		case seen[h.Device]:
+			return nil, fmt.Errorf("wgfirewall: device %q is used by more than one hop", h.Device)
+		case h.Peer.Endpoint == nil:
+			return nil, fmt.Errorf("wgfirewall: peer of hop %d (%s) has no endpoint", i, h.Device)
+		}
+		seen[h.Device] = true
+
+		mtu -= wgdiag.TunnelOverhead(h.Peer.Endpoint.IP.To4() == nil)
+		if mtu < minMultiHopMTU {
+			return nil, fmt.Errorf("wgfirewall: MTU %d of hop %d (%s) is below the IPv6 minimum of %d", mtu, i, h.Device, minMultiHopMTU)
+		}
+
+		ps = append(ps, hopPlan{
+			Hop:   h,
+			mark:  mark + i,
+			table: m.table() + i,
+			mtu:   mtu,
+		})
+	}
+
+	return ps, nil
+}
+
+// table returns the routing table for traffic routed through the last hop.
+func (m MultiHop) table() int {
+	switch {
+	case m.Table != 0:
+		return m.Table
+	case m.FirewallMark != 0:
+		return m.FirewallMark
+	default:
+		return DefaultFirewallMark
+	}
+}
+
+// priority returns the priority of the first routing rule.
+func (m MultiHop) priority() int {
+	if m.Priority != 0 {
+		return m.Priority
+	}
+
+	return defaultMultiHopPriority
+}
+
+// MTUs returns the MTU of each hop's device, in the order of Hops.
+func (m MultiHop) MTUs() ([]int, error) {
+	ps, err := m.plan()
+	if err != nil {
+		return nil, err
+	}
+
+	mtus := make([]int, 0, len(ps))
+	for _, p := range ps {
+		mtus = append(mtus, p.mtu)
+	}
+
+	return mtus, nil
+}
+
+// Configs returns the configuration of each hop's device, in the order of
+// Hops, for use with wgctrl.Client.ConfigureDevice once the devices have been
+// created by the commands returned by IPCommands.
+//
+// Each hop's peer is routed only the endpoint of the next hop's peer, and the
+// last hop's peer is routed all traffic.
+func (m MultiHop) Configs() ([]wgtypes.Config, error) {
+	ps, err := m.plan()
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs := make([]wgtypes.Config, 0, len(ps))
+	for i, p := range ps {
+		var allowed []net.IPNet
+		if i < len(ps)-1 {
+			ip := ps[i+1].Peer.Endpoint.IP
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			allowed = []net.IPNet{{IP: ip, Mask: net.CIDRMask(bits, bits)}}
+		} else {
+			allowed = []net.IPNet{
+				{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 8*net.IPv4len)},
+				{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)},
+			}
+		}
+
+		key, mark := p.PrivateKey, p.mark
+		peer := p.Peer
+		peer.ReplaceAllowedIPs = true
+		peer.AllowedIPs = allowed
+
+		cfgs = append(cfgs, wgtypes.Config{
+			PrivateKey:   &key,
+			FirewallMark: &mark,
+			ReplacePeers: true,
+			Peers:        []wgtypes.PeerConfig{peer},
+		})
+	}
+
+	return cfgs, nil
+}
+
+// IPCommands returns the ip(8) commands which create each hop's device with
+// its MTU, and the routes and routing rules for the chain in both address
+// families.
+func (m MultiHop) IPCommands() ([]Command, error) {
+	ps, err := m.plan()
+	if err != nil {
+		return nil, err
+	}
+
+	var cmds []Command
+	ip := func(args ...string) {
+		cmds = append(cmds, Command{Program: "ip", Args: args})
+	}
+
+	kind := m.Kind
+	if kind == "" {
+		kind = defaultMultiHopKind
+	}
+
+	for _, p := range ps {
+		ip("link", "add", "dev", p.Device, "type", kind)
+		ip("link", "set", "dev", p.Device, "mtu", fmt.Sprint(p.mtu), "up")
+	}
+
+	var (
+		last = ps[len(ps)-1]
+		prio = m.priority()
+	)
+
+	for _, f := range []string{"-4", "-6"} {
+		for i, p := range ps {
+			// The first hop's packets leave through the main table, and each
+			// following hop's packets through the previous hop.
+			table := "main"
+			if i > 0 {
+				table = fmt.Sprint(p.table)
+				ip(f, "route", "add", "default", "dev", ps[i-1].Device, "table", table)
+			}
+
+			ip(f, "rule", "add", "fwmark", fmt.Sprintf("%#x", p.mark), "table", table,
+				"priority", fmt.Sprint(prio+i))
+		}
+
+		ip(f, "route", "add", "default", "dev", last.Device, "table", fmt.Sprint(m.table()))
+		ip(f, "rule", "add", "table", "main", "suppress_prefixlength", "0",
+			"priority", fmt.Sprint(prio+len(ps)))
+		ip(f, "rule", "add", "table", fmt.Sprint(m.table()),
+			"priority", fmt.Sprint(prio+len(ps)+1))
+	}
+
+	return cmds, nil
+}
+
+// IPCommandsDelete returns the ip(8) commands which remove the routing rules
+// and devices created by the commands returned by IPCommands. Removing the
+// devices also removes their routes.
+func (m MultiHop) IPCommandsDelete() ([]Command, error) {
+	ps, err := m.plan()
+	if err != nil {
+		return nil, err
+	}
+
+	var cmds []Command
+	prio := m.priority()
+	for _, f := range []string{"-4", "-6"} {
+		for i := 0; i < len(ps)+2; i++ {
+			cmds = append(cmds, Command{
+				Program: "ip",
+				Args:    []string{f, "rule", "del", "priority", fmt.Sprint(prio + i)},
+			})
+		}
+	}
+
+	// Remove the innermost devices first.
+	for i := len(ps) - 1; i >= 0; i-- {
+		cmds = append(cmds, Command{
+			Program: "ip",
+			Args:    []string{"link", "del", "dev", ps[i].Device},
+		})
+	}
+
+	return cmds, nil
+}
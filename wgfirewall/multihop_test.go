@@ -0,0 +1,187 @@
+package wgfirewall_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgfirewall"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMultiHop(t *testing.T) {
+	var (
+		privA = wgtest.MustPrivateKey()
+		privB = wgtest.MustPrivateKey()
+		pubA  = wgtest.MustPublicKey()
+		pubB  = wgtest.MustPublicKey()
+		epA   = wgtest.MustUDPAddr("192.0.2.1:51820")
+		epB   = wgtest.MustUDPAddr("[2001:db8::1]:51820")
+	)
+
+	m := wgfirewall.MultiHop{
+		Hops: []wgfirewall.Hop{
+			{
+				Device:     "wg0",
+				PrivateKey: privA,
+				Peer:       wgtypes.PeerConfig{PublicKey: pubA, Endpoint: epA},
+			},
+			{
+				Device:     "wg1",
+				PrivateKey: privB,
+				Peer:       wgtypes.PeerConfig{PublicKey: pubB, Endpoint: epB},
+			},
+		},
+	}
+
+	// 1500 less 60 bytes for IPv4 and 80 bytes for IPv6.
+	mtus, err := m.MTUs()
+	if err != nil {
+		t.Fatalf("failed to compute MTUs: %v", err)
+	}
+
+	if diff := cmp.Diff([]int{1440, 1360}, mtus); diff != "" {
+		t.Fatalf("unexpected MTUs (-want +got):\n%s", diff)
+	}
+
+	markA, markB := 0xca6c, 0xca6d
+	want := []wgtypes.Config{
+		{
+			PrivateKey:   &privA,
+			FirewallMark: &markA,
+			ReplacePeers: true,
+			Peers: []wgtypes.PeerConfig{{
+				PublicKey:         pubA,
+				Endpoint:          epA,
+				ReplaceAllowedIPs: true,
+				AllowedIPs:        []net.IPNet{wgtest.MustCIDR("2001:db8::1/128")},
+			}},
+		},
+		{
+			PrivateKey:   &privB,
+			FirewallMark: &markB,
+			ReplacePeers: true,
+			Peers: []wgtypes.PeerConfig{{
+				PublicKey:         pubB,
+				Endpoint:          epB,
+				ReplaceAllowedIPs: true,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("0.0.0.0/0"),
+					wgtest.MustCIDR("::/0"),
+				},
+			}},
+		},
+	}
+
+	cfgs, err := m.Configs()
+	if err != nil {
+		t.Fatalf("failed to generate configs: %v", err)
+	}
+
+	if diff := cmp.Diff(want, cfgs); diff != "" {
+		t.Fatalf("unexpected configs (-want +got):\n%s", diff)
+	}
+
+	cmds, err := m.IPCommands()
+	if err != nil {
+		t.Fatalf("failed to generate commands: %v", err)
+	}
+
+	ip := []string{
+		"ip link add dev wg0 type wireguard",
+		"ip link set dev wg0 mtu 1440 up",
+		"ip link add dev wg1 type wireguard",
+		"ip link set dev wg1 mtu 1360 up",
+		"ip -4 rule add fwmark 0xca6c table main priority 10000",
+		"ip -4 route add default dev wg0 table 51821",
+		"ip -4 rule add fwmark 0xca6d table 51821 priority 10001",
+		"ip -4 route add default dev wg1 table 51820",
+		"ip -4 rule add table main suppress_prefixlength 0 priority 10002",
+		"ip -4 rule add table 51820 priority 10003",
+		"ip -6 rule add fwmark 0xca6c table main priority 10000",
+		"ip -6 route add default dev wg0 table 51821",
+		"ip -6 rule add fwmark 0xca6d table 51821 priority 10001",
+		"ip -6 route add default dev wg1 table 51820",
+		"ip -6 rule add table main suppress_prefixlength 0 priority 10002",
+		"ip -6 rule add table 51820 priority 10003",
+	}
+
+	if diff := cmp.Diff(ip, commands(cmds)); diff != "" {
+		t.Fatalf("unexpected ip commands (-want +got):\n%s", diff)
+	}
+
+	cmds, err = m.IPCommandsDelete()
+	if err != nil {
+		t.Fatalf("failed to generate delete commands: %v", err)
+	}
+
+	ipDel := []string{
+		"ip -4 rule del priority 10000",
+		"ip -4 rule del priority 10001",
+		"ip -4 rule del priority 10002",
+		"ip -4 rule del priority 10003",
+		"ip -6 rule del priority 10000",
+		"ip -6 rule del priority 10001",
+		"ip -6 rule del priority 10002",
+		"ip -6 rule del priority 10003",
+		"ip link del dev wg1",
+		"ip link del dev wg0",
+	}
+
+	if diff := cmp.Diff(ipDel, commands(cmds)); diff != "" {
+		t.Fatalf("unexpected ip delete commands (-want +got):\n%s", diff)
+	}
+}
+
+func TestMultiHopErrors(t *testing.T) {
+	ep := wgtest.MustUDPAddr("192.0.2.1:51820")
+
+	tests := []struct {
+		name string
+		m    wgfirewall.MultiHop
+	}{
+		{
+			name: "no hops",
+		},
+		{
+			name: "no device",
+			m: wgfirewall.MultiHop{
+				Hops: []wgfirewall.Hop{{Peer: wgtypes.PeerConfig{Endpoint: ep}}},
+			},
+		},
+		{
+			name: "duplicate device",
+			m: wgfirewall.MultiHop{
+				Hops: []wgfirewall.Hop{
+					{Device: "wg0", Peer: wgtypes.PeerConfig{Endpoint: ep}},
+					{Device: "wg0", Peer: wgtypes.PeerConfig{Endpoint: ep}},
+				},
+			},
+		},
+		{
+			name: "no endpoint",
+			m: wgfirewall.MultiHop{
+				Hops: []wgfirewall.Hop{{Device: "wg0"}},
+			},
+		},
+		{
+			name: "MTU too small",
+			m: wgfirewall.MultiHop{
+				PathMTU: 1380,
+				Hops: []wgfirewall.Hop{
+					{Device: "wg0", Peer: wgtypes.PeerConfig{Endpoint: ep}},
+					{Device: "wg1", Peer: wgtypes.PeerConfig{Endpoint: ep}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.m.IPCommands(); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package wgfirewall
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// DefaultFirewallMark is the firewall mark used by wg-quick(8) for full-tunnel
+// devices when no other mark is configured.
+const DefaultFirewallMark = 0xca6c
+
+// A Config describes the firewall rules to generate for a device.
+type Config struct {
+	// Device is the name of the WireGuard network interface.
+	Device string
+
+	// Addresses are the addresses assigned to the interface. Rules are only
+	// generated for the address families present.
+	Addresses []net.IPNet
+
+	// FullTunnel generates the rules wg-quick(8) creates when a peer is
+	// routed the default route: packets addressed to the interface are
+	// dropped unless they arrive on it, and packets carrying FirewallMark
+	// have the mark restored on their replies.
+	FullTunnel bool
+
+	// FirewallMark is the device's firewall mark. If zero,
+	// DefaultFirewallMark is used.
+	FirewallMark int
+
+	// ListenPort, if not zero, generates a rule accepting incoming UDP
+	// traffic on the device's listening port.
+	ListenPort int
+
+	// MasqueradeVia lists outbound interfaces through which traffic from the
+	// networks of Addresses is forwarded and masqueraded, as on a VPN
+	// gateway.
+	MasqueradeVia []string
+}
+
+// FromDevice returns a Config for d with the specified interface addresses.
+// FullTunnel is set if any peer of d is routed a default route.
+func FromDevice(d *wgtypes.Device, addrs []net.IPNet) Config {
+	_, full := d.FullTunnelPeer()
+
+	return Config{
+		Device:       d.Name,
+		Addresses:    addrs,
+		FullTunnel:   full,
+		FirewallMark: d.FirewallMark,
+		ListenPort:   d.ListenPort,
+	}
+}
+
+// A family is an address family and its names in nftables and iptables.
+type family struct {
+	nft, ipt, addr string
+	is4            bool
+}
+
+var (
+	ipv4 = family{nft: "ip", ipt: "iptables", addr: "ip", is4: true}
+	ipv6 = family{nft: "ip6", ipt: "ip6tables", addr: "ip6"}
+)
+
+// families returns the address families of c's addresses, with the addresses
+// of each.
+func (c Config) families() ([]family, map[family][]net.IPNet) {
+	var (
+		fs    []family
+		addrs = make(map[family][]net.IPNet)
+	)
+
+	for _, n := range c.Addresses {
+		f := ipv6
+		if ip4 := n.IP.To4(); ip4 != nil {
+			f = ipv4
+			n.IP = ip4
+		}
+
+		if _, ok := addrs[f]; !ok {
+			fs = append(fs, f)
+		}
+		addrs[f] = append(addrs[f], n)
+	}
+
+	return fs, addrs
+}
+
+// network returns the network containing address n, such as 10.0.0.0/24 for
+// 10.0.0.1/24.
+func network(n net.IPNet) string {
+	return (&net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask}).String()
+}
+
+// mark returns the firewall mark to use for c.
+func (c Config) mark() int {
+	if c.FirewallMark != 0 {
+		return c.FirewallMark
+	}
+
+	return DefaultFirewallMark
+}
+
+// Table returns the name of the nftables tables generated for c.
+func (c Config) Table() string {
+	return "wgctrl-" + c.Device
+}
+
+// NFTables returns an nftables script which creates the rules for c in one
+// table per address family, suitable for use with nft -f. Any existing
+// tables of the same name are replaced.
+func (c Config) NFTables() string {
+	var b strings.Builder
+	fs, addrs := c.families()
+	for _, f := range fs {
+		// Create then delete the table so that the script is idempotent.
+		fmt.Fprintf(&b, "table %s %s\ndelete table %s %s\n", f.nft, c.Table(), f.nft, c.Table())
+		fmt.Fprintf(&b, "table %s %s {\n", f.nft, c.Table())
+
+		if c.ListenPort != 0 {
+			fmt.Fprintf(&b, "\tchain input {\n\t\ttype filter hook input priority 0; policy accept;\n")
+			fmt.Fprintf(&b, "\t\tudp dport %d accept\n\t}\n", c.ListenPort)
+		}
+
+		if c.FullTunnel {
+			fmt.Fprintf(&b, "\tchain preraw {\n\t\ttype filter hook prerouting priority -300; policy accept;\n")
+			for _, n := range addrs[f] {
+				fmt.Fprintf(&b, "\t\tiifname != %q %s daddr %s fib saddr type != local drop\n", c.Device, f.addr, n.IP)
+			}
+			fmt.Fprintf(&b, "\t}\n")
+
+			fmt.Fprintf(&b, "\tchain premangle {\n\t\ttype filter hook prerouting priority -150; policy accept;\n")
+			fmt.Fprintf(&b, "\t\tmeta l4proto udp meta mark set ct mark\n\t}\n")
+
+			fmt.Fprintf(&b, "\tchain postmangle {\n\t\ttype filter hook postrouting priority -150; policy accept;\n")
+			fmt.Fprintf(&b, "\t\tmeta l4proto udp meta mark %#x ct mark set meta mark\n\t}\n", c.mark())
+		}
+
+		if len(c.MasqueradeVia) > 0 {
+			fmt.Fprintf(&b, "\tchain forward {\n\t\ttype filter hook forward priority 0; policy accept;\n")
+			fmt.Fprintf(&b, "\t\tiifname %q accept\n\t\toifname %q ct state established,related accept\n\t}\n", c.Device, c.Device)
+
+			fmt.Fprintf(&b, "\tchain postnat {\n\t\ttype nat hook postrouting priority 100; policy accept;\n")
+			for _, via := range c.MasqueradeVia {
+				for _, n := range addrs[f] {
+					fmt.Fprintf(&b, "\t\t%s saddr %s oifname %q masquerade\n", f.addr, network(n), via)
+				}
+			}
+			fmt.Fprintf(&b, "\t}\n")
+		}
+
+		fmt.Fprintf(&b, "}\n")
+	}
+
+	return b.String()
+}
+
+// NFTablesDelete returns an nftables script which removes the tables created
+// by the script returned by NFTables.
+func (c Config) NFTablesDelete() string {
+	var b strings.Builder
+	fs, _ := c.families()
+	for _, f := range fs {
+		fmt.Fprintf(&b, "delete table %s %s\n", f.nft, c.Table())
+	}
+
+	return b.String()
+}
+
+// A Command is a single iptables, ip6tables, or ip invocation.
+type Command struct {
+	// Program is "iptables", "ip6tables", or "ip".
+	Program string
+
+	// Args are the program's arguments.
+	Args []string
+}
+
+// String returns c as a shell command line. Arguments are not quoted, as
+// none of the generated arguments require it.
+func (c Command) String() string {
+	return c.Program + " " + strings.Join(c.Args, " ")
+}
+
+// An iptRule is an iptables rule, without its action.
+type iptRule struct {
+	table, chain string
+	insert       bool
+	spec         []string
+}
+
+// iptRules returns the iptables rules for c in each address family.
+func (c Config) iptRules() ([]family, map[family][]iptRule) {
+	fs, addrs := c.families()
+	rules := make(map[family][]iptRule, len(fs))
+	for _, f := range fs {
+		var rs []iptRule
+		add := func(table, chain string, insert bool, spec ...string) {
+			rs = append(rs, iptRule{table: table, chain: chain, insert: insert, spec: spec})
+		}
+
+		if c.ListenPort != 0 {
+			add("filter", "INPUT", true, "-p", "udp", "--dport", fmt.Sprint(c.ListenPort), "-j", "ACCEPT")
+		}
+
+		if c.FullTunnel {
+			mark := fmt.Sprintf("%#x", c.mark())
+			for _, n := range addrs[f] {
+				add("raw", "PREROUTING", true, "!", "-i", c.Device, "-d", n.IP.String(),
+					"-m", "addrtype", "!", "--src-type", "LOCAL", "-j", "DROP")
+			}
+			add("mangle", "POSTROUTING", true, "-m", "mark", "--mark", mark,
+				"-p", "udp", "-j", "CONNMARK", "--save-mark")
+			add("mangle", "PREROUTING", true, "-p", "udp", "-j", "CONNMARK", "--restore-mark")
+		}
+
+		if len(c.MasqueradeVia) > 0 {
+			add("filter", "FORWARD", false, "-i", c.Device, "-j", "ACCEPT")
+			add("filter", "FORWARD", false, "-o", c.Device,
+				"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT")
+			for _, via := range c.MasqueradeVia {
+				for _, n := range addrs[f] {
+					add("nat", "POSTROUTING", false, "-s", network(n), "-o", via, "-j", "MASQUERADE")
+				}
+			}
+		}
+
+		rules[f] = rs
+	}
+
+	return fs, rules
+}
+
+// IPTables returns the iptables and ip6tables commands which create the rules
+// for c.
+func (c Config) IPTables() []Command {
+	return c.iptCommands(false)
+}
+
+// IPTablesDelete returns the iptables and ip6tables commands which remove the
+// rules created by the commands returned by IPTables.
+func (c Config) IPTablesDelete() []Command {
+	return c.iptCommands(true)
+}
+
+// iptCommands returns the commands which create or delete c's rules.
+func (c Config) iptCommands(del bool) []Command {
+	var cmds []Command
+	fs, rules := c.iptRules()
+	for _, f := range fs {
+		for _, r := range rules[f] {
+			action := "-A"
+			switch {
+			case del:
+				action = "-D"
+			case r.insert:
+				action = "-I"
+			}
+
+			args := append([]string{"-t", r.table, action, r.chain}, r.spec...)
+			cmds = append(cmds, Command{Program: f.ipt, Args: args})
+		}
+	}
+
+	return cmds
+}
@@ -0,0 +1,135 @@
+package wgfirewall_test
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgfirewall"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfigFullTunnel(t *testing.T) {
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{{
+			AllowedIPs: []net.IPNet{wgtest.MustCIDR("0.0.0.0/0")},
+		}},
+	}
+
+	c := wgfirewall.FromDevice(d, []net.IPNet{mustAddr("10.0.0.2/24")})
+	if !c.FullTunnel {
+		t.Fatal("expected a full tunnel configuration")
+	}
+
+	nft := `table ip wgctrl-wg0
+delete table ip wgctrl-wg0
+table ip wgctrl-wg0 {
+	chain input {
+		type filter hook input priority 0; policy accept;
+		udp dport 51820 accept
+	}
+	chain preraw {
+		type filter hook prerouting priority -300; policy accept;
+		iifname != "wg0" ip daddr 10.0.0.2 fib saddr type != local drop
+	}
+	chain premangle {
+		type filter hook prerouting priority -150; policy accept;
+		meta l4proto udp meta mark set ct mark
+	}
+	chain postmangle {
+		type filter hook postrouting priority -150; policy accept;
+		meta l4proto udp meta mark 0xca6c ct mark set meta mark
+	}
+}
+`
+
+	if diff := cmp.Diff(nft, c.NFTables()); diff != "" {
+		t.Fatalf("unexpected nftables script (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff("delete table ip wgctrl-wg0\n", c.NFTablesDelete()); diff != "" {
+		t.Fatalf("unexpected nftables delete script (-want +got):\n%s", diff)
+	}
+
+	ipt := []string{
+		"iptables -t filter -I INPUT -p udp --dport 51820 -j ACCEPT",
+		"iptables -t raw -I PREROUTING ! -i wg0 -d 10.0.0.2 -m addrtype ! --src-type LOCAL -j DROP",
+		"iptables -t mangle -I POSTROUTING -m mark --mark 0xca6c -p udp -j CONNMARK --save-mark",
+		"iptables -t mangle -I PREROUTING -p udp -j CONNMARK --restore-mark",
+	}
+
+	if diff := cmp.Diff(ipt, commands(c.IPTables())); diff != "" {
+		t.Fatalf("unexpected iptables commands (-want +got):\n%s", diff)
+	}
+
+	for _, cmd := range commands(c.IPTablesDelete()) {
+		if !strings.Contains(cmd, " -D ") {
+			t.Fatalf("expected delete command, but got: %s", cmd)
+		}
+	}
+}
+
+func TestConfigMasquerade(t *testing.T) {
+	c := wgfirewall.Config{
+		Device: "wg0",
+		Addresses: []net.IPNet{
+			mustAddr("10.0.0.1/24"),
+			mustAddr("fd00::1/64"),
+		},
+		FirewallMark:  1,
+		MasqueradeVia: []string{"eth0"},
+	}
+
+	ipt := []string{
+		"iptables -t filter -A FORWARD -i wg0 -j ACCEPT",
+		"iptables -t filter -A FORWARD -o wg0 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT",
+		"iptables -t nat -A POSTROUTING -s 10.0.0.0/24 -o eth0 -j MASQUERADE",
+		"ip6tables -t filter -A FORWARD -i wg0 -j ACCEPT",
+		"ip6tables -t filter -A FORWARD -o wg0 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT",
+		"ip6tables -t nat -A POSTROUTING -s fd00::/64 -o eth0 -j MASQUERADE",
+	}
+
+	if diff := cmp.Diff(ipt, commands(c.IPTables())); diff != "" {
+		t.Fatalf("unexpected iptables commands (-want +got):\n%s", diff)
+	}
+
+	nft := c.NFTables()
+	for _, s := range []string{
+		`ip saddr 10.0.0.0/24 oifname "eth0" masquerade`,
+		`ip6 saddr fd00::/64 oifname "eth0" masquerade`,
+	} {
+		if !strings.Contains(nft, s) {
+			t.Fatalf("nftables script does not contain %q:\n%s", s, nft)
+		}
+	}
+}
+
+func commands(cs []wgfirewall.Command) []string {
+	ss := make([]string, 0, len(cs))
+	for _, c := range cs {
+		ss = append(ss, c.String())
+	}
+
+	return ss
+}
+
+// mustAddr parses an interface address in CIDR notation, keeping its host
+// part.
+func mustAddr(s string) net.IPNet {
+	ip, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panicf("failed to parse address: %v", err)
+	}
+
+	n.IP = ip
+	return *n
+}
+
+func panicf(format string, a ...interface{}) {
+	panic(fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,198 @@
+package wgmetrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgstats"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A Client is the subset of *wgctrl.Client used by a Collector.
+type Client interface {
+	Devices() ([]*wgtypes.Device, error)
+}
+
+// An Option configures a Collector created by New.
+type Option func(c *Collector)
+
+// WithEnricher adds the wgstats.Metadata provided by e for each peer as the
+// labels "country", "city", "asn", "organization", and "site" of the
+// wireguard_peer_info metric, which may be joined with other peer metrics on
+// the "device" and "public_key" labels. Unknown values are empty.
+func WithEnricher(e wgstats.Enricher) Option {
+	return func(c *Collector) {
+		c.enricher = e
+	}
+}
+
+var _ prometheus.Collector = &Collector{}
+
+// A Collector is a prometheus.Collector for the devices of a Client. Use New
+// to create a Collector.
+type Collector struct {
+	c        Client
+	enricher wgstats.Enricher
+
+	deviceInfo       *prometheus.Desc
+	deviceListenPort *prometheus.Desc
+	devicePeers      *prometheus.Desc
+
+	peerInfo          *prometheus.Desc
+	peerReceiveBytes  *prometheus.Desc
+	peerTransmitBytes *prometheus.Desc
+	peerHandshakeAge  *prometheus.Desc
+
+	// now may be replaced in tests.
+	now func() time.Time
+}
+
+// New returns a Collector which reports metrics for every device of c, such
+// as a *wgctrl.Client.
+func New(c Client, opts ...Option) *Collector {
+	var (
+		device = []string{"device"}
+		peer   = []string{"device", "public_key"}
+	)
+
+	col := &Collector{
+		c: c,
+
+		deviceInfo: prometheus.NewDesc(
+			"wireguard_device_info",
+			"Metadata about a device, whose value is always 1.",
+			[]string{"device", "type", "public_key"},
+			nil,
+		),
+
+		deviceListenPort: prometheus.NewDesc(
+			"wireguard_device_listen_port",
+			"The UDP port on which a device listens, or 0 if it does not.",
+			device,
+			nil,
+		),
+
+		devicePeers: prometheus.NewDesc(
+			"wireguard_device_peers",
+			"The number of peers configured on a device.",
+			device,
+			nil,
+		),
+
+		peerReceiveBytes: prometheus.NewDesc(
+			"wireguard_peer_receive_bytes_total",
+			"The number of bytes received from a peer.",
+			peer,
+			nil,
+		),
+
+		peerTransmitBytes: prometheus.NewDesc(
+			"wireguard_peer_transmit_bytes_total",
+			"The number of bytes transmitted to a peer.",
+			peer,
+			nil,
+		),
+
+		peerHandshakeAge: prometheus.NewDesc(
+			"wireguard_peer_last_handshake_age_seconds",
+			"The number of seconds since the most recent handshake with a peer. Omitted if no handshake has completed.",
+			peer,
+			nil,
+		),
+
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(col)
+	}
+
+	peerInfo := []string{"device", "public_key", "endpoint"}
+	if col.enricher != nil {
+		peerInfo = append(peerInfo, "country", "city", "asn", "organization", "site")
+	}
+
+	col.peerInfo = prometheus.NewDesc(
+		"wireguard_peer_info",
+		"Metadata about a peer, whose value is always 1.",
+		peerInfo,
+		nil,
+	)
+
+	return col
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ds := []*prometheus.Desc{
+		c.deviceInfo,
+		c.deviceListenPort,
+		c.devicePeers,
+		c.peerInfo,
+		c.peerReceiveBytes,
+		c.peerTransmitBytes,
+		c.peerHandshakeAge,
+	}
+
+	for _, d := range ds {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector. If the devices can't be listed,
+// an invalid metric is reported so that the scrape fails.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	devices, err := c.c.Devices()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.deviceInfo, fmt.Errorf("wgmetrics: failed to list devices: %w", err))
+		return
+	}
+
+	now := c.now()
+	for _, d := range devices {
+		ch <- prometheus.MustNewConstMetric(c.deviceInfo, prometheus.GaugeValue, 1,
+			d.Name, d.Type.String(), d.PublicKey.String())
+		ch <- prometheus.MustNewConstMetric(c.deviceListenPort, prometheus.GaugeValue,
+			float64(d.ListenPort), d.Name)
+		ch <- prometheus.MustNewConstMetric(c.devicePeers, prometheus.GaugeValue,
+			float64(len(d.Peers)), d.Name)
+
+		for _, p := range d.Peers {
+			pub := p.PublicKey.String()
+
+			var endpoint string
+			if p.Endpoint != nil {
+				endpoint = p.Endpoint.String()
+			}
+
+			info := []string{d.Name, pub, endpoint}
+			if c.enricher != nil {
+				info = append(info, metadataLabels(c.enricher.Enrich(d.Name, p))...)
+			}
+
+			ch <- prometheus.MustNewConstMetric(c.peerInfo, prometheus.GaugeValue, 1, info...)
+			ch <- prometheus.MustNewConstMetric(c.peerReceiveBytes, prometheus.CounterValue,
+				float64(p.ReceiveBytes), d.Name, pub)
+			ch <- prometheus.MustNewConstMetric(c.peerTransmitBytes, prometheus.CounterValue,
+				float64(p.TransmitBytes), d.Name, pub)
+
+			if !p.LastHandshakeTime.IsZero() {
+				ch <- prometheus.MustNewConstMetric(c.peerHandshakeAge, prometheus.GaugeValue,
+					now.Sub(p.LastHandshakeTime).Seconds(), d.Name, pub)
+			}
+		}
+	}
+}
+
+// metadataLabels returns the label values of the wireguard_peer_info metric
+// for m, as added by WithEnricher.
+func metadataLabels(m wgstats.Metadata) []string {
+	var asn string
+	if m.ASN != 0 {
+		asn = strconv.FormatUint(uint64(m.ASN), 10)
+	}
+
+	return []string{m.Country, m.City, asn, m.Organization, m.Site}
+}
@@ -0,0 +1,143 @@
+package wgmetrics
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgstats"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// A testClient is a Client which returns fixed devices.
+type testClient struct {
+	devices []*wgtypes.Device
+	err     error
+}
+
+func (c *testClient) Devices() ([]*wgtypes.Device, error) { return c.devices, c.err }
+
+func TestCollector(t *testing.T) {
+	var (
+		now  = time.Unix(1000, 0)
+		priv = wgtest.MustHexKey("e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a")
+		pubA = wgtest.MustHexKey("b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33")
+		pubB = wgtest.MustHexKey("188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52")
+	)
+
+	c := New(&testClient{
+		devices: []*wgtypes.Device{{
+			Name:       "wg0",
+			Type:       wgtypes.LinuxKernel,
+			PublicKey:  priv,
+			ListenPort: 51820,
+			Peers: []wgtypes.Peer{
+				{
+					PublicKey:         pubA,
+					Endpoint:          wgtest.MustUDPAddr("192.0.2.1:51820"),
+					LastHandshakeTime: now.Add(-30 * time.Second),
+					ReceiveBytes:      1024,
+					TransmitBytes:     2048,
+				},
+				{
+					// Never handshaked, so no age is reported.
+					PublicKey: pubB,
+				},
+			},
+		}},
+	})
+	c.now = func() time.Time { return now }
+
+	const want = `
+# HELP wireguard_device_info Metadata about a device, whose value is always 1.
+# TYPE wireguard_device_info gauge
+wireguard_device_info{device="wg0",public_key="6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA/rpSAno=",type="Linux kernel"} 1
+# HELP wireguard_device_listen_port The UDP port on which a device listens, or 0 if it does not.
+# TYPE wireguard_device_listen_port gauge
+wireguard_device_listen_port{device="wg0"} 51820
+# HELP wireguard_device_peers The number of peers configured on a device.
+# TYPE wireguard_device_peers gauge
+wireguard_device_peers{device="wg0"} 2
+# HELP wireguard_peer_info Metadata about a peer, whose value is always 1.
+# TYPE wireguard_peer_info gauge
+wireguard_peer_info{device="wg0",endpoint="",public_key="GIUVCT6VL18i6GXO8wEucvi18LWYrAMJ1drM47cPz1I="} 1
+wireguard_peer_info{device="wg0",endpoint="192.0.2.1:51820",public_key="uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM="} 1
+# HELP wireguard_peer_last_handshake_age_seconds The number of seconds since the most recent handshake with a peer. Omitted if no handshake has completed.
+# TYPE wireguard_peer_last_handshake_age_seconds gauge
+wireguard_peer_last_handshake_age_seconds{device="wg0",public_key="uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM="} 30
+# HELP wireguard_peer_receive_bytes_total The number of bytes received from a peer.
+# TYPE wireguard_peer_receive_bytes_total counter
+wireguard_peer_receive_bytes_total{device="wg0",public_key="GIUVCT6VL18i6GXO8wEucvi18LWYrAMJ1drM47cPz1I="} 0
+wireguard_peer_receive_bytes_total{device="wg0",public_key="uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM="} 1024
+# HELP wireguard_peer_transmit_bytes_total The number of bytes transmitted to a peer.
+# TYPE wireguard_peer_transmit_bytes_total counter
+wireguard_peer_transmit_bytes_total{device="wg0",public_key="GIUVCT6VL18i6GXO8wEucvi18LWYrAMJ1drM47cPz1I="} 0
+wireguard_peer_transmit_bytes_total{device="wg0",public_key="uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM="} 2048
+`
+
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+}
+
+func TestCollectorEnricher(t *testing.T) {
+	var (
+		pubA = wgtest.MustHexKey("b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33")
+		pubB = wgtest.MustHexKey("188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52")
+	)
+
+	e := wgstats.EnrichEndpoint(func(addr netip.Addr) wgstats.Metadata {
+		if addr != netip.MustParseAddr("192.0.2.1") {
+			return wgstats.Metadata{}
+		}
+
+		return wgstats.Metadata{
+			Country:      "DE",
+			City:         "Berlin",
+			ASN:          64496,
+			Organization: "Example",
+			Site:         "fra1",
+		}
+	})
+
+	c := New(&testClient{
+		devices: []*wgtypes.Device{{
+			Name: "wg0",
+			Peers: []wgtypes.Peer{
+				{
+					PublicKey: pubA,
+					Endpoint:  wgtest.MustUDPAddr("192.0.2.1:51820"),
+				},
+				{
+					// No endpoint, so no metadata.
+					PublicKey: pubB,
+				},
+			},
+		}},
+	}, WithEnricher(e))
+
+	const want = `
+# HELP wireguard_peer_info Metadata about a peer, whose value is always 1.
+# TYPE wireguard_peer_info gauge
+wireguard_peer_info{asn="",city="",country="",device="wg0",endpoint="",organization="",public_key="GIUVCT6VL18i6GXO8wEucvi18LWYrAMJ1drM47cPz1I=",site=""} 1
+wireguard_peer_info{asn="64496",city="Berlin",country="DE",device="wg0",endpoint="192.0.2.1:51820",organization="Example",public_key="uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM=",site="fra1"} 1
+`
+
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "wireguard_peer_info"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+}
+
+func TestCollectorError(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(New(&testClient{err: errors.New("permission denied")}))
+
+	if _, err := reg.Gather(); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
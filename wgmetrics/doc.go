@@ -0,0 +1,21 @@
+// Package wgmetrics exports the state of WireGuard devices as Prometheus
+// metrics.
+//
+// A Collector implements prometheus.Collector, reporting per-device and
+// per-peer metrics each time it is scraped, by listing the devices of a
+// wgctrl.Client:
+//
+//	c, err := wgctrl.New(wgtypes.NativeClient)
+//	if err != nil {
+//		// ...
+//	}
+//	prometheus.MustRegister(wgmetrics.New(c))
+//
+// The Collector keeps no state between scrapes, so counters are reported as
+// WireGuard reports them and reset when a device or peer is recreated.
+// Prometheus rate functions handle such resets.
+//
+// WithEnricher adds metadata such as the country and autonomous system of each
+// peer's endpoint, provided by a wgstats.Enricher, to the wireguard_peer_info
+// metric.
+package wgmetrics
@@ -0,0 +1,13 @@
+// Package wgpq implements a hybrid post-quantum preshared key negotiation for
+// WireGuard peers.
+//
+// WireGuard's Noise handshake is not resistant to attacks by a quantum
+// computer, but the protocol allows mixing an optional symmetric preshared key
+// into every handshake. This package derives such a preshared key from the
+// output of a post-quantum key encapsulation mechanism (KEM) combined with the
+// static X25519 keys already configured for a peer, so that the resulting
+// tunnel remains secure as long as either primitive holds.
+//
+// The KEM itself is pluggable through the KEM interface; this package does not
+// bundle an implementation of any particular algorithm.
+package wgpq
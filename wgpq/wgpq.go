@@ -0,0 +1,275 @@
+package wgpq
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Context strings used to separate the keys derived during a negotiation.
+const (
+	labelAuth = "wgpq v1 authentication"
+	labelPSK  = "wgpq v1 preshared key"
+)
+
+// maxMessageLen is the largest message accepted from a remote peer. It is
+// large enough for the public keys and ciphertexts of all standardized KEMs.
+const maxMessageLen = 64 * 1024
+
+// ErrAuthentication is returned when a negotiation message fails
+// authentication, indicating that the remote peer does not possess the
+// expected WireGuard private key or that the message was tampered with.
+var ErrAuthentication = errors.New("wgpq: message authentication failed")
+
+// A KEM is a key encapsulation mechanism, such as ML-KEM (Kyber).
+type KEM interface {
+	// GenerateKey generates a new encapsulation (public) and decapsulation
+	// (private) key pair.
+	GenerateKey() (public, private []byte, err error)
+
+	// Encapsulate generates a shared secret for public and returns the
+	// ciphertext which conveys it to the owner of the private key.
+	Encapsulate(public []byte) (ciphertext, secret []byte, err error)
+
+	// Decapsulate recovers the shared secret from ciphertext using private.
+	Decapsulate(private, ciphertext []byte) (secret []byte, err error)
+}
+
+// A Config specifies the parameters for one side of a negotiation.
+type Config struct {
+	// KEM is the key encapsulation mechanism used by both peers. KEM must be
+	// set.
+	KEM KEM
+
+	// PrivateKey is the local device's WireGuard private key.
+	PrivateKey wgtypes.Key
+
+	// PeerPublicKey is the remote peer's WireGuard public key.
+	PeerPublicKey wgtypes.Key
+}
+
+// Initiate performs the initiator side of a negotiation over rw, which is
+// typically an existing tunnel or another side channel to the peer. On
+// success, the returned Key is suitable for use as the peer's PresharedKey.
+func Initiate(rw io.ReadWriter, cfg Config) (wgtypes.Key, error) {
+	s, err := newSession(cfg, true)
+	if err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	pub, priv, err := cfg.KEM.GenerateKey()
+	if err != nil {
+		return wgtypes.Key{}, fmt.Errorf("wgpq: failed to generate KEM key pair: %v", err)
+	}
+
+	if err := s.send(rw, pub); err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	ct, err := s.receive(rw)
+	if err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	secret, err := cfg.KEM.Decapsulate(priv, ct)
+	if err != nil {
+		return wgtypes.Key{}, fmt.Errorf("wgpq: failed to decapsulate shared secret: %v", err)
+	}
+
+	return s.presharedKey(secret)
+}
+
+// Respond performs the responder side of a negotiation over rw. On success,
+// the returned Key is identical to the Key returned by Initiate on the peer.
+func Respond(rw io.ReadWriter, cfg Config) (wgtypes.Key, error) {
+	s, err := newSession(cfg, false)
+	if err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	pub, err := s.receive(rw)
+	if err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	ct, secret, err := cfg.KEM.Encapsulate(pub)
+	if err != nil {
+		return wgtypes.Key{}, fmt.Errorf("wgpq: failed to encapsulate shared secret: %v", err)
+	}
+
+	if err := s.send(rw, ct); err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	return s.presharedKey(secret)
+}
+
+// A Configurer is a type which can configure a WireGuard device, such as
+// *wgctrl.Client.
+type Configurer interface {
+	ConfigureDevice(name string, cfg wgtypes.Config) error
+}
+
+// Install configures psk as the preshared key for the existing peer
+// identified by peer on the device specified by name.
+func Install(c Configurer, name string, peer, psk wgtypes.Key) error {
+	return c.ConfigureDevice(name, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:    peer,
+			UpdateOnly:   true,
+			PresharedKey: &psk,
+		}},
+	})
+}
+
+// A session tracks the state of a single negotiation.
+type session struct {
+	// dh is the static-static X25519 shared secret of both peers, and auth
+	// is the message authentication key derived from it.
+	dh, auth []byte
+
+	// transcript accumulates every message exchanged, prefixed with the
+	// initiator and responder public keys.
+	transcript bytes.Buffer
+
+	// sent counts the messages sent and received so that each message is
+	// bound to its position in the exchange.
+	sent, received byte
+	initiator      bool
+}
+
+// newSession validates cfg and prepares the keys for a negotiation.
+func newSession(cfg Config, initiator bool) (*session, error) {
+	if cfg.KEM == nil {
+		return nil, errors.New("wgpq: no KEM specified")
+	}
+
+	dh, err := curve25519.X25519(cfg.PrivateKey[:], cfg.PeerPublicKey[:])
+	if err != nil {
+		return nil, fmt.Errorf("wgpq: failed to compute static shared secret: %v", err)
+	}
+
+	auth, err := derive(dh, nil, labelAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{
+		dh:        dh,
+		auth:      auth,
+		initiator: initiator,
+	}
+
+	// Both sides must agree on the order of the identities in the transcript.
+	local := cfg.PrivateKey.PublicKey()
+	if initiator {
+		s.transcript.Write(local[:])
+		s.transcript.Write(cfg.PeerPublicKey[:])
+	} else {
+		s.transcript.Write(cfg.PeerPublicKey[:])
+		s.transcript.Write(local[:])
+	}
+
+	return s, nil
+}
+
+// send writes an authenticated message containing b to w.
+func (s *session) send(w io.Writer, b []byte) error {
+	if len(b)+sha256.Size > maxMessageLen {
+		return fmt.Errorf("wgpq: message too large: %d bytes", len(b))
+	}
+
+	s.transcript.Write(b)
+	mac := s.mac(s.initiator, s.sent)
+	s.sent++
+
+	msg := make([]byte, 4, 4+len(b)+len(mac))
+	binary.BigEndian.PutUint32(msg, uint32(len(b)+len(mac)))
+	msg = append(msg, b...)
+	msg = append(msg, mac...)
+
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("wgpq: failed to send message: %v", err)
+	}
+
+	return nil
+}
+
+// receive reads and authenticates a single message from r.
+func (s *session) receive(r io.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("wgpq: failed to receive message: %v", err)
+	}
+
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n < sha256.Size || n > maxMessageLen {
+		return nil, fmt.Errorf("wgpq: invalid message length: %d", n)
+	}
+
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("wgpq: failed to receive message: %v", err)
+	}
+
+	b, mac := msg[:n-sha256.Size], msg[n-sha256.Size:]
+
+	s.transcript.Write(b)
+	want := s.mac(!s.initiator, s.received)
+	s.received++
+
+	if !hmac.Equal(mac, want) {
+		return nil, ErrAuthentication
+	}
+
+	return b, nil
+}
+
+// mac computes the authentication tag of the transcript for the n-th message
+// sent by the initiator or the responder.
+func (s *session) mac(initiator bool, n byte) []byte {
+	role := byte('r')
+	if initiator {
+		role = 'i'
+	}
+
+	h := hmac.New(sha256.New, s.auth)
+	h.Write([]byte{role, n})
+	h.Write(s.transcript.Bytes())
+	return h.Sum(nil)
+}
+
+// presharedKey combines the KEM shared secret with the static shared secret
+// to produce the final preshared key.
+func (s *session) presharedKey(secret []byte) (wgtypes.Key, error) {
+	ikm := make([]byte, 0, len(secret)+len(s.dh))
+	ikm = append(ikm, secret...)
+	ikm = append(ikm, s.dh...)
+
+	salt := sha256.Sum256(s.transcript.Bytes())
+
+	b, err := derive(ikm, salt[:], labelPSK)
+	if err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	return wgtypes.NewKey(b)
+}
+
+// derive uses HKDF-SHA256 to derive a key from secret.
+func derive(secret, salt []byte, info string) ([]byte, error) {
+	b := make([]byte, wgtypes.KeyLen)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), b); err != nil {
+		return nil, fmt.Errorf("wgpq: failed to derive key: %v", err)
+	}
+
+	return b, nil
+}
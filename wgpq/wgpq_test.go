@@ -0,0 +1,154 @@
+package wgpq_test
+
+import (
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgpq"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/curve25519"
+)
+
+func TestNegotiateOK(t *testing.T) {
+	var (
+		privA = wgtest.MustPrivateKey()
+		privB = wgtest.MustPrivateKey()
+	)
+
+	keyA, keyB, errA, errB := negotiate(t,
+		wgpq.Config{KEM: dhKEM{}, PrivateKey: privA, PeerPublicKey: privB.PublicKey()},
+		wgpq.Config{KEM: dhKEM{}, PrivateKey: privB, PeerPublicKey: privA.PublicKey()},
+	)
+	if errA != nil || errB != nil {
+		t.Fatalf("failed to negotiate: %v, %v", errA, errB)
+	}
+
+	if diff := cmp.Diff(keyA, keyB); diff != "" {
+		t.Fatalf("unexpected preshared key (-want +got):\n%s", diff)
+	}
+	if keyA == (wgtypes.Key{}) {
+		t.Fatal("negotiated an all-zero preshared key")
+	}
+}
+
+func TestNegotiateWrongPeer(t *testing.T) {
+	var (
+		privA = wgtest.MustPrivateKey()
+		privB = wgtest.MustPrivateKey()
+	)
+
+	// The responder expects a different initiator, so the first message must
+	// fail authentication.
+	_, _, _, errB := negotiate(t,
+		wgpq.Config{KEM: dhKEM{}, PrivateKey: privA, PeerPublicKey: privB.PublicKey()},
+		wgpq.Config{KEM: dhKEM{}, PrivateKey: privB, PeerPublicKey: wgtest.MustPublicKey()},
+	)
+	if !errors.Is(errB, wgpq.ErrAuthentication) {
+		t.Fatalf("expected authentication error, but got: %v", errB)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	var (
+		peer = wgtest.MustPublicKey()
+		psk  = wgtest.MustPresharedKey()
+	)
+
+	var got wgtypes.Config
+	c := configureFunc(func(name string, cfg wgtypes.Config) error {
+		if name != "wg0" {
+			t.Fatalf("unexpected device name: %q", name)
+		}
+
+		got = cfg
+		return nil
+	})
+
+	if err := wgpq.Install(c, "wg0", peer, psk); err != nil {
+		t.Fatalf("failed to install preshared key: %v", err)
+	}
+
+	want := wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:    peer,
+			UpdateOnly:   true,
+			PresharedKey: &psk,
+		}},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected configuration (-want +got):\n%s", diff)
+	}
+}
+
+// negotiate runs an initiator with cfgA and a responder with cfgB against
+// each other and returns their results.
+func negotiate(t *testing.T, cfgA, cfgB wgpq.Config) (wgtypes.Key, wgtypes.Key, error, error) {
+	t.Helper()
+
+	a, b := net.Pipe()
+
+	type result struct {
+		key wgtypes.Key
+		err error
+	}
+
+	resC := make(chan result, 1)
+	go func() {
+		defer b.Close()
+
+		key, err := wgpq.Respond(b, cfgB)
+		resC <- result{key: key, err: err}
+	}()
+
+	keyA, errA := wgpq.Initiate(a, cfgA)
+	_ = a.Close()
+
+	res := <-resC
+	return keyA, res.key, errA, res.err
+}
+
+// dhKEM is an X25519-based KEM used as a stand-in for a post-quantum KEM.
+type dhKEM struct{}
+
+func (dhKEM) GenerateKey() ([]byte, []byte, error) {
+	priv := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(priv); err != nil {
+		return nil, nil, err
+	}
+
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pub, priv, nil
+}
+
+func (k dhKEM) Encapsulate(public []byte) ([]byte, []byte, error) {
+	ct, priv, err := k.GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := curve25519.X25519(priv, public)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ct, secret, nil
+}
+
+func (dhKEM) Decapsulate(private, ciphertext []byte) ([]byte, error) {
+	return curve25519.X25519(private, ciphertext)
+}
+
+type configureFunc func(name string, cfg wgtypes.Config) error
+
+func (fn configureFunc) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	return fn(name, cfg)
+}
@@ -0,0 +1,371 @@
+package wgstats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgstore"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// Counters are the raw transfer counters reported for a peer on a device.
+type Counters struct {
+	ReceiveBytes  int64 `json:"rx"`
+	TransmitBytes int64 `json:"tx"`
+}
+
+// A Usage is the cumulative traffic of a peer, which continues across device
+// restarts and counter resets.
+type Usage struct {
+	// ReceiveBytes and TransmitBytes are the total bytes received from and
+	// transmitted to the peer since accounting began or the usage was last
+	// reset, summed over all devices the peer was observed on.
+	ReceiveBytes  int64 `json:"receive_bytes"`
+	TransmitBytes int64 `json:"transmit_bytes"`
+
+	// Updated is the time of the most recent observation of the peer.
+	Updated time.Time `json:"updated"`
+
+	// Last holds the raw counters most recently observed on each device,
+	// keyed by device name, which are used to compute the next increment.
+	Last map[string]Counters `json:"last,omitempty"`
+}
+
+// A Store persists the Usage of peers, keyed by public key.
+type Store interface {
+	// Load returns all stored usage. If nothing has been stored, Load
+	// returns an empty map and no error.
+	Load() (map[wgtypes.Key]Usage, error)
+
+	// Save replaces all stored usage with u.
+	Save(u map[wgtypes.Key]Usage) error
+}
+
+// An Accountant keeps the cumulative Usage of peers from periodic
+// observations of their devices, persisting it to a Store so that totals
+// survive restarts of both the devices and the program itself.
+//
+// WireGuard counters start at zero when a device or peer is created. A
+// counter lower than the previous observation is treated as a reset, and its
+// entire value is counted. Traffic exchanged between a reset and the next
+// observation which exceeds the previously observed value can't be
+// distinguished from a continuing counter, so devices should be observed more
+// often than they are restarted.
+//
+// The zero value is not usable; Store must be set. An Accountant is not safe
+// for concurrent use.
+type Accountant struct {
+	// Store persists usage between observations. It is loaded on the first
+	// call to any method, and saved after each change.
+	Store Store
+
+	usage map[wgtypes.Key]Usage
+
+	// now may be replaced in tests.
+	now func() time.Time
+}
+
+// Observe adds the traffic of every peer on d since its previous observation
+// to the peer's Usage, and saves the result to the Store.
+func (a *Accountant) Observe(d *wgtypes.Device) error {
+	if err := a.load(); err != nil {
+		return err
+	}
+
+	now := a.timeNow()
+	for _, p := range d.Peers {
+		u := a.usage[p.PublicKey]
+		if u.Last == nil {
+			u.Last = make(map[string]Counters)
+		}
+
+		// A peer which is new to this device has counted from zero.
+		last := u.Last[d.Name]
+		u.ReceiveBytes += increment(last.ReceiveBytes, p.ReceiveBytes)
+		u.TransmitBytes += increment(last.TransmitBytes, p.TransmitBytes)
+
+		u.Last[d.Name] = Counters{
+			ReceiveBytes:  p.ReceiveBytes,
+			TransmitBytes: p.TransmitBytes,
+		}
+		u.Updated = now
+
+		a.usage[p.PublicKey] = u
+	}
+
+	return a.save()
+}
+
+// Usage returns the cumulative Usage of the peer with the specified public
+// key. It reports false if the peer has never been observed.
+func (a *Accountant) Usage(peer wgtypes.Key) (Usage, bool, error) {
+	if err := a.load(); err != nil {
+		return Usage{}, false, err
+	}
+
+	u, ok := a.usage[peer]
+	return u, ok, nil
+}
+
+// Reset sets the cumulative Usage of the peer with the specified public key
+// to zero, for example at the start of a new billing period. Traffic is
+// counted from the peer's most recently observed counters onwards.
+func (a *Accountant) Reset(peer wgtypes.Key) error {
+	if err := a.load(); err != nil {
+		return err
+	}
+
+	u, ok := a.usage[peer]
+	if !ok {
+		return nil
+	}
+
+	u.ReceiveBytes, u.TransmitBytes = 0, 0
+	a.usage[peer] = u
+
+	return a.save()
+}
+
+// increment returns the traffic represented by a counter moving from prev to
+// cur.
+func increment(prev, cur int64) int64 {
+	if cur < prev {
+		// The counter was reset.
+		return cur
+	}
+
+	return cur - prev
+}
+
+// load loads usage from the Store if it has not yet been loaded.
+func (a *Accountant) load() error {
+	if a.usage != nil {
+		return nil
+	}
+
+	u, err := a.Store.Load()
+	if err != nil {
+		return fmt.Errorf("wgstats: failed to load usage: %w", err)
+	}
+	if u == nil {
+		u = make(map[wgtypes.Key]Usage)
+	}
+
+	a.usage = u
+	return nil
+}
+
+// save saves usage to the Store.
+func (a *Accountant) save() error {
+	if err := a.Store.Save(a.usage); err != nil {
+		return fmt.Errorf("wgstats: failed to save usage: %w", err)
+	}
+
+	return nil
+}
+
+func (a *Accountant) timeNow() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+
+	return time.Now()
+}
+
+// A MemoryStore is a Store which keeps usage in memory, which is useful for
+// tests and for programs which only need continuity across device restarts.
+// The zero value is ready to use. A MemoryStore is safe for concurrent use.
+type MemoryStore struct {
+	mu sync.Mutex
+	u  map[wgtypes.Key]Usage
+}
+
+var _ Store = &MemoryStore{}
+
+// Load implements Store.
+func (s *MemoryStore) Load() (map[wgtypes.Key]Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return copyUsage(s.u), nil
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(u map[wgtypes.Key]Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.u = copyUsage(u)
+	return nil
+}
+
+// A FileStore is a Store which keeps usage in a JSON file. The file is
+// replaced atomically on each save, so it is never left partially written.
+type FileStore struct {
+	// Path is the path of the file. It need not exist before the first
+	// save.
+	Path string
+}
+
+var _ Store = &FileStore{}
+
+// Load implements Store.
+func (s *FileStore) Load() (map[wgtypes.Key]Usage, error) {
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return make(map[wgtypes.Key]Usage), nil
+		}
+
+		return nil, err
+	}
+
+	var raw map[string]Usage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	u := make(map[wgtypes.Key]Usage, len(raw))
+	for k, v := range raw {
+		key, err := wgtypes.ParseKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		u[key] = v
+	}
+
+	return u, nil
+}
+
+// Save implements Store.
+func (s *FileStore) Save(u map[wgtypes.Key]Usage) error {
+	raw := make(map[string]Usage, len(u))
+	for k, v := range u {
+		raw[k.String()] = v
+	}
+
+	b, err := json.MarshalIndent(raw, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.Path)
+}
+
+// DefaultNamespace is the wgstore namespace used by a KVStore with no
+// Namespace set.
+const DefaultNamespace = "wgstats.usage"
+
+// A KVStore is a Store which keeps usage in a wgstore.Store, so that it can
+// share a database with other subsystems. Each peer's usage is stored as
+// JSON under its public key.
+type KVStore struct {
+	// Store is the underlying key/value store.
+	Store wgstore.Store
+
+	// Namespace is the namespace of the stored usage. If empty,
+	// DefaultNamespace is used.
+	Namespace string
+}
+
+var _ Store = &KVStore{}
+
+// Load implements Store.
+func (s *KVStore) Load() (map[wgtypes.Key]Usage, error) {
+	kvs, err := s.Store.List(s.namespace())
+	if err != nil {
+		return nil, err
+	}
+
+	u := make(map[wgtypes.Key]Usage, len(kvs))
+	for k, v := range kvs {
+		key, err := wgtypes.ParseKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		var usage Usage
+		if err := json.Unmarshal(v, &usage); err != nil {
+			return nil, err
+		}
+
+		u[key] = usage
+	}
+
+	return u, nil
+}
+
+// Save implements Store.
+func (s *KVStore) Save(u map[wgtypes.Key]Usage) error {
+	ns := s.namespace()
+
+	stale, err := s.Store.List(ns)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range u {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		if err := s.Store.Put(ns, k.String(), b); err != nil {
+			return err
+		}
+
+		delete(stale, k.String())
+	}
+
+	for k := range stale {
+		if err := s.Store.Delete(ns, k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *KVStore) namespace() string {
+	if s.Namespace != "" {
+		return s.Namespace
+	}
+
+	return DefaultNamespace
+}
+
+// copyUsage returns a deep copy of u.
+func copyUsage(u map[wgtypes.Key]Usage) map[wgtypes.Key]Usage {
+	out := make(map[wgtypes.Key]Usage, len(u))
+	for k, v := range u {
+		last := make(map[string]Counters, len(v.Last))
+		for d, c := range v.Last {
+			last[d] = c
+		}
+		v.Last = last
+
+		out[k] = v
+	}
+
+	return out
+}
@@ -0,0 +1,135 @@
+package wgstats
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgstore"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAccountantObserve(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func(t *testing.T) Store
+	}{
+		{
+			name:  "memory",
+			store: func(_ *testing.T) Store { return &MemoryStore{} },
+		},
+		{
+			name: "file",
+			store: func(t *testing.T) Store {
+				return &FileStore{Path: filepath.Join(t.TempDir(), "usage.json")}
+			},
+		},
+		{
+			name: "wgstore",
+			store: func(t *testing.T) Store {
+				return &KVStore{Store: &wgstore.FileStore{
+					Path: filepath.Join(t.TempDir(), "state.json"),
+				}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				peer  = wgtest.MustPublicKey()
+				store = tt.store(t)
+				now   = time.Unix(100000, 0).UTC()
+			)
+
+			newAccountant := func() *Accountant {
+				return &Accountant{
+					Store: store,
+					now:   func() time.Time { return now },
+				}
+			}
+
+			observe := func(a *Accountant, device string, rx, tx int64) {
+				t.Helper()
+
+				err := a.Observe(&wgtypes.Device{
+					Name: device,
+					Peers: []wgtypes.Peer{{
+						PublicKey:     peer,
+						ReceiveBytes:  rx,
+						TransmitBytes: tx,
+					}},
+				})
+				if err != nil {
+					t.Fatalf("failed to observe device: %v", err)
+				}
+			}
+
+			usage := func(a *Accountant, rx, tx int64) {
+				t.Helper()
+
+				u, ok, err := a.Usage(peer)
+				if err != nil {
+					t.Fatalf("failed to get usage: %v", err)
+				}
+				if !ok {
+					t.Fatal("peer was not observed")
+				}
+
+				want := Counters{ReceiveBytes: rx, TransmitBytes: tx}
+				got := Counters{ReceiveBytes: u.ReceiveBytes, TransmitBytes: u.TransmitBytes}
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Fatalf("unexpected usage (-want +got):\n%s", diff)
+				}
+			}
+
+			a := newAccountant()
+			observe(a, "wg0", 100, 50)
+			observe(a, "wg0", 300, 80)
+			usage(a, 300, 80)
+
+			// The device restarts and its counters reset.
+			observe(a, "wg0", 20, 10)
+			usage(a, 320, 90)
+
+			// The program restarts and loads its state from the store.
+			a = newAccountant()
+			observe(a, "wg0", 70, 10)
+			usage(a, 370, 90)
+
+			// The peer also appears on a second device.
+			observe(a, "wg1", 5, 5)
+			usage(a, 375, 95)
+
+			// Reset counts from the last observation onwards.
+			if err := a.Reset(peer); err != nil {
+				t.Fatalf("failed to reset usage: %v", err)
+			}
+			observe(a, "wg0", 100, 20)
+			usage(a, 30, 10)
+
+			u, _, err := newAccountant().Usage(peer)
+			if err != nil {
+				t.Fatalf("failed to get usage: %v", err)
+			}
+
+			if diff := cmp.Diff(now, u.Updated); diff != "" {
+				t.Fatalf("unexpected update time (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAccountantUsageNotObserved(t *testing.T) {
+	a := &Accountant{Store: &FileStore{Path: filepath.Join(t.TempDir(), "usage.json")}}
+
+	_, ok, err := a.Usage(wgtest.MustPublicKey())
+	if err != nil {
+		t.Fatalf("failed to get usage: %v", err)
+	}
+	if ok {
+		t.Fatal("expected peer to be unknown")
+	}
+}
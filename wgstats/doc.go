@@ -0,0 +1,14 @@
+// Package wgstats derives statistics about WireGuard peers from periodic
+// observations of the devices returned by package wgctrl.
+//
+// WireGuard only reports cumulative counters and the time of each peer's most
+// recent handshake, so the types in this package keep a short history of
+// observations in memory to compute rates and trends. An Accountant instead
+// persists cumulative usage to a Store, so that totals continue across counter
+// resets. A KVStore keeps usage in a wgstore.Store shared with other
+// subsystems.
+//
+// An Enricher attaches operator-provided Metadata, such as the location and
+// network of each peer's endpoint, to the peers reported by a Tracker and by
+// package wgmetrics. No GeoIP or ASN data is bundled.
+package wgstats
@@ -0,0 +1,66 @@
+package wgstats
+
+import (
+	"net/netip"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// Metadata is operator-provided information about a peer, typically derived
+// from its endpoint, which is attached to the statistics and metrics reported
+// for it. Empty fields are unknown.
+type Metadata struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country of the peer's
+	// endpoint, such as "DE".
+	Country string
+
+	// City is the name of the city of the peer's endpoint.
+	City string
+
+	// ASN is the number of the autonomous system which announces the peer's
+	// endpoint, or 0.
+	ASN uint32
+
+	// Organization is the name of the organization which operates that
+	// autonomous system.
+	Organization string
+
+	// Site is an operator-defined name for the location of the peer, such as
+	// a data center or office.
+	Site string
+}
+
+// An Enricher provides the Metadata of peers, for example by looking up their
+// endpoints in a GeoIP or ASN database. This package bundles no such data, so
+// an Enricher must be supplied by the caller, and is only consulted if one is
+// set.
+type Enricher interface {
+	// Enrich returns the Metadata of peer p on the device specified by name.
+	// p.Endpoint may be nil. Enrich is called for every peer each time
+	// devices are observed, so lookups which are slow should be cached.
+	Enrich(device string, p wgtypes.Peer) Metadata
+}
+
+// EnrichEndpoint returns an Enricher which calls fn with the address of the
+// endpoint of each peer. IPv4-mapped IPv6 addresses are passed as IPv4
+// addresses. Peers with no endpoint have no Metadata.
+func EnrichEndpoint(fn func(addr netip.Addr) Metadata) Enricher {
+	return endpointEnricher(fn)
+}
+
+// An endpointEnricher is the Enricher returned by EnrichEndpoint.
+type endpointEnricher func(addr netip.Addr) Metadata
+
+// Enrich implements Enricher.
+func (fn endpointEnricher) Enrich(_ string, p wgtypes.Peer) Metadata {
+	if p.Endpoint == nil {
+		return Metadata{}
+	}
+
+	addr, ok := netip.AddrFromSlice(p.Endpoint.IP)
+	if !ok {
+		return Metadata{}
+	}
+
+	return fn(addr.Unmap())
+}
@@ -0,0 +1,101 @@
+package wgstats
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+// testMetadata maps endpoint addresses to Metadata for tests.
+var testMetadata = map[netip.Addr]Metadata{
+	netip.MustParseAddr("192.0.2.1"): {
+		Country:      "DE",
+		ASN:          64496,
+		Organization: "Example",
+	},
+	netip.MustParseAddr("2001:db8::1"): {
+		Site: "lab",
+	},
+}
+
+func TestEnrichEndpoint(t *testing.T) {
+	e := EnrichEndpoint(func(addr netip.Addr) Metadata {
+		return testMetadata[addr]
+	})
+
+	tests := []struct {
+		name string
+		p    wgtypes.Peer
+		want Metadata
+	}{
+		{
+			name: "no endpoint",
+		},
+		{
+			name: "IPv4",
+			p:    wgtypes.Peer{Endpoint: wgtest.MustUDPAddr("192.0.2.1:51820")},
+			want: testMetadata[netip.MustParseAddr("192.0.2.1")],
+		},
+		{
+			name: "IPv4-mapped IPv6",
+			p:    wgtypes.Peer{Endpoint: wgtest.MustUDPAddr("[::ffff:192.0.2.1]:51820")},
+			want: testMetadata[netip.MustParseAddr("192.0.2.1")],
+		},
+		{
+			name: "IPv6",
+			p:    wgtypes.Peer{Endpoint: wgtest.MustUDPAddr("[2001:db8::1]:51820")},
+			want: testMetadata[netip.MustParseAddr("2001:db8::1")],
+		},
+		{
+			name: "unknown",
+			p:    wgtypes.Peer{Endpoint: wgtest.MustUDPAddr("198.51.100.1:51820")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, e.Enrich("wg0", tt.p)); diff != "" {
+				t.Fatalf("unexpected metadata (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTrackerEnricher(t *testing.T) {
+	var (
+		key = wgtest.MustPublicKey()
+		now = time.Unix(100000, 0)
+	)
+
+	tr := &Tracker{
+		Enricher: EnrichEndpoint(func(addr netip.Addr) Metadata {
+			return testMetadata[addr]
+		}),
+		now: func() time.Time { return now },
+	}
+
+	// The most recently observed endpoint determines the peer's metadata.
+	for _, ep := range []string{"192.0.2.1:51820", "[2001:db8::1]:51820"} {
+		tr.Observe(&wgtypes.Device{
+			Name: "wg0",
+			Peers: []wgtypes.Peer{{
+				PublicKey: key,
+				Endpoint:  wgtest.MustUDPAddr(ep),
+			}},
+		})
+		now = now.Add(time.Minute)
+	}
+
+	qs := tr.Qualities()
+	if len(qs) != 1 {
+		t.Fatalf("expected 1 peer, but got %d", len(qs))
+	}
+
+	if diff := cmp.Diff(Metadata{Site: "lab"}, qs[0].Metadata); diff != "" {
+		t.Fatalf("unexpected metadata (-want +got):\n%s", diff)
+	}
+}
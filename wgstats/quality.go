@@ -0,0 +1,288 @@
+package wgstats
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+// defaultWindow is the default value for Tracker.Window.
+const defaultWindow = 10 * time.Minute
+
+// Handshake staleness thresholds. A peer exchanging traffic rekeys every two
+// minutes, and sessions are rejected after three.
+const (
+	staleGood = 135 * time.Second
+	staleBad  = 5 * time.Minute
+)
+
+// Weights of each component of a Quality score, which sum to 100.
+const (
+	weightHandshake = 50
+	weightSymmetry  = 30
+	weightRoaming   = 20
+)
+
+// roamPenalty is the number of points deducted from the roaming component for
+// each endpoint change within the window.
+const roamPenalty = 25
+
+// A Quality is a connection quality score for a peer. Each score ranges from 0
+// to 100, where higher scores indicate a healthier connection.
+type Quality struct {
+	// Score combines the component scores below into a single value.
+	Score int
+
+	// Handshake scores the regularity of handshakes while traffic is
+	// exchanged with the peer.
+	Handshake int
+
+	// Symmetry scores the ratio of received to transmitted bytes, which
+	// drops sharply when traffic only flows in one direction.
+	Symmetry int
+
+	// Roaming scores the stability of the peer's endpoint.
+	Roaming int
+}
+
+// A PeerQuality is the Quality of a peer on a device.
+type PeerQuality struct {
+	Device    string
+	PublicKey wgtypes.Key
+	Quality   Quality
+
+	// Metadata is the Metadata of the peer provided by Tracker.Enricher when
+	// the peer was most recently observed, if set.
+	Metadata Metadata
+}
+
+// A Tracker computes the connection Quality of peers from periodic
+// observations of their devices. The zero value is ready to use. A Tracker is
+// not safe for concurrent use.
+type Tracker struct {
+	// Window is the period of history used to compute Quality. If zero, a
+	// default of 10 minutes is used.
+	Window time.Duration
+
+	// Enricher, if set, provides the Metadata of each peer reported by
+	// Qualities.
+	Enricher Enricher
+
+	peers map[peerID][]sample
+
+	// now may be replaced in tests.
+	now func() time.Time
+}
+
+// A peerID identifies a peer on a device.
+type peerID struct {
+	device string
+	key    wgtypes.Key
+}
+
+// A sample is a single observation of a peer.
+type sample struct {
+	at        time.Time
+	rx, tx    int64
+	handshake time.Time
+	endpoint  string
+	meta      Metadata
+}
+
+// Observe records the current state of every peer on d. Peers which are no
+// longer present on d are forgotten.
+func (t *Tracker) Observe(d *wgtypes.Device) {
+	if t.peers == nil {
+		t.peers = make(map[peerID][]sample)
+	}
+
+	now := t.timeNow()
+	cutoff := now.Add(-t.window())
+
+	seen := make(map[peerID]bool, len(d.Peers))
+	for _, p := range d.Peers {
+		id := peerID{device: d.Name, key: p.PublicKey}
+		seen[id] = true
+
+		var endpoint string
+		if p.Endpoint != nil {
+			endpoint = p.Endpoint.String()
+		}
+
+		var meta Metadata
+		if t.Enricher != nil {
+			meta = t.Enricher.Enrich(d.Name, p)
+		}
+
+		ss := append(t.peers[id], sample{
+			at:        now,
+			rx:        p.ReceiveBytes,
+			tx:        p.TransmitBytes,
+			handshake: p.LastHandshakeTime,
+			endpoint:  endpoint,
+			meta:      meta,
+		})
+
+		// Discard samples outside of the window, but always keep the most
+		// recent one before it as a baseline for deltas.
+		i := 0
+		for i < len(ss)-1 && !ss[i+1].at.After(cutoff) {
+			i++
+		}
+
+		t.peers[id] = ss[i:]
+	}
+
+	for id := range t.peers {
+		if id.device == d.Name && !seen[id] {
+			delete(t.peers, id)
+		}
+	}
+}
+
+// Quality returns the Quality of the peer with public key on the device
+// specified by name. It reports false if the peer has not been observed.
+func (t *Tracker) Quality(device string, peer wgtypes.Key) (Quality, bool) {
+	ss, ok := t.peers[peerID{device: device, key: peer}]
+	if !ok {
+		return Quality{}, false
+	}
+
+	return score(ss), true
+}
+
+// Qualities returns the Quality of every observed peer, ordered from lowest to
+// highest score so that problematic peers are listed first.
+func (t *Tracker) Qualities() []PeerQuality {
+	qs := make([]PeerQuality, 0, len(t.peers))
+	for id, ss := range t.peers {
+		qs = append(qs, PeerQuality{
+			Device:    id.device,
+			PublicKey: id.key,
+			Quality:   score(ss),
+			Metadata:  ss[len(ss)-1].meta,
+		})
+	}
+
+	sort.Slice(qs, func(i, j int) bool {
+		if qs[i].Quality.Score != qs[j].Quality.Score {
+			return qs[i].Quality.Score < qs[j].Quality.Score
+		}
+		if qs[i].Device != qs[j].Device {
+			return qs[i].Device < qs[j].Device
+		}
+		return qs[i].PublicKey.String() < qs[j].PublicKey.String()
+	})
+
+	return qs
+}
+
+// score computes a Quality from the samples of a single peer, ordered from
+// oldest to newest.
+func score(ss []sample) Quality {
+	var (
+		first = ss[0]
+		last  = ss[len(ss)-1]
+		drx   = last.rx - first.rx
+		dtx   = last.tx - first.tx
+	)
+
+	q := Quality{
+		Handshake: 100,
+		Symmetry:  symmetryScore(drx, dtx),
+		Roaming:   roamingScore(ss),
+	}
+
+	// Idle peers do not handshake, so only judge handshakes when traffic
+	// was exchanged.
+	if drx > 0 || dtx > 0 {
+		q.Handshake = handshakeScore(ss)
+	}
+
+	q.Score = (q.Handshake*weightHandshake + q.Symmetry*weightSymmetry + q.Roaming*weightRoaming) / 100
+	return q
+}
+
+// handshakeScore scores the largest gap between handshakes, including the age
+// of the most recent handshake.
+func handshakeScore(ss []sample) int {
+	last := ss[len(ss)-1]
+	if last.handshake.IsZero() {
+		return 0
+	}
+
+	stale := last.at.Sub(last.handshake)
+	for i := 1; i < len(ss); i++ {
+		prev, cur := ss[i-1].handshake, ss[i].handshake
+		if prev.IsZero() || !cur.After(prev) {
+			continue
+		}
+
+		if gap := cur.Sub(prev); gap > stale {
+			stale = gap
+		}
+	}
+
+	switch {
+	case stale <= staleGood:
+		return 100
+	case stale >= staleBad:
+		return 0
+	default:
+		return int(100 * (staleBad - stale) / (staleBad - staleGood))
+	}
+}
+
+// symmetryScore scores the ratio of received to transmitted bytes on a
+// logarithmic scale, from 100 for equal traffic to 0 for a ratio of 1:1000 or
+// traffic in only one direction.
+func symmetryScore(drx, dtx int64) int {
+	if drx <= 0 && dtx <= 0 {
+		return 100
+	}
+	if drx <= 0 || dtx <= 0 {
+		return 0
+	}
+
+	lo, hi := float64(drx), float64(dtx)
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+
+	s := math.Log10(1000*lo/hi) / 3
+	return int(math.Round(100 * math.Max(0, math.Min(1, s))))
+}
+
+// roamingScore deducts points for each endpoint change.
+func roamingScore(ss []sample) int {
+	s := 100
+	for i := 1; i < len(ss); i++ {
+		if ss[i-1].endpoint != "" && ss[i].endpoint != ss[i-1].endpoint {
+			s -= roamPenalty
+		}
+	}
+
+	if s < 0 {
+		return 0
+	}
+
+	return s
+}
+
+func (t *Tracker) window() time.Duration {
+	if t.Window == 0 {
+		return defaultWindow
+	}
+
+	return t.Window
+}
+
+func (t *Tracker) timeNow() time.Time {
+	if t.now == nil {
+		return time.Now()
+	}
+
+	return t.now()
+}
@@ -0,0 +1,135 @@
+package wgstats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTrackerQuality(t *testing.T) {
+	var (
+		healthy = wgtest.MustPublicKey()
+		oneWay  = wgtest.MustPublicKey()
+		roaming = wgtest.MustPublicKey()
+		idle    = wgtest.MustPublicKey()
+
+		start = time.Unix(100000, 0)
+		now   = start
+	)
+
+	tr := &Tracker{now: func() time.Time { return now }}
+
+	// Observe the device once per minute for five minutes.
+	for i := int64(0); i <= 5; i++ {
+		now = start.Add(time.Duration(i) * time.Minute)
+
+		roamAddr := "192.0.2.1:51820"
+		if i%2 == 1 {
+			roamAddr = "198.51.100.1:51820"
+		}
+
+		tr.Observe(&wgtypes.Device{
+			Name: "wg0",
+			Peers: []wgtypes.Peer{
+				{
+					PublicKey:         healthy,
+					Endpoint:          wgtest.MustUDPAddr("192.0.2.1:51820"),
+					LastHandshakeTime: now.Add(-30 * time.Second),
+					ReceiveBytes:      1000 * i,
+					TransmitBytes:     1000 * i,
+				},
+				{
+					PublicKey:         oneWay,
+					Endpoint:          wgtest.MustUDPAddr("192.0.2.2:51820"),
+					LastHandshakeTime: start.Add(-10 * time.Minute),
+					TransmitBytes:     148 * i,
+				},
+				{
+					PublicKey:         roaming,
+					Endpoint:          wgtest.MustUDPAddr(roamAddr),
+					LastHandshakeTime: now.Add(-30 * time.Second),
+					ReceiveBytes:      1000 * i,
+					TransmitBytes:     10 * i,
+				},
+				{
+					PublicKey:         idle,
+					LastHandshakeTime: start.Add(-time.Hour),
+				},
+			},
+		})
+	}
+
+	want := map[wgtypes.Key]Quality{
+		healthy: {Score: 100, Handshake: 100, Symmetry: 100, Roaming: 100},
+		oneWay:  {Score: 20, Handshake: 0, Symmetry: 0, Roaming: 100},
+		roaming: {Score: 59, Handshake: 100, Symmetry: 33, Roaming: 0},
+		idle:    {Score: 100, Handshake: 100, Symmetry: 100, Roaming: 100},
+	}
+
+	for k, w := range want {
+		q, ok := tr.Quality("wg0", k)
+		if !ok {
+			t.Fatalf("peer %s was not observed", k)
+		}
+
+		if diff := cmp.Diff(w, q); diff != "" {
+			t.Fatalf("unexpected Quality for peer %s (-want +got):\n%s", k, diff)
+		}
+	}
+
+	qs := tr.Qualities()
+	if diff := cmp.Diff(oneWay, qs[0].PublicKey); diff != "" {
+		t.Fatalf("unexpected lowest quality peer (-want +got):\n%s", diff)
+	}
+
+	// Removing a peer from the device forgets it.
+	tr.Observe(&wgtypes.Device{Name: "wg0", Peers: []wgtypes.Peer{{PublicKey: healthy}}})
+	if _, ok := tr.Quality("wg0", oneWay); ok {
+		t.Fatal("removed peer should not have a quality")
+	}
+	if diff := cmp.Diff(1, len(tr.Qualities())); diff != "" {
+		t.Fatalf("unexpected number of peers (-want +got):\n%s", diff)
+	}
+}
+
+func TestTrackerWindow(t *testing.T) {
+	var (
+		peer  = wgtest.MustPublicKey()
+		start = time.Unix(100000, 0)
+		now   = start
+	)
+
+	tr := &Tracker{
+		Window: 2 * time.Minute,
+		now:    func() time.Time { return now },
+	}
+
+	// One-way traffic early on followed by healthy traffic must recover
+	// once the early samples leave the window.
+	observe := func(rx, tx int64) {
+		tr.Observe(&wgtypes.Device{
+			Name: "wg0",
+			Peers: []wgtypes.Peer{{
+				PublicKey:         peer,
+				LastHandshakeTime: now,
+				ReceiveBytes:      rx,
+				TransmitBytes:     tx,
+			}},
+		})
+		now = now.Add(time.Minute)
+	}
+
+	observe(0, 0)
+	observe(0, 1000)
+	observe(1000, 2000)
+	observe(2000, 3000)
+	observe(3000, 4000)
+
+	q, _ := tr.Quality("wg0", peer)
+	if diff := cmp.Diff(100, q.Symmetry); diff != "" {
+		t.Fatalf("unexpected symmetry (-want +got):\n%s", diff)
+	}
+}
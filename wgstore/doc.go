@@ -0,0 +1,9 @@
+// Package wgstore defines a small key/value persistence interface shared by
+// the stateful types of the wgctrl module, so that programs can back all of
+// them with a single database.
+//
+// Values are opaque byte slices grouped into namespaces, so that several
+// subsystems can share a Store without their keys colliding. A MemoryStore
+// and a FileStore are provided; other databases can be used by implementing
+// Store.
+package wgstore
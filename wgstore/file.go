@@ -0,0 +1,120 @@
+package wgstore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A FileStore is a Store which keeps every namespace in a single JSON file.
+// The file is read on each call and replaced atomically on each change, so it
+// is never left partially written, but concurrent use is only safe within a
+// single FileStore.
+type FileStore struct {
+	// Path is the path of the file. It need not exist before the first
+	// change.
+	Path string
+
+	mu sync.Mutex
+}
+
+var _ Store = &FileStore{}
+
+// Get implements Store.
+func (s *FileStore) Get(namespace, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return ns.get(namespace, key)
+}
+
+// Put implements Store.
+func (s *FileStore) Put(namespace, key string, value []byte) error {
+	return s.update(func(ns namespaces) {
+		ns.put(namespace, key, value)
+	})
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(namespace, key string) error {
+	return s.update(func(ns namespaces) {
+		ns.delete(namespace, key)
+	})
+}
+
+// List implements Store.
+func (s *FileStore) List(namespace string) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return ns.list(namespace), nil
+}
+
+// update loads the file, applies fn, and saves the result.
+func (s *FileStore) update(fn func(ns namespaces)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	fn(ns)
+	return s.save(ns)
+}
+
+// load reads all namespaces from the file.
+func (s *FileStore) load() (namespaces, error) {
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return make(namespaces), nil
+		}
+
+		return nil, err
+	}
+
+	ns := make(namespaces)
+	if err := json.Unmarshal(b, &ns); err != nil {
+		return nil, err
+	}
+
+	return ns, nil
+}
+
+// save replaces the file with ns.
+func (s *FileStore) save(ns namespaces) error {
+	b, err := json.MarshalIndent(ns, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.Path)
+}
@@ -0,0 +1,118 @@
+package wgstore
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned by Store.Get when a key does not exist.
+var ErrNotFound = errors.New("wgstore: key not found")
+
+// A Store persists values by namespace and key. Implementations must be safe
+// for concurrent use.
+type Store interface {
+	// Get returns the value of key in namespace. If the key does not exist,
+	// Get returns an error which matches ErrNotFound.
+	Get(namespace, key string) ([]byte, error)
+
+	// Put sets the value of key in namespace, replacing any existing value.
+	Put(namespace, key string, value []byte) error
+
+	// Delete removes key from namespace. Deleting a key which does not exist
+	// is not an error.
+	Delete(namespace, key string) error
+
+	// List returns every key and value in namespace. If the namespace is
+	// empty, List returns an empty map and no error.
+	List(namespace string) (map[string][]byte, error)
+}
+
+// A MemoryStore is a Store which keeps values in memory, which is useful for
+// tests and for programs which don't need state to survive restarts. The zero
+// value is ready to use.
+type MemoryStore struct {
+	mu sync.Mutex
+	ns namespaces
+}
+
+var _ Store = &MemoryStore{}
+
+// Get implements Store.
+func (s *MemoryStore) Get(namespace, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ns.get(namespace, key)
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(namespace, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ns == nil {
+		s.ns = make(namespaces)
+	}
+
+	s.ns.put(namespace, key, value)
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(namespace, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ns.delete(namespace, key)
+	return nil
+}
+
+// List implements Store.
+func (s *MemoryStore) List(namespace string) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ns.list(namespace), nil
+}
+
+// namespaces holds values by namespace and key. Values are copied in and out
+// so that callers can't modify stored values.
+type namespaces map[string]map[string][]byte
+
+func (ns namespaces) get(namespace, key string) ([]byte, error) {
+	v, ok := ns[namespace][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return clone(v), nil
+}
+
+func (ns namespaces) put(namespace, key string, value []byte) {
+	if ns[namespace] == nil {
+		ns[namespace] = make(map[string][]byte)
+	}
+
+	ns[namespace][key] = clone(value)
+}
+
+func (ns namespaces) delete(namespace, key string) {
+	delete(ns[namespace], key)
+	if len(ns[namespace]) == 0 {
+		delete(ns, namespace)
+	}
+}
+
+func (ns namespaces) list(namespace string) map[string][]byte {
+	out := make(map[string][]byte, len(ns[namespace]))
+	for k, v := range ns[namespace] {
+		out[k] = clone(v)
+	}
+
+	return out
+}
+
+// clone returns a copy of b which is never nil.
+func clone(b []byte) []byte {
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,98 @@
+package wgstore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStore(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func(t *testing.T) Store
+	}{
+		{
+			name:  "memory",
+			store: func(_ *testing.T) Store { return &MemoryStore{} },
+		},
+		{
+			name: "file",
+			store: func(t *testing.T) Store {
+				return &FileStore{Path: filepath.Join(t.TempDir(), "state.json")}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.store(t)
+
+			if _, err := s.Get("a", "foo"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected not found, but got: %v", err)
+			}
+
+			put := func(ns, key, value string) {
+				t.Helper()
+
+				if err := s.Put(ns, key, []byte(value)); err != nil {
+					t.Fatalf("failed to put: %v", err)
+				}
+			}
+
+			put("a", "foo", "1")
+			put("a", "bar", "2")
+			put("b", "foo", "3")
+			put("a", "foo", "4")
+
+			v, err := s.Get("a", "foo")
+			if err != nil {
+				t.Fatalf("failed to get: %v", err)
+			}
+			if diff := cmp.Diff("4", string(v)); diff != "" {
+				t.Fatalf("unexpected value (-want +got):\n%s", diff)
+			}
+
+			// Values returned by the store must not alias stored values.
+			v[0] = 'x'
+
+			list := func(ns string) map[string]string {
+				t.Helper()
+
+				kvs, err := s.List(ns)
+				if err != nil {
+					t.Fatalf("failed to list: %v", err)
+				}
+
+				out := make(map[string]string, len(kvs))
+				for k, v := range kvs {
+					out[k] = string(v)
+				}
+
+				return out
+			}
+
+			if diff := cmp.Diff(map[string]string{"foo": "4", "bar": "2"}, list("a")); diff != "" {
+				t.Fatalf("unexpected namespace a (-want +got):\n%s", diff)
+			}
+
+			if err := s.Delete("a", "foo"); err != nil {
+				t.Fatalf("failed to delete: %v", err)
+			}
+			if err := s.Delete("c", "foo"); err != nil {
+				t.Fatalf("failed to delete missing key: %v", err)
+			}
+
+			if diff := cmp.Diff(map[string]string{"bar": "2"}, list("a")); diff != "" {
+				t.Fatalf("unexpected namespace a (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(map[string]string{"foo": "3"}, list("b")); diff != "" {
+				t.Fatalf("unexpected namespace b (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(map[string]string{}, list("c")); diff != "" {
+				t.Fatalf("unexpected namespace c (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
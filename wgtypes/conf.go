@@ -0,0 +1,263 @@
+package wgtypes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseConfig parses a configuration in the INI-style format read by wg(8)
+// setconf and wg-quick(8), with [Interface] and [Peer] sections, including
+// the AmneziaWG keys of awg-quick: Jc, Jmin, Jmax, S1 to S4, H1 to H4, I1 to
+// I5, and Itime. Keys and section names are case-insensitive, and "#" begins
+// a comment.
+//
+// Keys which are only meaningful to wg-quick, such as Address, DNS, and MTU,
+// are ignored, because they are not part of a device's WireGuard
+// configuration. As with wg(8), endpoints given as host names are resolved.
+func ParseConfig(r io.Reader) (Config, error) {
+	var (
+		cfg     Config
+		section string
+		peer    *PeerConfig
+	)
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(line[1 : len(line)-1])
+			switch section {
+			case "interface":
+			case "peer":
+				cfg.Peers = append(cfg.Peers, PeerConfig{})
+				peer = &cfg.Peers[len(cfg.Peers)-1]
+			default:
+				return Config{}, fmt.Errorf("wgtypes: line %d: unknown section %q", n, line)
+			}
+
+			continue
+		}
+
+		key, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return Config{}, fmt.Errorf("wgtypes: line %d: expected key = value", n)
+		}
+		key, v = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(v)
+
+		var err error
+		switch section {
+		case "interface":
+			err = parseConfInterface(key, v, &cfg)
+		case "peer":
+			err = parseConfPeer(key, v, peer)
+		default:
+			err = fmt.Errorf("key %q outside of a section", key)
+		}
+		if err != nil {
+			return Config{}, fmt.Errorf("wgtypes: line %d: %v", n, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return Config{}, err
+	}
+
+	for i, p := range cfg.Peers {
+		if p.PublicKey == (Key{}) {
+			return Config{}, fmt.Errorf("wgtypes: peer %d has no public key", i)
+		}
+	}
+
+	return cfg, nil
+}
+
+// parseConfInterface parses a single key of an [Interface] section into cfg.
+func parseConfInterface(key, v string, cfg *Config) error {
+	switch key {
+	case "privatekey":
+		k, err := ParseKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid private key: %v", err)
+		}
+
+		cfg.PrivateKey = &k
+	case "listenport":
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid listen port: %v", err)
+		}
+
+		p := int(port)
+		cfg.ListenPort = &p
+	case "fwmark":
+		var mark uint64
+		if v != "off" {
+			var err error
+			if mark, err = strconv.ParseUint(v, 0, 32); err != nil {
+				return fmt.Errorf("invalid fwmark: %v", err)
+			}
+		}
+
+		m := int(mark)
+		cfg.FirewallMark = &m
+	case "address", "dns", "mtu", "table", "preup", "postup", "predown", "postdown", "saveconfig":
+		// wg-quick(8) only.
+	default:
+		ok, err := cfg.AdvancedSecurityConfig.ParseUAPI(key, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("unknown interface key %q", key)
+		}
+	}
+
+	return nil
+}
+
+// parseConfPeer parses a single key of a [Peer] section into p.
+func parseConfPeer(key, v string, p *PeerConfig) error {
+	switch key {
+	case "publickey":
+		k, err := ParseKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid public key: %v", err)
+		}
+
+		p.PublicKey = k
+	case "presharedkey":
+		k, err := ParseKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid preshared key: %v", err)
+		}
+
+		p.PresharedKey = &k
+	case "endpoint":
+		addr, err := net.ResolveUDPAddr("udp", v)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint: %v", err)
+		}
+
+		p.Endpoint = addr
+	case "persistentkeepalive":
+		var secs uint64
+		if v != "off" {
+			var err error
+			if secs, err = strconv.ParseUint(v, 10, 16); err != nil {
+				return fmt.Errorf("invalid persistent keepalive: %v", err)
+			}
+		}
+
+		d := time.Duration(secs) * time.Second
+		p.PersistentKeepaliveInterval = &d
+	case "allowedips":
+		// Allowed IPs accumulate across lines.
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+
+			_, ipn, err := net.ParseCIDR(s)
+			if err != nil {
+				return fmt.Errorf("invalid allowed IP: %v", err)
+			}
+
+			p.AllowedIPs = append(p.AllowedIPs, *ipn)
+		}
+	default:
+		return fmt.Errorf("unknown peer key %q", key)
+	}
+
+	return nil
+}
+
+// WriteTo writes c to w in the format read by ParseConfig, implementing
+// io.WriterTo. Only the fields of c which are set are written.
+//
+// The format can't express ReplacePeers, or the Remove, UpdateOnly, and
+// ReplaceAllowedIPs fields and AlternateEndpoints of a peer, so they are not
+// written, and peers which are removed are skipped.
+func (c Config) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	fmt.Fprintln(bw, "[Interface]")
+	if c.PrivateKey != nil {
+		fmt.Fprintf(bw, "PrivateKey = %s\n", c.PrivateKey)
+	}
+	if c.ListenPort != nil {
+		fmt.Fprintf(bw, "ListenPort = %d\n", *c.ListenPort)
+	}
+	if c.FirewallMark != nil {
+		if *c.FirewallMark == 0 {
+			fmt.Fprintln(bw, "FwMark = off")
+		} else {
+			fmt.Fprintf(bw, "FwMark = %#x\n", *c.FirewallMark)
+		}
+	}
+	for _, f := range c.AdvancedSecurityConfig.uapiFields() {
+		// Jc, Jmin, S1, H1, and so on.
+		name := strings.ToUpper(f.key[:1]) + f.key[1:]
+
+		if f.isSet() {
+			fmt.Fprintf(bw, "%s = %s\n", name, f.value())
+		}
+	}
+
+	for _, p := range c.Peers {
+		if p.Remove {
+			continue
+		}
+
+		fmt.Fprintln(bw, "\n[Peer]")
+		fmt.Fprintf(bw, "PublicKey = %s\n", p.PublicKey)
+		if p.PresharedKey != nil {
+			fmt.Fprintf(bw, "PresharedKey = %s\n", p.PresharedKey)
+		}
+		if len(p.AllowedIPs) > 0 {
+			ss := make([]string, 0, len(p.AllowedIPs))
+			for _, ipn := range p.AllowedIPs {
+				ss = append(ss, ipn.String())
+			}
+
+			fmt.Fprintf(bw, "AllowedIPs = %s\n", strings.Join(ss, ", "))
+		}
+		if p.Endpoint != nil {
+			fmt.Fprintf(bw, "Endpoint = %s\n", p.Endpoint)
+		}
+		if d := p.PersistentKeepaliveInterval; d != nil {
+			if *d == 0 {
+				fmt.Fprintln(bw, "PersistentKeepalive = off")
+			} else {
+				fmt.Fprintf(bw, "PersistentKeepalive = %d\n", *d/time.Second)
+			}
+		}
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// A countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
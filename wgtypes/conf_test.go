@@ -0,0 +1,357 @@
+package wgtypes_test
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseConfig(t *testing.T) {
+	var (
+		priv = wgtest.MustHexKey("e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a")
+		pub  = wgtest.MustHexKey("b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33")
+		psk  = wgtest.MustHexKey("188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52")
+
+		port      = 51820
+		mark      = 0x1234
+		keepalive = 25 * time.Second
+		jc        = uint16(4)
+		jmin      = uint16(40)
+		h1        = uint32(123456)
+	)
+
+	const conf = `
+# wg-quick keys are ignored.
+[Interface]
+Address = 10.0.0.1/24
+PrivateKey = 6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA/rpSAno=
+ListenPort = 51820
+FwMark = 0x1234
+jc = 4
+Jmin = 40
+H1 = 123456
+PostUp = iptables -A FORWARD -i %i -j ACCEPT
+
+[Peer]
+PublicKey = uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM= # laptop
+PresharedKey = GIUVCT6VL18i6GXO8wEucvi18LWYrAMJ1drM47cPz1I=
+AllowedIPs = 10.0.0.2/32, fd00::2/128
+AllowedIPs = 10.0.1.0/24
+Endpoint = 192.0.2.1:51820
+PersistentKeepalive = 25
+`
+
+	want := wgtypes.Config{
+		PrivateKey:   &priv,
+		ListenPort:   &port,
+		FirewallMark: &mark,
+		AdvancedSecurityConfig: wgtypes.AdvancedSecurityConfig{
+			JunkPacketCount:       &jc,
+			JunkPacketMinSize:     &jmin,
+			InitPacketMagicHeader: &h1,
+		},
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:                   pub,
+			PresharedKey:                &psk,
+			Endpoint:                    wgtest.MustUDPAddr("192.0.2.1:51820"),
+			PersistentKeepaliveInterval: &keepalive,
+			AllowedIPs: []net.IPNet{
+				wgtest.MustCIDR("10.0.0.2/32"),
+				wgtest.MustCIDR("fd00::2/128"),
+				wgtest.MustCIDR("10.0.1.0/24"),
+			},
+		}},
+	}
+
+	const written = `[Interface]
+PrivateKey = 6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA/rpSAno=
+ListenPort = 51820
+FwMark = 0x1234
+Jc = 4
+Jmin = 40
+H1 = 123456
+
+[Peer]
+PublicKey = uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM=
+PresharedKey = GIUVCT6VL18i6GXO8wEucvi18LWYrAMJ1drM47cPz1I=
+AllowedIPs = 10.0.0.2/32, fd00::2/128, 10.0.1.0/24
+Endpoint = 192.0.2.1:51820
+PersistentKeepalive = 25
+`
+
+	testConfigRoundTrip(t, conf, want, written)
+}
+
+func TestParseConfigWGQuick(t *testing.T) {
+	var (
+		priv  = wgtest.MustHexKey("e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a")
+		pubA  = wgtest.MustHexKey("b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33")
+		pubB  = wgtest.MustHexKey("692251ecfa9a8e04a06e27c970417f254f168b7cbf6574f3f6e6b22a8089ca9f")
+		port  = 51820
+		ka    = 25 * time.Second
+		kaOff = time.Duration(0)
+	)
+
+	// A wg-quick(8) configuration, whose interface addresses, routing, and
+	// hooks are not part of the device's configuration.
+	const conf = `[Interface]
+Address = 10.200.100.1/24, fd42:42:42::1/64
+DNS = 10.200.100.1, example.com
+MTU = 1420
+Table = off
+SaveConfig = true
+PreUp = sysctl -w net.ipv4.ip_forward=1
+PostUp = iptables -A FORWARD -i %i -j ACCEPT; iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE
+PreDown = echo stopping
+PostDown = iptables -D FORWARD -i %i -j ACCEPT; iptables -t nat -D POSTROUTING -o eth0 -j MASQUERADE
+ListenPort = 51820
+PrivateKey = 6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA/rpSAno=
+
+# Road warrior.
+[Peer]
+PublicKey = uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM=
+AllowedIPs = 10.200.100.2/32, fd42:42:42::2/128
+PersistentKeepalive = 25
+
+[Peer]
+PublicKey = aSJR7PqajgSgbifJcEF/JU8Wi3y/ZXTz9uayKoCJyp8=
+Endpoint = [2001:db8::1]:51820
+AllowedIPs = 0.0.0.0/0, ::/0
+PersistentKeepalive = off
+`
+
+	want := wgtypes.Config{
+		PrivateKey: &priv,
+		ListenPort: &port,
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:                   pubA,
+				PersistentKeepaliveInterval: &ka,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("10.200.100.2/32"),
+					wgtest.MustCIDR("fd42:42:42::2/128"),
+				},
+			},
+			{
+				PublicKey:                   pubB,
+				Endpoint:                    wgtest.MustUDPAddr("[2001:db8::1]:51820"),
+				PersistentKeepaliveInterval: &kaOff,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("0.0.0.0/0"),
+					wgtest.MustCIDR("::/0"),
+				},
+			},
+		},
+	}
+
+	const written = `[Interface]
+PrivateKey = 6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA/rpSAno=
+ListenPort = 51820
+
+[Peer]
+PublicKey = uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM=
+AllowedIPs = 10.200.100.2/32, fd42:42:42::2/128
+PersistentKeepalive = 25
+
+[Peer]
+PublicKey = aSJR7PqajgSgbifJcEF/JU8Wi3y/ZXTz9uayKoCJyp8=
+AllowedIPs = 0.0.0.0/0, ::/0
+Endpoint = [2001:db8::1]:51820
+PersistentKeepalive = off
+`
+
+	testConfigRoundTrip(t, conf, want, written)
+}
+
+func TestParseConfigAmneziaWG(t *testing.T) {
+	var (
+		priv = wgtest.MustHexKey("e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a")
+		pub  = wgtest.MustHexKey("0e427785f8f56f4eccfc0fb25a8e0ddad191ba4d010f2b64371de4e4a97ead53")
+
+		jc, jmin, jmax = uint16(4), uint16(10), uint16(50)
+		s1, s2, s3, s4 = uint16(86), uint16(574), uint16(64), uint16(16)
+		h1, h2, h3, h4 = uint32(1826340137), uint32(2683216373), uint32(3102846795), uint32(4123456789)
+
+		i1    = "<b 0xc70000000108ce1bf31eec7d93360000449e227e4596ed7f75c4d35ce31880b4133107c822c6355b51f0d7c1bba96d5c210a48aca01885fed0871cfc37d59137d73b506dc013bb4a13c060ca5b04b7ae215af71e37d6e8ff1db235f9fe0c25cb8b492471054a7c8d0d6077d430d07f6e87a8699287f6e69f54263c7334a8e144a29851429bf2e350e519445172d36953e96085110ce1fb641e5efad42c0feb4711ece959b72cc4d6f3c1e83251adb572b921534f6ac4b10927167f41fe50040a75acef62f45bded67c0b45b9d655ce374589cad6f568b8475b2e8921ff98628f86ff2eb5bcce6f3ddb7dc89e37c5b5e78ddc8d93a58896e530b5f9f1448ab3b7a1d1f24a63bf981634f6183a21af310ffa52e9ddf5521561760288669de01a5f2f1a4f922e68d0592026bbe4329b654d4f5d6ace4f6a23b8560b720a5350691c0037b10acfac9726add44e7d3e880ee6f3b0d6429ff33655c297fee786bb5ac032e48d2062cd45e305e6d8d8b82bfbf0fdbc5ec09943d1ad02b0b5868ac4b24bb10255196be883562c35a713002014016b8cc5224768b3d330016cf8ed9300fe6bf39b4b19b3667cddc6e7c7ebe4437a58862606a2a66bd4184b09ab9d2cd3d3faed4d2ab71dd821422a9540c4c5fa2a9b2e6693d411a22854a8e541ed930796521f03a54254074bc4c5bca3a84a9ac1c5e0bd9c3f1ea1e0ad4c1cfcc7bb3b3b6d8a8e3cfb1a2d3f59d73b5dc14e4d11dba8bdec2b0d56f4f8a72d96fb9bfe4f8ca0d08f2a0e8e9ce5f0fc49f2d9b7ae0f5a5f7b0f0b6a6c81b03d3c4bb1f79b6bb1b5f64bc5a8d0c25c0ff7e8e0db1c8f2c3c5c1b>"
+		i2    = "<b 0x16fe01><r 16><c><t>"
+		i3    = "<r 32>"
+		itime = uint32(120)
+
+		ka = 25 * time.Second
+	)
+
+	// An awg-quick configuration for AmneziaWG 1.5, whose keys are
+	// deliberately written in mixed case.
+	const conf = `[Interface]
+PrivateKey = 6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA/rpSAno=
+Address = 10.8.1.2/32
+DNS = 1.1.1.1, 1.0.0.1
+jc = 4
+JMIN = 10
+Jmax = 50
+s1 = 86
+S2 = 574
+S3 = 64
+s4 = 16
+H1 = 1826340137
+h2 = 2683216373
+H3 = 3102846795
+h4 = 4123456789
+I1 = <b 0xc70000000108ce1bf31eec7d93360000449e227e4596ed7f75c4d35ce31880b4133107c822c6355b51f0d7c1bba96d5c210a48aca01885fed0871cfc37d59137d73b506dc013bb4a13c060ca5b04b7ae215af71e37d6e8ff1db235f9fe0c25cb8b492471054a7c8d0d6077d430d07f6e87a8699287f6e69f54263c7334a8e144a29851429bf2e350e519445172d36953e96085110ce1fb641e5efad42c0feb4711ece959b72cc4d6f3c1e83251adb572b921534f6ac4b10927167f41fe50040a75acef62f45bded67c0b45b9d655ce374589cad6f568b8475b2e8921ff98628f86ff2eb5bcce6f3ddb7dc89e37c5b5e78ddc8d93a58896e530b5f9f1448ab3b7a1d1f24a63bf981634f6183a21af310ffa52e9ddf5521561760288669de01a5f2f1a4f922e68d0592026bbe4329b654d4f5d6ace4f6a23b8560b720a5350691c0037b10acfac9726add44e7d3e880ee6f3b0d6429ff33655c297fee786bb5ac032e48d2062cd45e305e6d8d8b82bfbf0fdbc5ec09943d1ad02b0b5868ac4b24bb10255196be883562c35a713002014016b8cc5224768b3d330016cf8ed9300fe6bf39b4b19b3667cddc6e7c7ebe4437a58862606a2a66bd4184b09ab9d2cd3d3faed4d2ab71dd821422a9540c4c5fa2a9b2e6693d411a22854a8e541ed930796521f03a54254074bc4c5bca3a84a9ac1c5e0bd9c3f1ea1e0ad4c1cfcc7bb3b3b6d8a8e3cfb1a2d3f59d73b5dc14e4d11dba8bdec2b0d56f4f8a72d96fb9bfe4f8ca0d08f2a0e8e9ce5f0fc49f2d9b7ae0f5a5f7b0f0b6a6c81b03d3c4bb1f79b6bb1b5f64bc5a8d0c25c0ff7e8e0db1c8f2c3c5c1b>
+i2 = <b 0x16fe01><r 16><c><t>
+I3 = <r 32>
+ITime = 120
+
+[peer]
+publickey = DkJ3hfj1b07M/A+yWo4N2tGRuk0BDytkNx3k5Kl+rVM=
+AllowedIPs = 0.0.0.0/0
+Endpoint = 198.51.100.7:51820
+PersistentKeepalive = 25
+`
+
+	want := wgtypes.Config{
+		PrivateKey: &priv,
+		AdvancedSecurityConfig: wgtypes.AdvancedSecurityConfig{
+			JunkPacketCount:            &jc,
+			JunkPacketMinSize:          &jmin,
+			JunkPacketMaxSize:          &jmax,
+			InitPacketJunkSize:         &s1,
+			ResponsePacketJunkSize:     &s2,
+			UnderloadPacketJunkSize:    &s3,
+			TransportPacketJunkSize:    &s4,
+			InitPacketMagicHeader:      &h1,
+			ResponsePacketMagicHeader:  &h2,
+			UnderloadPacketMagicHeader: &h3,
+			TransportPacketMagicHeader: &h4,
+			SpecialJunkPacket1:         &i1,
+			SpecialJunkPacket2:         &i2,
+			SpecialJunkPacket3:         &i3,
+			SpecialJunkInterval:        &itime,
+		},
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:                   pub,
+			Endpoint:                    wgtest.MustUDPAddr("198.51.100.7:51820"),
+			PersistentKeepaliveInterval: &ka,
+			AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("0.0.0.0/0")},
+		}},
+	}
+
+	written := `[Interface]
+PrivateKey = 6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA/rpSAno=
+Jc = 4
+Jmin = 10
+Jmax = 50
+S1 = 86
+S2 = 574
+S3 = 64
+S4 = 16
+H1 = 1826340137
+H2 = 2683216373
+H3 = 3102846795
+H4 = 4123456789
+I1 = ` + i1 + `
+I2 = <b 0x16fe01><r 16><c><t>
+I3 = <r 32>
+Itime = 120
+
+[Peer]
+PublicKey = DkJ3hfj1b07M/A+yWo4N2tGRuk0BDytkNx3k5Kl+rVM=
+AllowedIPs = 0.0.0.0/0
+Endpoint = 198.51.100.7:51820
+PersistentKeepalive = 25
+`
+
+	testConfigRoundTrip(t, conf, want, written)
+}
+
+// testConfigRoundTrip verifies that conf parses to want, that want is written
+// as written, and that written parses back to want.
+func testConfigRoundTrip(t *testing.T, conf string, want wgtypes.Config, written string) {
+	t.Helper()
+
+	got, err := wgtypes.ParseConfig(strings.NewReader(conf))
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected config (-want +got):\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	n, err := got.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if diff := cmp.Diff(written, buf.String()); diff != "" {
+		t.Fatalf("unexpected written config (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(int64(len(written)), n); diff != "" {
+		t.Fatalf("unexpected written byte count (-want +got):\n%s", diff)
+	}
+
+	// The written config must parse back to the same Config.
+	again, err := wgtypes.ParseConfig(&buf)
+	if err != nil {
+		t.Fatalf("failed to parse written config: %v", err)
+	}
+
+	if diff := cmp.Diff(want, again); diff != "" {
+		t.Fatalf("unexpected round trip config (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+	}{
+		{
+			name: "unknown section",
+			conf: "[Foo]",
+		},
+		{
+			name: "no section",
+			conf: "ListenPort = 51820",
+		},
+		{
+			name: "no value",
+			conf: "[Interface]\nListenPort",
+		},
+		{
+			name: "unknown interface key",
+			conf: "[Interface]\nFoo = bar",
+		},
+		{
+			name: "bad listen port",
+			conf: "[Interface]\nListenPort = 65536",
+		},
+		{
+			name: "bad amnezia value",
+			conf: "[Interface]\nJc = -1",
+		},
+		{
+			name: "bad allowed IP",
+			conf: "[Peer]\nPublicKey = uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM=\nAllowedIPs = 10.0.0.1",
+		},
+		{
+			name: "no public key",
+			conf: "[Peer]\nAllowedIPs = 10.0.0.1/32",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := wgtypes.ParseConfig(strings.NewReader(tt.conf)); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
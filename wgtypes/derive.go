@@ -0,0 +1,64 @@
+package wgtypes
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// A KeyDerivation is a version of the scheme used by DerivePresharedKey.
+// Versions are never changed once released, so that keys derived by one
+// version of this package can always be recomputed by later versions.
+type KeyDerivation int
+
+// Possible KeyDerivation values.
+const (
+	// KeyDerivationV1 derives keys using HKDF-SHA256 with no salt, the
+	// master secret as the input keying material, and the info string
+	// "wgctrl preshared key v1" followed by a zero byte and the peer's public
+	// key.
+	KeyDerivationV1 KeyDerivation = 1
+)
+
+// MinMasterSecretLen is the minimum length in bytes of the master secret
+// accepted by DerivePresharedKey.
+const MinMasterSecretLen = KeyLen
+
+// DerivePresharedKey derives the preshared key for the peer with the
+// specified public key from a device's master secret, using the scheme
+// identified by v. This allows an operator of a device with many peers to
+// recompute any peer's preshared key on demand, rather than storing a secret
+// for each peer.
+//
+// master must be at least MinMasterSecretLen bytes of uniformly random data,
+// such as the output of GenerateKey, and must be kept as secret as the
+// device's private key. Anyone who knows it can derive the preshared key of
+// every peer.
+func DerivePresharedKey(v KeyDerivation, master []byte, peer Key) (Key, error) {
+	var info string
+	switch v {
+	case KeyDerivationV1:
+		info = "wgctrl preshared key v1"
+	default:
+		return Key{}, fmt.Errorf("wgtypes: unknown key derivation version %d", v)
+	}
+
+	if len(master) < MinMasterSecretLen {
+		return Key{}, fmt.Errorf("wgtypes: master secret must be at least %d bytes, got %d",
+			MinMasterSecretLen, len(master))
+	}
+
+	b := make([]byte, 0, len(info)+1+KeyLen)
+	b = append(b, info...)
+	b = append(b, 0)
+	b = append(b, peer[:]...)
+
+	var k Key
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, nil, b), k[:]); err != nil {
+		return Key{}, fmt.Errorf("wgtypes: failed to derive preshared key: %v", err)
+	}
+
+	return k, nil
+}
@@ -0,0 +1,88 @@
+package wgtypes_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDerivePresharedKey(t *testing.T) {
+	var (
+		master = func() []byte {
+			b := make([]byte, wgtypes.MinMasterSecretLen)
+			for i := range b {
+				b[i] = byte(i)
+			}
+			return b
+		}()
+		peer = wgtest.MustHexKey("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	)
+
+	tests := []struct {
+		name   string
+		v      wgtypes.KeyDerivation
+		master []byte
+		peer   wgtypes.Key
+		key    wgtypes.Key
+		ok     bool
+	}{
+		{
+			name:   "unknown version",
+			v:      0,
+			master: master,
+		},
+		{
+			name:   "short master secret",
+			v:      wgtypes.KeyDerivationV1,
+			master: master[:wgtypes.MinMasterSecretLen-1],
+		},
+		{
+			name:   "OK v1",
+			v:      wgtypes.KeyDerivationV1,
+			master: master,
+			peer:   peer,
+			// Computed independently using RFC 5869 HKDF-SHA256.
+			key: wgtest.MustHexKey("c694e988d24abfd367df84f920066262973a015b2a9d0ce47e8c8cb7d2bff9cd"),
+			ok:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := wgtypes.DerivePresharedKey(tt.v, tt.master, tt.peer)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to derive key: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tt.key, key); diff != "" {
+				t.Fatalf("unexpected key (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDerivePresharedKeyDistinct(t *testing.T) {
+	master := bytes.Repeat([]byte{0x01}, wgtypes.MinMasterSecretLen)
+
+	seen := make(map[wgtypes.Key]bool)
+	for i := 0; i < 16; i++ {
+		key, err := wgtypes.DerivePresharedKey(wgtypes.KeyDerivationV1, master, wgtest.MustPublicKey())
+		if err != nil {
+			t.Fatalf("failed to derive key: %v", err)
+		}
+
+		if seen[key] {
+			t.Fatalf("derived duplicate key: %s", key)
+		}
+		seen[key] = true
+	}
+}
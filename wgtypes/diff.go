@@ -0,0 +1,183 @@
+package wgtypes
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Change describes a single configuration difference between two Devices,
+// as produced by Diff.
+type Change struct {
+	// Field is the name of the Device or Peer field which changed, such as
+	// "ListenPort" or "Endpoint". Peers which were added or removed entirely
+	// are reported with the Field "Peer".
+	Field string
+
+	// Peer is the public key of the peer this change applies to, or nil if
+	// the change applies to the Device itself.
+	Peer *Key
+
+	// Old and New are string representations of the field's value in the
+	// first and second Device. An empty string indicates that the value is
+	// absent.
+	Old, New string
+
+	// Secret indicates that Old and New contain secret key material, and
+	// should be masked when displayed.
+	Secret bool
+}
+
+// Diff compares the configuration of Devices a and b and returns the list of
+// changes required to turn a into b.
+//
+// Only configurable fields are compared; the device name and type, as well
+// as runtime peer statistics such as LastHandshakeTime and transfer
+// counters, are ignored. Peer allowed IPs are compared without regard to
+// their order.
+func Diff(a, b *Device) []Change {
+	var cs []Change
+	add := func(field string, peer *Key, old, new string, secret bool) {
+		if old == new {
+			return
+		}
+
+		cs = append(cs, Change{
+			Field:  field,
+			Peer:   peer,
+			Old:    old,
+			New:    new,
+			Secret: secret,
+		})
+	}
+
+	add("PrivateKey", nil, keyString(a.PrivateKey), keyString(b.PrivateKey), true)
+	add("ListenPort", nil, intString(a.ListenPort), intString(b.ListenPort), false)
+	add("FirewallMark", nil, intString(a.FirewallMark), intString(b.FirewallMark), false)
+
+	aas, bas := a.AdvancedSecurity, b.AdvancedSecurity
+	for _, f := range []struct {
+		name   string
+		aa, bb uint32
+	}{
+		{"JunkPacketCount", uint32(aas.JunkPacketCount), uint32(bas.JunkPacketCount)},
+		{"JunkPacketMinSize", uint32(aas.JunkPacketMinSize), uint32(bas.JunkPacketMinSize)},
+		{"JunkPacketMaxSize", uint32(aas.JunkPacketMaxSize), uint32(bas.JunkPacketMaxSize)},
+		{"InitPacketJunkSize", uint32(aas.InitPacketJunkSize), uint32(bas.InitPacketJunkSize)},
+		{"ResponsePacketJunkSize", uint32(aas.ResponsePacketJunkSize), uint32(bas.ResponsePacketJunkSize)},
+		{"UnderloadPacketJunkSize", uint32(aas.UnderloadPacketJunkSize), uint32(bas.UnderloadPacketJunkSize)},
+		{"TransportPacketJunkSize", uint32(aas.TransportPacketJunkSize), uint32(bas.TransportPacketJunkSize)},
+		{"InitPacketMagicHeader", aas.InitPacketMagicHeader, bas.InitPacketMagicHeader},
+		{"ResponsePacketMagicHeader", aas.ResponsePacketMagicHeader, bas.ResponsePacketMagicHeader},
+		{"UnderloadPacketMagicHeader", aas.UnderloadPacketMagicHeader, bas.UnderloadPacketMagicHeader},
+		{"TransportPacketMagicHeader", aas.TransportPacketMagicHeader, bas.TransportPacketMagicHeader},
+		{"SpecialJunkInterval", aas.SpecialJunkInterval, bas.SpecialJunkInterval},
+	} {
+		add(f.name, nil, uintString(f.aa), uintString(f.bb), false)
+	}
+	for _, f := range []struct {
+		name   string
+		aa, bb string
+	}{
+		{"SpecialJunkPacket1", aas.SpecialJunkPacket1, bas.SpecialJunkPacket1},
+		{"SpecialJunkPacket2", aas.SpecialJunkPacket2, bas.SpecialJunkPacket2},
+		{"SpecialJunkPacket3", aas.SpecialJunkPacket3, bas.SpecialJunkPacket3},
+		{"SpecialJunkPacket4", aas.SpecialJunkPacket4, bas.SpecialJunkPacket4},
+		{"SpecialJunkPacket5", aas.SpecialJunkPacket5, bas.SpecialJunkPacket5},
+	} {
+		add(f.name, nil, f.aa, f.bb, false)
+	}
+
+	// Index the peers of b so they can be matched with those of a, while
+	// preserving the peer order of each device in the output.
+	bPeers := make(map[Key]*Peer, len(b.Peers))
+	for i := range b.Peers {
+		bPeers[b.Peers[i].PublicKey] = &b.Peers[i]
+	}
+
+	seen := make(map[Key]bool, len(a.Peers))
+	for i := range a.Peers {
+		ap := &a.Peers[i]
+		key := ap.PublicKey
+		seen[key] = true
+
+		bp, ok := bPeers[key]
+		if !ok {
+			add("Peer", &key, key.String(), "", false)
+			continue
+		}
+
+		add("PresharedKey", &key, keyString(ap.PresharedKey), keyString(bp.PresharedKey), true)
+		add("Endpoint", &key, endpointString(ap), endpointString(bp), false)
+		add("PersistentKeepaliveInterval", &key, durationString(ap), durationString(bp), false)
+		add("AllowedIPs", &key, allowedIPsString(ap), allowedIPsString(bp), false)
+	}
+
+	for i := range b.Peers {
+		key := b.Peers[i].PublicKey
+		if !seen[key] {
+			add("Peer", &key, "", key.String(), false)
+		}
+	}
+
+	return cs
+}
+
+// keyString returns the string representation of k, or an empty string for
+// a zero-value Key.
+func keyString(k Key) string {
+	if k == (Key{}) {
+		return ""
+	}
+
+	return k.String()
+}
+
+// intString returns the string representation of v, or an empty string for
+// zero.
+func intString(v int) string {
+	if v == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(v)
+}
+
+// uintString returns the string representation of v, or an empty string for
+// zero. Unlike intString, it doesn't wrap values above math.MaxInt32 on
+// 32-bit platforms.
+func uintString(v uint32) string {
+	if v == 0 {
+		return ""
+	}
+
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+func endpointString(p *Peer) string {
+	if p.Endpoint == nil {
+		return ""
+	}
+
+	return p.Endpoint.String()
+}
+
+func durationString(p *Peer) string {
+	if p.PersistentKeepaliveInterval == 0 {
+		return ""
+	}
+
+	return p.PersistentKeepaliveInterval.String()
+}
+
+// allowedIPsString returns a sorted, comma-separated list of a peer's
+// allowed IPs.
+func allowedIPsString(p *Peer) string {
+	ss := make([]string, 0, len(p.AllowedIPs))
+	for _, ipn := range p.AllowedIPs {
+		ss = append(ss, ipn.String())
+	}
+	sort.Strings(ss)
+
+	return strings.Join(ss, ", ")
+}
@@ -0,0 +1,80 @@
+package wgtypes_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	var (
+		priv  = wgtest.MustPrivateKey()
+		psk   = wgtest.MustPresharedKey()
+		keyA  = wgtest.MustPublicKey()
+		keyB  = wgtest.MustPublicKey()
+		keyC  = wgtest.MustPublicKey()
+		ipA   = wgtest.MustCIDR("10.0.0.1/32")
+		ipB   = wgtest.MustCIDR("10.0.0.2/32")
+		epOld = wgtest.MustUDPAddr("192.0.2.1:51820")
+		epNew = wgtest.MustUDPAddr("192.0.2.2:51820")
+	)
+
+	a := &wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:  keyA,
+				Endpoint:   epOld,
+				AllowedIPs: []net.IPNet{ipA, ipB},
+			},
+			{PublicKey: keyB},
+		},
+	}
+
+	b := &wgtypes.Device{
+		Name:       "wg1",
+		PrivateKey: priv,
+		ListenPort: 51820,
+		AdvancedSecurity: wgtypes.AdvancedSecurity{
+			JunkPacketCount: 4,
+			// Magic headers use the full range of uint32.
+			InitPacketMagicHeader: 4294967295,
+		},
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:    keyA,
+				PresharedKey: psk,
+				Endpoint:     epNew,
+				// Statistics and allowed IP order are ignored.
+				LastHandshakeTime:           time.Unix(1, 0),
+				PersistentKeepaliveInterval: 25 * time.Second,
+				AllowedIPs:                  []net.IPNet{ipB, ipA},
+			},
+			{PublicKey: keyC},
+		},
+	}
+
+	want := []wgtypes.Change{
+		{Field: "PrivateKey", New: priv.String(), Secret: true},
+		{Field: "JunkPacketCount", New: "4"},
+		{Field: "InitPacketMagicHeader", New: "4294967295"},
+		{Field: "PresharedKey", Peer: &keyA, New: psk.String(), Secret: true},
+		{Field: "Endpoint", Peer: &keyA, Old: epOld.String(), New: epNew.String()},
+		{Field: "PersistentKeepaliveInterval", Peer: &keyA, New: "25s"},
+		{Field: "Peer", Peer: &keyB, Old: keyB.String()},
+		{Field: "Peer", Peer: &keyC, New: keyC.String()},
+	}
+
+	if diff := cmp.Diff(want, wgtypes.Diff(a, b)); diff != "" {
+		t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+	}
+
+	if cs := wgtypes.Diff(b, b); len(cs) != 0 {
+		t.Fatalf("expected no changes for identical devices, but got: %v", cs)
+	}
+}
@@ -8,3 +8,8 @@ import (
 // the PeerConfig UpdateOnly flag.
 var ErrUpdateOnlyNotSupported = errors.New("the UpdateOnly flag is not supported by this platform")
 
+// ErrAdvancedSecurityNotSupported is returned due to missing kernel support of
+// the AdvancedSecurityConfig fields added in AmneziaWG 1.5: S3, S4, I1 to I5
+// and Itime.
+var ErrAdvancedSecurityNotSupported = errors.New("the AmneziaWG 1.5 parameters are not supported by this platform")
+
@@ -0,0 +1,137 @@
+package wgtypes
+
+import (
+	"sort"
+	"sync"
+)
+
+// A PeerLocation identifies a Peer configured on a Device.
+type PeerLocation struct {
+	Device *Device
+	Peer   *Peer
+}
+
+// A PeerIndex maps peer public keys to the devices they are configured on,
+// such as for controllers which manage many devices and must frequently
+// determine which device a peer belongs to.
+//
+// A PeerIndex is built from the output of Devices, and can be kept current by
+// calling Update and Remove as devices change. It is safe for concurrent use.
+type PeerIndex struct {
+	mu      sync.RWMutex
+	devices map[string]*Device
+	peers   map[Key][]PeerLocation
+}
+
+// NewPeerIndex creates a PeerIndex containing the peers of each device in ds.
+func NewPeerIndex(ds []*Device) *PeerIndex {
+	x := &PeerIndex{
+		devices: make(map[string]*Device, len(ds)),
+		peers:   make(map[Key][]PeerLocation),
+	}
+
+	for _, d := range ds {
+		x.remove(d.Name)
+		x.add(d)
+	}
+
+	return x
+}
+
+// Lookup returns the location of each peer with public key k, ordered by
+// device name. Lookup returns nil if no such peer exists.
+func (x *PeerIndex) Lookup(k Key) []PeerLocation {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	locs := x.peers[k]
+	if len(locs) == 0 {
+		return nil
+	}
+
+	out := make([]PeerLocation, len(locs))
+	copy(out, locs)
+	return out
+}
+
+// Device returns the indexed device specified by name, or nil if none exists.
+func (x *PeerIndex) Device(name string) *Device {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return x.devices[name]
+}
+
+// Len returns the number of distinct peer public keys in the index.
+func (x *PeerIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return len(x.peers)
+}
+
+// Update adds d to the index, replacing any previously indexed device with
+// the same name.
+func (x *PeerIndex) Update(d *Device) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(d.Name)
+	x.add(d)
+}
+
+// Remove removes the device specified by name and its peers from the index.
+func (x *PeerIndex) Remove(name string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(name)
+}
+
+// add indexes d. The caller must hold x.mu.
+func (x *PeerIndex) add(d *Device) {
+	x.devices[d.Name] = d
+
+	for i := range d.Peers {
+		k := d.Peers[i].PublicKey
+		locs := append(x.peers[k], PeerLocation{
+			Device: d,
+			Peer:   &d.Peers[i],
+		})
+
+		// A peer is rarely configured on more than a couple of devices, so
+		// keeping the list sorted is cheap.
+		sort.SliceStable(locs, func(i, j int) bool {
+			return locs[i].Device.Name < locs[j].Device.Name
+		})
+
+		x.peers[k] = locs
+	}
+}
+
+// remove removes the device specified by name. The caller must hold x.mu.
+func (x *PeerIndex) remove(name string) {
+	d, ok := x.devices[name]
+	if !ok {
+		return
+	}
+	delete(x.devices, name)
+
+	for _, p := range d.Peers {
+		locs := x.peers[p.PublicKey]
+
+		n := 0
+		for _, l := range locs {
+			if l.Device != d {
+				locs[n] = l
+				n++
+			}
+		}
+
+		if n == 0 {
+			delete(x.peers, p.PublicKey)
+		} else {
+			x.peers[p.PublicKey] = locs[:n]
+		}
+	}
+}
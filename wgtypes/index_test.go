@@ -0,0 +1,98 @@
+package wgtypes_test
+
+import (
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPeerIndex(t *testing.T) {
+	var (
+		peerA  = wgtest.MustPublicKey()
+		peerB  = wgtest.MustPublicKey()
+		shared = wgtest.MustPublicKey()
+	)
+
+	wg0 := &wgtypes.Device{
+		Name:  "wg0",
+		Peers: []wgtypes.Peer{{PublicKey: peerA}, {PublicKey: shared}},
+	}
+	wg1 := &wgtypes.Device{
+		Name:  "wg1",
+		Peers: []wgtypes.Peer{{PublicKey: shared}, {PublicKey: peerB}},
+	}
+
+	// Index the devices out of order to verify locations are sorted.
+	x := wgtypes.NewPeerIndex([]*wgtypes.Device{wg1, wg0})
+
+	// lookup returns the device names for a peer.
+	lookup := func(k wgtypes.Key) []string {
+		var names []string
+		for _, l := range x.Lookup(k) {
+			if l.Peer.PublicKey != k {
+				t.Fatalf("unexpected peer %s in location for %s", l.Peer.PublicKey, k)
+			}
+
+			names = append(names, l.Device.Name)
+		}
+
+		return names
+	}
+
+	check := func(want map[wgtypes.Key][]string) {
+		t.Helper()
+
+		got := make(map[wgtypes.Key][]string)
+		for _, k := range []wgtypes.Key{peerA, peerB, shared} {
+			if names := lookup(k); names != nil {
+				got[k] = names
+			}
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected locations (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff(len(want), x.Len()); diff != "" {
+			t.Fatalf("unexpected length (-want +got):\n%s", diff)
+		}
+	}
+
+	check(map[wgtypes.Key][]string{
+		peerA:  {"wg0"},
+		peerB:  {"wg1"},
+		shared: {"wg0", "wg1"},
+	})
+
+	// Move peerB from wg1 to wg0.
+	x.Update(&wgtypes.Device{
+		Name:  "wg0",
+		Peers: []wgtypes.Peer{{PublicKey: peerA}, {PublicKey: shared}, {PublicKey: peerB}},
+	})
+	x.Update(&wgtypes.Device{
+		Name:  "wg1",
+		Peers: []wgtypes.Peer{{PublicKey: shared}},
+	})
+
+	check(map[wgtypes.Key][]string{
+		peerA:  {"wg0"},
+		peerB:  {"wg0"},
+		shared: {"wg0", "wg1"},
+	})
+
+	x.Remove("wg0")
+	x.Remove("wg2")
+
+	check(map[wgtypes.Key][]string{
+		shared: {"wg1"},
+	})
+
+	if x.Device("wg0") != nil {
+		t.Fatal("device wg0 should have been removed")
+	}
+	if x.Device("wg1") == nil {
+		t.Fatal("device wg1 should be indexed")
+	}
+}
@@ -0,0 +1,347 @@
+package wgtypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// MarshalText implements encoding.TextMarshaler, encoding k in base64 as with
+// the String method. Keys are encoded as JSON strings, and may be used as JSON
+// object keys.
+func (k Key) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, decoding a base64 key as
+// with ParseKey.
+func (k *Key) UnmarshalText(b []byte) error {
+	key, err := ParseKey(string(b))
+	if err != nil {
+		return err
+	}
+
+	*k = key
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding dt as with the
+// String method.
+func (dt DeviceType) MarshalText() ([]byte, error) {
+	return []byte(dt.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, decoding the output of
+// the String method.
+func (dt *DeviceType) UnmarshalText(b []byte) error {
+	for t := Unknown; t <= Userspace; t++ {
+		if t.String() == string(b) {
+			*dt = t
+			return nil
+		}
+	}
+
+	return fmt.Errorf("wgtypes: unknown device type %q", b)
+}
+
+// MarshalJSON implements json.Marshaler, encoding each field of a as a number
+// or string named by its AmneziaWG UAPI key, such as "jc", "h1", or "i1". As
+// with WriteUAPI, the AmneziaWG 1.5 fields are omitted unless they are set.
+func (a AdvancedSecurity) MarshalJSON() ([]byte, error) {
+	fs := a.uapiFields()
+	m := make(map[string]interface{}, len(fs))
+	for _, f := range fs {
+		switch {
+		case f.optional && f.isZero():
+		case f.u16 != nil:
+			m[f.key] = *f.u16
+		case f.u32 != nil:
+			m[f.key] = *f.u32
+		default:
+			m[f.key] = *f.str
+		}
+	}
+
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding the output of
+// MarshalJSON. Missing fields are zero.
+func (a *AdvancedSecurity) UnmarshalJSON(b []byte) error {
+	m, err := unmarshalUAPIJSON(b)
+	if err != nil {
+		return err
+	}
+
+	var out AdvancedSecurity
+	for k, v := range m {
+		ok, err := out.ParseUAPI(k, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("wgtypes: unknown advanced security field %q", k)
+		}
+	}
+
+	*a = out
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding each non-nil field of c as
+// a number or string named by its AmneziaWG UAPI key, such as "jc", "h1", or
+// "i1". Nil fields are omitted.
+func (c AdvancedSecurityConfig) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{})
+	for _, f := range c.uapiFields() {
+		switch {
+		case f.u16 != nil && *f.u16 != nil:
+			m[f.key] = **f.u16
+		case f.u32 != nil && *f.u32 != nil:
+			m[f.key] = **f.u32
+		case f.str != nil && *f.str != nil:
+			m[f.key] = **f.str
+		}
+	}
+
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding the output of
+// MarshalJSON. Missing fields are nil.
+func (c *AdvancedSecurityConfig) UnmarshalJSON(b []byte) error {
+	m, err := unmarshalUAPIJSON(b)
+	if err != nil {
+		return err
+	}
+
+	var out AdvancedSecurityConfig
+	for k, v := range m {
+		ok, err := out.ParseUAPI(k, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("wgtypes: unknown advanced security field %q", k)
+		}
+	}
+
+	*c = out
+	return nil
+}
+
+// unmarshalUAPIJSON decodes a JSON object of AmneziaWG fields into their UAPI
+// values. Fields of string keys such as "i1" must be strings, and all others
+// must be unsigned integers.
+func unmarshalUAPIJSON(b []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if isUAPIString(k) {
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				return nil, fmt.Errorf("wgtypes: invalid advanced security field %q: %v", k, err)
+			}
+			m[k] = s
+			continue
+		}
+
+		var u uint64
+		if err := json.Unmarshal(v, &u); err != nil {
+			return nil, fmt.Errorf("wgtypes: invalid advanced security field %q: %v", k, err)
+		}
+		m[k] = strconv.FormatUint(u, 10)
+	}
+
+	return m, nil
+}
+
+// jsonDevice is the JSON representation of a Device.
+type jsonDevice struct {
+	Name             string            `json:"name"`
+	Index            int               `json:"index,omitempty"`
+	Type             DeviceType        `json:"type"`
+	PrivateKey       *Key              `json:"private_key,omitempty"`
+	PublicKey        *Key              `json:"public_key,omitempty"`
+	ListenPort       int               `json:"listen_port"`
+	FirewallMark     int               `json:"firewall_mark,omitempty"`
+	AdvancedSecurity *AdvancedSecurity `json:"advanced_security,omitempty"`
+	Peers            []Peer            `json:"peers"`
+}
+
+// MarshalJSON implements json.Marshaler. Keys are base64-encoded, and keys
+// and AmneziaWG parameters which are unset are omitted. The private key is
+// included if it is set; use Redacted to omit it.
+func (d Device) MarshalJSON() ([]byte, error) {
+	jd := jsonDevice{
+		Name:         d.Name,
+		Index:        d.Index,
+		Type:         d.Type,
+		PrivateKey:   optionalKey(d.PrivateKey),
+		PublicKey:    optionalKey(d.PublicKey),
+		ListenPort:   d.ListenPort,
+		FirewallMark: d.FirewallMark,
+		Peers:        d.Peers,
+	}
+	if d.AdvancedSecurity.IsEnabled() {
+		jd.AdvancedSecurity = &d.AdvancedSecurity
+	}
+	if jd.Peers == nil {
+		jd.Peers = []Peer{}
+	}
+
+	return json.Marshal(jd)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding the output of
+// MarshalJSON.
+func (d *Device) UnmarshalJSON(b []byte) error {
+	var jd jsonDevice
+	if err := json.Unmarshal(b, &jd); err != nil {
+		return err
+	}
+
+	*d = Device{
+		Name:         jd.Name,
+		Index:        jd.Index,
+		Type:         jd.Type,
+		PrivateKey:   valueKey(jd.PrivateKey),
+		PublicKey:    valueKey(jd.PublicKey),
+		ListenPort:   jd.ListenPort,
+		FirewallMark: jd.FirewallMark,
+		Peers:        jd.Peers,
+	}
+	if jd.AdvancedSecurity != nil {
+		d.AdvancedSecurity = *jd.AdvancedSecurity
+	}
+
+	return nil
+}
+
+// jsonPeer is the JSON representation of a Peer.
+type jsonPeer struct {
+	PublicKey           Key        `json:"public_key"`
+	PresharedKey        *Key       `json:"preshared_key,omitempty"`
+	Endpoint            string     `json:"endpoint,omitempty"`
+	PersistentKeepalive int        `json:"persistent_keepalive,omitempty"`
+	LastHandshakeTime   *time.Time `json:"last_handshake_time,omitempty"`
+	ReceiveBytes        int64      `json:"receive_bytes"`
+	TransmitBytes       int64      `json:"transmit_bytes"`
+	AllowedIPs          []string   `json:"allowed_ips"`
+	ProtocolVersion     int        `json:"protocol_version,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Keys are base64-encoded, the
+// endpoint and allowed IPs are strings, the persistent keepalive interval is
+// in whole seconds, and the last handshake time is in RFC 3339 format. Unset
+// fields are omitted. The preshared key is included if it is set; use
+// Device.Redacted to omit it. Allowed IPs held by LazyAllowedIPs are decoded.
+func (p Peer) MarshalJSON() ([]byte, error) {
+	ipns, err := p.LoadAllowedIPs()
+	if err != nil {
+		return nil, err
+	}
+
+	jp := jsonPeer{
+		PublicKey:           p.PublicKey,
+		PresharedKey:        optionalKey(p.PresharedKey),
+		PersistentKeepalive: int(p.PersistentKeepaliveInterval / time.Second),
+		ReceiveBytes:        p.ReceiveBytes,
+		TransmitBytes:       p.TransmitBytes,
+		AllowedIPs:          make([]string, 0, len(ipns)),
+		ProtocolVersion:     p.ProtocolVersion,
+	}
+	if p.Endpoint != nil {
+		jp.Endpoint = p.Endpoint.String()
+	}
+	if !p.LastHandshakeTime.IsZero() {
+		t := p.LastHandshakeTime
+		jp.LastHandshakeTime = &t
+	}
+	for _, ipn := range ipns {
+		jp.AllowedIPs = append(jp.AllowedIPs, ipn.String())
+	}
+
+	return json.Marshal(jp)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding the output of
+// MarshalJSON. Endpoints must be IP addresses; host names are not resolved.
+func (p *Peer) UnmarshalJSON(b []byte) error {
+	var jp jsonPeer
+	if err := json.Unmarshal(b, &jp); err != nil {
+		return err
+	}
+
+	out := Peer{
+		PublicKey:                   jp.PublicKey,
+		PresharedKey:                valueKey(jp.PresharedKey),
+		PersistentKeepaliveInterval: time.Duration(jp.PersistentKeepalive) * time.Second,
+		ReceiveBytes:                jp.ReceiveBytes,
+		TransmitBytes:               jp.TransmitBytes,
+		ProtocolVersion:             jp.ProtocolVersion,
+	}
+
+	if jp.Endpoint != "" {
+		ap, err := netip.ParseAddrPort(jp.Endpoint)
+		if err != nil {
+			return fmt.Errorf("wgtypes: invalid peer endpoint: %v", err)
+		}
+
+		out.Endpoint = net.UDPAddrFromAddrPort(ap)
+	}
+	if jp.LastHandshakeTime != nil {
+		out.LastHandshakeTime = *jp.LastHandshakeTime
+	}
+	for _, s := range jp.AllowedIPs {
+		_, ipn, err := net.ParseCIDR(s)
+		if err != nil {
+			return fmt.Errorf("wgtypes: invalid peer allowed IP: %v", err)
+		}
+
+		out.AllowedIPs = append(out.AllowedIPs, *ipn)
+	}
+
+	*p = out
+	return nil
+}
+
+// Redacted returns a copy of d without its private key or the preshared keys
+// of its peers, such as for serializing device state to a dashboard. d is
+// not modified.
+func (d *Device) Redacted() *Device {
+	out := *d
+	out.PrivateKey = Key{}
+	out.Peers = make([]Peer, len(d.Peers))
+	for i, p := range d.Peers {
+		p.PresharedKey = Key{}
+		out.Peers[i] = p
+	}
+
+	return &out
+}
+
+// optionalKey returns a pointer to a copy of k, or nil if k is the zero Key.
+func optionalKey(k Key) *Key {
+	if k == (Key{}) {
+		return nil
+	}
+
+	return &k
+}
+
+// valueKey returns the Key k points to, or the zero Key if k is nil.
+func valueKey(k *Key) Key {
+	if k == nil {
+		return Key{}
+	}
+
+	return *k
+}
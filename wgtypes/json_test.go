@@ -0,0 +1,265 @@
+package wgtypes_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDeviceJSON(t *testing.T) {
+	var (
+		priv = wgtest.MustHexKey("e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a")
+		pub  = wgtest.MustHexKey("b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33")
+		psk  = wgtest.MustHexKey("188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52")
+	)
+
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		Type:       wgtypes.LinuxKernel,
+		PrivateKey: priv,
+		PublicKey:  priv.PublicKey(),
+		ListenPort: 51820,
+		AdvancedSecurity: wgtypes.AdvancedSecurity{
+			JunkPacketCount:       4,
+			InitPacketMagicHeader: 123456,
+		},
+		Peers: []wgtypes.Peer{{
+			PublicKey:                   pub,
+			PresharedKey:                psk,
+			Endpoint:                    wgtest.MustUDPAddr("[2001:db8::1]:51820"),
+			PersistentKeepaliveInterval: 25 * time.Second,
+			LastHandshakeTime:           time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			ReceiveBytes:                1024,
+			TransmitBytes:               2048,
+			AllowedIPs: []net.IPNet{
+				wgtest.MustCIDR("10.0.0.2/32"),
+				wgtest.MustCIDR("fd00::2/128"),
+			},
+			ProtocolVersion: 1,
+		}},
+	}
+
+	want := `{
+	"name": "wg0",
+	"type": "Linux kernel",
+	"private_key": "6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA/rpSAno=",
+	"public_key": "` + d.PublicKey.String() + `",
+	"listen_port": 51820,
+	"advanced_security": {
+		"h1": 123456,
+		"h2": 0,
+		"h3": 0,
+		"h4": 0,
+		"jc": 4,
+		"jmax": 0,
+		"jmin": 0,
+		"s1": 0,
+		"s2": 0
+	},
+	"peers": [
+		{
+			"public_key": "uFmW/sycfx/G0lcqdu2hHVm80gvo5UOxXOS9hajnWjM=",
+			"preshared_key": "GIUVCT6VL18i6GXO8wEucvi18LWYrAMJ1drM47cPz1I=",
+			"endpoint": "[2001:db8::1]:51820",
+			"persistent_keepalive": 25,
+			"last_handshake_time": "2020-01-02T03:04:05Z",
+			"receive_bytes": 1024,
+			"transmit_bytes": 2048,
+			"allowed_ips": [
+				"10.0.0.2/32",
+				"fd00::2/128"
+			],
+			"protocol_version": 1
+		}
+	]
+}`
+
+	b, err := json.MarshalIndent(d, "", "\t")
+	if err != nil {
+		t.Fatalf("failed to marshal device: %v", err)
+	}
+
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("unexpected JSON (-want +got):\n%s", diff)
+	}
+
+	var got wgtypes.Device
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("failed to unmarshal device: %v", err)
+	}
+
+	if diff := cmp.Diff(d, &got); diff != "" {
+		t.Fatalf("unexpected round trip device (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeviceRedacted(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+		pub  = wgtest.MustPublicKey()
+	)
+
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		PrivateKey: priv,
+		PublicKey:  priv.PublicKey(),
+		Peers: []wgtypes.Peer{{
+			PublicKey:    pub,
+			PresharedKey: psk,
+		}},
+	}
+
+	want := &wgtypes.Device{
+		Name:      "wg0",
+		PublicKey: priv.PublicKey(),
+		Peers: []wgtypes.Peer{{
+			PublicKey: pub,
+		}},
+	}
+
+	got := d.Redacted()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected redacted device (-want +got):\n%s", diff)
+	}
+
+	// The original device must not be modified.
+	if d.PrivateKey != priv || d.Peers[0].PresharedKey != psk {
+		t.Fatal("Redacted modified the original device")
+	}
+
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("failed to marshal device: %v", err)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("failed to unmarshal device: %v", err)
+	}
+	if _, ok := m["private_key"]; ok {
+		t.Fatal("redacted device JSON contains a private key")
+	}
+	if _, ok := m["peers"].([]interface{})[0].(map[string]interface{})["preshared_key"]; ok {
+		t.Fatal("redacted device JSON contains a preshared key")
+	}
+}
+
+func TestAdvancedSecurityConfigJSON(t *testing.T) {
+	var (
+		jc = uint16(4)
+		h1 = uint32(123456)
+	)
+
+	asc := wgtypes.AdvancedSecurityConfig{
+		JunkPacketCount:       &jc,
+		InitPacketMagicHeader: &h1,
+	}
+
+	b, err := json.Marshal(asc)
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+
+	if diff := cmp.Diff(`{"h1":123456,"jc":4}`, string(b)); diff != "" {
+		t.Fatalf("unexpected JSON (-want +got):\n%s", diff)
+	}
+
+	var got wgtypes.AdvancedSecurityConfig
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("failed to unmarshal config: %v", err)
+	}
+
+	if diff := cmp.Diff(asc, got); diff != "" {
+		t.Fatalf("unexpected round trip config (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvancedSecurityJSONVersion15(t *testing.T) {
+	as := wgtypes.AdvancedSecurity{
+		JunkPacketCount:         4,
+		TransportPacketJunkSize: 40,
+		SpecialJunkPacket1:      "<b 0xf6ab3267fa><r 10>",
+	}
+
+	b, err := json.Marshal(as)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	const want = `{"h1":0,"h2":0,"h3":0,"h4":0,"i1":"\u003cb 0xf6ab3267fa\u003e\u003cr 10\u003e","jc":4,"jmax":0,"jmin":0,"s1":0,"s2":0,"s4":40}`
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("unexpected JSON (-want +got):\n%s", diff)
+	}
+
+	var got wgtypes.AdvancedSecurity
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(as, got); diff != "" {
+		t.Fatalf("unexpected round trip (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		b    string
+	}{
+		{
+			name: "bad key",
+			v:    new(wgtypes.Key),
+			b:    `"foo"`,
+		},
+		{
+			name: "bad device type",
+			v:    new(wgtypes.Device),
+			b:    `{"type":"foo"}`,
+		},
+		{
+			name: "bad endpoint",
+			v:    new(wgtypes.Peer),
+			b:    `{"endpoint":"example.com:51820"}`,
+		},
+		{
+			name: "bad allowed IP",
+			v:    new(wgtypes.Peer),
+			b:    `{"allowed_ips":["10.0.0.1"]}`,
+		},
+		{
+			name: "unknown advanced security field",
+			v:    new(wgtypes.AdvancedSecurityConfig),
+			b:    `{"foo":1}`,
+		},
+		{
+			name: "advanced security out of range",
+			v:    new(wgtypes.AdvancedSecurity),
+			b:    `{"jc":65536}`,
+		},
+		{
+			name: "advanced security number as string",
+			v:    new(wgtypes.AdvancedSecurityConfig),
+			b:    `{"jc":"4"}`,
+		},
+		{
+			name: "advanced security string as number",
+			v:    new(wgtypes.AdvancedSecurityConfig),
+			b:    `{"i1":4}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(tt.b), tt.v); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
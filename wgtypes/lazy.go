@@ -0,0 +1,48 @@
+package wgtypes
+
+import (
+	"net"
+	"sync"
+)
+
+// LazyAllowedIPs holds the allowed IPs of a Peer in the form reported by its
+// WireGuard implementation, and decodes them on first use. It allows callers
+// which frequently fetch devices only to read counters and handshake times to
+// skip decoding peers with many allowed IPs. LazyAllowedIPs is safe for
+// concurrent use.
+type LazyAllowedIPs struct {
+	once   sync.Once
+	decode func() ([]net.IPNet, error)
+	ipns   []net.IPNet
+	err    error
+}
+
+// NewLazyAllowedIPs returns a LazyAllowedIPs which calls decode on the first
+// call to its Decode method. It is intended for use by WireGuard
+// implementations.
+func NewLazyAllowedIPs(decode func() ([]net.IPNet, error)) *LazyAllowedIPs {
+	return &LazyAllowedIPs{decode: decode}
+}
+
+// Decode decodes the allowed IPs on its first call, and returns the result of
+// that call on every call. The returned slice is shared by all callers and
+// must not be modified.
+func (l *LazyAllowedIPs) Decode() ([]net.IPNet, error) {
+	l.once.Do(func() {
+		l.ipns, l.err = l.decode()
+		l.decode = nil
+	})
+
+	return l.ipns, l.err
+}
+
+// LoadAllowedIPs returns the allowed IPs of p, decoding them from
+// p.LazyAllowedIPs if they were deferred. The returned slice must not be
+// modified.
+func (p Peer) LoadAllowedIPs() ([]net.IPNet, error) {
+	if p.LazyAllowedIPs == nil {
+		return p.AllowedIPs, nil
+	}
+
+	return p.LazyAllowedIPs.Decode()
+}
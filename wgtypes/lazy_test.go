@@ -0,0 +1,107 @@
+package wgtypes_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPeerLoadAllowedIPs(t *testing.T) {
+	ipns := []net.IPNet{
+		wgtest.MustCIDR("192.0.2.0/24"),
+		wgtest.MustCIDR("2001:db8::/32"),
+	}
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+
+	lazy := wgtypes.NewLazyAllowedIPs(func() ([]net.IPNet, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+
+		return ipns, nil
+	})
+
+	p := wgtypes.Peer{
+		PublicKey:      wgtest.MustPublicKey(),
+		LazyAllowedIPs: lazy,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			got, err := p.LoadAllowedIPs()
+			if err != nil {
+				t.Errorf("failed to load allowed IPs: %v", err)
+				return
+			}
+			if diff := cmp.Diff(ipns, got); diff != "" {
+				t.Errorf("unexpected allowed IPs (-want +got):\n%s", diff)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if diff := cmp.Diff(1, calls); diff != "" {
+		t.Fatalf("unexpected number of decode calls (-want +got):\n%s", diff)
+	}
+
+	// Allowed IPs which were not deferred are returned as is.
+	eager := wgtypes.Peer{
+		PublicKey:  p.PublicKey,
+		AllowedIPs: ipns,
+	}
+	got, err := eager.LoadAllowedIPs()
+	if err != nil {
+		t.Fatalf("failed to load allowed IPs: %v", err)
+	}
+	if diff := cmp.Diff(ipns, got); diff != "" {
+		t.Fatalf("unexpected allowed IPs (-want +got):\n%s", diff)
+	}
+
+	// Deferred allowed IPs are encoded as JSON as if they had been decoded.
+	want, err := json.Marshal(eager)
+	if err != nil {
+		t.Fatalf("failed to marshal peer: %v", err)
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("failed to marshal lazy peer: %v", err)
+	}
+	if diff := cmp.Diff(string(want), string(b)); diff != "" {
+		t.Fatalf("unexpected JSON (-want +got):\n%s", diff)
+	}
+}
+
+func TestPeerLoadAllowedIPsError(t *testing.T) {
+	errDecode := errors.New("bad allowed IPs")
+
+	p := wgtypes.Peer{
+		LazyAllowedIPs: wgtypes.NewLazyAllowedIPs(func() ([]net.IPNet, error) {
+			return nil, errDecode
+		}),
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.LoadAllowedIPs(); !errors.Is(err, errDecode) {
+			t.Fatalf("expected decode error, but got: %v", err)
+		}
+	}
+
+	if _, err := json.Marshal(p); !errors.Is(err, errDecode) {
+		t.Fatalf("expected decode error from JSON, but got: %v", err)
+	}
+}
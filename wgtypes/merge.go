@@ -0,0 +1,132 @@
+package wgtypes
+
+import (
+	"bytes"
+	"net"
+)
+
+// Merge combines base and override into a single Config, so that layered
+// configurations such as defaults, site, and node settings can be composed.
+// Neither argument is modified.
+//
+// For each pointer field of the Config and its AdvancedSecurityConfig, a
+// non-nil value in override takes precedence over base. ReplacePeers is set
+// if it is set in either Config.
+//
+// Peers are merged by public key, in the order they first appear in base and
+// then override. For a peer which appears in both:
+//   - if override removes the peer, the result only removes the peer;
+//   - otherwise, non-nil pointer fields and AlternateEndpoints of override
+//     take precedence, the result is UpdateOnly only if both are, and
+//     ReplaceAllowedIPs is set if it is set in either;
+//   - allowed IPs are the union of both lists, unless override replaces
+//     allowed IPs, in which case only its allowed IPs are used.
+func Merge(base, override Config) Config {
+	out := Config{
+		PrivateKey:   base.PrivateKey,
+		ListenPort:   base.ListenPort,
+		FirewallMark: base.FirewallMark,
+		ReplacePeers: base.ReplacePeers || override.ReplacePeers,
+
+		AdvancedSecurityConfig: base.AdvancedSecurityConfig,
+	}
+
+	if override.PrivateKey != nil {
+		out.PrivateKey = override.PrivateKey
+	}
+	if override.ListenPort != nil {
+		out.ListenPort = override.ListenPort
+	}
+	if override.FirewallMark != nil {
+		out.FirewallMark = override.FirewallMark
+	}
+
+	// Both lists of fields are in UAPI order.
+	ofs := out.AdvancedSecurityConfig.uapiFields()
+	for i, f := range override.AdvancedSecurityConfig.uapiFields() {
+		switch {
+		case f.u16 != nil && *f.u16 != nil:
+			*ofs[i].u16 = *f.u16
+		case f.u32 != nil && *f.u32 != nil:
+			*ofs[i].u32 = *f.u32
+		case f.str != nil && *f.str != nil:
+			*ofs[i].str = *f.str
+		}
+	}
+
+	index := make(map[Key]int, len(base.Peers)+len(override.Peers))
+	for _, ps := range [][]PeerConfig{base.Peers, override.Peers} {
+		for _, p := range ps {
+			i, ok := index[p.PublicKey]
+			if !ok {
+				p.AllowedIPs = append([]net.IPNet(nil), p.AllowedIPs...)
+				index[p.PublicKey] = len(out.Peers)
+				out.Peers = append(out.Peers, p)
+				continue
+			}
+
+			out.Peers[i] = mergePeer(out.Peers[i], p)
+		}
+	}
+
+	return out
+}
+
+// mergePeer merges two configurations of the same peer, as described by
+// Merge.
+func mergePeer(base, override PeerConfig) PeerConfig {
+	if override.Remove {
+		return PeerConfig{PublicKey: override.PublicKey, Remove: true}
+	}
+	if base.Remove {
+		// The peer is added again by override.
+		base = PeerConfig{PublicKey: base.PublicKey}
+	}
+
+	out := base
+	out.UpdateOnly = base.UpdateOnly && override.UpdateOnly
+	out.ReplaceAllowedIPs = base.ReplaceAllowedIPs || override.ReplaceAllowedIPs
+
+	if override.PresharedKey != nil {
+		out.PresharedKey = override.PresharedKey
+	}
+	if override.Endpoint != nil {
+		out.Endpoint = override.Endpoint
+	}
+	if override.AlternateEndpoints != nil {
+		out.AlternateEndpoints = override.AlternateEndpoints
+	}
+	if override.PersistentKeepaliveInterval != nil {
+		out.PersistentKeepaliveInterval = override.PersistentKeepaliveInterval
+	}
+
+	if override.ReplaceAllowedIPs {
+		out.AllowedIPs = append([]net.IPNet(nil), override.AllowedIPs...)
+		return out
+	}
+
+	out.AllowedIPs = append([]net.IPNet(nil), base.AllowedIPs...)
+	for _, ipn := range override.AllowedIPs {
+		if !containsIPNet(out.AllowedIPs, ipn) {
+			out.AllowedIPs = append(out.AllowedIPs, ipn)
+		}
+	}
+
+	return out
+}
+
+// containsIPNet reports whether ipns contains a network equal to ipn.
+func containsIPNet(ipns []net.IPNet, ipn net.IPNet) bool {
+	for _, n := range ipns {
+		if equalIPNet(n, ipn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// equalIPNet reports whether a and b are the same network.
+func equalIPNet(a, b net.IPNet) bool {
+	return a.IP.Equal(b.IP) && bytes.Equal(a.Mask, b.Mask)
+}
@@ -0,0 +1,128 @@
+package wgtypes_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMerge(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		keyC = wgtest.MustPublicKey()
+		keyD = wgtest.MustPublicKey()
+		ipA  = wgtest.MustCIDR("10.0.0.1/32")
+		ipB  = wgtest.MustCIDR("10.0.0.2/32")
+		ipC  = wgtest.MustCIDR("10.0.0.3/32")
+		epA  = wgtest.MustUDPAddr("192.0.2.1:51820")
+		epB  = wgtest.MustUDPAddr("192.0.2.2:51820")
+
+		portA, portB = 51820, 51821
+		mark         = 1
+		jc, jmin     = uint16(4), uint16(40)
+		h1           = uint32(5)
+		keepalive    = 25 * time.Second
+	)
+
+	base := wgtypes.Config{
+		PrivateKey: &priv,
+		ListenPort: &portA,
+		AdvancedSecurityConfig: wgtypes.AdvancedSecurityConfig{
+			JunkPacketCount:       &jc,
+			InitPacketMagicHeader: &h1,
+		},
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:                   keyA,
+				Endpoint:                    epA,
+				AlternateEndpoints:          []*net.UDPAddr{epB},
+				PersistentKeepaliveInterval: &keepalive,
+				AllowedIPs:                  []net.IPNet{ipA},
+			},
+			{
+				PublicKey:  keyB,
+				UpdateOnly: true,
+				AllowedIPs: []net.IPNet{ipA},
+			},
+			{PublicKey: keyC},
+		},
+	}
+
+	override := wgtypes.Config{
+		ListenPort:   &portB,
+		FirewallMark: &mark,
+		ReplacePeers: true,
+		AdvancedSecurityConfig: wgtypes.AdvancedSecurityConfig{
+			JunkPacketMinSize: &jmin,
+		},
+		Peers: []wgtypes.PeerConfig{
+			{PublicKey: keyD},
+			{
+				PublicKey:    keyA,
+				PresharedKey: &psk,
+				Endpoint:     epB,
+				AllowedIPs:   []net.IPNet{ipA, ipB},
+			},
+			{
+				PublicKey:          keyB,
+				AlternateEndpoints: []*net.UDPAddr{epA},
+				ReplaceAllowedIPs:  true,
+				AllowedIPs:         []net.IPNet{ipC},
+			},
+			{PublicKey: keyC, Remove: true},
+		},
+	}
+
+	want := wgtypes.Config{
+		PrivateKey:   &priv,
+		ListenPort:   &portB,
+		FirewallMark: &mark,
+		ReplacePeers: true,
+		AdvancedSecurityConfig: wgtypes.AdvancedSecurityConfig{
+			JunkPacketCount:       &jc,
+			JunkPacketMinSize:     &jmin,
+			InitPacketMagicHeader: &h1,
+		},
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:                   keyA,
+				PresharedKey:                &psk,
+				Endpoint:                    epB,
+				AlternateEndpoints:          []*net.UDPAddr{epB},
+				PersistentKeepaliveInterval: &keepalive,
+				AllowedIPs:                  []net.IPNet{ipA, ipB},
+			},
+			{
+				PublicKey:          keyB,
+				AlternateEndpoints: []*net.UDPAddr{epA},
+				ReplaceAllowedIPs:  true,
+				AllowedIPs:         []net.IPNet{ipC},
+			},
+			{PublicKey: keyC, Remove: true},
+			{PublicKey: keyD},
+		},
+	}
+
+	got := wgtypes.Merge(base, override)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected merged config (-want +got):\n%s", diff)
+	}
+
+	// The inputs must not be modified.
+	if diff := cmp.Diff(51820, *base.ListenPort); diff != "" {
+		t.Fatalf("base was modified (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]net.IPNet{ipA}, base.Peers[0].AllowedIPs); diff != "" {
+		t.Fatalf("base peers were modified (-want +got):\n%s", diff)
+	}
+	if base.AdvancedSecurityConfig.JunkPacketMinSize != nil {
+		t.Fatal("base advanced security config was modified")
+	}
+}
@@ -0,0 +1,86 @@
+package wgtypes
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultPersistentKeepalive is the persistent keepalive interval used by the
+// peer presets. It is short enough to keep most NAT and stateful firewall
+// mappings open, as recommended by wg(8).
+const DefaultPersistentKeepalive = 25 * time.Second
+
+// RoadWarriorPeer returns a PeerConfig for a roaming client, as seen by the
+// server it connects to. The peer is routed only its own tunnel addresses,
+// each as a single-host route, and has no endpoint: the server learns the
+// endpoint when the client connects. Keepalives are left to the client.
+//
+// An error is returned if any of addrs is not a valid IPv4 or IPv6 address.
+func RoadWarriorPeer(publicKey Key, addrs ...net.IP) (PeerConfig, error) {
+	allowed := make([]net.IPNet, 0, len(addrs))
+	for _, ip := range addrs {
+		n, err := hostRoute(ip)
+		if err != nil {
+			return PeerConfig{}, err
+		}
+
+		allowed = append(allowed, n)
+	}
+
+	return PeerConfig{
+		PublicKey:         publicKey,
+		ReplaceAllowedIPs: true,
+		AllowedIPs:        allowed,
+	}, nil
+}
+
+// SiteToSitePeer returns a PeerConfig for the gateway of a remote site at
+// endpoint, which is routed the site's networks. A persistent keepalive of
+// DefaultPersistentKeepalive keeps the tunnel up in both directions even
+// when no traffic is flowing.
+func SiteToSitePeer(publicKey Key, endpoint *net.UDPAddr, networks ...net.IPNet) PeerConfig {
+	keepalive := DefaultPersistentKeepalive
+
+	return PeerConfig{
+		PublicKey:                   publicKey,
+		Endpoint:                    endpoint,
+		PersistentKeepaliveInterval: &keepalive,
+		ReplaceAllowedIPs:           true,
+		AllowedIPs:                  append([]net.IPNet(nil), networks...),
+	}
+}
+
+// ExitNodePeer returns a PeerConfig for a server at endpoint which all
+// traffic is routed through, using the IPv4 and IPv6 default routes. A
+// persistent keepalive of DefaultPersistentKeepalive is used, as the local
+// device is typically behind NAT.
+func ExitNodePeer(publicKey Key, endpoint *net.UDPAddr) PeerConfig {
+	keepalive := DefaultPersistentKeepalive
+
+	return PeerConfig{
+		PublicKey:                   publicKey,
+		Endpoint:                    endpoint,
+		PersistentKeepaliveInterval: &keepalive,
+		ReplaceAllowedIPs:           true,
+		AllowedIPs: []net.IPNet{
+			{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 8*net.IPv4len)},
+			{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)},
+		},
+	}
+}
+
+// hostRoute returns a single-host route for ip.
+func hostRoute(ip net.IP) (net.IPNet, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return net.IPNet{IP: ip4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}, nil
+	}
+	if len(ip) == net.IPv6len {
+		return net.IPNet{
+			IP:   append(net.IP(nil), ip...),
+			Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len),
+		}, nil
+	}
+
+	return net.IPNet{}, fmt.Errorf("wgtypes: invalid tunnel address %q", ip)
+}
@@ -0,0 +1,110 @@
+package wgtypes_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPeerPresets(t *testing.T) {
+	var (
+		key       = wgtest.MustPublicKey()
+		endpoint  = wgtest.MustUDPAddr("192.0.2.1:51820")
+		keepalive = wgtypes.DefaultPersistentKeepalive
+	)
+
+	tests := []struct {
+		name string
+		fn   func() (wgtypes.PeerConfig, error)
+		cfg  wgtypes.PeerConfig
+		ok   bool
+	}{
+		{
+			name: "road warrior, bad address",
+			fn: func() (wgtypes.PeerConfig, error) {
+				return wgtypes.RoadWarriorPeer(key, net.IP{0xff})
+			},
+		},
+		{
+			name: "road warrior",
+			fn: func() (wgtypes.PeerConfig, error) {
+				return wgtypes.RoadWarriorPeer(key,
+					net.ParseIP("10.0.0.2"),
+					net.ParseIP("fd00::2"),
+				)
+			},
+			cfg: wgtypes.PeerConfig{
+				PublicKey:         key,
+				ReplaceAllowedIPs: true,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("10.0.0.2/32"),
+					wgtest.MustCIDR("fd00::2/128"),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "site to site",
+			fn: func() (wgtypes.PeerConfig, error) {
+				return wgtypes.SiteToSitePeer(key, endpoint,
+					wgtest.MustCIDR("192.168.10.0/24"),
+					wgtest.MustCIDR("fd10::/64"),
+				), nil
+			},
+			cfg: wgtypes.PeerConfig{
+				PublicKey:                   key,
+				Endpoint:                    endpoint,
+				PersistentKeepaliveInterval: &keepalive,
+				ReplaceAllowedIPs:           true,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("192.168.10.0/24"),
+					wgtest.MustCIDR("fd10::/64"),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "exit node",
+			fn: func() (wgtypes.PeerConfig, error) {
+				return wgtypes.ExitNodePeer(key, endpoint), nil
+			},
+			cfg: wgtypes.PeerConfig{
+				PublicKey:                   key,
+				Endpoint:                    endpoint,
+				PersistentKeepaliveInterval: &keepalive,
+				ReplaceAllowedIPs:           true,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("0.0.0.0/0"),
+					wgtest.MustCIDR("::/0"),
+				},
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.fn()
+			if tt.ok && err != nil {
+				t.Fatalf("failed to create peer: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tt.cfg, cfg); diff != "" {
+				t.Fatalf("unexpected peer config (-want +got):\n%s", diff)
+			}
+
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("preset is not valid: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package wgtypes
+
+import "net"
+
+// Preview returns a copy of d with cfg applied, as a WireGuard implementation
+// would apply it, without modifying any device. Comparing d and the result
+// using Diff reports the changes cfg would make, such as for a dry run.
+//
+// As with WireGuard itself, an allowed IP assigned to a peer is removed from
+// any other peer of the device. Runtime peer statistics of existing peers are
+// preserved, and are zero for new peers.
+func Preview(d *Device, cfg Config) *Device {
+	out := *d
+	out.Peers = make([]Peer, 0, len(d.Peers))
+	for _, p := range d.Peers {
+		p.AllowedIPs = append([]net.IPNet(nil), p.AllowedIPs...)
+		out.Peers = append(out.Peers, p)
+	}
+
+	if cfg.PrivateKey != nil {
+		out.PrivateKey = *cfg.PrivateKey
+		out.PublicKey = Key{}
+		if out.PrivateKey != (Key{}) {
+			out.PublicKey = out.PrivateKey.PublicKey()
+		}
+	}
+	if cfg.ListenPort != nil {
+		out.ListenPort = *cfg.ListenPort
+	}
+	if cfg.FirewallMark != nil {
+		out.FirewallMark = *cfg.FirewallMark
+	}
+	previewAdvancedSecurity(&out.AdvancedSecurity, cfg.AdvancedSecurityConfig)
+
+	if cfg.ReplacePeers {
+		out.Peers = out.Peers[:0]
+	}
+
+	for _, pc := range cfg.Peers {
+		i := -1
+		for j := range out.Peers {
+			if out.Peers[j].PublicKey == pc.PublicKey {
+				i = j
+				break
+			}
+		}
+
+		switch {
+		case pc.Remove:
+			if i >= 0 {
+				out.Peers = append(out.Peers[:i], out.Peers[i+1:]...)
+			}
+			continue
+		case i < 0 && pc.UpdateOnly:
+			continue
+		case i < 0:
+			out.Peers = append(out.Peers, Peer{PublicKey: pc.PublicKey})
+			i = len(out.Peers) - 1
+		}
+
+		p := &out.Peers[i]
+		if pc.PresharedKey != nil {
+			p.PresharedKey = *pc.PresharedKey
+		}
+		if pc.Endpoint != nil {
+			p.Endpoint = pc.Endpoint
+		}
+		if pc.PersistentKeepaliveInterval != nil {
+			p.PersistentKeepaliveInterval = *pc.PersistentKeepaliveInterval
+		}
+		if pc.ReplaceAllowedIPs {
+			p.AllowedIPs = nil
+		}
+
+		for _, ipn := range pc.AllowedIPs {
+			// Take the allowed IP from any peer which holds it.
+			for j := range out.Peers {
+				out.Peers[j].AllowedIPs = removeIPNet(out.Peers[j].AllowedIPs, ipn)
+			}
+
+			p.AllowedIPs = append(p.AllowedIPs, ipn)
+		}
+	}
+
+	return &out
+}
+
+// previewAdvancedSecurity sets each field of a which is set in c.
+func previewAdvancedSecurity(a *AdvancedSecurity, c AdvancedSecurityConfig) {
+	// Both lists of fields are in UAPI order.
+	afs := a.uapiFields()
+	for i, f := range c.uapiFields() {
+		switch {
+		case f.u16 != nil && *f.u16 != nil:
+			*afs[i].u16 = **f.u16
+		case f.u32 != nil && *f.u32 != nil:
+			*afs[i].u32 = **f.u32
+		case f.str != nil && *f.str != nil:
+			*afs[i].str = **f.str
+		}
+	}
+}
+
+// removeIPNet returns ipns without any network equal to ipn.
+func removeIPNet(ipns []net.IPNet, ipn net.IPNet) []net.IPNet {
+	out := ipns[:0]
+	for _, n := range ipns {
+		if !equalIPNet(n, ipn) {
+			out = append(out, n)
+		}
+	}
+
+	return out
+}
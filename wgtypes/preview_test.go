@@ -0,0 +1,108 @@
+package wgtypes_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPreview(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		keyC = wgtest.MustPublicKey()
+		keyD = wgtest.MustPublicKey()
+		ipA  = wgtest.MustCIDR("10.0.0.1/32")
+		ipB  = wgtest.MustCIDR("10.0.0.2/32")
+		ipC  = wgtest.MustCIDR("10.0.0.3/32")
+		ep   = wgtest.MustUDPAddr("192.0.2.1:51820")
+
+		port      = 51821
+		jc        = uint16(4)
+		keepalive = 25 * time.Second
+	)
+
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:    keyA,
+				AllowedIPs:   []net.IPNet{ipA, ipB},
+				ReceiveBytes: 1,
+			},
+			{PublicKey: keyB},
+			{PublicKey: keyC},
+		},
+	}
+
+	got := wgtypes.Preview(d, wgtypes.Config{
+		PrivateKey: &priv,
+		ListenPort: &port,
+		AdvancedSecurityConfig: wgtypes.AdvancedSecurityConfig{
+			JunkPacketCount: &jc,
+		},
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:    keyA,
+				PresharedKey: &psk,
+			},
+			{
+				// Takes ipB from peer A.
+				PublicKey:                   keyB,
+				Endpoint:                    ep,
+				PersistentKeepaliveInterval: &keepalive,
+				ReplaceAllowedIPs:           true,
+				AllowedIPs:                  []net.IPNet{ipB, ipC},
+			},
+			{PublicKey: keyC, Remove: true},
+			{PublicKey: keyD, UpdateOnly: true},
+		},
+	})
+
+	want := &wgtypes.Device{
+		Name:             "wg0",
+		PrivateKey:       priv,
+		PublicKey:        priv.PublicKey(),
+		ListenPort:       port,
+		AdvancedSecurity: wgtypes.AdvancedSecurity{JunkPacketCount: jc},
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:    keyA,
+				PresharedKey: psk,
+				AllowedIPs:   []net.IPNet{ipA},
+				ReceiveBytes: 1,
+			},
+			{
+				PublicKey:                   keyB,
+				Endpoint:                    ep,
+				PersistentKeepaliveInterval: keepalive,
+				AllowedIPs:                  []net.IPNet{ipB, ipC},
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected device (-want +got):\n%s", diff)
+	}
+
+	// The original device must not be modified.
+	if diff := cmp.Diff([]net.IPNet{ipA, ipB}, d.Peers[0].AllowedIPs); diff != "" {
+		t.Fatalf("original device was modified (-want +got):\n%s", diff)
+	}
+
+	replaced := wgtypes.Preview(d, wgtypes.Config{
+		ReplacePeers: true,
+		Peers:        []wgtypes.PeerConfig{{PublicKey: keyD}},
+	})
+
+	if diff := cmp.Diff([]wgtypes.Peer{{PublicKey: keyD}}, replaced.Peers); diff != "" {
+		t.Fatalf("unexpected replaced peers (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,211 @@
+package wgtypes
+
+import "net"
+
+// Reconcile returns the smallest Config which, applied to d, makes the
+// configuration of d match cfg with the semantics of wg syncconf: peers of d
+// which are not in cfg are removed, and the allowed IPs of each peer in cfg
+// are exactly those in cfg. Neither argument is modified.
+//
+// Unlike applying cfg with ReplacePeers, which removes and re-adds every
+// peer, the result only contains the fields which differ, so that the
+// sessions of unchanged peers are not disturbed. Existing peers are updated
+// using UpdateOnly, and their allowed IPs are only replaced if they differ.
+// As with Config, nil pointer fields of cfg leave the current value of d
+// unchanged, and ReplacePeers is ignored.
+//
+// A peer of cfg whose Endpoint is nil but which has AlternateEndpoints is
+// only given a new endpoint if its current endpoint is not one of them, so
+// that a failover is not undone. If d already matches cfg, the zero Config
+// is returned.
+func Reconcile(d *Device, cfg Config) Config {
+	var out Config
+	if cfg.PrivateKey != nil && *cfg.PrivateKey != d.PrivateKey {
+		out.PrivateKey = cfg.PrivateKey
+	}
+	if cfg.ListenPort != nil && *cfg.ListenPort != d.ListenPort {
+		out.ListenPort = cfg.ListenPort
+	}
+	if cfg.FirewallMark != nil && *cfg.FirewallMark != d.FirewallMark {
+		out.FirewallMark = cfg.FirewallMark
+	}
+
+	// Both lists of fields are in UAPI order.
+	afs := d.AdvancedSecurity.uapiFields()
+	ofs := out.AdvancedSecurityConfig.uapiFields()
+	for i, f := range cfg.AdvancedSecurityConfig.uapiFields() {
+		switch {
+		case f.u16 != nil && *f.u16 != nil && **f.u16 != *afs[i].u16:
+			*ofs[i].u16 = *f.u16
+		case f.u32 != nil && *f.u32 != nil && **f.u32 != *afs[i].u32:
+			*ofs[i].u32 = *f.u32
+		case f.str != nil && *f.str != nil && **f.str != *afs[i].str:
+			*ofs[i].str = *f.str
+		}
+	}
+
+	cur := make(map[Key]*Peer, len(d.Peers))
+	for i := range d.Peers {
+		cur[d.Peers[i].PublicKey] = &d.Peers[i]
+	}
+
+	want := make(map[Key]bool, len(cfg.Peers))
+	for _, pc := range cfg.Peers {
+		if pc.Remove {
+			continue
+		}
+		want[pc.PublicKey] = true
+
+		p, ok := cur[pc.PublicKey]
+		if !ok {
+			pc.UpdateOnly = false
+			pc.ReplaceAllowedIPs = false
+			pc.AllowedIPs = append([]net.IPNet(nil), pc.AllowedIPs...)
+			out.Peers = append(out.Peers, pc)
+			continue
+		}
+
+		if pc, ok := reconcilePeer(p, pc); ok {
+			out.Peers = append(out.Peers, pc)
+		}
+	}
+
+	for _, p := range d.Peers {
+		if !want[p.PublicKey] {
+			out.Peers = append(out.Peers, PeerConfig{PublicKey: p.PublicKey, Remove: true})
+		}
+	}
+
+	return out
+}
+
+// reconcilePeer returns the PeerConfig which updates the existing peer p to
+// match pc, and whether any update is needed.
+func reconcilePeer(p *Peer, pc PeerConfig) (PeerConfig, bool) {
+	out := PeerConfig{PublicKey: p.PublicKey, UpdateOnly: true}
+	changed := false
+
+	if pc.PresharedKey != nil && *pc.PresharedKey != p.PresharedKey {
+		out.PresharedKey, changed = pc.PresharedKey, true
+	}
+
+	switch {
+	case pc.Endpoint != nil:
+		if !equalUDPAddr(pc.Endpoint, p.Endpoint) {
+			out.Endpoint, changed = pc.Endpoint, true
+		}
+	case len(pc.AlternateEndpoints) > 0:
+		if !containsUDPAddr(pc.AlternateEndpoints, p.Endpoint) {
+			out.Endpoint, changed = pc.AlternateEndpoints[0], true
+		}
+	}
+
+	if ka := pc.PersistentKeepaliveInterval; ka != nil && *ka != p.PersistentKeepaliveInterval {
+		out.PersistentKeepaliveInterval, changed = ka, true
+	}
+
+	if !equalIPNets(pc.AllowedIPs, p.AllowedIPs) {
+		out.ReplaceAllowedIPs = true
+		out.AllowedIPs = append([]net.IPNet(nil), pc.AllowedIPs...)
+		changed = true
+	}
+
+	return out, changed
+}
+
+// equalIPNets reports whether a and b contain the same networks, in any
+// order.
+func equalIPNets(a, b []net.IPNet) bool {
+	for _, ipn := range a {
+		if !containsIPNet(b, ipn) {
+			return false
+		}
+	}
+	for _, ipn := range b {
+		if !containsIPNet(a, ipn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalUDPAddr reports whether a and b are the same address. A nil address
+// is only equal to another nil address.
+func equalUDPAddr(a, b *net.UDPAddr) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.IP.Equal(b.IP) && a.Port == b.Port && a.Zone == b.Zone
+}
+
+// containsUDPAddr reports whether addrs contains an address equal to addr.
+func containsUDPAddr(addrs []*net.UDPAddr, addr *net.UDPAddr) bool {
+	for _, a := range addrs {
+		if equalUDPAddr(a, addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeviceConfig returns a Config which, reconciled against any device using
+// Reconcile, makes its configuration match that of d, such as to restore d
+// after it was changed. Every field of d is set, including its keys, so the
+// result should not be shared. Peers of d must not have deferred allowed IPs;
+// see Peer.LazyAllowedIPs.
+func DeviceConfig(d *Device) Config {
+	var (
+		priv = d.PrivateKey
+		port = d.ListenPort
+		mark = d.FirewallMark
+		as   = d.AdvancedSecurity
+	)
+
+	cfg := Config{
+		PrivateKey:   &priv,
+		ListenPort:   &port,
+		FirewallMark: &mark,
+		AdvancedSecurityConfig: AdvancedSecurityConfig{
+			JunkPacketCount:            &as.JunkPacketCount,
+			JunkPacketMinSize:          &as.JunkPacketMinSize,
+			JunkPacketMaxSize:          &as.JunkPacketMaxSize,
+			InitPacketJunkSize:         &as.InitPacketJunkSize,
+			ResponsePacketJunkSize:     &as.ResponsePacketJunkSize,
+			UnderloadPacketJunkSize:    &as.UnderloadPacketJunkSize,
+			TransportPacketJunkSize:    &as.TransportPacketJunkSize,
+			InitPacketMagicHeader:      &as.InitPacketMagicHeader,
+			ResponsePacketMagicHeader:  &as.ResponsePacketMagicHeader,
+			UnderloadPacketMagicHeader: &as.UnderloadPacketMagicHeader,
+			TransportPacketMagicHeader: &as.TransportPacketMagicHeader,
+			SpecialJunkPacket1:         &as.SpecialJunkPacket1,
+			SpecialJunkPacket2:         &as.SpecialJunkPacket2,
+			SpecialJunkPacket3:         &as.SpecialJunkPacket3,
+			SpecialJunkPacket4:         &as.SpecialJunkPacket4,
+			SpecialJunkPacket5:         &as.SpecialJunkPacket5,
+			SpecialJunkInterval:        &as.SpecialJunkInterval,
+		},
+		Peers: make([]PeerConfig, 0, len(d.Peers)),
+	}
+
+	for _, p := range d.Peers {
+		var (
+			// Restore an unset preshared key as well.
+			psk       = p.PresharedKey
+			keepalive = p.PersistentKeepaliveInterval
+		)
+
+		cfg.Peers = append(cfg.Peers, PeerConfig{
+			PublicKey:                   p.PublicKey,
+			PresharedKey:                &psk,
+			Endpoint:                    p.Endpoint,
+			PersistentKeepaliveInterval: &keepalive,
+			ReplaceAllowedIPs:           true,
+			AllowedIPs:                  append([]net.IPNet(nil), p.AllowedIPs...),
+		})
+	}
+
+	return cfg
+}
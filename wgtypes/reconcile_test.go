@@ -0,0 +1,205 @@
+package wgtypes_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReconcile(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		keyC = wgtest.MustPublicKey()
+		ipA  = wgtest.MustCIDR("10.0.0.1/32")
+		ipB  = wgtest.MustCIDR("10.0.0.2/32")
+		ipC  = wgtest.MustCIDR("10.0.0.3/32")
+		epA  = wgtest.MustUDPAddr("192.0.2.1:51820")
+		epB  = wgtest.MustUDPAddr("192.0.2.2:51820")
+
+		port, otherPort = 51820, 51821
+		jc              = uint16(4)
+		keepalive       = 25 * time.Second
+	)
+
+	d := &wgtypes.Device{
+		PrivateKey:       priv,
+		ListenPort:       port,
+		AdvancedSecurity: wgtypes.AdvancedSecurity{JunkPacketCount: jc},
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:                   keyA,
+				Endpoint:                    epA,
+				PersistentKeepaliveInterval: keepalive,
+				AllowedIPs:                  []net.IPNet{ipA, ipC},
+			},
+			{
+				PublicKey:  keyB,
+				Endpoint:   epB,
+				AllowedIPs: []net.IPNet{ipB},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		cfg  wgtypes.Config
+		want wgtypes.Config
+	}{
+		{
+			name: "unchanged",
+			cfg: wgtypes.Config{
+				PrivateKey: &priv,
+				ListenPort: &port,
+				AdvancedSecurityConfig: wgtypes.AdvancedSecurityConfig{
+					JunkPacketCount: &jc,
+				},
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey:                   keyA,
+						Endpoint:                    epA,
+						PersistentKeepaliveInterval: &keepalive,
+						// Order does not matter.
+						AllowedIPs: []net.IPNet{ipC, ipA},
+					},
+					{
+						PublicKey: keyB,
+						// The endpoint is one of the alternates.
+						AlternateEndpoints: []*net.UDPAddr{epA, epB},
+						AllowedIPs:         []net.IPNet{ipB},
+					},
+				},
+			},
+		},
+		{
+			name: "device fields",
+			cfg: wgtypes.Config{
+				ListenPort: &otherPort,
+				Peers: []wgtypes.PeerConfig{
+					{PublicKey: keyA, AllowedIPs: []net.IPNet{ipA, ipC}},
+					{PublicKey: keyB, AllowedIPs: []net.IPNet{ipB}},
+				},
+			},
+			want: wgtypes.Config{ListenPort: &otherPort},
+		},
+		{
+			name: "peers",
+			cfg: wgtypes.Config{
+				ReplacePeers: true,
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey:    keyA,
+						PresharedKey: &psk,
+						AllowedIPs:   []net.IPNet{ipA},
+					},
+					{
+						PublicKey:         keyC,
+						UpdateOnly:        true,
+						ReplaceAllowedIPs: true,
+						Endpoint:          epB,
+						AllowedIPs:        []net.IPNet{ipB},
+					},
+				},
+			},
+			want: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey:         keyA,
+						UpdateOnly:        true,
+						PresharedKey:      &psk,
+						ReplaceAllowedIPs: true,
+						AllowedIPs:        []net.IPNet{ipA},
+					},
+					{
+						PublicKey:  keyC,
+						Endpoint:   epB,
+						AllowedIPs: []net.IPNet{ipB},
+					},
+					{
+						PublicKey: keyB,
+						Remove:    true,
+					},
+				},
+			},
+		},
+		{
+			name: "alternate endpoint",
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{PublicKey: keyA, AllowedIPs: []net.IPNet{ipA, ipC}},
+					{
+						PublicKey:          keyB,
+						AlternateEndpoints: []*net.UDPAddr{epA},
+						AllowedIPs:         []net.IPNet{ipB},
+					},
+				},
+			},
+			want: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:  keyB,
+					UpdateOnly: true,
+					Endpoint:   epA,
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wgtypes.Reconcile(d, tt.cfg)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeviceConfig(t *testing.T) {
+	var (
+		psk  = wgtest.MustPresharedKey()
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+	)
+
+	d := &wgtypes.Device{
+		PrivateKey:       wgtest.MustPrivateKey(),
+		ListenPort:       51820,
+		AdvancedSecurity: wgtypes.AdvancedSecurity{JunkPacketCount: 4},
+		Peers: []wgtypes.Peer{{
+			PublicKey:                   keyA,
+			PresharedKey:                psk,
+			Endpoint:                    wgtest.MustUDPAddr("192.0.2.1:51820"),
+			PersistentKeepaliveInterval: 25 * time.Second,
+			AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("10.0.0.1/32")},
+		}},
+	}
+
+	// A device already matching its own configuration needs no changes.
+	if diff := cmp.Diff(wgtypes.Config{}, wgtypes.Reconcile(d, wgtypes.DeviceConfig(d))); diff != "" {
+		t.Fatalf("unexpected configuration (-want +got):\n%s", diff)
+	}
+
+	// Change every setting, then restore d.
+	changed := &wgtypes.Device{
+		PrivateKey: wgtest.MustPrivateKey(),
+		ListenPort: 51821,
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:  keyA,
+				AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")},
+			},
+			{PublicKey: keyB},
+		},
+	}
+
+	got := wgtypes.Preview(changed, wgtypes.Reconcile(changed, wgtypes.DeviceConfig(d)))
+	if diff := wgtypes.Diff(d, got); len(diff) > 0 {
+		t.Fatalf("device was not restored: %v", diff)
+	}
+}
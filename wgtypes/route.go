@@ -0,0 +1,50 @@
+package wgtypes
+
+import "net"
+
+// IsDefaultRoute reports whether n is the IPv4 or IPv6 default route,
+// 0.0.0.0/0 or ::/0. IPv4 routes in 16-byte form, such as those produced by
+// some parsers, are also recognized. Networks with a non-canonical mask are
+// never a default route.
+func IsDefaultRoute(n net.IPNet) bool {
+	ones, bits := n.Mask.Size()
+	if ones != 0 || bits == 0 {
+		// Either a non-zero prefix length or a non-canonical mask.
+		return false
+	}
+
+	switch bits {
+	case 8 * net.IPv4len:
+		return n.IP.To4() != nil && n.IP.To4().Equal(net.IPv4zero.To4())
+	case 8 * net.IPv6len:
+		return len(n.IP) == net.IPv6len && n.IP.Equal(net.IPv6zero)
+	default:
+		return false
+	}
+}
+
+// HasDefaultRoute reports whether any of p's allowed IPs is a default route
+// according to IsDefaultRoute.
+func (p Peer) HasDefaultRoute() bool {
+	for _, ip := range p.AllowedIPs {
+		if IsDefaultRoute(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FullTunnelPeer returns the first peer of d which is configured with an IPv4
+// or IPv6 default route. Because WireGuard routes each allowed IP to a single
+// peer, at most one peer may carry the IPv4 default route and one the IPv6
+// default route. FullTunnelPeer reports false if no such peer exists.
+func (d *Device) FullTunnelPeer() (*Peer, bool) {
+	for i := range d.Peers {
+		if d.Peers[i].HasDefaultRoute() {
+			return &d.Peers[i], true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,79 @@
+package wgtypes_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+)
+
+func TestIsDefaultRoute(t *testing.T) {
+	tests := []struct {
+		name string
+		n    net.IPNet
+		ok   bool
+	}{
+		{name: "IPv4", n: wgtest.MustCIDR("0.0.0.0/0"), ok: true},
+		{name: "IPv6", n: wgtest.MustCIDR("::/0"), ok: true},
+		{
+			name: "IPv4 16-byte",
+			n:    net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)},
+			ok:   true,
+		},
+		{name: "IPv4 host bits", n: net.IPNet{IP: net.IPv4(10, 0, 0, 1), Mask: net.CIDRMask(0, 32)}},
+		{name: "IPv4 split", n: wgtest.MustCIDR("0.0.0.0/1")},
+		{name: "IPv4 host", n: wgtest.MustCIDR("10.0.0.1/32")},
+		{name: "IPv6 split", n: wgtest.MustCIDR("::/1")},
+		{
+			name: "IPv4 address with IPv6 mask",
+			n:    net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 128)},
+		},
+		{
+			name: "non-canonical mask",
+			n:    net.IPNet{IP: net.IPv4zero.To4(), Mask: net.IPMask{0xff, 0x00, 0xff, 0x00}},
+		},
+		{name: "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wgtypes.IsDefaultRoute(tt.n); got != tt.ok {
+				t.Fatalf("unexpected result for %s: want %v, got %v", tt.n.String(), tt.ok, got)
+			}
+		})
+	}
+}
+
+func TestDeviceFullTunnelPeer(t *testing.T) {
+	var (
+		split = wgtest.MustPublicKey()
+		full  = wgtest.MustPublicKey()
+	)
+
+	d := &wgtypes.Device{
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:  split,
+				AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.0/8")},
+			},
+			{
+				PublicKey: full,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("10.1.0.0/16"),
+					wgtest.MustCIDR("::/0"),
+				},
+			},
+		},
+	}
+
+	p, ok := d.FullTunnelPeer()
+	if !ok || p.PublicKey != full {
+		t.Fatalf("expected full tunnel peer %s, but got: %v, %v", full, p, ok)
+	}
+
+	d.Peers = d.Peers[:1]
+	if p, ok := d.FullTunnelPeer(); ok {
+		t.Fatalf("expected no full tunnel peer, but got: %v", p.PublicKey)
+	}
+}
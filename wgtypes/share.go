@@ -0,0 +1,149 @@
+package wgtypes
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ShareScheme is the URI scheme used by Share.URI.
+const ShareScheme = "wireguard"
+
+// checksumLen is the number of bytes of a key's SHA-256 digest used as its
+// share checksum.
+const checksumLen = 4
+
+// A Share is the public information a peer exchanges with another party so
+// that it may be configured as a peer, such as in a QR code.
+type Share struct {
+	// PublicKey is the public key of the peer.
+	PublicKey Key
+
+	// Endpoint is an optional "host:port" address at which the peer can be
+	// reached. Host may be a DNS name.
+	Endpoint string
+
+	// AllowedIPs are optional IP addresses which the peer will accept
+	// traffic from.
+	AllowedIPs []net.IPNet
+}
+
+// URI encodes s as a URI of the form:
+//
+//	wireguard://<key>@<host>:<port>?allowed-ips=<cidr>,<cidr>
+//
+// where key is the unpadded URL-safe base64 encoding of s.PublicKey. If
+// s.Endpoint is empty, the opaque form "wireguard:<key>" is used instead.
+func (s Share) URI() string {
+	u := url.URL{Scheme: ShareScheme}
+
+	key := base64.RawURLEncoding.EncodeToString(s.PublicKey[:])
+	if s.Endpoint == "" {
+		u.Opaque = key
+	} else {
+		u.User = url.User(key)
+		u.Host = s.Endpoint
+	}
+
+	if len(s.AllowedIPs) > 0 {
+		ips := make([]string, 0, len(s.AllowedIPs))
+		for _, ip := range s.AllowedIPs {
+			ips = append(ips, ip.String())
+		}
+
+		// Commas and slashes needn't be escaped in a query, so keep the
+		// URI short for QR codes.
+		u.RawQuery = "allowed-ips=" + strings.Join(ips, ",")
+	}
+
+	return u.String()
+}
+
+// ParseShareURI parses a Share from a URI produced by Share.URI.
+func ParseShareURI(s string) (Share, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Share{}, fmt.Errorf("wgtypes: failed to parse share URI: %v", err)
+	}
+	if u.Scheme != ShareScheme {
+		return Share{}, fmt.Errorf("wgtypes: unexpected share URI scheme %q", u.Scheme)
+	}
+
+	var (
+		sh  Share
+		key string
+	)
+
+	switch {
+	case u.Opaque != "":
+		key = u.Opaque
+	case u.User != nil:
+		key = u.User.Username()
+		sh.Endpoint = u.Host
+		if _, _, err := net.SplitHostPort(sh.Endpoint); err != nil {
+			return Share{}, fmt.Errorf("wgtypes: invalid share URI endpoint: %v", err)
+		}
+	default:
+		return Share{}, errors.New("wgtypes: share URI has no public key")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil {
+		return Share{}, fmt.Errorf("wgtypes: failed to parse share URI key: %v", err)
+	}
+	if sh.PublicKey, err = NewKey(b); err != nil {
+		return Share{}, err
+	}
+
+	if ips := u.Query().Get("allowed-ips"); ips != "" {
+		for _, ip := range strings.Split(ips, ",") {
+			_, cidr, err := net.ParseCIDR(ip)
+			if err != nil {
+				return Share{}, fmt.Errorf("wgtypes: failed to parse share URI allowed IP: %v", err)
+			}
+
+			sh.AllowedIPs = append(sh.AllowedIPs, *cidr)
+		}
+	}
+
+	return sh, nil
+}
+
+// ShareString encodes k as a base64 string followed by a colon and a short
+// hexadecimal checksum, such as "<key>:1a2b3c4d". The checksum allows
+// ParseShareString to detect keys which were mistyped or truncated when
+// copied by hand.
+func (k Key) ShareString() string {
+	return k.String() + ":" + keyChecksum(k)
+}
+
+// ParseShareString parses a Key from a string produced by Key.ShareString, and
+// verifies its checksum.
+func ParseShareString(s string) (Key, error) {
+	ks, sum, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return Key{}, errors.New("wgtypes: share string has no checksum")
+	}
+
+	k, err := ParseKey(ks)
+	if err != nil {
+		return Key{}, err
+	}
+
+	if !strings.EqualFold(sum, keyChecksum(k)) {
+		return Key{}, errors.New("wgtypes: share string checksum mismatch")
+	}
+
+	return k, nil
+}
+
+// keyChecksum returns the hex-encoded share checksum of k.
+func keyChecksum(k Key) string {
+	sum := sha256.Sum256(k[:])
+	return hex.EncodeToString(sum[:checksumLen])
+}
@@ -0,0 +1,113 @@
+package wgtypes_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestShareURI(t *testing.T) {
+	key := wgtest.MustHexKey("e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a")
+
+	tests := []struct {
+		name string
+		s    wgtypes.Share
+		uri  string
+	}{
+		{
+			name: "key only",
+			s:    wgtypes.Share{PublicKey: key},
+			uri:  "wireguard:6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA_rpSAno",
+		},
+		{
+			name: "full",
+			s: wgtypes.Share{
+				PublicKey: key,
+				Endpoint:  "vpn.example.com:51820",
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("10.0.0.0/24"),
+					wgtest.MustCIDR("fd00::/64"),
+				},
+			},
+			uri: "wireguard://6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA_rpSAno@vpn.example.com:51820?allowed-ips=10.0.0.0/24,fd00::/64",
+		},
+		{
+			name: "IPv6 endpoint",
+			s: wgtypes.Share{
+				PublicKey: key,
+				Endpoint:  "[2001:db8::1]:51820",
+			},
+			uri: "wireguard://6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA_rpSAno@[2001:db8::1]:51820",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.uri, tt.s.URI()); diff != "" {
+				t.Fatalf("unexpected URI (-want +got):\n%s", diff)
+			}
+
+			s, err := wgtypes.ParseShareURI(tt.uri)
+			if err != nil {
+				t.Fatalf("failed to parse URI: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.s, s); diff != "" {
+				t.Fatalf("unexpected Share (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseShareURIErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+	}{
+		{name: "scheme", uri: "https://6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA_rpSAno@example.com:443"},
+		{name: "no key", uri: "wireguard://example.com:51820"},
+		{name: "bad key", uri: "wireguard:AAAA"},
+		{name: "no port", uri: "wireguard://6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA_rpSAno@example.com"},
+		{name: "bad allowed IP", uri: "wireguard:6EtabScXwQA6E7QxVwNT26ypFGzxUMX4V1aA_rpSAno?allowed-ips=10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := wgtypes.ParseShareURI(tt.uri); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestKeyShareString(t *testing.T) {
+	key := wgtest.MustPublicKey()
+
+	s := key.ShareString()
+	got, err := wgtypes.ParseShareString(s)
+	if err != nil {
+		t.Fatalf("failed to parse share string: %v", err)
+	}
+
+	if diff := cmp.Diff(key, got); diff != "" {
+		t.Fatalf("unexpected key (-want +got):\n%s", diff)
+	}
+
+	// Corrupt a single character of the key.
+	b := []byte(s)
+	if b[0] == 'A' {
+		b[0] = 'B'
+	} else {
+		b[0] = 'A'
+	}
+
+	for _, bad := range []string{string(b), key.String(), strings.Split(s, ":")[0] + ":00000000"} {
+		if _, err := wgtypes.ParseShareString(bad); err == nil {
+			t.Fatalf("expected an error for %q, but none occurred", bad)
+		}
+	}
+}
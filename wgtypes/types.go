@@ -30,6 +30,18 @@ const (
 	AmneziaClient
 )
 
+// String returns the string representation of a ClientType.
+func (ct ClientType) String() string {
+	switch ct {
+	case NativeClient:
+		return "native"
+	case AmneziaClient:
+		return "amnezia"
+	default:
+		return "unknown"
+	}
+}
+
 // String returns the string representation of a DeviceType.
 func (dt DeviceType) String() string {
 	switch dt {
@@ -59,29 +71,49 @@ type AdvancedSecurity struct {
 	InitPacketJunkSize uint16
 	// S2
 	ResponsePacketJunkSize uint16
+	// S3
+	//
+	// The number of junk bytes prepended to cookie reply messages. Added in
+	// AmneziaWG 1.5.
+	UnderloadPacketJunkSize uint16
+	// S4
+	//
+	// The number of junk bytes prepended to transport data messages, which
+	// reduces the space available for tunneled packets. Added in AmneziaWG
+	// 1.5.
+	TransportPacketJunkSize uint16
 	// H1
 	InitPacketMagicHeader uint32
 	// H2
 	ResponsePacketMagicHeader uint32
 	// H3
+	//
+	// The magic header of cookie reply messages, which a device sends
+	// instead of a handshake response while it is under load. It is only a
+	// message type and does not indicate whether the device is under load;
+	// no implementation reports that state.
 	UnderloadPacketMagicHeader uint32
 	// H4
 	TransportPacketMagicHeader uint32
+	// I1 to I5
+	//
+	// The special junk packets sent before each handshake initiation, in
+	// the AmneziaWG tag format, such as "<b 0xf6ab3267fa><r 16>". An empty
+	// value sends no packet. Added in AmneziaWG 1.5.
+	SpecialJunkPacket1 string
+	SpecialJunkPacket2 string
+	SpecialJunkPacket3 string
+	SpecialJunkPacket4 string
+	SpecialJunkPacket5 string
+	// Itime
+	//
+	// The interval in seconds after which special junk packets are sent
+	// again. Added in AmneziaWG 1.5.
+	SpecialJunkInterval uint32
 }
 
 func (a AdvancedSecurity) IsEnabled() bool {
-	ret := false
-	ret = ret || a.JunkPacketCount != 0
-	ret = ret || a.JunkPacketMinSize != 0
-	ret = ret || a.JunkPacketMaxSize != 0
-	ret = ret || a.InitPacketJunkSize != 0
-	ret = ret || a.ResponsePacketJunkSize != 0
-	ret = ret || a.InitPacketMagicHeader != 0
-	ret = ret || a.ResponsePacketMagicHeader != 0
-	ret = ret || a.UnderloadPacketMagicHeader != 0
-	ret = ret || a.TransportPacketMagicHeader != 0
-
-	return ret
+	return a != AdvancedSecurity{}
 }
 
 // A Device is a WireGuard device.
@@ -89,6 +121,11 @@ type Device struct {
 	// Name is the name of the device.
 	Name string
 
+	// Index is the network interface index of the device, which unlike Name
+	// is stable across renames. A value of 0 indicates that the index is
+	// unknown, such as for userspace devices without a network interface.
+	Index int
+
 	// Type specifies the underlying implementation of the device.
 	Type DeviceType
 
@@ -242,6 +279,13 @@ type Peer struct {
 	// indicates that all IPv6 addresses are allowed.
 	AllowedIPs []net.IPNet
 
+	// LazyAllowedIPs, if non-nil, holds the allowed IPs of this peer in place
+	// of AllowedIPs, which is then empty, so that they are only decoded when
+	// needed. It is only set for devices fetched by a Client created with the
+	// wgctrl.WithLazyAllowedIPs option. Use LoadAllowedIPs to access the
+	// allowed IPs of a peer in either case.
+	LazyAllowedIPs *LazyAllowedIPs
+
 	// ProtocolVersion specifies which version of the WireGuard protocol is used
 	// for this Peer.
 	//
@@ -255,10 +299,18 @@ type AdvancedSecurityConfig struct {
 	JunkPacketMaxSize          *uint16
 	InitPacketJunkSize         *uint16
 	ResponsePacketJunkSize     *uint16
+	UnderloadPacketJunkSize    *uint16
+	TransportPacketJunkSize    *uint16
 	InitPacketMagicHeader      *uint32
 	ResponsePacketMagicHeader  *uint32
 	UnderloadPacketMagicHeader *uint32
 	TransportPacketMagicHeader *uint32
+	SpecialJunkPacket1         *string
+	SpecialJunkPacket2         *string
+	SpecialJunkPacket3         *string
+	SpecialJunkPacket4         *string
+	SpecialJunkPacket5         *string
+	SpecialJunkInterval        *uint32
 }
 
 // A Config is a WireGuard device configuration.
@@ -318,6 +370,15 @@ type PeerConfig struct {
 	// Endpoint specifies the endpoint of this peer entry, if not nil.
 	Endpoint *net.UDPAddr
 
+	// AlternateEndpoints specifies endpoints to fail over to, in order, when
+	// a handshake can't be completed using the peer's current endpoint.
+	//
+	// Devices hold a single endpoint per peer, so AlternateEndpoints are
+	// never sent to a device; they are used by the failover controller
+	// in package wgendpoint. If Endpoint is nil, package wgctrl configures
+	// the first of AlternateEndpoints as the peer's endpoint.
+	AlternateEndpoints []*net.UDPAddr
+
 	// PersistentKeepaliveInterval specifies the persistent keepalive interval
 	// for this peer, if not nil.
 	//
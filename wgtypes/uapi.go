@@ -0,0 +1,275 @@
+package wgtypes
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A uapiField is an AdvancedSecurity field and its UAPI key. Exactly one of
+// u16, u32, or str is set.
+type uapiField struct {
+	key string
+	u16 *uint16
+	u32 *uint32
+	str *string
+
+	// optional fields were added in AmneziaWG 1.5, and are only written by
+	// WriteUAPI and MarshalJSON if they are not zero, so that the output for
+	// devices which don't use them is unchanged.
+	optional bool
+}
+
+// isZero reports whether the field's value is zero.
+func (f uapiField) isZero() bool {
+	switch {
+	case f.u16 != nil:
+		return *f.u16 == 0
+	case f.u32 != nil:
+		return *f.u32 == 0
+	default:
+		return *f.str == ""
+	}
+}
+
+// value returns the field's value in UAPI form.
+func (f uapiField) value() string {
+	switch {
+	case f.u16 != nil:
+		return strconv.FormatUint(uint64(*f.u16), 10)
+	case f.u32 != nil:
+		return strconv.FormatUint(uint64(*f.u32), 10)
+	default:
+		return *f.str
+	}
+}
+
+// uapiFields returns the fields of a in the order they are written by
+// WriteUAPI.
+func (a *AdvancedSecurity) uapiFields() []uapiField {
+	return []uapiField{
+		{key: "jc", u16: &a.JunkPacketCount},
+		{key: "jmin", u16: &a.JunkPacketMinSize},
+		{key: "jmax", u16: &a.JunkPacketMaxSize},
+		{key: "s1", u16: &a.InitPacketJunkSize},
+		{key: "s2", u16: &a.ResponsePacketJunkSize},
+		{key: "s3", u16: &a.UnderloadPacketJunkSize, optional: true},
+		{key: "s4", u16: &a.TransportPacketJunkSize, optional: true},
+		{key: "h1", u32: &a.InitPacketMagicHeader},
+		{key: "h2", u32: &a.ResponsePacketMagicHeader},
+		{key: "h3", u32: &a.UnderloadPacketMagicHeader},
+		{key: "h4", u32: &a.TransportPacketMagicHeader},
+		{key: "i1", str: &a.SpecialJunkPacket1, optional: true},
+		{key: "i2", str: &a.SpecialJunkPacket2, optional: true},
+		{key: "i3", str: &a.SpecialJunkPacket3, optional: true},
+		{key: "i4", str: &a.SpecialJunkPacket4, optional: true},
+		{key: "i5", str: &a.SpecialJunkPacket5, optional: true},
+		{key: "itime", u32: &a.SpecialJunkInterval, optional: true},
+	}
+}
+
+// A uapiConfigField is an AdvancedSecurityConfig field and its UAPI key.
+// Exactly one of u16, u32, or str is set.
+type uapiConfigField struct {
+	key string
+	u16 **uint16
+	u32 **uint32
+	str **string
+}
+
+// isSet reports whether the field is not nil.
+func (f uapiConfigField) isSet() bool {
+	switch {
+	case f.u16 != nil:
+		return *f.u16 != nil
+	case f.u32 != nil:
+		return *f.u32 != nil
+	default:
+		return *f.str != nil
+	}
+}
+
+// value returns the value of a set field in UAPI form.
+func (f uapiConfigField) value() string {
+	switch {
+	case f.u16 != nil:
+		return strconv.FormatUint(uint64(**f.u16), 10)
+	case f.u32 != nil:
+		return strconv.FormatUint(uint64(**f.u32), 10)
+	default:
+		return **f.str
+	}
+}
+
+// uapiFields returns the fields of c in the order they are written by
+// WriteUAPI.
+func (c *AdvancedSecurityConfig) uapiFields() []uapiConfigField {
+	return []uapiConfigField{
+		{key: "jc", u16: &c.JunkPacketCount},
+		{key: "jmin", u16: &c.JunkPacketMinSize},
+		{key: "jmax", u16: &c.JunkPacketMaxSize},
+		{key: "s1", u16: &c.InitPacketJunkSize},
+		{key: "s2", u16: &c.ResponsePacketJunkSize},
+		{key: "s3", u16: &c.UnderloadPacketJunkSize},
+		{key: "s4", u16: &c.TransportPacketJunkSize},
+		{key: "h1", u32: &c.InitPacketMagicHeader},
+		{key: "h2", u32: &c.ResponsePacketMagicHeader},
+		{key: "h3", u32: &c.UnderloadPacketMagicHeader},
+		{key: "h4", u32: &c.TransportPacketMagicHeader},
+		{key: "i1", str: &c.SpecialJunkPacket1},
+		{key: "i2", str: &c.SpecialJunkPacket2},
+		{key: "i3", str: &c.SpecialJunkPacket3},
+		{key: "i4", str: &c.SpecialJunkPacket4},
+		{key: "i5", str: &c.SpecialJunkPacket5},
+		{key: "itime", u32: &c.SpecialJunkInterval},
+	}
+}
+
+// WriteUAPI writes the AmneziaWG UAPI "key=value" lines for each field of a to
+// w, as returned by a "get" operation. The AmneziaWG 1.5 fields are only
+// written if they are set.
+func (a AdvancedSecurity) WriteUAPI(w io.Writer) error {
+	for _, f := range a.uapiFields() {
+		if f.optional && f.isZero() {
+			continue
+		}
+
+		if err := writeUAPI(w, f.key, f.value()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseUAPI parses the value of an AmneziaWG UAPI key into the matching field
+// of a. ParseUAPI reports false if key is not an AmneziaWG key. a is only
+// modified if the value is valid.
+func (a *AdvancedSecurity) ParseUAPI(key, value string) (bool, error) {
+	for _, f := range a.uapiFields() {
+		if f.key != key {
+			continue
+		}
+
+		switch {
+		case f.u16 != nil:
+			v, err := parseUAPIUint(key, value, 16)
+			if err == nil {
+				*f.u16 = uint16(v)
+			}
+			return true, err
+		case f.u32 != nil:
+			v, err := parseUAPIUint(key, value, 32)
+			if err == nil {
+				*f.u32 = uint32(v)
+			}
+			return true, err
+		default:
+			err := checkUAPIString(key, value)
+			if err == nil {
+				*f.str = value
+			}
+			return true, err
+		}
+	}
+
+	return false, nil
+}
+
+// WriteUAPI writes the AmneziaWG UAPI "key=value" lines for each non-nil field
+// of c to w, as sent in a "set" operation. Because UAPI keys which follow a
+// peer's public_key apply to that peer, the output must be written before any
+// peer configuration.
+func (c AdvancedSecurityConfig) WriteUAPI(w io.Writer) error {
+	for _, f := range c.uapiFields() {
+		if !f.isSet() {
+			continue
+		}
+
+		if err := writeUAPI(w, f.key, f.value()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseUAPI parses the value of an AmneziaWG UAPI key into the matching field
+// of c. ParseUAPI reports false if key is not an AmneziaWG key. c is only
+// modified if the value is valid.
+func (c *AdvancedSecurityConfig) ParseUAPI(key, value string) (bool, error) {
+	for _, f := range c.uapiFields() {
+		if f.key != key {
+			continue
+		}
+
+		switch {
+		case f.u16 != nil:
+			v, err := parseUAPIUint(key, value, 16)
+			if err == nil {
+				u := uint16(v)
+				*f.u16 = &u
+			}
+			return true, err
+		case f.u32 != nil:
+			v, err := parseUAPIUint(key, value, 32)
+			if err == nil {
+				u := uint32(v)
+				*f.u32 = &u
+			}
+			return true, err
+		default:
+			err := checkUAPIString(key, value)
+			if err == nil {
+				s := value
+				*f.str = &s
+			}
+			return true, err
+		}
+	}
+
+	return false, nil
+}
+
+// writeUAPI writes a single UAPI "key=value" line to w. Values which would
+// span multiple lines are rejected, as they would be interpreted as further
+// keys.
+func writeUAPI(w io.Writer, key, value string) error {
+	if err := checkUAPIString(key, value); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%s=%s\n", key, value)
+	return err
+}
+
+// isUAPIString reports whether key is the UAPI key of a string field.
+func isUAPIString(key string) bool {
+	for _, f := range (&AdvancedSecurity{}).uapiFields() {
+		if f.key == key {
+			return f.str != nil
+		}
+	}
+
+	return false
+}
+
+// checkUAPIString verifies that a string UAPI value fits on a single line.
+func checkUAPIString(key, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("wgtypes: invalid UAPI value for %q: value contains a line break", key)
+	}
+
+	return nil
+}
+
+// parseUAPIUint parses an unsigned integer UAPI value of the given bit size.
+func parseUAPIUint(key, value string, bits int) (uint64, error) {
+	v, err := strconv.ParseUint(value, 10, bits)
+	if err != nil {
+		return 0, fmt.Errorf("wgtypes: invalid UAPI value for %q: %v", key, err)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,173 @@
+package wgtypes_test
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAdvancedSecurityUAPI(t *testing.T) {
+	as := wgtypes.AdvancedSecurity{
+		JunkPacketCount:            4,
+		JunkPacketMinSize:          40,
+		JunkPacketMaxSize:          70,
+		InitPacketJunkSize:         15,
+		ResponsePacketJunkSize:     25,
+		InitPacketMagicHeader:      1,
+		ResponsePacketMagicHeader:  2,
+		UnderloadPacketMagicHeader: 3,
+		TransportPacketMagicHeader: 4294967295,
+	}
+
+	const want = "jc=4\njmin=40\njmax=70\ns1=15\ns2=25\nh1=1\nh2=2\nh3=3\nh4=4294967295\n"
+
+	var buf bytes.Buffer
+	if err := as.WriteUAPI(&buf); err != nil {
+		t.Fatalf("failed to write UAPI: %v", err)
+	}
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("unexpected UAPI (-want +got):\n%s", diff)
+	}
+
+	var (
+		got wgtypes.AdvancedSecurity
+		cfg wgtypes.AdvancedSecurityConfig
+	)
+
+	s := bufio.NewScanner(&buf)
+	for s.Scan() {
+		key, value, _ := strings.Cut(s.Text(), "=")
+
+		if ok, err := got.ParseUAPI(key, value); !ok || err != nil {
+			t.Fatalf("failed to parse %q: %v, %v", s.Text(), ok, err)
+		}
+		if ok, err := cfg.ParseUAPI(key, value); !ok || err != nil {
+			t.Fatalf("failed to parse config %q: %v, %v", s.Text(), ok, err)
+		}
+	}
+
+	if diff := cmp.Diff(as, got); diff != "" {
+		t.Fatalf("unexpected AdvancedSecurity (-want +got):\n%s", diff)
+	}
+
+	// The config must encode identically when every field is set.
+	buf.Reset()
+	if err := cfg.WriteUAPI(&buf); err != nil {
+		t.Fatalf("failed to write config UAPI: %v", err)
+	}
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("unexpected config UAPI (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvancedSecurityUAPIVersion15(t *testing.T) {
+	as := wgtypes.AdvancedSecurity{
+		JunkPacketCount:         4,
+		UnderloadPacketJunkSize: 30,
+		TransportPacketJunkSize: 40,
+		SpecialJunkPacket1:      "<b 0xf6ab3267fa><c><b 0xf6ab><t><r 10>",
+		SpecialJunkPacket3:      "<r 64>",
+		SpecialJunkInterval:     120,
+	}
+
+	// Unset AmneziaWG 1.5 fields are omitted.
+	const want = "jc=4\njmin=0\njmax=0\ns1=0\ns2=0\ns3=30\ns4=40\nh1=0\nh2=0\nh3=0\nh4=0\n" +
+		"i1=<b 0xf6ab3267fa><c><b 0xf6ab><t><r 10>\ni3=<r 64>\nitime=120\n"
+
+	var buf bytes.Buffer
+	if err := as.WriteUAPI(&buf); err != nil {
+		t.Fatalf("failed to write UAPI: %v", err)
+	}
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("unexpected UAPI (-want +got):\n%s", diff)
+	}
+
+	var (
+		got wgtypes.AdvancedSecurity
+		cfg wgtypes.AdvancedSecurityConfig
+	)
+
+	s := bufio.NewScanner(&buf)
+	for s.Scan() {
+		key, value, _ := strings.Cut(s.Text(), "=")
+
+		if ok, err := got.ParseUAPI(key, value); !ok || err != nil {
+			t.Fatalf("failed to parse %q: %v, %v", s.Text(), ok, err)
+		}
+		if ok, err := cfg.ParseUAPI(key, value); !ok || err != nil {
+			t.Fatalf("failed to parse config %q: %v, %v", s.Text(), ok, err)
+		}
+	}
+
+	if diff := cmp.Diff(as, got); diff != "" {
+		t.Fatalf("unexpected AdvancedSecurity (-want +got):\n%s", diff)
+	}
+
+	buf.Reset()
+	if err := cfg.WriteUAPI(&buf); err != nil {
+		t.Fatalf("failed to write config UAPI: %v", err)
+	}
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("unexpected config UAPI (-want +got):\n%s", diff)
+	}
+
+	// A value spanning lines would inject further keys.
+	i2 := "<r 16>\nprivate_key=00"
+	cfg.SpecialJunkPacket2 = &i2
+	if err := cfg.WriteUAPI(&bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestAdvancedSecurityConfigUAPIPartial(t *testing.T) {
+	jmax := uint16(1000)
+	cfg := wgtypes.AdvancedSecurityConfig{JunkPacketMaxSize: &jmax}
+
+	var buf bytes.Buffer
+	if err := cfg.WriteUAPI(&buf); err != nil {
+		t.Fatalf("failed to write UAPI: %v", err)
+	}
+
+	if diff := cmp.Diff("jmax=1000\n", buf.String()); diff != "" {
+		t.Fatalf("unexpected UAPI (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvancedSecurityParseUAPIErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		key, value string
+		ok         bool
+	}{
+		{name: "unknown key", key: "listen_port", value: "51820"},
+		{name: "not a number", key: "jc", value: "x", ok: true},
+		{name: "too large", key: "s1", value: "65536", ok: true},
+		{name: "negative", key: "h1", value: "-1", ok: true},
+		{name: "line break", key: "i1", value: "<r 16>\n<r 16>", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var as wgtypes.AdvancedSecurity
+			ok, err := as.ParseUAPI(tt.key, tt.value)
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected ok (-want +got):\n%s", diff)
+			}
+			if tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(wgtypes.AdvancedSecurity{}, as); diff != "" {
+				t.Fatalf("AdvancedSecurity was modified (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package wgtypes
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// MaxPersistentKeepaliveInterval is the largest persistent keepalive interval
+// supported by WireGuard, which transfers the interval as a number of seconds
+// stored in a 16-bit unsigned integer.
+const MaxPersistentKeepaliveInterval = 65535 * time.Second
+
+// A ValidationError indicates that a Config contains a value which cannot be
+// applied to a device.
+type ValidationError struct {
+	// Peer is the public key of the peer which contains the invalid value,
+	// or nil if the value belongs to the Config itself.
+	Peer *Key
+
+	// Field is the name of the Config or PeerConfig field which contains
+	// the invalid value.
+	Field string
+
+	// Reason describes why the value is invalid.
+	Reason string
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	if e.Peer != nil {
+		return fmt.Sprintf("wgtypes: invalid %s for peer %s: %s", e.Field, e.Peer.String(), e.Reason)
+	}
+
+	return fmt.Sprintf("wgtypes: invalid %s: %s", e.Field, e.Reason)
+}
+
+// Validate checks c for values which can't be applied consistently by every
+// device implementation, and returns a *ValidationError describing the first
+// such value it finds.
+func (c Config) Validate() error {
+	// UAPI is line-based, so a line break would inject further keys.
+	for _, f := range c.AdvancedSecurityConfig.uapiFields() {
+		if f.isSet() && checkUAPIString(f.key, f.value()) != nil {
+			return &ValidationError{
+				Field:  "AdvancedSecurityConfig",
+				Reason: fmt.Sprintf("%s contains a line break", strings.ToUpper(f.key)),
+			}
+		}
+	}
+
+	for _, p := range c.Peers {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate checks p for values which can't be applied consistently by every
+// device implementation, and returns a *ValidationError describing the first
+// such value it finds.
+func (p PeerConfig) Validate() error {
+	invalid := func(field, format string, v ...interface{}) error {
+		key := p.PublicKey
+		return &ValidationError{
+			Peer:   &key,
+			Field:  field,
+			Reason: fmt.Sprintf(format, v...),
+		}
+	}
+
+	// Keepalive intervals are transferred in whole seconds, so sub-second
+	// precision would be silently truncated by every backend.
+	if d := p.PersistentKeepaliveInterval; d != nil {
+		switch {
+		case *d < 0:
+			return invalid("PersistentKeepaliveInterval", "%s is negative", *d)
+		case *d%time.Second != 0:
+			return invalid("PersistentKeepaliveInterval", "%s is not a whole number of seconds", *d)
+		case *d > MaxPersistentKeepaliveInterval:
+			return invalid("PersistentKeepaliveInterval", "%s exceeds the maximum of %s", *d, MaxPersistentKeepaliveInterval)
+		}
+	}
+
+	for i, ep := range p.AlternateEndpoints {
+		if ep == nil {
+			return invalid("AlternateEndpoints", "endpoint %d is nil", i)
+		}
+	}
+
+	// Backends infer each allowed IP's address family and prefix length from
+	// its mask, and kernels reject mismatches with an unhelpful EINVAL.
+	for i, ipn := range p.AllowedIPs {
+		if _, reason := allowedIPPrefix(ipn); reason != "" {
+			return invalid("AllowedIPs", "allowed IP %d: %s", i, reason)
+		}
+	}
+
+	return nil
+}
+
+// AllowedIPPrefix converts allowed IP n to a netip.Prefix, inferring its
+// address family from n.IP: IPv4 addresses, including IPv4 addresses in
+// 16-byte form, produce IPv4 prefixes. An IPv4 address may also carry a
+// 128-bit mask of at least /96, as produced by parsing an IPv4-mapped IPv6
+// prefix such as ::ffff:10.0.0.0/104, which is converted to the equivalent
+// IPv4 prefix length.
+//
+// AllowedIPPrefix returns an error if n.IP is not a valid address or n.Mask
+// is not a valid mask for its address family.
+func AllowedIPPrefix(n net.IPNet) (netip.Prefix, error) {
+	pfx, reason := allowedIPPrefix(n)
+	if reason != "" {
+		return netip.Prefix{}, fmt.Errorf("wgtypes: invalid allowed IP: %s", reason)
+	}
+
+	return pfx, nil
+}
+
+// allowedIPPrefix implements AllowedIPPrefix, returning a description of why
+// n is invalid instead of an error.
+func allowedIPPrefix(n net.IPNet) (netip.Prefix, string) {
+	ones, bits := n.Mask.Size()
+
+	if ip4 := n.IP.To4(); ip4 != nil {
+		addr := netip.AddrFrom4([4]byte(ip4))
+
+		switch bits {
+		case 8 * net.IPv4len:
+		case 8 * net.IPv6len:
+			if ones < 96 {
+				return netip.Prefix{}, fmt.Sprintf("prefix length /%d of a 128-bit mask is invalid for IPv4 address %s", ones, addr)
+			}
+			ones -= 96
+		default:
+			return netip.Prefix{}, fmt.Sprintf("mask %s is not a valid mask for IPv4 address %s", n.Mask, addr)
+		}
+
+		return netip.PrefixFrom(addr, ones), ""
+	}
+
+	if len(n.IP) != net.IPv6len {
+		return netip.Prefix{}, fmt.Sprintf("IP address of length %d is not a valid IPv4 or IPv6 address", len(n.IP))
+	}
+
+	addr := netip.AddrFrom16([16]byte(n.IP))
+	if bits != 8*net.IPv6len {
+		if bits == 8*net.IPv4len {
+			return netip.Prefix{}, fmt.Sprintf("prefix length /%d of a 32-bit mask is invalid for IPv6 address %s", ones, addr)
+		}
+
+		return netip.Prefix{}, fmt.Sprintf("mask %s is not a valid mask for IPv6 address %s", n.Mask, addr)
+	}
+
+	return netip.PrefixFrom(addr, ones), ""
+}
@@ -0,0 +1,209 @@
+package wgtypes_test
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/danpashin/wgctrl/internal/wgtest"
+	"github.com/danpashin/wgctrl/wgtypes"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		keepalive  time.Duration
+		alternates []*net.UDPAddr
+		i1         string
+		field      string
+	}{
+		{
+			name: "zero keepalive",
+		},
+		{
+			name:      "OK keepalive",
+			keepalive: 25 * time.Second,
+		},
+		{
+			name:      "maximum keepalive",
+			keepalive: wgtypes.MaxPersistentKeepaliveInterval,
+		},
+		{
+			name:      "negative keepalive",
+			keepalive: -1 * time.Second,
+			field:     "PersistentKeepaliveInterval",
+		},
+		{
+			name:      "sub-second keepalive",
+			keepalive: 500 * time.Millisecond,
+			field:     "PersistentKeepaliveInterval",
+		},
+		{
+			name:      "fractional keepalive",
+			keepalive: 1500 * time.Millisecond,
+			field:     "PersistentKeepaliveInterval",
+		},
+		{
+			name:      "too large keepalive",
+			keepalive: wgtypes.MaxPersistentKeepaliveInterval + time.Second,
+			field:     "PersistentKeepaliveInterval",
+		},
+		{
+			name:       "OK alternate endpoints",
+			alternates: []*net.UDPAddr{{IP: net.IPv4(192, 0, 2, 1), Port: 51820}},
+		},
+		{
+			name:       "nil alternate endpoint",
+			alternates: []*net.UDPAddr{{IP: net.IPv4(192, 0, 2, 1), Port: 51820}, nil},
+			field:      "AlternateEndpoints",
+		},
+		{
+			name: "OK special junk packet",
+			i1:   "<b 0xf6ab3267fa><r 10>",
+		},
+		{
+			name:  "special junk packet line break",
+			i1:    "<r 10>\nlisten_port=1",
+			field: "AdvancedSecurityConfig",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PersistentKeepaliveInterval: &tt.keepalive,
+					AlternateEndpoints:          tt.alternates,
+				}},
+			}
+			if tt.i1 != "" {
+				cfg.AdvancedSecurityConfig.SpecialJunkPacket1 = &tt.i1
+			}
+
+			err := cfg.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("failed to validate: %v", err)
+				}
+
+				return
+			}
+
+			var verr *wgtypes.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected validation error, but got: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.field, verr.Field); diff != "" {
+				t.Fatalf("unexpected invalid field (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAllowedIPPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		ipn  net.IPNet
+		pfx  netip.Prefix
+		ok   bool
+	}{
+		{
+			name: "IPv4",
+			ipn:  wgtest.MustCIDR("192.0.2.0/24"),
+			pfx:  netip.MustParsePrefix("192.0.2.0/24"),
+			ok:   true,
+		},
+		{
+			name: "IPv4 16-byte address",
+			ipn:  net.IPNet{IP: net.ParseIP("192.0.2.1"), Mask: net.CIDRMask(32, 32)},
+			pfx:  netip.MustParsePrefix("192.0.2.1/32"),
+			ok:   true,
+		},
+		{
+			name: "IPv4-mapped mask",
+			ipn:  wgtest.MustCIDR("::ffff:10.0.0.0/104"),
+			pfx:  netip.MustParsePrefix("10.0.0.0/8"),
+			ok:   true,
+		},
+		{
+			name: "IPv6",
+			ipn:  wgtest.MustCIDR("2001:db8::/32"),
+			pfx:  netip.MustParsePrefix("2001:db8::/32"),
+			ok:   true,
+		},
+		{
+			name: "IPv6 default route",
+			ipn:  wgtest.MustCIDR("::/0"),
+			pfx:  netip.MustParsePrefix("::/0"),
+			ok:   true,
+		},
+		{
+			name: "no IP",
+			ipn:  net.IPNet{Mask: net.CIDRMask(32, 32)},
+		},
+		{
+			name: "bad IP length",
+			ipn:  net.IPNet{IP: net.IP{192, 0, 2}, Mask: net.CIDRMask(24, 32)},
+		},
+		{
+			name: "no mask",
+			ipn:  net.IPNet{IP: net.IPv4(192, 0, 2, 1)},
+		},
+		{
+			name: "non-canonical mask",
+			ipn:  net.IPNet{IP: net.IPv4(192, 0, 2, 1), Mask: net.IPv4Mask(255, 0, 255, 0)},
+		},
+		{
+			name: "IPv4 /33",
+			ipn:  net.IPNet{IP: net.IPv4(192, 0, 2, 1), Mask: net.CIDRMask(33, 128)},
+		},
+		{
+			name: "IPv4 long mask",
+			ipn:  net.IPNet{IP: net.IPv4(192, 0, 2, 1).To4(), Mask: net.IPMask{255, 255, 255, 255, 255}},
+		},
+		{
+			name: "IPv6 with IPv4 mask",
+			ipn:  net.IPNet{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(32, 32)},
+		},
+		{
+			name: "IPv6 /129",
+			ipn:  net.IPNet{IP: net.ParseIP("2001:db8::1"), Mask: append(net.CIDRMask(128, 128), 0x80)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pfx, err := wgtypes.AllowedIPPrefix(tt.ipn)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to convert allowed IP: %v", err)
+			}
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+
+				// Configs with the same allowed IP must fail validation.
+				cfg := wgtypes.Config{
+					Peers: []wgtypes.PeerConfig{{
+						AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.0/8"), tt.ipn},
+					}},
+				}
+
+				var verr *wgtypes.ValidationError
+				if err := cfg.Validate(); !errors.As(err, &verr) || verr.Field != "AllowedIPs" {
+					t.Fatalf("expected AllowedIPs validation error, but got: %v", err)
+				}
+
+				return
+			}
+
+			if pfx != tt.pfx {
+				t.Fatalf("unexpected prefix: want %s, got %s", tt.pfx, pfx)
+			}
+		})
+	}
+}